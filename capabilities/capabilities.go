@@ -0,0 +1,135 @@
+package capabilities
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+var nvidiaDevicePattern = regexp.MustCompile(`^nvidia[0-9]+$`)
+
+// Detect inspects the procfs, sysfs and devfs mounted under root to find the
+// capabilities of the cell. Capabilities that cannot be determined, e.g. on
+// Windows cells, are left empty.
+func Detect(logger lager.Logger, root string) executor.CellCapabilities {
+	logger = logger.Session("detect-capabilities")
+
+	capabilities := executor.CellCapabilities{
+		CPUFeatures:   cpuFeatures(logger, filepath.Join(root, "proc", "cpuinfo")),
+		GPUs:          countGPUs(logger, filepath.Join(root, "dev")),
+		KernelVersion: kernelVersion(logger, filepath.Join(root, "proc", "sys", "kernel", "osrelease")),
+		CgroupVersion: cgroupVersion(filepath.Join(root, "sys", "fs", "cgroup")),
+	}
+	capabilities.HugePagesTotal, capabilities.HugePageSizeKB = hugePages(logger, filepath.Join(root, "proc", "meminfo"))
+
+	logger.Info("detected", lager.Data{
+		"gpus":              capabilities.GPUs,
+		"huge-pages-total":  capabilities.HugePagesTotal,
+		"huge-page-size-kb": capabilities.HugePageSizeKB,
+		"kernel-version":    capabilities.KernelVersion,
+		"cgroup-version":    capabilities.CgroupVersion,
+	})
+
+	return capabilities
+}
+
+func cpuFeatures(logger lager.Logger, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Debug("failed-to-read-cpuinfo", lager.Data{"error": err.Error()})
+		return nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		// x86 reports "flags", arm reports "Features"
+		switch strings.TrimSpace(key) {
+		case "flags", "Features":
+			features := strings.Fields(value)
+			sort.Strings(features)
+			return features
+		}
+	}
+
+	return nil
+}
+
+func countGPUs(logger lager.Logger, devPath string) int {
+	entries, err := os.ReadDir(devPath)
+	if err != nil {
+		logger.Debug("failed-to-read-devices", lager.Data{"error": err.Error()})
+		return 0
+	}
+
+	gpus := 0
+	for _, entry := range entries {
+		if nvidiaDevicePattern.MatchString(entry.Name()) {
+			gpus++
+		}
+	}
+	return gpus
+}
+
+func hugePages(logger lager.Logger, path string) (int, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Debug("failed-to-read-meminfo", lager.Data{"error": err.Error()})
+		return 0, 0
+	}
+	defer file.Close()
+
+	var total, sizeKB int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch key {
+		case "HugePages_Total":
+			total, _ = strconv.Atoi(fields[0])
+		case "Hugepagesize":
+			sizeKB, _ = strconv.Atoi(fields[0])
+		}
+	}
+
+	return total, sizeKB
+}
+
+func kernelVersion(logger lager.Logger, path string) string {
+	release, err := os.ReadFile(path)
+	if err != nil {
+		logger.Debug("failed-to-read-kernel-version", lager.Data{"error": err.Error()})
+		return ""
+	}
+	return strings.TrimSpace(string(release))
+}
+
+func cgroupVersion(cgroupRoot string) int {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	if _, err := os.Stat(cgroupRoot); err == nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,60 @@
+package capabilities_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/capabilities"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Detect", func() {
+	var (
+		logger *lagertest.TestLogger
+		root   string
+	)
+
+	writeFile := func(path, contents string) {
+		path = filepath.Join(root, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		root = GinkgoT().TempDir()
+	})
+
+	It("detects the capabilities of the cell", func() {
+		writeFile("proc/cpuinfo", "processor\t: 0\nflags\t\t: sse4_2 avx2 aes\n\nprocessor\t: 1\nflags\t\t: sse4_2 avx2 aes\n")
+		writeFile("proc/meminfo", "MemTotal:       16314616 kB\nHugePages_Total:      16\nHugepagesize:       2048 kB\n")
+		writeFile("proc/sys/kernel/osrelease", "5.15.0-91-generic\n")
+		writeFile("sys/fs/cgroup/cgroup.controllers", "cpu memory pids\n")
+		writeFile("dev/nvidia0", "")
+		writeFile("dev/nvidia1", "")
+		writeFile("dev/nvidiactl", "")
+
+		Expect(capabilities.Detect(logger, root)).To(Equal(executor.CellCapabilities{
+			CPUFeatures:    []string{"aes", "avx2", "sse4_2"},
+			GPUs:           2,
+			HugePagesTotal: 16,
+			HugePageSizeKB: 2048,
+			KernelVersion:  "5.15.0-91-generic",
+			CgroupVersion:  2,
+		}))
+	})
+
+	It("detects cgroup v1 hierarchies", func() {
+		Expect(os.MkdirAll(filepath.Join(root, "sys/fs/cgroup/memory"), 0755)).To(Succeed())
+		Expect(capabilities.Detect(logger, root).CgroupVersion).To(Equal(1))
+	})
+
+	Context("when nothing can be detected", func() {
+		It("returns empty capabilities", func() {
+			Expect(capabilities.Detect(logger, root)).To(Equal(executor.CellCapabilities{}))
+		})
+	})
+})
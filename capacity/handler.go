@@ -0,0 +1,93 @@
+package capacity
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// totalRequest is the body of PUT /total. GPUs is only decoded to reject
+// requests that try to change them.
+type totalRequest struct {
+	executor.ExecutorResources
+	GPUs *int `json:"gpus"`
+}
+
+// Capacity is the JSON representation of what the cell advertises to the
+// scheduler.
+type Capacity struct {
+	Total         executor.ExecutorResources `json:"total"`
+	PlacementTags []string                   `json:"placement_tags"`
+}
+
+// Handler reads and changes the capacity of the cell, relative to the path it
+// is mounted on:
+//
+//	GET /
+//	PUT /total            {"memory_mb": 1024, "disk_mb": 2048, "containers": 10}
+//	PUT /placement-tags   ["some-tag"]
+//
+// The network, port and GPU pools and the exclusive cores of the cell cannot
+// be changed, and requests that set gpus are rejected. Totals that cannot hold
+// the containers already allocated on the cell are rejected.
+func Handler(logger lager.Logger, client executor.Client) http.Handler {
+	logger = logger.Session("capacity-handler")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := strings.Trim(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodGet && resource == "":
+		case r.Method == http.MethodPut && resource == "total":
+			var request totalRequest
+			err := json.NewDecoder(r.Body).Decode(&request)
+			total := request.ExecutorResources
+			if err != nil || request.GPUs != nil || total.MemoryMB < 0 || total.DiskMB < 0 || total.Containers < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			err = client.SetTotalResources(logger, total)
+			if err == executor.ErrInsufficientResourcesAvailable {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			if err != nil {
+				logger.Error("failed-to-set-total-resources", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		case r.Method == http.MethodPut && resource == "placement-tags":
+			var placementTags []string
+			err := json.NewDecoder(r.Body).Decode(&placementTags)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			client.SetPlacementTags(logger, placementTags)
+		case resource == "" || resource == "total" || resource == "placement-tags":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		total, err := client.TotalResources(logger)
+		if err != nil {
+			logger.Error("failed-to-get-total-resources", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		placementTags := client.PlacementTags(logger)
+		if placementTags == nil {
+			placementTags = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Capacity{Total: total, PlacementTags: placementTags})
+	})
+}
@@ -0,0 +1,110 @@
+package capacity_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/capacity"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		client  *fakes.FakeClient
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		client = &fakes.FakeClient{}
+		client.TotalResourcesReturns(executor.ExecutorResources{MemoryMB: 1024, DiskMB: 2048, Containers: 10}, nil)
+		client.PlacementTagsReturns([]string{"some-tag"})
+		handler = capacity.Handler(lagertest.NewTestLogger("test"), client)
+	})
+
+	serve := func(method, path, body string) (int, capacity.Capacity) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		var c capacity.Capacity
+		if response.Code == http.StatusOK {
+			Expect(json.Unmarshal(response.Body.Bytes(), &c)).To(Succeed())
+		}
+		return response.Code, c
+	}
+
+	It("returns the capacity of the cell", func() {
+		code, c := serve(http.MethodGet, "/", "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(c).To(Equal(capacity.Capacity{
+			Total:         executor.ExecutorResources{MemoryMB: 1024, DiskMB: 2048, Containers: 10},
+			PlacementTags: []string{"some-tag"},
+		}))
+	})
+
+	It("sets the total resources", func() {
+		code, _ := serve(http.MethodPut, "/total", `{"memory_mb": 512, "disk_mb": 1024, "containers": 5}`)
+		Expect(code).To(Equal(http.StatusOK))
+
+		Expect(client.SetTotalResourcesCallCount()).To(Equal(1))
+		_, total := client.SetTotalResourcesArgsForCall(0)
+		Expect(total).To(Equal(executor.ExecutorResources{MemoryMB: 512, DiskMB: 1024, Containers: 5}))
+	})
+
+	It("rejects changes to the GPUs of the cell", func() {
+		code, _ := serve(http.MethodPut, "/total", `{"memory_mb": 512, "gpus": 0}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		Expect(client.SetTotalResourcesCallCount()).To(Equal(0))
+	})
+
+	It("rejects negative resources", func() {
+		code, _ := serve(http.MethodPut, "/total", `{"memory_mb": -1}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		Expect(client.SetTotalResourcesCallCount()).To(Equal(0))
+	})
+
+	Context("when the total cannot hold the allocated containers", func() {
+		BeforeEach(func() {
+			client.SetTotalResourcesReturns(executor.ErrInsufficientResourcesAvailable)
+		})
+
+		It("responds with a conflict", func() {
+			code, _ := serve(http.MethodPut, "/total", `{"memory_mb": 1}`)
+			Expect(code).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Context("when setting the total fails", func() {
+		BeforeEach(func() {
+			client.SetTotalResourcesReturns(errors.New("boom"))
+		})
+
+		It("responds with an internal server error", func() {
+			code, _ := serve(http.MethodPut, "/total", `{"memory_mb": 1}`)
+			Expect(code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	It("sets the placement tags", func() {
+		code, _ := serve(http.MethodPut, "/placement-tags", `["tag-a", "tag-b"]`)
+		Expect(code).To(Equal(http.StatusOK))
+
+		Expect(client.SetPlacementTagsCallCount()).To(Equal(1))
+		_, placementTags := client.SetPlacementTagsArgsForCall(0)
+		Expect(placementTags).To(Equal([]string{"tag-a", "tag-b"}))
+	})
+
+	It("rejects other methods and paths", func() {
+		code, _ := serve(http.MethodDelete, "/total", "")
+		Expect(code).To(Equal(http.StatusMethodNotAllowed))
+
+		code, _ = serve(http.MethodGet, "/bogus", "")
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1 @@
+package capacity // import "code.cloudfoundry.org/executor/capacity"
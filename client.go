@@ -2,7 +2,9 @@ package executor
 
 import (
 	"io"
+	"time"
 
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/routing-info/internalroutes"
 )
@@ -14,18 +16,34 @@ type Client interface {
 	AllocateContainers(logger lager.Logger, traceID string, requests []AllocationRequest) []AllocationFailure
 	GetContainer(logger lager.Logger, guid string) (Container, error)
 	RunContainer(lager.Logger, string, *RunRequest) error
+	RunContainers(logger lager.Logger, traceID string, requests []RunRequest) []ContainerResult
 	UpdateContainer(lager.Logger, *UpdateRequest) error
 	StopContainer(logger lager.Logger, traceID string, guid string) error
 	DeleteContainer(logger lager.Logger, traceID string, guid string) error
+	StopContainers(logger lager.Logger, traceID string, selector ContainerSelector) []ContainerResult
+	DeleteContainers(logger lager.Logger, traceID string, selector ContainerSelector) []ContainerResult
 	ListContainers(lager.Logger) ([]Container, error)
+	ListContainersPage(logger lager.Logger, request ListContainersRequest) (ContainerPage, error)
 	GetBulkMetrics(lager.Logger) (map[string]Metrics, error)
 	RemainingResources(lager.Logger) (ExecutorResources, error)
 	TotalResources(lager.Logger) (ExecutorResources, error)
+	SetTotalResources(lager.Logger, ExecutorResources) error
+	Drain(logger lager.Logger, traceID string, deadline time.Duration) error
+	PlacementTags(lager.Logger) []string
+	SetPlacementTags(lager.Logger, []string)
+	Capabilities(lager.Logger) CellCapabilities
+	ScheduledTaskResults(lager.Logger) []ScheduledTaskResult
+	PrefetchArtifacts(logger lager.Logger, artifacts []PrefetchArtifact) error
+	PrefetchProgress(lager.Logger) PrefetchProgress
 	GetFiles(logger lager.Logger, guid string, path string) (io.ReadCloser, error)
+	StreamIn(logger lager.Logger, guid string, path string, tarStream io.Reader) error
 	VolumeDrivers(logger lager.Logger) ([]string, error)
-	SubscribeToEvents(lager.Logger) (EventSource, error)
+	RunProcess(logger lager.Logger, guid string, spec ProcessSpec, processIO ProcessIO) (Process, error)
+	SubscribeToEvents(logger lager.Logger, opts ...SubscribeOption) (EventSource, error)
 	Healthy(lager.Logger) bool
 	SetHealthy(lager.Logger, bool)
+	FeatureFlags(lager.Logger) []string
+	SetFeatureFlag(logger lager.Logger, name string, enabled bool) error
 	Cleanup(lager.Logger)
 }
 
@@ -36,6 +54,95 @@ type EventSource interface {
 	Close() error
 }
 
+// ProcessIO is streamed to and from a process run with RunProcess. Stderr is
+// not used when the process has a TTY.
+type ProcessIO struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+//go:generate counterfeiter -o fakes/fake_process.go . Process
+
+type Process interface {
+	ID() string
+	Wait() (int, error)
+	Resize(WindowSize) error
+	Kill() error
+}
+
+// EventSubscription selects the events of the containers in ContainerGuids
+// that are of one of EventTypes. Fields that are empty select all events.
+// When Replay is positive, the most recent Replay selected events that were
+// emitted before subscribing are delivered first, so that consumers that
+// reconnect do not miss what happened in between.
+type EventSubscription struct {
+	ContainerGuids []string
+	EventTypes     []EventType
+	Replay         int
+}
+
+type SubscribeOption func(*EventSubscription)
+
+func WithContainerGuids(guids ...string) SubscribeOption {
+	return func(s *EventSubscription) {
+		s.ContainerGuids = append(s.ContainerGuids, guids...)
+	}
+}
+
+func WithEventTypes(eventTypes ...EventType) SubscribeOption {
+	return func(s *EventSubscription) {
+		s.EventTypes = append(s.EventTypes, eventTypes...)
+	}
+}
+
+func WithReplay(events int) SubscribeOption {
+	return func(s *EventSubscription) {
+		s.Replay = events
+	}
+}
+
+func NewEventSubscription(opts ...SubscribeOption) EventSubscription {
+	subscription := EventSubscription{}
+	for _, opt := range opts {
+		opt(&subscription)
+	}
+	return subscription
+}
+
+// Matches reports whether the subscription selects the event. Events that do
+// not belong to a container are not selected when filtering by container.
+func (s EventSubscription) Matches(event Event) bool {
+	if len(s.EventTypes) > 0 && !containsEventType(s.EventTypes, event.EventType()) {
+		return false
+	}
+	if len(s.ContainerGuids) > 0 {
+		containerEvent, ok := event.(interface{ Container() Container })
+		if !ok || !containsString(s.ContainerGuids, containerEvent.Container().Guid) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsEventType(eventTypes []EventType, eventType EventType) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
 type AllocationRequest struct {
 	Guid string
 	Resource
@@ -73,6 +180,75 @@ func NewAllocationFailure(req *AllocationRequest, msg string) AllocationFailure
 	}
 }
 
+// ContainerSelector selects the containers with one of Guids and the
+// containers with all of Tags.
+type ContainerSelector struct {
+	Guids []string
+	Tags  Tags
+}
+
+// ContainerFilter selects the containers in one of States, with the
+// Lifecycle and ProcessGuid tags. Fields that are empty select all
+// containers.
+type ContainerFilter struct {
+	States      []State
+	Lifecycle   string
+	ProcessGuid string
+}
+
+func (f ContainerFilter) Matches(container Container) bool {
+	if len(f.States) > 0 && !containsState(f.States, container.State) {
+		return false
+	}
+	if f.Lifecycle != "" && container.Tags[LifecycleTag] != f.Lifecycle {
+		return false
+	}
+	if f.ProcessGuid != "" && container.Tags[ProcessGuidTag] != f.ProcessGuid {
+		return false
+	}
+	return true
+}
+
+func containsState(states []State, state State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// ListContainersRequest lists the containers selected by Filter in the order
+// of their guids. When Limit is positive, at most Limit containers are
+// listed and the ContinuationToken of the page lists the next ones.
+type ListContainersRequest struct {
+	Filter            ContainerFilter
+	Limit             int
+	ContinuationToken string
+}
+
+// ContainerPage is a page of containers. Its ContinuationToken is empty on
+// the last page.
+type ContainerPage struct {
+	Containers        []Container
+	ContinuationToken string
+}
+
+// ContainerResult is the outcome of a batch operation on a single container.
+// ErrorMsg is empty when the operation succeeded.
+type ContainerResult struct {
+	Guid     string
+	ErrorMsg string
+}
+
+func NewContainerResult(guid string, err error) ContainerResult {
+	result := ContainerResult{Guid: guid}
+	if err != nil {
+		result.ErrorMsg = err.Error()
+	}
+	return result
+}
+
 type RunRequest struct {
 	Guid string
 	RunInfo
@@ -91,6 +267,10 @@ type UpdateRequest struct {
 	Guid           string
 	InternalRoutes internalroutes.InternalRoutes
 	MetricTags     map[string]string
+	// EgressRules are applied to the container in addition to the rules it
+	// was created with. Garden cannot revoke NetOut rules, so rules can only
+	// be added to a running container.
+	EgressRules []*models.SecurityGroupRule
 }
 
 func NewUpdateRequest(guid string, internalRoutes internalroutes.InternalRoutes, metricTags map[string]string) UpdateRequest {
@@ -0,0 +1,138 @@
+package clockskew
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const ClockJumpDetectedMetric = "ClockJumpDetected"
+
+// Jump describes a discontinuity in the wall clock. Skew is positive when the
+// clock jumped forward (or the VM was paused) and negative when it jumped
+// backwards.
+type Jump struct {
+	Skew time.Duration
+}
+
+// Detector periodically compares the wall clock time elapsed between two
+// checks with the check interval. When they differ by more than the
+// threshold, e.g. after an NTP step or a VM pause, it notifies its
+// subscribers so they can re-arm their timers, and emits a
+// CellClockJumpEvent.
+//
+// A nil *Detector never reports jumps.
+type Detector struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
+	eventHub     event.Hub
+	interval     time.Duration
+	threshold    time.Duration
+
+	lock        sync.Mutex
+	subscribers map[<-chan Jump]chan Jump
+}
+
+func NewDetector(
+	logger lager.Logger,
+	clock clock.Clock,
+	metronClient loggingclient.IngressClient,
+	eventHub event.Hub,
+	interval time.Duration,
+	threshold time.Duration,
+) *Detector {
+	return &Detector{
+		logger:       logger.Session("clock-skew-detector"),
+		clock:        clock,
+		metronClient: metronClient,
+		eventHub:     eventHub,
+		interval:     interval,
+		threshold:    threshold,
+		subscribers:  map[<-chan Jump]chan Jump{},
+	}
+}
+
+// Subscribe returns a channel on which detected jumps are delivered. Jumps
+// are dropped for subscribers that have not consumed the previous one yet.
+func (d *Detector) Subscribe() <-chan Jump {
+	if d == nil {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	ch := make(chan Jump, 1)
+	d.subscribers[ch] = ch
+	return ch
+}
+
+func (d *Detector) Unsubscribe(ch <-chan Jump) {
+	if d == nil {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.subscribers, ch)
+}
+
+func (d *Detector) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := d.logger
+	logger.Info("starting", lager.Data{"interval": d.interval.String(), "threshold": d.threshold.String()})
+	defer logger.Info("complete")
+
+	ticker := d.clock.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	// Round(0) strips the monotonic clock reading so that the comparison is
+	// made against the wall clock, which is what certificates and other
+	// subsystems depend on.
+	last := d.clock.Now().Round(0)
+
+	close(ready)
+
+	for {
+		select {
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			return nil
+
+		case <-ticker.C():
+			now := d.clock.Now().Round(0)
+			skew := now.Sub(last) - d.interval
+			last = now
+
+			if skew > d.threshold || -skew > d.threshold {
+				d.notify(logger, Jump{Skew: skew})
+			}
+		}
+	}
+}
+
+func (d *Detector) notify(logger lager.Logger, jump Jump) {
+	logger.Error("clock-jump-detected", nil, lager.Data{"skew": jump.Skew.String()})
+
+	err := d.metronClient.IncrementCounter(ClockJumpDetectedMetric)
+	if err != nil {
+		logger.Error("failed-to-send-clock-jump-metric", err)
+	}
+	d.eventHub.Emit(executor.CellClockJumpEvent{Skew: jump.Skew})
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, ch := range d.subscribers {
+		select {
+		case ch <- jump:
+		default:
+		}
+	}
+}
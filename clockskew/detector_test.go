@@ -0,0 +1,87 @@
+package clockskew_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/clockskew"
+	efakes "code.cloudfoundry.org/executor/depot/event/fakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Detector", func() {
+	const (
+		interval  = 5 * time.Second
+		threshold = 30 * time.Second
+	)
+
+	var (
+		fakeClock        *fakeclock.FakeClock
+		fakeMetronClient *mfakes.FakeIngressClient
+		fakeHub          *efakes.FakeHub
+		detector         *clockskew.Detector
+		jumps            <-chan clockskew.Jump
+		process          ifrit.Process
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		fakeHub = &efakes.FakeHub{}
+		detector = clockskew.NewDetector(lagertest.NewTestLogger("test"), fakeClock, fakeMetronClient, fakeHub, interval, threshold)
+		jumps = detector.Subscribe()
+		process = ifrit.Invoke(detector)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("does not report regular ticks", func() {
+		fakeClock.WaitForWatcherAndIncrement(interval + threshold/2)
+
+		Consistently(jumps).ShouldNot(Receive())
+		Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(0))
+		Expect(fakeHub.EmitCallCount()).To(Equal(0))
+	})
+
+	It("reports jumps larger than the threshold", func() {
+		fakeClock.WaitForWatcherAndIncrement(interval + 2*threshold)
+
+		Eventually(jumps).Should(Receive(Equal(clockskew.Jump{Skew: 2 * threshold})))
+		Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+		Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal(clockskew.ClockJumpDetectedMetric))
+	})
+
+	It("emits a clock jump event", func() {
+		fakeClock.WaitForWatcherAndIncrement(interval + 2*threshold)
+
+		Eventually(fakeHub.EmitCallCount).Should(Equal(1))
+		Expect(fakeHub.EmitArgsForCall(0)).To(Equal(executor.CellClockJumpEvent{Skew: 2 * threshold}))
+	})
+
+	Context("when unsubscribed", func() {
+		It("stops delivering jumps", func() {
+			detector.Unsubscribe(jumps)
+			fakeClock.WaitForWatcherAndIncrement(interval + 2*threshold)
+
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+			Expect(jumps).NotTo(Receive())
+		})
+	})
+
+	Context("when the detector is nil", func() {
+		It("never reports jumps", func() {
+			var nilDetector *clockskew.Detector
+			Expect(nilDetector.Subscribe()).To(BeNil())
+			nilDetector.Unsubscribe(nil)
+		})
+	})
+})
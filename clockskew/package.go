@@ -0,0 +1 @@
+package clockskew // import "code.cloudfoundry.org/executor/clockskew"
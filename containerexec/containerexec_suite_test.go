@@ -0,0 +1,13 @@
+package containerexec_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestContainerExec(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ContainerExec Suite")
+}
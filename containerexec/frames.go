@@ -0,0 +1,95 @@
+package containerexec
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// FrameType identifies the payload of a frame streamed over an exec
+// connection.
+type FrameType byte
+
+const (
+	// FrameStdin is sent by the client; an empty stdin frame closes the stdin
+	// of the process
+	FrameStdin  FrameType = 0
+	FrameStdout FrameType = 1
+	FrameStderr FrameType = 2
+	// FrameResize is sent by the client with a JSON encoded
+	// executor.WindowSize to resize the TTY of the process
+	FrameResize FrameType = 3
+	// FrameExit is the last frame sent by the server, with a JSON encoded
+	// ExitStatus
+	FrameExit FrameType = 4
+
+	maxFramePayload = 1024 * 1024
+)
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// ExitStatus is the payload of the exit frame. Error is set when the exit
+// status of the process could not be determined.
+type ExitStatus struct {
+	ExitStatus int    `json:"exit_status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WriteFrame writes a frame as its type, the length of its payload as a big
+// endian uint32 and the payload.
+func WriteFrame(w io.Writer, frameType FrameType, payload []byte) error {
+	if len(payload) > maxFramePayload {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 5+len(payload))
+	frame[0] = byte(frameType)
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+func ReadFrame(r io.Reader) (FrameType, []byte, error) {
+	var header [5]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length > maxFramePayload {
+		return 0, nil, ErrFrameTooLarge
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return FrameType(header[0]), payload, nil
+}
+
+// frameWriter writes the output of a process as frames of its type. Writes
+// block while the connection is locked, e.g. until it is hijacked.
+type frameWriter struct {
+	conn      *lockedWriter
+	frameType FrameType
+}
+
+func (w frameWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxFramePayload {
+			chunk = chunk[:maxFramePayload]
+		}
+		err := w.conn.WriteFrame(w.frameType, chunk)
+		if err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,187 @@
+package containerexec
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/diagnostics"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Upgrade is the protocol that clients must request to exec a process.
+const Upgrade = "executor-exec"
+
+// Handler runs processes in running containers, e.g. to debug them:
+//
+//	POST /exec/:guid
+//
+// The body is a JSON encoded executor.ProcessSpec and the request must ask
+// to upgrade the connection to the executor-exec protocol. Once the process
+// runs, the connection is hijacked and stdin, stdout, stderr and TTY resizes
+// are streamed over it as frames (see WriteFrame) until the exit frame.
+// The process is killed when the client disconnects. Each process is logged
+// with the operator that ran it, for audits.
+func Handler(logger lager.Logger, client executor.Client) http.Handler {
+	logger = logger.Session("container-exec-handler")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] != "exec" || parts[1] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		guid := parts[1]
+
+		if !strings.EqualFold(r.Header.Get("Upgrade"), Upgrade) {
+			w.WriteHeader(http.StatusUpgradeRequired)
+			return
+		}
+
+		var spec executor.ProcessSpec
+		err := json.NewDecoder(r.Body).Decode(&spec)
+		if err != nil || spec.Path == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		serve(logger.Session("exec", lager.Data{"guid": guid, "path": spec.Path, "user": spec.User, "operator": diagnostics.Operator(r)}), client, w, r, hijacker, guid, spec)
+	})
+}
+
+func serve(
+	logger lager.Logger,
+	client executor.Client,
+	w http.ResponseWriter,
+	r *http.Request,
+	hijacker http.Hijacker,
+	guid string,
+	spec executor.ProcessSpec,
+) {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	// the output of the process is held back until the connection is
+	// hijacked, and discarded when it cannot be
+	output := &lockedWriter{}
+	output.Lock()
+
+	stdin, stdinWriter := io.Pipe()
+	process, err := client.RunProcess(logger, guid, spec, executor.ProcessIO{
+		Stdin:  stdin,
+		Stdout: frameWriter{conn: output, frameType: FrameStdout},
+		Stderr: frameWriter{conn: output, frameType: FrameStderr},
+	})
+	if err != nil {
+		output.Unlock()
+		logger.Error("failed-to-run-process", err)
+		w.WriteHeader(statusCode(err))
+		return
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		output.Unlock()
+		logger.Error("failed-to-hijack", err)
+		process.Kill()
+		return
+	}
+	defer conn.Close()
+
+	output.w = conn
+	_, err = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + Upgrade + "\r\n\r\n"))
+	output.Unlock()
+	if err != nil {
+		logger.Error("failed-to-upgrade", err)
+		process.Kill()
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		defer stdinWriter.Close()
+		for {
+			frameType, payload, err := ReadFrame(buffered)
+			if err != nil {
+				select {
+				case <-exited:
+				default:
+					logger.Info("client-disconnected", lager.Data{"error": err.Error()})
+					process.Kill()
+				}
+				return
+			}
+
+			switch frameType {
+			case FrameStdin:
+				if len(payload) == 0 {
+					stdinWriter.Close()
+					continue
+				}
+				stdinWriter.Write(payload)
+			case FrameResize:
+				var size executor.WindowSize
+				if json.Unmarshal(payload, &size) == nil {
+					process.Resize(size)
+				}
+			}
+		}
+	}()
+
+	exitStatus := ExitStatus{}
+	exitStatus.ExitStatus, err = process.Wait()
+	close(exited)
+	stdin.Close()
+	if err != nil {
+		logger.Error("failed-to-wait-for-process", err)
+		exitStatus.Error = err.Error()
+	}
+
+	payload, _ := json.Marshal(exitStatus)
+	err = output.WriteFrame(FrameExit, payload)
+	if err != nil {
+		logger.Error("failed-to-write-exit-status", err)
+	}
+}
+
+func statusCode(err error) int {
+	switch err {
+	case executor.ErrContainerNotFound:
+		return http.StatusNotFound
+	case executor.ErrContainerNotRunning:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// lockedWriter serializes the frames written to the connection by stdout,
+// stderr and the exit status. Frames are discarded while there is no
+// connection.
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) WriteFrame(frameType FrameType, payload []byte) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.w == nil {
+		return nil
+	}
+	return WriteFrame(l.w, frameType, payload)
+}
@@ -0,0 +1,184 @@
+package containerexec_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/containerexec"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		client  *fakes.FakeClient
+		process *fakes.FakeProcess
+		server  *httptest.Server
+		spec    executor.ProcessSpec
+	)
+
+	BeforeEach(func() {
+		client = &fakes.FakeClient{}
+		process = &fakes.FakeProcess{}
+		spec = executor.ProcessSpec{Path: "/bin/sh", User: "vcap", TTY: &executor.WindowSize{Columns: 80, Rows: 24}}
+		server = httptest.NewServer(containerexec.Handler(lagertest.NewTestLogger("test"), client))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	request := func(path string, upgrade bool) *http.Request {
+		body, err := json.Marshal(spec)
+		Expect(err).NotTo(HaveOccurred())
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		if upgrade {
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", containerexec.Upgrade)
+		}
+		return req
+	}
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(request("/exec/some-guid", true).Write(conn)).To(Succeed())
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		return conn, reader
+	}
+
+	Context("when the process runs", func() {
+		var (
+			stdin  chan string
+			exited chan int
+		)
+
+		BeforeEach(func() {
+			stdin = make(chan string, 1)
+			exited = make(chan int, 1)
+			client.RunProcessStub = func(_ lager.Logger, _ string, _ executor.ProcessSpec, processIO executor.ProcessIO) (executor.Process, error) {
+				go func() {
+					processIO.Stdout.Write([]byte("hello\n"))
+					processIO.Stderr.Write([]byte("oops\n"))
+					input, _ := io.ReadAll(processIO.Stdin)
+					stdin <- string(input)
+				}()
+				return process, nil
+			}
+			process.WaitStub = func() (int, error) {
+				return <-exited, nil
+			}
+		})
+
+		It("streams the process over the hijacked connection", func() {
+			conn, reader := dial()
+			defer conn.Close()
+
+			Expect(client.RunProcessCallCount()).To(Equal(1))
+			_, guid, runSpec, _ := client.RunProcessArgsForCall(0)
+			Expect(guid).To(Equal("some-guid"))
+			Expect(runSpec).To(Equal(spec))
+
+			frameType, payload, err := containerexec.ReadFrame(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(frameType).To(Equal(containerexec.FrameStdout))
+			Expect(string(payload)).To(Equal("hello\n"))
+
+			frameType, payload, err = containerexec.ReadFrame(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(frameType).To(Equal(containerexec.FrameStderr))
+			Expect(string(payload)).To(Equal("oops\n"))
+
+			Expect(containerexec.WriteFrame(conn, containerexec.FrameResize, []byte(`{"columns":120,"rows":40}`))).To(Succeed())
+			Eventually(process.ResizeCallCount).Should(Equal(1))
+			Expect(process.ResizeArgsForCall(0)).To(Equal(executor.WindowSize{Columns: 120, Rows: 40}))
+
+			Expect(containerexec.WriteFrame(conn, containerexec.FrameStdin, []byte("exit 3\n"))).To(Succeed())
+			Expect(containerexec.WriteFrame(conn, containerexec.FrameStdin, nil)).To(Succeed())
+			Eventually(stdin).Should(Receive(Equal("exit 3\n")))
+
+			exited <- 3
+			frameType, payload, err = containerexec.ReadFrame(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(frameType).To(Equal(containerexec.FrameExit))
+			Expect(payload).To(MatchJSON(`{"exit_status":3}`))
+			Expect(process.KillCallCount()).To(Equal(0))
+		})
+
+		It("kills the process when the client disconnects", func() {
+			conn, _ := dial()
+			conn.Close()
+
+			Eventually(process.KillCallCount).Should(Equal(1))
+			exited <- 137
+		})
+	})
+
+	It("kills the process and discards its output when the connection cannot be hijacked", func() {
+		var stdout io.Writer
+		client.RunProcessStub = func(_ lager.Logger, _ string, _ executor.ProcessSpec, processIO executor.ProcessIO) (executor.Process, error) {
+			stdout = processIO.Stdout
+			return process, nil
+		}
+
+		handler := containerexec.Handler(lagertest.NewTestLogger("test"), client)
+		handler.ServeHTTP(unhijackableWriter{httptest.NewRecorder()}, request("/exec/some-guid", true))
+		Expect(process.KillCallCount()).To(Equal(1))
+
+		Expect(stdout.Write([]byte("hello\n"))).To(Equal(6))
+	})
+
+	It("responds with 404 when the container does not exist", func() {
+		client.RunProcessReturns(nil, executor.ErrContainerNotFound)
+		resp, err := http.DefaultClient.Do(request("/exec/some-guid", true))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("responds with 409 when the container is not running", func() {
+		client.RunProcessReturns(nil, executor.ErrContainerNotRunning)
+		resp, err := http.DefaultClient.Do(request("/exec/some-guid", true))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+	})
+
+	It("requires the connection to be upgraded", func() {
+		resp, err := http.DefaultClient.Do(request("/exec/some-guid", false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusUpgradeRequired))
+		Expect(client.RunProcessCallCount()).To(Equal(0))
+	})
+
+	It("requires a path", func() {
+		spec.Path = ""
+		resp, err := http.DefaultClient.Do(request("/exec/some-guid", true))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
+
+// unhijackableWriter is a response writer whose connection cannot be
+// hijacked.
+type unhijackableWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (unhijackableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("cannot hijack")
+}
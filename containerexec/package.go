@@ -0,0 +1 @@
+package containerexec // import "code.cloudfoundry.org/executor/containerexec"
@@ -7,4 +7,6 @@ type CachedContainerMetrics struct {
 	DiskQuotaBytes   uint64  `json:"disk_quota_bytes"`
 	MemoryUsageBytes uint64  `json:"memory_usage_bytes"`
 	MemoryQuotaBytes uint64  `json:"memory_quota_bytes"`
+	SwapUsageBytes   uint64  `json:"swap_usage_bytes"`
+	SwapQuotaBytes   uint64  `json:"swap_quota_bytes"`
 }
@@ -0,0 +1,32 @@
+package containermetrics
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type cgroupCPUSharesSetter struct {
+	root string
+}
+
+// NewCgroupCPUSharesSetter writes the shares to the cgroups of the containers,
+// which garden creates in the root directory under the container guid. On
+// cgroup v2 the shares are converted to a weight the same way runc does.
+func NewCgroupCPUSharesSetter(root string) CPUSharesSetter {
+	return &cgroupCPUSharesSetter{root: root}
+}
+
+func (s *cgroupCPUSharesSetter) SetCPUShares(logger lager.Logger, guid string, shares uint64) error {
+	dir := filepath.Join(s.root, guid)
+
+	weightPath := filepath.Join(dir, "cpu.weight")
+	if _, err := os.Stat(weightPath); err == nil {
+		weight := 1 + ((shares-minCPUShares)*9999)/(maxCPUShares-minCPUShares)
+		return os.WriteFile(weightPath, []byte(strconv.FormatUint(weight, 10)), 0644)
+	}
+
+	return os.WriteFile(filepath.Join(dir, "cpu.shares"), []byte(strconv.FormatUint(shares, 10)), 0644)
+}
@@ -0,0 +1,171 @@
+package containermetrics
+
+import (
+	"fmt"
+	"time"
+
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	OpenConnectionsMetric         = "OpenConnections"
+	NewConnectionsPerMinuteMetric = "NewConnectionsPerMinute"
+
+	connectionPolicyTraceID = "connection-policy"
+)
+
+//go:generate counterfeiter -o containermetricsfakes/fake_connection_tracker.go . ConnectionTracker
+
+// ConnectionTracker accounts for the TCP connections of a running container.
+type ConnectionTracker interface {
+	Connections(logger lager.Logger, guid string) (ConnectionStats, error)
+}
+
+// ConnectionStats are the TCP connections of a container. Opened counts the
+// connections opened since the network of the container was created.
+type ConnectionStats struct {
+	Open   uint64
+	Opened uint64
+}
+
+// ContainerStopper stops a container, e.g. the executor client.
+type ContainerStopper interface {
+	StopContainer(logger lager.Logger, traceID string, guid string) error
+}
+
+type connectionSample struct {
+	timeStamp time.Time
+	opened    uint64
+	exceeded  bool
+}
+
+// ConnectionPolicy emits the open connections and the rate of new
+// connections of the running containers, to catch apps that leak connections
+// before they exhaust the conntrack table of the cell. Containers that exceed
+// a ceiling are reported in their app logs, and stopped when the ceilings are
+// enforced. Ceilings that are zero are not checked.
+type ConnectionPolicy struct {
+	metronClient            loggingclient.IngressClient
+	tracker                 ConnectionTracker
+	stopper                 ContainerStopper
+	cellID                  string
+	maxOpenConnections      uint64
+	maxNewConnectionsPerMin uint64
+	enforce                 bool
+
+	samples map[string]connectionSample
+}
+
+func NewConnectionPolicy(
+	metronClient loggingclient.IngressClient,
+	tracker ConnectionTracker,
+	stopper ContainerStopper,
+	cellID string,
+	maxOpenConnections uint64,
+	maxNewConnectionsPerMin uint64,
+	enforce bool,
+) *ConnectionPolicy {
+	return &ConnectionPolicy{
+		metronClient:            metronClient,
+		tracker:                 tracker,
+		stopper:                 stopper,
+		cellID:                  cellID,
+		maxOpenConnections:      maxOpenConnections,
+		maxNewConnectionsPerMin: maxNewConnectionsPerMin,
+		enforce:                 enforce,
+		samples:                 map[string]connectionSample{},
+	}
+}
+
+func (policy *ConnectionPolicy) Report(logger lager.Logger, containers []executor.Container, metrics map[string]executor.Metrics, timeStamp time.Time) error {
+	logger = logger.Session("connection-policy")
+	samples := map[string]connectionSample{}
+
+	for _, container := range containers {
+		if container.State != executor.StateRunning {
+			continue
+		}
+
+		stats, err := policy.tracker.Connections(logger, container.Guid)
+		if err != nil {
+			logger.Error("failed-to-get-connections", err, lager.Data{"guid": container.Guid})
+			continue
+		}
+
+		sample := connectionSample{timeStamp: timeStamp, opened: stats.Opened}
+		previous, ok := policy.samples[container.Guid]
+		var perMinute uint64
+		if ok && timeStamp.After(previous.timeStamp) && stats.Opened >= previous.opened {
+			perMinute = uint64(float64(stats.Opened-previous.opened) * float64(time.Minute) / float64(timeStamp.Sub(previous.timeStamp)))
+		}
+
+		if metric, ok := metrics[container.Guid]; ok && metric.MetricsConfig.Guid != "" {
+			policy.sendMetrics(logger, metric.MetricsConfig, stats.Open, perMinute)
+		}
+
+		reason := policy.exceeded(stats.Open, perMinute)
+		if reason != "" && !previous.exceeded {
+			sample.exceeded = policy.handleExceeded(logger, container, reason)
+		} else {
+			sample.exceeded = reason != ""
+		}
+		samples[container.Guid] = sample
+	}
+
+	policy.samples = samples
+	return nil
+}
+
+// handleExceeded reports a container that exceeds a ceiling in its app logs,
+// and stops it when the ceilings are enforced. It returns false when the
+// container could not be stopped, so that it is stopped on the next report.
+func (policy *ConnectionPolicy) handleExceeded(logger lager.Logger, container executor.Container, reason string) bool {
+	logger.Info("connection-ceiling-exceeded", lager.Data{"guid": container.Guid, "reason": reason, "enforce": policy.enforce})
+	sourceName, tags := container.LogConfig.GetSourceNameAndTagsForLogging()
+	if !policy.enforce {
+		policy.sendAppLog(logger, fmt.Sprintf("Instance %s exceeds the connection ceiling of cell %s: %s", container.Guid, policy.cellID, reason), sourceName, tags)
+		return true
+	}
+
+	policy.sendAppLog(logger, fmt.Sprintf("Cell %s stopping instance %s: %s", policy.cellID, container.Guid, reason), sourceName, tags)
+	err := policy.stopper.StopContainer(logger, connectionPolicyTraceID, container.Guid)
+	if err != nil {
+		logger.Error("failed-to-stop-container", err, lager.Data{"guid": container.Guid})
+		return false
+	}
+	return true
+}
+
+// exceeded returns why the connections exceed a ceiling, or "" if they do not.
+func (policy *ConnectionPolicy) exceeded(open, perMinute uint64) string {
+	if policy.maxOpenConnections > 0 && open > policy.maxOpenConnections {
+		return fmt.Sprintf("%d open connections exceed the limit of %d", open, policy.maxOpenConnections)
+	}
+	if policy.maxNewConnectionsPerMin > 0 && perMinute > policy.maxNewConnectionsPerMin {
+		return fmt.Sprintf("%d new connections per minute exceed the limit of %d", perMinute, policy.maxNewConnectionsPerMin)
+	}
+	return ""
+}
+
+func (policy *ConnectionPolicy) sendMetrics(logger lager.Logger, metricsConfig executor.MetricsConfig, open, perMinute uint64) {
+	tags := instanceTags(metricsConfig)
+
+	err := policy.metronClient.SendMetric(OpenConnectionsMetric, int(open), loggregator.WithEnvelopeTags(tags))
+	if err != nil {
+		logger.Error("failed-to-send-metric", err, lager.Data{"metric": OpenConnectionsMetric})
+	}
+	err = policy.metronClient.SendMetric(NewConnectionsPerMinuteMetric, int(perMinute), loggregator.WithEnvelopeTags(tags))
+	if err != nil {
+		logger.Error("failed-to-send-metric", err, lager.Data{"metric": NewConnectionsPerMinuteMetric})
+	}
+}
+
+func (policy *ConnectionPolicy) sendAppLog(logger lager.Logger, message, sourceName string, tags map[string]string) {
+	err := policy.metronClient.SendAppLog(message, sourceName, tags)
+	if err != nil {
+		logger.Error("failed-to-send-app-log", err)
+	}
+}
@@ -0,0 +1,199 @@
+package containermetrics_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/containermetrics"
+	"code.cloudfoundry.org/executor/containermetrics/containermetricsfakes"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ConnectionPolicy", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeMetronClient *mfakes.FakeIngressClient
+		tracker          *containermetricsfakes.FakeConnectionTracker
+		stopper          *fakes.FakeClient
+		enforce          bool
+		policy           *containermetrics.ConnectionPolicy
+
+		start      time.Time
+		containers []executor.Container
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeMetronClient = new(mfakes.FakeIngressClient)
+		tracker = new(containermetricsfakes.FakeConnectionTracker)
+		stopper = new(fakes.FakeClient)
+		enforce = false
+
+		start = time.Now()
+		containers = []executor.Container{
+			{Guid: "container-1", State: executor.StateRunning, RunInfo: executor.RunInfo{LogConfig: executor.LogConfig{Guid: "app-1", SourceName: "APP"}}},
+			{Guid: "container-2", State: executor.StateCreated},
+		}
+	})
+
+	JustBeforeEach(func() {
+		policy = containermetrics.NewConnectionPolicy(fakeMetronClient, tracker, stopper, "cell-1", 100, 600, enforce)
+	})
+
+	report := func(after time.Duration, open, opened uint64) {
+		tracker.ConnectionsReturns(containermetrics.ConnectionStats{Open: open, Opened: opened}, nil)
+		metrics := map[string]executor.Metrics{}
+		for _, container := range containers {
+			metrics[container.Guid] = executor.Metrics{
+				MetricsConfig: executor.MetricsConfig{Guid: "app-" + container.Guid, Index: 1},
+			}
+		}
+		Expect(policy.Report(logger, containers, metrics, start.Add(after))).To(Succeed())
+	}
+
+	It("reports the open connections and the rate of new connections of running containers", func() {
+		report(0, 10, 1000)
+		report(30*time.Second, 12, 1100)
+
+		Expect(tracker.ConnectionsCallCount()).To(Equal(2))
+		_, guid := tracker.ConnectionsArgsForCall(0)
+		Expect(guid).To(Equal("container-1"))
+
+		Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(4))
+		name, value, _ := fakeMetronClient.SendMetricArgsForCall(2)
+		Expect(name).To(Equal(containermetrics.OpenConnectionsMetric))
+		Expect(value).To(Equal(12))
+		name, value, _ = fakeMetronClient.SendMetricArgsForCall(3)
+		Expect(name).To(Equal(containermetrics.NewConnectionsPerMinuteMetric))
+		Expect(value).To(Equal(200))
+	})
+
+	It("logs when the connections cannot be accounted for", func() {
+		tracker.ConnectionsReturns(containermetrics.ConnectionStats{}, errors.New("boom"))
+		Expect(policy.Report(logger, containers, nil, start)).To(Succeed())
+		Expect(logger).To(gbytes.Say("connection-policy.failed-to-get-connections"))
+		Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(0))
+	})
+
+	Context("when a container exceeds a ceiling", func() {
+		It("warns in the app logs once", func() {
+			report(0, 101, 0)
+			report(30*time.Second, 102, 0)
+
+			Expect(fakeMetronClient.SendAppLogCallCount()).To(Equal(1))
+			message, sourceName, _ := fakeMetronClient.SendAppLogArgsForCall(0)
+			Expect(message).To(Equal("Instance container-1 exceeds the connection ceiling of cell cell-1: 101 open connections exceed the limit of 100"))
+			Expect(sourceName).To(Equal("APP"))
+			Expect(stopper.StopContainerCallCount()).To(Equal(0))
+		})
+
+		It("warns again once it exceeded the ceiling again", func() {
+			report(0, 101, 0)
+			report(30*time.Second, 10, 0)
+			report(60*time.Second, 10, 1000)
+
+			Expect(fakeMetronClient.SendAppLogCallCount()).To(Equal(2))
+			message, _, _ := fakeMetronClient.SendAppLogArgsForCall(1)
+			Expect(message).To(ContainSubstring("2000 new connections per minute exceed the limit of 600"))
+		})
+
+		Context("when the ceilings are enforced", func() {
+			BeforeEach(func() {
+				enforce = true
+			})
+
+			It("stops the container", func() {
+				report(0, 101, 0)
+				report(30*time.Second, 101, 0)
+
+				Expect(stopper.StopContainerCallCount()).To(Equal(1))
+				_, _, guid := stopper.StopContainerArgsForCall(0)
+				Expect(guid).To(Equal("container-1"))
+
+				message, _, _ := fakeMetronClient.SendAppLogArgsForCall(0)
+				Expect(message).To(Equal("Cell cell-1 stopping instance container-1: 101 open connections exceed the limit of 100"))
+			})
+
+			Context("when stopping the container fails", func() {
+				BeforeEach(func() {
+					stopper.StopContainerReturnsOnCall(0, errors.New("boom"))
+				})
+
+				It("stops it again on the next report", func() {
+					report(0, 101, 0)
+					Expect(logger).To(gbytes.Say("connection-policy.failed-to-stop-container"))
+
+					report(30*time.Second, 101, 0)
+					Expect(stopper.StopContainerCallCount()).To(Equal(2))
+
+					report(60*time.Second, 101, 0)
+					Expect(stopper.StopContainerCallCount()).To(Equal(2))
+				})
+			})
+		})
+	})
+})
+
+var _ = Describe("NetnsConnectionTracker", func() {
+	var (
+		cgroupRoot string
+		procRoot   string
+		tracker    containermetrics.ConnectionTracker
+	)
+
+	BeforeEach(func() {
+		cgroupRoot = GinkgoT().TempDir()
+		procRoot = GinkgoT().TempDir()
+		tracker = containermetrics.NewNetnsConnectionTracker(cgroupRoot, procRoot)
+
+		Expect(os.Mkdir(filepath.Join(cgroupRoot, "container-1"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cgroupRoot, "container-1", "cgroup.procs"), []byte("1234\n1235\n"), 0644)).To(Succeed())
+
+		netDir := filepath.Join(procRoot, "1234", "net")
+		Expect(os.MkdirAll(netDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(netDir, "sockstat"), []byte(
+			"sockets: used 290\n"+
+				"TCP: inuse 5 orphan 0 tw 2 alloc 7 mem 1\n"+
+				"UDP: inuse 1 mem 0\n",
+		), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(netDir, "sockstat6"), []byte(
+			"TCP6: inuse 3\n"+
+				"UDP6: inuse 0\n",
+		), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(netDir, "snmp"), []byte(
+			"Ip: Forwarding DefaultTTL\n"+
+				"Ip: 1 64\n"+
+				"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails\n"+
+				"Tcp: 1 200 120000 -1 40 2 0\n",
+		), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(netDir, "tcp"), []byte(
+			"  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"+
+				"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  2000        0 1001 1\n"+
+				"   1: 0100007F:1F90 0100007F:D2A4 01 00000000:00000000 00:00000000 00000000  2000        0 1002 1\n",
+		), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(netDir, "tcp6"), []byte(
+			"  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"+
+				"   0: 00000000000000000000000000000000:1F91 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  2000        0 1003 1\n",
+		), 0644)).To(Succeed())
+	})
+
+	It("reads the TCP counters of the network namespace of the container, without the listening sockets", func() {
+		stats, err := tracker.Connections(lagertest.NewTestLogger("test"), "container-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal(containermetrics.ConnectionStats{Open: 6, Opened: 42}))
+	})
+
+	It("fails when the container has no process", func() {
+		Expect(os.WriteFile(filepath.Join(cgroupRoot, "container-1", "cgroup.procs"), nil, 0644)).To(Succeed())
+		_, err := tracker.Connections(lagertest.NewTestLogger("test"), "container-1")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1 @@
+package containermetricsfakes // import "code.cloudfoundry.org/executor/containermetrics/containermetricsfakes"
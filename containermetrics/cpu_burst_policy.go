@@ -0,0 +1,171 @@
+package containermetrics
+
+import (
+	"strconv"
+	"time"
+
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	CPUEntitlementUsageMetric = "CPUEntitlementUsage"
+	CPUBurstCreditsMetric     = "CPUBurstCredits"
+
+	minCPUShares = 2
+	maxCPUShares = 262144
+)
+
+//go:generate counterfeiter -o containermetricsfakes/fake_cpushares_setter.go . CPUSharesSetter
+
+// CPUSharesSetter changes the CPU shares of a running container.
+type CPUSharesSetter interface {
+	SetCPUShares(logger lager.Logger, guid string, shares uint64) error
+}
+
+type cpuSample struct {
+	timeStamp      time.Time
+	timeSpentInCPU time.Duration
+	entitlement    uint64
+}
+
+type burstState struct {
+	samples []cpuSample
+	shares  uint64
+}
+
+// CPUBurstPolicy lets containers that used less CPU than they are entitled
+// to over the window burst above their shares, and holds back containers
+// that used more, until their usage is back within their entitlement. The
+// difference between the entitlement and the usage over the window is the
+// container's burst credit.
+type CPUBurstPolicy struct {
+	metronClient loggingclient.IngressClient
+	setter       CPUSharesSetter
+	maxCPUShares uint64
+	window       time.Duration
+	factor       float64
+
+	states map[string]*burstState
+}
+
+// NewCPUBurstPolicy multiplies the shares of containers with credits by
+// factor and divides the shares of containers without by it. maxCPUShares is
+// the shares of a container with a CPU weight of 100.
+func NewCPUBurstPolicy(
+	metronClient loggingclient.IngressClient,
+	setter CPUSharesSetter,
+	maxCPUShares uint64,
+	window time.Duration,
+	factor float64,
+) *CPUBurstPolicy {
+	return &CPUBurstPolicy{
+		metronClient: metronClient,
+		setter:       setter,
+		maxCPUShares: maxCPUShares,
+		window:       window,
+		factor:       factor,
+		states:       map[string]*burstState{},
+	}
+}
+
+func (policy *CPUBurstPolicy) Report(logger lager.Logger, containers []executor.Container, metrics map[string]executor.Metrics, timeStamp time.Time) error {
+	logger = logger.Session("cpu-burst-policy")
+	states := map[string]*burstState{}
+
+	for _, container := range containers {
+		guid := container.Guid
+		metric, ok := metrics[guid]
+		if !ok || container.State != executor.StateRunning {
+			continue
+		}
+
+		baseShares := uint64(float64(policy.maxCPUShares) * float64(container.CPUWeight) / 100.0)
+		state, ok := policy.states[guid]
+		if !ok {
+			state = &burstState{shares: baseShares}
+		}
+		states[guid] = state
+
+		state.samples = append(state.samples, cpuSample{
+			timeStamp:      timeStamp,
+			timeSpentInCPU: metric.TimeSpentInCPU,
+			entitlement:    metric.AbsoluteCPUEntitlementInNanoseconds,
+		})
+		// keep the last sample before the window, so that the samples span
+		// all of it
+		for len(state.samples) > 2 && timeStamp.Sub(state.samples[1].timeStamp) >= policy.window {
+			state.samples = state.samples[1:]
+		}
+
+		oldest, newest := state.samples[0], state.samples[len(state.samples)-1]
+		entitled := int64(newest.entitlement) - int64(oldest.entitlement)
+		if entitled <= 0 {
+			continue
+		}
+		used := int64(newest.timeSpentInCPU - oldest.timeSpentInCPU)
+		credits := entitled - used
+
+		shares := baseShares
+		if credits > 0 {
+			shares = clampShares(float64(baseShares) * policy.factor)
+		} else if credits < 0 {
+			shares = clampShares(float64(baseShares) / policy.factor)
+		}
+
+		if shares != state.shares {
+			err := policy.setter.SetCPUShares(logger, guid, shares)
+			if err != nil {
+				logger.Error("failed-to-set-cpu-shares", err, lager.Data{"guid": guid, "shares": shares})
+			} else {
+				logger.Info("set-cpu-shares", lager.Data{"guid": guid, "shares": shares, "credits-ms": credits / int64(time.Millisecond)})
+				state.shares = shares
+			}
+		}
+
+		if metric.MetricsConfig.Guid != "" {
+			policy.sendMetrics(logger, metric.MetricsConfig, int(used*100/entitled), int(credits/int64(time.Millisecond)))
+		}
+	}
+
+	policy.states = states
+	return nil
+}
+
+func (policy *CPUBurstPolicy) sendMetrics(logger lager.Logger, metricsConfig executor.MetricsConfig, usagePercent, creditsMS int) {
+	tags := instanceTags(metricsConfig)
+
+	err := policy.metronClient.SendMetric(CPUEntitlementUsageMetric, usagePercent, loggregator.WithEnvelopeTags(tags))
+	if err != nil {
+		logger.Error("failed-to-send-metric", err, lager.Data{"metric": CPUEntitlementUsageMetric})
+	}
+	err = policy.metronClient.SendMetric(CPUBurstCreditsMetric, creditsMS, loggregator.WithEnvelopeTags(tags))
+	if err != nil {
+		logger.Error("failed-to-send-metric", err, lager.Data{"metric": CPUBurstCreditsMetric})
+	}
+}
+
+// instanceTags tags the metrics of a container with its app and instance,
+// unless its metrics config already does.
+func instanceTags(metricsConfig executor.MetricsConfig) map[string]string {
+	tags := map[string]string{
+		"source_id":   metricsConfig.Guid,
+		"instance_id": strconv.Itoa(metricsConfig.Index),
+	}
+	for k, v := range metricsConfig.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+func clampShares(shares float64) uint64 {
+	if shares < minCPUShares {
+		return minCPUShares
+	}
+	if shares > maxCPUShares {
+		return maxCPUShares
+	}
+	return uint64(shares)
+}
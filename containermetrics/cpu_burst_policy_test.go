@@ -0,0 +1,148 @@
+package containermetrics_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/containermetrics"
+	"code.cloudfoundry.org/executor/containermetrics/containermetricsfakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("CPUBurstPolicy", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeMetronClient *mfakes.FakeIngressClient
+		setter           *containermetricsfakes.FakeCPUSharesSetter
+		policy           *containermetrics.CPUBurstPolicy
+
+		start      time.Time
+		containers []executor.Container
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeMetronClient = new(mfakes.FakeIngressClient)
+		setter = new(containermetricsfakes.FakeCPUSharesSetter)
+		policy = containermetrics.NewCPUBurstPolicy(fakeMetronClient, setter, 1024, time.Minute, 2)
+
+		start = time.Now()
+		containers = []executor.Container{
+			{Guid: "container-1", State: executor.StateRunning, RunInfo: executor.RunInfo{CPUWeight: 50}},
+			{Guid: "container-2", State: executor.StateCreated, RunInfo: executor.RunInfo{CPUWeight: 50}},
+		}
+	})
+
+	report := func(after time.Duration, timeSpentInCPU, entitlement time.Duration) {
+		metrics := map[string]executor.Metrics{}
+		for _, container := range containers {
+			metrics[container.Guid] = executor.Metrics{
+				MetricsConfig: executor.MetricsConfig{Guid: "app-" + container.Guid, Index: 1},
+				ContainerMetrics: executor.ContainerMetrics{
+					TimeSpentInCPU:                      timeSpentInCPU,
+					AbsoluteCPUEntitlementInNanoseconds: uint64(entitlement),
+				},
+			}
+		}
+		Expect(policy.Report(logger, containers, metrics, start.Add(after))).To(Succeed())
+	}
+
+	It("raises the shares of running containers with credits", func() {
+		report(0, 0, 0)
+		Expect(setter.SetCPUSharesCallCount()).To(Equal(0))
+
+		report(30*time.Second, time.Second, 3*time.Second)
+		Expect(setter.SetCPUSharesCallCount()).To(Equal(1))
+		_, guid, shares := setter.SetCPUSharesArgsForCall(0)
+		Expect(guid).To(Equal("container-1"))
+		Expect(shares).To(Equal(uint64(1024)))
+	})
+
+	It("lowers the shares of running containers that used up their credits", func() {
+		report(0, 0, 0)
+		report(30*time.Second, time.Second, 3*time.Second)
+		report(60*time.Second, 5*time.Second, 4*time.Second)
+
+		Expect(setter.SetCPUSharesCallCount()).To(Equal(2))
+		_, _, shares := setter.SetCPUSharesArgsForCall(1)
+		Expect(shares).To(Equal(uint64(256)))
+	})
+
+	It("only considers the usage within the window", func() {
+		report(0, 0, 0)
+		report(30*time.Second, 5*time.Second, 3*time.Second)
+		report(90*time.Second, 6*time.Second, 6*time.Second)
+		report(120*time.Second, 7*time.Second, 9*time.Second)
+
+		Expect(setter.SetCPUSharesCallCount()).To(Equal(2))
+		_, _, shares := setter.SetCPUSharesArgsForCall(0)
+		Expect(shares).To(Equal(uint64(256)))
+		_, _, shares = setter.SetCPUSharesArgsForCall(1)
+		Expect(shares).To(Equal(uint64(1024)))
+	})
+
+	It("does not set the shares again when they did not change", func() {
+		report(0, 0, 0)
+		report(30*time.Second, time.Second, 3*time.Second)
+		report(40*time.Second, 2*time.Second, 4*time.Second)
+
+		Expect(setter.SetCPUSharesCallCount()).To(Equal(1))
+	})
+
+	It("tries again when setting the shares fails", func() {
+		setter.SetCPUSharesReturnsOnCall(0, errors.New("boom"))
+
+		report(0, 0, 0)
+		report(30*time.Second, time.Second, 3*time.Second)
+		report(40*time.Second, 2*time.Second, 4*time.Second)
+
+		Expect(setter.SetCPUSharesCallCount()).To(Equal(2))
+		Expect(logger).To(gbytes.Say("cpu-burst-policy.failed-to-set-cpu-shares"))
+	})
+
+	It("reports the entitlement usage and credits over the window", func() {
+		report(0, 0, 0)
+		report(30*time.Second, time.Second, 4*time.Second)
+
+		Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(2))
+		name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+		Expect(name).To(Equal(containermetrics.CPUEntitlementUsageMetric))
+		Expect(value).To(Equal(25))
+		name, value, _ = fakeMetronClient.SendMetricArgsForCall(1)
+		Expect(name).To(Equal(containermetrics.CPUBurstCreditsMetric))
+		Expect(value).To(Equal(3000))
+	})
+})
+
+var _ = Describe("CgroupCPUSharesSetter", func() {
+	var (
+		root   string
+		setter containermetrics.CPUSharesSetter
+	)
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(root, "container-1"), 0755)).To(Succeed())
+		setter = containermetrics.NewCgroupCPUSharesSetter(root)
+	})
+
+	It("writes the shares on cgroup v1", func() {
+		Expect(setter.SetCPUShares(lagertest.NewTestLogger("test"), "container-1", 1024)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(root, "container-1", "cpu.shares"))).To(BeEquivalentTo("1024"))
+	})
+
+	It("writes the converted weight on cgroup v2", func() {
+		weightPath := filepath.Join(root, "container-1", "cpu.weight")
+		Expect(os.WriteFile(weightPath, []byte("100"), 0644)).To(Succeed())
+
+		Expect(setter.SetCPUShares(lagertest.NewTestLogger("test"), "container-1", 1024)).To(Succeed())
+		Expect(os.ReadFile(weightPath)).To(BeEquivalentTo("39"))
+	})
+})
@@ -0,0 +1,176 @@
+package containermetrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+var errNoContainerProcess = errors.New("container has no process")
+
+type netnsConnectionTracker struct {
+	cgroupRoot string
+	procRoot   string
+}
+
+// NewNetnsConnectionTracker reads the TCP counters of the network namespace
+// of the containers from procfs, through a process in the cgroup that garden
+// creates in cgroupRoot under the container guid. The counters of a network
+// namespace are those of the container, since every container has its own.
+// Listening sockets are not counted as open connections.
+//
+// The connections are not traced with eBPF: the counters are sampled on
+// every report of the container metrics, so connections that open and close
+// between two reports only count towards the rate of new connections.
+func NewNetnsConnectionTracker(cgroupRoot, procRoot string) ConnectionTracker {
+	return &netnsConnectionTracker{cgroupRoot: cgroupRoot, procRoot: procRoot}
+}
+
+func (t *netnsConnectionTracker) Connections(logger lager.Logger, guid string) (ConnectionStats, error) {
+	pid, err := t.pid(guid)
+	if err != nil {
+		return ConnectionStats{}, err
+	}
+
+	netDir := filepath.Join(t.procRoot, pid, "net")
+	stats := ConnectionStats{}
+	for _, name := range []string{"sockstat", "sockstat6"} {
+		fields, err := readProcFields(filepath.Join(netDir, name))
+		if err != nil {
+			if name == "sockstat6" && os.IsNotExist(err) {
+				continue
+			}
+			return ConnectionStats{}, err
+		}
+		for _, prefix := range []string{"TCP:", "TCP6:"} {
+			stats.Open += fields[prefix]["inuse"]
+		}
+	}
+
+	// the sockets in use include the listening ones, which are not
+	// connections
+	listeners, err := countListeners(netDir)
+	if err != nil {
+		return ConnectionStats{}, err
+	}
+	if listeners > stats.Open {
+		listeners = stats.Open
+	}
+	stats.Open -= listeners
+
+	fields, err := readProcFields(filepath.Join(netDir, "snmp"))
+	if err != nil {
+		return ConnectionStats{}, err
+	}
+	stats.Opened = fields["Tcp:"]["ActiveOpens"] + fields["Tcp:"]["PassiveOpens"]
+
+	return stats, nil
+}
+
+// pid returns a process of the container. All of them share its network
+// namespace.
+func (t *netnsConnectionTracker) pid(guid string) (string, error) {
+	procs, err := os.ReadFile(filepath.Join(t.cgroupRoot, guid, "cgroup.procs"))
+	if err != nil {
+		return "", err
+	}
+	pids := strings.Fields(string(procs))
+	if len(pids) == 0 {
+		return "", errNoContainerProcess
+	}
+	return pids[0], nil
+}
+
+// tcpListenState is the state of listening sockets in /proc/net/tcp.
+const tcpListenState = "0A"
+
+// countListeners counts the listening sockets in /proc/net/tcp and
+// /proc/net/tcp6, whose lines hold the state of a socket in their fourth
+// field after a header line.
+func countListeners(netDir string) (uint64, error) {
+	var listeners uint64
+	for _, name := range []string{"tcp", "tcp6"} {
+		file, err := os.Open(filepath.Join(netDir, name))
+		if err != nil {
+			if name == "tcp6" && os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Scan()
+		for scanner.Scan() {
+			line := strings.Fields(scanner.Text())
+			if len(line) > 3 && line[3] == tcpListenState {
+				listeners++
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return listeners, nil
+}
+
+// readProcFields parses the counters of files like /proc/net/sockstat, with
+// name and value pairs on each line, and /proc/net/snmp, with a line of names
+// followed by a line of values. Counters are keyed by the prefix of their line.
+func readProcFields(path string) (map[string]map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fields := map[string]map[string]uint64{}
+	var header []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) < 2 {
+			continue
+		}
+
+		prefix, values := line[0], line[1:]
+		if fields[prefix] == nil {
+			fields[prefix] = map[string]uint64{}
+		}
+
+		// a line of names is followed by a line of values with the same prefix
+		if !isNumeric(values[0]) && (len(values)%2 != 0 || !isNumeric(values[1])) {
+			header = values
+			continue
+		}
+		if header != nil {
+			if len(header) != len(values) {
+				return nil, fmt.Errorf("malformed %s: %d names and %d values for %s", path, len(header), len(values), prefix)
+			}
+			for i, name := range header {
+				value, _ := strconv.ParseUint(values[i], 10, 64)
+				fields[prefix][name] = value
+			}
+			header = nil
+			continue
+		}
+
+		for i := 0; i+1 < len(values); i += 2 {
+			value, _ := strconv.ParseUint(values[i+1], 10, 64)
+			fields[prefix][values[i]] = value
+		}
+	}
+	return fields, scanner.Err()
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,143 @@
+package containermetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	ProxyConnectionsMetric             = "ProxyConnections"
+	ProxyActiveConnectionsMetric       = "ProxyActiveConnections"
+	ProxyTLSHandshakeFailuresMetric    = "ProxyTLSHandshakeFailures"
+	ProxyUpstreamConnectFailuresMetric = "ProxyUpstreamConnectFailures"
+
+	proxyStatsFilter = `^(listener\.|cluster\.service-cluster-)`
+)
+
+// ProxyStatsReporter scrapes the stats of the Envoy proxies of the running
+// containers and emits them with the metrics of the app instance. The
+// admin and stats listeners are not counted.
+type ProxyStatsReporter struct {
+	metronClient loggingclient.IngressClient
+	client       *http.Client
+	port         uint16
+}
+
+func NewProxyStatsReporter(metronClient loggingclient.IngressClient, port uint16, timeout time.Duration) *ProxyStatsReporter {
+	return &ProxyStatsReporter{
+		metronClient: metronClient,
+		client:       &http.Client{Timeout: timeout},
+		port:         port,
+	}
+}
+
+type proxyStats struct {
+	connections             uint64
+	activeConnections       uint64
+	tlsHandshakeFailures    uint64
+	upstreamConnectFailures uint64
+}
+
+func (reporter *ProxyStatsReporter) Report(logger lager.Logger, containers []executor.Container, metrics map[string]executor.Metrics, timeStamp time.Time) error {
+	logger = logger.Session("proxy-stats-reporter")
+
+	wg := sync.WaitGroup{}
+	for _, container := range containers {
+		metric, ok := metrics[container.Guid]
+		if !ok || metric.MetricsConfig.Guid == "" || !container.EnableContainerProxy ||
+			container.State != executor.StateRunning || container.InternalIP == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(container executor.Container, metricsConfig executor.MetricsConfig) {
+			defer wg.Done()
+
+			stats, err := reporter.scrape(container.InternalIP)
+			if err != nil {
+				logger.Error("failed-to-scrape-proxy-stats", err, lager.Data{"guid": container.Guid})
+				return
+			}
+			reporter.send(logger, instanceTags(metricsConfig), stats)
+		}(container, metric.MetricsConfig)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (reporter *ProxyStatsReporter) scrape(ip string) (proxyStats, error) {
+	query := url.Values{"format": {"json"}, "filter": {proxyStatsFilter}}
+	statsURL := fmt.Sprintf("http://%s/stats?%s", net.JoinHostPort(ip, strconv.Itoa(int(reporter.port))), query.Encode())
+
+	resp, err := reporter.client.Get(statsURL)
+	if err != nil {
+		return proxyStats{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return proxyStats{}, fmt.Errorf("proxy responded with status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Stats []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"stats"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return proxyStats{}, err
+	}
+
+	statsListener := fmt.Sprintf("_%d.", reporter.port)
+	stats := proxyStats{}
+	for _, stat := range body.Stats {
+		value, err := strconv.ParseUint(string(stat.Value), 10, 64)
+		if err != nil {
+			// histograms and text readouts
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(stat.Name, "listener.admin."),
+			strings.HasPrefix(stat.Name, "listener.") && strings.Contains(stat.Name, statsListener):
+		case strings.HasPrefix(stat.Name, "listener.") && strings.HasSuffix(stat.Name, ".downstream_cx_total"):
+			stats.connections += value
+		case strings.HasPrefix(stat.Name, "listener.") && strings.HasSuffix(stat.Name, ".downstream_cx_active"):
+			stats.activeConnections += value
+		case strings.HasPrefix(stat.Name, "listener.") && strings.HasSuffix(stat.Name, ".ssl.connection_error"):
+			stats.tlsHandshakeFailures += value
+		case strings.HasPrefix(stat.Name, "cluster.") && strings.HasSuffix(stat.Name, ".upstream_cx_connect_fail"):
+			stats.upstreamConnectFailures += value
+		}
+	}
+	return stats, nil
+}
+
+func (reporter *ProxyStatsReporter) send(logger lager.Logger, tags map[string]string, stats proxyStats) {
+	for name, value := range map[string]uint64{
+		ProxyConnectionsMetric:             stats.connections,
+		ProxyActiveConnectionsMetric:       stats.activeConnections,
+		ProxyTLSHandshakeFailuresMetric:    stats.tlsHandshakeFailures,
+		ProxyUpstreamConnectFailuresMetric: stats.upstreamConnectFailures,
+	} {
+		err := reporter.metronClient.SendMetric(name, int(value), loggregator.WithEnvelopeTags(tags))
+		if err != nil {
+			logger.Error("failed-to-send-metric", err, lager.Data{"metric": name})
+		}
+	}
+}
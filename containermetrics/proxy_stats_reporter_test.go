@@ -0,0 +1,143 @@
+package containermetrics_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/containermetrics"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/go-loggregator/v8/rpc/loggregator_v2"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ProxyStatsReporter", func() {
+	var (
+		logger           *lagertest.TestLogger
+		fakeMetronClient *mfakes.FakeIngressClient
+		server           *httptest.Server
+		port             uint16
+		status           int
+		query            chan string
+
+		containers []executor.Container
+		metrics    map[string]executor.Metrics
+
+		lock    sync.Mutex
+		sent    map[string]int
+		sentFor map[string]map[string]string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeMetronClient = new(mfakes.FakeIngressClient)
+		status = http.StatusOK
+		query = make(chan string, 10)
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			query <- req.URL.Path + "?" + req.URL.RawQuery
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"stats": [
+				{"name": "listener.0.0.0.0_61001.downstream_cx_total", "value": 10},
+				{"name": "listener.0.0.0.0_61443.downstream_cx_total", "value": 5},
+				{"name": "listener.0.0.0.0_%d.downstream_cx_total", "value": 100},
+				{"name": "listener.admin.downstream_cx_total", "value": 7},
+				{"name": "listener.0.0.0.0_61001.downstream_cx_active", "value": 2},
+				{"name": "listener.0.0.0.0_61001.ssl.connection_error", "value": 3},
+				{"name": "cluster.service-cluster-8080.upstream_cx_connect_fail", "value": 4},
+				{"histograms": {"supported_quantiles": [0, 50, 100]}}
+			]}`, port)
+		}))
+		_, portString, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		p, err := strconv.Atoi(portString)
+		Expect(err).NotTo(HaveOccurred())
+		port = uint16(p)
+
+		containers = []executor.Container{
+			{
+				Guid:       "container-1",
+				State:      executor.StateRunning,
+				InternalIP: "127.0.0.1",
+				RunInfo:    executor.RunInfo{EnableContainerProxy: true},
+			},
+			{
+				Guid:       "container-without-proxy",
+				State:      executor.StateRunning,
+				InternalIP: "127.0.0.1",
+			},
+		}
+		metrics = map[string]executor.Metrics{
+			"container-1":             {MetricsConfig: executor.MetricsConfig{Guid: "app-1", Index: 2}},
+			"container-without-proxy": {MetricsConfig: executor.MetricsConfig{Guid: "app-2"}},
+		}
+
+		sent = map[string]int{}
+		sentFor = map[string]map[string]string{}
+		fakeMetronClient.SendMetricStub = func(name string, value int, opts ...loggregator.EmitGaugeOption) error {
+			envelope := &loggregator_v2.Envelope{Tags: map[string]string{}}
+			for _, opt := range opts {
+				opt(envelope)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			sent[name] = value
+			sentFor[name] = envelope.Tags
+			return nil
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	report := func() {
+		reporter := containermetrics.NewProxyStatsReporter(fakeMetronClient, port, time.Second)
+		Expect(reporter.Report(logger, containers, metrics, time.Now())).To(Succeed())
+	}
+
+	It("emits the proxy stats of the app instances with a proxy", func() {
+		report()
+
+		Expect(query).To(Receive(Equal(`/stats?filter=%5E%28listener%5C.%7Ccluster%5C.service-cluster-%29&format=json`)))
+		Expect(query).NotTo(Receive())
+
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(sent).To(Equal(map[string]int{
+			containermetrics.ProxyConnectionsMetric:             15,
+			containermetrics.ProxyActiveConnectionsMetric:       2,
+			containermetrics.ProxyTLSHandshakeFailuresMetric:    3,
+			containermetrics.ProxyUpstreamConnectFailuresMetric: 4,
+		}))
+		Expect(sentFor[containermetrics.ProxyConnectionsMetric]).To(Equal(map[string]string{
+			"source_id":   "app-1",
+			"instance_id": "2",
+		}))
+	})
+
+	It("does not scrape containers that are not running", func() {
+		containers[0].State = executor.StateCreated
+		report()
+
+		Expect(query).NotTo(Receive())
+		Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(0))
+	})
+
+	It("logs when the stats cannot be scraped", func() {
+		status = http.StatusServiceUnavailable
+		report()
+
+		Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(0))
+		Expect(logger).To(gbytes.Say("proxy-stats-reporter.failed-to-scrape-proxy-stats"))
+	})
+})
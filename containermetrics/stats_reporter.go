@@ -131,6 +131,8 @@ func (reporter *StatsReporter) calculateAndSendMetrics(
 		DiskQuotaBytes:   containerMetrics.DiskLimitInBytes,
 		MemoryUsageBytes: containerMetrics.MemoryUsageInBytes,
 		MemoryQuotaBytes: containerMetrics.MemoryLimitInBytes,
+		SwapUsageBytes:   containerMetrics.SwapUsageInBytes,
+		SwapQuotaBytes:   containerMetrics.SwapLimitInBytes,
 	}, &currentInfo
 }
 
@@ -0,0 +1,13 @@
+package callbacks_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCallbacks(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Callbacks Suite")
+}
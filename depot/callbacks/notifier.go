@@ -0,0 +1,215 @@
+package callbacks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// CompletionPayload is the body POSTed to the completion callback URLs of a
+// container.
+type CompletionPayload struct {
+	Guid      string                      `json:"guid"`
+	Tags      executor.Tags               `json:"tags,omitempty"`
+	RunResult executor.ContainerRunResult `json:"run_result"`
+}
+
+// Notifier POSTs the result of completed containers to the
+// CompletionCallbackURLs declared in their RunInfo. The URLs are chosen by
+// the tenants, so they are only called when their host is allowed by the
+// operator: an allowed host is either a hostname or a wildcard like
+// *.example.com, which matches its subdomains. Failed deliveries are retried
+// with exponential backoff, unless the callback rejected the payload with a
+// 4xx status.
+type Notifier struct {
+	logger       lager.Logger
+	hub          event.Hub
+	delivery     delivery
+	allowedHosts []string
+}
+
+func NewNotifier(
+	logger lager.Logger,
+	hub event.Hub,
+	httpClient *http.Client,
+	clock clock.Clock,
+	maxAttempts int,
+	retryDelay time.Duration,
+	allowedHosts []string,
+) *Notifier {
+	return &Notifier{
+		logger: logger.Session("completion-callbacks"),
+		hub:    hub,
+		delivery: delivery{
+			httpClient:  httpClient,
+			clock:       clock,
+			maxAttempts: maxAttempts,
+			retryDelay:  retryDelay,
+		},
+		allowedHosts: allowedHosts,
+	}
+}
+
+func (n *Notifier) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	return runEvents(n.logger, n.hub, signals, ready, func(logger lager.Logger, ev executor.Event) {
+		completeEvent, ok := ev.(executor.ContainerCompleteEvent)
+		if !ok {
+			return
+		}
+
+		container := completeEvent.Container()
+		for _, url := range container.CompletionCallbackURLs {
+			if !n.allowed(url) {
+				logger.Info("callback-url-not-allowed", lager.Data{"guid": container.Guid, "url": url})
+				continue
+			}
+			go n.delivery.deliver(logger, url, container.Guid, CompletionPayload{
+				Guid:      container.Guid,
+				Tags:      container.Tags,
+				RunResult: container.RunResult,
+			})
+		}
+	})
+}
+
+func (n *Notifier) allowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range n.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// runEvents calls handle with every event of the hub until it is signalled
+// or the hub is closed.
+func runEvents(logger lager.Logger, hub event.Hub, signals <-chan os.Signal, ready chan<- struct{}, handle func(lager.Logger, executor.Event)) error {
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	source, err := hub.Subscribe()
+	if err != nil {
+		logger.Error("failed-to-subscribe", err)
+		return err
+	}
+
+	events := make(chan executor.Event)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			ev, err := source.Next()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case events <- ev:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	close(ready)
+
+	for {
+		select {
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			source.Close()
+			return nil
+
+		case err := <-errs:
+			// the hub is only closed when the executor shuts down
+			logger.Info("event-source-closed", lager.Data{"error": err.Error()})
+			return nil
+
+		case ev := <-events:
+			handle(logger, ev)
+		}
+	}
+}
+
+// delivery POSTs JSON payloads. Failed deliveries are retried with
+// exponential backoff, unless the endpoint rejected the payload with a 4xx
+// status.
+type delivery struct {
+	httpClient  *http.Client
+	clock       clock.Clock
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+func (d delivery) deliver(logger lager.Logger, url, guid string, payload interface{}) {
+	logger = logger.Session("deliver", lager.Data{"guid": guid, "url": url})
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("failed-to-marshal-payload", err)
+		return
+	}
+
+	delay := d.retryDelay
+	for attempt := 1; ; attempt++ {
+		retryable, err := d.post(url, body)
+		if err == nil {
+			logger.Info("delivered", lager.Data{"attempt": attempt})
+			return
+		}
+
+		if !retryable || attempt >= d.maxAttempts {
+			logger.Error("failed-to-deliver", err, lager.Data{"attempt": attempt})
+			return
+		}
+
+		logger.Info("retrying", lager.Data{"attempt": attempt, "error": err.Error(), "delay": delay.String()})
+		d.clock.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (d delivery) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+}
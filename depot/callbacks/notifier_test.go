@@ -0,0 +1,204 @@
+package callbacks_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/callbacks"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Notifier", func() {
+	var (
+		fakeClock *fakeclock.FakeClock
+		hub       event.Hub
+		server    *httptest.Server
+		process   ifrit.Process
+
+		lock         sync.Mutex
+		payloads     []callbacks.CompletionPayload
+		responses    []int
+		allowedHosts []string
+		httpClient   *http.Client
+	)
+
+	received := func() []callbacks.CompletionPayload {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]callbacks.CompletionPayload{}, payloads...)
+	}
+
+	completeContainerWithCallback := func(callbackURL string) executor.Container {
+		container := executor.Container{
+			Guid:  "some-guid",
+			Tags:  executor.Tags{"some-tag": "some-value"},
+			State: executor.StateCompleted,
+			RunInfo: executor.RunInfo{
+				CompletionCallbackURLs: []string{callbackURL},
+			},
+			RunResult: executor.ContainerRunResult{Failed: true, FailureReason: "exit status 2"},
+		}
+		hub.Emit(executor.NewContainerCompleteEvent(container, "some-trace-id"))
+		return container
+	}
+
+	completeContainer := func() executor.Container {
+		return completeContainerWithCallback(server.URL + "/callback")
+	}
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		hub = event.NewHub()
+		payloads = nil
+		responses = nil
+		allowedHosts = []string{"127.0.0.1"}
+		httpClient = http.DefaultClient
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/callback"))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var payload callbacks.CompletionPayload
+			Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+
+			lock.Lock()
+			defer lock.Unlock()
+			payloads = append(payloads, payload)
+			status := http.StatusOK
+			if len(responses) > 0 {
+				status, responses = responses[0], responses[1:]
+			}
+			w.WriteHeader(status)
+		}))
+	})
+
+	JustBeforeEach(func() {
+		notifier := callbacks.NewNotifier(lagertest.NewTestLogger("test"), hub, httpClient, fakeClock, 3, time.Second, allowedHosts)
+		process = ifrit.Invoke(notifier)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		server.Close()
+		hub.Close()
+	})
+
+	It("posts the result of completed containers to their callback URLs", func() {
+		container := completeContainer()
+
+		Eventually(received).Should(Equal([]callbacks.CompletionPayload{{
+			Guid:      container.Guid,
+			Tags:      container.Tags,
+			RunResult: container.RunResult,
+		}}))
+	})
+
+	Context("when the host of the callback URL is not allowed", func() {
+		BeforeEach(func() {
+			allowedHosts = []string{"callbacks.example.com"}
+		})
+
+		It("does not post the result", func() {
+			completeContainer()
+			Consistently(received).Should(BeEmpty())
+		})
+	})
+
+	Context("when the host of the callback URL matches an allowed wildcard", func() {
+		BeforeEach(func() {
+			allowedHosts = []string{"*.example.com"}
+			httpClient = &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+				},
+			}}
+		})
+
+		It("posts the result", func() {
+			completeContainerWithCallback("http://callbacks.example.com/callback")
+			Eventually(received).Should(HaveLen(1))
+		})
+	})
+
+	Context("when the callback URL has credentials", func() {
+		It("does not post the result", func() {
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			completeContainerWithCallback("http://user:pass@" + serverURL.Host + "/callback")
+			Consistently(received).Should(BeEmpty())
+		})
+	})
+
+	It("ignores other events", func() {
+		hub.Emit(executor.NewContainerRunningEvent(executor.Container{
+			Guid:    "some-guid",
+			RunInfo: executor.RunInfo{CompletionCallbackURLs: []string{server.URL + "/callback"}},
+		}, "some-trace-id"))
+
+		Consistently(received).Should(BeEmpty())
+	})
+
+	Context("when the callback fails with a server error", func() {
+		BeforeEach(func() {
+			responses = []int{http.StatusServiceUnavailable, http.StatusInternalServerError}
+		})
+
+		It("retries with exponential backoff", func() {
+			completeContainer()
+			Eventually(received).Should(HaveLen(1))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(received).Should(HaveLen(2))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Consistently(received).Should(HaveLen(2))
+			fakeClock.Increment(time.Second)
+			Eventually(received).Should(HaveLen(3))
+		})
+	})
+
+	Context("when the callback keeps failing", func() {
+		BeforeEach(func() {
+			responses = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+		})
+
+		It("gives up after the maximum number of attempts", func() {
+			completeContainer()
+			Eventually(received).Should(HaveLen(1))
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(received).Should(HaveLen(2))
+			fakeClock.WaitForWatcherAndIncrement(2 * time.Second)
+			Eventually(received).Should(HaveLen(3))
+
+			Consistently(fakeClock.WatcherCount).Should(Equal(0))
+		})
+	})
+
+	Context("when the callback rejects the payload", func() {
+		BeforeEach(func() {
+			responses = []int{http.StatusBadRequest}
+		})
+
+		It("does not retry", func() {
+			completeContainer()
+			Eventually(received).Should(HaveLen(1))
+			Consistently(fakeClock.WatcherCount).Should(Equal(0))
+		})
+	})
+})
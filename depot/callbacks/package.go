@@ -0,0 +1 @@
+package callbacks // import "code.cloudfoundry.org/executor/depot/callbacks"
@@ -0,0 +1,176 @@
+package callbacks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// The lifecycle points at which webhooks are fired.
+const (
+	WebhookEventReserved  = "reserved"
+	WebhookEventCreated   = "created"
+	WebhookEventRunning   = "running"
+	WebhookEventCompleted = "completed"
+)
+
+var webhookEvents = map[executor.EventType]string{
+	executor.EventTypeContainerReserved: WebhookEventReserved,
+	executor.EventTypeContainerRunning:  WebhookEventRunning,
+	executor.EventTypeContainerComplete: WebhookEventCompleted,
+}
+
+// Webhook is an operator endpoint that is notified of the containers of the
+// cell. It receives all lifecycle events when Events is empty.
+type Webhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+func (w Webhook) subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPayload is the body POSTed to the webhooks. It only carries the
+// metadata of the container, not its environment or credentials.
+type WebhookPayload struct {
+	Event      string                       `json:"event"`
+	CellID     string                       `json:"cell_id"`
+	Timestamp  int64                        `json:"timestamp"`
+	Guid       string                       `json:"guid"`
+	State      executor.State               `json:"state"`
+	Tags       executor.Tags                `json:"tags,omitempty"`
+	AppGuid    string                       `json:"app_guid,omitempty"`
+	Index      int                          `json:"index"`
+	MemoryMB   int                          `json:"memory_mb"`
+	DiskMB     int                          `json:"disk_mb"`
+	InternalIP string                       `json:"internal_ip,omitempty"`
+	RunResult  *executor.ContainerRunResult `json:"run_result,omitempty"`
+}
+
+// WebhookNotifier POSTs the lifecycle events of all containers to the
+// webhooks configured by the operator, so that external systems can track
+// the workloads of the cell without polling it.
+type WebhookNotifier struct {
+	logger   lager.Logger
+	hub      event.Hub
+	clock    clock.Clock
+	delivery delivery
+	cellID   string
+	webhooks []Webhook
+
+	// created holds the containers the created webhook was fired for. The
+	// executor does not publish an event when the garden container of a
+	// container is created, so the webhook is fired on its first running
+	// event, which always follows it.
+	created map[string]bool
+}
+
+func NewWebhookNotifier(
+	logger lager.Logger,
+	hub event.Hub,
+	httpClient *http.Client,
+	clock clock.Clock,
+	maxAttempts int,
+	retryDelay time.Duration,
+	cellID string,
+	webhooks []Webhook,
+) (*WebhookNotifier, error) {
+	known := map[string]bool{WebhookEventCreated: true}
+	for _, e := range webhookEvents {
+		known[e] = true
+	}
+	for _, webhook := range webhooks {
+		if webhook.URL == "" {
+			return nil, errors.New("webhook url must be set")
+		}
+		for _, e := range webhook.Events {
+			if !known[e] {
+				return nil, fmt.Errorf("unknown webhook event %q for %s", e, webhook.URL)
+			}
+		}
+	}
+
+	return &WebhookNotifier{
+		logger: logger.Session("lifecycle-webhooks"),
+		hub:    hub,
+		clock:  clock,
+		delivery: delivery{
+			httpClient:  httpClient,
+			clock:       clock,
+			maxAttempts: maxAttempts,
+			retryDelay:  retryDelay,
+		},
+		cellID:   cellID,
+		webhooks: webhooks,
+		created:  map[string]bool{},
+	}, nil
+}
+
+func (n *WebhookNotifier) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	return runEvents(n.logger, n.hub, signals, ready, func(logger lager.Logger, ev executor.Event) {
+		name, ok := webhookEvents[ev.EventType()]
+		if !ok {
+			return
+		}
+		lifecycleEvent, ok := ev.(executor.LifecycleEvent)
+		if !ok {
+			return
+		}
+
+		container := lifecycleEvent.Container()
+		switch name {
+		case WebhookEventRunning:
+			if !n.created[container.Guid] {
+				n.created[container.Guid] = true
+				created := container
+				created.State = executor.StateCreated
+				n.notify(logger, WebhookEventCreated, created)
+			}
+		case WebhookEventCompleted:
+			delete(n.created, container.Guid)
+		}
+		n.notify(logger, name, container)
+	})
+}
+
+func (n *WebhookNotifier) notify(logger lager.Logger, name string, container executor.Container) {
+	payload := WebhookPayload{
+		Event:      name,
+		CellID:     n.cellID,
+		Timestamp:  n.clock.Now().UnixNano(),
+		Guid:       container.Guid,
+		State:      container.State,
+		Tags:       container.Tags,
+		AppGuid:    container.MetricsConfig.Guid,
+		Index:      container.MetricsConfig.Index,
+		MemoryMB:   container.MemoryMB,
+		DiskMB:     container.DiskMB,
+		InternalIP: container.InternalIP,
+	}
+	if name == WebhookEventCompleted {
+		runResult := container.RunResult
+		payload.RunResult = &runResult
+	}
+
+	for _, webhook := range n.webhooks {
+		if webhook.subscribed(name) {
+			go n.delivery.deliver(logger, webhook.URL, container.Guid, payload)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package callbacks_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/callbacks"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("WebhookNotifier", func() {
+	var (
+		fakeClock *fakeclock.FakeClock
+		hub       event.Hub
+		server    *httptest.Server
+		webhooks  []callbacks.Webhook
+		process   ifrit.Process
+
+		lock      sync.Mutex
+		payloads  map[string][]callbacks.WebhookPayload
+		responses []int
+
+		container executor.Container
+	)
+
+	received := func(path string) func() []callbacks.WebhookPayload {
+		return func() []callbacks.WebhookPayload {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]callbacks.WebhookPayload{}, payloads[path]...)
+		}
+	}
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1700000000, 0))
+		hub = event.NewHub()
+		payloads = map[string][]callbacks.WebhookPayload{}
+		responses = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var payload callbacks.WebhookPayload
+			Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+
+			lock.Lock()
+			defer lock.Unlock()
+			payloads[r.URL.Path] = append(payloads[r.URL.Path], payload)
+			status := http.StatusOK
+			if len(responses) > 0 {
+				status, responses = responses[0], responses[1:]
+			}
+			w.WriteHeader(status)
+		}))
+
+		webhooks = []callbacks.Webhook{
+			{URL: server.URL + "/cmdb"},
+			{URL: server.URL + "/security", Events: []string{callbacks.WebhookEventRunning}},
+		}
+
+		container = executor.Container{
+			Guid:       "some-guid",
+			Resource:   executor.NewResource(128, 256, 10),
+			Tags:       executor.Tags{"some-tag": "some-value"},
+			State:      executor.StateRunning,
+			InternalIP: "10.0.0.5",
+			RunInfo: executor.RunInfo{
+				MetricsConfig: executor.MetricsConfig{Guid: "some-app-guid", Index: 2},
+				Env:           []executor.EnvironmentVariable{{Name: "SECRET", Value: "shh"}},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		notifier, err := callbacks.NewWebhookNotifier(lagertest.NewTestLogger("test"), hub, http.DefaultClient, fakeClock, 3, time.Second, "some-cell", webhooks)
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(notifier)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		server.Close()
+		hub.Close()
+	})
+
+	It("posts the metadata of the container to the webhooks subscribed to the event", func() {
+		hub.Emit(executor.NewContainerRunningEvent(container, "some-trace-id"))
+
+		expected := callbacks.WebhookPayload{
+			Event:      callbacks.WebhookEventRunning,
+			CellID:     "some-cell",
+			Timestamp:  fakeClock.Now().UnixNano(),
+			Guid:       "some-guid",
+			State:      executor.StateRunning,
+			Tags:       executor.Tags{"some-tag": "some-value"},
+			AppGuid:    "some-app-guid",
+			Index:      2,
+			MemoryMB:   128,
+			DiskMB:     256,
+			InternalIP: "10.0.0.5",
+		}
+		Eventually(received("/security")).Should(Equal([]callbacks.WebhookPayload{expected}))
+		Eventually(received("/cmdb")).Should(HaveLen(2))
+		Expect(received("/cmdb")()).To(ContainElement(expected))
+	})
+
+	It("only posts to the webhooks subscribed to the event", func() {
+		container.State = executor.StateReserved
+		hub.Emit(executor.NewContainerReservedEvent(container, "some-trace-id"))
+
+		Eventually(received("/cmdb")).Should(HaveLen(1))
+		Expect(received("/cmdb")()[0].Event).To(Equal(callbacks.WebhookEventReserved))
+		Consistently(received("/security")).Should(BeEmpty())
+	})
+
+	It("posts the created event once, along with the first running event", func() {
+		hub.Emit(executor.NewContainerRunningEvent(container, "some-trace-id"))
+		Eventually(received("/cmdb")).Should(HaveLen(2))
+
+		hub.Emit(executor.NewContainerRunningEvent(container, "some-trace-id"))
+		Eventually(received("/cmdb")).Should(HaveLen(3))
+		Consistently(received("/cmdb")).Should(HaveLen(3))
+
+		var created []callbacks.WebhookPayload
+		for _, payload := range received("/cmdb")() {
+			if payload.Event == callbacks.WebhookEventCreated {
+				created = append(created, payload)
+			}
+		}
+		Expect(created).To(HaveLen(1))
+		Expect(created[0].State).To(Equal(executor.StateCreated))
+	})
+
+	It("includes the result of completed containers", func() {
+		container.State = executor.StateCompleted
+		container.RunResult = executor.ContainerRunResult{Failed: true, FailureReason: "exit status 2"}
+		hub.Emit(executor.NewContainerCompleteEvent(container, "some-trace-id"))
+
+		Eventually(received("/cmdb")).Should(HaveLen(1))
+		payload := received("/cmdb")()[0]
+		Expect(payload.Event).To(Equal(callbacks.WebhookEventCompleted))
+		Expect(payload.RunResult).To(Equal(&container.RunResult))
+	})
+
+	It("ignores other events", func() {
+		hub.Emit(executor.NewContainerRoutabilityEvent(container, "some-trace-id"))
+		Consistently(received("/cmdb")).Should(BeEmpty())
+	})
+
+	Context("when the webhook fails with a server error", func() {
+		BeforeEach(func() {
+			responses = []int{http.StatusServiceUnavailable}
+		})
+
+		It("retries", func() {
+			container.State = executor.StateReserved
+			hub.Emit(executor.NewContainerReservedEvent(container, "some-trace-id"))
+			Eventually(received("/cmdb")).Should(HaveLen(1))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(received("/cmdb")).Should(HaveLen(2))
+		})
+	})
+
+	It("rejects unknown events", func() {
+		_, err := callbacks.NewWebhookNotifier(lagertest.NewTestLogger("test"), hub, http.DefaultClient, fakeClock, 3, time.Second, "some-cell", []callbacks.Webhook{
+			{URL: server.URL, Events: []string{"destroyed"}},
+		})
+		Expect(err).To(MatchError(ContainSubstring(`unknown webhook event "destroyed"`)))
+	})
+})
@@ -0,0 +1,78 @@
+package containerstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	bandwidthHookTimeout = 30 * time.Second
+
+	// bandwidthHookWaitDelay bounds how long the output of the hook is read
+	// once it exited or was killed, as the processes it started can keep its
+	// output open.
+	bandwidthHookWaitDelay = 5 * time.Second
+)
+
+//go:generate counterfeiter -o containerstorefakes/fake_bandwidth_limiter.go . BandwidthLimiter
+
+// BandwidthLimiter limits the ingress traffic of containers, which garden
+// cannot, e.g. with tc on the host side of their network interface. The
+// egress traffic is limited by garden.
+type BandwidthLimiter interface {
+	Limit(logger lager.Logger, guid, containerIP string, rate, burst uint64) error
+	Clear(logger lager.Logger, guid string) error
+}
+
+type commandBandwidthLimiter struct {
+	command []string
+}
+
+// NewCommandBandwidthLimiter returns a BandwidthLimiter that runs the command
+// on the cell, with the arguments
+//
+//	limit <guid> <container-ip> <rate-in-bytes-per-second> <burst-rate-in-bytes-per-second>
+//
+// to limit the ingress traffic of a container, and
+//
+//	clear <guid>
+//
+// once the container is destroyed. The command is killed when it takes
+// longer than 30 seconds.
+func NewCommandBandwidthLimiter(command []string) BandwidthLimiter {
+	return &commandBandwidthLimiter{command: command}
+}
+
+func (l *commandBandwidthLimiter) Limit(logger lager.Logger, guid, containerIP string, rate, burst uint64) error {
+	return l.run(logger.Session("limit-bandwidth", lager.Data{"guid": guid}),
+		"limit", guid, containerIP, strconv.FormatUint(rate, 10), strconv.FormatUint(burst, 10))
+}
+
+func (l *commandBandwidthLimiter) Clear(logger lager.Logger, guid string) error {
+	return l.run(logger.Session("clear-bandwidth", lager.Data{"guid": guid}), "clear", guid)
+}
+
+func (l *commandBandwidthLimiter) run(logger lager.Logger, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bandwidthHookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, l.command[0], append(l.command[1:], args...)...)
+	cmd.WaitDelay = bandwidthHookWaitDelay
+	output, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		logger.Info("bandwidth-hook-left-its-output-open")
+		return nil
+	}
+	if err != nil {
+		logger.Error("failed-to-run-bandwidth-hook", err, lager.Data{"output": string(output)})
+		return fmt.Errorf("bandwidth hook failed: %s: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
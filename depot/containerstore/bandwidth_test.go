@@ -0,0 +1,60 @@
+package containerstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CommandBandwidthLimiter", func() {
+	var (
+		logger   *lagertest.TestLogger
+		argsPath string
+		limiter  containerstore.BandwidthLimiter
+	)
+
+	BeforeEach(func() {
+		if runtime.GOOS == "windows" {
+			Skip("the hook is a shell script")
+		}
+
+		logger = lagertest.NewTestLogger("test")
+		dir := GinkgoT().TempDir()
+		argsPath = filepath.Join(dir, "args")
+		hookPath := filepath.Join(dir, "hook")
+		Expect(os.WriteFile(hookPath, []byte("#!/bin/sh\necho \"$@\" >> \"$1\"\n"), 0755)).To(Succeed())
+
+		limiter = containerstore.NewCommandBandwidthLimiter([]string{hookPath, argsPath})
+	})
+
+	It("runs the hook to limit and clear the ingress bandwidth of a container", func() {
+		Expect(limiter.Limit(logger, "some-guid", "10.0.0.5", 1000, 2000)).To(Succeed())
+		Expect(limiter.Clear(logger, "some-guid")).To(Succeed())
+
+		args, err := os.ReadFile(argsPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(args)).To(Equal(
+			argsPath + " limit some-guid 10.0.0.5 1000 2000\n" +
+				argsPath + " clear some-guid\n",
+		))
+	})
+
+	It("does not wait for the processes the hook leaves running", func() {
+		limiter = containerstore.NewCommandBandwidthLimiter([]string{"/bin/sh", "-c", "sleep 60 & exit 0"})
+		start := time.Now()
+		Expect(limiter.Clear(logger, "some-guid")).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 30*time.Second))
+	})
+
+	It("fails with the output of the hook when it fails", func() {
+		limiter = containerstore.NewCommandBandwidthLimiter([]string{"/bin/sh", "-c", "echo no tc >&2; exit 1"})
+		err := limiter.Clear(logger, "some-guid")
+		Expect(err).To(MatchError("bandwidth hook failed: exit status 1: no tc"))
+	})
+})
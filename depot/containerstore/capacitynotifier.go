@@ -0,0 +1,57 @@
+package containerstore
+
+import "sync"
+
+// CapacityNotifier notifies its subscribers when containers are allocated or
+// deallocated, or the capacity of the cell changes. Notifications are
+// coalesced: a subscriber that has not received the last notification yet
+// is not notified again.
+type CapacityNotifier struct {
+	lock        sync.Mutex
+	subscribers map[<-chan struct{}]chan struct{}
+}
+
+func NewCapacityNotifier() *CapacityNotifier {
+	return &CapacityNotifier{
+		subscribers: map[<-chan struct{}]chan struct{}{},
+	}
+}
+
+func (n *CapacityNotifier) Subscribe() <-chan struct{} {
+	if n == nil {
+		return nil
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	ch := make(chan struct{}, 1)
+	n.subscribers[ch] = ch
+	return ch
+}
+
+func (n *CapacityNotifier) Unsubscribe(ch <-chan struct{}) {
+	if n == nil {
+		return
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	delete(n.subscribers, ch)
+}
+
+func (n *CapacityNotifier) notify() {
+	if n == nil {
+		return
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, ch := range n.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
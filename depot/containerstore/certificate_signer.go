@@ -0,0 +1,481 @@
+package containerstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	SignerTypeLocal = "local"
+	SignerTypeCFSSL = "cfssl"
+	SignerTypeVault = "vault"
+)
+
+const certificateRequestPEMBlockType = "CERTIFICATE REQUEST"
+
+var (
+	ErrNoCertificateInResponse = errors.New("no certificate in signer response")
+	ErrSignerBackingOff        = errors.New("signer is backing off after a failure")
+)
+
+//go:generate counterfeiter -o containerstorefakes/fake_certificate_signer.go . CertificateSigner
+
+// CertificateSigner issues a certificate for the given template and the
+// public key of privateKey. It returns the DER encoded certificate followed by
+// the DER encoded certificates of the chain of the CA that issued it.
+type CertificateSigner interface {
+	SignCertificate(logger lager.Logger, template *x509.Certificate, privateKey crypto.Signer) ([][]byte, error)
+}
+
+type localSigner struct {
+	entropyReader io.Reader
+	caCert        *x509.Certificate
+	caKey         crypto.Signer
+	chain         []*x509.Certificate
+}
+
+// NewLocalSigner returns a CertificateSigner that signs certificates in
+// process with the given CA certificate and key, and returns them with the
+// certificates in chain.
+func NewLocalSigner(entropyReader io.Reader, caCert *x509.Certificate, caKey crypto.Signer, chain []*x509.Certificate) CertificateSigner {
+	return &localSigner{
+		entropyReader: entropyReader,
+		caCert:        caCert,
+		caKey:         caKey,
+		chain:         chain,
+	}
+}
+
+func (s *localSigner) SignCertificate(logger lager.Logger, template *x509.Certificate, privateKey crypto.Signer) ([][]byte, error) {
+	certBytes, err := x509.CreateCertificate(s.entropyReader, template, s.caCert, privateKey.Public(), s.caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := [][]byte{certBytes}
+	for _, caCert := range s.chain {
+		certs = append(certs, caCert.Raw)
+	}
+	return certs, nil
+}
+
+type revocationEndpointsSigner struct {
+	signer     CertificateSigner
+	crlURL     string
+	ocspServer string
+}
+
+// NewRevocationEndpointsSigner returns a CertificateSigner that points the
+// certificates signed by signer to the CRL and the OCSP responder of their
+// CA, so that relying parties can check whether they were revoked. Empty
+// endpoints are left out.
+func NewRevocationEndpointsSigner(signer CertificateSigner, crlURL, ocspServer string) CertificateSigner {
+	return &revocationEndpointsSigner{
+		signer:     signer,
+		crlURL:     crlURL,
+		ocspServer: ocspServer,
+	}
+}
+
+func (s *revocationEndpointsSigner) SignCertificate(logger lager.Logger, template *x509.Certificate, privateKey crypto.Signer) ([][]byte, error) {
+	withEndpoints := *template
+	if s.crlURL != "" {
+		withEndpoints.CRLDistributionPoints = []string{s.crlURL}
+	}
+	if s.ocspServer != "" {
+		withEndpoints.OCSPServer = []string{s.ocspServer}
+	}
+	return s.signer.SignCertificate(logger, &withEndpoints, privateKey)
+}
+
+type cfsslSigner struct {
+	httpClient    *http.Client
+	entropyReader io.Reader
+	url           string
+	profile       string
+
+	chainLock sync.Mutex
+	chain     [][]byte
+}
+
+// NewCFSSLSigner returns a CertificateSigner that submits a CSR to the
+// /api/v1/cfssl/sign endpoint of the CFSSL server at url. The certificate of
+// the CA is fetched once from its /api/v1/cfssl/info endpoint.
+func NewCFSSLSigner(httpClient *http.Client, entropyReader io.Reader, url, profile string) CertificateSigner {
+	return &cfsslSigner{
+		httpClient:    httpClient,
+		entropyReader: entropyReader,
+		url:           strings.TrimSuffix(url, "/"),
+		profile:       profile,
+	}
+}
+
+type cfsslSignRequest struct {
+	CertificateRequest string   `json:"certificate_request"`
+	Hosts              []string `json:"hosts,omitempty"`
+	Profile            string   `json:"profile,omitempty"`
+}
+
+type cfsslInfoRequest struct {
+	Profile string `json:"profile,omitempty"`
+}
+
+type cfsslResponse struct {
+	Success bool `json:"success"`
+	Result  struct {
+		Certificate string `json:"certificate"`
+	} `json:"result"`
+	Errors []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (r cfsslResponse) err(operation string) error {
+	if r.Success {
+		return nil
+	}
+	if len(r.Errors) > 0 {
+		return fmt.Errorf("cfssl %s failed: %s", operation, r.Errors[0].Message)
+	}
+	return fmt.Errorf("cfssl %s failed", operation)
+}
+
+func (s *cfsslSigner) SignCertificate(logger lager.Logger, template *x509.Certificate, privateKey crypto.Signer) ([][]byte, error) {
+	chain, err := s.caChain()
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := createCSR(s.entropyReader, template, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	request := cfsslSignRequest{
+		CertificateRequest: csr,
+		Hosts:              certificateHosts(template),
+		Profile:            s.profile,
+	}
+
+	var response cfsslResponse
+	err = postJSON(s.httpClient, s.url+"/api/v1/cfssl/sign", nil, request, &response)
+	if err != nil {
+		return nil, err
+	}
+	if err := response.err("sign"); err != nil {
+		return nil, err
+	}
+
+	certs, err := decodeCertificates(response.Result.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return append(certs[:1], chain...), nil
+}
+
+// caChain returns the certificate of the CA of the profile. It is only
+// cached once it was fetched, so that a CFSSL server that is down when the
+// cell starts does not leave the certificates without their chain.
+func (s *cfsslSigner) caChain() ([][]byte, error) {
+	s.chainLock.Lock()
+	defer s.chainLock.Unlock()
+	if s.chain != nil {
+		return s.chain, nil
+	}
+
+	var response cfsslResponse
+	err := postJSON(s.httpClient, s.url+"/api/v1/cfssl/info", nil, cfsslInfoRequest{Profile: s.profile}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if err := response.err("info"); err != nil {
+		return nil, err
+	}
+
+	chain, err := decodeCertificates(response.Result.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	s.chain = chain
+	return chain, nil
+}
+
+type vaultSigner struct {
+	httpClient    *http.Client
+	entropyReader io.Reader
+	url           string
+	mount         string
+	role          string
+	token         string
+}
+
+// NewVaultSigner returns a CertificateSigner that submits a CSR to the
+// sign endpoint of the given role in a Vault PKI secrets engine.
+func NewVaultSigner(httpClient *http.Client, entropyReader io.Reader, url, mount, role, token string) CertificateSigner {
+	return &vaultSigner{
+		httpClient:    httpClient,
+		entropyReader: entropyReader,
+		url:           strings.TrimSuffix(url, "/"),
+		mount:         strings.Trim(mount, "/"),
+		role:          role,
+		token:         token,
+	}
+}
+
+type vaultSignRequest struct {
+	CSR               string `json:"csr"`
+	CommonName        string `json:"common_name"`
+	AltNames          string `json:"alt_names,omitempty"`
+	IPSANs            string `json:"ip_sans,omitempty"`
+	URISANs           string `json:"uri_sans,omitempty"`
+	TTL               string `json:"ttl,omitempty"`
+	ExcludeCNFromSANs bool   `json:"exclude_cn_from_sans"`
+}
+
+type vaultSignResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (s *vaultSigner) SignCertificate(logger lager.Logger, template *x509.Certificate, privateKey crypto.Signer) ([][]byte, error) {
+	csr, err := createCSR(s.entropyReader, template, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips, uris []string
+	for _, ip := range template.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	for _, uri := range template.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	request := vaultSignRequest{
+		CSR:               csr,
+		CommonName:        template.Subject.CommonName,
+		AltNames:          strings.Join(template.DNSNames, ","),
+		IPSANs:            strings.Join(ips, ","),
+		URISANs:           strings.Join(uris, ","),
+		TTL:               template.NotAfter.Sub(template.NotBefore).String(),
+		ExcludeCNFromSANs: true,
+	}
+
+	var response vaultSignResponse
+	headers := map[string]string{"X-Vault-Token": s.token}
+	err = postJSON(s.httpClient, fmt.Sprintf("%s/v1/%s/sign/%s", s.url, s.mount, s.role), headers, request, &response)
+	if err != nil {
+		if len(response.Errors) > 0 {
+			return nil, fmt.Errorf("vault sign failed: %s", strings.Join(response.Errors, "; "))
+		}
+		return nil, err
+	}
+
+	certs, err := decodeCertificates(response.Data.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	// ca_chain holds the issuing CA and its parents, up to the root of the
+	// mount; older versions of Vault only return the issuing CA
+	chainPEM := response.Data.CAChain
+	if len(chainPEM) == 0 {
+		chainPEM = []string{response.Data.IssuingCA}
+	}
+	for _, caPEM := range chainPEM {
+		caCerts, err := decodeCertificates(caPEM)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, caCerts...)
+	}
+	return certs, nil
+}
+
+type retryingSigner struct {
+	signer       CertificateSigner
+	fallback     CertificateSigner
+	clock        clock.Clock
+	maxAttempts  int
+	initialDelay time.Duration
+
+	lock     sync.Mutex
+	failures int
+	retryAt  time.Time
+}
+
+// NewRetryingSigner signs with signer and backs off from it when it fails,
+// without blocking the generation of credentials: until the delay expires,
+// certificates are signed with fallback, or fail with ErrSignerBackingOff if
+// it is nil, and the rotation of the credentials retries them. The delay
+// starts at initialDelay and doubles with every consecutive failure, up to
+// maxAttempts-1 times.
+func NewRetryingSigner(signer, fallback CertificateSigner, clock clock.Clock, maxAttempts int, initialDelay time.Duration) CertificateSigner {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &retryingSigner{
+		signer:       signer,
+		fallback:     fallback,
+		clock:        clock,
+		maxAttempts:  maxAttempts,
+		initialDelay: initialDelay,
+	}
+}
+
+func (s *retryingSigner) SignCertificate(logger lager.Logger, template *x509.Certificate, privateKey crypto.Signer) ([][]byte, error) {
+	err := ErrSignerBackingOff
+	if s.ready() {
+		var certs [][]byte
+		certs, err = s.signer.SignCertificate(logger, template, privateKey)
+		s.record(logger, err)
+		if err == nil {
+			return certs, nil
+		}
+	}
+
+	if s.fallback == nil {
+		return nil, err
+	}
+
+	logger.Info("signing-with-fallback-signer")
+	return s.fallback.SignCertificate(logger, template, privateKey)
+}
+
+func (s *retryingSigner) ready() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.clock.Now().Before(s.retryAt)
+}
+
+func (s *retryingSigner) record(logger lager.Logger, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err == nil {
+		s.failures = 0
+		return
+	}
+
+	delay := s.initialDelay
+	for i := 0; i < s.failures && i < s.maxAttempts-1; i++ {
+		delay *= 2
+	}
+	s.failures++
+	s.retryAt = s.clock.Now().Add(delay)
+	logger.Error("failed-to-sign-certificate", err, lager.Data{"failures": s.failures, "retry-in": delay.String()})
+}
+
+func createCSR(entropyReader io.Reader, template *x509.Certificate, privateKey crypto.Signer) (string, error) {
+	csrBytes, err := x509.CreateCertificateRequest(entropyReader, &x509.CertificateRequest{
+		Subject:     template.Subject,
+		DNSNames:    template.DNSNames,
+		IPAddresses: template.IPAddresses,
+		URIs:        template.URIs,
+	}, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = pemEncode(csrBytes, certificateRequestPEMBlockType, &buf)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func certificateHosts(template *x509.Certificate) []string {
+	hosts := append([]string{}, template.DNSNames...)
+	for _, ip := range template.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	for _, uri := range template.URIs {
+		hosts = append(hosts, uri.String())
+	}
+	return hosts
+}
+
+func decodeCertificates(certPEM string) ([][]byte, error) {
+	var certs [][]byte
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == certificatePEMBlockType {
+			certs = append(certs, block.Bytes)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoCertificateInResponse
+	}
+	return certs, nil
+}
+
+func postJSON(httpClient *http.Client, url string, headers map[string]string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decodeErr := json.NewDecoder(resp.Body).Decode(response)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code from signer: %d", resp.StatusCode)
+	}
+	return decodeErr
+}
+
+// NewSignerHTTPClient returns an http.Client suitable for talking to an
+// external CA.
+func NewSignerHTTPClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			Dial: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).Dial,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		},
+	}
+}
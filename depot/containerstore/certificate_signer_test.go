@@ -0,0 +1,327 @@
+package containerstore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/executor/depot/containerstore/containerstorefakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CertificateSigner", func() {
+	var (
+		logger     *lagertest.TestLogger
+		caCert     *x509.Certificate
+		caKey      *rsa.PrivateKey
+		privateKey *ecdsa.PrivateKey
+		template   *x509.Certificate
+	)
+
+	BeforeEach(func() {
+		var err error
+		logger = lagertest.NewTestLogger("signer")
+		caCert, caKey = createIntermediateCert()
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		now := time.Now().UTC().Truncate(time.Second)
+		template = &x509.Certificate{
+			SerialNumber: big.NewInt(42),
+			DNSNames:     []string{"some-guid"},
+			NotBefore:    now,
+			NotAfter:     now.Add(time.Hour),
+		}
+		template.Subject.CommonName = "some-guid"
+	})
+
+	signLocally := func() []byte {
+		certs, err := containerstore.NewLocalSigner(rand.Reader, caCert, caKey, nil).SignCertificate(logger, template, privateKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certs).To(HaveLen(1))
+		return certs[0]
+	}
+
+	toPEM := func(der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	parseCSR := func(csrPEM string) *x509.CertificateRequest {
+		block, _ := pem.Decode([]byte(csrPEM))
+		Expect(block).NotTo(BeNil())
+		Expect(block.Type).To(Equal("CERTIFICATE REQUEST"))
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(csr.CheckSignature()).To(Succeed())
+		return csr
+	}
+
+	Describe("LocalSigner", func() {
+		It("signs the certificate with the CA key", func() {
+			certs, err := x509.ParseCertificates(signLocally())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs[0].CheckSignatureFrom(caCert)).To(Succeed())
+			Expect(certs[0].PublicKey).To(Equal(privateKey.Public()))
+		})
+
+		It("returns the certificate with the chain", func() {
+			certs, err := containerstore.NewLocalSigner(rand.Reader, caCert, caKey, []*x509.Certificate{caCert}).SignCertificate(logger, template, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs).To(HaveLen(2))
+			Expect(certs[1]).To(Equal(caCert.Raw))
+		})
+	})
+
+	Describe("RevocationEndpointsSigner", func() {
+		It("points the certificate to the CRL and the OCSP responder", func() {
+			signer := containerstore.NewRevocationEndpointsSigner(
+				containerstore.NewLocalSigner(rand.Reader, caCert, caKey, nil),
+				"https://crl.example.com/instance-identity.crl",
+				"https://ocsp.example.com",
+			)
+			certs, err := signer.SignCertificate(logger, template, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			cert, err := x509.ParseCertificate(certs[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.CRLDistributionPoints).To(Equal([]string{"https://crl.example.com/instance-identity.crl"}))
+			Expect(cert.OCSPServer).To(Equal([]string{"https://ocsp.example.com"}))
+			Expect(template.CRLDistributionPoints).To(BeEmpty())
+		})
+	})
+
+	Describe("CFSSLSigner", func() {
+		var (
+			server     *httptest.Server
+			statusCode int
+			infoCalls  int
+		)
+
+		BeforeEach(func() {
+			statusCode = http.StatusOK
+			infoCalls = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				if r.URL.Path == "/api/v1/cfssl/info" {
+					infoCalls++
+					var request map[string]interface{}
+					Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+					Expect(request["profile"]).To(Equal("instance-identity"))
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"success": true,
+						"result":  map[string]string{"certificate": toPEM(caCert.Raw)},
+					})
+					return
+				}
+				Expect(r.URL.Path).To(Equal("/api/v1/cfssl/sign"))
+
+				var request map[string]interface{}
+				Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+				csr := parseCSR(request["certificate_request"].(string))
+				Expect(csr.Subject.CommonName).To(Equal("some-guid"))
+				Expect(request["profile"]).To(Equal("instance-identity"))
+
+				w.WriteHeader(statusCode)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": statusCode == http.StatusOK,
+					"result":  map[string]string{"certificate": toPEM(signLocally())},
+					"errors":  []map[string]interface{}{{"code": 1, "message": "boom"}},
+				})
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("returns the certificate issued by CFSSL with the certificate of its CA", func() {
+			signer := containerstore.NewCFSSLSigner(http.DefaultClient, rand.Reader, server.URL+"/", "instance-identity")
+			certs, err := signer.SignCertificate(logger, template, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs).To(HaveLen(2))
+
+			cert, err := x509.ParseCertificate(certs[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.Subject.CommonName).To(Equal("some-guid"))
+			Expect(certs[1]).To(Equal(caCert.Raw))
+		})
+
+		It("fetches the certificate of the CA once", func() {
+			signer := containerstore.NewCFSSLSigner(http.DefaultClient, rand.Reader, server.URL, "instance-identity")
+			_, err := signer.SignCertificate(logger, template, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = signer.SignCertificate(logger, template, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(infoCalls).To(Equal(1))
+		})
+
+		Context("when CFSSL fails to sign the CSR", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusBadRequest
+			})
+
+			It("returns an error", func() {
+				signer := containerstore.NewCFSSLSigner(http.DefaultClient, rand.Reader, server.URL, "instance-identity")
+				_, err := signer.SignCertificate(logger, template, privateKey)
+				Expect(err).To(MatchError("unexpected status code from signer: 400"))
+			})
+		})
+	})
+
+	Describe("VaultSigner", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.URL.Path).To(Equal("/v1/pki/sign/instance-identity"))
+				if r.Header.Get("X-Vault-Token") != "some-token" {
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+					return
+				}
+
+				var request map[string]interface{}
+				Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+				parseCSR(request["csr"].(string))
+				Expect(request["common_name"]).To(Equal("some-guid"))
+				Expect(request["alt_names"]).To(Equal("some-guid"))
+				Expect(request["ttl"]).To(Equal("1h0m0s"))
+
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": map[string]interface{}{
+						"certificate": toPEM(signLocally()),
+						"issuing_ca":  toPEM(caCert.Raw),
+						"ca_chain":    []string{toPEM(caCert.Raw)},
+					},
+				})
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("returns the certificate issued by Vault with the chain of its CA", func() {
+			signer := containerstore.NewVaultSigner(http.DefaultClient, rand.Reader, server.URL, "/pki/", "instance-identity", "some-token")
+			certs, err := signer.SignCertificate(logger, template, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(certs).To(HaveLen(2))
+
+			cert, err := x509.ParseCertificate(certs[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.CheckSignatureFrom(caCert)).To(Succeed())
+			Expect(certs[1]).To(Equal(caCert.Raw))
+		})
+
+		Context("when Vault rejects the request", func() {
+			It("returns the errors reported by Vault", func() {
+				signer := containerstore.NewVaultSigner(http.DefaultClient, rand.Reader, server.URL, "pki", "instance-identity", "bad-token")
+				_, err := signer.SignCertificate(logger, template, privateKey)
+				Expect(err).To(MatchError("vault sign failed: permission denied"))
+			})
+		})
+	})
+
+	Describe("RetryingSigner", func() {
+		var (
+			clock          *fakeclock.FakeClock
+			externalSigner *containerstorefakes.FakeCertificateSigner
+			fallbackSigner *containerstorefakes.FakeCertificateSigner
+		)
+
+		BeforeEach(func() {
+			clock = fakeclock.NewFakeClock(time.Now())
+			externalSigner = &containerstorefakes.FakeCertificateSigner{}
+			fallbackSigner = &containerstorefakes.FakeCertificateSigner{}
+			fallbackSigner.SignCertificateReturns([][]byte{[]byte("fallback-cert")}, nil)
+		})
+
+		It("returns the certificate from the signer", func() {
+			externalSigner.SignCertificateReturns([][]byte{[]byte("cert")}, nil)
+			signer := containerstore.NewRetryingSigner(externalSigner, fallbackSigner, clock, 3, time.Second)
+
+			Expect(signer.SignCertificate(logger, template, privateKey)).To(Equal([][]byte{[]byte("cert")}))
+			Expect(fallbackSigner.SignCertificateCallCount()).To(Equal(0))
+		})
+
+		Context("when the signer keeps failing", func() {
+			BeforeEach(func() {
+				externalSigner.SignCertificateReturns(nil, errors.New("unavailable"))
+			})
+
+			It("uses the fallback and backs off exponentially without blocking", func() {
+				signer := containerstore.NewRetryingSigner(externalSigner, fallbackSigner, clock, 3, time.Second)
+				sign := func() [][]byte {
+					certs, err := signer.SignCertificate(logger, template, privateKey)
+					Expect(err).NotTo(HaveOccurred())
+					return certs
+				}
+
+				Expect(sign()).To(Equal([][]byte{[]byte("fallback-cert")}))
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(1))
+
+				sign()
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(1))
+
+				clock.Increment(time.Second)
+				sign()
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(2))
+
+				clock.Increment(time.Second)
+				sign()
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(2))
+
+				clock.Increment(time.Second)
+				sign()
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(3))
+
+				clock.Increment(4 * time.Second)
+				sign()
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(4))
+			})
+
+			It("uses the signer again once it recovers", func() {
+				signer := containerstore.NewRetryingSigner(externalSigner, fallbackSigner, clock, 3, time.Second)
+				_, err := signer.SignCertificate(logger, template, privateKey)
+				Expect(err).NotTo(HaveOccurred())
+
+				externalSigner.SignCertificateReturns([][]byte{[]byte("cert")}, nil)
+				clock.Increment(time.Second)
+				Expect(signer.SignCertificate(logger, template, privateKey)).To(Equal([][]byte{[]byte("cert")}))
+
+				externalSigner.SignCertificateReturns(nil, errors.New("unavailable"))
+				_, err = signer.SignCertificate(logger, template, privateKey)
+				Expect(err).NotTo(HaveOccurred())
+				clock.Increment(time.Second)
+				signer.SignCertificate(logger, template, privateKey)
+				Expect(externalSigner.SignCertificateCallCount()).To(Equal(4))
+			})
+
+			Context("when there is no fallback", func() {
+				It("returns the error, and backs off until the delay expires", func() {
+					signer := containerstore.NewRetryingSigner(externalSigner, nil, clock, 1, time.Second)
+					_, err := signer.SignCertificate(logger, template, privateKey)
+					Expect(err).To(MatchError("unavailable"))
+
+					_, err = signer.SignCertificate(logger, template, privateKey)
+					Expect(err).To(Equal(containerstore.ErrSignerBackingOff))
+					Expect(externalSigner.SignCertificateCallCount()).To(Equal(1))
+				})
+			})
+		})
+	})
+})
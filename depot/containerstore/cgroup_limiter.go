@@ -0,0 +1,114 @@
+package containerstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+//go:generate counterfeiter -o containerstorefakes/fake_cgroup_limiter.go . CgroupLimiter
+
+// CgroupLimiter applies the limits of containers that garden has no spec
+// for, by writing them to the cgroups of the containers on the cell.
+type CgroupLimiter interface {
+	SetCPUSet(logger lager.Logger, guid string, cpus []int) error
+	AllowDevices(logger lager.Logger, guid string, devices []string) error
+	SetSysctls(logger lager.Logger, guid string, sysctls map[string]string) error
+	SetSwapLimit(logger lager.Logger, guid string, memoryLimit, swapLimit uint64) error
+}
+
+type cgroupLimiter struct {
+	root string
+}
+
+// NewCgroupLimiter writes to the cgroups of the containers, which garden
+// creates in the root directory under the container guid. On cgroup v1 the
+// root contains {controller}, which is replaced by the controller of the
+// file that is written, e.g. /sys/fs/cgroup/{controller}/garden.
+func NewCgroupLimiter(root string) CgroupLimiter {
+	return &cgroupLimiter{root: root}
+}
+
+func (l *cgroupLimiter) SetCPUSet(logger lager.Logger, guid string, cpus []int) error {
+	return l.write(logger.Session("set-cpuset", lager.Data{"guid": guid}), guid, "cpuset", "cpuset.cpus", FormatCPUSet(cpus))
+}
+
+// AllowDevices opens the device cgroup of the container to the devices, for
+// reading, writing and mknod. Only the device cgroup of cgroup v1 can be
+// changed that way; on cgroup v2 it is a BPF program of the runtime.
+func (l *cgroupLimiter) AllowDevices(logger lager.Logger, guid string, devices []string) error {
+	logger = logger.Session("allow-devices", lager.Data{"guid": guid})
+	for _, device := range devices {
+		rule, err := deviceRule(device)
+		if err != nil {
+			logger.Error("failed-to-stat-device", err, lager.Data{"device": device})
+			return err
+		}
+		err = l.write(logger, guid, "devices", "devices.allow", rule)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetSwapLimit limits the swap of the container on top of its memory limit.
+// Cgroup v1 limits memory and swap together instead.
+func (l *cgroupLimiter) SetSwapLimit(logger lager.Logger, guid string, memoryLimit, swapLimit uint64) error {
+	logger = logger.Session("set-swap-limit", lager.Data{"guid": guid})
+
+	if _, err := os.Stat(l.path(guid, "memory", "memory.swap.max")); err == nil {
+		return l.write(logger, guid, "memory", "memory.swap.max", strconv.FormatUint(swapLimit, 10))
+	}
+	if memoryLimit == 0 {
+		return errors.New("the swap of containers without a memory limit cannot be limited on cgroup v1")
+	}
+	return l.write(logger, guid, "memory", "memory.memsw.limit_in_bytes", strconv.FormatUint(memoryLimit+swapLimit, 10))
+}
+
+// SetSysctls sets the sysctls in the namespaces of the container, which are
+// entered through the first process of its cgroup.
+func (l *cgroupLimiter) SetSysctls(logger lager.Logger, guid string, sysctls map[string]string) error {
+	logger = logger.Session("set-sysctls", lager.Data{"guid": guid})
+
+	procs, err := os.ReadFile(l.path(guid, "memory", "cgroup.procs"))
+	if err != nil {
+		logger.Error("failed-to-read-cgroup-procs", err)
+		return err
+	}
+	pid, err := strconv.Atoi(strings.SplitN(strings.TrimSpace(string(procs)), "\n", 2)[0])
+	if err != nil {
+		logger.Error("failed-to-find-container-process", err)
+		return fmt.Errorf("container %s has no process", guid)
+	}
+
+	err = setSysctls(pid, sysctls)
+	if err != nil {
+		logger.Error("failed-to-set-sysctls", err, lager.Data{"pid": pid})
+	}
+	return err
+}
+
+func (l *cgroupLimiter) path(guid, controller, file string) string {
+	return filepath.Join(strings.ReplaceAll(l.root, "{controller}", controller), guid, file)
+}
+
+func (l *cgroupLimiter) write(logger lager.Logger, guid, controller, file, value string) error {
+	path := l.path(guid, controller, file)
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		_, err = f.WriteString(value)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logger.Error("failed-to-write-cgroup", err, lager.Data{"path": path, "value": value})
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package containerstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CgroupLimiter", func() {
+	var (
+		logger  *lagertest.TestLogger
+		root    string
+		limiter containerstore.CgroupLimiter
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		root = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(root, "cpuset", "some-guid"), 0755)).To(Succeed())
+
+		limiter = containerstore.NewCgroupLimiter(filepath.Join(root, "{controller}"))
+	})
+
+	It("writes the cpuset to the cgroup of the container", func() {
+		Expect(os.WriteFile(filepath.Join(root, "cpuset", "some-guid", "cpuset.cpus"), nil, 0644)).To(Succeed())
+		Expect(limiter.SetCPUSet(logger, "some-guid", []int{4, 2, 3, 8})).To(Succeed())
+
+		cpus, err := os.ReadFile(filepath.Join(root, "cpuset", "some-guid", "cpuset.cpus"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(cpus)).To(Equal("2-4,8"))
+	})
+
+	It("fails when the container has no cgroup", func() {
+		Expect(limiter.SetCPUSet(logger, "other-guid", []int{2})).NotTo(Succeed())
+	})
+
+	Describe("SetSwapLimit", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(root, "memory", "some-guid"), 0755)).To(Succeed())
+		})
+
+		It("limits memory and swap together on cgroup v1", func() {
+			Expect(os.WriteFile(filepath.Join(root, "memory", "some-guid", "memory.memsw.limit_in_bytes"), nil, 0644)).To(Succeed())
+			Expect(limiter.SetSwapLimit(logger, "some-guid", 1024, 256)).To(Succeed())
+
+			limit, err := os.ReadFile(filepath.Join(root, "memory", "some-guid", "memory.memsw.limit_in_bytes"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(limit)).To(Equal("1280"))
+		})
+
+		It("fails on cgroup v1 when the container has no memory limit", func() {
+			Expect(os.WriteFile(filepath.Join(root, "memory", "some-guid", "memory.memsw.limit_in_bytes"), nil, 0644)).To(Succeed())
+			Expect(limiter.SetSwapLimit(logger, "some-guid", 0, 256)).NotTo(Succeed())
+		})
+
+		It("limits swap on its own on cgroup v2", func() {
+			Expect(os.WriteFile(filepath.Join(root, "memory", "some-guid", "memory.swap.max"), nil, 0644)).To(Succeed())
+			Expect(limiter.SetSwapLimit(logger, "some-guid", 1024, 256)).To(Succeed())
+
+			limit, err := os.ReadFile(filepath.Join(root, "memory", "some-guid", "memory.swap.max"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(limit)).To(Equal("256"))
+		})
+	})
+
+	It("fails to set sysctls when the cgroup of the container has no process", func() {
+		Expect(os.MkdirAll(filepath.Join(root, "memory", "some-guid"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "memory", "some-guid", "cgroup.procs"), nil, 0644)).To(Succeed())
+
+		err := limiter.SetSysctls(logger, "some-guid", map[string]string{"net.core.somaxconn": "4096"})
+		Expect(err).To(MatchError("container some-guid has no process"))
+	})
+
+	Context("when the cgroup has a device controller", func() {
+		BeforeEach(func() {
+			if runtime.GOOS == "windows" {
+				Skip("windows has no device nodes")
+			}
+			Expect(os.MkdirAll(filepath.Join(root, "devices", "some-guid"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, "devices", "some-guid", "devices.allow"), nil, 0644)).To(Succeed())
+		})
+
+		It("allows the devices in the device cgroup of the container", func() {
+			Expect(limiter.AllowDevices(logger, "some-guid", []string{"/dev/null"})).To(Succeed())
+
+			rule, err := os.ReadFile(filepath.Join(root, "devices", "some-guid", "devices.allow"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(rule)).To(Equal("c 1:3 rwm"))
+		})
+
+		It("fails to allow a file that is not a device", func() {
+			notADevice := filepath.Join(root, "not-a-device")
+			Expect(os.WriteFile(notADevice, nil, 0644)).To(Succeed())
+			Expect(limiter.AllowDevices(logger, "some-guid", []string{notADevice})).NotTo(Succeed())
+		})
+	})
+
+	It("fails to allow devices without a device controller, as on cgroup v2", func() {
+		Expect(limiter.AllowDevices(logger, "some-guid", []string{"/dev/null"})).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,270 @@
+package containerstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const ContainerRecoveryFailedMessage = "failed to recover container after executor restart"
+
+var ErrNoProcessesToReattach = errors.New("garden container has no processes to re-attach to")
+
+// Checkpoint is the state of the container store that is persisted, so that
+// a restarted executor can recover the containers that are still running in
+// garden instead of destroying them.
+type Checkpoint struct {
+	SavedAt    time.Time            `json:"saved_at"`
+	Containers []executor.Container `json:"containers"`
+
+	// CredentialRotations is when the credentials of each container are next
+	// rotated, by container guid.
+	CredentialRotations map[string]time.Time `json:"credential_rotations,omitempty"`
+}
+
+// checkpointed returns what is persisted of a container: what the executor
+// needs to rebuild its steps and reattach to its processes. Its setup, which
+// is not run again, is left out, and so are the secrets of the container:
+// its environment, the environment of its run actions, which carries the
+// credentials of the services of the app, its image credentials and the
+// URLs of its downloads, which can be signed.
+//
+// The processes of a recovered container are attached to instead of being
+// run again. As they could only be started again without their environment,
+// the action and the sidecars of a recovered container are not restarted.
+func checkpointed(container executor.Container) executor.Container {
+	container.Env = nil
+	container.ImageUsername = ""
+	container.ImagePassword = ""
+	container.Setup = nil
+	container.RestartPolicy = nil
+	container.Action = withoutSecrets(container.Action)
+	container.Monitor = withoutSecrets(container.Monitor)
+	container.ReadinessMonitor = withoutSecrets(container.ReadinessMonitor)
+
+	if container.CachedDependencies != nil {
+		dependencies := make([]executor.CachedDependency, len(container.CachedDependencies))
+		for i, dependency := range container.CachedDependencies {
+			dependency.From = ""
+			dependencies[i] = dependency
+		}
+		container.CachedDependencies = dependencies
+	}
+
+	if container.Sidecars != nil {
+		sidecars := make([]executor.Sidecar, len(container.Sidecars))
+		for i, sidecar := range container.Sidecars {
+			sidecar.Action = withoutSecrets(sidecar.Action)
+			sidecar.Monitor = withoutSecrets(sidecar.Monitor)
+			sidecar.RestartPolicy = ""
+			sidecar.MaxRestarts = 0
+			sidecars[i] = sidecar
+		}
+		container.Sidecars = sidecars
+	}
+
+	if container.InitActions != nil {
+		initActions := make([]executor.InitAction, len(container.InitActions))
+		for i, initAction := range container.InitActions {
+			initAction.Action = withoutSecrets(initAction.Action)
+			initActions[i] = initAction
+		}
+		container.InitActions = initActions
+	}
+
+	return container
+}
+
+// withoutSecrets returns a copy of the action without the environment of its
+// run actions and the URLs of its downloads.
+func withoutSecrets(action *models.Action) *models.Action {
+	if action == nil {
+		return nil
+	}
+
+	copied := *action
+	switch {
+	case copied.RunAction != nil:
+		run := *copied.RunAction
+		run.Env = nil
+		copied.RunAction = &run
+	case copied.DownloadAction != nil:
+		download := *copied.DownloadAction
+		download.From = ""
+		copied.DownloadAction = &download
+	case copied.TimeoutAction != nil:
+		timeout := *copied.TimeoutAction
+		timeout.Action = withoutSecrets(timeout.Action)
+		copied.TimeoutAction = &timeout
+	case copied.EmitProgressAction != nil:
+		emitProgress := *copied.EmitProgressAction
+		emitProgress.Action = withoutSecrets(emitProgress.Action)
+		copied.EmitProgressAction = &emitProgress
+	case copied.TryAction != nil:
+		try := *copied.TryAction
+		try.Action = withoutSecrets(try.Action)
+		copied.TryAction = &try
+	case copied.ParallelAction != nil:
+		parallel := *copied.ParallelAction
+		parallel.Actions = withoutSecretsAll(parallel.Actions)
+		copied.ParallelAction = &parallel
+	case copied.SerialAction != nil:
+		serial := *copied.SerialAction
+		serial.Actions = withoutSecretsAll(serial.Actions)
+		copied.SerialAction = &serial
+	case copied.CodependentAction != nil:
+		codependent := *copied.CodependentAction
+		codependent.Actions = withoutSecretsAll(codependent.Actions)
+		copied.CodependentAction = &codependent
+	}
+	return &copied
+}
+
+func withoutSecretsAll(actions []*models.Action) []*models.Action {
+	copied := make([]*models.Action, len(actions))
+	for i, action := range actions {
+		copied[i] = withoutSecrets(action)
+	}
+	return copied
+}
+
+// ReadCheckpoint reads the checkpoint at path. It returns an empty
+// checkpoint if there is none.
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	checkpoint := Checkpoint{}
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
+
+// WriteCheckpoint replaces the checkpoint at path atomically, so that a
+// crash while writing it leaves the previous one in place.
+func WriteCheckpoint(path string, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type checkpointer struct {
+	logger      lager.Logger
+	clock       clock.Clock
+	containers  *nodeMap
+	credManager CredManager
+	changes     <-chan struct{}
+	path        string
+	interval    time.Duration
+}
+
+func newCheckpointer(logger lager.Logger, clock clock.Clock, containers *nodeMap, credManager CredManager, changes <-chan struct{}, path string, interval time.Duration) *checkpointer {
+	return &checkpointer{
+		logger:      logger,
+		clock:       clock,
+		containers:  containers,
+		credManager: credManager,
+		changes:     changes,
+		path:        path,
+		interval:    interval,
+	}
+}
+
+// Run writes a checkpoint whenever the containers change, at least every
+// interval, and a last one when it is signalled.
+func (c *checkpointer) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := c.logger.Session("checkpointer", lager.Data{"path": c.path})
+	timer := c.clock.NewTimer(c.interval)
+	defer timer.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-timer.C():
+			c.checkpoint(logger)
+
+		case <-c.changes:
+			c.checkpoint(logger)
+
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			c.checkpoint(logger)
+			return nil
+		}
+
+		timer.Reset(c.interval)
+	}
+}
+
+func (c *checkpointer) checkpoint(logger lager.Logger) {
+	nodes := c.containers.List()
+	containers := make([]executor.Container, 0, len(nodes))
+	for _, node := range nodes {
+		containers = append(containers, checkpointed(node.Info()))
+	}
+	err := WriteCheckpoint(c.path, Checkpoint{
+		SavedAt:             c.clock.Now(),
+		Containers:          containers,
+		CredentialRotations: c.credManager.RotationDeadlines(),
+	})
+	if err != nil {
+		logger.Error("failed-to-write-checkpoint", err)
+		return
+	}
+	logger.Debug("wrote-checkpoint", lager.Data{"containers": len(containers)})
+}
+
+// changeNotifier tells the checkpointer that the containers changed, without
+// blocking when it is already about to write a checkpoint.
+type changeNotifier chan struct{}
+
+func (c changeNotifier) changed() {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// notifyingHub notifies the checkpointer of the events of containers, which
+// are emitted whenever their state changes.
+type notifyingHub struct {
+	event.Hub
+	changes changeNotifier
+}
+
+func (h notifyingHub) Emit(e executor.Event) {
+	h.Hub.Emit(e)
+	h.changes.changed()
+}
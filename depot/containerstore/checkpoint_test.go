@@ -0,0 +1,56 @@
+package containerstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checkpoint", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "checkpoint.json")
+	})
+
+	It("reads the checkpoint that was written", func() {
+		checkpoint := containerstore.Checkpoint{
+			SavedAt: time.Unix(123, 0).UTC(),
+			Containers: []executor.Container{
+				{Guid: "some-guid", State: executor.StateRunning},
+			},
+		}
+		Expect(containerstore.WriteCheckpoint(path, checkpoint)).To(Succeed())
+
+		read, err := containerstore.ReadCheckpoint(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(read.SavedAt).To(BeTemporally("==", checkpoint.SavedAt))
+		Expect(read.Containers).To(HaveLen(1))
+		Expect(read.Containers[0].Guid).To(Equal("some-guid"))
+		Expect(read.Containers[0].State).To(Equal(executor.StateRunning))
+	})
+
+	It("leaves no temporary files behind", func() {
+		Expect(containerstore.WriteCheckpoint(path, containerstore.Checkpoint{})).To(Succeed())
+		entries, err := os.ReadDir(filepath.Dir(path))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("reads an empty checkpoint when there is none", func() {
+		checkpoint, err := containerstore.ReadCheckpoint(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint.Containers).To(BeEmpty())
+	})
+
+	It("fails to read a corrupted checkpoint", func() {
+		Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+		_, err := containerstore.ReadCheckpoint(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
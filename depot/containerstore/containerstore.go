@@ -3,6 +3,9 @@ package containerstore
 import (
 	"errors"
 	"io"
+	"net"
+	"net/http"
+	"os"
 	"time"
 
 	"code.cloudfoundry.org/clock"
@@ -11,9 +14,11 @@ import (
 	"code.cloudfoundry.org/executor/depot/event"
 	"code.cloudfoundry.org/executor/depot/transformer"
 	"code.cloudfoundry.org/executor/initializer/configuration"
+	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/volman"
 	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
 )
 
 var (
@@ -34,16 +39,31 @@ type ContainerStore interface {
 	Update(logger lager.Logger, req *executor.UpdateRequest) error
 	Stop(logger lager.Logger, traceID string, guid string) error
 
+	// SetTotalResources adjusts the advertised memory, disk and containers of
+	// the cell. Its GPUs and exclusive cores are not changed.
+	SetTotalResources(logger lager.Logger, total executor.ExecutorResources) error
+
+	// Drain prepares the containers for the cell being drained within window
+	Drain(logger lager.Logger, window time.Duration)
+
 	// Getters
 	Get(logger lager.Logger, guid string) (executor.Container, error)
 	List(logger lager.Logger) []executor.Container
 	Metrics(logger lager.Logger) (map[string]executor.ContainerMetrics, error)
 	RemainingResources(logger lager.Logger) executor.ExecutorResources
 	GetFiles(logger lager.Logger, guid, sourcePath string) (io.ReadCloser, error)
+	StreamIn(logger lager.Logger, guid, destinationPath string, tarStream io.Reader) error
+	RunProcess(logger lager.Logger, guid string, spec executor.ProcessSpec, processIO executor.ProcessIO) (executor.Process, error)
 
 	// Cleanup
 	NewRegistryPruner(logger lager.Logger) ifrit.Runner
 	NewContainerReaper(logger lager.Logger) ifrit.Runner
+	NewEgressResolver(logger lager.Logger, lookupIP func(string) ([]net.IP, error)) ifrit.Runner
+	NewPropertySyncer(logger lager.Logger) ifrit.Runner
+
+	// Recovery
+	Recover(logger lager.Logger, traceID string, checkpoint Checkpoint) error
+	NewCheckpointer(logger lager.Logger, path string, interval time.Duration) ifrit.Runner
 
 	// shutdown the dependency manager
 	Cleanup(logger lager.Logger)
@@ -55,10 +75,139 @@ type ContainerConfig struct {
 	MaxCPUShares uint64
 	SetCPUWeight bool
 
+	// AllowHostProcessContainers lets containers run as Windows HostProcess
+	// containers, with full access to the host. It has no effect on other
+	// platforms.
+	AllowHostProcessContainers bool
+
+	// AllowedSysctls are the namespaced sysctls that containers may set. They
+	// are set in the namespaces of a container with the CgroupLimiter once
+	// it is created.
+	AllowedSysctls []string
+
 	ReservedExpirationTime time.Duration
 	ReapInterval           time.Duration
+	EgressResolveInterval  time.Duration
 	MaxLogLinesPerSecond   int
 	MetricReportInterval   time.Duration
+
+	// PropertySyncInterval is how often the mirrored executor fields of the
+	// containers are compared with their garden properties, and the
+	// properties that drifted are set again.
+	PropertySyncInterval time.Duration
+
+	// MaxResultArtifactBytes caps the total size of the result artifacts
+	// captured from a container. DefaultMaxResultArtifactBytes is used when
+	// it is not set.
+	MaxResultArtifactBytes int
+
+	// CrashLoopThreshold is the number of failures of containers with the
+	// same process guid and index within CrashLoopWindow after which the
+	// next container is delayed by an exponential backoff of at most
+	// CrashLoopMaxBackoff. Crash-loop detection is disabled when it is 0.
+	CrashLoopThreshold  int
+	CrashLoopWindow     time.Duration
+	CrashLoopMaxBackoff time.Duration
+
+	// IPRetentionWindow is how long the internal IP of a destroyed container
+	// is remembered. A container created with the same guid within the
+	// window requests that IP from the network plugin in the
+	// executor.ContainerRequestedIPProperty property. IPs are not retained
+	// when it is 0.
+	IPRetentionWindow time.Duration
+
+	// StartTimeoutWarningThreshold is how much of the start timeout of a
+	// starting container remains when a ContainerStartTimeoutWarningEvent is
+	// emitted. No warnings are emitted when it is 0.
+	StartTimeoutWarningThreshold time.Duration
+
+	// CapacityChanges, if set, is notified whenever containers are
+	// allocated or deallocated, so that capacity metrics can be reported
+	// without polling.
+	CapacityChanges *CapacityNotifier
+
+	// CoreDumpDir is the directory of the cell into which core files matching
+	// CoreDumpGlobs are copied when a container fails. Each core is truncated
+	// to MaxCoreDumpBytes and the oldest cores are evicted to keep the
+	// directory under CoreDumpQuotaBytes, when they are set. Core dumps are
+	// not captured when the directory is empty.
+	CoreDumpDir        string
+	CoreDumpGlobs      []string
+	MaxCoreDumpBytes   int64
+	CoreDumpQuotaBytes int64
+	CompressCoreDumps  bool
+
+	// DefaultIPFamily is the IP family of containers that do not select one.
+	// Garden's own default is used when both are empty.
+	DefaultIPFamily executor.IPFamily
+
+	// ZoneInfoDir is the time zone database of the cell. The zone of
+	// containers that set a timezone is bind mounted from it to
+	// /etc/localtime, in addition to setting TZ.
+	ZoneInfoDir string
+
+	// FakeTimeLibraryPath is the libfaketime of the cell. It is bind mounted
+	// into the containers that offset their clock and preloaded into their
+	// processes. Containers cannot offset their clock when it is empty.
+	FakeTimeLibraryPath string
+
+	// PlacementQuotas caps the resources allocated to the containers of
+	// each placement tag, by the executor.PlacementTagTag of the containers.
+	PlacementQuotas executor.PlacementQuotas
+
+	// ReadOnlyRootfsSupported is set when the garden runtime of the cell
+	// mounts the rootfs of containers with the executor:read-only-rootfs
+	// property read-only. Containers cannot ask for a read-only rootfs
+	// otherwise, and those that do are failed when their rootfs turns out
+	// to be writable.
+	ReadOnlyRootfsSupported bool
+
+	// GracefulShutdownInterval is how long the processes of a container that
+	// was recovered from a checkpoint are given to exit once it is stopped,
+	// before they are killed.
+	GracefulShutdownInterval time.Duration
+
+	// ImageCacheDir is the directory of the cell into which the registry
+	// images of containers are pulled before their garden container is
+	// created from the pulled image, sharing layers across images. Garden
+	// fetches the images itself when it is empty. The least recently used
+	// images are evicted once the cache outgrows ImageCacheMaxSizeInBytes,
+	// unless it is 0. Each request to a registry must complete within
+	// ImagePullTimeout. InsecureImageRegistries are the registries that are
+	// pulled from over plain HTTP.
+	ImageCacheDir            string
+	ImageCacheMaxSizeInBytes uint64
+	ImagePullTimeout         time.Duration
+	InsecureImageRegistries  []string
+
+	// CredHubURL is the CredHub that the image credentials references of
+	// containers are resolved from, with CredHubClient. Resolved credentials
+	// are cached in memory for ImageCredentialsTTL. References are resolved
+	// under ImageCredentialsNamespace/<app guid>. Containers cannot
+	// reference image credentials when it is empty.
+	CredHubURL                string
+	CredHubClient             *http.Client
+	ImageCredentialsNamespace string
+	ImageCredentialsTTL       time.Duration
+
+	// GPUDeviceTypes maps GPU devices of the cell to their type, so that
+	// containers can ask for GPUs of a type. Devices without a type are only
+	// allocated to containers that do not.
+	GPUDeviceTypes map[string]string
+
+	// ExclusiveCPUs are the cores of the cell that containers requesting
+	// exclusive CPUs are pinned to, with the CgroupLimiter. Containers cannot
+	// request exclusive CPUs when it is empty.
+	ExclusiveCPUs []int
+
+	// BandwidthLimiter limits the ingress traffic of containers with
+	// ingress bandwidth limits. Containers cannot limit their ingress
+	// bandwidth when it is nil.
+	BandwidthLimiter BandwidthLimiter
+
+	// CgroupLimiter applies the limits of containers that garden cannot.
+	// It is required for exclusive CPUs, GPUs, sysctls and swap limits.
+	CgroupLimiter CgroupLimiter
 }
 
 type containerStore struct {
@@ -69,7 +218,15 @@ type containerStore struct {
 	credManager         CredManager
 	transformer         transformer.Transformer
 	containers          *nodeMap
+	devices             *deviceAllocator
+	cpusets             *cpusetManager
+	crashLoops          *crashLoopDetector
+	ipRetention         *ipRetention
+	coreDumps           *coreDumpCollector
+	images              *imageManager
+	imageCredentials    *imageCredentialResolver
 	eventEmitter        event.Hub
+	changes             changeNotifier
 	clock               clock.Clock
 	metronClient        loggingclient.IngressClient
 	rootFSSizer         configuration.RootFSSizer
@@ -112,7 +269,9 @@ func New(
 	enableUnproxiedPortMappings bool,
 	advertisePreferenceForInstanceAddress bool,
 	jsonMarshaller func(any) ([]byte, error),
+	gpuDevices []string,
 ) ContainerStore {
+	changes := make(changeNotifier, 1)
 	return &containerStore{
 		containerConfig:               containerConfig,
 		gardenClientFactory:           gardenClientFactory,
@@ -120,8 +279,16 @@ func New(
 		volumeManager:                 volumeManager,
 		credManager:                   credManager,
 		logManager:                    logManager,
-		containers:                    newNodeMap(totalCapacity),
-		eventEmitter:                  eventEmitter,
+		containers:                    newNodeMap(totalCapacity, containerConfig.CapacityChanges, containerConfig.PlacementQuotas),
+		devices:                       newDeviceAllocator(gpuDevices, containerConfig.GPUDeviceTypes),
+		cpusets:                       newCPUSetManager(containerConfig.ExclusiveCPUs),
+		crashLoops:                    newCrashLoopDetector(clock, containerConfig.CrashLoopThreshold, containerConfig.CrashLoopWindow, containerConfig.CrashLoopMaxBackoff),
+		ipRetention:                   newIPRetention(clock, containerConfig.IPRetentionWindow),
+		coreDumps:                     newCoreDumpCollector(&containerConfig),
+		images:                        newImageManager(&containerConfig, clock),
+		imageCredentials:              newImageCredentialResolver(&containerConfig, clock),
+		eventEmitter:                  notifyingHub{Hub: eventEmitter, changes: changes},
+		changes:                       changes,
 		transformer:                   transformer,
 		clock:                         clock,
 		metronClient:                  metronClient,
@@ -148,9 +315,29 @@ func (cs *containerStore) Reserve(logger lager.Logger, traceID string, req *exec
 	logger.Debug("starting")
 	defer logger.Debug("complete")
 
+	if _, _, ok := req.Bandwidth.Ingress(); ok && cs.containerConfig.BandwidthLimiter == nil {
+		logger.Error("ingress-bandwidth-not-supported", executor.ErrIngressBandwidthNotSupported)
+		return executor.Container{}, executor.ErrIngressBandwidthNotSupported
+	}
+
 	container := executor.NewReservedContainerFromAllocationRequest(req, cs.clock.Now().UnixNano())
 
-	err := cs.containers.Add(
+	devices, err := cs.devices.Allocate(req.Guid, req.GPUs, req.GPUType)
+	if err != nil {
+		logger.Error("failed-to-allocate-devices", err, lager.Data{"gpus": req.GPUs, "gpu-type": req.GPUType})
+		return executor.Container{}, err
+	}
+	container.Devices = devices
+
+	cpus, err := cs.cpusets.Allocate(req.Guid, req.ExclusiveCPUs)
+	if err != nil {
+		logger.Error("failed-to-allocate-cpus", err, lager.Data{"exclusive-cpus": req.ExclusiveCPUs})
+		cs.devices.Free(devices)
+		return executor.Container{}, err
+	}
+	container.CPUSet = cpus
+
+	err = cs.containers.Add(
 		newStoreNode(&cs.containerConfig,
 			cs.useDeclarativeHealthCheck,
 			cs.declarativeHealthcheckPath,
@@ -171,10 +358,16 @@ func (cs *containerStore) Reserve(logger lager.Logger, traceID string, req *exec
 			cs.enableUnproxiedPortMappings,
 			cs.advertisePreferenceForInstanceAddress,
 			cs.jsonMarshaller,
+			cs.coreDumps,
+			cs.ipRetention,
+			cs.images,
+			cs.imageCredentials,
 		))
 
 	if err != nil {
 		logger.Error("failed-to-reserve", err)
+		cs.devices.Free(devices)
+		cs.cpusets.Free(cpus)
 		return executor.Container{}, err
 	}
 
@@ -186,6 +379,51 @@ func (cs *containerStore) Initialize(logger lager.Logger, req *executor.RunReque
 	logger = logger.Session("containerstore-initialize", lager.Data{"guid": req.Guid})
 	logger.Debug("starting")
 	defer logger.Debug("complete")
+	defer cs.changes.changed()
+
+	if req.HostProcess && (!hostProcessContainersSupported || !cs.containerConfig.AllowHostProcessContainers) {
+		logger.Error("host-process-not-allowed", executor.ErrHostProcessNotAllowed)
+		return executor.ErrHostProcessNotAllowed
+	}
+
+	if req.IPFamily != "" && !req.IPFamily.Valid() {
+		logger.Error("invalid-ip-family", executor.ErrInvalidIPFamily, lager.Data{"ip-family": req.IPFamily})
+		return executor.ErrInvalidIPFamily
+	}
+
+	for name := range req.Sysctls {
+		if !cs.sysctlAllowed(name) || cs.containerConfig.CgroupLimiter == nil {
+			logger.Error("sysctl-not-allowed", executor.ErrSysctlNotAllowed, lager.Data{"sysctl": name})
+			return executor.ErrSysctlNotAllowed
+		}
+	}
+
+	if _, ok := req.Swap.Enforced(); ok && cs.containerConfig.CgroupLimiter == nil {
+		logger.Error("swap-limits-not-supported", executor.ErrSwapLimitsNotSupported)
+		return executor.ErrSwapLimitsNotSupported
+	}
+
+	if req.ReadOnlyRootfs && !cs.containerConfig.ReadOnlyRootfsSupported {
+		logger.Error("read-only-rootfs-not-supported", executor.ErrReadOnlyRootfsNotSupported)
+		return executor.ErrReadOnlyRootfsNotSupported
+	}
+
+	if !req.Clock.Valid() {
+		logger.Error("invalid-timezone", executor.ErrInvalidTimezone, lager.Data{"timezone": req.Clock.Timezone})
+		return executor.ErrInvalidTimezone
+	}
+
+	if req.Clock != nil && req.Clock.OffsetSeconds != 0 && cs.containerConfig.FakeTimeLibraryPath == "" {
+		logger.Error("clock-offset-not-supported", executor.ErrClockOffsetNotSupported)
+		return executor.ErrClockOffsetNotSupported
+	}
+
+	for _, dependency := range req.DependsOn {
+		if !validDependency(req.Guid, dependency) {
+			logger.Error("invalid-dependency", executor.ErrInvalidDependency, lager.Data{"dependency": dependency})
+			return executor.ErrInvalidDependency
+		}
+	}
 
 	node, err := cs.containers.Get(req.Guid)
 	if err != nil {
@@ -193,6 +431,16 @@ func (cs *containerStore) Initialize(logger lager.Logger, req *executor.RunReque
 		return err
 	}
 
+	if !validSidecars(req.Sidecars, node.Info().Resource) {
+		logger.Error("invalid-sidecar", executor.ErrInvalidSidecar)
+		return executor.ErrInvalidSidecar
+	}
+
+	if !req.RestartPolicy.Valid() {
+		logger.Error("invalid-restart-policy", executor.ErrInvalidRestartPolicy)
+		return executor.ErrInvalidRestartPolicy
+	}
+
 	err = node.Initialize(logger, req)
 	if err != nil {
 		return err
@@ -201,10 +449,38 @@ func (cs *containerStore) Initialize(logger lager.Logger, req *executor.RunReque
 	return nil
 }
 
+func (cs *containerStore) Drain(logger lager.Logger, window time.Duration) {
+	cs.credManager.Drain(logger, window)
+}
+
+func (cs *containerStore) sysctlAllowed(name string) bool {
+	for _, allowed := range cs.containerConfig.AllowedSysctls {
+		if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validSidecars reports whether the restart policies of the sidecars are
+// valid, and whether their sub-limits fit in the resources of the container.
+func validSidecars(sidecars []executor.Sidecar, resource executor.Resource) bool {
+	var memoryMB, diskMB int
+	for _, sidecar := range sidecars {
+		if !sidecar.RestartPolicy.Valid() || sidecar.MaxRestarts < 0 || sidecar.MemoryMB < 0 || sidecar.DiskMB < 0 {
+			return false
+		}
+		memoryMB += int(sidecar.MemoryMB)
+		diskMB += int(sidecar.DiskMB)
+	}
+	return (resource.MemoryMB == 0 || memoryMB <= resource.MemoryMB) && (resource.DiskMB == 0 || diskMB <= resource.DiskMB)
+}
+
 func (cs *containerStore) Create(logger lager.Logger, traceID string, guid string) (executor.Container, error) {
 	logger = logger.Session("containerstore-create", lager.Data{"guid": guid})
 	logger.Info("starting")
 	defer logger.Info("complete")
+	defer cs.changes.changed()
 
 	node, err := cs.containers.Get(guid)
 	if err != nil {
@@ -215,12 +491,27 @@ func (cs *containerStore) Create(logger lager.Logger, traceID string, guid strin
 	err = node.Create(logger, traceID)
 	if err != nil {
 		logger.Error("failed-to-create-container", err)
+		if limit, ok := gardenLimitFor(err); ok {
+			cs.exhaustGardenLimit(logger, traceID, node.Info(), limit, err)
+		}
 		return executor.Container{}, err
 	}
 
 	return node.Info(), nil
 }
 
+// exhaustGardenLimit stops advertising the capacity that a garden limit
+// rejected the creation of a container for, until a container is removed
+// from garden.
+func (cs *containerStore) exhaustGardenLimit(logger lager.Logger, traceID string, info executor.Container, limit executor.GardenLimit, err error) {
+	logger.Info("garden-limit-exhausted", lager.Data{"limit": limit})
+	cs.containers.ExhaustGardenLimit(limit)
+	go cs.eventEmitter.Emit(executor.NewContainerGardenLimitExhaustedEvent(info, limit, err.Error(), traceID))
+	if err := cs.metronClient.IncrementCounter(GardenLimitExhaustedCount); err != nil {
+		logger.Error("failed-to-increment-counter", err, lager.Data{"metric-name": GardenLimitExhaustedCount})
+	}
+}
+
 func (cs *containerStore) Run(logger lager.Logger, traceID string, guid string) error {
 	logger = logger.Session("containerstore-run")
 
@@ -234,7 +525,24 @@ func (cs *containerStore) Run(logger lager.Logger, traceID string, guid string)
 		return err
 	}
 
-	err = node.Run(logger, traceID)
+	info := node.Info()
+	var dependencies ifrit.Runner = newDependencyWaiter(logger, cs.clock, cs.containers, info.DependsOn, cs.transformer.StartTimeout(info), node.setStartDeadline)
+
+	if crashes, backoff := cs.crashLoops.Backoff(info); backoff > 0 {
+		logger.Info("crash-looping", lager.Data{"crashes": crashes, "backoff": backoff.String()})
+		go cs.eventEmitter.Emit(executor.NewContainerCrashLoopingEvent(info, crashes, backoff, traceID))
+		err := cs.metronClient.IncrementCounter(ContainerCrashLoopBackoffCount)
+		if err != nil {
+			logger.Error("failed-to-increment-counter", err, lager.Data{"metric-name": ContainerCrashLoopBackoffCount})
+		}
+
+		dependencies = grouper.NewQueueOrdered(os.Interrupt, grouper.Members{
+			{Name: "crash-loop-backoff", Runner: newBackoffWaiter(logger, cs.clock, backoff)},
+			{Name: "dependency-waiter", Runner: dependencies},
+		})
+	}
+
+	err = node.Run(logger, traceID, dependencies)
 	if err != nil {
 		logger.Error("failed-to-run-container", err)
 		return err
@@ -263,6 +571,7 @@ func (cs *containerStore) Stop(logger lager.Logger, traceID string, guid string)
 
 	logger.Info("starting")
 	defer logger.Info("complete")
+	defer cs.changes.changed()
 
 	node, err := cs.containers.Get(guid)
 	if err != nil {
@@ -280,6 +589,7 @@ func (cs *containerStore) Destroy(logger lager.Logger, traceID string, guid stri
 
 	logger.Info("starting")
 	defer logger.Info("complete")
+	defer cs.changes.changed()
 
 	node, err := cs.containers.Get(guid)
 	if err != nil {
@@ -287,13 +597,20 @@ func (cs *containerStore) Destroy(logger lager.Logger, traceID string, guid stri
 		return err
 	}
 
+	info := node.Info()
+
 	err = node.Destroy(logger, traceID)
 	if err != nil {
 		logger.Error("failed-to-destroy-container", err)
 		return err
 	}
 
+	cs.crashLoops.RecordCompletion(info)
+	cs.ipRetention.Release(info)
+
 	cs.containers.Remove(guid)
+	cs.devices.Release(guid)
+	cs.cpusets.Release(guid)
 
 	return nil
 }
@@ -358,23 +675,55 @@ func (cs *containerStore) Metrics(logger lager.Logger) (map[string]executor.Cont
 		gardenMetric := metricEntry.Metrics
 
 		rootFSSize := cs.rootFSSizer.RootFSSizeFromPath(nodeInfo.RootFSPath)
-		diskUsage := gardenMetric.DiskStat.TotalBytesUsed - rootFSSize
-		containerMetrics[guid] = executor.ContainerMetrics{
-			MemoryUsageInBytes:                  gardenMetric.MemoryStat.TotalUsageTowardLimit,
-			DiskUsageInBytes:                    diskUsage,
+		metrics := executor.ContainerMetrics{
+			MemoryUsageInBytes:                  memoryUsageInBytes(gardenMetric.MemoryStat),
+			DiskUsageInBytes:                    diskUsageInBytes(gardenMetric.DiskStat, rootFSSize),
 			MemoryLimitInBytes:                  nodeInfo.MemoryLimit,
 			DiskLimitInBytes:                    nodeInfo.DiskLimit - rootFSSize,
-			TimeSpentInCPU:                      time.Duration(gardenMetric.CPUStat.Usage),
+			TimeSpentInCPU:                      timeSpentInCPU(gardenMetric.CPUStat),
 			ContainerAgeInNanoseconds:           uint64(gardenMetric.Age),
 			AbsoluteCPUEntitlementInNanoseconds: gardenMetric.CPUEntitlement,
+			SwapUsageInBytes:                    swapUsageInBytes(gardenMetric.MemoryStat),
+			SwapLimitInBytes:                    nodeInfo.Swap.Limit(),
+			SetupMetrics:                        nodeInfo.SetupMetrics,
 		}
+		if gardenMetric.NetworkStat != nil {
+			metrics.NetworkUsage = &executor.NetworkUsage{
+				RxBytes: gardenMetric.NetworkStat.RxBytes,
+				TxBytes: gardenMetric.NetworkStat.TxBytes,
+			}
+		}
+		containerMetrics[guid] = metrics
 	}
 
 	return containerMetrics, nil
 }
 
+// diskUsageInBytes excludes the shared rootfs layers from the disk usage of a
+// container. Some garden backends (e.g. on Windows) do not include the rootfs
+// in the total, in which case only the exclusive usage is reported.
+func diskUsageInBytes(stat garden.ContainerDiskStat, rootFSSize uint64) uint64 {
+	if stat.TotalBytesUsed < rootFSSize {
+		return stat.ExclusiveBytesUsed
+	}
+	return stat.TotalBytesUsed - rootFSSize
+}
+
+func (cs *containerStore) SetTotalResources(logger lager.Logger, total executor.ExecutorResources) error {
+	logger = logger.Session("set-total-resources", lager.Data{"total": total})
+	err := cs.containers.SetTotalResources(total)
+	if err != nil {
+		logger.Error("failed-to-set-total-resources", err)
+		return err
+	}
+	logger.Info("succeeded")
+	return nil
+}
+
 func (cs *containerStore) RemainingResources(logger lager.Logger) executor.ExecutorResources {
-	return cs.containers.RemainingResources()
+	remaining := cs.containers.RemainingResources()
+	remaining.GPUTypes = cs.devices.Remaining()
+	return remaining
 }
 
 func (cs *containerStore) GetFiles(logger lager.Logger, guid, sourcePath string) (io.ReadCloser, error) {
@@ -391,6 +740,34 @@ func (cs *containerStore) GetFiles(logger lager.Logger, guid, sourcePath string)
 	return node.GetFiles(logger, sourcePath)
 }
 
+func (cs *containerStore) StreamIn(logger lager.Logger, guid, destinationPath string, tarStream io.Reader) error {
+	logger = logger.Session("containerstore-streamin")
+
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	node, err := cs.containers.Get(guid)
+	if err != nil {
+		return err
+	}
+
+	return node.StreamIn(logger, destinationPath, tarStream)
+}
+
+func (cs *containerStore) RunProcess(logger lager.Logger, guid string, spec executor.ProcessSpec, processIO executor.ProcessIO) (executor.Process, error) {
+	logger = logger.Session("containerstore-run-process", lager.Data{"guid": guid, "path": spec.Path})
+
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	node, err := cs.containers.Get(guid)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.RunProcess(logger, spec, processIO)
+}
+
 func (cs *containerStore) NewRegistryPruner(logger lager.Logger) ifrit.Runner {
 	return newRegistryPruner(logger, &cs.containerConfig, cs.clock, cs.containers)
 }
@@ -398,3 +775,107 @@ func (cs *containerStore) NewRegistryPruner(logger lager.Logger) ifrit.Runner {
 func (cs *containerStore) NewContainerReaper(logger lager.Logger) ifrit.Runner {
 	return newContainerReaper(logger, &cs.containerConfig, cs.clock, cs.containers, cs.gardenClientFactory.NewGardenClient(logger, ""))
 }
+
+func (cs *containerStore) NewCheckpointer(logger lager.Logger, path string, interval time.Duration) ifrit.Runner {
+	return newCheckpointer(logger, cs.clock, cs.containers, cs.credManager, cs.changes, path, interval)
+}
+
+// Recover restores the containers of a checkpoint into the store, and
+// destroys the garden containers of the executor that are not recovered.
+// Running containers whose garden container still exists are re-attached
+// to, and rotate their credentials on the schedule they had, while
+// containers that were still being set up, or whose garden container is
+// gone, are completed as failed.
+func (cs *containerStore) Recover(logger lager.Logger, traceID string, checkpoint Checkpoint) error {
+	logger = logger.Session("containerstore-recover", lager.Data{"containers": len(checkpoint.Containers)})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	gardenClient := cs.gardenClientFactory.NewGardenClient(logger, traceID)
+	gardenContainers, err := gardenClient.Containers(garden.Properties{
+		executor.ContainerOwnerProperty: cs.containerConfig.OwnerName,
+	})
+	if err != nil {
+		logger.Error("failed-to-fetch-containers", err)
+		return err
+	}
+
+	cs.credManager.RestoreRotationDeadlines(checkpoint.CredentialRotations)
+
+	byHandle := make(map[string]garden.Container, len(gardenContainers))
+	for _, gardenContainer := range gardenContainers {
+		byHandle[gardenContainer.Handle()] = gardenContainer
+	}
+
+	for _, container := range checkpoint.Containers {
+		logger := logger.WithData(lager.Data{"guid": container.Guid, "state": container.State})
+
+		err := cs.devices.Claim(container.Guid, container.Devices)
+		if err != nil {
+			logger.Error("failed-to-claim-devices", err)
+			continue
+		}
+
+		err = cs.cpusets.Claim(container.Guid, container.CPUSet)
+		if err != nil {
+			logger.Error("failed-to-claim-cpus", err)
+			cs.devices.Release(container.Guid)
+			continue
+		}
+
+		node := newStoreNode(&cs.containerConfig,
+			cs.useDeclarativeHealthCheck,
+			cs.declarativeHealthcheckPath,
+			container,
+			cs.gardenClientFactory,
+			cs.clock,
+			cs.dependencyManager,
+			cs.volumeManager,
+			cs.credManager,
+			cs.logManager,
+			cs.eventEmitter,
+			cs.transformer,
+			cs.trustedSystemCertificatesPath,
+			cs.metronClient,
+			cs.proxyConfigHandler,
+			cs.rootFSSizer,
+			cs.cellID,
+			cs.enableUnproxiedPortMappings,
+			cs.advertisePreferenceForInstanceAddress,
+			cs.jsonMarshaller,
+			cs.coreDumps,
+			cs.ipRetention,
+			cs.images,
+			cs.imageCredentials,
+		)
+		err = cs.containers.Add(node)
+		if err != nil {
+			logger.Error("failed-to-restore-container", err)
+			cs.devices.Release(container.Guid)
+			cs.cpusets.Release(container.Guid)
+			continue
+		}
+
+		gardenContainer := byHandle[container.Guid]
+		delete(byHandle, container.Guid)
+		node.Recover(logger, traceID, gardenContainer)
+		logger.Info("recovered-container")
+	}
+
+	for handle := range byHandle {
+		err := gardenClient.Destroy(handle)
+		if err != nil {
+			logger.Error("failed-to-destroy-container", err, lager.Data{"handle": handle})
+		}
+	}
+
+	return nil
+}
+
+func (cs *containerStore) NewEgressResolver(logger lager.Logger, lookupIP func(string) ([]net.IP, error)) ifrit.Runner {
+	return newEgressResolver(logger, &cs.containerConfig, cs.clock, cs.containers, lookupIP)
+}
+
+func (cs *containerStore) NewPropertySyncer(logger lager.Logger) ifrit.Runner {
+	return newPropertySyncer(logger, &cs.containerConfig, cs.clock, cs.containers)
+}
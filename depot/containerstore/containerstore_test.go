@@ -1,15 +1,23 @@
 package containerstore_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/bbs/models"
@@ -19,8 +27,10 @@ import (
 	"code.cloudfoundry.org/executor/depot/containerstore"
 	"code.cloudfoundry.org/executor/depot/containerstore/containerstorefakes"
 	eventfakes "code.cloudfoundry.org/executor/depot/event/fakes"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
 	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
 	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/executor/depot/transformer"
 	"code.cloudfoundry.org/executor/depot/transformer/faketransformer"
 	"code.cloudfoundry.org/executor/initializer/configuration/configurationfakes"
 	"code.cloudfoundry.org/garden"
@@ -141,6 +151,11 @@ var _ = Describe("Container Store", func() {
 			MaxCPUShares:           maxCPUShares,
 			ReapInterval:           20 * time.Millisecond,
 			ReservedExpirationTime: 20 * time.Millisecond,
+			EgressResolveInterval:  time.Second,
+			PropertySyncInterval:   time.Second,
+			ZoneInfoDir:            "/usr/share/zoneinfo",
+			FakeTimeLibraryPath:    "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1",
+			AllowedSysctls:         []string{"net.core.somaxconn"},
 		}
 
 		containerStore = containerstore.New(
@@ -164,6 +179,7 @@ var _ = Describe("Container Store", func() {
 			true,
 			advertisePreferenceForInstanceAddress,
 			json.Marshal,
+			nil,
 		)
 
 		metronClient.SendDurationStub = func(name string, value time.Duration, opts ...loggregator.EmitGaugeOption) error {
@@ -238,6 +254,129 @@ var _ = Describe("Container Store", func() {
 			Expect(remainingCapacity.Containers).To(Equal(totalCapacity.Containers - 1))
 		})
 
+		Context("when the placement tag of the container has a quota", func() {
+			BeforeEach(func() {
+				containerConfig.PlacementQuotas = executor.PlacementQuotas{
+					"isolated": {MemoryMB: 2048, Containers: 2},
+				}
+				containerStore = containerstore.New(
+					containerConfig,
+					&totalCapacity,
+					gardenClientFactory,
+					dependencyManager,
+					volumeManager,
+					credManager,
+					logManager,
+					clock,
+					eventEmitter,
+					megatron,
+					"/var/vcap/data/cf-system-trusted-certs",
+					metronClient,
+					rootFSSizer,
+					false,
+					"/var/vcap/packages/healthcheck",
+					proxyManager,
+					cellID,
+					true,
+					advertisePreferenceForInstanceAddress,
+					json.Marshal,
+					nil,
+				)
+			})
+
+			reserve := func(guid string, memoryMB int, placementTag string) error {
+				_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{
+					Guid:     guid,
+					Tags:     executor.Tags{executor.PlacementTagTag: placementTag},
+					Resource: executor.Resource{MemoryMB: memoryMB, DiskMB: 10},
+				})
+				return err
+			}
+
+			It("rejects containers that exceed the memory quota", func() {
+				Expect(reserve("guid-1", 1024, "isolated")).To(Succeed())
+				Expect(reserve("guid-2", 1025, "isolated")).To(Equal(executor.ErrPlacementTagMemoryExceeded))
+				Expect(containerStore.RemainingResources(logger).Containers).To(Equal(totalCapacity.Containers - 1))
+			})
+
+			It("rejects containers that exceed the container quota", func() {
+				Expect(reserve("guid-1", 10, "isolated")).To(Succeed())
+				Expect(reserve("guid-2", 10, "isolated")).To(Succeed())
+				Expect(reserve("guid-3", 10, "isolated")).To(Equal(executor.ErrPlacementTagContainersExceeded))
+			})
+
+			It("frees the quota when containers are destroyed", func() {
+				Expect(reserve("guid-1", 2048, "isolated")).To(Succeed())
+				Expect(containerStore.Destroy(logger, "some-trace-id", "guid-1")).To(Succeed())
+				Expect(reserve("guid-2", 2048, "isolated")).To(Succeed())
+			})
+
+			It("does not cap other placement tags", func() {
+				Expect(reserve("guid-1", 2048, "isolated")).To(Succeed())
+				Expect(reserve("guid-2", 4096, "shared")).To(Succeed())
+				Expect(reserve("guid-3", 4096, "")).To(Succeed())
+			})
+		})
+
+		Context("when capacity changes are subscribed to", func() {
+			var (
+				capacityChanges *containerstore.CapacityNotifier
+				changes         <-chan struct{}
+			)
+
+			BeforeEach(func() {
+				capacityChanges = containerstore.NewCapacityNotifier()
+				changes = capacityChanges.Subscribe()
+				containerConfig.CapacityChanges = capacityChanges
+				containerStore = containerstore.New(
+					containerConfig,
+					&totalCapacity,
+					gardenClientFactory,
+					dependencyManager,
+					volumeManager,
+					credManager,
+					logManager,
+					clock,
+					eventEmitter,
+					megatron,
+					"/var/vcap/data/cf-system-trusted-certs",
+					metronClient,
+					rootFSSizer,
+					false,
+					"/var/vcap/packages/healthcheck",
+					proxyManager,
+					cellID,
+					true,
+					advertisePreferenceForInstanceAddress,
+					json.Marshal,
+					nil,
+				)
+			})
+
+			It("notifies the subscribers when containers are reserved and destroyed", func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(changes).To(Receive())
+
+				Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+				Expect(changes).To(Receive())
+			})
+
+			It("does not notify the subscribers when the reservation fails", func() {
+				req.Resource.MemoryMB = totalCapacity.MemoryMB + 1
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).To(HaveOccurred())
+				Expect(changes).NotTo(Receive())
+			})
+
+			It("does not notify subscribers that unsubscribed", func() {
+				capacityChanges.Unsubscribe(changes)
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(changes).NotTo(Receive())
+			})
+		})
+
 		Context("when the container guid is already reserved", func() {
 			BeforeEach(func() {
 				_, err := containerStore.Reserve(logger, "some-trace-id", req)
@@ -260,6 +399,264 @@ var _ = Describe("Container Store", func() {
 				Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
 			})
 		})
+
+		Context("when the container limits its ingress bandwidth without a bandwidth limiter", func() {
+			BeforeEach(func() {
+				req.Resource.Bandwidth = &executor.BandwidthLimits{IngressRateInBytesPerSecond: 1000}
+			})
+
+			It("returns an error", func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).To(Equal(executor.ErrIngressBandwidthNotSupported))
+			})
+		})
+
+		Context("when the container requests exclusive CPUs", func() {
+			BeforeEach(func() {
+				containerConfig.ExclusiveCPUs = []int{2, 3, 4}
+				totalCapacity.ExclusiveCPUs = 3
+				containerStore = containerstore.New(
+					containerConfig,
+					&totalCapacity,
+					gardenClientFactory,
+					dependencyManager,
+					volumeManager,
+					credManager,
+					logManager,
+					clock,
+					eventEmitter,
+					megatron,
+					"/var/vcap/data/cf-system-trusted-certs",
+					metronClient,
+					rootFSSizer,
+					false,
+					"/var/vcap/packages/healthcheck",
+					proxyManager,
+					cellID,
+					true,
+					advertisePreferenceForInstanceAddress,
+					json.Marshal,
+					nil,
+				)
+				req.Resource.ExclusiveCPUs = 2
+			})
+
+			It("pins the container to dedicated cores", func() {
+				container, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.CPUSet).To(Equal([]int{2, 3}))
+				Expect(containerStore.RemainingResources(logger).ExclusiveCPUs).To(Equal(1))
+			})
+
+			It("does not pin other containers to the same cores", func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+
+				otherReq := *req
+				otherReq.Guid = "other-guid"
+				_, err = containerStore.Reserve(logger, "some-trace-id", &otherReq)
+				Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
+
+				otherReq.Resource.ExclusiveCPUs = 1
+				other, err := containerStore.Reserve(logger, "some-trace-id", &otherReq)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(other.CPUSet).To(Equal([]int{4}))
+			})
+
+			It("releases the cores when the container is destroyed", func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+
+				otherReq := *req
+				otherReq.Guid = "other-guid"
+				otherReq.Resource.ExclusiveCPUs = 3
+				other, err := containerStore.Reserve(logger, "some-trace-id", &otherReq)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(other.CPUSet).To(Equal([]int{2, 3, 4}))
+			})
+		})
+
+		Context("when the container requests GPUs", func() {
+			BeforeEach(func() {
+				totalCapacity.GPUs = 2
+				containerStore = containerstore.New(
+					containerConfig,
+					&totalCapacity,
+					gardenClientFactory,
+					dependencyManager,
+					volumeManager,
+					credManager,
+					logManager,
+					clock,
+					eventEmitter,
+					megatron,
+					"/var/vcap/data/cf-system-trusted-certs",
+					metronClient,
+					rootFSSizer,
+					false,
+					"/var/vcap/packages/healthcheck",
+					proxyManager,
+					cellID,
+					true,
+					advertisePreferenceForInstanceAddress,
+					json.Marshal,
+					[]string{"/dev/nvidia0", "/dev/nvidia1"},
+				)
+				req.Resource.GPUs = 1
+			})
+
+			It("allocates devices to the container", func() {
+				container, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.Devices).To(Equal([]string{"/dev/nvidia0"}))
+				Expect(containerStore.RemainingResources(logger).GPUs).To(Equal(1))
+
+				otherReq := *req
+				otherReq.Guid = "other-guid"
+				other, err := containerStore.Reserve(logger, "some-trace-id", &otherReq)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(other.Devices).To(Equal([]string{"/dev/nvidia1"}))
+			})
+
+			It("releases the devices when the container is destroyed", func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+
+				otherReq := *req
+				otherReq.Guid = "other-guid"
+				otherReq.Resource.GPUs = 2
+				other, err := containerStore.Reserve(logger, "some-trace-id", &otherReq)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(other.Devices).To(ConsistOf("/dev/nvidia0", "/dev/nvidia1"))
+			})
+
+			Context("when there are not enough GPUs available", func() {
+				BeforeEach(func() {
+					req.Resource.GPUs = 3
+				})
+
+				It("returns an error", func() {
+					_, err := containerStore.Reserve(logger, "some-trace-id", req)
+					Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
+				})
+			})
+
+			Context("when the GPU devices have types", func() {
+				BeforeEach(func() {
+					containerConfig.GPUDeviceTypes = map[string]string{
+						"/dev/nvidia0": "a100",
+						"/dev/nvidia1": "t4",
+					}
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						[]string{"/dev/nvidia0", "/dev/nvidia1"},
+					)
+					req.Resource.GPUType = "t4"
+				})
+
+				It("allocates devices of the requested type", func() {
+					container, err := containerStore.Reserve(logger, "some-trace-id", req)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.Devices).To(Equal([]string{"/dev/nvidia1"}))
+					Expect(containerStore.RemainingResources(logger).GPUTypes).To(Equal(map[string]int{"a100": 1, "t4": 0}))
+				})
+
+				It("fails when no device of the requested type is free", func() {
+					_, err := containerStore.Reserve(logger, "some-trace-id", req)
+					Expect(err).NotTo(HaveOccurred())
+
+					otherReq := *req
+					otherReq.Guid = "other-guid"
+					_, err = containerStore.Reserve(logger, "some-trace-id", &otherReq)
+					Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
+				})
+			})
+		})
+	})
+
+	Describe("SetTotalResources", func() {
+		BeforeEach(func() {
+			req := &executor.AllocationRequest{
+				Guid:     containerGuid,
+				Resource: executor.Resource{MemoryMB: 1024, DiskMB: 1024},
+			}
+			_, err := containerStore.Reserve(logger, "some-trace-id", req)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("adjusts the remaining capacity while preserving allocations", func() {
+			err := containerStore.SetTotalResources(logger, executor.NewExecutorResources(4096, 2048, 4))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(containerStore.RemainingResources(logger)).To(Equal(executor.NewExecutorResources(3072, 1024, 3)))
+		})
+
+		Context("when the cell has GPUs", func() {
+			BeforeEach(func() {
+				totalCapacity.GPUs = 2
+				containerStore = containerstore.New(
+					containerConfig,
+					&totalCapacity,
+					gardenClientFactory,
+					dependencyManager,
+					volumeManager,
+					credManager,
+					logManager,
+					clock,
+					eventEmitter,
+					megatron,
+					"/var/vcap/data/cf-system-trusted-certs",
+					metronClient,
+					rootFSSizer,
+					false,
+					"/var/vcap/packages/healthcheck",
+					proxyManager,
+					cellID,
+					true,
+					advertisePreferenceForInstanceAddress,
+					json.Marshal,
+					nil,
+				)
+			})
+
+			It("keeps the GPUs of the cell, which the total does not set", func() {
+				err := containerStore.SetTotalResources(logger, executor.NewExecutorResources(4096, 2048, 4))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(containerStore.RemainingResources(logger).GPUs).To(Equal(2))
+			})
+		})
+
+		Context("when the new capacity cannot fit the allocated containers", func() {
+			It("returns an error and keeps the current capacity", func() {
+				err := containerStore.SetTotalResources(logger, executor.NewExecutorResources(512, 2048, 4))
+				Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
+
+				remainingCapacity := containerStore.RemainingResources(logger)
+				Expect(remainingCapacity.MemoryMB).To(Equal(totalCapacity.MemoryMB - 1024))
+			})
+		})
 	})
 
 	Describe("Initialize", func() {
@@ -315,6 +712,150 @@ var _ = Describe("Container Store", func() {
 				Expect(container.RunInfo).To(Equal(runInfo))
 				Expect(container.Tags).To(Equal(runTags))
 			})
+
+			Context("when the run request is for a host process container", func() {
+				BeforeEach(func() {
+					req.HostProcess = true
+				})
+
+				It("rejects the request unless host process containers are allowed", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrHostProcessNotAllowed))
+
+					container, err := containerStore.Get(logger, req.Guid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.State).To(Equal(executor.StateReserved))
+				})
+			})
+
+			Context("when the run request has an invalid dependency", func() {
+				It("rejects dependencies on itself", func() {
+					req.DependsOn = []executor.ContainerDependency{{Guid: req.Guid, State: executor.StateRunning}}
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrInvalidDependency))
+				})
+
+				It("rejects states that cannot be waited for", func() {
+					req.DependsOn = []executor.ContainerDependency{{Guid: "other-guid", State: executor.StateReserved}}
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrInvalidDependency))
+				})
+			})
+
+			Context("when the run request has an invalid sidecar", func() {
+				It("rejects unknown restart policies", func() {
+					req.Sidecars = []executor.Sidecar{{RestartPolicy: "sometimes"}}
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrInvalidSidecar))
+				})
+
+				It("rejects negative restart limits", func() {
+					req.Sidecars = []executor.Sidecar{{RestartPolicy: executor.SidecarRestartAlways, MaxRestarts: -1}}
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrInvalidSidecar))
+				})
+			})
+
+			Context("when the run request has an unknown ip family", func() {
+				BeforeEach(func() {
+					req.IPFamily = "ipv5"
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrInvalidIPFamily))
+				})
+			})
+
+			Context("when the run request sets a sysctl that is not allowed", func() {
+				BeforeEach(func() {
+					req.Sysctls = map[string]string{"net.core.somaxconn": "4096", "kernel.shmmax": "1"}
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrSysctlNotAllowed))
+				})
+			})
+
+			Context("when the run request sets an allowed sysctl and the cell cannot set sysctls", func() {
+				BeforeEach(func() {
+					req.Sysctls = map[string]string{"net.core.somaxconn": "4096"}
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrSysctlNotAllowed))
+				})
+			})
+
+			Context("when the run request limits swap and the cell cannot", func() {
+				BeforeEach(func() {
+					req.Swap = &executor.SwapLimits{Disabled: true}
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrSwapLimitsNotSupported))
+				})
+			})
+
+			Context("when the run request asks for a read-only rootfs and the cell does not support it", func() {
+				BeforeEach(func() {
+					req.ReadOnlyRootfs = true
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrReadOnlyRootfsNotSupported))
+				})
+			})
+
+			Context("when the run request has an invalid timezone", func() {
+				BeforeEach(func() {
+					req.Clock = &executor.ContainerClock{Timezone: "../../etc/passwd"}
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrInvalidTimezone))
+				})
+			})
+
+			Context("when the run request offsets the clock on a cell without libfaketime", func() {
+				BeforeEach(func() {
+					containerConfig.FakeTimeLibraryPath = ""
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+					req.Clock = &executor.ContainerClock{OffsetSeconds: 60}
+				})
+
+				It("rejects the request", func() {
+					err := containerStore.Initialize(logger, req)
+					Expect(err).To(Equal(executor.ErrClockOffsetNotSupported))
+				})
+			})
 		})
 
 		Context("when the container exists but is not reserved", func() {
@@ -488,6 +1029,7 @@ var _ = Describe("Container Store", func() {
 						true,
 						advertisePreferenceForInstanceAddress,
 						json.Marshal,
+						nil,
 					)
 				})
 
@@ -558,6 +1100,20 @@ var _ = Describe("Container Store", func() {
 				Expect(mounts).To(Equal(runReq.CachedDependencies))
 			})
 
+			It("records the cache statistics of the downloads", func() {
+				dependencyManager.DownloadCachedDependenciesReturns(containerstore.BindMounts{
+					CacheHits:       2,
+					CacheMisses:     1,
+					DownloadedBytes: 4096,
+				}, nil)
+
+				container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.SetupMetrics.CacheHits).To(BeEquivalentTo(2))
+				Expect(container.SetupMetrics.CacheMisses).To(BeEquivalentTo(1))
+				Expect(container.SetupMetrics.DownloadedBytes).To(BeEquivalentTo(4096))
+			})
+
 			It("creates the container in garden with the correct bind mounts", func() {
 				expectedMount := garden.BindMount{
 					SrcPath: "foo",
@@ -592,103 +1148,97 @@ var _ = Describe("Container Store", func() {
 				}))
 			})
 
-			Context("if the network is not set", func() {
-				BeforeEach(func() {
-					runReq.RunInfo.Network = nil
-				})
-				It("sets the owner property", func() {
-					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-
-					containerSpec := gardenClient.CreateArgsForCall(0)
-
-					Expect(containerSpec.Properties).To(Equal(garden.Properties{
-						executor.ContainerOwnerProperty: ownerName,
-						"log_config":                    "{\"guid\":\"log-guid-foo\",\"index\":1,\"source_name\":\"test-source\",\"tags\":null}",
-					}))
-				})
-			})
+			Context("when the container has bandwidth limits", func() {
+				var bandwidthLimiter *containerstorefakes.FakeBandwidthLimiter
 
-			Context("if the RootFSPath is not a known preloaded rootfs", func() {
 				BeforeEach(func() {
-					runReq.RunInfo.RootFSPath = "docker://some/repo"
-					rootFSSizer.RootFSSizeFromPathReturns(0)
+					bandwidthLimiter = new(containerstorefakes.FakeBandwidthLimiter)
+					containerConfig.BandwidthLimiter = bandwidthLimiter
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+					allocationReq.Resource.Bandwidth = &executor.BandwidthLimits{
+						EgressRateInBytesPerSecond:       1000,
+						EgressBurstRateInBytesPerSecond:  4000,
+						IngressRateInBytesPerSecond:      2000,
+						IngressBurstRateInBytesPerSecond: 500,
+					}
 				})
 
-				It("sets the correct disk limit", func() {
+				It("limits the egress bandwidth in garden", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
 
-					Expect(gardenClient.CreateCallCount()).To(Equal(1))
 					containerSpec := gardenClient.CreateArgsForCall(0)
-
-					Expect(containerSpec.Limits.Disk.Scope).To(Equal(garden.DiskLimitScopeTotal))
-					Expect(containerSpec.Limits.Disk.ByteHard).To(BeEquivalentTo(resource.DiskMB * 1024 * 1024))
+					Expect(containerSpec.Limits.Bandwidth).To(Equal(garden.BandwidthLimits{
+						RateInBytesPerSecond:      1000,
+						BurstRateInBytesPerSecond: 4000,
+					}))
 				})
-			})
-
-			It("creates the container with the correct environment", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-
-				Expect(gardenClient.CreateCallCount()).To(Equal(1))
-				containerSpec := gardenClient.CreateArgsForCall(0)
 
-				expectedEnv := []string{}
-				for _, envVar := range runReq.Env {
-					expectedEnv = append(expectedEnv, envVar.Name+"="+envVar.Value)
-				}
-				Expect(containerSpec.Env).To(Equal(expectedEnv))
-			})
+				It("limits the ingress bandwidth with the bandwidth limiter", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-			It("sets the correct external and internal ip", func() {
-				container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(container.ExternalIP).To(Equal(externalIP))
-				Expect(container.InternalIP).To(Equal(internalIP))
-			})
+					Expect(bandwidthLimiter.LimitCallCount()).To(Equal(1))
+					_, guid, ip, rate, burst := bandwidthLimiter.LimitArgsForCall(0)
+					Expect(guid).To(Equal(containerGuid))
+					Expect(ip).To(Equal(internalIP))
+					Expect(rate).To(BeEquivalentTo(2000))
+					Expect(burst).To(BeEquivalentTo(2000))
+				})
 
-			It("emits metrics after creating the container", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerCreationSucceededDuration))
-			})
+				It("clears the ingress bandwidth limits when the container is destroyed", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-			It("sends a log after creating the container", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Eventually(metronClient.SendAppLogCallCount()).Should(Equal(2))
-				Eventually(func() string {
-					msg, _, _ := metronClient.SendAppLogArgsForCall(1)
-					return msg
-				}).Should(ContainSubstring(fmt.Sprintf("Cell %s successfully created container for instance %s", cellID, containerGuid)))
-			})
+					Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+					Expect(bandwidthLimiter.ClearCallCount()).To(Equal(1))
+					_, guid := bandwidthLimiter.ClearArgsForCall(0)
+					Expect(guid).To(Equal(containerGuid))
+				})
 
-			It("generates container credential directory", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
+				Context("when the ingress bandwidth cannot be limited", func() {
+					BeforeEach(func() {
+						bandwidthLimiter.LimitReturns(errors.New("tc failed"))
+					})
 
-				Expect(credManager.CreateCredDirCallCount()).To(Equal(1))
-				_, container := credManager.CreateCredDirArgsForCall(0)
-				Expect(container.Guid).To(Equal(containerGuid))
+					It("destroys the container and fails", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(MatchError("tc failed"))
+						Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+					})
+				})
 			})
 
-			It("does not bind mount the healthcheck", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-
-				Expect(gardenClient.CreateCallCount()).To(Equal(1))
-				containerSpec := gardenClient.CreateArgsForCall(0)
-				Expect(containerSpec.BindMounts).NotTo(ContainElement(garden.BindMount{
-					SrcPath: "/var/vcap/packages/healthcheck",
-					DstPath: "/etc/cf-assets/healthcheck",
-					Mode:    garden.BindMountModeRO,
-					Origin:  garden.BindMountOriginHost,
-				}))
-			})
+			Context("when the container has exclusive cpus", func() {
+				var cgroupLimiter *containerstorefakes.FakeCgroupLimiter
 
-			Context("when declarative healthchecks are enabled", func() {
 				BeforeEach(func() {
+					cgroupLimiter = new(containerstorefakes.FakeCgroupLimiter)
+					containerConfig.CgroupLimiter = cgroupLimiter
+					containerConfig.ExclusiveCPUs = []int{2, 3, 4}
+					totalCapacity.ExclusiveCPUs = 3
 					containerStore = containerstore.New(
 						containerConfig,
 						&totalCapacity,
@@ -703,481 +1253,696 @@ var _ = Describe("Container Store", func() {
 						"/var/vcap/data/cf-system-trusted-certs",
 						metronClient,
 						rootFSSizer,
-						true,
+						false,
 						"/var/vcap/packages/healthcheck",
 						proxyManager,
 						cellID,
 						true,
 						advertisePreferenceForInstanceAddress,
 						json.Marshal,
+						nil,
 					)
+					allocationReq.Resource.ExclusiveCPUs = 2
 				})
 
-				It("bind mounts the healthcheck", func() {
+				It("pins the container to its cpus through its cgroup", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
 
-					Expect(gardenClient.CreateCallCount()).To(Equal(1))
-					containerSpec := gardenClient.CreateArgsForCall(0)
-					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
-						SrcPath: "/var/vcap/packages/healthcheck",
-						DstPath: "/etc/cf-assets/healthcheck",
-						Mode:    garden.BindMountModeRO,
-						Origin:  garden.BindMountOriginHost,
-					}))
+					Expect(cgroupLimiter.SetCPUSetCallCount()).To(Equal(1))
+					_, guid, cpus := cgroupLimiter.SetCPUSetArgsForCall(0)
+					Expect(guid).To(Equal(containerGuid))
+					Expect(cpus).To(Equal([]int{2, 3}))
+				})
+
+				Context("when the cpus cannot be pinned", func() {
+					BeforeEach(func() {
+						cgroupLimiter.SetCPUSetReturns(errors.New("no such file or directory"))
+					})
+
+					It("destroys the container and fails", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(MatchError("no such file or directory"))
+						Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+					})
 				})
 			})
 
-			Context("when credential mounts are configured", func() {
-				var (
-					expectedBindMount garden.BindMount
-				)
+			Context("when the container has swap limits", func() {
+				var cgroupLimiter *containerstorefakes.FakeCgroupLimiter
 
 				BeforeEach(func() {
-					expectedBindMount = garden.BindMount{SrcPath: "hpath1", DstPath: "cpath1", Mode: garden.BindMountModeRO, Origin: garden.BindMountOriginHost}
-					envVariables := []executor.EnvironmentVariable{
-						{Name: "CF_INSTANCE_CERT", Value: "some-cert"},
-					}
-					credManager.CreateCredDirReturns([]garden.BindMount{expectedBindMount}, envVariables, nil)
+					cgroupLimiter = new(containerstorefakes.FakeCgroupLimiter)
+					containerConfig.CgroupLimiter = cgroupLimiter
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+					runReq.RunInfo.Swap = &executor.SwapLimits{LimitInBytes: 64 * 1024 * 1024}
 				})
 
-				It("mounts the credential directory into the container", func() {
+				It("limits the swap of the container through its cgroup", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(gardenClient.CreateCallCount()).To(Equal(1))
-					Expect(gardenClient.CreateArgsForCall(0).BindMounts).To(ContainElement(expectedBindMount))
-				})
 
-				It("add the instance identity environment variables to the container", func() {
-					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(gardenClient.CreateCallCount()).To(Equal(1))
-					Expect(gardenClient.CreateArgsForCall(0).Env).To(ContainElement("CF_INSTANCE_CERT=some-cert"))
+					Expect(cgroupLimiter.SetSwapLimitCallCount()).To(Equal(1))
+					_, guid, memoryLimit, swapLimit := cgroupLimiter.SetSwapLimitArgsForCall(0)
+					Expect(guid).To(Equal(containerGuid))
+					Expect(memoryLimit).To(BeEquivalentTo(resource.MemoryMB * 1024 * 1024))
+					Expect(swapLimit).To(BeEquivalentTo(64 * 1024 * 1024))
 				})
 
-				Context("when failing to create credential directory on host", func() {
+				Context("and swap is disabled", func() {
 					BeforeEach(func() {
-						credManager.CreateCredDirReturns(nil, nil, errors.New("failed to create dir"))
+						runReq.RunInfo.Swap.Disabled = true
 					})
 
-					It("fails fast and completes the container", func() {
+					It("limits the swap of the container to 0", func() {
 						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-						Expect(err).To(HaveOccurred())
-
-						container, err := containerStore.Get(logger, containerGuid)
 						Expect(err).NotTo(HaveOccurred())
-						Expect(container.State).To(Equal(executor.StateCompleted))
-						Expect(container.RunResult.Failed).To(BeTrue())
-						Expect(container.RunResult.FailureReason).To(Equal(containerstore.CredDirFailed))
-						Expect(container.RunResult.Retryable).To(BeTrue())
+
+						Expect(cgroupLimiter.SetSwapLimitCallCount()).To(Equal(1))
+						_, _, _, swapLimit := cgroupLimiter.SetSwapLimitArgsForCall(0)
+						Expect(swapLimit).To(BeZero())
 					})
 				})
-			})
 
-			Context("when there are volume mounts configured", func() {
-				BeforeEach(func() {
-					someConfig := map[string]interface{}{"some-config": "interface"}
-					runReq.RunInfo.VolumeMounts = []executor.VolumeMount{
-						executor.VolumeMount{ContainerPath: "cpath1", Mode: executor.BindMountModeRW, Driver: "some-driver", VolumeId: "some-volume", Config: someConfig},
-						executor.VolumeMount{ContainerPath: "cpath2", Mode: executor.BindMountModeRO, Driver: "some-other-driver", VolumeId: "some-other-volume", Config: someConfig},
-					}
+				Context("when the swap cannot be limited", func() {
+					BeforeEach(func() {
+						cgroupLimiter.SetSwapLimitReturns(errors.New("permission denied"))
+					})
 
-					count := 0
-					volumeManager.MountStub = // first call mounts at a different point than second call
-						func(lager.Logger, string, string, string, map[string]interface{}) (volman.MountResponse, error) {
-							defer func() { count = count + 1 }()
-							if count == 0 {
-								return volman.MountResponse{Path: "hpath1"}, nil
-							}
-							return volman.MountResponse{Path: "hpath2"}, nil
-						}
+					It("destroys the container and fails", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(MatchError("permission denied"))
+						Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+					})
 				})
+			})
 
-				It("mounts the correct volumes via the volume manager", func() {
+			Context("if the network is not set", func() {
+				BeforeEach(func() {
+					runReq.RunInfo.Network = nil
+				})
+				It("sets the owner property", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(volumeManager.MountCallCount()).To(Equal(2))
 
-					_, driverName, volumeId, containerId, config := volumeManager.MountArgsForCall(0)
-					Expect(driverName).To(Equal(runReq.VolumeMounts[0].Driver))
-					Expect(volumeId).To(Equal(runReq.VolumeMounts[0].VolumeId))
-					Expect(containerId).To(Equal(containerGuid))
-					Expect(config).To(Equal(runReq.VolumeMounts[0].Config))
+					containerSpec := gardenClient.CreateArgsForCall(0)
 
-					_, driverName, volumeId, containerId, config = volumeManager.MountArgsForCall(1)
-					Expect(driverName).To(Equal(runReq.VolumeMounts[1].Driver))
-					Expect(volumeId).To(Equal(runReq.VolumeMounts[1].VolumeId))
-					Expect(containerId).To(Equal(containerGuid))
-					Expect(config).To(Equal(runReq.VolumeMounts[1].Config))
+					Expect(containerSpec.Properties).To(Equal(garden.Properties{
+						executor.ContainerOwnerProperty: ownerName,
+						"log_config":                    "{\"guid\":\"log-guid-foo\",\"index\":1,\"source_name\":\"test-source\",\"tags\":null}",
+					}))
 				})
+			})
 
-				It("correctly maps container and host directories in garden", func() {
+			Context("if the RootFSPath is not a known preloaded rootfs", func() {
+				BeforeEach(func() {
+					runReq.RunInfo.RootFSPath = "docker://some/repo"
+					rootFSSizer.RootFSSizeFromPathReturns(0)
+				})
+
+				It("sets the correct disk limit", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
+
 					Expect(gardenClient.CreateCallCount()).To(Equal(1))
+					containerSpec := gardenClient.CreateArgsForCall(0)
 
-					expectedBindMount1 := garden.BindMount{SrcPath: "hpath1", DstPath: "cpath1", Mode: garden.BindMountModeRW}
-					Expect(gardenClient.CreateArgsForCall(0).BindMounts).To(ContainElement(expectedBindMount1))
-					expectedBindMount2 := garden.BindMount{SrcPath: "hpath2", DstPath: "cpath2", Mode: garden.BindMountModeRO}
-					Expect(gardenClient.CreateArgsForCall(0).BindMounts).To(ContainElement(expectedBindMount2))
+					Expect(containerSpec.Limits.Disk.Scope).To(Equal(garden.DiskLimitScopeTotal))
+					Expect(containerSpec.Limits.Disk.ByteHard).To(BeEquivalentTo(resource.DiskMB * 1024 * 1024))
 				})
 
-				Context("when it errors on mount", func() {
-					Context("when the driver returns a safeError", func() {
-						BeforeEach(func() {
-							volumeManager.MountReturns(volman.MountResponse{Path: "host-path"}, volman.SafeError{SafeDescription: "some-error"})
-						})
-
-						It("fails fast and completes the container", func() {
-							_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-							Expect(err).To(HaveOccurred())
-							Expect(volumeManager.MountCallCount()).To(Equal(1))
-
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							Expect(container.State).To(Equal(executor.StateCompleted))
-							Expect(container.RunResult.Failed).To(BeTrue())
-							Expect(container.RunResult.FailureReason).To(Equal(fmt.Sprintf("%s, errors: some-error", containerstore.VolmanMountFailed)))
-							Expect(container.RunResult.Retryable).To(BeTrue())
-						})
+				It("emits the image fetch duration", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Eventually(getMetrics).Should(HaveKey(containerstore.ImageFetchDuration))
+				})
+			})
 
-					})
+			Context("when images are pulled into the image cache", func() {
+				var (
+					registry      *httptest.Server
+					imageCacheDir string
+					layer         []byte
+					layerDigest   string
+					manifest      []byte
+					blobRequests  int32
+					stalled       chan struct{}
+				)
 
-					Context("when the driver returns a unsafeError", func() {
-						BeforeEach(func() {
-							volumeManager.MountReturns(volman.MountResponse{Path: "host-path"}, errors.New("some-error"))
-						})
+				newContainerStore := func() containerstore.ContainerStore {
+					return containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+				}
 
-						It("fails fast and completes the container", func() {
-							_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-							Expect(err).To(HaveOccurred())
-							Expect(volumeManager.MountCallCount()).To(Equal(1))
+				digest := func(content []byte) string {
+					return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+				}
 
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							Expect(container.State).To(Equal(executor.StateCompleted))
-							Expect(container.RunResult.Failed).To(BeTrue())
-							Expect(container.RunResult.FailureReason).To(Equal(containerstore.VolmanMountFailed))
-							Expect(container.RunResult.Retryable).To(BeTrue())
-						})
+				BeforeEach(func() {
+					imageCacheDir = GinkgoT().TempDir()
+					blobRequests = 0
+					stalled = nil
+
+					config := []byte("{}")
+					layer = []byte("some-layer")
+					layerDigest = digest(layer)
+					var err error
+					manifest, err = json.Marshal(map[string]interface{}{
+						"schemaVersion": 2,
+						"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+						"config":        map[string]interface{}{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": digest(config), "size": len(config)},
+						"layers":        []interface{}{map[string]interface{}{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": layerDigest, "size": len(layer)}},
 					})
+					Expect(err).NotTo(HaveOccurred())
+
+					blobs := map[string][]byte{digest(config): config, layerDigest: layer}
+					registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if r.URL.Path == "/token" {
+							username, password, _ := r.BasicAuth()
+							if username != "some-username" || password != "some-password" || r.URL.Query().Get("scope") != "repository:some/repo:pull" {
+								w.WriteHeader(http.StatusUnauthorized)
+								return
+							}
+							w.Write([]byte(`{"token":"some-token"}`))
+							return
+						}
+
+						if r.Header.Get("Authorization") != "Bearer some-token" {
+							w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, registry.URL))
+							w.WriteHeader(http.StatusUnauthorized)
+							return
+						}
+
+						switch {
+						case path.Dir(r.URL.Path) == "/v2/some/repo/manifests":
+							w.Write(manifest)
+						case path.Dir(r.URL.Path) == "/v2/some/repo/blobs":
+							atomic.AddInt32(&blobRequests, 1)
+							if stalled != nil {
+								<-stalled
+							}
+							blob, ok := blobs[path.Base(r.URL.Path)]
+							if !ok {
+								w.WriteHeader(http.StatusNotFound)
+								return
+							}
+							w.Write(blob)
+						default:
+							w.WriteHeader(http.StatusNotFound)
+						}
+					}))
+
+					registryHost := strings.TrimPrefix(registry.URL, "http://")
+					containerConfig.ImageCacheDir = imageCacheDir
+					containerConfig.InsecureImageRegistries = []string{registryHost}
 
+					runReq.RunInfo.RootFSPath = "docker://" + registryHost + "/some/repo#latest"
+					runReq.RunInfo.ImageUsername = "some-username"
+					runReq.RunInfo.ImagePassword = "some-password"
+
+					containerStore = newContainerStore()
 				})
-			})
 
-			Context("when there are trusted system certificates", func() {
-				Context("and the desired LRP has a certificates path", func() {
-					var mounts []garden.BindMount
+				AfterEach(func() {
+					registry.Close()
+				})
+
+				It("creates the container from the layout of the pulled image", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+
+					layout := filepath.Join(imageCacheDir, "images", strings.TrimPrefix(digest(manifest), "sha256:"))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.Image).To(Equal(garden.ImageRef{URI: "oci://" + layout}))
+
+					Expect(filepath.Join(layout, "index.json")).To(BeAnExistingFile())
+					Expect(os.ReadFile(filepath.Join(layout, "blobs", "sha256", strings.TrimPrefix(layerDigest, "sha256:")))).To(Equal(layer))
+					Expect(logStreamer.Stdout()).To(gbytes.Say("Pulling image"))
+					Expect(logStreamer.Stdout()).To(gbytes.Say("Pulled image " + digest(manifest)))
+				})
 
+				It("does not download the layers of cached images again", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(atomic.LoadInt32(&blobRequests)).To(BeEquivalentTo(2))
+
+					allocationReq.Guid = "other-guid"
+					_, err = containerStore.Reserve(logger, "some-trace-id", allocationReq)
+					Expect(err).NotTo(HaveOccurred())
+					runReq.Guid = "other-guid"
+					Expect(containerStore.Initialize(logger, runReq)).To(Succeed())
+
+					_, err = containerStore.Create(logger, "some-trace-id", "other-guid")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(atomic.LoadInt32(&blobRequests)).To(BeEquivalentTo(2))
+				})
+
+				Context("when the cache outgrows its size", func() {
 					BeforeEach(func() {
-						runReq.RunInfo.TrustedSystemCertificatesPath = "/etc/cf-system-certificates"
-						mounts = []garden.BindMount{
-							{
-								SrcPath: "/var/vcap/data/cf-system-trusted-certs",
-								DstPath: runReq.RunInfo.TrustedSystemCertificatesPath,
-								Mode:    garden.BindMountModeRO,
-								Origin:  garden.BindMountOriginHost,
-							},
-						}
+						containerConfig.ImageCacheMaxSizeInBytes = 1
+						containerStore = newContainerStore()
 					})
 
-					It("creates a bind mount", func() {
+					It("evicts the image once the container is created from it", func() {
 						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 						Expect(err).NotTo(HaveOccurred())
-
 						Expect(gardenClient.CreateCallCount()).To(Equal(1))
-						gardenContainerSpec := gardenClient.CreateArgsForCall(0)
-						Expect(gardenContainerSpec.BindMounts).To(ContainElement(mounts[0]))
+
+						layout := filepath.Join(imageCacheDir, "images", strings.TrimPrefix(digest(manifest), "sha256:"))
+						Expect(layout).NotTo(BeADirectory())
+						Expect(filepath.Join(imageCacheDir, "blobs", "sha256", strings.TrimPrefix(layerDigest, "sha256:"))).NotTo(BeAnExistingFile())
 					})
+				})
 
-					It("creates a CF_SYSTEM_CERT_PATH env var", func() {
-						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-						Expect(err).NotTo(HaveOccurred())
+				Context("when the registry stalls", func() {
+					BeforeEach(func() {
+						stalled = make(chan struct{})
+						containerConfig.ImagePullTimeout = 100 * time.Millisecond
+						containerStore = newContainerStore()
+					})
 
-						containerSpec := gardenClient.CreateArgsForCall(0)
-						Expect(containerSpec.Env).To(ContainElement("CF_SYSTEM_CERT_PATH=" + runReq.RunInfo.TrustedSystemCertificatesPath))
+					AfterEach(func() {
+						close(stalled)
 					})
-				})
 
-				Context("and the desired LRP does not have a certificates path", func() {
-					It("does not create a bind mount", func() {
+					It("fails to create the container", func() {
 						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(HaveOccurred())
+						Expect(gardenClient.CreateCallCount()).To(Equal(0))
+
+						container, err := containerStore.Get(logger, containerGuid)
 						Expect(err).NotTo(HaveOccurred())
+						Expect(container.RunResult.FailureReason).To(HavePrefix(containerstore.ImagePullFailed))
+					})
+				})
 
-						Expect(gardenClient.CreateCallCount()).To(Equal(1))
-						gardenContainerSpec := gardenClient.CreateArgsForCall(0)
-						Expect(gardenContainerSpec.BindMounts).NotTo(ContainElement(garden.BindMount{
-							SrcPath: "/var/vcap/data/cf-system-trusted-certs",
-							DstPath: runReq.RunInfo.TrustedSystemCertificatesPath,
-							Mode:    garden.BindMountModeRO,
-							Origin:  garden.BindMountOriginHost,
-						}))
+				Context("when the image is pinned to another digest", func() {
+					BeforeEach(func() {
+						runReq.RunInfo.RootFSPath = strings.TrimSuffix(runReq.RunInfo.RootFSPath, "#latest") + "@" + digest([]byte("other-manifest"))
 					})
 
-					It("does not create the CF_SYSTEM_CERT_PATH env var", func() {
+					It("fails to create the container", func() {
 						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(HaveOccurred())
+						Expect(gardenClient.CreateCallCount()).To(Equal(0))
+
+						container, err := containerStore.Get(logger, containerGuid)
 						Expect(err).NotTo(HaveOccurred())
-						containerSpec := gardenClient.CreateArgsForCall(0)
-						Expect(containerSpec.Env).NotTo(ContainElement(ContainSubstring("CF_SYSTEM_CERT_PATH")))
+						Expect(container.RunResult.Failed).To(BeTrue())
+						Expect(container.RunResult.FailureReason).To(HavePrefix(containerstore.ImagePullFailed))
 					})
 				})
 			})
 
-			Context("when downloading bind mounts fails", func() {
+			Context("when the image credentials are a CredHub reference", func() {
+				var (
+					credHub         *httptest.Server
+					credHubRequests int32
+					credHubStatus   int
+					credHubNames    chan string
+				)
+
 				BeforeEach(func() {
-					dependencyManager.DownloadCachedDependenciesReturns(containerstore.BindMounts{}, errors.New("no"))
+					credHubRequests = 0
+					credHubStatus = http.StatusOK
+					credHubNames = make(chan string, 10)
+					credHub = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						atomic.AddInt32(&credHubRequests, 1)
+						credHubNames <- r.URL.Query().Get("name")
+						if r.URL.Path != "/api/v1/data" || !strings.HasSuffix(r.URL.Query().Get("name"), "/registry/creds") {
+							w.WriteHeader(http.StatusNotFound)
+							return
+						}
+						w.WriteHeader(credHubStatus)
+						w.Write([]byte(`{"data":[{"type":"user","value":{"username":"credhub-username","password":"credhub-password"}}]}`))
+					}))
+
+					containerConfig.CredHubURL = credHub.URL
+					containerConfig.CredHubClient = credHub.Client()
+					containerConfig.ImageCredentialsNamespace = "/image-credentials"
+					containerConfig.ImageCredentialsTTL = time.Minute
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+
+					runReq.RunInfo.RootFSPath = "docker://some/repo"
+					runReq.RunInfo.ImageCredentialsRef = "((/registry/creds))"
 				})
 
-				It("transitions to a completed state", func() {
+				AfterEach(func() {
+					credHub.Close()
+				})
+
+				createAnother := func(guid string) {
+					allocationReq.Guid = guid
+					_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
+					Expect(err).NotTo(HaveOccurred())
+					runReq.Guid = guid
+					Expect(containerStore.Initialize(logger, runReq)).To(Succeed())
+					_, err = containerStore.Create(logger, "some-trace-id", guid)
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				It("creates the container with the resolved credentials without storing them", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
+					Expect(err).NotTo(HaveOccurred())
+					Expect(credHubNames).To(Receive(Equal("/image-credentials/metric-guid/registry/creds")))
+
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.Image.Username).To(Equal("credhub-username"))
+					Expect(containerSpec.Image.Password).To(Equal("credhub-password"))
 
 					container, err := containerStore.Get(logger, containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(container.State).To(Equal(executor.StateCompleted))
-					Expect(container.RunResult.Failed).To(BeTrue())
-					Expect(container.RunResult.FailureReason).To(Equal(containerstore.DownloadCachedDependenciesFailed))
-					Expect(container.RunResult.Retryable).To(BeTrue())
+					Expect(container.ImageUsername).To(BeEmpty())
+					Expect(container.ImagePassword).To(BeEmpty())
 				})
-			})
 
-			Context("when egress rules are requested", func() {
-				BeforeEach(func() {
-					egressRules := []*models.SecurityGroupRule{
-						{
-							Protocol:     "icmp",
-							Destinations: []string{"1.1.1.1"},
-							IcmpInfo: &models.ICMPInfo{
-								Type: 2,
-								Code: 10,
-							},
-						},
-						{
-							Protocol:     "icmp",
-							Destinations: []string{"1.1.1.2"},
-							IcmpInfo: &models.ICMPInfo{
-								Type: 3,
-								Code: 10,
-							},
-						},
-					}
-					runReq.EgressRules = egressRules
+				It("caches the resolved credentials until they expire", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					createAnother("other-guid")
+					Expect(atomic.LoadInt32(&credHubRequests)).To(BeEquivalentTo(1))
+
+					clock.Increment(time.Minute)
+					createAnother("third-guid")
+					Expect(atomic.LoadInt32(&credHubRequests)).To(BeEquivalentTo(2))
 				})
 
-				It("calls NetOut for each egress rule", func() {
+				It("does not share the resolved credentials between apps", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
+					Expect(credHubNames).To(Receive(Equal("/image-credentials/metric-guid/registry/creds")))
 
-					Expect(gardenClient.CreateCallCount()).To(Equal(1))
-					containerSpec := gardenClient.CreateArgsForCall(0)
-					Expect(containerSpec.NetOut).To(HaveLen(2))
-					icmpCode := garden.ICMPCode(10)
-					Expect(containerSpec.NetOut).To(ContainElement(garden.NetOutRule{
-						Protocol: garden.Protocol(3),
-						Networks: []garden.IPRange{
-							{
-								Start: net.ParseIP("1.1.1.1"),
-								End:   net.ParseIP("1.1.1.1"),
-							},
-						},
-						ICMPs: &garden.ICMPControl{
-							Type: 2,
-							Code: &icmpCode,
-						},
-					}))
-					Expect(containerSpec.NetOut).To(ContainElement(garden.NetOutRule{
-						Protocol: garden.Protocol(3),
-						Networks: []garden.IPRange{
-							{
-								Start: net.ParseIP("1.1.1.2"),
-								End:   net.ParseIP("1.1.1.2"),
-							},
-						},
-						ICMPs: &garden.ICMPControl{
-							Type: 3,
-							Code: &icmpCode,
-						},
-					}))
+					runReq.MetricsConfig.Guid = "other-app-guid"
+					createAnother("other-guid")
+					Expect(atomic.LoadInt32(&credHubRequests)).To(BeEquivalentTo(2))
+					Expect(credHubNames).To(Receive(Equal("/image-credentials/other-app-guid/registry/creds")))
 				})
 
-				Context("when a egress rule is not valid", func() {
+				Context("when the reference leaves the namespace of the app", func() {
 					BeforeEach(func() {
-						egressRule := &models.SecurityGroupRule{
-							Protocol: "tcp",
-						}
-						runReq.EgressRules = append(runReq.EgressRules, egressRule)
+						runReq.RunInfo.ImageCredentialsRef = "((../other-app-guid/registry/creds))"
 					})
 
-					It("returns an error", func() {
+					It("fails to create the container without asking CredHub", func() {
 						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-						Expect(err).To(HaveOccurred())
+						Expect(err).To(MatchError(containerstore.ErrInvalidCredentialName))
+						Expect(atomic.LoadInt32(&credHubRequests)).To(BeZero())
+						Expect(gardenClient.CreateCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("when the container has no app guid", func() {
+					BeforeEach(func() {
+						runReq.MetricsConfig.Guid = ""
+					})
+
+					It("fails to create the container", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(MatchError(containerstore.ErrNoAppIdentity))
+						Expect(atomic.LoadInt32(&credHubRequests)).To(BeZero())
+					})
+				})
+
+				Context("when the credentials cannot be resolved", func() {
+					BeforeEach(func() {
+						credHubStatus = http.StatusForbidden
+					})
 
+					It("fails to create the container", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(HaveOccurred())
 						Expect(gardenClient.CreateCallCount()).To(Equal(0))
+
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.RunResult.FailureReason).To(HavePrefix(containerstore.ImageCredentialsFailed))
 					})
 				})
 			})
 
-			Context("when containerProxy is disabled", func() {
-				BeforeEach(func() {
-					portMapping := []executor.PortMapping{
-						{ContainerPort: 8080},
-						{ContainerPort: 9090},
-					}
-					runReq.Ports = portMapping
+			It("creates the container with the correct environment", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
 
-					gardenClient.CreateStub = func(spec garden.ContainerSpec) (garden.Container, error) {
-						gardenContainer.InfoStub = func() (garden.ContainerInfo, error) {
-							info := garden.ContainerInfo{}
-							info.MappedPorts = []garden.PortMapping{}
-							for _, netIn := range spec.NetIn {
-								switch netIn.ContainerPort {
-								case 8080:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16000, ContainerPort: 8080})
-								case 9090:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 32000, ContainerPort: 9090})
-								default:
-									return info, errors.New("failed-net-in")
-								}
-							}
-							return info, nil
-						}
-						return gardenContainer, nil
-					}
+				Expect(gardenClient.CreateCallCount()).To(Equal(1))
+				containerSpec := gardenClient.CreateArgsForCall(0)
+
+				expectedEnv := []string{}
+				for _, envVar := range runReq.Env {
+					expectedEnv = append(expectedEnv, envVar.Name+"="+envVar.Value)
+				}
+				Expect(containerSpec.Env).To(Equal(expectedEnv))
+			})
+
+			It("sets the correct external and internal ip", func() {
+				container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.ExternalIP).To(Equal(externalIP))
+				Expect(container.InternalIP).To(Equal(internalIP))
+			})
+
+			Context("when the container sets sysctls", func() {
+				var cgroupLimiter *containerstorefakes.FakeCgroupLimiter
+
+				BeforeEach(func() {
+					cgroupLimiter = new(containerstorefakes.FakeCgroupLimiter)
+					containerConfig.CgroupLimiter = cgroupLimiter
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+					runReq.RunInfo.Sysctls = map[string]string{"net.core.somaxconn": "4096"}
 				})
 
-				It("passes all port mappings to NetIn on container creation", func() {
+				It("sets them in the namespaces of the container", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
 
-					containerSpec := gardenClient.CreateArgsForCall(0)
-					Expect(containerSpec.NetIn).To(HaveLen(2))
-					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: 8080,
-					}))
-					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: 9090,
-					}))
+					Expect(cgroupLimiter.SetSysctlsCallCount()).To(Equal(1))
+					_, guid, sysctls := cgroupLimiter.SetSysctlsArgsForCall(0)
+					Expect(guid).To(Equal(containerGuid))
+					Expect(sysctls).To(Equal(map[string]string{"net.core.somaxconn": "4096"}))
 				})
 
-				Context("when the app has duplicate port exposed", func() {
+				Context("when the sysctls cannot be set", func() {
 					BeforeEach(func() {
-						runReq.Ports = append(runReq.Ports, executor.PortMapping{ContainerPort: 8080})
+						cgroupLimiter.SetSysctlsReturns(errors.New("permission denied"))
 					})
 
-					It("de duplicate the exposed ports", func() {
-						container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-
-						Expect(container.Ports).To(ConsistOf(executor.PortMapping{
-							ContainerPort: 8080,
-							HostPort:      16000,
-						}, executor.PortMapping{
-							ContainerPort: 9090,
-							HostPort:      32000,
-						}))
-
-						fetchedContainer, err := containerStore.Get(logger, containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-						Expect(fetchedContainer).To(Equal(container))
+					It("destroys the container and fails", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(MatchError("permission denied"))
+						Expect(gardenClient.DestroyCallCount()).To(Equal(1))
 					})
 				})
+			})
 
-				It("saves the actual port mappings on the container", func() {
+			Context("when the container is dual-stack", func() {
+				BeforeEach(func() {
+					runReq.RunInfo.IPFamily = executor.IPFamilyDualStack
+					gardenContainer.InfoReturns(garden.ContainerInfo{
+						ExternalIP:  externalIP,
+						ContainerIP: internalIP,
+						Properties:  garden.Properties{executor.ContainerIPv6Property: "fd00::7"},
+					}, nil)
+				})
+
+				It("requests the ip family and records both internal addresses", func() {
 					container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
+					Expect(container.InternalIP).To(Equal(internalIP))
+					Expect(container.InternalIPv6).To(Equal("fd00::7"))
 
-					Expect(container.Ports).To(ConsistOf(executor.PortMapping{
-						ContainerPort: 8080,
-						HostPort:      16000,
-					}, executor.PortMapping{
-						ContainerPort: 9090,
-						HostPort:      32000,
-					}))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.Properties).To(HaveKeyWithValue(executor.ContainerIPFamilyProperty, "dual-stack"))
+				})
+			})
 
-					fetchedContainer, err := containerStore.Get(logger, containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(fetchedContainer).To(Equal(container))
+			Context("when the container only has an IPv6 address", func() {
+				BeforeEach(func() {
+					gardenContainer.InfoReturns(garden.ContainerInfo{ExternalIP: externalIP, ContainerIP: "fd00::7"}, nil)
 				})
 
-				It("preserves port orders", func() {
-					Consistently(func() uint16 {
-						containerGUID := "new-container-guid"
-						allocationReq = &executor.AllocationRequest{
-							Guid: containerGUID,
-							Tags: executor.Tags{
-								"Foo": "Bar",
-							},
-						}
+				It("records it as both internal addresses", func() {
+					container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.InternalIP).To(Equal("fd00::7"))
+					Expect(container.InternalIPv6).To(Equal("fd00::7"))
+				})
+			})
 
-						_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
-						Expect(err).NotTo(HaveOccurred())
+			It("emits metrics after creating the container", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerCreationSucceededDuration))
+			})
 
-						defer containerStore.Destroy(logger, "some-trace-id", containerGUID)
+			It("sends a log after creating the container", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(metronClient.SendAppLogCallCount()).Should(Equal(2))
+				Eventually(func() string {
+					msg, _, _ := metronClient.SendAppLogArgsForCall(1)
+					return msg
+				}).Should(ContainSubstring(fmt.Sprintf("Cell %s successfully created container for instance %s", cellID, containerGuid)))
+			})
 
-						runReq = &executor.RunRequest{
-							Guid:    containerGUID,
-							RunInfo: runInfo,
-						}
-						runReq.Ports = []executor.PortMapping{
-							{ContainerPort: 8080},
-							{ContainerPort: 9090},
-						}
-						err = containerStore.Initialize(logger, runReq)
-						Expect(err).NotTo(HaveOccurred())
+			It("generates container credential directory", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
 
-						container, err := containerStore.Create(logger, "some-trace-id", containerGUID)
-						Expect(err).NotTo(HaveOccurred())
-						return container.Ports[0].ContainerPort
-					}).Should(Equal(uint16(8080)))
-				})
+				Expect(credManager.CreateCredDirCallCount()).To(Equal(1))
+				_, container := credManager.CreateCredDirArgsForCall(0)
+				Expect(container.Guid).To(Equal(containerGuid))
 			})
 
-			Context("when containerProxy is enabled", func() {
-				var (
-					envoySourceDir string
-					envoyConfigDir string
-					err            error
-				)
+			It("does not bind mount the healthcheck", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(gardenClient.CreateCallCount()).To(Equal(1))
+				containerSpec := gardenClient.CreateArgsForCall(0)
+				Expect(containerSpec.BindMounts).NotTo(ContainElement(garden.BindMount{
+					SrcPath: "/var/vcap/packages/healthcheck",
+					DstPath: "/etc/cf-assets/healthcheck",
+					Mode:    garden.BindMountModeRO,
+					Origin:  garden.BindMountOriginHost,
+				}))
+			})
 
+			Context("when declarative healthchecks are enabled", func() {
 				BeforeEach(func() {
-					envoySourceDir, err = ioutil.TempDir("", "envoy_dir")
-					Expect(err).NotTo(HaveOccurred())
-					envoyConfigDir, err = ioutil.TempDir("", "envoy_config_dir")
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						true,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+				})
+
+				It("bind mounts the healthcheck", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
 
-					bindMounts := []garden.BindMount{
-						{
-							Origin:  garden.BindMountOriginHost,
-							SrcPath: envoySourceDir,
-							DstPath: "/etc/cf-assets/envoy",
-						},
-						{
-							Origin:  garden.BindMountOriginHost,
-							SrcPath: filepath.Join(envoyConfigDir, containerGuid),
-							DstPath: "/etc/cf-assets/envoy_config",
-						},
-					}
-					credManager.CreateCredDirReturns(bindMounts, nil, nil)
+					Expect(gardenClient.CreateCallCount()).To(Equal(1))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: "/var/vcap/packages/healthcheck",
+						DstPath: "/etc/cf-assets/healthcheck",
+						Mode:    garden.BindMountModeRO,
+						Origin:  garden.BindMountOriginHost,
+					}))
+				})
+			})
 
-					proxyManager.ProxyPortsReturns([]executor.ProxyPortMapping{
-						{
-							AppPort:   8080,
-							ProxyPort: 61001,
-						},
-						{
-							AppPort:   8080,
-							ProxyPort: containerstore.C2CTLSPort,
-						},
-						{
-							AppPort:   9090,
-							ProxyPort: 61002,
-						},
-					}, []uint16{
-						61001,
-						61002,
-						containerstore.C2CTLSPort,
-					}, nil)
+			Context("when the container has GPUs", func() {
+				var cgroupLimiter *containerstorefakes.FakeCgroupLimiter
 
+				BeforeEach(func() {
+					cgroupLimiter = new(containerstorefakes.FakeCgroupLimiter)
+					containerConfig.CgroupLimiter = cgroupLimiter
+					totalCapacity.GPUs = 1
 					containerStore = containerstore.New(
 						containerConfig,
 						&totalCapacity,
@@ -1199,1047 +1964,1230 @@ var _ = Describe("Container Store", func() {
 						true,
 						advertisePreferenceForInstanceAddress,
 						json.Marshal,
+						[]string{"/dev/nvidia0"},
 					)
+					allocationReq.Resource.GPUs = 1
+				})
 
-					portMapping := []executor.PortMapping{
-						{ContainerPort: 8080},
-						{ContainerPort: 9090},
-					}
-					runReq.Ports = portMapping
-
-					gardenClient.CreateStub = func(spec garden.ContainerSpec) (garden.Container, error) {
-						gardenContainer.InfoStub = func() (garden.ContainerInfo, error) {
-							info := garden.ContainerInfo{}
-							info.MappedPorts = []garden.PortMapping{}
-							for _, netIn := range spec.NetIn {
-								switch netIn.ContainerPort {
-								case 8080:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16000, ContainerPort: 8080})
-								case 9090:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16004, ContainerPort: 9090})
-								case 61001:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16001, ContainerPort: 61001})
-								case 61002:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16002, ContainerPort: 61002})
-								case 61003:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16003, ContainerPort: 61003})
-								case containerstore.C2CTLSPort:
-									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16004, ContainerPort: containerstore.C2CTLSPort})
-								default:
-									return info, errors.New("failed-net-in")
-								}
-							}
-							return info, nil
-						}
-						return gardenContainer, nil
-					}
-				})
-
-				AfterEach(func() {
-					err := os.RemoveAll(envoySourceDir)
-					Expect(err).NotTo(HaveOccurred())
-
-					err = os.RemoveAll(envoyConfigDir)
-					Expect(err).NotTo(HaveOccurred())
-				})
-
-				It("passes all port mappings to NetIn on container creation", func() {
+				It("bind mounts the devices and allows them in the device cgroup of the container", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
 
 					containerSpec := gardenClient.CreateArgsForCall(0)
-					Expect(containerSpec.NetIn).To(HaveLen(4))
-					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: 8080,
-					}))
-					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: 9090,
-					}))
-					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: 61001,
-					}))
-					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: 61002,
-					}))
-					Expect(containerSpec.NetIn).ToNot(ContainElement(garden.NetIn{
-						HostPort: 0, ContainerPort: containerstore.C2CTLSPort,
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: "/dev/nvidia0",
+						DstPath: "/dev/nvidia0",
+						Mode:    garden.BindMountModeRW,
+						Origin:  garden.BindMountOriginHost,
 					}))
+
+					Expect(cgroupLimiter.AllowDevicesCallCount()).To(Equal(1))
+					_, guid, devices := cgroupLimiter.AllowDevicesArgsForCall(0)
+					Expect(guid).To(Equal(containerGuid))
+					Expect(devices).To(Equal([]string{"/dev/nvidia0"}))
 				})
 
-				Context("when disabling unproxied port mappings", func() {
+				Context("when the devices cannot be allowed", func() {
 					BeforeEach(func() {
-						containerStore = containerstore.New(
-							containerConfig,
-							&totalCapacity,
-							gardenClientFactory,
-							dependencyManager,
-							volumeManager,
-							credManager,
-							logManager,
-							clock,
-							eventEmitter,
-							megatron,
-							"/var/vcap/data/cf-system-trusted-certs",
-							metronClient,
-							rootFSSizer,
-							false,
-							"/var/vcap/packages/healthcheck",
-							proxyManager,
-							cellID,
-							false,
-							advertisePreferenceForInstanceAddress,
-							json.Marshal,
-						)
+						cgroupLimiter.AllowDevicesReturns(errors.New("no such file or directory"))
 					})
 
-					It("passes only proxied port mappings to NetIn on container creation", func() {
+					It("destroys the container and fails", func() {
 						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-
-						containerSpec := gardenClient.CreateArgsForCall(0)
-						Expect(containerSpec.NetIn).To(HaveLen(2))
-						Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-							HostPort: 0, ContainerPort: 61001,
-						}))
-						Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
-							HostPort: 0, ContainerPort: 61002,
-						}))
-						Expect(containerSpec.NetIn).ToNot(ContainElement(garden.NetIn{
-							HostPort: 0, ContainerPort: containerstore.C2CTLSPort,
-						}))
-					})
-
-					It("unproxied host ports are set to 0", func() {
-						container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-
-						Expect(container.Ports).To(ConsistOf(executor.PortMapping{
-							ContainerPort:         8080,
-							HostPort:              0,
-							ContainerTLSProxyPort: 61001,
-							HostTLSProxyPort:      16001,
-						}, executor.PortMapping{
-							ContainerPort:         8080,
-							HostPort:              0,
-							ContainerTLSProxyPort: containerstore.C2CTLSPort,
-							HostTLSProxyPort:      0,
-						}, executor.PortMapping{
-							ContainerPort:         9090,
-							HostPort:              0,
-							ContainerTLSProxyPort: 61002,
-							HostTLSProxyPort:      16002,
-						}))
+						Expect(err).To(MatchError("no such file or directory"))
+						Expect(gardenClient.DestroyCallCount()).To(Equal(1))
 					})
 				})
+			})
 
-				It("each port gets an equivalent extra proxy port", func() {
-					container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
+			Context("when credential mounts are configured", func() {
+				var (
+					expectedBindMount garden.BindMount
+				)
 
-					Expect(container.Ports).To(ConsistOf(executor.PortMapping{
-						ContainerPort:         8080,
-						HostPort:              16000,
-						ContainerTLSProxyPort: 61001,
-						HostTLSProxyPort:      16001,
-					}, executor.PortMapping{
-						ContainerPort:         8080,
-						HostPort:              16000,
-						ContainerTLSProxyPort: containerstore.C2CTLSPort,
-						HostTLSProxyPort:      0,
-					}, executor.PortMapping{
-						ContainerPort:         9090,
-						HostPort:              16004,
-						ContainerTLSProxyPort: 61002,
-						HostTLSProxyPort:      16002,
-					}))
+				BeforeEach(func() {
+					expectedBindMount = garden.BindMount{SrcPath: "hpath1", DstPath: "cpath1", Mode: garden.BindMountModeRO, Origin: garden.BindMountOriginHost}
+					envVariables := []executor.EnvironmentVariable{
+						{Name: "CF_INSTANCE_CERT", Value: "some-cert"},
+					}
+					credManager.CreateCredDirReturns([]garden.BindMount{expectedBindMount}, envVariables, nil)
 				})
 
-				It("passes the proxy ports in the config", func() {
+				It("mounts the credential directory into the container", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						return nil
-					}), nil)
-					Expect(containerStore.Run(logger, "some-trace-id", containerGuid)).NotTo(HaveOccurred())
-					Eventually(megatron.StepsRunnerCallCount).Should(Equal(1))
-					_, _, _, _, cfg := megatron.StepsRunnerArgsForCall(0)
-					Expect(cfg.ProxyTLSPorts).To(ConsistOf(uint16(61001), uint16(61002), uint16(containerstore.C2CTLSPort)))
+					Expect(gardenClient.CreateCallCount()).To(Equal(1))
+					Expect(gardenClient.CreateArgsForCall(0).BindMounts).To(ContainElement(expectedBindMount))
 				})
 
-				It("bind mounts envoy", func() {
+				It("add the instance identity environment variables to the container", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-
 					Expect(gardenClient.CreateCallCount()).To(Equal(1))
-					containerSpec := gardenClient.CreateArgsForCall(0)
-					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
-						SrcPath: envoySourceDir,
-						DstPath: "/etc/cf-assets/envoy",
-						Mode:    garden.BindMountModeRO,
-						Origin:  garden.BindMountOriginHost,
-					}))
+					Expect(gardenClient.CreateArgsForCall(0).Env).To(ContainElement("CF_INSTANCE_CERT=some-cert"))
+				})
 
-					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
-						SrcPath: filepath.Join(envoyConfigDir, containerGuid),
-						DstPath: "/etc/cf-assets/envoy_config",
-						Mode:    garden.BindMountModeRO,
-						Origin:  garden.BindMountOriginHost,
-					}))
+				Context("when failing to create credential directory on host", func() {
+					BeforeEach(func() {
+						credManager.CreateCredDirReturns(nil, nil, errors.New("failed to create dir"))
+					})
+
+					It("fails fast and completes the container", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(HaveOccurred())
+
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.State).To(Equal(executor.StateCompleted))
+						Expect(container.RunResult.Failed).To(BeTrue())
+						Expect(container.RunResult.FailureReason).To(Equal(containerstore.CredDirFailed))
+						Expect(container.RunResult.Retryable).To(BeTrue())
+					})
 				})
 			})
 
-			Context("when creating the container fails", func() {
+			Context("when there are volume mounts configured", func() {
 				BeforeEach(func() {
-					gardenClient.CreateStub = func(garden.ContainerSpec) (garden.Container, error) {
-						clock.Increment(1 * time.Second)
-						return nil, errors.New("boom!")
+					someConfig := map[string]interface{}{"some-config": "interface"}
+					runReq.RunInfo.VolumeMounts = []executor.VolumeMount{
+						executor.VolumeMount{ContainerPath: "cpath1", Mode: executor.BindMountModeRW, Driver: "some-driver", VolumeId: "some-volume", Config: someConfig},
+						executor.VolumeMount{ContainerPath: "cpath2", Mode: executor.BindMountModeRO, Driver: "some-other-driver", VolumeId: "some-other-volume", Config: someConfig},
 					}
-				})
 
-				It("returns an error", func() {
-					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(Equal(errors.New("boom!")))
+					count := 0
+					volumeManager.MountStub = // first call mounts at a different point than second call
+						func(lager.Logger, string, string, string, map[string]interface{}) (volman.MountResponse, error) {
+							defer func() { count = count + 1 }()
+							if count == 0 {
+								return volman.MountResponse{Path: "hpath1"}, nil
+							}
+							return volman.MountResponse{Path: "hpath2"}, nil
+						}
 				})
 
-				It("transitions to a completed state", func() {
+				It("mounts the correct volumes via the volume manager", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(Equal(errors.New("boom!")))
-
-					container, err := containerStore.Get(logger, containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(container.State).To(Equal(executor.StateCompleted))
-					Expect(container.RunResult.Failed).To(BeTrue())
-					Expect(container.RunResult.FailureReason).To(ContainSubstring(containerstore.ContainerCreationFailedMessage))
-					Expect(container.RunResult.FailureReason).To(ContainSubstring("boom!"))
-					Expect(container.RunResult.Retryable).To(BeTrue())
-				})
+					Expect(volumeManager.MountCallCount()).To(Equal(2))
 
-				It("emits a metric after failing to create the container", func() {
-					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
-					Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerCreationFailedDuration))
+					_, driverName, volumeId, containerId, config := volumeManager.MountArgsForCall(0)
+					Expect(driverName).To(Equal(runReq.VolumeMounts[0].Driver))
+					Expect(volumeId).To(Equal(runReq.VolumeMounts[0].VolumeId))
+					Expect(containerId).To(Equal(containerGuid))
+					Expect(config).To(Equal(runReq.VolumeMounts[0].Config))
+
+					_, driverName, volumeId, containerId, config = volumeManager.MountArgsForCall(1)
+					Expect(driverName).To(Equal(runReq.VolumeMounts[1].Driver))
+					Expect(volumeId).To(Equal(runReq.VolumeMounts[1].VolumeId))
+					Expect(containerId).To(Equal(containerGuid))
+					Expect(config).To(Equal(runReq.VolumeMounts[1].Config))
 				})
 
-				It("logs that the reason the container failed to create", func() {
+				It("correctly maps container and host directories in garden", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
+					Expect(err).NotTo(HaveOccurred())
+					Expect(gardenClient.CreateCallCount()).To(Equal(1))
 
-					Expect(metronClient.SendAppErrorLogCallCount()).To(Equal(1))
-					msg, sourceType, tags := metronClient.SendAppErrorLogArgsForCall(0)
-					Expect(msg).To(Equal(fmt.Sprintf("Cell %s failed to create container for instance %s: boom!", cellID, containerGuid)))
-					Expect(tags["source_id"]).To(Equal(logGuid))
-					Expect(sourceType).To(Equal("test-source"))
-					Expect(tags["instance_id"]).To(Equal("1"))
+					expectedBindMount1 := garden.BindMount{SrcPath: "hpath1", DstPath: "cpath1", Mode: garden.BindMountModeRW}
+					Expect(gardenClient.CreateArgsForCall(0).BindMounts).To(ContainElement(expectedBindMount1))
+					expectedBindMount2 := garden.BindMount{SrcPath: "hpath2", DstPath: "cpath2", Mode: garden.BindMountModeRO}
+					Expect(gardenClient.CreateArgsForCall(0).BindMounts).To(ContainElement(expectedBindMount2))
 				})
 
-				It("logs the total time it took to create the container before it failed", func() {
-					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
-					Eventually(logger).Should(gbytes.Say("container-setup-failed.*duration.*1000000000"))
+				Context("when it errors on mount", func() {
+					Context("when the driver returns a safeError", func() {
+						BeforeEach(func() {
+							volumeManager.MountReturns(volman.MountResponse{Path: "host-path"}, volman.SafeError{SafeDescription: "some-error"})
+						})
+
+						It("fails fast and completes the container", func() {
+							_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+							Expect(err).To(HaveOccurred())
+							Expect(volumeManager.MountCallCount()).To(Equal(1))
+
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(container.State).To(Equal(executor.StateCompleted))
+							Expect(container.RunResult.Failed).To(BeTrue())
+							Expect(container.RunResult.FailureReason).To(Equal(fmt.Sprintf("%s, errors: some-error", containerstore.VolmanMountFailed)))
+							Expect(container.RunResult.Retryable).To(BeTrue())
+						})
+
+					})
+
+					Context("when the driver returns a unsafeError", func() {
+						BeforeEach(func() {
+							volumeManager.MountReturns(volman.MountResponse{Path: "host-path"}, errors.New("some-error"))
+						})
+
+						It("fails fast and completes the container", func() {
+							_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+							Expect(err).To(HaveOccurred())
+							Expect(volumeManager.MountCallCount()).To(Equal(1))
+
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(container.State).To(Equal(executor.StateCompleted))
+							Expect(container.RunResult.Failed).To(BeTrue())
+							Expect(container.RunResult.FailureReason).To(Equal(containerstore.VolmanMountFailed))
+							Expect(container.RunResult.Retryable).To(BeTrue())
+						})
+					})
+
+				})
+			})
+
+			Context("when the run request sets the clock of the container", func() {
+				BeforeEach(func() {
+					runReq.RunInfo.Clock = &executor.ContainerClock{Timezone: "Europe/Berlin", OffsetSeconds: -3600}
 				})
 
-				It("emits metric on the total time it took to create the container before it failed", func() {
+				It("sets the timezone and clock offset of the container", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
-					Eventually(getMetrics).Should(HaveKey(steps.ContainerSetupFailedDuration))
+					Expect(err).NotTo(HaveOccurred())
+
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.Env).To(ContainElement("TZ=Europe/Berlin"))
+					Expect(containerSpec.Env).To(ContainElement("FAKETIME=-3600s"))
+					Expect(containerSpec.Env).To(ContainElement("LD_PRELOAD=/usr/lib/faketime/libfaketime.so.1"))
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: "/usr/share/zoneinfo/Europe/Berlin",
+						DstPath: "/etc/localtime",
+						Mode:    garden.BindMountModeRO,
+						Origin:  garden.BindMountOriginHost,
+					}))
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1",
+						DstPath: "/usr/lib/faketime/libfaketime.so.1",
+						Mode:    garden.BindMountModeRO,
+						Origin:  garden.BindMountOriginHost,
+					}))
 				})
 			})
 
-			Context("when requesting the container info for the created container fails", func() {
+			Context("when the run request asks for a read-only rootfs", func() {
 				BeforeEach(func() {
-					gardenContainer.InfoStub = func() (garden.ContainerInfo, error) {
-						return garden.ContainerInfo{}, errors.New("could not obtain info")
-					}
+					containerConfig.ReadOnlyRootfsSupported = true
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+
+					runReq.RunInfo.ReadOnlyRootfs = true
+					gardenContainer.StreamInReturns(errors.New("read-only file system"))
 				})
 
-				It("returns an error", func() {
+				It("asks the runtime for a read-only rootfs with a writable /tmp inside the rootfs", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
+					Expect(err).NotTo(HaveOccurred())
 
-					Expect(gardenClient.DestroyCallCount()).To(Equal(1))
-					Expect(gardenClient.DestroyArgsForCall(0)).To(Equal(containerGuid))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.Properties).To(HaveKeyWithValue(executor.ContainerReadOnlyRootfsProperty, "true"))
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: "/tmp",
+						DstPath: "/tmp",
+						Mode:    garden.BindMountModeRW,
+						Origin:  garden.BindMountOriginContainer,
+					}))
 				})
 
-				It("transitions to a completed state", func() {
+				It("checks that the rootfs cannot be written to", func() {
 					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
-
-					container, err := containerStore.Get(logger, containerGuid)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(container.State).To(Equal(executor.StateCompleted))
-					Expect(container.RunResult.Failed).To(BeTrue())
-					Expect(container.RunResult.FailureReason).To(ContainSubstring(containerstore.ContainerCreationFailedMessage))
-					Expect(container.RunResult.FailureReason).To(ContainSubstring("could not obtain info"))
-					Expect(container.RunResult.Retryable).To(BeTrue())
+
+					Expect(gardenContainer.StreamInCallCount()).To(Equal(1))
+					spec := gardenContainer.StreamInArgsForCall(0)
+					Expect(spec.Path).To(Equal("/"))
+					Expect(spec.User).To(Equal("root"))
 				})
-			})
-		})
 
-		Context("when the container does not exist", func() {
-			It("returns a conatiner not found error", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", "bogus-guid")
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
-			})
-		})
+				Context("when the runtime leaves the rootfs writable", func() {
+					BeforeEach(func() {
+						gardenContainer.StreamInReturns(nil)
+					})
 
-		Context("when the container is not initializing", func() {
-			BeforeEach(func() {
-				_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
-				Expect(err).NotTo(HaveOccurred())
+					It("destroys the container and fails", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(Equal(executor.ErrReadOnlyRootfsNotEnforced))
+						Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+					})
+				})
 			})
 
-			It("returns an invalid state transition error", func() {
-				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).To(Equal(executor.ErrInvalidTransition))
-			})
-		})
-	})
+			Context("when there are trusted system certificates", func() {
+				Context("and the desired LRP has a certificates path", func() {
+					var mounts []garden.BindMount
 
-	Describe("Run", func() {
-		var (
-			allocationReq *executor.AllocationRequest
-			runProcess    *gardenfakes.FakeProcess
-		)
+					BeforeEach(func() {
+						runReq.RunInfo.TrustedSystemCertificatesPath = "/etc/cf-system-certificates"
+						mounts = []garden.BindMount{
+							{
+								SrcPath: "/var/vcap/data/cf-system-trusted-certs",
+								DstPath: runReq.RunInfo.TrustedSystemCertificatesPath,
+								Mode:    garden.BindMountModeRO,
+								Origin:  garden.BindMountOriginHost,
+							},
+						}
+					})
 
-		BeforeEach(func() {
-			allocationReq = &executor.AllocationRequest{
-				Guid: containerGuid,
-			}
+					It("creates a bind mount", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-			runProcess = &gardenfakes.FakeProcess{}
+						Expect(gardenClient.CreateCallCount()).To(Equal(1))
+						gardenContainerSpec := gardenClient.CreateArgsForCall(0)
+						Expect(gardenContainerSpec.BindMounts).To(ContainElement(mounts[0]))
+					})
 
-			gardenContainer.RunReturns(runProcess, nil)
-			gardenClient.CreateReturns(gardenContainer, nil)
-			gardenClient.LookupReturns(gardenContainer, nil)
-		})
+					It("creates a CF_SYSTEM_CERT_PATH env var", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-		Context("when it is in the created state", func() {
-			var (
-				runReq *executor.RunRequest
-			)
+						containerSpec := gardenClient.CreateArgsForCall(0)
+						Expect(containerSpec.Env).To(ContainElement("CF_SYSTEM_CERT_PATH=" + runReq.RunInfo.TrustedSystemCertificatesPath))
+					})
+				})
 
-			BeforeEach(func() {
-				runAction := &models.Action{
-					RunAction: &models.RunAction{
-						Path: "/foo/bar",
-					},
-				}
+				Context("and the desired LRP does not have a certificates path", func() {
+					It("does not create a bind mount", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-				runReq = &executor.RunRequest{
-					Guid: containerGuid,
-					RunInfo: executor.RunInfo{
-						Action: runAction,
-						LogConfig: executor.LogConfig{
-							Guid: containerGuid,
-						},
-						LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
-					},
-				}
+						Expect(gardenClient.CreateCallCount()).To(Equal(1))
+						gardenContainerSpec := gardenClient.CreateArgsForCall(0)
+						Expect(gardenContainerSpec.BindMounts).NotTo(ContainElement(garden.BindMount{
+							SrcPath: "/var/vcap/data/cf-system-trusted-certs",
+							DstPath: runReq.RunInfo.TrustedSystemCertificatesPath,
+							Mode:    garden.BindMountModeRO,
+							Origin:  garden.BindMountOriginHost,
+						}))
+					})
 
-				var err error
-				_, err = ioutil.TempDir("", "envoy_dir")
-				Expect(err).NotTo(HaveOccurred())
-				_, err = ioutil.TempDir("", "envoy_config_dir")
-				Expect(err).NotTo(HaveOccurred())
+					It("does not create the CF_SYSTEM_CERT_PATH env var", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						containerSpec := gardenClient.CreateArgsForCall(0)
+						Expect(containerSpec.Env).NotTo(ContainElement(ContainSubstring("CF_SYSTEM_CERT_PATH")))
+					})
+				})
 			})
 
-			JustBeforeEach(func() {
-				_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
-				Expect(err).NotTo(HaveOccurred())
+			Context("when downloading bind mounts fails", func() {
+				BeforeEach(func() {
+					dependencyManager.DownloadCachedDependenciesReturns(containerstore.BindMounts{}, errors.New("no"))
+				})
 
-				err = containerStore.Initialize(logger, runReq)
-				Expect(err).NotTo(HaveOccurred())
+				It("transitions to a completed state", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
 
-				_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.State).To(Equal(executor.StateCompleted))
+					Expect(container.RunResult.Failed).To(BeTrue())
+					Expect(container.RunResult.FailureReason).To(Equal(containerstore.DownloadCachedDependenciesFailed))
+					Expect(container.RunResult.Retryable).To(BeTrue())
+				})
 			})
 
-			Context("while the cred manager is still setting up", func() {
-				var (
-					cmFinishSetup            chan struct{}
-					containerRunnerCalled    chan struct{}
-					credManagerBindMount     []garden.BindMount
-					credManagerSignalled     chan struct{}
-					containerRunnerSignalled chan struct{}
-				)
-
+			Context("when egress rules are requested", func() {
 				BeforeEach(func() {
-					cmFinishSetup = make(chan struct{}, 1)
-					containerRunnerCalled = make(chan struct{})
-
-					credManagerSignalled = make(chan struct{}, 1)
-					containerRunnerSignalled = make(chan struct{}, 1)
-
-					credManagerBindMount = []garden.BindMount{
+					egressRules := []*models.SecurityGroupRule{
 						{
-							SrcPath: "hpath1",
-							DstPath: "cpath1",
-							Mode:    garden.BindMountModeRO,
-							Origin:  garden.BindMountOriginHost,
+							Protocol:     "icmp",
+							Destinations: []string{"1.1.1.1"},
+							IcmpInfo: &models.ICMPInfo{
+								Type: 2,
+								Code: 10,
+							},
+						},
+						{
+							Protocol:     "icmp",
+							Destinations: []string{"1.1.1.2"},
+							IcmpInfo: &models.ICMPInfo{
+								Type: 3,
+								Code: 10,
+							},
 						},
 					}
-					envVariables := []executor.EnvironmentVariable{
-						{Name: "CF_INSTANCE_CERT", Value: "some-cert"},
-					}
-					credManager.CreateCredDirReturns(credManagerBindMount, envVariables, nil)
-
-					credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						<-cmFinishSetup
-						close(ready)
-						<-signals
-						credManagerSignalled <- struct{}{}
-						return nil
-					}))
-
-					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						close(containerRunnerCalled)
-						<-signals
-						containerRunnerSignalled <- struct{}{}
-						return nil
-					}), nil)
+					runReq.EgressRules = egressRules
 				})
 
-				AfterEach(func() {
-					close(cmFinishSetup)
-					Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
-				})
+				It("calls NetOut for each egress rule", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-				It("does not start the container while cred manager is setting up", func() {
-					go containerStore.Run(logger, "some-trace-id", containerGuid)
-					Consistently(containerRunnerCalled).ShouldNot(BeClosed())
+					Expect(gardenClient.CreateCallCount()).To(Equal(1))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.NetOut).To(HaveLen(2))
+					icmpCode := garden.ICMPCode(10)
+					Expect(containerSpec.NetOut).To(ContainElement(garden.NetOutRule{
+						Protocol: garden.Protocol(3),
+						Networks: []garden.IPRange{
+							{
+								Start: net.ParseIP("1.1.1.1"),
+								End:   net.ParseIP("1.1.1.1"),
+							},
+						},
+						ICMPs: &garden.ICMPControl{
+							Type: 2,
+							Code: &icmpCode,
+						},
+					}))
+					Expect(containerSpec.NetOut).To(ContainElement(garden.NetOutRule{
+						Protocol: garden.Protocol(3),
+						Networks: []garden.IPRange{
+							{
+								Start: net.ParseIP("1.1.1.2"),
+								End:   net.ParseIP("1.1.1.2"),
+							},
+						},
+						ICMPs: &garden.ICMPControl{
+							Type: 3,
+							Code: &icmpCode,
+						},
+					}))
 				})
 
-				Context("when cred manager is finished setting up", func() {
+				Context("when a egress rule is not valid", func() {
 					BeforeEach(func() {
-						cmFinishSetup <- struct{}{}
+						egressRule := &models.SecurityGroupRule{
+							Protocol: "tcp",
+						}
+						runReq.EgressRules = append(runReq.EgressRules, egressRule)
 					})
 
-					It("starts the container", func() {
-						go containerStore.Run(logger, "some-trace-id", containerGuid)
-						Eventually(containerRunnerCalled).Should(BeClosed())
+					It("returns an error", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).To(HaveOccurred())
+
+						Expect(gardenClient.CreateCallCount()).To(Equal(0))
 					})
 				})
 			})
 
-			Context("when the runner fails the initial credential generation", func() {
+			Context("when containerProxy is disabled", func() {
 				BeforeEach(func() {
-					credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						return errors.New("BOOOM")
-					}))
-				})
-
-				It("destroys the container and returns an error", func() {
-					err := containerStore.Run(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-
-					Eventually(func() executor.State {
-						container, err := containerStore.Get(logger, containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-						return container.State
-					}).Should(Equal(executor.StateCompleted))
-					container, _ := containerStore.Get(logger, containerGuid)
-					Expect(container.RunResult.Failed).To(BeTrue())
-					// make sure the error message is at the end so that
-					// FailureReasonSanitizer can properly map the error messages
-					Expect(container.RunResult.FailureReason).To(MatchRegexp("cred-manager-runner exited: BOOOM$"))
-					Expect(container.RunResult.Retryable).To(BeFalse())
-				})
-
-				It("tranistions immediately to Completed state", func() {
-					err := containerStore.Run(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-
-					Eventually(func() executor.State {
-						container, err := containerStore.Get(logger, containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-						return container.State
-					}).Should(Equal(executor.StateCompleted))
+					portMapping := []executor.PortMapping{
+						{ContainerPort: 8080},
+						{ContainerPort: 9090},
+					}
+					runReq.Ports = portMapping
 
-					Eventually(func() []string {
-						var events []string
-						for i := 0; i < eventEmitter.EmitCallCount(); i++ {
-							event := eventEmitter.EmitArgsForCall(i)
-							events = append(events, string(event.EventType()))
+					gardenClient.CreateStub = func(spec garden.ContainerSpec) (garden.Container, error) {
+						gardenContainer.InfoStub = func() (garden.ContainerInfo, error) {
+							info := garden.ContainerInfo{}
+							info.MappedPorts = []garden.PortMapping{}
+							for _, netIn := range spec.NetIn {
+								switch netIn.ContainerPort {
+								case 8080:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16000, ContainerPort: 8080})
+								case 9090:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 32000, ContainerPort: 9090})
+								default:
+									return info, errors.New("failed-net-in")
+								}
+							}
+							return info, nil
 						}
-						return events
-					}).Should(ConsistOf("container_reserved", "container_complete"))
+						return gardenContainer, nil
+					}
 				})
-			})
 
-			Context("when instance credential is ready", func() {
-				var (
-					containerRunnerCalled   chan struct{}
-					credManagerRunnerCalled chan struct{}
-				)
+				It("passes all port mappings to NetIn on container creation", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-				BeforeEach(func() {
-					credManagerRunnerCalled = make(chan struct{})
-					cmCalled := credManagerRunnerCalled
-					credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						close(ready)
-						close(cmCalled)
-						<-signals
-						return nil
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.NetIn).To(HaveLen(2))
+					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: 8080,
+					}))
+					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: 9090,
 					}))
-
-					containerRunnerCalled = make(chan struct{})
-
-					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						close(containerRunnerCalled)
-						close(ready)
-						<-signals
-						return nil
-					}), nil)
-				})
-
-				AfterEach(func() {
-					containerStore.Destroy(logger, "some-trace-id", containerGuid)
 				})
 
-				Context("when the runner fails subsequent credential generation", func() {
+				Context("when the network and port pools are tracked", func() {
 					BeforeEach(func() {
-						credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-							close(ready)
-							select {
-							case <-containerRunnerCalled:
-								return errors.New("BOOOM")
-							case <-signals:
-								return nil
-							}
-						}))
+						totalCapacity.ContainerIPs = 10
+						totalCapacity.HostPorts = 100
+						containerStore = containerstore.New(
+							containerConfig,
+							&totalCapacity,
+							gardenClientFactory,
+							dependencyManager,
+							volumeManager,
+							credManager,
+							logManager,
+							clock,
+							eventEmitter,
+							megatron,
+							"/var/vcap/data/cf-system-trusted-certs",
+							metronClient,
+							rootFSSizer,
+							false,
+							"/var/vcap/packages/healthcheck",
+							proxyManager,
+							cellID,
+							true,
+							advertisePreferenceForInstanceAddress,
+							json.Marshal,
+							nil,
+						)
 					})
 
-					It("destroys the container and returns an error", func() {
-						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+					It("counts the container IP and host ports garden assigned", func() {
+						Expect(containerStore.RemainingResources(logger).ContainerIPs).To(Equal(10))
+
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 						Expect(err).NotTo(HaveOccurred())
 
-						Eventually(func() executor.State {
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							return container.State
-						}).Should(Equal(executor.StateCompleted))
-						container, _ := containerStore.Get(logger, containerGuid)
-						Expect(container.RunResult.Failed).To(BeTrue())
-						// make sure the error message is at the end so that
-						// FailureReasonSanitizer can properly map the error messages
-						Expect(container.RunResult.FailureReason).To(MatchRegexp("BOOOM$"))
-						Expect(container.RunResult.Retryable).To(BeFalse())
+						remainingCapacity := containerStore.RemainingResources(logger)
+						Expect(remainingCapacity.ContainerIPs).To(Equal(9))
+						Expect(remainingCapacity.HostPorts).To(Equal(98))
+
+						Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+						remainingCapacity = containerStore.RemainingResources(logger)
+						Expect(remainingCapacity.ContainerIPs).To(Equal(10))
+						Expect(remainingCapacity.HostPorts).To(Equal(100))
 					})
 				})
 
-				Context("when the action runs indefinitely", func() {
-					var readyChan chan struct{}
+				Context("when the app has duplicate port exposed", func() {
 					BeforeEach(func() {
-						readyChan = make(chan struct{})
-						var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-							readyChan <- struct{}{}
-							close(ready)
-							<-signals
-							return nil
-						}
-						megatron.StepsRunnerReturns(testRunner, nil)
+						runReq.Ports = append(runReq.Ports, executor.PortMapping{ContainerPort: 8080})
 					})
 
-					It("performs the step", func() {
-						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+					It("de duplicate the exposed ports", func() {
+						container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
 						Expect(err).NotTo(HaveOccurred())
 
-						Expect(megatron.StepsRunnerCallCount()).To(Equal(1))
-						Eventually(readyChan).Should(Receive())
-					})
-
-					It("sets the container state to running once the healthcheck passes, and emits a running event", func() {
-						err := containerStore.Run(logger, "some-trace-id", containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-
-						container, err := containerStore.Get(logger, containerGuid)
-						Expect(err).NotTo(HaveOccurred())
-						Expect(container.State).To(Equal(executor.StateCreated))
-
-						Eventually(readyChan).Should(Receive())
-
-						Eventually(func() executor.State {
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							return container.State
-						}).Should(Equal(executor.StateRunning))
+						Expect(container.Ports).To(ConsistOf(executor.PortMapping{
+							ContainerPort: 8080,
+							HostPort:      16000,
+						}, executor.PortMapping{
+							ContainerPort: 9090,
+							HostPort:      32000,
+						}))
 
-						container, err = containerStore.Get(logger, containerGuid)
+						fetchedContainer, err := containerStore.Get(logger, containerGuid)
 						Expect(err).NotTo(HaveOccurred())
-
-						Eventually(eventEmitter.EmitCallCount).Should(Equal(2))
-						event := eventEmitter.EmitArgsForCall(1)
-						Expect(event).To(Equal(executor.NewContainerRunningEvent(container, "some-trace-id")))
+						Expect(fetchedContainer).To(Equal(container))
 					})
 				})
 
-				Context("when the action exits", func() {
-					var (
-						completeChan chan struct{}
-					)
-
-					BeforeEach(func() {
-						completeChan = make(chan struct{})
-					})
+				It("saves the actual port mappings on the container", func() {
+					container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-					Context("successfully", func() {
-						BeforeEach(func() {
-							var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-								close(ready)
-								<-completeChan
-								return nil
-							}
-							megatron.StepsRunnerReturns(testRunner, nil)
-						})
+					Expect(container.Ports).To(ConsistOf(executor.PortMapping{
+						ContainerPort: 8080,
+						HostPort:      16000,
+					}, executor.PortMapping{
+						ContainerPort: 9090,
+						HostPort:      32000,
+					}))
 
-						It("sets its state to completed", func() {
-							err := containerStore.Run(logger, "some-trace-id", containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+					fetchedContainer, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fetchedContainer).To(Equal(container))
+				})
 
-							close(completeChan)
+				It("preserves port orders", func() {
+					Consistently(func() uint16 {
+						containerGUID := "new-container-guid"
+						allocationReq = &executor.AllocationRequest{
+							Guid: containerGUID,
+							Tags: executor.Tags{
+								"Foo": "Bar",
+							},
+						}
 
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+						_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
+						Expect(err).NotTo(HaveOccurred())
 
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							Expect(container.State).To(Equal(executor.StateCompleted))
-						})
+						defer containerStore.Destroy(logger, "some-trace-id", containerGUID)
 
-						It("emits a container completed event", func() {
-							err := containerStore.Run(logger, "some-trace-id", containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+						runReq = &executor.RunRequest{
+							Guid:    containerGUID,
+							RunInfo: runInfo,
+						}
+						runReq.Ports = []executor.PortMapping{
+							{ContainerPort: 8080},
+							{ContainerPort: 9090},
+						}
+						err = containerStore.Initialize(logger, runReq)
+						Expect(err).NotTo(HaveOccurred())
 
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
-							close(completeChan)
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+						container, err := containerStore.Create(logger, "some-trace-id", containerGUID)
+						Expect(err).NotTo(HaveOccurred())
+						return container.Ports[0].ContainerPort
+					}).Should(Equal(uint16(8080)))
+				})
+			})
 
-							Expect(eventEmitter.EmitCallCount()).To(Equal(3))
+			Context("when containerProxy is enabled", func() {
+				var (
+					envoySourceDir string
+					envoyConfigDir string
+					err            error
+				)
 
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+				BeforeEach(func() {
+					envoySourceDir, err = ioutil.TempDir("", "envoy_dir")
+					Expect(err).NotTo(HaveOccurred())
+					envoyConfigDir, err = ioutil.TempDir("", "envoy_config_dir")
+					Expect(err).NotTo(HaveOccurred())
 
-							emittedEvents := []executor.Event{}
-							for i := 0; i < eventEmitter.EmitCallCount(); i++ {
-								emittedEvents = append(emittedEvents, eventEmitter.EmitArgsForCall(i))
-							}
+					bindMounts := []garden.BindMount{
+						{
+							Origin:  garden.BindMountOriginHost,
+							SrcPath: envoySourceDir,
+							DstPath: "/etc/cf-assets/envoy",
+						},
+						{
+							Origin:  garden.BindMountOriginHost,
+							SrcPath: filepath.Join(envoyConfigDir, containerGuid),
+							DstPath: "/etc/cf-assets/envoy_config",
+						},
+					}
+					credManager.CreateCredDirReturns(bindMounts, nil, nil)
 
-							Expect(emittedEvents).To(ContainElement(executor.NewContainerCompleteEvent(container, "some-trace-id")))
-						})
+					proxyManager.ProxyPortsReturns([]executor.ProxyPortMapping{
+						{
+							AppPort:   8080,
+							ProxyPort: 61001,
+						},
+						{
+							AppPort:   8080,
+							ProxyPort: containerstore.C2CTLSPort,
+						},
+						{
+							AppPort:   9090,
+							ProxyPort: 61002,
+						},
+					}, []uint16{
+						61001,
+						61002,
+						containerstore.C2CTLSPort,
+					}, nil)
 
-						It("sets the result on the container", func() {
-							err := containerStore.Run(logger, "some-trace-id", containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
 
-							close(completeChan)
+					portMapping := []executor.PortMapping{
+						{ContainerPort: 8080},
+						{ContainerPort: 9090},
+					}
+					runReq.Ports = portMapping
 
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+					gardenClient.CreateStub = func(spec garden.ContainerSpec) (garden.Container, error) {
+						gardenContainer.InfoStub = func() (garden.ContainerInfo, error) {
+							info := garden.ContainerInfo{}
+							info.MappedPorts = []garden.PortMapping{}
+							for _, netIn := range spec.NetIn {
+								switch netIn.ContainerPort {
+								case 8080:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16000, ContainerPort: 8080})
+								case 9090:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16004, ContainerPort: 9090})
+								case 61001:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16001, ContainerPort: 61001})
+								case 61002:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16002, ContainerPort: 61002})
+								case 61003:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16003, ContainerPort: 61003})
+								case containerstore.C2CTLSPort:
+									info.MappedPorts = append(info.MappedPorts, garden.PortMapping{HostPort: 16004, ContainerPort: containerstore.C2CTLSPort})
+								default:
+									return info, errors.New("failed-net-in")
+								}
+							}
+							return info, nil
+						}
+						return gardenContainer, nil
+					}
+				})
 
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							Expect(container.RunResult.Failed).To(Equal(false))
-							Expect(container.RunResult.Stopped).To(Equal(false))
-							Expect(container.RunResult.Retryable).To(BeFalse())
-						})
+				AfterEach(func() {
+					err := os.RemoveAll(envoySourceDir)
+					Expect(err).NotTo(HaveOccurred())
 
-						It("increments the ContainerCompletedCount metric", func() {
-							err := containerStore.Run(logger, "some-trace-id", containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+					err = os.RemoveAll(envoyConfigDir)
+					Expect(err).NotTo(HaveOccurred())
+				})
 
-							close(completeChan)
+				It("passes all port mappings to NetIn on container creation", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
-							Expect(metronClient.IncrementCounterCallCount()).To(Equal(1))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.NetIn).To(HaveLen(4))
+					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: 8080,
+					}))
+					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: 9090,
+					}))
+					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: 61001,
+					}))
+					Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: 61002,
+					}))
+					Expect(containerSpec.NetIn).ToNot(ContainElement(garden.NetIn{
+						HostPort: 0, ContainerPort: containerstore.C2CTLSPort,
+					}))
+				})
 
-							Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerCompletedCount))
-						})
+				Context("when disabling unproxied port mappings", func() {
+					BeforeEach(func() {
+						containerStore = containerstore.New(
+							containerConfig,
+							&totalCapacity,
+							gardenClientFactory,
+							dependencyManager,
+							volumeManager,
+							credManager,
+							logManager,
+							clock,
+							eventEmitter,
+							megatron,
+							"/var/vcap/data/cf-system-trusted-certs",
+							metronClient,
+							rootFSSizer,
+							false,
+							"/var/vcap/packages/healthcheck",
+							proxyManager,
+							cellID,
+							false,
+							advertisePreferenceForInstanceAddress,
+							json.Marshal,
+							nil,
+						)
 					})
 
-					Context("unsuccessfully", func() {
-						BeforeEach(func() {
-							var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-								close(ready)
-								return errors.New("BOOOOM!!!!")
-							}
-							megatron.StepsRunnerReturns(testRunner, nil)
-						})
+					It("passes only proxied port mappings to NetIn on container creation", func() {
+						_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-						It("sets the run result on the container", func() {
-							err := containerStore.Run(logger, "some-trace-id", containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+						containerSpec := gardenClient.CreateArgsForCall(0)
+						Expect(containerSpec.NetIn).To(HaveLen(2))
+						Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+							HostPort: 0, ContainerPort: 61001,
+						}))
+						Expect(containerSpec.NetIn).To(ContainElement(garden.NetIn{
+							HostPort: 0, ContainerPort: 61002,
+						}))
+						Expect(containerSpec.NetIn).ToNot(ContainElement(garden.NetIn{
+							HostPort: 0, ContainerPort: containerstore.C2CTLSPort,
+						}))
+					})
 
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+					It("unproxied host ports are set to 0", func() {
+						container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-							container, err := containerStore.Get(logger, containerGuid)
-							Expect(err).NotTo(HaveOccurred())
-							Expect(container.RunResult.Failed).To(Equal(true))
-							// make sure the error message is at the end so that
-							// FailureReasonSanitizer can properly map the error messages
-							Expect(container.RunResult.FailureReason).To(MatchRegexp("BOOOOM!!!!$"))
-							Expect(container.RunResult.Stopped).To(Equal(false))
-							Expect(container.RunResult.Retryable).To(BeFalse())
-						})
+						Expect(container.Ports).To(ConsistOf(executor.PortMapping{
+							ContainerPort:         8080,
+							HostPort:              0,
+							ContainerTLSProxyPort: 61001,
+							HostTLSProxyPort:      16001,
+						}, executor.PortMapping{
+							ContainerPort:         8080,
+							HostPort:              0,
+							ContainerTLSProxyPort: containerstore.C2CTLSPort,
+							HostTLSProxyPort:      0,
+						}, executor.PortMapping{
+							ContainerPort:         9090,
+							HostPort:              0,
+							ContainerTLSProxyPort: 61002,
+							HostTLSProxyPort:      16002,
+						}))
+					})
+				})
 
-						It("increments the ContainerCompletedCount metric", func() {
-							err := containerStore.Run(logger, "some-trace-id", containerGuid)
-							Expect(err).NotTo(HaveOccurred())
+				It("each port gets an equivalent extra proxy port", func() {
+					container, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
-							Expect(metronClient.IncrementCounterCallCount()).To(Equal(1))
+					Expect(container.Ports).To(ConsistOf(executor.PortMapping{
+						ContainerPort:         8080,
+						HostPort:              16000,
+						ContainerTLSProxyPort: 61001,
+						HostTLSProxyPort:      16001,
+					}, executor.PortMapping{
+						ContainerPort:         8080,
+						HostPort:              16000,
+						ContainerTLSProxyPort: containerstore.C2CTLSPort,
+						HostTLSProxyPort:      0,
+					}, executor.PortMapping{
+						ContainerPort:         9090,
+						HostPort:              16004,
+						ContainerTLSProxyPort: 61002,
+						HostTLSProxyPort:      16002,
+					}))
+				})
 
-							Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerCompletedCount))
-						})
+				It("passes the proxy ports in the config", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						return nil
+					}), nil)
+					Expect(containerStore.Run(logger, "some-trace-id", containerGuid)).NotTo(HaveOccurred())
+					Eventually(megatron.StepsRunnerCallCount).Should(Equal(1))
+					_, _, _, _, cfg := megatron.StepsRunnerArgsForCall(0)
+					Expect(cfg.ProxyTLSPorts).To(ConsistOf(uint16(61001), uint16(61002), uint16(containerstore.C2CTLSPort)))
+				})
 
-						Context("when run fails with ErrExceededGracefulShutdownInterval", func() {
-							BeforeEach(func() {
-								var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-									close(ready)
-									return new(steps.ExceededGracefulShutdownIntervalError)
-								}
-								megatron.StepsRunnerReturns(testRunner, nil)
-							})
+				It("bind mounts envoy", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-							It("increments the ContainerExitedOnTimeoutCount and ContainerCompletedCount metric", func() {
-								err := containerStore.Run(logger, "some-trace-id", containerGuid)
-								Expect(err).NotTo(HaveOccurred())
+					Expect(gardenClient.CreateCallCount()).To(Equal(1))
+					containerSpec := gardenClient.CreateArgsForCall(0)
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: envoySourceDir,
+						DstPath: "/etc/cf-assets/envoy",
+						Mode:    garden.BindMountModeRO,
+						Origin:  garden.BindMountOriginHost,
+					}))
 
-								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
-								Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+					Expect(containerSpec.BindMounts).To(ContainElement(garden.BindMount{
+						SrcPath: filepath.Join(envoyConfigDir, containerGuid),
+						DstPath: "/etc/cf-assets/envoy_config",
+						Mode:    garden.BindMountModeRO,
+						Origin:  garden.BindMountOriginHost,
+					}))
+				})
+			})
 
-								Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerExitedOnTimeoutCount))
-								Expect(metronClient.IncrementCounterArgsForCall(1)).To(Equal(containerstore.ContainerCompletedCount))
-							})
-						})
+			Context("when creating the container fails", func() {
+				BeforeEach(func() {
+					gardenClient.CreateStub = func(garden.ContainerSpec) (garden.Container, error) {
+						clock.Increment(1 * time.Second)
+						return nil, errors.New("boom!")
+					}
+				})
 
-						Context("when run fails with ErrExitTimeout", func() {
-							BeforeEach(func() {
-								var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-									close(ready)
-									return new(steps.ExitTimeoutError)
-								}
-								megatron.StepsRunnerReturns(testRunner, nil)
-							})
+				It("returns an error", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(Equal(errors.New("boom!")))
+				})
 
-							It("increments the ContainerExitedOnTimeoutCount and ContainerCompletedCount metric", func() {
-								err := containerStore.Run(logger, "some-trace-id", containerGuid)
-								Expect(err).NotTo(HaveOccurred())
+				It("transitions to a completed state", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(Equal(errors.New("boom!")))
 
-								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
-								Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.State).To(Equal(executor.StateCompleted))
+					Expect(container.RunResult.Failed).To(BeTrue())
+					Expect(container.RunResult.FailureReason).To(ContainSubstring(containerstore.ContainerCreationFailedMessage))
+					Expect(container.RunResult.FailureReason).To(ContainSubstring("boom!"))
+					Expect(container.RunResult.Retryable).To(BeTrue())
+				})
 
-								Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerExitedOnTimeoutCount))
-								Expect(metronClient.IncrementCounterArgsForCall(1)).To(Equal(containerstore.ContainerCompletedCount))
-							})
-						})
+				It("emits a metric after failing to create the container", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
+					Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerCreationFailedDuration))
+				})
 
-						Context("when run fails with a complex error that contains a graceful shutdown error", func() {
-							BeforeEach(func() {
-								aggregate := &multierror.Error{}
-								aggregate = multierror.Append(aggregate, errors.New("some-other-error"))
-								aggregate = multierror.Append(aggregate, &steps.ExceededGracefulShutdownIntervalError{})
-								var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-									close(ready)
-									return grouper.ErrorTrace{
-										{
-											Member: grouper.Member{Name: "foo"}, Err: errors.New("foo"),
-										},
-										{
-											Member: grouper.Member{Name: "runner"}, Err: aggregate,
-										},
-									}
-								}
-								megatron.StepsRunnerReturns(testRunner, nil)
-							})
+				It("logs that the reason the container failed to create", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
 
-							It("increments the ContainerExitedOnTimeoutCount and ContainerCompletedCount metric", func() {
-								err := containerStore.Run(logger, "some-trace-id", containerGuid)
-								Expect(err).NotTo(HaveOccurred())
+					Expect(metronClient.SendAppErrorLogCallCount()).To(Equal(1))
+					msg, sourceType, tags := metronClient.SendAppErrorLogArgsForCall(0)
+					Expect(msg).To(Equal(fmt.Sprintf("Cell %s failed to create container for instance %s: boom!", cellID, containerGuid)))
+					Expect(tags["source_id"]).To(Equal(logGuid))
+					Expect(sourceType).To(Equal("test-source"))
+					Expect(tags["instance_id"]).To(Equal("1"))
+				})
 
-								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
-								Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+				It("logs the total time it took to create the container before it failed", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
+					Eventually(logger).Should(gbytes.Say("container-setup-failed.*duration.*1000000000"))
+				})
 
-								Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerExitedOnTimeoutCount))
-								Expect(metronClient.IncrementCounterArgsForCall(1)).To(Equal(containerstore.ContainerCompletedCount))
-							})
+				It("emits metric on the total time it took to create the container before it failed", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
+					Eventually(getMetrics).Should(HaveKey(steps.ContainerSetupFailedDuration))
+				})
+			})
 
-							Context("when there are multiple graceful shutdown exceeded errors", func() {
-								BeforeEach(func() {
-									var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-										close(ready)
-										return grouper.ErrorTrace{
-											{
-												Member: grouper.Member{Name: "runner"}, Err: &multierror.Error{
-													Errors: []error{errors.New("some-other-error"), new(steps.ExitTimeoutError), new(steps.ExceededGracefulShutdownIntervalError)},
-												},
-											},
-										}
-									}
-									megatron.StepsRunnerReturns(testRunner, nil)
-								})
-
-								It("only increments the graceful shutdown exceeded metric once", func() {
-									err := containerStore.Run(logger, "some-trace-id", containerGuid)
-									Expect(err).NotTo(HaveOccurred())
-
-									Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
-									Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
-								})
-							})
-						})
-					})
+			Context("when a garden limit rejects the container", func() {
+				BeforeEach(func() {
+					gardenClient.CreateReturns(nil, errors.New("insufficient subnets remaining in the pool"))
 				})
 
-				Context("when the transformer fails to generate steps", func() {
-					BeforeEach(func() {
-						megatron.StepsRunnerReturns(nil, errors.New("defeated by the auto bots"))
-					})
+				It("fails the container with a distinct reason", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
 
-					It("returns an error", func() {
-						err := containerStore.Run(logger, "some-trace-id", containerGuid)
-						Expect(err).To(HaveOccurred())
-					})
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.RunResult.FailureReason).To(ContainSubstring(containerstore.GardenLimitExhaustedMessage + " (network)"))
+					Expect(container.RunResult.Retryable).To(BeTrue())
 				})
-			})
-		})
-
-		Context("when the container does not exist", func() {
-			It("returns an ErrContainerNotFound error", func() {
-				err := containerStore.Run(logger, "some-trace-id", containerGuid)
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
-			})
-		})
 
-		Context("When the container is not in the created state", func() {
-			JustBeforeEach(func() {
-				_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
-				Expect(err).NotTo(HaveOccurred())
-			})
+				It("stops advertising container capacity until a container is removed from garden", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
+					Expect(containerStore.RemainingResources(logger).Containers).To(Equal(0))
 
-			It("returns a transition error", func() {
-				err := containerStore.Run(logger, "some-trace-id", containerGuid)
-				Expect(err).To(Equal(executor.ErrInvalidTransition))
-			})
-		})
-	})
+					_, err = containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: "another-guid"})
+					Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
 
-	Context("when the container creation is hung", func() {
-		var blockCh chan struct{}
+					Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+					Expect(containerStore.RemainingResources(logger).Containers).To(Equal(0))
+				})
 
-		BeforeEach(func() {
-			blockCh = make(chan struct{})
+				It("emits an event and a metric", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
 
-			// avoid race detector warnings
-			ch := blockCh
-			gardenClient.CreateStub = func(garden.ContainerSpec) (garden.Container, error) {
-				<-ch
-				return &gardenfakes.FakeContainer{}, nil
-			}
-		})
+					Eventually(func() []executor.GardenLimit {
+						var limits []executor.GardenLimit
+						for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+							if event, ok := eventEmitter.EmitArgsForCall(i).(executor.ContainerGardenLimitExhaustedEvent); ok {
+								limits = append(limits, event.Limit)
+							}
+						}
+						return limits
+					}).Should(Equal([]executor.GardenLimit{executor.GardenLimitNetwork}))
+					Expect(metronClient.IncrementCounterArgsForCall(metronClient.IncrementCounterCallCount() - 1)).To(Equal(containerstore.GardenLimitExhaustedCount))
+				})
+			})
 
-		JustBeforeEach(func() {
-			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
-			Expect(err).NotTo(HaveOccurred())
+			Context("when requesting the container info for the created container fails", func() {
+				BeforeEach(func() {
+					gardenContainer.InfoStub = func() (garden.ContainerInfo, error) {
+						return garden.ContainerInfo{}, errors.New("could not obtain info")
+					}
+				})
 
-			runInfo := executor.RunInfo{
-				LogConfig: executor.LogConfig{
-					Guid:       containerGuid,
-					Index:      1,
-					SourceName: "test-source",
-				},
-				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
-			}
-			runReq := &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
-			err = containerStore.Initialize(logger, runReq)
-			Expect(err).NotTo(HaveOccurred())
+				It("returns an error", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
 
-			go containerStore.Create(logger, "some-trace-id", containerGuid)
-			Eventually(gardenClient.CreateCallCount).Should(Equal(1))
-		})
+					Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+					Expect(gardenClient.DestroyArgsForCall(0)).To(Equal(containerGuid))
+				})
 
-		AfterEach(func() {
-			close(blockCh)
-		})
+				It("transitions to a completed state", func() {
+					_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
 
-		Context("when Destroy has been called", func() {
-			JustBeforeEach(func() {
-				blockCh := make(chan error)
-				go func() {
-					blockCh <- containerStore.Destroy(logger, "some-trace-id", containerGuid)
-				}()
-				Consistently(blockCh, time.Second).ShouldNot(Receive())
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.State).To(Equal(executor.StateCompleted))
+					Expect(container.RunResult.Failed).To(BeTrue())
+					Expect(container.RunResult.FailureReason).To(ContainSubstring(containerstore.ContainerCreationFailedMessage))
+					Expect(container.RunResult.FailureReason).To(ContainSubstring("could not obtain info"))
+					Expect(container.RunResult.Retryable).To(BeTrue())
+				})
 			})
+		})
 
-			It("should return immediately", func() {
-				errCh := make(chan error)
-				go func() {
-					errCh <- containerStore.Destroy(logger, "some-trace-id", containerGuid)
-				}()
-				Eventually(errCh).Should(Receive(BeNil()))
+		Context("when the container does not exist", func() {
+			It("returns a conatiner not found error", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", "bogus-guid")
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
 			})
 		})
 
-		Context("when Stop has been called and is hanging", func() {
-			JustBeforeEach(func() {
-				blockCh := make(chan error)
-				go func() {
-					blockCh <- containerStore.Stop(logger, "some-trace-id", containerGuid)
-				}()
-				Consistently(blockCh, time.Second).ShouldNot(Receive())
+		Context("when the container is not initializing", func() {
+			BeforeEach(func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
+				Expect(err).NotTo(HaveOccurred())
 			})
 
-			It("should return immediately", func() {
-				errCh := make(chan error)
-				go func() {
-					errCh <- containerStore.Stop(logger, "some-trace-id", containerGuid)
-				}()
-				Eventually(errCh).Should(Receive(BeNil()))
+			It("returns an invalid state transition error", func() {
+				_, err := containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).To(Equal(executor.ErrInvalidTransition))
 			})
 		})
 	})
 
-	Describe("Update", func() {
+	Describe("Run", func() {
 		var (
-			runReq         *executor.RunRequest
-			updateReq      *executor.UpdateRequest
-			internalRoutes internalroutes.InternalRoutes
-			metricTags     map[string]string
+			allocationReq *executor.AllocationRequest
+			runProcess    *gardenfakes.FakeProcess
 		)
 
 		BeforeEach(func() {
-			var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-				<-signals
-				return nil
-			}
-			runInfo := executor.RunInfo{
-				LogConfig: executor.LogConfig{
-					Guid:       containerGuid,
-					Index:      1,
-					SourceName: "test-source",
-					Tags: map[string]string{
-						"old-log-tag": "old-value",
-					},
-				},
-				MetricsConfig: executor.MetricsConfig{
-					Guid:  containerGuid,
-					Index: 1,
-					Tags: map[string]string{
-						"old-metrics-tag": "old-value",
-					},
-				},
-				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
-				InternalRoutes: internalroutes.InternalRoutes{
-					{Hostname: "old.apps.internal"},
-				},
+			allocationReq = &executor.AllocationRequest{
+				Guid: containerGuid,
 			}
-			runReq = &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
+
+			runProcess = &gardenfakes.FakeProcess{}
+
+			gardenContainer.RunReturns(runProcess, nil)
 			gardenClient.CreateReturns(gardenContainer, nil)
-			megatron.StepsRunnerReturns(testRunner, nil)
-			internalRoutes = internalroutes.InternalRoutes{
-				{Hostname: "a.apps.internal"},
-				{Hostname: "b.apps.internal"},
-			}
-			metricTags = map[string]string{"some-tag": "some-value"}
-			updateReq = &executor.UpdateRequest{Guid: containerGuid, InternalRoutes: internalRoutes, MetricTags: metricTags}
+			gardenClient.LookupReturns(gardenContainer, nil)
 		})
 
-		JustBeforeEach(func() {
-			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
-			Expect(err).NotTo(HaveOccurred())
-
-			err = containerStore.Initialize(logger, runReq)
-			Expect(err).NotTo(HaveOccurred())
+		Context("when it is in the created state", func() {
+			var (
+				runReq *executor.RunRequest
+			)
 
-			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
-		})
+			BeforeEach(func() {
+				runAction := &models.Action{
+					RunAction: &models.RunAction{
+						Path: "/foo/bar",
+					},
+				}
 
-		Context("when the container exists", func() {
-			JustBeforeEach(func() {
+				runReq = &executor.RunRequest{
+					Guid: containerGuid,
+					RunInfo: executor.RunInfo{
+						Action: runAction,
+						LogConfig: executor.LogConfig{
+							Guid: containerGuid,
+						},
+						LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
+					},
+				}
 
-				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				var err error
+				_, err = ioutil.TempDir("", "envoy_dir")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = ioutil.TempDir("", "envoy_config_dir")
 				Expect(err).NotTo(HaveOccurred())
 			})
 
-			It("updates container internal routes", func() {
-				err := containerStore.Update(logger, updateReq)
+			JustBeforeEach(func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
 				Expect(err).NotTo(HaveOccurred())
 
-				container, err := containerStore.Get(logger, containerGuid)
+				err = containerStore.Initialize(logger, runReq)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(container.InternalRoutes).To(Equal(internalRoutes))
-			})
-
-			It("sends a signal to the credmanager to regenerate certs", func() {
-				_, _, regenerateCertsCh := credManager.RunnerArgsForCall(0)
 
-				go func() {
-					err := containerStore.Update(logger, updateReq)
-					Expect(err).NotTo(HaveOccurred())
-				}()
-				Eventually(regenerateCertsCh).Should(Receive(Equal(struct{}{})))
+				_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
 			})
 
-			It("updates metric tags", func() {
-				err := containerStore.Update(logger, updateReq)
-				Expect(err).NotTo(HaveOccurred())
+			Context("while the cred manager is still setting up", func() {
+				var (
+					cmFinishSetup            chan struct{}
+					containerRunnerCalled    chan struct{}
+					credManagerBindMount     []garden.BindMount
+					credManagerSignalled     chan struct{}
+					containerRunnerSignalled chan struct{}
+				)
 
-				container, err := containerStore.Get(logger, containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(container.MetricsConfig.Tags).To(Equal(metricTags))
-			})
+				BeforeEach(func() {
+					cmFinishSetup = make(chan struct{}, 1)
+					containerRunnerCalled = make(chan struct{})
 
-			It("updates log tags and the logStreamer", func() {
-				err := containerStore.Update(logger, updateReq)
-				Expect(err).NotTo(HaveOccurred())
+					credManagerSignalled = make(chan struct{}, 1)
+					containerRunnerSignalled = make(chan struct{}, 1)
 
-				container, err := containerStore.Get(logger, containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(container.LogConfig.Tags).To(Equal(metricTags))
+					credManagerBindMount = []garden.BindMount{
+						{
+							SrcPath: "hpath1",
+							DstPath: "cpath1",
+							Mode:    garden.BindMountModeRO,
+							Origin:  garden.BindMountOriginHost,
+						},
+					}
+					envVariables := []executor.EnvironmentVariable{
+						{Name: "CF_INSTANCE_CERT", Value: "some-cert"},
+					}
+					credManager.CreateCredDirReturns(credManagerBindMount, envVariables, nil)
 
-				Expect(logStreamer.UpdateTagsArgsForCall(0)).To(Equal(metricTags))
-			})
+					credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						<-cmFinishSetup
+						close(ready)
+						<-signals
+						credManagerSignalled <- struct{}{}
+						return nil
+					}))
 
-			It("updates the log config property on the container", func() {
-				err := containerStore.Update(logger, updateReq)
-				Expect(err).NotTo(HaveOccurred())
+					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						close(containerRunnerCalled)
+						<-signals
+						containerRunnerSignalled <- struct{}{}
+						return nil
+					}), nil)
+				})
 
-				Expect(gardenContainer.SetPropertyCallCount()).To(Equal(1))
-				name, value := gardenContainer.SetPropertyArgsForCall(0)
-				Expect(name).To(Equal("log_config"))
+				AfterEach(func() {
+					close(cmFinishSetup)
+					Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+				})
 
-				var parsedValue map[string]interface{}
-				err = json.Unmarshal([]byte(value), &parsedValue)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(parsedValue["guid"]).To(Equal("container-guid"))
-				Expect(parsedValue["index"]).To(Equal(1.0))
-				Expect(parsedValue["source_name"]).To(Equal("test-source"))
-				Expect(parsedValue["tags"]).To(Equal(map[string]interface{}{"some-tag": "some-value"}))
+				It("does not start the container while cred manager is setting up", func() {
+					go containerStore.Run(logger, "some-trace-id", containerGuid)
+					Consistently(containerRunnerCalled).ShouldNot(BeClosed())
+				})
+
+				Context("when cred manager is finished setting up", func() {
+					BeforeEach(func() {
+						cmFinishSetup <- struct{}{}
+					})
+
+					It("starts the container", func() {
+						go containerStore.Run(logger, "some-trace-id", containerGuid)
+						Eventually(containerRunnerCalled).Should(BeClosed())
+					})
+				})
 			})
 
-			Context("when Update is called concurrently", func() {
-				JustBeforeEach(func() {
-					updateReq.InternalRoutes = nil
+			Context("when the container depends on another container", func() {
+				var (
+					dependencyGuid        string
+					containerRunnerCalled chan struct{}
+				)
+
+				BeforeEach(func() {
+					dependencyGuid = "dependency-guid"
+					runReq.DependsOn = []executor.ContainerDependency{{Guid: dependencyGuid, State: executor.StateCreated}}
+
+					_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: dependencyGuid})
+					Expect(err).NotTo(HaveOccurred())
+					err = containerStore.Initialize(logger, &executor.RunRequest{Guid: dependencyGuid})
+					Expect(err).NotTo(HaveOccurred())
+
+					containerRunnerCalled = make(chan struct{})
+					runnerCalled := containerRunnerCalled
+					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						close(runnerCalled)
+						<-signals
+						return nil
+					}), nil)
 				})
-				It("locks access to the container info", func() {
-					var wg sync.WaitGroup
-					wg.Add(2)
-					go func() {
-						err := containerStore.Update(logger, updateReq)
+
+				It("waits for the dependency to reach the state before running the action", func() {
+					err := containerStore.Run(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Consistently(containerRunnerCalled).ShouldNot(BeClosed())
+
+					_, err = containerStore.Create(logger, "some-trace-id", dependencyGuid)
+					Expect(err).NotTo(HaveOccurred())
+					clock.WaitForWatcherAndIncrement(time.Second)
+
+					Eventually(containerRunnerCalled).Should(BeClosed())
+				})
+
+				Context("when the dependency completes before reaching the state", func() {
+					It("fails the container", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
 						Expect(err).NotTo(HaveOccurred())
-						wg.Done()
-					}()
-					go func() {
-						err := containerStore.Update(logger, updateReq)
+
+						err = containerStore.Stop(logger, "some-trace-id", dependencyGuid)
 						Expect(err).NotTo(HaveOccurred())
-						wg.Done()
-					}()
-					wg.Wait()
+						clock.WaitForWatcherAndIncrement(time.Second)
+
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateCompleted))
+						container, _ := containerStore.Get(logger, containerGuid)
+						Expect(container.RunResult.Failed).To(BeTrue())
+						Expect(container.RunResult.FailureReason).To(ContainSubstring("dependency dependency-guid completed before reaching created"))
+						Expect(containerRunnerCalled).NotTo(BeClosed())
+					})
+				})
+
+				Context("when the container has a start timeout", func() {
+					BeforeEach(func() {
+						megatron.StartTimeoutReturns(time.Minute)
+					})
+
+					It("fails the container when the dependency does not reach the state within the start timeout", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+
+						clock.WaitForNWatchersAndIncrement(time.Minute, 2)
+
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateCompleted))
+						container, _ := containerStore.Get(logger, containerGuid)
+						Expect(container.RunResult.Failed).To(BeTrue())
+						Expect(container.RunResult.FailureReason).To(ContainSubstring(executor.ErrDependencyTimeout.Error()))
+						Expect(containerRunnerCalled).NotTo(BeClosed())
+					})
+
+					It("starts the start timeout again once the dependency reaches the state", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+
+						clock.WaitForNWatchersAndIncrement(30*time.Second, 2)
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.StartTimeoutRemainingMs).To(BeEquivalentTo(30000))
+
+						_, err = containerStore.Create(logger, "some-trace-id", dependencyGuid)
+						Expect(err).NotTo(HaveOccurred())
+						clock.Increment(time.Second)
+
+						Eventually(containerRunnerCalled).Should(BeClosed())
+						container, err = containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.StartTimeoutRemainingMs).To(BeEquivalentTo(60000))
+					})
 				})
 			})
 
-			Context("when the log config cannot be serialized", func() {
-				var fm failingMarshaller
+			Context("when containers with the same process guid and index are crash looping", func() {
+				var containerRunnerCalled chan struct{}
 
 				BeforeEach(func() {
+					containerConfig.CrashLoopThreshold = 1
+					containerConfig.CrashLoopWindow = time.Minute
+					containerConfig.CrashLoopMaxBackoff = time.Minute
 					containerStore = containerstore.New(
 						containerConfig,
 						&totalCapacity,
@@ -2260,928 +3208,2682 @@ var _ = Describe("Container Store", func() {
 						cellID,
 						true,
 						advertisePreferenceForInstanceAddress,
-						fm.Marshal,
+						json.Marshal,
+						nil,
 					)
-				})
 
-				It("releases the info lock", func() {
-					fm.fail = true
-					err := containerStore.Update(logger, updateReq)
-					Expect(err).To(HaveOccurred())
+					metricsConfig := executor.MetricsConfig{Guid: "some-process-guid", Index: 1}
+					runReq.MetricsConfig = metricsConfig
 
-					fm.fail = false
-					err = containerStore.Update(logger, updateReq)
+					crashedGuid := "crashed-guid"
+					_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: crashedGuid})
+					Expect(err).NotTo(HaveOccurred())
+					err = containerStore.Initialize(logger, &executor.RunRequest{
+						Guid:    crashedGuid,
+						RunInfo: executor.RunInfo{MetricsConfig: metricsConfig},
+					})
+					Expect(err).NotTo(HaveOccurred())
+					_, err = containerStore.Create(logger, "some-trace-id", crashedGuid)
 					Expect(err).NotTo(HaveOccurred())
-				})
-			})
 
-			Context("when there is an error updating the log config property on the container", func() {
-				BeforeEach(func() {
-					gardenContainer.SetPropertyReturns(errors.New("some-error"))
-				})
-				It("logs the error", func() {
-					err := containerStore.Update(logger, updateReq)
-					Expect(err).To(HaveOccurred())
+					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						return errors.New("crashed")
+					}), nil)
+					Expect(containerStore.Run(logger, "some-trace-id", crashedGuid)).To(Succeed())
+					Eventually(func() executor.State {
+						container, err := containerStore.Get(logger, crashedGuid)
+						Expect(err).NotTo(HaveOccurred())
+						return container.State
+					}).Should(Equal(executor.StateCompleted))
+					Expect(containerStore.Destroy(logger, "some-trace-id", crashedGuid)).To(Succeed())
 
-					Expect(gardenContainer.SetPropertyCallCount()).To(Equal(1))
-					Expect(logger).To(gbytes.Say("failed-to-set-log-config-property"))
-					Expect(logger).To(gbytes.Say(updateReq.Guid))
-					Expect(logger).To(gbytes.Say("some-error"))
+					containerRunnerCalled = make(chan struct{})
+					runnerCalled := containerRunnerCalled
+					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						close(runnerCalled)
+						<-signals
+						return nil
+					}), nil)
 				})
-			})
 
-			Context("when internal routes are not provided", func() {
-				BeforeEach(func() {
-					updateReq.InternalRoutes = nil
-				})
-				It("does not update container internal routes", func() {
-					err := containerStore.Update(logger, updateReq)
+				It("delays running the action and emits a crash looping event", func() {
+					err := containerStore.Run(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
+					Consistently(containerRunnerCalled).ShouldNot(BeClosed())
 
-					container, err := containerStore.Get(logger, containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(container.InternalRoutes).To(Equal(internalroutes.InternalRoutes{
-						{Hostname: "old.apps.internal"},
-					}))
+					Eventually(func() []executor.EventType {
+						var eventTypes []executor.EventType
+						for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+							eventTypes = append(eventTypes, eventEmitter.EmitArgsForCall(i).EventType())
+						}
+						return eventTypes
+					}).Should(ContainElement(executor.EventTypeContainerCrashLooping))
+					Expect(metronClient.IncrementCounterArgsForCall(metronClient.IncrementCounterCallCount() - 1)).To(Equal(containerstore.ContainerCrashLoopBackoffCount))
+
+					clock.WaitForWatcherAndIncrement(time.Second)
+					Eventually(containerRunnerCalled).Should(BeClosed())
 				})
-				It("does not send a signal to the credmanager to regenerate certs", func() {
-					_, _, regenerateCertsCh := credManager.RunnerArgsForCall(0)
 
-					go func() {
-						err := containerStore.Update(logger, updateReq)
+				Context("when the crashes are older than the window", func() {
+					BeforeEach(func() {
+						clock.Increment(time.Minute)
+					})
+
+					It("runs the action right away", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
 						Expect(err).NotTo(HaveOccurred())
-					}()
-					Consistently(regenerateCertsCh, 100*time.Millisecond).ShouldNot(Receive(Equal(struct{}{})))
+						Eventually(containerRunnerCalled).Should(BeClosed())
+					})
 				})
 			})
 
-			Context("when metric tags are not provided", func() {
+			Context("when the runner fails the initial credential generation", func() {
 				BeforeEach(func() {
-					updateReq.MetricTags = nil
-				})
-
-				It("does not update container metric tags", func() {
-					err := containerStore.Update(logger, updateReq)
-					Expect(err).NotTo(HaveOccurred())
-
-					container, err := containerStore.Get(logger, containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(container.LogConfig.Tags).To(Equal(map[string]string{
-						"old-log-tag": "old-value",
-					}))
-					Expect(container.MetricsConfig.Tags).To(Equal(map[string]string{
-						"old-metrics-tag": "old-value",
+					credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						return errors.New("BOOOM")
 					}))
-
-					Expect(logStreamer.UpdateTagsCallCount()).To(Equal(0))
 				})
 
-				It("does not update the log config property on the container", func() {
-					err := containerStore.Update(logger, updateReq)
+				It("destroys the container and returns an error", func() {
+					err := containerStore.Run(logger, "some-trace-id", containerGuid)
 					Expect(err).NotTo(HaveOccurred())
 
-					Expect(gardenContainer.SetPropertyCallCount()).To(Equal(0))
-				})
-			})
-
-		})
+					Eventually(func() executor.State {
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						return container.State
+					}).Should(Equal(executor.StateCompleted))
+					container, _ := containerStore.Get(logger, containerGuid)
+					Expect(container.RunResult.Failed).To(BeTrue())
+					// make sure the error message is at the end so that
+					// FailureReasonSanitizer can properly map the error messages
+					Expect(container.RunResult.FailureReason).To(MatchRegexp("cred-manager-runner exited: BOOOM$"))
+					Expect(container.RunResult.Retryable).To(BeFalse())
+				})
 
-		Context("when the container does not exist", func() {
-			It("returns an ErrContainerNotFound", func() {
-				updateReq.Guid = "unknown-guid"
-				err := containerStore.Update(logger, updateReq)
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
-			})
-		})
-	})
+				It("tranistions immediately to Completed state", func() {
+					err := containerStore.Run(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
 
-	Describe("Stop", func() {
-		var (
-			runReq *executor.RunRequest
-		)
+					Eventually(func() executor.State {
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						return container.State
+					}).Should(Equal(executor.StateCompleted))
 
-		BeforeEach(func() {
-			var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-				<-signals
-				return nil
-			}
-			runInfo := executor.RunInfo{
-				LogConfig: executor.LogConfig{
-					Guid:       containerGuid,
-					Index:      1,
-					SourceName: "test-source",
-				},
-				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
-			}
-			runReq = &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
-			gardenClient.CreateReturns(gardenContainer, nil)
-			megatron.StepsRunnerReturns(testRunner, nil)
-		})
+					Eventually(func() []string {
+						var events []string
+						for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+							event := eventEmitter.EmitArgsForCall(i)
+							events = append(events, string(event.EventType()))
+						}
+						return events
+					}).Should(ConsistOf("container_reserved", "container_complete"))
+				})
+			})
 
-		JustBeforeEach(func() {
-			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
-			Expect(err).NotTo(HaveOccurred())
+			Context("when instance credential is ready", func() {
+				var (
+					containerRunnerCalled   chan struct{}
+					credManagerRunnerCalled chan struct{}
+				)
 
-			err = containerStore.Initialize(logger, runReq)
-			Expect(err).NotTo(HaveOccurred())
+				BeforeEach(func() {
+					credManagerRunnerCalled = make(chan struct{})
+					cmCalled := credManagerRunnerCalled
+					credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						close(ready)
+						close(cmCalled)
+						<-signals
+						return nil
+					}))
 
-			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
-		})
+					containerRunnerCalled = make(chan struct{})
 
-		Context("when the container has processes associated with it", func() {
-			JustBeforeEach(func() {
-				err := containerStore.Run(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-			})
+					megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						close(containerRunnerCalled)
+						close(ready)
+						<-signals
+						return nil
+					}), nil)
+				})
 
-			It("sets stopped to true on the run result", func() {
-				err := containerStore.Stop(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
+				AfterEach(func() {
+					containerStore.Destroy(logger, "some-trace-id", containerGuid)
+				})
 
-				container, err := containerStore.Get(logger, containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(container.RunResult.Stopped).To(BeTrue())
-				Expect(container.RunResult.Retryable).To(BeFalse())
-			})
+				Context("when the runner fails subsequent credential generation", func() {
+					BeforeEach(func() {
+						credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+							close(ready)
+							select {
+							case <-containerRunnerCalled:
+								return errors.New("BOOOM")
+							case <-signals:
+								return nil
+							}
+						}))
+					})
 
-			It("logs that the container is stopping", func() {
-				err := containerStore.Stop(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(metronClient.SendAppLogCallCount()).To(Equal(3))
-				msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
-				Expect(tags["source_id"]).To(Equal(containerGuid))
-				Expect(sourceType).To(Equal("test-source"))
-				Expect(msg).To(Equal(fmt.Sprintf("Cell %s stopping instance %s", cellID, containerGuid)))
-				Expect(tags["instance_id"]).To(Equal("1"))
-			})
-		})
+					It("destroys the container and returns an error", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-		Context("when the container does not have processes associated with it", func() {
-			It("transitions to the completed state", func() {
-				err := containerStore.Stop(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateCompleted))
+						container, _ := containerStore.Get(logger, containerGuid)
+						Expect(container.RunResult.Failed).To(BeTrue())
+						// make sure the error message is at the end so that
+						// FailureReasonSanitizer can properly map the error messages
+						Expect(container.RunResult.FailureReason).To(MatchRegexp("BOOOM$"))
+						Expect(container.RunResult.Retryable).To(BeFalse())
+					})
+				})
 
-				container, err := containerStore.Get(logger, containerGuid)
-				Expect(err).NotTo(HaveOccurred())
+				Context("when the steps exit", func() {
+					BeforeEach(func() {
+						megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+							_, _, _, _, cfg := megatron.StepsRunnerArgsForCall(0)
+							action := cfg.Timeline.Step("action/run", ifrit.RunFunc(func(<-chan os.Signal, chan<- struct{}) error {
+								return errors.New("exit status 1")
+							}))
+							return action.Run(signals, ready)
+						}), nil)
+					})
 
-				Expect(container.RunResult.Stopped).To(BeTrue())
-				Expect(container.State).To(Equal(executor.StateCompleted))
-				Expect(container.RunResult.Retryable).To(BeFalse())
-			})
-		})
+					It("attaches the timeline of the steps to the run result", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-		Context("when the container does not exist", func() {
-			It("returns an ErrContainerNotFound", func() {
-				err := containerStore.Stop(logger, "some-trace-id", "")
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
-			})
-		})
-	})
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateCompleted))
 
-	Describe("Destroy", func() {
-		var resource executor.Resource
-		var expectedMounts containerstore.BindMounts
-		var runReq *executor.RunRequest
+						container, _ := containerStore.Get(logger, containerGuid)
+						Expect(container.RunResult.Timeline).To(Equal([]executor.StepTiming{
+							{
+								Step:       "action/run",
+								StartedAt:  clock.Now().UnixNano(),
+								FinishedAt: clock.Now().UnixNano(),
+								Failed:     true,
+								Runs:       1,
+							},
+						}))
+					})
+				})
 
-		BeforeEach(func() {
-			runInfo := executor.RunInfo{
-				LogConfig: executor.LogConfig{
-					Guid:       containerGuid,
-					Index:      1,
-					SourceName: "test-source",
-				},
-				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
-			}
-			runReq = &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
-			gardenClient.CreateReturns(gardenContainer, nil)
-			resource = executor.NewResource(1024, 2048, 1024)
-			expectedMounts = containerstore.BindMounts{
-				CacheKeys: []containerstore.BindMountCacheKey{
-					{CacheKey: "cache-key", Dir: "foo"},
-				},
-			}
-			dependencyManager.DownloadCachedDependenciesReturns(expectedMounts, nil)
-		})
+				Context("when the action runs indefinitely", func() {
+					var readyChan chan struct{}
+					BeforeEach(func() {
+						readyChan = make(chan struct{})
+						var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+							readyChan <- struct{}{}
+							close(ready)
+							<-signals
+							return nil
+						}
+						megatron.StepsRunnerReturns(testRunner, nil)
+					})
 
-		JustBeforeEach(func() {
-			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid, Resource: resource})
-			Expect(err).NotTo(HaveOccurred())
+					It("performs the step", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-			err = containerStore.Initialize(logger, runReq)
-			Expect(err).NotTo(HaveOccurred())
+						Expect(megatron.StepsRunnerCallCount()).To(Equal(1))
+						Eventually(readyChan).Should(Receive())
+					})
 
-			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
-		})
+					It("sets the container state to running once the healthcheck passes, and emits a running event", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-		It("cleans up the credentials dir", func() {
-			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(credManager.RemoveCredDirCallCount()).To(Equal(1))
-		})
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.State).To(Equal(executor.StateCreated))
 
-		Context("when there are volumes mounted", func() {
-			BeforeEach(func() {
-				someConfig := map[string]interface{}{"some-config": "interface"}
-				runReq.RunInfo.VolumeMounts = []executor.VolumeMount{
-					executor.VolumeMount{ContainerPath: "cpath1", Driver: "some-driver", VolumeId: "some-volume", Config: someConfig},
-					executor.VolumeMount{ContainerPath: "cpath2", Driver: "some-other-driver", VolumeId: "some-other-volume", Config: someConfig},
-				}
-				count := 0
-				volumeManager.MountStub = // first call mounts at a different point than second call
-					func(lager.Logger, string, string, string, map[string]interface{}) (volman.MountResponse, error) {
-						defer func() { count = count + 1 }()
-						if count == 0 {
-							return volman.MountResponse{Path: "hpath1"}, nil
-						}
-						return volman.MountResponse{Path: "hpath2"}, nil
-					}
-			})
+						Eventually(readyChan).Should(Receive())
 
-			It("removes mounted volumes on the host machine", func() {
-				err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(volumeManager.UnmountCallCount()).To(Equal(2))
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateRunning))
 
-				_, driverId, volumeId, containerId := volumeManager.UnmountArgsForCall(0)
-				Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[0].Driver))
-				Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[0].VolumeId))
-				Expect(containerId).To(Equal(containerGuid))
+						container, err = containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-				_, driverId, volumeId, containerId = volumeManager.UnmountArgsForCall(1)
-				Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[1].Driver))
-				Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[1].VolumeId))
-				Expect(containerId).To(Equal(containerGuid))
-			})
+						Eventually(eventEmitter.EmitCallCount).Should(Equal(2))
+						event := eventEmitter.EmitArgsForCall(1)
+						Expect(event).To(Equal(executor.NewContainerRunningEvent(container, "some-trace-id")))
+					})
 
-			Context("when we fail to release cache dependencies", func() {
-				BeforeEach(func() {
-					dependencyManager.ReleaseCachedDependenciesReturns(errors.New("oh noes!"))
-				})
-				It("still attempts to unmount our volumes", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
-					Expect(volumeManager.UnmountCallCount()).To(Equal(2))
+					It("emits health transition events reported by the health check", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Eventually(readyChan).Should(Receive())
+						Eventually(eventEmitter.EmitCallCount).Should(Equal(2))
 
-					_, driverId, volumeId, containerId := volumeManager.UnmountArgsForCall(0)
-					Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[0].Driver))
-					Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[0].VolumeId))
-					Expect(containerId).To(Equal(containerGuid))
+						_, _, _, _, cfg := megatron.StepsRunnerArgsForCall(0)
+						cfg.HealthTransitions(executor.HealthCheckLiveness, false, time.Minute, "connection refused")
 
-					_, driverId, volumeId, containerId = volumeManager.UnmountArgsForCall(1)
-					Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[1].Driver))
-					Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[1].VolumeId))
-					Expect(containerId).To(Equal(containerGuid))
-				})
-			})
-			Context("when an volume unmount fails", func() {
-				BeforeEach(func() {
-					volumeManager.UnmountReturns(errors.New("oh noes!"))
-				})
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-				It("still attempts to unmount the remaining volumes", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(volumeManager.UnmountCallCount()).To(Equal(2))
-				})
-			})
-			Context("when garden fails to destroy the container", func() {
-				BeforeEach(func() {
-					gardenClient.DestroyReturns(errors.New("destroy failed"))
-				})
-				It("should still unmount the volumes", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(MatchError("destroy failed"))
-					Expect(volumeManager.UnmountCallCount()).To(Equal(2))
-				})
-			})
-		})
+						Eventually(eventEmitter.EmitCallCount).Should(Equal(3))
+						event := eventEmitter.EmitArgsForCall(2)
+						Expect(event).To(Equal(executor.NewContainerHealthTransitionEvent(container, executor.HealthCheckLiveness, false, time.Minute, "connection refused", "some-trace-id")))
+					})
 
-		It("removes downloader cache references", func() {
-			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(dependencyManager.ReleaseCachedDependenciesCallCount()).To(Equal(1))
-			_, keys := dependencyManager.ReleaseCachedDependenciesArgsForCall(0)
-			Expect(keys).To(Equal(expectedMounts.CacheKeys))
-		})
+					It("marks the container unroutable while its readiness is failing", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Eventually(readyChan).Should(Receive())
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateRunning))
 
-		It("destroys the container", func() {
-			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
+						_, _, _, _, cfg := megatron.StepsRunnerArgsForCall(0)
+						cfg.HealthTransitions(executor.HealthCheckReadiness, false, time.Minute, "not ready")
 
-			Expect(gardenClient.DestroyCallCount()).To(Equal(1))
-			Expect(gardenClient.DestroyArgsForCall(0)).To(Equal(containerGuid))
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.Unroutable).To(BeTrue())
+						Eventually(func() []executor.Event {
+							var events []executor.Event
+							for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+								events = append(events, eventEmitter.EmitArgsForCall(i))
+							}
+							return events
+						}).Should(ContainElement(executor.NewContainerRoutabilityEvent(container, "some-trace-id")))
 
-			_, err = containerStore.Get(logger, containerGuid)
-			Expect(err).To(Equal(executor.ErrContainerNotFound))
-		})
+						cfg.HealthTransitions(executor.HealthCheckReadiness, true, time.Minute, "")
 
-		It("emits a metric after destroying the container", func() {
-			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
+						container, err = containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.Unroutable).To(BeFalse())
+					})
+				})
 
-			Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerDestructionSucceededDuration))
-		})
+				Context("when the container has a restart policy", func() {
+					BeforeEach(func() {
+						runReq.RestartPolicy = &executor.RestartPolicy{MaxRestarts: 1, InitialBackoffMs: 1000}
+						megatron.StepsRunnerStub = func(_ lager.Logger, _ executor.Container, _ garden.Container, _ log_streamer.LogStreamer, cfg transformer.Config) (ifrit.Runner, error) {
+							return cfg.ActionMarker.Step(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+								close(ready)
+								return errors.New("crashed")
+							})), nil
+						}
+					})
 
-		It("frees the containers resources", func() {
-			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-			Expect(err).NotTo(HaveOccurred())
+					It("restarts the action in place before completing the container", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-			remainingResources := containerStore.RemainingResources(logger)
-			Expect(remainingResources).To(Equal(totalCapacity))
-		})
+						Eventually(func() []executor.EventType {
+							var types []executor.EventType
+							for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+								types = append(types, eventEmitter.EmitArgsForCall(i).EventType())
+							}
+							return types
+						}).Should(ContainElement(executor.EventTypeContainerRestarted))
+						Expect(megatron.StepsRunnerCallCount()).To(Equal(1))
 
-		Context("when destroying the garden container fails", func() {
-			var destroyErr error
-			BeforeEach(func() {
-				destroyErr = errors.New("failed to destroy garden container")
-			})
+						clock.WaitForWatcherAndIncrement(time.Second)
+						Eventually(megatron.StepsRunnerCallCount).Should(Equal(2))
+						_, _, _, _, cfg := megatron.StepsRunnerArgsForCall(1)
+						Expect(cfg.Restarted).To(BeTrue())
 
-			JustBeforeEach(func() {
-				gardenClient.DestroyReturns(destroyErr)
-			})
+						Eventually(func() executor.State {
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							return container.State
+						}).Should(Equal(executor.StateCompleted))
 
-			Context("because the garden container does not exist", func() {
-				BeforeEach(func() {
-					destroyErr = garden.ContainerNotFoundError{}
-				})
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.Restarts).To(Equal(1))
+						Expect(container.RunResult.Failed).To(BeTrue())
+						Expect(container.RunResult.FailureReason).To(Equal("crashed"))
+						Expect(gardenClient.CreateCallCount()).To(Equal(1))
+					})
 
-				It("does not return an error", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-				})
-			})
+					Context("when the setup of the container fails", func() {
+						BeforeEach(func() {
+							megatron.StepsRunnerStub = nil
+							megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+								return errors.New("download failed")
+							}), nil)
+						})
 
-			Context("because the garden container is already being destroyed", func() {
-				BeforeEach(func() {
-					destroyErr = server.ErrConcurrentDestroy
-				})
+						It("completes the container without restarting it", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
 
-				It("does not return an error", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
+							Eventually(func() executor.State {
+								container, err := containerStore.Get(logger, containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+								return container.State
+							}).Should(Equal(executor.StateCompleted))
+
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(container.Restarts).To(BeZero())
+							Expect(container.RunResult.FailureReason).To(Equal("download failed"))
+							Expect(megatron.StepsRunnerCallCount()).To(Equal(1))
+						})
+					})
 				})
 
-				It("logs the container is destroyed", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(metronClient.SendAppLogCallCount()).To(Equal(4))
-					msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
-					Expect(tags["source_id"]).To(Equal(containerGuid))
-					Expect(sourceType).To(Equal("test-source"))
-					Expect(msg).To(Equal(fmt.Sprintf("Cell %s destroying container for instance %s", cellID, containerGuid)))
-					Expect(tags["instance_id"]).To(Equal("1"))
+				Context("when the container is slow to become healthy", func() {
+					var becomeHealthy chan struct{}
 
-					msg, sourceType, tags = metronClient.SendAppLogArgsForCall(3)
-					Expect(tags["source_id"]).To(Equal(containerGuid))
-					Expect(sourceType).To(Equal("test-source"))
-					Expect(msg).To(Equal(fmt.Sprintf("Cell %s successfully destroyed container for instance %s", cellID, containerGuid)))
-					Expect(tags["instance_id"]).To(Equal("1"))
-				})
-			})
+					BeforeEach(func() {
+						becomeHealthy = make(chan struct{})
+						megatron.StartTimeoutReturns(time.Minute)
+						megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+							select {
+							case <-becomeHealthy:
+								close(ready)
+							case <-signals:
+								return nil
+							}
+							<-signals
+							return nil
+						}), nil)
 
-			Context("for unknown reason", func() {
-				It("returns an error", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(Equal(destroyErr))
-				})
+						containerConfig.StartTimeoutWarningThreshold = 10 * time.Second
+						containerStore = containerstore.New(
+							containerConfig,
+							&totalCapacity,
+							gardenClientFactory,
+							dependencyManager,
+							volumeManager,
+							credManager,
+							logManager,
+							clock,
+							eventEmitter,
+							megatron,
+							"/var/vcap/data/cf-system-trusted-certs",
+							metronClient,
+							rootFSSizer,
+							false,
+							"/var/vcap/packages/healthcheck",
+							proxyManager,
+							cellID,
+							true,
+							advertisePreferenceForInstanceAddress,
+							json.Marshal,
+							nil,
+						)
+					})
 
-				It("emits a metric after failing to destroy the container", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(Equal(destroyErr))
-					Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerDestructionFailedDuration))
-				})
+					It("exposes the remaining start timeout until the container is running", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-				It("does not remove the container from the container store", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(Equal(destroyErr))
+						clock.Increment(20 * time.Second)
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.StartTimeoutRemainingMs).To(BeEquivalentTo(40000))
 
-					Expect(gardenClient.DestroyCallCount()).To(Equal(1))
-					Expect(gardenClient.DestroyArgsForCall(0)).To(Equal(containerGuid))
+						close(becomeHealthy)
+						Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
+						container, err = containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.StartTimeoutRemainingMs).To(BeZero())
+					})
 
-					container, err := containerStore.Get(logger, containerGuid)
-					Expect(err).ToNot(HaveOccurred())
-					Expect(container.Guid).To(Equal(containerGuid))
-				})
+					It("emits a warning once the remaining start timeout reaches the threshold", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).NotTo(HaveOccurred())
 
-				It("does not free up the containers resources", func() {
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(Equal(destroyErr))
+						clock.WaitForWatcherAndIncrement(50 * time.Second)
+						Eventually(func() []executor.EventType {
+							var eventTypes []executor.EventType
+							for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+								eventTypes = append(eventTypes, eventEmitter.EmitArgsForCall(i).EventType())
+							}
+							return eventTypes
+						}).Should(ContainElement(executor.EventTypeContainerStartTimeoutWarning))
 
-					resources := containerStore.RemainingResources(logger)
-					expectedResources := totalCapacity.Copy()
-					expectedResources.Subtract(&resource)
-					Expect(resources).To(Equal(expectedResources))
+						for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+							if warning, ok := eventEmitter.EmitArgsForCall(i).(executor.ContainerStartTimeoutWarningEvent); ok {
+								Expect(warning.Remaining).To(Equal(10 * time.Second))
+								Expect(warning.Container().StartTimeoutRemainingMs).To(BeEquivalentTo(10000))
+							}
+						}
+						close(becomeHealthy)
+					})
 				})
-			})
-		})
 
-		Context("when the container does not exist", func() {
-			It("returns a ErrContainerNotFound", func() {
-				err := containerStore.Destroy(logger, "some-trace-id", "")
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
-			})
-		})
+				Context("when the action exits", func() {
+					var (
+						completeChan chan struct{}
+					)
 
-		Context("when there is a stopped process associated with the container", func() {
-			var (
-				finishRun                  chan struct{}
-				credManagerRunnerSignalled chan struct{}
-				destroyed                  chan struct{}
-			)
+					BeforeEach(func() {
+						completeChan = make(chan struct{})
+					})
 
-			BeforeEach(func() {
-				credManagerRunnerSignalled = make(chan struct{})
-				finishRun = make(chan struct{})
-				finishRunIfrit := finishRun
-				var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-					close(ready)
-					<-signals
-					<-finishRunIfrit
-					return nil
-				}
+					Context("successfully", func() {
+						BeforeEach(func() {
+							var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+								close(ready)
+								<-completeChan
+								return nil
+							}
+							megatron.StepsRunnerReturns(testRunner, nil)
+						})
 
-				signalled := credManagerRunnerSignalled
-				megatron.StepsRunnerReturns(testRunner, nil)
-				credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-					close(ready)
-					<-signals
-					close(signalled)
-					return nil
-				}))
-			})
+						It("sets its state to completed", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
 
-			JustBeforeEach(func() {
-				err := containerStore.Run(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
-				err = containerStore.Stop(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				destroyed = make(chan struct{})
-				go func(ch chan struct{}) {
-					containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					close(ch)
-				}(destroyed)
-			})
+							close(completeChan)
 
-			It("cancels the process", func() {
-				Consistently(destroyed).ShouldNot(Receive())
-				close(finishRun)
-				Eventually(destroyed).Should(BeClosed())
-			})
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
 
-			It("logs that the container is stopping once", func() {
-				close(finishRun)
-				Eventually(destroyed).Should(BeClosed())
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(container.State).To(Equal(executor.StateCompleted))
+						})
 
-				Expect(metronClient.SendAppLogCallCount()).To(Equal(5))
-				msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
-				Expect(tags["source_id"]).To(Equal(containerGuid))
-				Expect(sourceType).To(Equal("test-source"))
-				Expect(msg).To(Equal(fmt.Sprintf("Cell %s stopping instance %s", cellID, containerGuid)))
-				Expect(tags["instance_id"]).To(Equal("1"))
-			})
-		})
+						It("emits a container completed event", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
 
-		Context("when there is a running process associated with the container", func() {
-			var (
-				finishRun                  chan struct{}
-				credManagerRunnerSignalled chan struct{}
-				destroyed                  chan struct{}
-			)
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
+							close(completeChan)
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
 
-			BeforeEach(func() {
-				credManagerRunnerSignalled = make(chan struct{})
-				finishRun = make(chan struct{})
-				finishRunIfrit := finishRun
-				var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
-					close(ready)
-					<-signals
-					<-finishRunIfrit
-					return nil
-				}
+							Expect(eventEmitter.EmitCallCount()).To(Equal(3))
 
-				signalled := credManagerRunnerSignalled
-				megatron.StepsRunnerReturns(testRunner, nil)
-				credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-					close(ready)
-					<-signals
-					close(signalled)
-					return nil
-				}))
-			})
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
 
-			JustBeforeEach(func() {
-				err := containerStore.Run(logger, "some-trace-id", containerGuid)
-				Expect(err).NotTo(HaveOccurred())
-				Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
-				destroyed = make(chan struct{})
-				go func(ch chan struct{}) {
-					containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					close(ch)
-				}(destroyed)
-			})
+							emittedEvents := []executor.Event{}
+							for i := 0; i < eventEmitter.EmitCallCount(); i++ {
+								emittedEvents = append(emittedEvents, eventEmitter.EmitArgsForCall(i))
+							}
 
-			It("cancels the process", func() {
-				Consistently(destroyed).ShouldNot(Receive())
-				close(finishRun)
-				Eventually(destroyed).Should(BeClosed())
-			})
+							Expect(emittedEvents).To(ContainElement(executor.NewContainerCompleteEvent(container, "some-trace-id")))
+						})
 
-			It("signals the cred manager runner", func() {
-				close(finishRun)
-				Eventually(credManagerRunnerSignalled).Should(BeClosed())
-			})
+						It("sets the result on the container", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
 
-			It("logs that the container is stopping", func() {
-				close(finishRun)
-				Eventually(destroyed).Should(BeClosed())
-				Expect(metronClient.SendAppLogCallCount()).To(Equal(5))
-				msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
-				Expect(tags["source_id"]).To(Equal(containerGuid))
-				Expect(sourceType).To(Equal("test-source"))
-				Expect(msg).To(Equal(fmt.Sprintf("Cell %s stopping instance %s", cellID, containerGuid)))
-				Expect(tags["instance_id"]).To(Equal("1"))
-			})
+							close(completeChan)
 
-			Context("when the container credManager config process is running in the container", func() {
-				var (
-					credManagerRunnerSignalled chan struct{}
-				)
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
 
-				BeforeEach(func() {
-					credManagerRunnerSignalled = make(chan struct{})
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(container.RunResult.Failed).To(Equal(false))
+							Expect(container.RunResult.Stopped).To(Equal(false))
+							Expect(container.RunResult.Retryable).To(BeFalse())
+						})
 
-					containerStore = containerstore.New(
-						containerConfig,
-						&totalCapacity,
-						gardenClientFactory,
-						dependencyManager,
-						volumeManager,
-						credManager,
-						logManager,
-						clock,
-						eventEmitter,
-						megatron,
-						"/var/vcap/data/cf-system-trusted-certs",
-						metronClient,
-						rootFSSizer,
-						false,
-						"/var/vcap/packages/healthcheck",
-						proxyManager,
-						cellID,
-						true,
-						advertisePreferenceForInstanceAddress,
-						json.Marshal,
-					)
+						Context("when the container declares result files", func() {
+							BeforeEach(func() {
+								runReq.ResultFiles = []string{"/tmp/results/*.json"}
+
+								buffer := &bytes.Buffer{}
+								tarWriter := tar.NewWriter(buffer)
+								for _, file := range []struct{ name, content string }{
+									{"./summary.json", `{"passed":true}`},
+									{"./ignored.txt", "ignored"},
+								} {
+									Expect(tarWriter.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg})).To(Succeed())
+									_, err := tarWriter.Write([]byte(file.content))
+									Expect(err).NotTo(HaveOccurred())
+								}
+								Expect(tarWriter.Close()).To(Succeed())
+								gardenContainer.StreamOutReturns(ioutil.NopCloser(buffer), nil)
+							})
 
-					signalled := credManagerRunnerSignalled
-					runner := &fake_runner.FakeRunner{}
-					runner.RunStub = ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
-						close(ready)
-						<-signals
-						close(signalled)
-						return nil
+							It("attaches the matching files to the result", func() {
+								err := containerStore.Run(logger, "some-trace-id", containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+
+								close(completeChan)
+
+								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+
+								Expect(gardenContainer.StreamOutCallCount()).To(Equal(1))
+								Expect(gardenContainer.StreamOutArgsForCall(0)).To(Equal(garden.StreamOutSpec{Path: "/tmp/results/", User: "root"}))
+
+								container, err := containerStore.Get(logger, containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+								Expect(container.RunResult.Artifacts).To(Equal([]executor.ResultArtifact{
+									{Path: "/tmp/results/summary.json", Content: []byte(`{"passed":true}`)},
+								}))
+							})
+
+							Context("when the files exceed the size cap", func() {
+								BeforeEach(func() {
+									containerConfig.MaxResultArtifactBytes = 4
+									containerStore = containerstore.New(
+										containerConfig,
+										&totalCapacity,
+										gardenClientFactory,
+										dependencyManager,
+										volumeManager,
+										credManager,
+										logManager,
+										clock,
+										eventEmitter,
+										megatron,
+										"/var/vcap/data/cf-system-trusted-certs",
+										metronClient,
+										rootFSSizer,
+										false,
+										"/var/vcap/packages/healthcheck",
+										proxyManager,
+										cellID,
+										true,
+										advertisePreferenceForInstanceAddress,
+										json.Marshal,
+										nil,
+									)
+								})
+
+								It("truncates the artifacts", func() {
+									err := containerStore.Run(logger, "some-trace-id", containerGuid)
+									Expect(err).NotTo(HaveOccurred())
+
+									close(completeChan)
+
+									Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+
+									container, err := containerStore.Get(logger, containerGuid)
+									Expect(err).NotTo(HaveOccurred())
+									Expect(container.RunResult.Artifacts).To(Equal([]executor.ResultArtifact{
+										{Path: "/tmp/results/summary.json", Content: []byte(`{"pa`), Truncated: true},
+									}))
+								})
+							})
+						})
+
+						It("increments the ContainerCompletedCount metric", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+
+							close(completeChan)
+
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+							Expect(metronClient.IncrementCounterCallCount()).To(Equal(1))
+
+							Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerCompletedCount))
+						})
 					})
-					credManager.RunnerReturns(runner)
-				})
 
-				It("signals the credManager config runner", func() {
-					close(finishRun)
-					Eventually(credManagerRunnerSignalled).Should(BeClosed())
-				})
+					Context("unsuccessfully", func() {
+						BeforeEach(func() {
+							var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+								close(ready)
+								return errors.New("BOOOOM!!!!")
+							}
+							megatron.StepsRunnerReturns(testRunner, nil)
+						})
+
+						It("sets the run result on the container", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+
+							container, err := containerStore.Get(logger, containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(container.RunResult.Failed).To(Equal(true))
+							// make sure the error message is at the end so that
+							// FailureReasonSanitizer can properly map the error messages
+							Expect(container.RunResult.FailureReason).To(MatchRegexp("BOOOOM!!!!$"))
+							Expect(container.RunResult.Stopped).To(Equal(false))
+							Expect(container.RunResult.Retryable).To(BeFalse())
+						})
+
+						It("increments the ContainerCompletedCount metric", func() {
+							err := containerStore.Run(logger, "some-trace-id", containerGuid)
+							Expect(err).NotTo(HaveOccurred())
+
+							Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+							Expect(metronClient.IncrementCounterCallCount()).To(Equal(1))
+
+							Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerCompletedCount))
+						})
+
+						Context("when core dumps are captured", func() {
+							var coreDumpDir string
+
+							BeforeEach(func() {
+								var err error
+								coreDumpDir, err = ioutil.TempDir("", "core_dumps")
+								Expect(err).NotTo(HaveOccurred())
+
+								buffer := &bytes.Buffer{}
+								tarWriter := tar.NewWriter(buffer)
+								for _, file := range []struct{ name, content string }{
+									{"./core.1234", "core contents"},
+									{"./app.log", "ignored"},
+								} {
+									Expect(tarWriter.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg})).To(Succeed())
+									_, err := tarWriter.Write([]byte(file.content))
+									Expect(err).NotTo(HaveOccurred())
+								}
+								Expect(tarWriter.Close()).To(Succeed())
+								gardenContainer.StreamOutReturns(ioutil.NopCloser(buffer), nil)
+
+								containerConfig.CoreDumpDir = coreDumpDir
+								containerConfig.CoreDumpGlobs = []string{"/tmp/cores/core.*"}
+								containerConfig.MaxCoreDumpBytes = 4
+								containerConfig.CoreDumpQuotaBytes = 6
+								containerStore = containerstore.New(
+									containerConfig,
+									&totalCapacity,
+									gardenClientFactory,
+									dependencyManager,
+									volumeManager,
+									credManager,
+									logManager,
+									clock,
+									eventEmitter,
+									megatron,
+									"/var/vcap/data/cf-system-trusted-certs",
+									metronClient,
+									rootFSSizer,
+									false,
+									"/var/vcap/packages/healthcheck",
+									proxyManager,
+									cellID,
+									true,
+									advertisePreferenceForInstanceAddress,
+									json.Marshal,
+									nil,
+								)
+							})
+
+							AfterEach(func() {
+								Expect(os.RemoveAll(coreDumpDir)).To(Succeed())
+							})
+
+							It("copies the truncated core files to the cell and serves them through GetFiles", func() {
+								err := containerStore.Run(logger, "some-trace-id", containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+
+								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+
+								Expect(gardenContainer.StreamOutArgsForCall(0)).To(Equal(garden.StreamOutSpec{Path: "/tmp/cores/", User: "root"}))
+
+								container, err := containerStore.Get(logger, containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+								Expect(container.RunResult.CoreDumps).To(Equal([]string{"core.1234"}))
+
+								stream, err := containerStore.GetFiles(logger, containerGuid, path.Join(executor.CoreDumpsPath, "core.1234"))
+								Expect(err).NotTo(HaveOccurred())
+								defer stream.Close()
+								Expect(gardenContainer.StreamOutCallCount()).To(Equal(1))
+
+								tarReader := tar.NewReader(stream)
+								header, err := tarReader.Next()
+								Expect(err).NotTo(HaveOccurred())
+								Expect(header.Name).To(Equal("core.1234"))
+								content, err := ioutil.ReadAll(tarReader)
+								Expect(err).NotTo(HaveOccurred())
+								Expect(string(content)).To(Equal("core"))
+							})
+
+							Context("when the core dump quota of the cell is used up", func() {
+								BeforeEach(func() {
+									oldDir := filepath.Join(coreDumpDir, "old-guid")
+									Expect(os.MkdirAll(oldDir, 0700)).To(Succeed())
+									Expect(ioutil.WriteFile(filepath.Join(oldDir, "core.1"), []byte("old"), 0600)).To(Succeed())
+								})
+
+								It("evicts the oldest core dumps", func() {
+									err := containerStore.Run(logger, "some-trace-id", containerGuid)
+									Expect(err).NotTo(HaveOccurred())
+
+									Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+
+									Expect(filepath.Join(coreDumpDir, "old-guid", "core.1")).NotTo(BeAnExistingFile())
+									Expect(filepath.Join(coreDumpDir, containerGuid, "core.1234")).To(BeAnExistingFile())
+								})
+							})
+						})
+
+						Context("when run fails with ErrExceededGracefulShutdownInterval", func() {
+							BeforeEach(func() {
+								var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+									close(ready)
+									return new(steps.ExceededGracefulShutdownIntervalError)
+								}
+								megatron.StepsRunnerReturns(testRunner, nil)
+							})
+
+							It("increments the ContainerExitedOnTimeoutCount and ContainerCompletedCount metric", func() {
+								err := containerStore.Run(logger, "some-trace-id", containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+
+								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+								Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+
+								Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerExitedOnTimeoutCount))
+								Expect(metronClient.IncrementCounterArgsForCall(1)).To(Equal(containerstore.ContainerCompletedCount))
+							})
+						})
+
+						Context("when run fails with ErrExitTimeout", func() {
+							BeforeEach(func() {
+								var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+									close(ready)
+									return new(steps.ExitTimeoutError)
+								}
+								megatron.StepsRunnerReturns(testRunner, nil)
+							})
+
+							It("increments the ContainerExitedOnTimeoutCount and ContainerCompletedCount metric", func() {
+								err := containerStore.Run(logger, "some-trace-id", containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+
+								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+								Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+
+								Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerExitedOnTimeoutCount))
+								Expect(metronClient.IncrementCounterArgsForCall(1)).To(Equal(containerstore.ContainerCompletedCount))
+							})
+						})
+
+						Context("when run fails with a complex error that contains a graceful shutdown error", func() {
+							BeforeEach(func() {
+								aggregate := &multierror.Error{}
+								aggregate = multierror.Append(aggregate, errors.New("some-other-error"))
+								aggregate = multierror.Append(aggregate, &steps.ExceededGracefulShutdownIntervalError{})
+								var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+									close(ready)
+									return grouper.ErrorTrace{
+										{
+											Member: grouper.Member{Name: "foo"}, Err: errors.New("foo"),
+										},
+										{
+											Member: grouper.Member{Name: "runner"}, Err: aggregate,
+										},
+									}
+								}
+								megatron.StepsRunnerReturns(testRunner, nil)
+							})
+
+							It("increments the ContainerExitedOnTimeoutCount and ContainerCompletedCount metric", func() {
+								err := containerStore.Run(logger, "some-trace-id", containerGuid)
+								Expect(err).NotTo(HaveOccurred())
+
+								Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+								Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+
+								Expect(metronClient.IncrementCounterArgsForCall(0)).To(Equal(containerstore.ContainerExitedOnTimeoutCount))
+								Expect(metronClient.IncrementCounterArgsForCall(1)).To(Equal(containerstore.ContainerCompletedCount))
+							})
+
+							Context("when there are multiple graceful shutdown exceeded errors", func() {
+								BeforeEach(func() {
+									var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+										close(ready)
+										return grouper.ErrorTrace{
+											{
+												Member: grouper.Member{Name: "runner"}, Err: &multierror.Error{
+													Errors: []error{errors.New("some-other-error"), new(steps.ExitTimeoutError), new(steps.ExceededGracefulShutdownIntervalError)},
+												},
+											},
+										}
+									}
+									megatron.StepsRunnerReturns(testRunner, nil)
+								})
+
+								It("only increments the graceful shutdown exceeded metric once", func() {
+									err := containerStore.Run(logger, "some-trace-id", containerGuid)
+									Expect(err).NotTo(HaveOccurred())
+
+									Eventually(containerState(containerGuid)).Should(Equal(executor.StateCompleted))
+									Expect(metronClient.IncrementCounterCallCount()).To(Equal(2))
+								})
+							})
+						})
+					})
+				})
+
+				Context("when the transformer fails to generate steps", func() {
+					BeforeEach(func() {
+						megatron.StepsRunnerReturns(nil, errors.New("defeated by the auto bots"))
+					})
+
+					It("returns an error", func() {
+						err := containerStore.Run(logger, "some-trace-id", containerGuid)
+						Expect(err).To(HaveOccurred())
+					})
+				})
+			})
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns an ErrContainerNotFound error", func() {
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
+		})
+
+		Context("When the container is not in the created state", func() {
+			JustBeforeEach(func() {
+				_, err := containerStore.Reserve(logger, "some-trace-id", allocationReq)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns a transition error", func() {
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).To(Equal(executor.ErrInvalidTransition))
+			})
+		})
+	})
+
+	Context("when the container creation is hung", func() {
+		var blockCh chan struct{}
+
+		BeforeEach(func() {
+			blockCh = make(chan struct{})
+
+			// avoid race detector warnings
+			ch := blockCh
+			gardenClient.CreateStub = func(garden.ContainerSpec) (garden.Container, error) {
+				<-ch
+				return &gardenfakes.FakeContainer{}, nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+			Expect(err).NotTo(HaveOccurred())
+
+			runInfo := executor.RunInfo{
+				LogConfig: executor.LogConfig{
+					Guid:       containerGuid,
+					Index:      1,
+					SourceName: "test-source",
+				},
+				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
+			}
+			runReq := &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
+			err = containerStore.Initialize(logger, runReq)
+			Expect(err).NotTo(HaveOccurred())
+
+			go containerStore.Create(logger, "some-trace-id", containerGuid)
+			Eventually(gardenClient.CreateCallCount).Should(Equal(1))
+		})
+
+		AfterEach(func() {
+			close(blockCh)
+		})
+
+		Context("when Destroy has been called", func() {
+			JustBeforeEach(func() {
+				blockCh := make(chan error)
+				go func() {
+					blockCh <- containerStore.Destroy(logger, "some-trace-id", containerGuid)
+				}()
+				Consistently(blockCh, time.Second).ShouldNot(Receive())
+			})
+
+			It("should return immediately", func() {
+				errCh := make(chan error)
+				go func() {
+					errCh <- containerStore.Destroy(logger, "some-trace-id", containerGuid)
+				}()
+				Eventually(errCh).Should(Receive(BeNil()))
+			})
+		})
+
+		Context("when Stop has been called and is hanging", func() {
+			JustBeforeEach(func() {
+				blockCh := make(chan error)
+				go func() {
+					blockCh <- containerStore.Stop(logger, "some-trace-id", containerGuid)
+				}()
+				Consistently(blockCh, time.Second).ShouldNot(Receive())
+			})
+
+			It("should return immediately", func() {
+				errCh := make(chan error)
+				go func() {
+					errCh <- containerStore.Stop(logger, "some-trace-id", containerGuid)
+				}()
+				Eventually(errCh).Should(Receive(BeNil()))
+			})
+		})
+	})
+
+	Describe("Update", func() {
+		var (
+			runReq         *executor.RunRequest
+			updateReq      *executor.UpdateRequest
+			internalRoutes internalroutes.InternalRoutes
+			metricTags     map[string]string
+		)
+
+		BeforeEach(func() {
+			var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+				<-signals
+				return nil
+			}
+			runInfo := executor.RunInfo{
+				LogConfig: executor.LogConfig{
+					Guid:       containerGuid,
+					Index:      1,
+					SourceName: "test-source",
+					Tags: map[string]string{
+						"old-log-tag": "old-value",
+					},
+				},
+				MetricsConfig: executor.MetricsConfig{
+					Guid:  containerGuid,
+					Index: 1,
+					Tags: map[string]string{
+						"old-metrics-tag": "old-value",
+					},
+				},
+				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
+				InternalRoutes: internalroutes.InternalRoutes{
+					{Hostname: "old.apps.internal"},
+				},
+			}
+			runReq = &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
+			gardenClient.CreateReturns(gardenContainer, nil)
+			megatron.StepsRunnerReturns(testRunner, nil)
+			internalRoutes = internalroutes.InternalRoutes{
+				{Hostname: "a.apps.internal"},
+				{Hostname: "b.apps.internal"},
+			}
+			metricTags = map[string]string{"some-tag": "some-value"}
+			updateReq = &executor.UpdateRequest{Guid: containerGuid, InternalRoutes: internalRoutes, MetricTags: metricTags}
+		})
+
+		JustBeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = containerStore.Initialize(logger, runReq)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the container exists", func() {
+			JustBeforeEach(func() {
+
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("updates container internal routes", func() {
+				err := containerStore.Update(logger, updateReq)
+				Expect(err).NotTo(HaveOccurred())
+
+				container, err := containerStore.Get(logger, containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.InternalRoutes).To(Equal(internalRoutes))
+			})
+
+			It("sends a signal to the credmanager to regenerate certs", func() {
+				_, _, regenerateCertsCh := credManager.RunnerArgsForCall(0)
+
+				go func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+				}()
+				Eventually(regenerateCertsCh).Should(Receive(Equal(struct{}{})))
+			})
+
+			It("updates metric tags", func() {
+				err := containerStore.Update(logger, updateReq)
+				Expect(err).NotTo(HaveOccurred())
+
+				container, err := containerStore.Get(logger, containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.MetricsConfig.Tags).To(Equal(metricTags))
+			})
+
+			It("updates log tags and the logStreamer", func() {
+				err := containerStore.Update(logger, updateReq)
+				Expect(err).NotTo(HaveOccurred())
+
+				container, err := containerStore.Get(logger, containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.LogConfig.Tags).To(Equal(metricTags))
+
+				Expect(logStreamer.UpdateTagsArgsForCall(0)).To(Equal(metricTags))
+			})
+
+			It("updates the log config property on the container", func() {
+				err := containerStore.Update(logger, updateReq)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(gardenContainer.SetPropertyCallCount()).To(Equal(1))
+				name, value := gardenContainer.SetPropertyArgsForCall(0)
+				Expect(name).To(Equal("log_config"))
+
+				var parsedValue map[string]interface{}
+				err = json.Unmarshal([]byte(value), &parsedValue)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsedValue["guid"]).To(Equal("container-guid"))
+				Expect(parsedValue["index"]).To(Equal(1.0))
+				Expect(parsedValue["source_name"]).To(Equal("test-source"))
+				Expect(parsedValue["tags"]).To(Equal(map[string]interface{}{"some-tag": "some-value"}))
+			})
+
+			Context("when egress rules are provided", func() {
+				var egressRule *models.SecurityGroupRule
+
+				BeforeEach(func() {
+					egressRule = &models.SecurityGroupRule{
+						Protocol:     models.TCPProtocol,
+						Destinations: []string{"1.1.1.1"},
+						Ports:        []uint32{443},
+					}
+					updateReq.EgressRules = []*models.SecurityGroupRule{egressRule}
+				})
+
+				It("applies the rules to the garden container", func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(gardenContainer.BulkNetOutCallCount()).To(Equal(1))
+					Expect(gardenContainer.BulkNetOutArgsForCall(0)).To(Equal([]garden.NetOutRule{{
+						Protocol: garden.ProtocolTCP,
+						Networks: []garden.IPRange{{Start: net.ParseIP("1.1.1.1"), End: net.ParseIP("1.1.1.1")}},
+						Ports:    []garden.PortRange{garden.PortRangeFromPort(443)},
+					}}))
+				})
+
+				It("records the rules on the container", func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.EgressRules).To(ConsistOf(egressRule))
+				})
+
+				Context("when a rule is invalid", func() {
+					BeforeEach(func() {
+						egressRule.Destinations = nil
+					})
+
+					It("returns an error without applying any rule", func() {
+						err := containerStore.Update(logger, updateReq)
+						Expect(err).To(HaveOccurred())
+						Expect(gardenContainer.BulkNetOutCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("when garden fails to apply the rules", func() {
+					BeforeEach(func() {
+						gardenContainer.BulkNetOutReturns(errors.New("boom"))
+					})
+
+					It("returns the error and does not record the rules", func() {
+						err := containerStore.Update(logger, updateReq)
+						Expect(err).To(MatchError("boom"))
+
+						container, err := containerStore.Get(logger, containerGuid)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(container.EgressRules).To(BeEmpty())
+					})
+				})
+			})
+
+			Context("when Update is called concurrently", func() {
+				JustBeforeEach(func() {
+					updateReq.InternalRoutes = nil
+				})
+				It("locks access to the container info", func() {
+					var wg sync.WaitGroup
+					wg.Add(2)
+					go func() {
+						err := containerStore.Update(logger, updateReq)
+						Expect(err).NotTo(HaveOccurred())
+						wg.Done()
+					}()
+					go func() {
+						err := containerStore.Update(logger, updateReq)
+						Expect(err).NotTo(HaveOccurred())
+						wg.Done()
+					}()
+					wg.Wait()
+				})
+			})
+
+			Context("when the log config cannot be serialized", func() {
+				var fm failingMarshaller
+
+				BeforeEach(func() {
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						fm.Marshal,
+						nil,
+					)
+				})
+
+				It("releases the info lock", func() {
+					fm.fail = true
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).To(HaveOccurred())
+
+					fm.fail = false
+					err = containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("when there is an error updating the log config property on the container", func() {
+				BeforeEach(func() {
+					gardenContainer.SetPropertyReturns(errors.New("some-error"))
+				})
+				It("logs the error", func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).To(HaveOccurred())
+
+					Expect(gardenContainer.SetPropertyCallCount()).To(Equal(1))
+					Expect(logger).To(gbytes.Say("failed-to-set-log-config-property"))
+					Expect(logger).To(gbytes.Say(updateReq.Guid))
+					Expect(logger).To(gbytes.Say("some-error"))
+				})
+			})
+
+			Context("when internal routes are not provided", func() {
+				BeforeEach(func() {
+					updateReq.InternalRoutes = nil
+				})
+				It("does not update container internal routes", func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.InternalRoutes).To(Equal(internalroutes.InternalRoutes{
+						{Hostname: "old.apps.internal"},
+					}))
+				})
+				It("does not send a signal to the credmanager to regenerate certs", func() {
+					_, _, regenerateCertsCh := credManager.RunnerArgsForCall(0)
+
+					go func() {
+						err := containerStore.Update(logger, updateReq)
+						Expect(err).NotTo(HaveOccurred())
+					}()
+					Consistently(regenerateCertsCh, 100*time.Millisecond).ShouldNot(Receive(Equal(struct{}{})))
+				})
+			})
+
+			Context("when metric tags are not provided", func() {
+				BeforeEach(func() {
+					updateReq.MetricTags = nil
+				})
+
+				It("does not update container metric tags", func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(container.LogConfig.Tags).To(Equal(map[string]string{
+						"old-log-tag": "old-value",
+					}))
+					Expect(container.MetricsConfig.Tags).To(Equal(map[string]string{
+						"old-metrics-tag": "old-value",
+					}))
+
+					Expect(logStreamer.UpdateTagsCallCount()).To(Equal(0))
+				})
+
+				It("does not update the log config property on the container", func() {
+					err := containerStore.Update(logger, updateReq)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(gardenContainer.SetPropertyCallCount()).To(Equal(0))
+				})
+			})
+
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns an ErrContainerNotFound", func() {
+				updateReq.Guid = "unknown-guid"
+				err := containerStore.Update(logger, updateReq)
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
+		})
+	})
+
+	Describe("Stop", func() {
+		var (
+			runReq *executor.RunRequest
+		)
+
+		BeforeEach(func() {
+			var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+				<-signals
+				return nil
+			}
+			runInfo := executor.RunInfo{
+				LogConfig: executor.LogConfig{
+					Guid:       containerGuid,
+					Index:      1,
+					SourceName: "test-source",
+				},
+				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
+			}
+			runReq = &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
+			gardenClient.CreateReturns(gardenContainer, nil)
+			megatron.StepsRunnerReturns(testRunner, nil)
+		})
+
+		JustBeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = containerStore.Initialize(logger, runReq)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the container has processes associated with it", func() {
+			JustBeforeEach(func() {
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("sets stopped to true on the run result", func() {
+				err := containerStore.Stop(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+
+				container, err := containerStore.Get(logger, containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.RunResult.Stopped).To(BeTrue())
+				Expect(container.RunResult.Retryable).To(BeFalse())
+			})
+
+			It("logs that the container is stopping", func() {
+				err := containerStore.Stop(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metronClient.SendAppLogCallCount()).To(Equal(3))
+				msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
+				Expect(tags["source_id"]).To(Equal(containerGuid))
+				Expect(sourceType).To(Equal("test-source"))
+				Expect(msg).To(Equal(fmt.Sprintf("Cell %s stopping instance %s", cellID, containerGuid)))
+				Expect(tags["instance_id"]).To(Equal("1"))
+			})
+		})
+
+		Context("when the container does not have processes associated with it", func() {
+			It("transitions to the completed state", func() {
+				err := containerStore.Stop(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+
+				container, err := containerStore.Get(logger, containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(container.RunResult.Stopped).To(BeTrue())
+				Expect(container.State).To(Equal(executor.StateCompleted))
+				Expect(container.RunResult.Retryable).To(BeFalse())
+			})
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns an ErrContainerNotFound", func() {
+				err := containerStore.Stop(logger, "some-trace-id", "")
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
+		})
+	})
+
+	Describe("Destroy", func() {
+		var resource executor.Resource
+		var expectedMounts containerstore.BindMounts
+		var runReq *executor.RunRequest
+
+		BeforeEach(func() {
+			runInfo := executor.RunInfo{
+				LogConfig: executor.LogConfig{
+					Guid:       containerGuid,
+					Index:      1,
+					SourceName: "test-source",
+				},
+				LogRateLimitBytesPerSecond: logRateUnlimitedBytesPerSecond,
+			}
+			runReq = &executor.RunRequest{Guid: containerGuid, RunInfo: runInfo}
+			gardenClient.CreateReturns(gardenContainer, nil)
+			resource = executor.NewResource(1024, 2048, 1024)
+			expectedMounts = containerstore.BindMounts{
+				CacheKeys: []containerstore.BindMountCacheKey{
+					{CacheKey: "cache-key", Dir: "foo"},
+				},
+			}
+			dependencyManager.DownloadCachedDependenciesReturns(expectedMounts, nil)
+		})
+
+		JustBeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid, Resource: resource})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = containerStore.Initialize(logger, runReq)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("cleans up the credentials dir", func() {
+			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credManager.RemoveCredDirCallCount()).To(Equal(1))
+		})
+
+		Context("when there are volumes mounted", func() {
+			BeforeEach(func() {
+				someConfig := map[string]interface{}{"some-config": "interface"}
+				runReq.RunInfo.VolumeMounts = []executor.VolumeMount{
+					executor.VolumeMount{ContainerPath: "cpath1", Driver: "some-driver", VolumeId: "some-volume", Config: someConfig},
+					executor.VolumeMount{ContainerPath: "cpath2", Driver: "some-other-driver", VolumeId: "some-other-volume", Config: someConfig},
+				}
+				count := 0
+				volumeManager.MountStub = // first call mounts at a different point than second call
+					func(lager.Logger, string, string, string, map[string]interface{}) (volman.MountResponse, error) {
+						defer func() { count = count + 1 }()
+						if count == 0 {
+							return volman.MountResponse{Path: "hpath1"}, nil
+						}
+						return volman.MountResponse{Path: "hpath2"}, nil
+					}
+			})
+
+			It("removes mounted volumes on the host machine", func() {
+				err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(volumeManager.UnmountCallCount()).To(Equal(2))
+
+				_, driverId, volumeId, containerId := volumeManager.UnmountArgsForCall(0)
+				Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[0].Driver))
+				Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[0].VolumeId))
+				Expect(containerId).To(Equal(containerGuid))
+
+				_, driverId, volumeId, containerId = volumeManager.UnmountArgsForCall(1)
+				Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[1].Driver))
+				Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[1].VolumeId))
+				Expect(containerId).To(Equal(containerGuid))
+			})
+
+			Context("when we fail to release cache dependencies", func() {
+				BeforeEach(func() {
+					dependencyManager.ReleaseCachedDependenciesReturns(errors.New("oh noes!"))
+				})
+				It("still attempts to unmount our volumes", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
+					Expect(volumeManager.UnmountCallCount()).To(Equal(2))
+
+					_, driverId, volumeId, containerId := volumeManager.UnmountArgsForCall(0)
+					Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[0].Driver))
+					Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[0].VolumeId))
+					Expect(containerId).To(Equal(containerGuid))
+
+					_, driverId, volumeId, containerId = volumeManager.UnmountArgsForCall(1)
+					Expect(driverId).To(Equal(runReq.RunInfo.VolumeMounts[1].Driver))
+					Expect(volumeId).To(Equal(runReq.RunInfo.VolumeMounts[1].VolumeId))
+					Expect(containerId).To(Equal(containerGuid))
+				})
+			})
+			Context("when an volume unmount fails", func() {
+				BeforeEach(func() {
+					volumeManager.UnmountReturns(errors.New("oh noes!"))
+				})
+
+				It("still attempts to unmount the remaining volumes", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(volumeManager.UnmountCallCount()).To(Equal(2))
+				})
+			})
+			Context("when garden fails to destroy the container", func() {
+				BeforeEach(func() {
+					gardenClient.DestroyReturns(errors.New("destroy failed"))
+				})
+				It("should still unmount the volumes", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(MatchError("destroy failed"))
+					Expect(volumeManager.UnmountCallCount()).To(Equal(2))
+				})
+			})
+		})
+
+		It("removes downloader cache references", func() {
+			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dependencyManager.ReleaseCachedDependenciesCallCount()).To(Equal(1))
+			_, keys := dependencyManager.ReleaseCachedDependenciesArgsForCall(0)
+			Expect(keys).To(Equal(expectedMounts.CacheKeys))
+		})
+
+		It("destroys the container", func() {
+			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+			Expect(gardenClient.DestroyArgsForCall(0)).To(Equal(containerGuid))
+
+			_, err = containerStore.Get(logger, containerGuid)
+			Expect(err).To(Equal(executor.ErrContainerNotFound))
+		})
+
+		It("emits a metric after destroying the container", func() {
+			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerDestructionSucceededDuration))
+		})
+
+		It("frees the containers resources", func() {
+			err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			remainingResources := containerStore.RemainingResources(logger)
+			Expect(remainingResources).To(Equal(totalCapacity))
+		})
+
+		Context("when destroying the garden container fails", func() {
+			var destroyErr error
+			BeforeEach(func() {
+				destroyErr = errors.New("failed to destroy garden container")
+			})
+
+			JustBeforeEach(func() {
+				gardenClient.DestroyReturns(destroyErr)
+			})
+
+			Context("because the garden container does not exist", func() {
+				BeforeEach(func() {
+					destroyErr = garden.ContainerNotFoundError{}
+				})
+
+				It("does not return an error", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			Context("because the garden container is already being destroyed", func() {
+				BeforeEach(func() {
+					destroyErr = server.ErrConcurrentDestroy
+				})
+
+				It("does not return an error", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("logs the container is destroyed", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(metronClient.SendAppLogCallCount()).To(Equal(4))
+					msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
+					Expect(tags["source_id"]).To(Equal(containerGuid))
+					Expect(sourceType).To(Equal("test-source"))
+					Expect(msg).To(Equal(fmt.Sprintf("Cell %s destroying container for instance %s", cellID, containerGuid)))
+					Expect(tags["instance_id"]).To(Equal("1"))
+
+					msg, sourceType, tags = metronClient.SendAppLogArgsForCall(3)
+					Expect(tags["source_id"]).To(Equal(containerGuid))
+					Expect(sourceType).To(Equal("test-source"))
+					Expect(msg).To(Equal(fmt.Sprintf("Cell %s successfully destroyed container for instance %s", cellID, containerGuid)))
+					Expect(tags["instance_id"]).To(Equal("1"))
+				})
+			})
+
+			Context("for unknown reason", func() {
+				It("returns an error", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(Equal(destroyErr))
+				})
+
+				It("emits a metric after failing to destroy the container", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(Equal(destroyErr))
+					Eventually(getMetrics).Should(HaveKey(containerstore.GardenContainerDestructionFailedDuration))
+				})
+
+				It("does not remove the container from the container store", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(Equal(destroyErr))
+
+					Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+					Expect(gardenClient.DestroyArgsForCall(0)).To(Equal(containerGuid))
+
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(container.Guid).To(Equal(containerGuid))
+				})
+
+				It("does not free up the containers resources", func() {
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(Equal(destroyErr))
+
+					resources := containerStore.RemainingResources(logger)
+					expectedResources := totalCapacity.Copy()
+					expectedResources.Subtract(&resource)
+					Expect(resources).To(Equal(expectedResources))
+				})
+			})
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns a ErrContainerNotFound", func() {
+				err := containerStore.Destroy(logger, "some-trace-id", "")
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
+		})
+
+		Context("when there is a stopped process associated with the container", func() {
+			var (
+				finishRun                  chan struct{}
+				credManagerRunnerSignalled chan struct{}
+				destroyed                  chan struct{}
+			)
+
+			BeforeEach(func() {
+				credManagerRunnerSignalled = make(chan struct{})
+				finishRun = make(chan struct{})
+				finishRunIfrit := finishRun
+				var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+					close(ready)
+					<-signals
+					<-finishRunIfrit
+					return nil
+				}
+
+				signalled := credManagerRunnerSignalled
+				megatron.StepsRunnerReturns(testRunner, nil)
+				credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+					close(ready)
+					<-signals
+					close(signalled)
+					return nil
+				}))
+			})
+
+			JustBeforeEach(func() {
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
+				err = containerStore.Stop(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				destroyed = make(chan struct{})
+				go func(ch chan struct{}) {
+					containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					close(ch)
+				}(destroyed)
+			})
+
+			It("cancels the process", func() {
+				Consistently(destroyed).ShouldNot(Receive())
+				close(finishRun)
+				Eventually(destroyed).Should(BeClosed())
+			})
+
+			It("logs that the container is stopping once", func() {
+				close(finishRun)
+				Eventually(destroyed).Should(BeClosed())
+
+				Expect(metronClient.SendAppLogCallCount()).To(Equal(5))
+				msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
+				Expect(tags["source_id"]).To(Equal(containerGuid))
+				Expect(sourceType).To(Equal("test-source"))
+				Expect(msg).To(Equal(fmt.Sprintf("Cell %s stopping instance %s", cellID, containerGuid)))
+				Expect(tags["instance_id"]).To(Equal("1"))
+			})
+		})
+
+		Context("when there is a running process associated with the container", func() {
+			var (
+				finishRun                  chan struct{}
+				credManagerRunnerSignalled chan struct{}
+				destroyed                  chan struct{}
+			)
+
+			BeforeEach(func() {
+				credManagerRunnerSignalled = make(chan struct{})
+				finishRun = make(chan struct{})
+				finishRunIfrit := finishRun
+				var testRunner ifrit.RunFunc = func(signals <-chan os.Signal, ready chan<- struct{}) error {
+					close(ready)
+					<-signals
+					<-finishRunIfrit
+					return nil
+				}
+
+				signalled := credManagerRunnerSignalled
+				megatron.StepsRunnerReturns(testRunner, nil)
+				credManager.RunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+					close(ready)
+					<-signals
+					close(signalled)
+					return nil
+				}))
+			})
+
+			JustBeforeEach(func() {
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
+				destroyed = make(chan struct{})
+				go func(ch chan struct{}) {
+					containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					close(ch)
+				}(destroyed)
+			})
+
+			It("cancels the process", func() {
+				Consistently(destroyed).ShouldNot(Receive())
+				close(finishRun)
+				Eventually(destroyed).Should(BeClosed())
+			})
+
+			It("signals the cred manager runner", func() {
+				close(finishRun)
+				Eventually(credManagerRunnerSignalled).Should(BeClosed())
+			})
+
+			It("logs that the container is stopping", func() {
+				close(finishRun)
+				Eventually(destroyed).Should(BeClosed())
+				Expect(metronClient.SendAppLogCallCount()).To(Equal(5))
+				msg, sourceType, tags := metronClient.SendAppLogArgsForCall(2)
+				Expect(tags["source_id"]).To(Equal(containerGuid))
+				Expect(sourceType).To(Equal("test-source"))
+				Expect(msg).To(Equal(fmt.Sprintf("Cell %s stopping instance %s", cellID, containerGuid)))
+				Expect(tags["instance_id"]).To(Equal("1"))
+			})
+
+			Context("when the container credManager config process is running in the container", func() {
+				var (
+					credManagerRunnerSignalled chan struct{}
+				)
+
+				BeforeEach(func() {
+					credManagerRunnerSignalled = make(chan struct{})
+
+					containerStore = containerstore.New(
+						containerConfig,
+						&totalCapacity,
+						gardenClientFactory,
+						dependencyManager,
+						volumeManager,
+						credManager,
+						logManager,
+						clock,
+						eventEmitter,
+						megatron,
+						"/var/vcap/data/cf-system-trusted-certs",
+						metronClient,
+						rootFSSizer,
+						false,
+						"/var/vcap/packages/healthcheck",
+						proxyManager,
+						cellID,
+						true,
+						advertisePreferenceForInstanceAddress,
+						json.Marshal,
+						nil,
+					)
+
+					signalled := credManagerRunnerSignalled
+					runner := &fake_runner.FakeRunner{}
+					runner.RunStub = ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+						close(ready)
+						<-signals
+						close(signalled)
+						return nil
+					})
+					credManager.RunnerReturns(runner)
+				})
+
+				It("signals the credManager config runner", func() {
+					close(finishRun)
+					Eventually(credManagerRunnerSignalled).Should(BeClosed())
+				})
+			})
+		})
+
+		Context("when IP retention is enabled", func() {
+			BeforeEach(func() {
+				containerConfig.IPRetentionWindow = time.Minute
+				containerStore = containerstore.New(
+					containerConfig,
+					&totalCapacity,
+					gardenClientFactory,
+					dependencyManager,
+					volumeManager,
+					credManager,
+					logManager,
+					clock,
+					eventEmitter,
+					megatron,
+					"/var/vcap/data/cf-system-trusted-certs",
+					metronClient,
+					rootFSSizer,
+					false,
+					"/var/vcap/packages/healthcheck",
+					proxyManager,
+					cellID,
+					true,
+					advertisePreferenceForInstanceAddress,
+					json.Marshal,
+					nil,
+				)
+				gardenContainer.InfoReturns(garden.ContainerInfo{ContainerIP: "10.255.0.7"}, nil)
+			})
+
+			recreate := func() garden.ContainerSpec {
+				_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid, Resource: resource})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(containerStore.Initialize(logger, runReq)).To(Succeed())
+				_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				return gardenClient.CreateArgsForCall(gardenClient.CreateCallCount() - 1)
+			}
+
+			It("does not request an IP for the first container", func() {
+				Expect(gardenClient.CreateArgsForCall(0).Properties).NotTo(HaveKey(executor.ContainerRequestedIPProperty))
+			})
+
+			It("requests the previous IP when the container is recreated within the window", func() {
+				Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+				clock.Increment(59 * time.Second)
+
+				spec := recreate()
+				Expect(spec.Properties).To(HaveKeyWithValue(executor.ContainerRequestedIPProperty, "10.255.0.7"))
+			})
+
+			It("does not request the previous IP once the window has passed", func() {
+				Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+				clock.Increment(time.Minute)
+
+				spec := recreate()
+				Expect(spec.Properties).NotTo(HaveKey(executor.ContainerRequestedIPProperty))
+			})
+
+			It("does not request the IP for containers with another guid", func() {
+				Expect(containerStore.Destroy(logger, "some-trace-id", containerGuid)).To(Succeed())
+
+				containerGuid = "other-container-guid"
+				runReq.Guid = containerGuid
+				spec := recreate()
+				Expect(spec.Properties).NotTo(HaveKey(executor.ContainerRequestedIPProperty))
+			})
+		})
+
+		Context("when there are no process associated with the container", func() {
+			Context("when container is in completed state", func() {
+				JustBeforeEach(func() {
+					destroyErr := errors.New("failed-to-destroy-container")
+					gardenClient.DestroyReturns(destroyErr)
+					eventEmitter.EmitStub = func(e executor.Event) {
+						// processing completed container
+						defer GinkgoRecover()
+						if e.EventType() == executor.EventTypeContainerComplete {
+							// sleeping to avoid atomic destroying state
+							time.Sleep(time.Second)
+							err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+							Expect(err).To(HaveOccurred())
+						}
+					}
+				})
+
+				It("does not emit the completed event", func() {
+					// completed event will trigger Destroy for failed completed container and that will cause an infinite loop
+					Eventually(eventEmitter.EmitCallCount).Should(Equal(1))
+					event1 := eventEmitter.EmitArgsForCall(0)
+					Expect(event1.EventType()).To(Equal(executor.EventTypeContainerReserved))
+
+					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
+					Expect(err).To(HaveOccurred())
+
+					container, err := containerStore.Get(logger, containerGuid)
+					Expect(err).NotTo(HaveOccurred())
+
+					Eventually(eventEmitter.EmitCallCount).Should(Equal(2))
+					event2 := eventEmitter.EmitArgsForCall(1)
+					Expect(event2).To(Equal(executor.NewContainerCompleteEvent(container, "some-trace-id")))
+
+					Consistently(eventEmitter.EmitCallCount).Should(Equal(2))
+				})
+			})
+		})
+	})
+
+	Describe("Get", func() {
+		BeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the specified container", func() {
+			container, err := containerStore.Get(logger, containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(container.Guid).To(Equal(containerGuid))
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns an ErrContainerNotFound", func() {
+				_, err := containerStore.Get(logger, "")
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
+		})
+	})
+
+	Describe("List", func() {
+		var container1, container2 executor.Container
+
+		BeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+
+			Expect(err).NotTo(HaveOccurred())
+
+			err = containerStore.Initialize(logger, &executor.RunRequest{
+				Guid: containerGuid,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{
+				Guid: containerGuid + "2",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			container1, err = containerStore.Get(logger, containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			container2, err = containerStore.Get(logger, containerGuid+"2")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the list of known containers", func() {
+			containers := containerStore.List(logger)
+			Expect(containers).To(HaveLen(2))
+			Expect(containers).To(ContainElement(container1))
+			Expect(containers).To(ContainElement(container2))
+		})
+	})
+
+	reserveContainer := func(guid string) {
+		resource := executor.Resource{
+			MemoryMB: 10,
+			DiskMB:   10,
+		}
+		tags := executor.Tags{}
+		_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: guid, Tags: tags, Resource: resource})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	initializeContainer := func(guid string, rootFSPath string) {
+		runInfo := executor.RunInfo{
+			RootFSPath:         rootFSPath,
+			CPUWeight:          2,
+			StartTimeoutMs:     50000,
+			Privileged:         true,
+			CachedDependencies: []executor.CachedDependency{},
+			LogConfig: executor.LogConfig{
+				Guid:       "log-guid",
+				Index:      1,
+				SourceName: "test-source",
+			},
+			MetricsConfig: executor.MetricsConfig{
+				Guid:  "metric-guid",
+				Index: 1,
+			},
+			Env:                           []executor.EnvironmentVariable{},
+			TrustedSystemCertificatesPath: "",
+			Network: &executor.Network{
+				Properties: map[string]string{},
+			},
+		}
+
+		req := &executor.RunRequest{
+			Guid:    guid,
+			RunInfo: runInfo,
+			Tags:    executor.Tags{},
+		}
+
+		err := containerStore.Initialize(logger, req)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Describe("Metrics", func() {
+		var (
+			containerGuid1, containerGuid2, containerGuid3, containerGuid4 string
+			containerGuid5, containerGuid6                                 string
+		)
+
+		BeforeEach(func() {
+			rootFSSizer.RootFSSizeFromPathStub = func(path string) uint64 {
+				switch path {
+				case "/foo/bar":
+					return 1000
+				default:
+					return 0
+				}
+			}
+
+			containerGuid1 = "container-guid-1"
+			containerGuid2 = "container-guid-2"
+			containerGuid3 = "container-guid-3"
+			containerGuid4 = "container-guid-4"
+			containerGuid5 = "container-guid-5"
+			containerGuid6 = "container-guid-6"
+
+			reserveContainer(containerGuid1)
+			reserveContainer(containerGuid2)
+			reserveContainer(containerGuid3)
+			reserveContainer(containerGuid4)
+			reserveContainer(containerGuid5)
+			reserveContainer(containerGuid6)
+
+			initializeContainer(containerGuid1, "/foo/bar")
+			initializeContainer(containerGuid2, "docker://repo")
+			initializeContainer(containerGuid3, "/foo/bar")
+			initializeContainer(containerGuid4, "/foo/bar")
+
+			gardenContainer.InfoReturns(garden.ContainerInfo{ExternalIP: "6.6.6.6"}, nil)
+			gardenClient.CreateReturns(gardenContainer, nil)
+			_, err := containerStore.Create(logger, "some-trace-id", containerGuid1)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid2)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid3)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid4)
+			Expect(err).ToNot(HaveOccurred())
+
+			bulkMetrics := map[string]garden.ContainerMetricsEntry{
+				containerGuid1: garden.ContainerMetricsEntry{
+					Metrics: garden.Metrics{
+						MemoryStat: garden.ContainerMemoryStat{
+							TotalUsageTowardLimit: 1024,
+							TotalSwap:             64,
+						},
+						DiskStat: garden.ContainerDiskStat{
+							TotalBytesUsed: uint64(1000 + 2048),
+						},
+						CPUStat: garden.ContainerCPUStat{
+							Usage: 5000000000,
+						},
+						Age:            1000000000,
+						CPUEntitlement: 100,
+					},
+				},
+				containerGuid2: garden.ContainerMetricsEntry{
+					Metrics: garden.Metrics{
+						MemoryStat: garden.ContainerMemoryStat{
+							TotalUsageTowardLimit: 512,
+						},
+						DiskStat: garden.ContainerDiskStat{
+							TotalBytesUsed: 256,
+						},
+						CPUStat: garden.ContainerCPUStat{
+							Usage: 1000000,
+						},
+						Age:            2000000000,
+						CPUEntitlement: 200,
+					},
+				},
+				containerGuid4: garden.ContainerMetricsEntry{
+					Err: &garden.Error{Err: errors.New("no-metrics-here")},
+					Metrics: garden.Metrics{
+						MemoryStat: garden.ContainerMemoryStat{
+							TotalUsageTowardLimit: 512,
+						},
+						DiskStat: garden.ContainerDiskStat{
+							TotalBytesUsed: uint64(1000 + 128),
+						},
+						CPUStat: garden.ContainerCPUStat{
+							Usage: 1000000,
+						},
+						Age:            4000000000,
+						CPUEntitlement: 300,
+					},
+				},
+				"BOGUS-GUID": garden.ContainerMetricsEntry{},
+			}
+			gardenClient.BulkMetricsReturns(bulkMetrics, nil)
+		})
+
+		It("returns metrics for all known containers in the running and created state", func() {
+			metrics, err := containerStore.Metrics(logger)
+			Expect(err).NotTo(HaveOccurred())
+			containerSpec1 := gardenClient.CreateArgsForCall(0)
+			containerSpec2 := gardenClient.CreateArgsForCall(1)
+
+			Expect(gardenClient.BulkMetricsCallCount()).To(Equal(1))
+			Expect(gardenClient.BulkMetricsArgsForCall(0)).To(ConsistOf(
+				containerGuid1, containerGuid2, containerGuid3, containerGuid4,
+			))
+
+			Expect(metrics).To(HaveLen(2))
+
+			container1Metrics, ok := metrics[containerGuid1]
+			Expect(ok).To(BeTrue())
+			Expect(container1Metrics.MemoryUsageInBytes).To(BeEquivalentTo(1024))
+			Expect(container1Metrics.DiskUsageInBytes).To(BeEquivalentTo(2048))
+			Expect(container1Metrics.MemoryLimitInBytes).To(BeEquivalentTo(containerSpec1.Limits.Memory.LimitInBytes))
+			Expect(container1Metrics.DiskLimitInBytes).To(BeEquivalentTo(10 * 1024 * 1024))
+			Expect(container1Metrics.TimeSpentInCPU).To(Equal(5 * time.Second))
+			Expect(container1Metrics.ContainerAgeInNanoseconds).To(Equal(uint64(1000000000)))
+			Expect(container1Metrics.AbsoluteCPUEntitlementInNanoseconds).To(Equal(uint64(100)))
+			if runtime.GOOS != "windows" {
+				Expect(container1Metrics.SwapUsageInBytes).To(BeEquivalentTo(64))
+			}
+			Expect(container1Metrics.SwapLimitInBytes).To(BeZero())
+
+			container2Metrics, ok := metrics[containerGuid2]
+			Expect(ok).To(BeTrue())
+			Expect(container2Metrics.MemoryUsageInBytes).To(BeEquivalentTo(512))
+			Expect(container2Metrics.DiskUsageInBytes).To(BeEquivalentTo(256))
+			Expect(container2Metrics.MemoryLimitInBytes).To(BeEquivalentTo(containerSpec2.Limits.Memory.LimitInBytes))
+			Expect(container2Metrics.DiskLimitInBytes).To(BeEquivalentTo(10 * 1024 * 1024))
+			Expect(container2Metrics.TimeSpentInCPU).To(Equal(1 * time.Millisecond))
+			Expect(container2Metrics.ContainerAgeInNanoseconds).To(Equal(uint64(2000000000)))
+			Expect(container2Metrics.AbsoluteCPUEntitlementInNanoseconds).To(Equal(uint64(200)))
+		})
+
+		Context("when garden reports the network traffic of the containers", func() {
+			BeforeEach(func() {
+				gardenClient.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
+					containerGuid1: garden.ContainerMetricsEntry{
+						Metrics: garden.Metrics{
+							NetworkStat: &garden.ContainerNetworkStat{RxBytes: 4096, TxBytes: 1024},
+						},
+					},
+					containerGuid3: garden.ContainerMetricsEntry{},
+				}, nil)
+			})
+
+			It("reports the network usage of the containers it is reported for", func() {
+				metrics, err := containerStore.Metrics(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metrics[containerGuid1].NetworkUsage).To(Equal(&executor.NetworkUsage{RxBytes: 4096, TxBytes: 1024}))
+				Expect(metrics[containerGuid3].NetworkUsage).To(BeNil())
 			})
 		})
 
-		Context("when there are no process associated with the container", func() {
-			Context("when container is in completed state", func() {
-				JustBeforeEach(func() {
-					destroyErr := errors.New("failed-to-destroy-container")
-					gardenClient.DestroyReturns(destroyErr)
-					eventEmitter.EmitStub = func(e executor.Event) {
-						// processing completed container
-						defer GinkgoRecover()
-						if e.EventType() == executor.EventTypeContainerComplete {
-							// sleeping to avoid atomic destroying state
-							time.Sleep(time.Second)
-							err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-							Expect(err).To(HaveOccurred())
-						}
-					}
-				})
+		Context("when the disk usage reported by garden does not include the rootfs", func() {
+			BeforeEach(func() {
+				gardenClient.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
+					containerGuid3: garden.ContainerMetricsEntry{
+						Metrics: garden.Metrics{
+							DiskStat: garden.ContainerDiskStat{
+								TotalBytesUsed:     500,
+								ExclusiveBytesUsed: 300,
+							},
+						},
+					},
+				}, nil)
+			})
 
-				It("does not emit the completed event", func() {
-					// completed event will trigger Destroy for failed completed container and that will cause an infinite loop
-					Eventually(eventEmitter.EmitCallCount).Should(Equal(1))
-					event1 := eventEmitter.EmitArgsForCall(0)
-					Expect(event1.EventType()).To(Equal(executor.EventTypeContainerReserved))
+			It("reports the exclusive disk usage", func() {
+				metrics, err := containerStore.Metrics(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metrics[containerGuid3].DiskUsageInBytes).To(BeEquivalentTo(300))
+			})
+		})
 
-					err := containerStore.Destroy(logger, "some-trace-id", containerGuid)
-					Expect(err).To(HaveOccurred())
+		Context("when garden only reports the working set and user/kernel CPU time", func() {
+			BeforeEach(func() {
+				gardenClient.BulkMetricsReturns(map[string]garden.ContainerMetricsEntry{
+					containerGuid3: garden.ContainerMetricsEntry{
+						Metrics: garden.Metrics{
+							MemoryStat: garden.ContainerMemoryStat{
+								TotalRss: 2048,
+							},
+							CPUStat: garden.ContainerCPUStat{
+								User:   2000000,
+								System: 1000000,
+							},
+						},
+					},
+				}, nil)
+			})
 
-					container, err := containerStore.Get(logger, containerGuid)
-					Expect(err).NotTo(HaveOccurred())
+			It("uses the Windows counters on Windows", func() {
+				metrics, err := containerStore.Metrics(logger)
+				Expect(err).NotTo(HaveOccurred())
+				if runtime.GOOS == "windows" {
+					Expect(metrics[containerGuid3].MemoryUsageInBytes).To(BeEquivalentTo(2048))
+					Expect(metrics[containerGuid3].TimeSpentInCPU).To(Equal(3 * time.Millisecond))
+				} else {
+					Expect(metrics[containerGuid3].MemoryUsageInBytes).To(BeEquivalentTo(0))
+					Expect(metrics[containerGuid3].TimeSpentInCPU).To(BeZero())
+				}
+			})
+		})
 
-					Eventually(eventEmitter.EmitCallCount).Should(Equal(2))
-					event2 := eventEmitter.EmitArgsForCall(1)
-					Expect(event2).To(Equal(executor.NewContainerCompleteEvent(container, "some-trace-id")))
+		Context("when fetching bulk metrics fails", func() {
+			BeforeEach(func() {
+				gardenClient.BulkMetricsReturns(nil, errors.New("failed-bulk-metrics"))
+			})
 
-					Consistently(eventEmitter.EmitCallCount).Should(Equal(2))
-				})
+			It("returns an error", func() {
+				_, err := containerStore.Metrics(logger)
+				Expect(err).To(Equal(errors.New("failed-bulk-metrics")))
 			})
 		})
 	})
 
-	Describe("Get", func() {
+	Describe("GetFiles", func() {
 		BeforeEach(func() {
+			gardenClient.CreateReturns(gardenContainer, nil)
+			gardenContainer.StreamOutReturns(ioutil.NopCloser(bytes.NewReader([]byte("this is the stream"))), nil)
+		})
+
+		JustBeforeEach(func() {
 			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("returns the specified container", func() {
-			container, err := containerStore.Get(logger, containerGuid)
-			Expect(err).NotTo(HaveOccurred())
+		Context("when the container has a corresponding garden container", func() {
+			JustBeforeEach(func() {
+				err := containerStore.Initialize(logger, &executor.RunRequest{Guid: containerGuid})
+				Expect(err).NotTo(HaveOccurred())
 
-			Expect(container.Guid).To(Equal(containerGuid))
+				_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("calls streamout on the garden client", func() {
+				stream, err := containerStore.GetFiles(logger, containerGuid, "/path/to/file")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(gardenContainer.StreamOutCallCount()).To(Equal(1))
+				streamOutSpec := gardenContainer.StreamOutArgsForCall(0)
+				Expect(streamOutSpec.Path).To(Equal("/path/to/file"))
+				Expect(streamOutSpec.User).To(Equal("root"))
+
+				output := make([]byte, len("this is the stream"))
+				_, err = stream.Read(output)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).To(Equal([]byte("this is the stream")))
+			})
+		})
+
+		Context("when the container does not have a corresponding garden container", func() {
+			It("returns an error", func() {
+				_, err := containerStore.GetFiles(logger, containerGuid, "/path")
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
 		})
 
 		Context("when the container does not exist", func() {
-			It("returns an ErrContainerNotFound", func() {
-				_, err := containerStore.Get(logger, "")
+			It("returns ErrContainerNotFound", func() {
+				_, err := containerStore.GetFiles(logger, "", "/stuff")
 				Expect(err).To(Equal(executor.ErrContainerNotFound))
 			})
 		})
 	})
 
-	Describe("List", func() {
-		var container1, container2 executor.Container
-
+	Describe("StreamIn", func() {
 		BeforeEach(func() {
-			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+			gardenClient.CreateReturns(gardenContainer, nil)
+		})
 
+		JustBeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
 			Expect(err).NotTo(HaveOccurred())
+		})
 
-			err = containerStore.Initialize(logger, &executor.RunRequest{
-				Guid: containerGuid,
+		Context("when the container has a corresponding garden container", func() {
+			JustBeforeEach(func() {
+				err := containerStore.Initialize(logger, &executor.RunRequest{Guid: containerGuid})
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
 			})
-			Expect(err).NotTo(HaveOccurred())
 
-			_, err = containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{
-				Guid: containerGuid + "2",
+			It("calls streamin on the garden container", func() {
+				tarStream := bytes.NewReader([]byte("this is the stream"))
+				err := containerStore.StreamIn(logger, containerGuid, "/tmp/debug", tarStream)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(gardenContainer.StreamInCallCount()).To(Equal(1))
+				Expect(gardenContainer.StreamInArgsForCall(0)).To(Equal(garden.StreamInSpec{
+					Path:      "/tmp/debug",
+					User:      "root",
+					TarStream: tarStream,
+				}))
+			})
+		})
+
+		Context("when the container does not have a corresponding garden container", func() {
+			It("returns ErrContainerNotFound", func() {
+				err := containerStore.StreamIn(logger, containerGuid, "/tmp", &bytes.Buffer{})
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
 			})
+		})
+	})
+
+	Describe("RunProcess", func() {
+		var (
+			gardenProcess *gardenfakes.FakeProcess
+			spec          executor.ProcessSpec
+			processIO     executor.ProcessIO
+		)
+
+		BeforeEach(func() {
+			gardenProcess = &gardenfakes.FakeProcess{}
+			gardenProcess.WaitReturns(3, nil)
+			gardenContainer.RunReturns(gardenProcess, nil)
+			gardenClient.CreateReturns(gardenContainer, nil)
+			megatron.StepsRunnerReturns(ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+				close(ready)
+				<-signals
+				return nil
+			}), nil)
+
+			spec = executor.ProcessSpec{
+				Path: "/bin/sh",
+				Args: []string{"-l"},
+				User: "vcap",
+				TTY:  &executor.WindowSize{Columns: 80, Rows: 24},
+			}
+			processIO = executor.ProcessIO{Stdin: &bytes.Buffer{}, Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+		})
+
+		JustBeforeEach(func() {
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
 			Expect(err).NotTo(HaveOccurred())
 
-			container1, err = containerStore.Get(logger, containerGuid)
+			err = containerStore.Initialize(logger, &executor.RunRequest{Guid: containerGuid})
 			Expect(err).NotTo(HaveOccurred())
 
-			container2, err = containerStore.Get(logger, containerGuid+"2")
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("returns the list of known containers", func() {
-			containers := containerStore.List(logger)
-			Expect(containers).To(HaveLen(2))
-			Expect(containers).To(ContainElement(container1))
-			Expect(containers).To(ContainElement(container2))
-		})
-	})
+		Context("when the container is running", func() {
+			JustBeforeEach(func() {
+				err := containerStore.Run(logger, "some-trace-id", containerGuid)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(containerState(containerGuid)).Should(Equal(executor.StateRunning))
+			})
 
-	reserveContainer := func(guid string) {
-		resource := executor.Resource{
-			MemoryMB: 10,
-			DiskMB:   10,
-		}
-		tags := executor.Tags{}
-		_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: guid, Tags: tags, Resource: resource})
-		Expect(err).NotTo(HaveOccurred())
-	}
+			It("runs the process in the garden container", func() {
+				process, err := containerStore.RunProcess(logger, containerGuid, spec, processIO)
+				Expect(err).NotTo(HaveOccurred())
 
-	initializeContainer := func(guid string, rootFSPath string) {
-		runInfo := executor.RunInfo{
-			RootFSPath:         rootFSPath,
-			CPUWeight:          2,
-			StartTimeoutMs:     50000,
-			Privileged:         true,
-			CachedDependencies: []executor.CachedDependency{},
-			LogConfig: executor.LogConfig{
-				Guid:       "log-guid",
-				Index:      1,
-				SourceName: "test-source",
-			},
-			MetricsConfig: executor.MetricsConfig{
-				Guid:  "metric-guid",
-				Index: 1,
-			},
-			Env:                           []executor.EnvironmentVariable{},
-			TrustedSystemCertificatesPath: "",
-			Network: &executor.Network{
-				Properties: map[string]string{},
-			},
-		}
+				Expect(gardenContainer.RunCallCount()).To(Equal(1))
+				processSpec, gardenIO := gardenContainer.RunArgsForCall(0)
+				Expect(processSpec).To(Equal(garden.ProcessSpec{
+					Path: "/bin/sh",
+					Args: []string{"-l"},
+					User: "vcap",
+					TTY:  &garden.TTYSpec{WindowSize: &garden.WindowSize{Columns: 80, Rows: 24}},
+				}))
+				Expect(gardenIO.Stdin).To(Equal(processIO.Stdin))
+				Expect(gardenIO.Stdout).To(Equal(processIO.Stdout))
 
-		req := &executor.RunRequest{
-			Guid:    guid,
-			RunInfo: runInfo,
-			Tags:    executor.Tags{},
-		}
+				Expect(process.Wait()).To(Equal(3))
 
-		err := containerStore.Initialize(logger, req)
-		Expect(err).ToNot(HaveOccurred())
-	}
+				Expect(process.Resize(executor.WindowSize{Columns: 120, Rows: 40})).To(Succeed())
+				Expect(gardenProcess.SetTTYArgsForCall(0)).To(Equal(garden.TTYSpec{WindowSize: &garden.WindowSize{Columns: 120, Rows: 40}}))
 
-	Describe("Metrics", func() {
+				Expect(process.Kill()).To(Succeed())
+				Expect(gardenProcess.SignalArgsForCall(0)).To(Equal(garden.SignalKill))
+			})
+		})
+
+		Context("when the container is not running", func() {
+			It("returns ErrContainerNotRunning", func() {
+				_, err := containerStore.RunProcess(logger, containerGuid, spec, processIO)
+				Expect(err).To(Equal(executor.ErrContainerNotRunning))
+				Expect(gardenContainer.RunCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the container does not exist", func() {
+			It("returns ErrContainerNotFound", func() {
+				_, err := containerStore.RunProcess(logger, "missing-guid", spec, processIO)
+				Expect(err).To(Equal(executor.ErrContainerNotFound))
+			})
+		})
+	})
+
+	Describe("Recover", func() {
 		var (
-			containerGuid1, containerGuid2, containerGuid3, containerGuid4 string
-			containerGuid5, containerGuid6                                 string
+			checkpoint       containerstore.Checkpoint
+			runningContainer *gardenfakes.FakeContainer
+			createdContainer *gardenfakes.FakeContainer
+			strayContainer   *gardenfakes.FakeContainer
+			process          *gardenfakes.FakeProcess
+			exited           chan int
 		)
 
 		BeforeEach(func() {
-			rootFSSizer.RootFSSizeFromPathStub = func(path string) uint64 {
-				switch path {
-				case "/foo/bar":
-					return 1000
-				default:
-					return 0
-				}
+			resource := executor.Resource{MemoryMB: 1024, DiskMB: 1024}
+			checkpoint = containerstore.Checkpoint{
+				Containers: []executor.Container{
+					{Guid: "running-guid", State: executor.StateRunning, Resource: resource},
+					{Guid: "missing-guid", State: executor.StateRunning, Resource: resource},
+					{Guid: "created-guid", State: executor.StateCreated, Resource: resource},
+					{Guid: "reserved-guid", State: executor.StateReserved, Resource: resource},
+				},
 			}
 
-			containerGuid1 = "container-guid-1"
-			containerGuid2 = "container-guid-2"
-			containerGuid3 = "container-guid-3"
-			containerGuid4 = "container-guid-4"
-			containerGuid5 = "container-guid-5"
-			containerGuid6 = "container-guid-6"
+			exited = make(chan int, 1)
+			process = &gardenfakes.FakeProcess{}
+			process.IDReturns("action")
+			process.WaitStub = func() (int, error) {
+				return <-exited, nil
+			}
+
+			runningContainer = &gardenfakes.FakeContainer{}
+			runningContainer.HandleReturns("running-guid")
+			runningContainer.InfoReturns(garden.ContainerInfo{ProcessIDs: []string{"running-guid-action-run", "running-guid-envoy"}}, nil)
+			runningContainer.AttachReturns(process, nil)
+
+			megatron.StepsRunnerStub = func(logger lager.Logger, container executor.Container, gardenContainer garden.Container, logStreamer log_streamer.LogStreamer, cfg transformer.Config) (ifrit.Runner, error) {
+				return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+					process, err := gardenContainer.Attach("running-guid-action-run", garden.ProcessIO{})
+					if err != nil {
+						return err
+					}
+					close(ready)
+					status, _ := process.Wait()
+					if status != 0 {
+						return errors.New("action exited")
+					}
+					return nil
+				}), nil
+			}
+
+			createdContainer = &gardenfakes.FakeContainer{}
+			createdContainer.HandleReturns("created-guid")
+
+			strayContainer = &gardenfakes.FakeContainer{}
+			strayContainer.HandleReturns("stray-guid")
+
+			gardenClient.ContainersReturns([]garden.Container{runningContainer, createdContainer, strayContainer}, nil)
+		})
+
+		AfterEach(func() {
+			exited <- 0
+		})
+
+		It("lists the garden containers of the executor", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Expect(gardenClient.ContainersCallCount()).To(Equal(1))
+			Expect(gardenClient.ContainersArgsForCall(0)).To(Equal(garden.Properties{
+				executor.ContainerOwnerProperty: ownerName,
+			}))
+		})
+
+		It("rebuilds the steps of the running containers to attach to their processes", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Eventually(megatron.StepsRunnerCallCount).Should(Equal(1))
+			_, container, gardenContainer, _, cfg := megatron.StepsRunnerArgsForCall(0)
+			Expect(container.Guid).To(Equal("running-guid"))
+			Expect(gardenContainer).To(Equal(runningContainer))
+			Expect(cfg.Reattach).To(BeTrue())
+			Expect(cfg.RunningProcesses).To(ConsistOf("running-guid-action-run", "running-guid-envoy"))
+			Expect(cfg.HealthTransitions).NotTo(BeNil())
+
+			Eventually(runningContainer.AttachCallCount).Should(Equal(1))
+			Expect(containerState("running-guid")()).To(Equal(executor.StateRunning))
+		})
 
-			reserveContainer(containerGuid1)
-			reserveContainer(containerGuid2)
-			reserveContainer(containerGuid3)
-			reserveContainer(containerGuid4)
-			reserveContainer(containerGuid5)
-			reserveContainer(containerGuid6)
+		It("gives the recovered containers their start timeout", func() {
+			megatron.StartTimeoutReturns(time.Minute)
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Expect(megatron.StartTimeoutCallCount()).To(Equal(1))
+		})
 
-			initializeContainer(containerGuid1, "/foo/bar")
-			initializeContainer(containerGuid2, "docker://repo")
-			initializeContainer(containerGuid3, "/foo/bar")
-			initializeContainer(containerGuid4, "/foo/bar")
+		Context("when the steps of a running container cannot be built", func() {
+			BeforeEach(func() {
+				megatron.StepsRunnerReturns(nil, errors.New("invalid probes"))
+				megatron.StepsRunnerStub = nil
+			})
 
-			gardenContainer.InfoReturns(garden.ContainerInfo{ExternalIP: "6.6.6.6"}, nil)
-			gardenClient.CreateReturns(gardenContainer, nil)
-			_, err := containerStore.Create(logger, "some-trace-id", containerGuid1)
+			It("completes the container as failed", func() {
+				Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+				container, err := containerStore.Get(logger, "running-guid")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(container.State).To(Equal(executor.StateCompleted))
+				Expect(container.RunResult.FailureReason).To(Equal(containerstore.ContainerRecoveryFailedMessage))
+			})
+		})
+
+		It("completes the running containers once their processes exit", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Eventually(runningContainer.AttachCallCount).Should(Equal(1))
+
+			exited <- 1
+			Eventually(containerState("running-guid")).Should(Equal(executor.StateCompleted))
+			container, err := containerStore.Get(logger, "running-guid")
 			Expect(err).NotTo(HaveOccurred())
-			_, err = containerStore.Create(logger, "some-trace-id", containerGuid2)
-			Expect(err).ToNot(HaveOccurred())
-			_, err = containerStore.Create(logger, "some-trace-id", containerGuid3)
-			Expect(err).ToNot(HaveOccurred())
-			_, err = containerStore.Create(logger, "some-trace-id", containerGuid4)
-			Expect(err).ToNot(HaveOccurred())
+			Expect(container.RunResult.Failed).To(BeTrue())
+		})
 
-			bulkMetrics := map[string]garden.ContainerMetricsEntry{
-				containerGuid1: garden.ContainerMetricsEntry{
-					Metrics: garden.Metrics{
-						MemoryStat: garden.ContainerMemoryStat{
-							TotalUsageTowardLimit: 1024,
-						},
-						DiskStat: garden.ContainerDiskStat{
-							TotalBytesUsed: uint64(1000 + 2048),
-						},
-						CPUStat: garden.ContainerCPUStat{
-							Usage: 5000000000,
-						},
-						Age:            1000000000,
-						CPUEntitlement: 100,
-					},
-				},
-				containerGuid2: garden.ContainerMetricsEntry{
-					Metrics: garden.Metrics{
-						MemoryStat: garden.ContainerMemoryStat{
-							TotalUsageTowardLimit: 512,
-						},
-						DiskStat: garden.ContainerDiskStat{
-							TotalBytesUsed: 256,
-						},
-						CPUStat: garden.ContainerCPUStat{
-							Usage: 1000000,
-						},
-						Age:            2000000000,
-						CPUEntitlement: 200,
-					},
-				},
-				containerGuid4: garden.ContainerMetricsEntry{
-					Err: &garden.Error{Err: errors.New("no-metrics-here")},
-					Metrics: garden.Metrics{
-						MemoryStat: garden.ContainerMemoryStat{
-							TotalUsageTowardLimit: 512,
-						},
-						DiskStat: garden.ContainerDiskStat{
-							TotalBytesUsed: uint64(1000 + 128),
-						},
-						CPUStat: garden.ContainerCPUStat{
-							Usage: 1000000,
-						},
-						Age:            4000000000,
-						CPUEntitlement: 300,
-					},
-				},
-				"BOGUS-GUID": garden.ContainerMetricsEntry{},
-			}
-			gardenClient.BulkMetricsReturns(bulkMetrics, nil)
+		It("completes the running containers whose garden container is gone as failed", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			container, err := containerStore.Get(logger, "missing-guid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(container.State).To(Equal(executor.StateCompleted))
+			Expect(container.RunResult.Failed).To(BeTrue())
+			Expect(container.RunResult.FailureReason).To(Equal(containerstore.ContainerMissingMessage))
 		})
 
-		It("returns metrics for all known containers in the running and created state", func() {
-			metrics, err := containerStore.Metrics(logger)
+		It("completes the containers that were not running yet as failed", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			container, err := containerStore.Get(logger, "created-guid")
 			Expect(err).NotTo(HaveOccurred())
-			containerSpec1 := gardenClient.CreateArgsForCall(0)
-			containerSpec2 := gardenClient.CreateArgsForCall(1)
+			Expect(container.State).To(Equal(executor.StateCompleted))
+			Expect(container.RunResult.Failed).To(BeTrue())
+			Expect(container.RunResult.FailureReason).To(Equal(containerstore.ContainerRecoveryFailedMessage))
+		})
 
-			Expect(gardenClient.BulkMetricsCallCount()).To(Equal(1))
-			Expect(gardenClient.BulkMetricsArgsForCall(0)).To(ConsistOf(
-				containerGuid1, containerGuid2, containerGuid3, containerGuid4,
-			))
+		It("keeps the reserved containers", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Expect(containerState("reserved-guid")()).To(Equal(executor.StateReserved))
+		})
 
-			Expect(metrics).To(HaveLen(2))
+		It("accounts for the resources of the recovered containers", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			remaining := containerStore.RemainingResources(logger)
+			Expect(remaining.MemoryMB).To(Equal(totalCapacity.MemoryMB - 4*1024))
+			Expect(remaining.Containers).To(Equal(totalCapacity.Containers - 4))
+		})
 
-			container1Metrics, ok := metrics[containerGuid1]
-			Expect(ok).To(BeTrue())
-			Expect(container1Metrics.MemoryUsageInBytes).To(BeEquivalentTo(1024))
-			Expect(container1Metrics.DiskUsageInBytes).To(BeEquivalentTo(2048))
-			Expect(container1Metrics.MemoryLimitInBytes).To(BeEquivalentTo(containerSpec1.Limits.Memory.LimitInBytes))
-			Expect(container1Metrics.DiskLimitInBytes).To(BeEquivalentTo(10 * 1024 * 1024))
-			Expect(container1Metrics.TimeSpentInCPU).To(Equal(5 * time.Second))
-			Expect(container1Metrics.ContainerAgeInNanoseconds).To(Equal(uint64(1000000000)))
-			Expect(container1Metrics.AbsoluteCPUEntitlementInNanoseconds).To(Equal(uint64(100)))
+		It("restores the rotation deadlines of the credentials of the containers", func() {
+			deadline := time.Unix(1234, 0).UTC()
+			checkpoint.CredentialRotations = map[string]time.Time{"running-guid": deadline}
 
-			container2Metrics, ok := metrics[containerGuid2]
-			Expect(ok).To(BeTrue())
-			Expect(container2Metrics.MemoryUsageInBytes).To(BeEquivalentTo(512))
-			Expect(container2Metrics.DiskUsageInBytes).To(BeEquivalentTo(256))
-			Expect(container2Metrics.MemoryLimitInBytes).To(BeEquivalentTo(containerSpec2.Limits.Memory.LimitInBytes))
-			Expect(container2Metrics.DiskLimitInBytes).To(BeEquivalentTo(10 * 1024 * 1024))
-			Expect(container2Metrics.TimeSpentInCPU).To(Equal(1 * time.Millisecond))
-			Expect(container2Metrics.ContainerAgeInNanoseconds).To(Equal(uint64(2000000000)))
-			Expect(container2Metrics.AbsoluteCPUEntitlementInNanoseconds).To(Equal(uint64(200)))
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Expect(credManager.RestoreRotationDeadlinesCallCount()).To(Equal(1))
+			Expect(credManager.RestoreRotationDeadlinesArgsForCall(0)).To(Equal(map[string]time.Time{"running-guid": deadline}))
 		})
 
-		Context("when fetching bulk metrics fails", func() {
+		It("destroys the garden containers that are not recovered", func() {
+			Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(Succeed())
+			Expect(gardenClient.DestroyCallCount()).To(Equal(1))
+			Expect(gardenClient.DestroyArgsForCall(0)).To(Equal("stray-guid"))
+		})
+
+		Context("when listing the garden containers fails", func() {
 			BeforeEach(func() {
-				gardenClient.BulkMetricsReturns(nil, errors.New("failed-bulk-metrics"))
+				gardenClient.ContainersReturns(nil, errors.New("garden is down"))
 			})
 
-			It("returns an error", func() {
-				_, err := containerStore.Metrics(logger)
-				Expect(err).To(Equal(errors.New("failed-bulk-metrics")))
+			It("returns the error without recovering any container", func() {
+				Expect(containerStore.Recover(logger, "some-trace-id", checkpoint)).To(MatchError("garden is down"))
+				Expect(containerStore.List(logger)).To(BeEmpty())
 			})
 		})
 	})
 
-	Describe("GetFiles", func() {
+	Describe("NewCheckpointer", func() {
+		var (
+			path    string
+			process ifrit.Process
+		)
+
 		BeforeEach(func() {
-			gardenClient.CreateReturns(gardenContainer, nil)
-			gardenContainer.StreamOutReturns(ioutil.NopCloser(bytes.NewReader([]byte("this is the stream"))), nil)
+			path = filepath.Join(GinkgoT().TempDir(), "checkpoint.json")
 		})
 
 		JustBeforeEach(func() {
 			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
 			Expect(err).NotTo(HaveOccurred())
+			process = ifrit.Background(containerStore.NewCheckpointer(logger, path, time.Minute))
+			Eventually(process.Ready()).Should(BeClosed())
 		})
 
-		Context("when the container has a corresponding garden container", func() {
-			JustBeforeEach(func() {
-				err := containerStore.Initialize(logger, &executor.RunRequest{Guid: containerGuid})
-				Expect(err).NotTo(HaveOccurred())
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
 
-				_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+		It("writes the containers to the checkpoint every interval", func() {
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(func() []executor.Container {
+				checkpoint, err := containerstore.ReadCheckpoint(path)
 				Expect(err).NotTo(HaveOccurred())
-			})
+				return checkpoint.Containers
+			}).Should(HaveLen(1))
 
-			It("calls streamout on the garden client", func() {
-				stream, err := containerStore.GetFiles(logger, containerGuid, "/path/to/file")
-				Expect(err).NotTo(HaveOccurred())
+			checkpoint, err := containerstore.ReadCheckpoint(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checkpoint.Containers[0].Guid).To(Equal(containerGuid))
+			Expect(checkpoint.SavedAt).To(BeTemporally("==", clock.Now()))
+		})
 
-				Expect(gardenContainer.StreamOutCallCount()).To(Equal(1))
-				streamOutSpec := gardenContainer.StreamOutArgsForCall(0)
-				Expect(streamOutSpec.Path).To(Equal("/path/to/file"))
-				Expect(streamOutSpec.User).To(Equal("root"))
+		It("writes a last checkpoint when it is signalled", func() {
+			ginkgomon.Interrupt(process)
+			checkpoint, err := containerstore.ReadCheckpoint(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checkpoint.Containers).To(HaveLen(1))
+		})
 
-				output := make([]byte, len("this is the stream"))
-				_, err = stream.Read(output)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(output).To(Equal([]byte("this is the stream")))
-			})
+		It("writes when the credentials of the containers are next rotated", func() {
+			deadline := time.Unix(1234, 0).UTC()
+			credManager.RotationDeadlinesReturns(map[string]time.Time{containerGuid: deadline})
+
+			ginkgomon.Interrupt(process)
+			checkpoint, err := containerstore.ReadCheckpoint(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checkpoint.CredentialRotations).To(HaveKeyWithValue(containerGuid, BeTemporally("==", deadline)))
 		})
 
-		Context("when the container does not have a corresponding garden container", func() {
-			It("returns an error", func() {
-				_, err := containerStore.GetFiles(logger, containerGuid, "/path")
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
+		It("writes a checkpoint as soon as the containers change, without their secrets", func() {
+			appEnv := []*models.EnvironmentVariable{{Name: "VCAP_SERVICES", Value: "service-password"}}
+			err := containerStore.Initialize(logger, &executor.RunRequest{
+				Guid: containerGuid,
+				RunInfo: executor.RunInfo{
+					Env:           []executor.EnvironmentVariable{{Name: "CF_INSTANCE_KEY_PASSPHRASE", Value: "secret"}},
+					ImageUsername: "some-user",
+					ImagePassword: "some-password",
+					Setup:         &models.Action{RunAction: &models.RunAction{Path: "/setup"}},
+					Action: models.WrapAction(models.Timeout(
+						&models.RunAction{Path: "/action", Env: appEnv},
+						time.Minute,
+					)),
+					Monitor: &models.Action{RunAction: &models.RunAction{Path: "/monitor", Env: appEnv}},
+					Sidecars: []executor.Sidecar{{
+						Action:        &models.Action{RunAction: &models.RunAction{Path: "/sidecar", Env: appEnv}},
+						RestartPolicy: executor.SidecarRestartAlways,
+					}},
+					InitActions: []executor.InitAction{{
+						Action: &models.Action{RunAction: &models.RunAction{Path: "/init", Env: appEnv}},
+					}},
+					CachedDependencies: []executor.CachedDependency{{
+						From: "https://blobstore.example.com/droplet?signature=signed-url-secret",
+						To:   "/tmp/app",
+					}},
+					RestartPolicy: &executor.RestartPolicy{MaxRestarts: 1},
+				},
 			})
+			Expect(err).NotTo(HaveOccurred())
+
+			readContainer := func() executor.Container {
+				checkpoint, err := containerstore.ReadCheckpoint(path)
+				Expect(err).NotTo(HaveOccurred())
+				if len(checkpoint.Containers) == 0 {
+					return executor.Container{}
+				}
+				return checkpoint.Containers[0]
+			}
+			Eventually(readContainer).Should(HaveField("State", executor.StateInitializing))
+
+			container := readContainer()
+			Expect(container.Env).To(BeEmpty())
+			Expect(container.ImageUsername).To(BeEmpty())
+			Expect(container.ImagePassword).To(BeEmpty())
+			Expect(container.Setup).To(BeNil())
+			Expect(container.Action.TimeoutAction.Action.RunAction.Path).To(Equal("/action"))
+			Expect(container.CachedDependencies[0].To).To(Equal("/tmp/app"))
+			Expect(container.RestartPolicy).To(BeNil())
+			Expect(container.Sidecars[0].RestartPolicy).To(BeEmpty())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("secret"))
+			Expect(string(data)).NotTo(ContainSubstring("some-password"))
+			Expect(string(data)).NotTo(ContainSubstring("service-password"))
 		})
 
-		Context("when the container does not exist", func() {
-			It("returns ErrContainerNotFound", func() {
-				_, err := containerStore.GetFiles(logger, "", "/stuff")
-				Expect(err).To(Equal(executor.ErrContainerNotFound))
+		It("leaves the actions of the containers in the store as they were", func() {
+			appEnv := []*models.EnvironmentVariable{{Name: "VCAP_SERVICES", Value: "service-password"}}
+			err := containerStore.Initialize(logger, &executor.RunRequest{
+				Guid: containerGuid,
+				RunInfo: executor.RunInfo{
+					Action: &models.Action{RunAction: &models.RunAction{Path: "/action", Env: appEnv}},
+				},
 			})
+			Expect(err).NotTo(HaveOccurred())
+
+			ginkgomon.Interrupt(process)
+			container, err := containerStore.Get(logger, containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(container.Action.RunAction.Env).To(Equal(appEnv))
 		})
 	})
 
@@ -3258,6 +5960,171 @@ var _ = Describe("Container Store", func() {
 		})
 	})
 
+	Describe("EgressResolver", func() {
+		var (
+			process  ifrit.Process
+			lookups  map[string][]net.IP
+			lookupMu sync.Mutex
+		)
+
+		lookupIP := func(host string) ([]net.IP, error) {
+			lookupMu.Lock()
+			defer lookupMu.Unlock()
+			ips, ok := lookups[host]
+			if !ok {
+				return nil, errors.New("no such host")
+			}
+			return ips, nil
+		}
+
+		setLookup := func(host string, ips ...string) {
+			lookupMu.Lock()
+			defer lookupMu.Unlock()
+			lookups[host] = nil
+			for _, ip := range ips {
+				lookups[host] = append(lookups[host], net.ParseIP(ip))
+			}
+		}
+
+		BeforeEach(func() {
+			lookups = map[string][]net.IP{}
+			setLookup("api.example.com", "1.1.1.1")
+			gardenClient.CreateReturns(gardenContainer, nil)
+
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{Guid: containerGuid})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = containerStore.Initialize(logger, &executor.RunRequest{Guid: containerGuid, RunInfo: executor.RunInfo{
+				HostnameEgressRules: []executor.HostnameEgressRule{
+					{Hostname: "api.example.com", Protocol: models.TCPProtocol, Ports: []uint32{443}},
+					{Hostname: "unresolvable.example.com", Protocol: models.TCPProtocol, Ports: []uint32{443}},
+				},
+			}})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			process = ginkgomon.Invoke(containerStore.NewEgressResolver(logger, lookupIP))
+		})
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		netOutRule := func(ip string) garden.NetOutRule {
+			return garden.NetOutRule{
+				Protocol: garden.ProtocolTCP,
+				Networks: []garden.IPRange{{Start: net.ParseIP(ip), End: net.ParseIP(ip)}},
+				Ports:    []garden.PortRange{garden.PortRangeFromPort(443)},
+			}
+		}
+
+		It("allows the addresses the hostnames resolve to", func() {
+			clock.WaitForWatcherAndIncrement(time.Second)
+
+			Eventually(gardenContainer.BulkNetOutCallCount).Should(Equal(1))
+			Expect(gardenContainer.BulkNetOutArgsForCall(0)).To(Equal([]garden.NetOutRule{netOutRule("1.1.1.1")}))
+		})
+
+		It("only allows new addresses when the hostnames are resolved again", func() {
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(gardenContainer.BulkNetOutCallCount).Should(Equal(1))
+
+			setLookup("api.example.com", "1.1.1.1", "2.2.2.2")
+			clock.WaitForWatcherAndIncrement(time.Second)
+
+			Eventually(gardenContainer.BulkNetOutCallCount).Should(Equal(2))
+			Expect(gardenContainer.BulkNetOutArgsForCall(1)).To(Equal([]garden.NetOutRule{netOutRule("2.2.2.2")}))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Consistently(gardenContainer.BulkNetOutCallCount).Should(Equal(2))
+		})
+
+		Context("when garden fails to apply the rules", func() {
+			BeforeEach(func() {
+				gardenContainer.BulkNetOutReturnsOnCall(0, errors.New("boom"))
+			})
+
+			It("retries on the next refresh", func() {
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(gardenContainer.BulkNetOutCallCount).Should(Equal(1))
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(gardenContainer.BulkNetOutCallCount).Should(Equal(2))
+				Expect(gardenContainer.BulkNetOutArgsForCall(1)).To(Equal([]garden.NetOutRule{netOutRule("1.1.1.1")}))
+			})
+		})
+	})
+
+	Describe("PropertySyncer", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			gardenClient.CreateReturns(gardenContainer, nil)
+			gardenContainer.PropertiesReturns(garden.Properties{
+				executor.ContainerExecutorStateProperty: string(executor.StateCreated),
+				executor.ContainerRoutableProperty:      "false",
+			}, nil)
+
+			_, err := containerStore.Reserve(logger, "some-trace-id", &executor.AllocationRequest{
+				Guid: containerGuid,
+				Tags: executor.Tags{"domain": "cf-apps"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = containerStore.Initialize(logger, &executor.RunRequest{Guid: containerGuid, RunInfo: executor.RunInfo{
+				Ports: []executor.PortMapping{{ContainerPort: 8080}},
+			}})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = containerStore.Create(logger, "some-trace-id", containerGuid)
+			Expect(err).NotTo(HaveOccurred())
+
+			process = ginkgomon.Invoke(containerStore.NewPropertySyncer(logger))
+		})
+
+		AfterEach(func() {
+			ginkgomon.Interrupt(process)
+		})
+
+		setProperties := func(from int) map[string]string {
+			properties := map[string]string{}
+			for i := from; i < gardenContainer.SetPropertyCallCount(); i++ {
+				name, value := gardenContainer.SetPropertyArgsForCall(i)
+				properties[name] = value
+			}
+			return properties
+		}
+
+		It("sets the mirrored properties that drifted from the container", func() {
+			before := gardenContainer.SetPropertyCallCount()
+			clock.WaitForWatcherAndIncrement(time.Second)
+
+			Eventually(func() map[string]string { return setProperties(before) }).Should(Equal(map[string]string{
+				executor.ContainerRoutableProperty:       "true",
+				executor.ContainerTagsProperty:           `{"domain":"cf-apps"}`,
+				executor.ContainerPortsProperty:          `[{"container_port":8080}]`,
+				executor.ContainerInternalRoutesProperty: "null",
+			}))
+		})
+
+		Context("when garden fails to set a property", func() {
+			BeforeEach(func() {
+				gardenContainer.SetPropertyReturns(errors.New("boom"))
+			})
+
+			It("retries on the next sync", func() {
+				before := gardenContainer.SetPropertyCallCount()
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(gardenContainer.SetPropertyCallCount).Should(Equal(before + 4))
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(gardenContainer.SetPropertyCallCount).Should(Equal(before + 8))
+			})
+		})
+	})
+
 	Describe("ContainerReaper", func() {
 		var (
 			containerGuid1, containerGuid2, containerGuid3 string
@@ -3,7 +3,9 @@ package containerstorefakes
 
 import (
 	"io"
+	"net"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/containerstore"
@@ -45,6 +47,12 @@ type FakeContainerStore struct {
 	destroyReturnsOnCall map[int]struct {
 		result1 error
 	}
+	DrainStub        func(lager.Logger, time.Duration)
+	drainMutex       sync.RWMutex
+	drainArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 time.Duration
+	}
 	GetStub        func(lager.Logger, string) (executor.Container, error)
 	getMutex       sync.RWMutex
 	getArgsForCall []struct {
@@ -110,6 +118,19 @@ type FakeContainerStore struct {
 		result1 map[string]executor.ContainerMetrics
 		result2 error
 	}
+	NewCheckpointerStub        func(lager.Logger, string, time.Duration) ifrit.Runner
+	newCheckpointerMutex       sync.RWMutex
+	newCheckpointerArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 time.Duration
+	}
+	newCheckpointerReturns struct {
+		result1 ifrit.Runner
+	}
+	newCheckpointerReturnsOnCall map[int]struct {
+		result1 ifrit.Runner
+	}
 	NewContainerReaperStub        func(lager.Logger) ifrit.Runner
 	newContainerReaperMutex       sync.RWMutex
 	newContainerReaperArgsForCall []struct {
@@ -121,6 +142,29 @@ type FakeContainerStore struct {
 	newContainerReaperReturnsOnCall map[int]struct {
 		result1 ifrit.Runner
 	}
+	NewEgressResolverStub        func(lager.Logger, func(string) ([]net.IP, error)) ifrit.Runner
+	newEgressResolverMutex       sync.RWMutex
+	newEgressResolverArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 func(string) ([]net.IP, error)
+	}
+	newEgressResolverReturns struct {
+		result1 ifrit.Runner
+	}
+	newEgressResolverReturnsOnCall map[int]struct {
+		result1 ifrit.Runner
+	}
+	NewPropertySyncerStub        func(lager.Logger) ifrit.Runner
+	newPropertySyncerMutex       sync.RWMutex
+	newPropertySyncerArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	newPropertySyncerReturns struct {
+		result1 ifrit.Runner
+	}
+	newPropertySyncerReturnsOnCall map[int]struct {
+		result1 ifrit.Runner
+	}
 	NewRegistryPrunerStub        func(lager.Logger) ifrit.Runner
 	newRegistryPrunerMutex       sync.RWMutex
 	newRegistryPrunerArgsForCall []struct {
@@ -132,6 +176,19 @@ type FakeContainerStore struct {
 	newRegistryPrunerReturnsOnCall map[int]struct {
 		result1 ifrit.Runner
 	}
+	RecoverStub        func(lager.Logger, string, containerstore.Checkpoint) error
+	recoverMutex       sync.RWMutex
+	recoverArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 containerstore.Checkpoint
+	}
+	recoverReturns struct {
+		result1 error
+	}
+	recoverReturnsOnCall map[int]struct {
+		result1 error
+	}
 	RemainingResourcesStub        func(lager.Logger) executor.ExecutorResources
 	remainingResourcesMutex       sync.RWMutex
 	remainingResourcesArgsForCall []struct {
@@ -171,6 +228,34 @@ type FakeContainerStore struct {
 	runReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RunProcessStub        func(lager.Logger, string, executor.ProcessSpec, executor.ProcessIO) (executor.Process, error)
+	runProcessMutex       sync.RWMutex
+	runProcessArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ProcessSpec
+		arg4 executor.ProcessIO
+	}
+	runProcessReturns struct {
+		result1 executor.Process
+		result2 error
+	}
+	runProcessReturnsOnCall map[int]struct {
+		result1 executor.Process
+		result2 error
+	}
+	SetTotalResourcesStub        func(lager.Logger, executor.ExecutorResources) error
+	setTotalResourcesMutex       sync.RWMutex
+	setTotalResourcesArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 executor.ExecutorResources
+	}
+	setTotalResourcesReturns struct {
+		result1 error
+	}
+	setTotalResourcesReturnsOnCall map[int]struct {
+		result1 error
+	}
 	StopStub        func(lager.Logger, string, string) error
 	stopMutex       sync.RWMutex
 	stopArgsForCall []struct {
@@ -184,6 +269,20 @@ type FakeContainerStore struct {
 	stopReturnsOnCall map[int]struct {
 		result1 error
 	}
+	StreamInStub        func(lager.Logger, string, string, io.Reader) error
+	streamInMutex       sync.RWMutex
+	streamInArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 string
+		arg4 io.Reader
+	}
+	streamInReturns struct {
+		result1 error
+	}
+	streamInReturnsOnCall map[int]struct {
+		result1 error
+	}
 	UpdateStub        func(lager.Logger, *executor.UpdateRequest) error
 	updateMutex       sync.RWMutex
 	updateArgsForCall []struct {
@@ -361,6 +460,39 @@ func (fake *FakeContainerStore) DestroyReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeContainerStore) Drain(arg1 lager.Logger, arg2 time.Duration) {
+	fake.drainMutex.Lock()
+	fake.drainArgsForCall = append(fake.drainArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 time.Duration
+	}{arg1, arg2})
+	stub := fake.DrainStub
+	fake.recordInvocation("Drain", []interface{}{arg1, arg2})
+	fake.drainMutex.Unlock()
+	if stub != nil {
+		fake.DrainStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeContainerStore) DrainCallCount() int {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	return len(fake.drainArgsForCall)
+}
+
+func (fake *FakeContainerStore) DrainCalls(stub func(lager.Logger, time.Duration)) {
+	fake.drainMutex.Lock()
+	defer fake.drainMutex.Unlock()
+	fake.DrainStub = stub
+}
+
+func (fake *FakeContainerStore) DrainArgsForCall(i int) (lager.Logger, time.Duration) {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	argsForCall := fake.drainArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeContainerStore) Get(arg1 lager.Logger, arg2 string) (executor.Container, error) {
 	fake.getMutex.Lock()
 	ret, specificReturn := fake.getReturnsOnCall[len(fake.getArgsForCall)]
@@ -679,6 +811,69 @@ func (fake *FakeContainerStore) MetricsReturnsOnCall(i int, result1 map[string]e
 	}{result1, result2}
 }
 
+func (fake *FakeContainerStore) NewCheckpointer(arg1 lager.Logger, arg2 string, arg3 time.Duration) ifrit.Runner {
+	fake.newCheckpointerMutex.Lock()
+	ret, specificReturn := fake.newCheckpointerReturnsOnCall[len(fake.newCheckpointerArgsForCall)]
+	fake.newCheckpointerArgsForCall = append(fake.newCheckpointerArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 time.Duration
+	}{arg1, arg2, arg3})
+	stub := fake.NewCheckpointerStub
+	fakeReturns := fake.newCheckpointerReturns
+	fake.recordInvocation("NewCheckpointer", []interface{}{arg1, arg2, arg3})
+	fake.newCheckpointerMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeContainerStore) NewCheckpointerCallCount() int {
+	fake.newCheckpointerMutex.RLock()
+	defer fake.newCheckpointerMutex.RUnlock()
+	return len(fake.newCheckpointerArgsForCall)
+}
+
+func (fake *FakeContainerStore) NewCheckpointerCalls(stub func(lager.Logger, string, time.Duration) ifrit.Runner) {
+	fake.newCheckpointerMutex.Lock()
+	defer fake.newCheckpointerMutex.Unlock()
+	fake.NewCheckpointerStub = stub
+}
+
+func (fake *FakeContainerStore) NewCheckpointerArgsForCall(i int) (lager.Logger, string, time.Duration) {
+	fake.newCheckpointerMutex.RLock()
+	defer fake.newCheckpointerMutex.RUnlock()
+	argsForCall := fake.newCheckpointerArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeContainerStore) NewCheckpointerReturns(result1 ifrit.Runner) {
+	fake.newCheckpointerMutex.Lock()
+	defer fake.newCheckpointerMutex.Unlock()
+	fake.NewCheckpointerStub = nil
+	fake.newCheckpointerReturns = struct {
+		result1 ifrit.Runner
+	}{result1}
+}
+
+func (fake *FakeContainerStore) NewCheckpointerReturnsOnCall(i int, result1 ifrit.Runner) {
+	fake.newCheckpointerMutex.Lock()
+	defer fake.newCheckpointerMutex.Unlock()
+	fake.NewCheckpointerStub = nil
+	if fake.newCheckpointerReturnsOnCall == nil {
+		fake.newCheckpointerReturnsOnCall = make(map[int]struct {
+			result1 ifrit.Runner
+		})
+	}
+	fake.newCheckpointerReturnsOnCall[i] = struct {
+		result1 ifrit.Runner
+	}{result1}
+}
+
 func (fake *FakeContainerStore) NewContainerReaper(arg1 lager.Logger) ifrit.Runner {
 	fake.newContainerReaperMutex.Lock()
 	ret, specificReturn := fake.newContainerReaperReturnsOnCall[len(fake.newContainerReaperArgsForCall)]
@@ -740,6 +935,129 @@ func (fake *FakeContainerStore) NewContainerReaperReturnsOnCall(i int, result1 i
 	}{result1}
 }
 
+func (fake *FakeContainerStore) NewEgressResolver(arg1 lager.Logger, arg2 func(string) ([]net.IP, error)) ifrit.Runner {
+	fake.newEgressResolverMutex.Lock()
+	ret, specificReturn := fake.newEgressResolverReturnsOnCall[len(fake.newEgressResolverArgsForCall)]
+	fake.newEgressResolverArgsForCall = append(fake.newEgressResolverArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 func(string) ([]net.IP, error)
+	}{arg1, arg2})
+	stub := fake.NewEgressResolverStub
+	fakeReturns := fake.newEgressResolverReturns
+	fake.recordInvocation("NewEgressResolver", []interface{}{arg1, arg2})
+	fake.newEgressResolverMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeContainerStore) NewEgressResolverCallCount() int {
+	fake.newEgressResolverMutex.RLock()
+	defer fake.newEgressResolverMutex.RUnlock()
+	return len(fake.newEgressResolverArgsForCall)
+}
+
+func (fake *FakeContainerStore) NewEgressResolverCalls(stub func(lager.Logger, func(string) ([]net.IP, error)) ifrit.Runner) {
+	fake.newEgressResolverMutex.Lock()
+	defer fake.newEgressResolverMutex.Unlock()
+	fake.NewEgressResolverStub = stub
+}
+
+func (fake *FakeContainerStore) NewEgressResolverArgsForCall(i int) (lager.Logger, func(string) ([]net.IP, error)) {
+	fake.newEgressResolverMutex.RLock()
+	defer fake.newEgressResolverMutex.RUnlock()
+	argsForCall := fake.newEgressResolverArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeContainerStore) NewEgressResolverReturns(result1 ifrit.Runner) {
+	fake.newEgressResolverMutex.Lock()
+	defer fake.newEgressResolverMutex.Unlock()
+	fake.NewEgressResolverStub = nil
+	fake.newEgressResolverReturns = struct {
+		result1 ifrit.Runner
+	}{result1}
+}
+
+func (fake *FakeContainerStore) NewEgressResolverReturnsOnCall(i int, result1 ifrit.Runner) {
+	fake.newEgressResolverMutex.Lock()
+	defer fake.newEgressResolverMutex.Unlock()
+	fake.NewEgressResolverStub = nil
+	if fake.newEgressResolverReturnsOnCall == nil {
+		fake.newEgressResolverReturnsOnCall = make(map[int]struct {
+			result1 ifrit.Runner
+		})
+	}
+	fake.newEgressResolverReturnsOnCall[i] = struct {
+		result1 ifrit.Runner
+	}{result1}
+}
+
+func (fake *FakeContainerStore) NewPropertySyncer(arg1 lager.Logger) ifrit.Runner {
+	fake.newPropertySyncerMutex.Lock()
+	ret, specificReturn := fake.newPropertySyncerReturnsOnCall[len(fake.newPropertySyncerArgsForCall)]
+	fake.newPropertySyncerArgsForCall = append(fake.newPropertySyncerArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	stub := fake.NewPropertySyncerStub
+	fakeReturns := fake.newPropertySyncerReturns
+	fake.recordInvocation("NewPropertySyncer", []interface{}{arg1})
+	fake.newPropertySyncerMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeContainerStore) NewPropertySyncerCallCount() int {
+	fake.newPropertySyncerMutex.RLock()
+	defer fake.newPropertySyncerMutex.RUnlock()
+	return len(fake.newPropertySyncerArgsForCall)
+}
+
+func (fake *FakeContainerStore) NewPropertySyncerCalls(stub func(lager.Logger) ifrit.Runner) {
+	fake.newPropertySyncerMutex.Lock()
+	defer fake.newPropertySyncerMutex.Unlock()
+	fake.NewPropertySyncerStub = stub
+}
+
+func (fake *FakeContainerStore) NewPropertySyncerArgsForCall(i int) lager.Logger {
+	fake.newPropertySyncerMutex.RLock()
+	defer fake.newPropertySyncerMutex.RUnlock()
+	argsForCall := fake.newPropertySyncerArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeContainerStore) NewPropertySyncerReturns(result1 ifrit.Runner) {
+	fake.newPropertySyncerMutex.Lock()
+	defer fake.newPropertySyncerMutex.Unlock()
+	fake.NewPropertySyncerStub = nil
+	fake.newPropertySyncerReturns = struct {
+		result1 ifrit.Runner
+	}{result1}
+}
+
+func (fake *FakeContainerStore) NewPropertySyncerReturnsOnCall(i int, result1 ifrit.Runner) {
+	fake.newPropertySyncerMutex.Lock()
+	defer fake.newPropertySyncerMutex.Unlock()
+	fake.NewPropertySyncerStub = nil
+	if fake.newPropertySyncerReturnsOnCall == nil {
+		fake.newPropertySyncerReturnsOnCall = make(map[int]struct {
+			result1 ifrit.Runner
+		})
+	}
+	fake.newPropertySyncerReturnsOnCall[i] = struct {
+		result1 ifrit.Runner
+	}{result1}
+}
+
 func (fake *FakeContainerStore) NewRegistryPruner(arg1 lager.Logger) ifrit.Runner {
 	fake.newRegistryPrunerMutex.Lock()
 	ret, specificReturn := fake.newRegistryPrunerReturnsOnCall[len(fake.newRegistryPrunerArgsForCall)]
@@ -801,6 +1119,69 @@ func (fake *FakeContainerStore) NewRegistryPrunerReturnsOnCall(i int, result1 if
 	}{result1}
 }
 
+func (fake *FakeContainerStore) Recover(arg1 lager.Logger, arg2 string, arg3 containerstore.Checkpoint) error {
+	fake.recoverMutex.Lock()
+	ret, specificReturn := fake.recoverReturnsOnCall[len(fake.recoverArgsForCall)]
+	fake.recoverArgsForCall = append(fake.recoverArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 containerstore.Checkpoint
+	}{arg1, arg2, arg3})
+	stub := fake.RecoverStub
+	fakeReturns := fake.recoverReturns
+	fake.recordInvocation("Recover", []interface{}{arg1, arg2, arg3})
+	fake.recoverMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeContainerStore) RecoverCallCount() int {
+	fake.recoverMutex.RLock()
+	defer fake.recoverMutex.RUnlock()
+	return len(fake.recoverArgsForCall)
+}
+
+func (fake *FakeContainerStore) RecoverCalls(stub func(lager.Logger, string, containerstore.Checkpoint) error) {
+	fake.recoverMutex.Lock()
+	defer fake.recoverMutex.Unlock()
+	fake.RecoverStub = stub
+}
+
+func (fake *FakeContainerStore) RecoverArgsForCall(i int) (lager.Logger, string, containerstore.Checkpoint) {
+	fake.recoverMutex.RLock()
+	defer fake.recoverMutex.RUnlock()
+	argsForCall := fake.recoverArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeContainerStore) RecoverReturns(result1 error) {
+	fake.recoverMutex.Lock()
+	defer fake.recoverMutex.Unlock()
+	fake.RecoverStub = nil
+	fake.recoverReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeContainerStore) RecoverReturnsOnCall(i int, result1 error) {
+	fake.recoverMutex.Lock()
+	defer fake.recoverMutex.Unlock()
+	fake.RecoverStub = nil
+	if fake.recoverReturnsOnCall == nil {
+		fake.recoverReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recoverReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeContainerStore) RemainingResources(arg1 lager.Logger) executor.ExecutorResources {
 	fake.remainingResourcesMutex.Lock()
 	ret, specificReturn := fake.remainingResourcesReturnsOnCall[len(fake.remainingResourcesArgsForCall)]
@@ -991,6 +1372,135 @@ func (fake *FakeContainerStore) RunReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeContainerStore) RunProcess(arg1 lager.Logger, arg2 string, arg3 executor.ProcessSpec, arg4 executor.ProcessIO) (executor.Process, error) {
+	fake.runProcessMutex.Lock()
+	ret, specificReturn := fake.runProcessReturnsOnCall[len(fake.runProcessArgsForCall)]
+	fake.runProcessArgsForCall = append(fake.runProcessArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ProcessSpec
+		arg4 executor.ProcessIO
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.RunProcessStub
+	fakeReturns := fake.runProcessReturns
+	fake.recordInvocation("RunProcess", []interface{}{arg1, arg2, arg3, arg4})
+	fake.runProcessMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeContainerStore) RunProcessCallCount() int {
+	fake.runProcessMutex.RLock()
+	defer fake.runProcessMutex.RUnlock()
+	return len(fake.runProcessArgsForCall)
+}
+
+func (fake *FakeContainerStore) RunProcessCalls(stub func(lager.Logger, string, executor.ProcessSpec, executor.ProcessIO) (executor.Process, error)) {
+	fake.runProcessMutex.Lock()
+	defer fake.runProcessMutex.Unlock()
+	fake.RunProcessStub = stub
+}
+
+func (fake *FakeContainerStore) RunProcessArgsForCall(i int) (lager.Logger, string, executor.ProcessSpec, executor.ProcessIO) {
+	fake.runProcessMutex.RLock()
+	defer fake.runProcessMutex.RUnlock()
+	argsForCall := fake.runProcessArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeContainerStore) RunProcessReturns(result1 executor.Process, result2 error) {
+	fake.runProcessMutex.Lock()
+	defer fake.runProcessMutex.Unlock()
+	fake.RunProcessStub = nil
+	fake.runProcessReturns = struct {
+		result1 executor.Process
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeContainerStore) RunProcessReturnsOnCall(i int, result1 executor.Process, result2 error) {
+	fake.runProcessMutex.Lock()
+	defer fake.runProcessMutex.Unlock()
+	fake.RunProcessStub = nil
+	if fake.runProcessReturnsOnCall == nil {
+		fake.runProcessReturnsOnCall = make(map[int]struct {
+			result1 executor.Process
+			result2 error
+		})
+	}
+	fake.runProcessReturnsOnCall[i] = struct {
+		result1 executor.Process
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeContainerStore) SetTotalResources(arg1 lager.Logger, arg2 executor.ExecutorResources) error {
+	fake.setTotalResourcesMutex.Lock()
+	ret, specificReturn := fake.setTotalResourcesReturnsOnCall[len(fake.setTotalResourcesArgsForCall)]
+	fake.setTotalResourcesArgsForCall = append(fake.setTotalResourcesArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 executor.ExecutorResources
+	}{arg1, arg2})
+	stub := fake.SetTotalResourcesStub
+	fakeReturns := fake.setTotalResourcesReturns
+	fake.recordInvocation("SetTotalResources", []interface{}{arg1, arg2})
+	fake.setTotalResourcesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeContainerStore) SetTotalResourcesCallCount() int {
+	fake.setTotalResourcesMutex.RLock()
+	defer fake.setTotalResourcesMutex.RUnlock()
+	return len(fake.setTotalResourcesArgsForCall)
+}
+
+func (fake *FakeContainerStore) SetTotalResourcesCalls(stub func(lager.Logger, executor.ExecutorResources) error) {
+	fake.setTotalResourcesMutex.Lock()
+	defer fake.setTotalResourcesMutex.Unlock()
+	fake.SetTotalResourcesStub = stub
+}
+
+func (fake *FakeContainerStore) SetTotalResourcesArgsForCall(i int) (lager.Logger, executor.ExecutorResources) {
+	fake.setTotalResourcesMutex.RLock()
+	defer fake.setTotalResourcesMutex.RUnlock()
+	argsForCall := fake.setTotalResourcesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeContainerStore) SetTotalResourcesReturns(result1 error) {
+	fake.setTotalResourcesMutex.Lock()
+	defer fake.setTotalResourcesMutex.Unlock()
+	fake.SetTotalResourcesStub = nil
+	fake.setTotalResourcesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeContainerStore) SetTotalResourcesReturnsOnCall(i int, result1 error) {
+	fake.setTotalResourcesMutex.Lock()
+	defer fake.setTotalResourcesMutex.Unlock()
+	fake.SetTotalResourcesStub = nil
+	if fake.setTotalResourcesReturnsOnCall == nil {
+		fake.setTotalResourcesReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setTotalResourcesReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeContainerStore) Stop(arg1 lager.Logger, arg2 string, arg3 string) error {
 	fake.stopMutex.Lock()
 	ret, specificReturn := fake.stopReturnsOnCall[len(fake.stopArgsForCall)]
@@ -1054,6 +1564,70 @@ func (fake *FakeContainerStore) StopReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeContainerStore) StreamIn(arg1 lager.Logger, arg2 string, arg3 string, arg4 io.Reader) error {
+	fake.streamInMutex.Lock()
+	ret, specificReturn := fake.streamInReturnsOnCall[len(fake.streamInArgsForCall)]
+	fake.streamInArgsForCall = append(fake.streamInArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 string
+		arg4 io.Reader
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.StreamInStub
+	fakeReturns := fake.streamInReturns
+	fake.recordInvocation("StreamIn", []interface{}{arg1, arg2, arg3, arg4})
+	fake.streamInMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeContainerStore) StreamInCallCount() int {
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
+	return len(fake.streamInArgsForCall)
+}
+
+func (fake *FakeContainerStore) StreamInCalls(stub func(lager.Logger, string, string, io.Reader) error) {
+	fake.streamInMutex.Lock()
+	defer fake.streamInMutex.Unlock()
+	fake.StreamInStub = stub
+}
+
+func (fake *FakeContainerStore) StreamInArgsForCall(i int) (lager.Logger, string, string, io.Reader) {
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
+	argsForCall := fake.streamInArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeContainerStore) StreamInReturns(result1 error) {
+	fake.streamInMutex.Lock()
+	defer fake.streamInMutex.Unlock()
+	fake.StreamInStub = nil
+	fake.streamInReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeContainerStore) StreamInReturnsOnCall(i int, result1 error) {
+	fake.streamInMutex.Lock()
+	defer fake.streamInMutex.Unlock()
+	fake.StreamInStub = nil
+	if fake.streamInReturnsOnCall == nil {
+		fake.streamInReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.streamInReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeContainerStore) Update(arg1 lager.Logger, arg2 *executor.UpdateRequest) error {
 	fake.updateMutex.Lock()
 	ret, specificReturn := fake.updateReturnsOnCall[len(fake.updateArgsForCall)]
@@ -1125,6 +1699,8 @@ func (fake *FakeContainerStore) Invocations() map[string][][]interface{} {
 	defer fake.createMutex.RUnlock()
 	fake.destroyMutex.RLock()
 	defer fake.destroyMutex.RUnlock()
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
 	fake.getMutex.RLock()
 	defer fake.getMutex.RUnlock()
 	fake.getFilesMutex.RLock()
@@ -1135,18 +1711,32 @@ func (fake *FakeContainerStore) Invocations() map[string][][]interface{} {
 	defer fake.listMutex.RUnlock()
 	fake.metricsMutex.RLock()
 	defer fake.metricsMutex.RUnlock()
+	fake.newCheckpointerMutex.RLock()
+	defer fake.newCheckpointerMutex.RUnlock()
 	fake.newContainerReaperMutex.RLock()
 	defer fake.newContainerReaperMutex.RUnlock()
+	fake.newEgressResolverMutex.RLock()
+	defer fake.newEgressResolverMutex.RUnlock()
+	fake.newPropertySyncerMutex.RLock()
+	defer fake.newPropertySyncerMutex.RUnlock()
 	fake.newRegistryPrunerMutex.RLock()
 	defer fake.newRegistryPrunerMutex.RUnlock()
+	fake.recoverMutex.RLock()
+	defer fake.recoverMutex.RUnlock()
 	fake.remainingResourcesMutex.RLock()
 	defer fake.remainingResourcesMutex.RUnlock()
 	fake.reserveMutex.RLock()
 	defer fake.reserveMutex.RUnlock()
 	fake.runMutex.RLock()
 	defer fake.runMutex.RUnlock()
+	fake.runProcessMutex.RLock()
+	defer fake.runProcessMutex.RUnlock()
+	fake.setTotalResourcesMutex.RLock()
+	defer fake.setTotalResourcesMutex.RUnlock()
 	fake.stopMutex.RLock()
 	defer fake.stopMutex.RUnlock()
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
 	fake.updateMutex.RLock()
 	defer fake.updateMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
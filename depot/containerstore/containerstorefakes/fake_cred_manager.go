@@ -3,6 +3,7 @@ package containerstorefakes
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/containerstore"
@@ -28,6 +29,12 @@ type FakeCredManager struct {
 		result2 []executor.EnvironmentVariable
 		result3 error
 	}
+	DrainStub        func(lager.Logger, time.Duration)
+	drainMutex       sync.RWMutex
+	drainArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 time.Duration
+	}
 	RemoveCredDirStub        func(lager.Logger, executor.Container) error
 	removeCredDirMutex       sync.RWMutex
 	removeCredDirArgsForCall []struct {
@@ -40,6 +47,21 @@ type FakeCredManager struct {
 	removeCredDirReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RestoreRotationDeadlinesStub        func(map[string]time.Time)
+	restoreRotationDeadlinesMutex       sync.RWMutex
+	restoreRotationDeadlinesArgsForCall []struct {
+		arg1 map[string]time.Time
+	}
+	RotationDeadlinesStub        func() map[string]time.Time
+	rotationDeadlinesMutex       sync.RWMutex
+	rotationDeadlinesArgsForCall []struct {
+	}
+	rotationDeadlinesReturns struct {
+		result1 map[string]time.Time
+	}
+	rotationDeadlinesReturnsOnCall map[int]struct {
+		result1 map[string]time.Time
+	}
 	RunnerStub        func(lager.Logger, containerstore.ContainerInfoProvider, <-chan struct{}) ifrit.Runner
 	runnerMutex       sync.RWMutex
 	runnerArgsForCall []struct {
@@ -125,6 +147,39 @@ func (fake *FakeCredManager) CreateCredDirReturnsOnCall(i int, result1 []garden.
 	}{result1, result2, result3}
 }
 
+func (fake *FakeCredManager) Drain(arg1 lager.Logger, arg2 time.Duration) {
+	fake.drainMutex.Lock()
+	fake.drainArgsForCall = append(fake.drainArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 time.Duration
+	}{arg1, arg2})
+	stub := fake.DrainStub
+	fake.recordInvocation("Drain", []interface{}{arg1, arg2})
+	fake.drainMutex.Unlock()
+	if stub != nil {
+		fake.DrainStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeCredManager) DrainCallCount() int {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	return len(fake.drainArgsForCall)
+}
+
+func (fake *FakeCredManager) DrainCalls(stub func(lager.Logger, time.Duration)) {
+	fake.drainMutex.Lock()
+	defer fake.drainMutex.Unlock()
+	fake.DrainStub = stub
+}
+
+func (fake *FakeCredManager) DrainArgsForCall(i int) (lager.Logger, time.Duration) {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	argsForCall := fake.drainArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeCredManager) RemoveCredDir(arg1 lager.Logger, arg2 executor.Container) error {
 	fake.removeCredDirMutex.Lock()
 	ret, specificReturn := fake.removeCredDirReturnsOnCall[len(fake.removeCredDirArgsForCall)]
@@ -187,6 +242,91 @@ func (fake *FakeCredManager) RemoveCredDirReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCredManager) RestoreRotationDeadlines(arg1 map[string]time.Time) {
+	fake.restoreRotationDeadlinesMutex.Lock()
+	fake.restoreRotationDeadlinesArgsForCall = append(fake.restoreRotationDeadlinesArgsForCall, struct {
+		arg1 map[string]time.Time
+	}{arg1})
+	stub := fake.RestoreRotationDeadlinesStub
+	fake.recordInvocation("RestoreRotationDeadlines", []interface{}{arg1})
+	fake.restoreRotationDeadlinesMutex.Unlock()
+	if stub != nil {
+		fake.RestoreRotationDeadlinesStub(arg1)
+	}
+}
+
+func (fake *FakeCredManager) RestoreRotationDeadlinesCallCount() int {
+	fake.restoreRotationDeadlinesMutex.RLock()
+	defer fake.restoreRotationDeadlinesMutex.RUnlock()
+	return len(fake.restoreRotationDeadlinesArgsForCall)
+}
+
+func (fake *FakeCredManager) RestoreRotationDeadlinesCalls(stub func(map[string]time.Time)) {
+	fake.restoreRotationDeadlinesMutex.Lock()
+	defer fake.restoreRotationDeadlinesMutex.Unlock()
+	fake.RestoreRotationDeadlinesStub = stub
+}
+
+func (fake *FakeCredManager) RestoreRotationDeadlinesArgsForCall(i int) map[string]time.Time {
+	fake.restoreRotationDeadlinesMutex.RLock()
+	defer fake.restoreRotationDeadlinesMutex.RUnlock()
+	argsForCall := fake.restoreRotationDeadlinesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCredManager) RotationDeadlines() map[string]time.Time {
+	fake.rotationDeadlinesMutex.Lock()
+	ret, specificReturn := fake.rotationDeadlinesReturnsOnCall[len(fake.rotationDeadlinesArgsForCall)]
+	fake.rotationDeadlinesArgsForCall = append(fake.rotationDeadlinesArgsForCall, struct {
+	}{})
+	stub := fake.RotationDeadlinesStub
+	fakeReturns := fake.rotationDeadlinesReturns
+	fake.recordInvocation("RotationDeadlines", []interface{}{})
+	fake.rotationDeadlinesMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCredManager) RotationDeadlinesCallCount() int {
+	fake.rotationDeadlinesMutex.RLock()
+	defer fake.rotationDeadlinesMutex.RUnlock()
+	return len(fake.rotationDeadlinesArgsForCall)
+}
+
+func (fake *FakeCredManager) RotationDeadlinesCalls(stub func() map[string]time.Time) {
+	fake.rotationDeadlinesMutex.Lock()
+	defer fake.rotationDeadlinesMutex.Unlock()
+	fake.RotationDeadlinesStub = stub
+}
+
+func (fake *FakeCredManager) RotationDeadlinesReturns(result1 map[string]time.Time) {
+	fake.rotationDeadlinesMutex.Lock()
+	defer fake.rotationDeadlinesMutex.Unlock()
+	fake.RotationDeadlinesStub = nil
+	fake.rotationDeadlinesReturns = struct {
+		result1 map[string]time.Time
+	}{result1}
+}
+
+func (fake *FakeCredManager) RotationDeadlinesReturnsOnCall(i int, result1 map[string]time.Time) {
+	fake.rotationDeadlinesMutex.Lock()
+	defer fake.rotationDeadlinesMutex.Unlock()
+	fake.RotationDeadlinesStub = nil
+	if fake.rotationDeadlinesReturnsOnCall == nil {
+		fake.rotationDeadlinesReturnsOnCall = make(map[int]struct {
+			result1 map[string]time.Time
+		})
+	}
+	fake.rotationDeadlinesReturnsOnCall[i] = struct {
+		result1 map[string]time.Time
+	}{result1}
+}
+
 func (fake *FakeCredManager) Runner(arg1 lager.Logger, arg2 containerstore.ContainerInfoProvider, arg3 <-chan struct{}) ifrit.Runner {
 	fake.runnerMutex.Lock()
 	ret, specificReturn := fake.runnerReturnsOnCall[len(fake.runnerArgsForCall)]
@@ -255,8 +395,14 @@ func (fake *FakeCredManager) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.createCredDirMutex.RLock()
 	defer fake.createCredDirMutex.RUnlock()
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
 	fake.removeCredDirMutex.RLock()
 	defer fake.removeCredDirMutex.RUnlock()
+	fake.restoreRotationDeadlinesMutex.RLock()
+	defer fake.restoreRotationDeadlinesMutex.RUnlock()
+	fake.rotationDeadlinesMutex.RLock()
+	defer fake.rotationDeadlinesMutex.RUnlock()
 	fake.runnerMutex.RLock()
 	defer fake.runnerMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
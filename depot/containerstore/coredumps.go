@@ -0,0 +1,232 @@
+package containerstore
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+var ErrCoreDumpQuotaExceeded = errors.New("core dump exceeds the core dump quota of the cell")
+
+// coreDumpCollector copies the core files left behind by failed containers
+// into a directory on the cell, one subdirectory per container. Each core is
+// truncated to maxBytes, and the oldest cores are evicted to keep the
+// directory under quota bytes.
+type coreDumpCollector struct {
+	dir      string
+	globs    []string
+	maxBytes int64
+	quota    int64
+	compress bool
+
+	lock sync.Mutex
+}
+
+// newCoreDumpCollector returns nil, which never collects anything, unless
+// both a directory and globs are configured.
+func newCoreDumpCollector(config *ContainerConfig) *coreDumpCollector {
+	if config.CoreDumpDir == "" || len(config.CoreDumpGlobs) == 0 {
+		return nil
+	}
+
+	return &coreDumpCollector{
+		dir:      config.CoreDumpDir,
+		globs:    config.CoreDumpGlobs,
+		maxBytes: config.MaxCoreDumpBytes,
+		quota:    config.CoreDumpQuotaBytes,
+		compress: config.CompressCoreDumps,
+	}
+}
+
+// Collect copies the regular files matching the core dump globs out of the
+// container and returns their names. Only the last element of a glob may
+// contain wildcards.
+func (c *coreDumpCollector) Collect(logger lager.Logger, guid string, gardenContainer garden.Container) []string {
+	if c == nil {
+		return nil
+	}
+	logger = logger.Session("collect-core-dumps")
+
+	var names []string
+	for _, glob := range c.globs {
+		dir, pattern := path.Split(path.Clean(glob))
+
+		stream, err := gardenContainer.StreamOut(garden.StreamOutSpec{Path: dir, User: "root"})
+		if err != nil {
+			logger.Error("failed-to-stream-out", err, lager.Data{"glob": glob})
+			continue
+		}
+
+		tarReader := tar.NewReader(stream)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				logger.Error("failed-to-read-stream", err, lager.Data{"glob": glob})
+				break
+			}
+
+			name := strings.TrimPrefix(path.Clean(header.Name), "./")
+			if header.Typeflag != tar.TypeReg || strings.Contains(name, "/") {
+				continue
+			}
+			if matched, _ := path.Match(pattern, name); !matched {
+				continue
+			}
+
+			stored, err := c.store(logger, guid, name, tarReader, header.Size)
+			if err != nil {
+				logger.Error("failed-to-store-core-dump", err, lager.Data{"path": path.Join(dir, name)})
+				continue
+			}
+			logger.Info("stored-core-dump", lager.Data{"path": path.Join(dir, name), "name": stored})
+			names = append(names, stored)
+		}
+		stream.Close()
+	}
+
+	return names
+}
+
+func (c *coreDumpCollector) store(logger lager.Logger, guid, name string, content io.Reader, size int64) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.maxBytes > 0 && size > c.maxBytes {
+		size = c.maxBytes
+	}
+
+	// compressed cores are accounted for at their uncompressed size
+	if c.quota > 0 {
+		if size > c.quota {
+			return "", ErrCoreDumpQuotaExceeded
+		}
+		err := c.evict(logger, c.quota-size)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	containerDir := filepath.Join(c.dir, guid)
+	err := os.MkdirAll(containerDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	if c.compress {
+		name += ".gz"
+	}
+	file, err := os.OpenFile(filepath.Join(containerDir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	if c.compress {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		w = gz
+	}
+
+	_, err = io.Copy(w, io.LimitReader(content, size))
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// evict removes the oldest core dumps until at most limit bytes are used.
+func (c *coreDumpCollector) evict(logger lager.Logger, limit int64) error {
+	type coreDump struct {
+		path string
+		size int64
+		mod  int64
+	}
+
+	var dumps []coreDump
+	var used int64
+	err := filepath.Walk(c.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			dumps = append(dumps, coreDump{path: p, size: info.Size(), mod: info.ModTime().UnixNano()})
+			used += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].mod < dumps[j].mod })
+	for _, dump := range dumps {
+		if used <= limit {
+			break
+		}
+		logger.Info("evicting-core-dump", lager.Data{"path": dump.path})
+		err := os.Remove(dump.path)
+		if err != nil {
+			return err
+		}
+		used -= dump.size
+	}
+	return nil
+}
+
+// Open returns a tar stream of the named core dump of the container, in the
+// same format as garden.Container.StreamOut.
+func (c *coreDumpCollector) Open(guid, name string) (io.ReadCloser, error) {
+	if c == nil || name == "" || name != filepath.Base(name) {
+		return nil, executor.ErrContainerNotFound
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, guid, name))
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer file.Close()
+
+		tarWriter := tar.NewWriter(writer)
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		if err == nil {
+			_, err = io.Copy(tarWriter, file)
+		}
+		if err == nil {
+			err = tarWriter.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	return reader, nil
+}
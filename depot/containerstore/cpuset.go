@@ -0,0 +1,188 @@
+package containerstore
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/executor"
+)
+
+// cpusetManager pins the containers that request exclusive CPUs to dedicated
+// cores of the cell. Each core is assigned to at most one container at a
+// time.
+type cpusetManager struct {
+	lock     sync.Mutex
+	cpus     []int
+	assigned map[int]string
+}
+
+// newCPUSetManager returns nil, which cannot allocate any core, when the cell
+// has no exclusive cores.
+func newCPUSetManager(cpus []int) *cpusetManager {
+	if len(cpus) == 0 {
+		return nil
+	}
+
+	return &cpusetManager{
+		cpus:     append([]int{}, cpus...),
+		assigned: make(map[int]string),
+	}
+}
+
+// Allocate assigns count free cores to the container with the given guid.
+func (m *cpusetManager) Allocate(guid string, count int) ([]int, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	if m == nil {
+		return nil, executor.ErrInsufficientResourcesAvailable
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var allocated []int
+	for _, cpu := range m.cpus {
+		if _, ok := m.assigned[cpu]; ok {
+			continue
+		}
+		allocated = append(allocated, cpu)
+		if len(allocated) == count {
+			break
+		}
+	}
+
+	if len(allocated) < count {
+		return nil, executor.ErrInsufficientResourcesAvailable
+	}
+
+	for _, cpu := range allocated {
+		m.assigned[cpu] = guid
+	}
+	return allocated, nil
+}
+
+// Claim assigns the given cores to the container with the given guid, e.g.
+// when the container is recovered. It fails if any of them is not an
+// exclusive core or is assigned to another container.
+func (m *cpusetManager) Claim(guid string, cpus []int) error {
+	if len(cpus) == 0 {
+		return nil
+	}
+	if m == nil {
+		return executor.ErrInsufficientResourcesAvailable
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, cpu := range cpus {
+		owner, assigned := m.assigned[cpu]
+		if !m.known(cpu) || (assigned && owner != guid) {
+			return executor.ErrInsufficientResourcesAvailable
+		}
+	}
+
+	for _, cpu := range cpus {
+		m.assigned[cpu] = guid
+	}
+	return nil
+}
+
+func (m *cpusetManager) known(cpu int) bool {
+	for _, c := range m.cpus {
+		if c == cpu {
+			return true
+		}
+	}
+	return false
+}
+
+// Free returns cores that were allocated but never handed to a container.
+func (m *cpusetManager) Free(cpus []int) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, cpu := range cpus {
+		delete(m.assigned, cpu)
+	}
+}
+
+// Release frees the cores assigned to the container with the given guid.
+func (m *cpusetManager) Release(guid string) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for cpu, owner := range m.assigned {
+		if owner == guid {
+			delete(m.assigned, cpu)
+		}
+	}
+}
+
+// ParseCPUSet parses a list of cores in the cpuset format of the kernel,
+// e.g. 0-3,8.
+func ParseCPUSet(list string) ([]int, error) {
+	seen := map[int]bool{}
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpu %q", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpu range %q", part)
+			}
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// FormatCPUSet formats cores in the cpuset format of the kernel.
+func FormatCPUSet(cpus []int) string {
+	sorted := append([]int{}, cpus...)
+	sort.Ints(sorted)
+
+	var parts []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(sorted[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
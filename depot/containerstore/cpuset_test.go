@@ -0,0 +1,35 @@
+package containerstore_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/executor/depot/containerstore"
+)
+
+var _ = Describe("CPUSet", func() {
+	It("parses lists and ranges of cores", func() {
+		cpus, err := containerstore.ParseCPUSet("8, 0-3,2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cpus).To(Equal([]int{0, 1, 2, 3, 8}))
+	})
+
+	It("parses an empty list", func() {
+		cpus, err := containerstore.ParseCPUSet("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cpus).To(BeEmpty())
+	})
+
+	It("rejects invalid cores and ranges", func() {
+		_, err := containerstore.ParseCPUSet("a")
+		Expect(err).To(MatchError(`invalid cpu "a"`))
+
+		_, err = containerstore.ParseCPUSet("4-2")
+		Expect(err).To(MatchError(`invalid cpu range "4-2"`))
+	})
+
+	It("formats cores as lists and ranges", func() {
+		Expect(containerstore.FormatCPUSet([]int{8, 2, 3, 4, 6})).To(Equal("2-4,6,8"))
+		Expect(containerstore.FormatCPUSet(nil)).To(Equal(""))
+	})
+})
@@ -0,0 +1,149 @@
+package containerstore
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	ContainerCrashLoopBackoffCount = "ContainerCrashLoopBackoffCount"
+
+	crashLoopInitialBackoff = time.Second
+	crashLoopMaxShift       = 16
+)
+
+// crashLoopDetector counts the failures of containers created from the same
+// definition, i.e. the same process guid and index, on the cell. Once a
+// definition failed threshold times within the window, every further run of
+// it is delayed with an exponential backoff, regardless of the backoff
+// applied upstream.
+type crashLoopDetector struct {
+	clock      clock.Clock
+	threshold  int
+	window     time.Duration
+	maxBackoff time.Duration
+
+	lock    sync.Mutex
+	crashes map[string][]time.Time
+}
+
+func newCrashLoopDetector(clock clock.Clock, threshold int, window, maxBackoff time.Duration) *crashLoopDetector {
+	return &crashLoopDetector{
+		clock:      clock,
+		threshold:  threshold,
+		window:     window,
+		maxBackoff: maxBackoff,
+		crashes:    map[string][]time.Time{},
+	}
+}
+
+func crashLoopKey(container executor.Container) string {
+	if container.MetricsConfig.Guid == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", container.MetricsConfig.Guid, container.MetricsConfig.Index)
+}
+
+// RecordCompletion counts the container as a crash if it failed without
+// being stopped.
+func (d *crashLoopDetector) RecordCompletion(container executor.Container) {
+	key := crashLoopKey(container)
+	if d.threshold <= 0 || key == "" {
+		return
+	}
+	if container.State != executor.StateCompleted || !container.RunResult.Failed || container.RunResult.Stopped {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := d.clock.Now()
+	for k := range d.crashes {
+		d.crashes[k] = d.recent(k, now)
+		if len(d.crashes[k]) == 0 {
+			delete(d.crashes, k)
+		}
+	}
+	d.crashes[key] = append(d.crashes[key], now)
+}
+
+// Backoff returns the number of recent crashes of the definition of the
+// container and how long its next run should be delayed.
+func (d *crashLoopDetector) Backoff(container executor.Container) (int, time.Duration) {
+	key := crashLoopKey(container)
+	if d.threshold <= 0 || key == "" {
+		return 0, 0
+	}
+
+	d.lock.Lock()
+	crashes := len(d.recent(key, d.clock.Now()))
+	d.lock.Unlock()
+
+	if crashes < d.threshold {
+		return crashes, 0
+	}
+
+	shift := crashes - d.threshold
+	if shift > crashLoopMaxShift {
+		shift = crashLoopMaxShift
+	}
+	backoff := crashLoopInitialBackoff << uint(shift)
+	if d.maxBackoff > 0 && backoff > d.maxBackoff {
+		backoff = d.maxBackoff
+	}
+	return crashes, backoff
+}
+
+func (d *crashLoopDetector) recent(key string, now time.Time) []time.Time {
+	var recent []time.Time
+	for _, t := range d.crashes[key] {
+		if now.Sub(t) < d.window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// backoffWaiter becomes ready once the backoff has elapsed.
+type backoffWaiter struct {
+	logger  lager.Logger
+	clock   clock.Clock
+	backoff time.Duration
+}
+
+func newBackoffWaiter(logger lager.Logger, clock clock.Clock, backoff time.Duration) *backoffWaiter {
+	return &backoffWaiter{
+		logger:  logger,
+		clock:   clock,
+		backoff: backoff,
+	}
+}
+
+func (w *backoffWaiter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := w.logger.Session("crash-loop-backoff")
+	logger.Info("waiting", lager.Data{"backoff": w.backoff.String()})
+
+	timer := w.clock.NewTimer(w.backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+	case signal := <-signals:
+		logger.Info("signalled", lager.Data{"signal": signal.String()})
+		return nil
+	}
+
+	logger.Info("backoff-elapsed")
+	close(ready)
+
+	signal := <-signals
+	logger.Debug("signalled", lager.Data{"signal": signal.String()})
+	return nil
+}
@@ -2,14 +2,21 @@ package containerstore
 
 import (
 	"bytes"
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"io"
 	"math/big"
+	"math/rand"
 	"net"
+	"net/url"
 	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
@@ -19,7 +26,9 @@ import (
 	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/clockskew"
 	"code.cloudfoundry.org/garden"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/routing-info/internalroutes"
 )
@@ -31,11 +40,19 @@ const (
 	C2CCredCreationSucceededCount    = "C2CCredCreationSucceededCount"
 	C2CCredCreationSucceededDuration = "C2CCredCreationSucceededDuration"
 	C2CCredCreationFailedCount       = "C2CCredCreationFailedCount"
+	CredValidityRemainingSeconds     = "CredValidityRemainingSeconds"
 )
 
+const credValidityReportInterval = time.Minute
+
 type Credentials struct {
 	InstanceIdentityCredential Credential
 	C2CCredential              Credential
+
+	// TrustBundle is the PEM-encoded certificates of the CAs trusted for
+	// instance identity credentials, newest first. It is set whenever the
+	// instance identity credential is.
+	TrustBundle string
 }
 
 type Credential struct {
@@ -57,6 +74,20 @@ type CredManager interface {
 	CreateCredDir(lager.Logger, executor.Container) ([]garden.BindMount, []executor.EnvironmentVariable, error)
 	RemoveCredDir(lager.Logger, executor.Container) error
 	Runner(lager.Logger, ContainerInfoProvider, <-chan struct{}) ifrit.Runner
+
+	// Drain rotates the credentials of all the containers right away, with a
+	// validity that only covers the drain window of the cell, and stops
+	// rotating them afterwards.
+	Drain(logger lager.Logger, window time.Duration)
+
+	// RotationDeadlines returns when the credentials of each container are
+	// next rotated, by container guid.
+	RotationDeadlines() map[string]time.Time
+
+	// RestoreRotationDeadlines makes the containers recovered from a
+	// checkpoint keep the rotation schedule they had before the executor
+	// restarted, instead of all rotating together one rotation period later.
+	RestoreRotationDeadlines(deadlines map[string]time.Time)
 }
 
 type noopManager struct{}
@@ -73,6 +104,14 @@ func (c *noopManager) RemoveCredDir(logger lager.Logger, container executor.Cont
 	return nil
 }
 
+func (c *noopManager) Drain(lager.Logger, time.Duration) {}
+
+func (c *noopManager) RotationDeadlines() map[string]time.Time {
+	return nil
+}
+
+func (c *noopManager) RestoreRotationDeadlines(map[string]time.Time) {}
+
 func (c *noopManager) Runner(lager.Logger, ContainerInfoProvider, <-chan struct{}) ifrit.Runner {
 	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
 		close(ready)
@@ -87,9 +126,63 @@ type credManager struct {
 	validityPeriod time.Duration
 	entropyReader  io.Reader
 	clock          clock.Clock
-	CaCert         *x509.Certificate
-	privateKey     *rsa.PrivateKey
+	trustBundle    string
+	signer         CertificateSigner
+	keyGenerator   KeyGenerator
+	trustDomain    string
+	sanAllowlist   SANAllowlist
+	rotation       RotationConfig
+	clockJumps     *clockskew.Detector
 	handlers       []CredentialHandler
+
+	drainLock   sync.Mutex
+	drainWindow time.Duration
+	drains      map[chan time.Duration]struct{}
+
+	deadlineLock sync.Mutex
+	deadlines    map[string]time.Time
+	restored     map[string]time.Time
+}
+
+// RotationConfig controls when the CredManager rotates credentials ahead of
+// their expiry.
+type RotationConfig struct {
+	// Fraction of the validity period after which credentials are rotated.
+	// When zero, credentials are rotated 30 minutes before they expire, or
+	// after 7/8 of the validity period if it is shorter than 4 hours.
+	Fraction float64
+
+	// Jitter is the upper bound of a random duration, picked once per
+	// container, by which rotation is brought forward. It spreads the load of
+	// regenerating credentials on cells running many containers.
+	Jitter time.Duration
+
+	// RetryAttempts is the number of times a failed rotation is retried
+	// before the container is failed. The current credentials keep being
+	// served while retrying. When zero, the first failure fails the container.
+	RetryAttempts int
+
+	// RetryBackoff is the delay before the first retry. It doubles with every
+	// subsequent attempt.
+	RetryBackoff time.Duration
+
+	// MinValidity is the remaining validity of the current credentials below
+	// which a failed rotation fails the container instead of being retried.
+	MinValidity time.Duration
+}
+
+// retryDelay returns how long to wait before retrying a failed rotation, or
+// false if the container should be failed instead.
+func (r RotationConfig) retryDelay(attempt int, remaining time.Duration) (time.Duration, bool) {
+	if attempt > r.RetryAttempts || remaining <= r.MinValidity {
+		return 0, false
+	}
+
+	delay := r.RetryBackoff << (attempt - 1)
+	if delay <= 0 || delay > remaining-r.MinValidity {
+		delay = remaining - r.MinValidity
+	}
+	return delay, true
 }
 
 //go:generate counterfeiter -o containerstorefakes/fake_cred_handler.go . CredentialHandler
@@ -111,35 +204,136 @@ type CredentialHandler interface {
 	Close(invalidCredentials Credentials, container executor.Container) error
 }
 
-func NewCredManager(
-	logger lager.Logger,
-	metronClient loggingclient.IngressClient,
-	validityPeriod time.Duration,
-	entropyReader io.Reader,
-	clock clock.Clock,
-	CaCert *x509.Certificate,
-	privateKey *rsa.PrivateKey,
-	handlers ...CredentialHandler,
-) CredManager {
+// ErrNoSigningCA is returned when none of the CAs can sign credentials locally.
+var ErrNoSigningCA = errors.New("no instance identity CA has a private key")
+
+// CA is a certificate authority trusted for instance identity credentials.
+// Key is only needed for the CA that signs the credentials locally.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// SigningCA returns the most recently issued CA that has a private key, or
+// ErrNoSigningCA if none has.
+func SigningCA(cas []CA) (CA, error) {
+	var signing CA
+	found := false
+	for _, ca := range cas {
+		if ca.Key == nil {
+			continue
+		}
+		if !found || ca.Cert.NotBefore.After(signing.Cert.NotBefore) {
+			signing = ca
+			found = true
+		}
+	}
+	if !found {
+		return CA{}, ErrNoSigningCA
+	}
+	return signing, nil
+}
+
+// TrustBundle returns the certificates of the CAs, newest first. While a CA is
+// being rotated both the old and the new CA are in the bundle, so that peers
+// that only trust one of them can still validate the chain.
+func TrustBundle(cas []CA) []*x509.Certificate {
+	bundle := make([]*x509.Certificate, 0, len(cas))
+	for _, ca := range cas {
+		bundle = append(bundle, ca.Cert)
+	}
+	sort.SliceStable(bundle, func(i, j int) bool {
+		return bundle[i].NotBefore.After(bundle[j].NotBefore)
+	})
+	return bundle
+}
+
+// CredManagerOptions are the options of the credentials generated by a
+// CredManager, whatever signs them.
+type CredManagerOptions struct {
+	Logger         lager.Logger
+	MetronClient   loggingclient.IngressClient
+	ValidityPeriod time.Duration
+	EntropyReader  io.Reader
+	Clock          clock.Clock
+	KeyGenerator   KeyGenerator
+	TrustDomain    string
+	SANAllowlist   SANAllowlist
+	Rotation       RotationConfig
+
+	// ClockJumps, when set, makes the CredManager rotate the credentials
+	// when the clock of the cell jumps, after the jitter of each container.
+	ClockJumps *clockskew.Detector
+
+	Handlers []CredentialHandler
+}
+
+// NewCredManager returns a CredManager that signs credentials with the newest
+// of the given CAs that has a private key, and appends the certificates of
+// all the CAs to the generated certificates. It returns ErrNoSigningCA if
+// none of the CAs has a private key.
+func NewCredManager(options CredManagerOptions, cas []CA) (CredManager, error) {
+	signingCA, err := SigningCA(cas)
+	if err != nil {
+		return nil, err
+	}
+	signer := NewLocalSigner(options.EntropyReader, signingCA.Cert, signingCA.Key, TrustBundle(cas))
+	return NewCredManagerWithSigner(options, TrustBundle(cas), signer), nil
+}
+
+// NewCredManagerWithSigner returns a CredManager that delegates signing of
+// the generated credentials to signer, e.g. an external CA. The generated
+// certificates carry the chain returned by signer; the certificates in
+// caBundle are given to the containers as their trust bundle.
+func NewCredManagerWithSigner(options CredManagerOptions, caBundle []*x509.Certificate, signer CertificateSigner) CredManager {
+	var trustBundle bytes.Buffer
+	for _, caCert := range caBundle {
+		pemEncode(caCert.Raw, certificatePEMBlockType, &trustBundle)
+	}
+
 	return &credManager{
-		logger:         logger,
-		metronClient:   metronClient,
-		validityPeriod: validityPeriod,
-		entropyReader:  entropyReader,
-		clock:          clock,
-		CaCert:         CaCert,
-		privateKey:     privateKey,
-		handlers:       handlers,
+		logger:         options.Logger,
+		metronClient:   options.MetronClient,
+		validityPeriod: options.ValidityPeriod,
+		entropyReader:  options.EntropyReader,
+		clock:          options.Clock,
+		trustBundle:    trustBundle.String(),
+		signer:         signer,
+		keyGenerator:   options.KeyGenerator,
+		trustDomain:    options.TrustDomain,
+		sanAllowlist:   options.SANAllowlist,
+		rotation:       options.Rotation,
+		clockJumps:     options.ClockJumps,
+		handlers:       options.Handlers,
+		drains:         map[chan time.Duration]struct{}{},
+		deadlines:      map[string]time.Time{},
+		restored:       map[string]time.Time{},
 	}
 }
 
-func calculateCredentialRotationPeriod(validityPeriod time.Duration) time.Duration {
-	if validityPeriod > 4*time.Hour {
-		return validityPeriod - 30*time.Minute
+func calculateCredentialRotationPeriod(validityPeriod time.Duration, rotation RotationConfig, jitter time.Duration) time.Duration {
+	var period time.Duration
+	switch {
+	case rotation.Fraction > 0 && rotation.Fraction < 1:
+		period = time.Duration(float64(validityPeriod) * rotation.Fraction)
+	case validityPeriod > 4*time.Hour:
+		period = validityPeriod - 30*time.Minute
+	default:
+		eighth := validityPeriod / 8
+		period = validityPeriod - eighth
 	}
 
-	eighth := validityPeriod / 8
-	return validityPeriod - eighth
+	if jitter > period/2 {
+		jitter = period / 2
+	}
+	return period - jitter
+}
+
+func (c *credManager) rotationJitter() time.Duration {
+	if c.rotation.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(c.rotation.Jitter) + 1))
 }
 
 func (c *credManager) CreateCredDir(logger lager.Logger, container executor.Container) ([]garden.BindMount, []executor.EnvironmentVariable, error) {
@@ -179,24 +373,117 @@ func (c *credManager) RemoveCredDir(logger lager.Logger, container executor.Cont
 	return err.ErrorOrNil()
 }
 
+func (c *credManager) Drain(logger lager.Logger, window time.Duration) {
+	logger = logger.Session("cred-manager-drain", lager.Data{"window": window.String()})
+	if window <= 0 {
+		logger.Info("ignoring-drain-without-window")
+		return
+	}
+
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+
+	logger.Info("draining", lager.Data{"containers": len(c.drains)})
+	c.drainWindow = window
+	for ch := range c.drains {
+		select {
+		case ch <- window:
+		default:
+		}
+	}
+}
+
+func (c *credManager) RotationDeadlines() map[string]time.Time {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+
+	deadlines := make(map[string]time.Time, len(c.deadlines))
+	for guid, deadline := range c.deadlines {
+		deadlines[guid] = deadline
+	}
+	return deadlines
+}
+
+func (c *credManager) RestoreRotationDeadlines(deadlines map[string]time.Time) {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+
+	for guid, deadline := range deadlines {
+		c.restored[guid] = deadline
+	}
+}
+
+// restoredRotationDeadline returns the rotation deadline the container had
+// before the executor restarted, once.
+func (c *credManager) restoredRotationDeadline(guid string) (time.Time, bool) {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+
+	deadline, ok := c.restored[guid]
+	delete(c.restored, guid)
+	return deadline, ok
+}
+
+// setRotationDeadline records that the credentials of the container are
+// rotated after delay, or that they are no longer rotated when it is zero.
+func (c *credManager) setRotationDeadline(guid string, delay time.Duration) {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+
+	if delay <= 0 {
+		delete(c.deadlines, guid)
+		return
+	}
+	c.deadlines[guid] = c.clock.Now().Add(delay)
+}
+
+// subscribeToDrain returns the drain window if the cell is already draining,
+// so that containers created while draining get short-lived credentials too.
+func (c *credManager) subscribeToDrain() (chan time.Duration, time.Duration) {
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+
+	ch := make(chan time.Duration, 1)
+	c.drains[ch] = struct{}{}
+	return ch, c.drainWindow
+}
+
+func (c *credManager) unsubscribeFromDrain(ch chan time.Duration) {
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+	delete(c.drains, ch)
+}
+
 func (c *credManager) Runner(logger lager.Logger, containerInfoProvider ContainerInfoProvider, regenerateCertsCh <-chan struct{}) ifrit.Runner {
 	runner := ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
 		logger = logger.Session("cred-manager-runner")
 		logger.Info("starting")
 		defer logger.Info("complete")
 
+		drains, drainWindow := c.subscribeToDrain()
+		defer c.unsubscribeFromDrain(drains)
+
+		// once the cell drains, credentials are only valid for the drain
+		// window and no longer rotated
+		validity := c.validityPeriod
+		draining := drainWindow > 0
+		if draining {
+			validity = drainWindow
+		}
+
 		initialContainer := containerInfoProvider.Info()
-		idCred, err := c.generateInstanceIdentityCred(logger, initialContainer, initialContainer.Guid)
+		expiry := c.clock.Now().Add(validity)
+		idCred, err := c.generateInstanceIdentityCred(logger, initialContainer, initialContainer.Guid, validity)
 		if err != nil {
 			return err
 		}
 
-		c2cCred, err := c.generateC2cCred(logger, initialContainer, initialContainer.Guid)
+		c2cCred, err := c.generateC2cCred(logger, initialContainer, initialContainer.Guid, validity)
 		if err != nil {
 			return err
 		}
 
-		creds := Credentials{InstanceIdentityCredential: idCred, C2CCredential: c2cCred}
+		creds := Credentials{InstanceIdentityCredential: idCred, C2CCredential: c2cCred, TrustBundle: c.trustBundle}
 		for _, h := range c.handlers {
 			err := h.Update(creds, initialContainer)
 			if err != nil {
@@ -204,41 +491,140 @@ func (c *credManager) Runner(logger lager.Logger, containerInfoProvider Containe
 			}
 		}
 
-		rotationDuration := calculateCredentialRotationPeriod(c.validityPeriod)
+		guid := initialContainer.Guid
+		jitter := c.rotationJitter()
+		rotationDuration := calculateCredentialRotationPeriod(c.validityPeriod, c.rotation, jitter)
+		if deadline, ok := c.restoredRotationDeadline(guid); ok {
+			remaining := deadline.Sub(c.clock.Now())
+			if remaining > 0 && remaining < rotationDuration {
+				rotationDuration = remaining
+			}
+		}
 		regenCertTimer := c.clock.NewTimer(rotationDuration)
+		defer c.setRotationDeadline(guid, 0)
+		if draining {
+			regenCertTimer.Stop()
+		} else {
+			c.setRotationDeadline(guid, rotationDuration)
+		}
+
+		// scheduleRotation rotates the credentials after delay, and records
+		// when for the checkpoint of the container store.
+		scheduleRotation := func(delay time.Duration) {
+			regenCertTimer.Reset(delay)
+			c.setRotationDeadline(guid, delay)
+		}
+		stopRotating := func() {
+			regenCertTimer.Stop()
+			c.setRotationDeadline(guid, 0)
+		}
+
+		clockJumps := c.clockJumps.Subscribe()
+		defer c.clockJumps.Unsubscribe(clockJumps)
+
+		validityTicker := c.clock.NewTicker(credValidityReportInterval)
+		defer validityTicker.Stop()
+		c.emitValidityRemaining(logger, initialContainer, expiry)
 
 		close(ready)
 
 		regenLogger := logger.Session("regenerating-cert-and-key")
+		failedAttempts := 0
+		rotateCredentials := func() error {
+			container := containerInfoProvider.Info()
+			newExpiry := c.clock.Now().Add(validity)
+			idCred, err := c.generateInstanceIdentityCred(logger, container, container.Guid, validity)
+			if err != nil {
+				return err
+			}
+
+			c2cCred, err := c.generateC2cCred(logger, container, container.Guid, validity)
+			if err != nil {
+				return err
+			}
+
+			creds := Credentials{InstanceIdentityCredential: idCred, C2CCredential: c2cCred, TrustBundle: c.trustBundle}
+			for _, h := range c.handlers {
+				err := h.Update(creds, container)
+				if err != nil {
+					return err
+				}
+			}
+			failedAttempts = 0
+			expiry = newExpiry
+			c.emitValidityRemaining(logger, container, expiry)
+			if !draining {
+				rotationDuration = calculateCredentialRotationPeriod(c.validityPeriod, c.rotation, jitter)
+				scheduleRotation(rotationDuration)
+			}
+			regenLogger.Debug("completed")
+			return nil
+		}
+
+		// rotationFailed keeps the current credentials in place and schedules
+		// a retry as long as the retry policy allows it.
+		rotationFailed := func(err error) error {
+			failedAttempts++
+			remaining := expiry.Sub(c.clock.Now())
+			delay, retry := c.rotation.retryDelay(failedAttempts, remaining)
+			if !retry {
+				regenLogger.Error("failed", err, lager.Data{"attempts": failedAttempts, "remaining-validity": remaining.String()})
+				return err
+			}
+
+			regenLogger.Error("failed-retrying", err, lager.Data{"attempt": failedAttempts, "retry-in": delay.String()})
+			scheduleRotation(delay)
+			return nil
+		}
+
 		for {
 			select {
 			case <-regenCertTimer.C():
 				regenLogger.Debug("on-timer")
-				container := containerInfoProvider.Info()
-				idCred, err := c.generateInstanceIdentityCred(logger, container, container.Guid)
+				err := rotateCredentials()
 				if err != nil {
-					return err
+					if err := rotationFailed(err); err != nil {
+						return err
+					}
 				}
-
-				c2cCred, err := c.generateC2cCred(logger, container, container.Guid)
+			case <-validityTicker.C():
+				c.emitValidityRemaining(logger, containerInfoProvider.Info(), expiry)
+			case jump := <-clockJumps:
+				// the validity of the current credentials was computed from a
+				// wall clock that can no longer be trusted. They are rotated
+				// after the jitter of the container, so that the containers of
+				// the cell do not all rotate at once, unless they expire first.
+				delay := jitter
+				if delay >= expiry.Sub(c.clock.Now()) {
+					delay = 0
+				}
+				regenLogger.Info("on-clock-jump", lager.Data{"skew": jump.Skew.String(), "rotate-in": delay.String()})
+				if delay > 0 {
+					scheduleRotation(delay)
+					continue
+				}
+				stopRotating()
+				err := rotateCredentials()
 				if err != nil {
-					return err
+					if err := rotationFailed(err); err != nil {
+						return err
+					}
 				}
-
-				creds := Credentials{InstanceIdentityCredential: idCred, C2CCredential: c2cCred}
-				for _, h := range c.handlers {
-					err := h.Update(creds, container)
-					if err != nil {
+			case window := <-drains:
+				regenLogger.Info("on-drain", lager.Data{"window": window.String()})
+				draining = true
+				validity = window
+				stopRotating()
+				err := rotateCredentials()
+				if err != nil {
+					if err := rotationFailed(err); err != nil {
 						return err
 					}
 				}
-				rotationDuration = calculateCredentialRotationPeriod(c.validityPeriod)
-				regenCertTimer.Reset(rotationDuration)
-				regenLogger.Debug("completed")
 			case <-regenerateCertsCh:
 				regenLogger.Debug("on-update")
 				container := containerInfoProvider.Info()
-				cred, err := c.generateC2cCred(logger, container, container.Guid)
+				cred, err := c.generateC2cCred(logger, container, container.Guid, validity)
 				if err != nil {
 					return err
 				}
@@ -255,12 +641,12 @@ func (c *credManager) Runner(logger lager.Logger, containerInfoProvider Containe
 			case signal := <-signals:
 				logger.Info("on-signal", lager.Data{"signal": signal.String()})
 				container := containerInfoProvider.Info()
-				idCred, err := c.generateInstanceIdentityCred(logger, container, "")
+				idCred, err := c.generateInstanceIdentityCred(logger, container, "", c.validityPeriod)
 				if err != nil {
 					return err
 				}
 
-				c2cCred, err := c.generateC2cCred(logger, container, "")
+				c2cCred, err := c.generateC2cCred(logger, container, "", c.validityPeriod)
 				if err != nil {
 					return err
 				}
@@ -277,12 +663,35 @@ func (c *credManager) Runner(logger lager.Logger, containerInfoProvider Containe
 	return runner
 }
 
+// emitValidityRemaining reports how long the current instance identity
+// credentials remain valid, tagged with the app and instance they belong to.
+func (c *credManager) emitValidityRemaining(logger lager.Logger, container executor.Container, expiry time.Time) {
+	remaining := expiry.Sub(c.clock.Now())
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	tags := map[string]string{
+		"source_id":     container.MetricsConfig.Guid,
+		"instance_id":   strconv.Itoa(container.MetricsConfig.Index),
+		"instance_guid": container.Guid,
+	}
+	if sourceID, ok := container.MetricsConfig.Tags["source_id"]; ok {
+		tags["source_id"] = sourceID
+	}
+
+	err := c.metronClient.SendMetric(CredValidityRemainingSeconds, int(remaining/time.Second), loggregator.WithEnvelopeTags(tags))
+	if err != nil {
+		logger.Error("failed-to-send-cred-validity-metric", err)
+	}
+}
+
 const (
 	certificatePEMBlockType = "CERTIFICATE"
 	privateKeyPEMBlockType  = "RSA PRIVATE KEY"
 )
 
-func (c *credManager) generateInstanceIdentityCred(logger lager.Logger, container executor.Container, certGUID string) (Credential, error) {
+func (c *credManager) generateInstanceIdentityCred(logger lager.Logger, container executor.Container, certGUID string, validity time.Duration) (Credential, error) {
 	logger = logger.Session("generating-instance-identity-credentials")
 	logger.Debug("starting")
 	defer logger.Debug("complete")
@@ -291,11 +700,28 @@ func (c *credManager) generateInstanceIdentityCred(logger lager.Logger, containe
 		ipForCert = container.ExternalIP
 	}
 
+	certSAN := certificateSAN{IPAddress: ipForCert, OrganizationalUnits: container.CertificateProperties.OrganizationalUnit}
+	if certGUID != "" {
+		spiffeID := c.spiffeID(container, certGUID)
+		if spiffeID != nil {
+			certSAN.URIs = []*url.URL{spiffeID}
+		}
+
+		err := c.addCustomSANs(&certSAN, container)
+		if err != nil {
+			logger.Error("invalid-custom-sans", err)
+			c.metronClient.IncrementCounter(CredCreationFailedCount)
+			return Credential{}, err
+		}
+	}
+
+	// dual-stack containers are reachable on both of their addresses
+	if container.InternalIPv6 != "" && container.InternalIPv6 != ipForCert {
+		certSAN.IPAddresses = append(certSAN.IPAddresses, net.ParseIP(container.InternalIPv6))
+	}
+
 	start := c.clock.Now()
-	idCred, err := c.generateCredForSAN(logger,
-		certificateSAN{IPAddress: ipForCert, OrganizationalUnits: container.CertificateProperties.OrganizationalUnit},
-		certGUID,
-	)
+	idCred, err := c.generateCredForSAN(logger, certSAN, certGUID, validity)
 	duration := c.clock.Since(start)
 	if err != nil {
 		logger.Error("failed-to-generate-instance-identity-credentials", err)
@@ -308,15 +734,50 @@ func (c *credManager) generateInstanceIdentityCred(logger lager.Logger, containe
 	return idCred, nil
 }
 
-func (c *credManager) generateC2cCred(logger lager.Logger, container executor.Container, certGUID string) (Credential, error) {
+// spiffeID returns the SPIFFE ID of the container in the form
+// spiffe://<trust-domain>/<app-guid>/<instance-guid>, or nil if SPIFFE
+// identities are disabled or the container has no app guid.
+func (c *credManager) spiffeID(container executor.Container, instanceGUID string) *url.URL {
+	appGUID := container.CertificateProperties.AppGUID
+	if c.trustDomain == "" || appGUID == "" {
+		return nil
+	}
+
+	return &url.URL{
+		Scheme: "spiffe",
+		Host:   c.trustDomain,
+		Path:   "/" + path.Join(appGUID, instanceGUID),
+	}
+}
+
+// addCustomSANs adds the SANs requested in the CertificateProperties of the
+// container, after checking them against the allowlist of the cell.
+func (c *credManager) addCustomSANs(certSAN *certificateSAN, container executor.Container) error {
+	dnsNames, ips, err := c.sanAllowlist.Validate(container.CertificateProperties)
+	if err != nil {
+		return err
+	}
+	certSAN.DNSNames = dnsNames
+	certSAN.IPAddresses = ips
+	return nil
+}
+
+func (c *credManager) generateC2cCred(logger lager.Logger, container executor.Container, certGUID string, validity time.Duration) (Credential, error) {
 	logger = logger.Session("generating-c2c-credentials")
 	logger.Debug("starting")
 	defer logger.Debug("complete")
+	certSAN := certificateSAN{InternalRoutes: container.InternalRoutes, OrganizationalUnits: container.CertificateProperties.OrganizationalUnit}
+	if certGUID != "" {
+		err := c.addCustomSANs(&certSAN, container)
+		if err != nil {
+			logger.Error("invalid-custom-sans", err)
+			c.metronClient.IncrementCounter(C2CCredCreationFailedCount)
+			return Credential{}, err
+		}
+	}
+
 	start := c.clock.Now()
-	c2cCred, err := c.generateCredForSAN(logger,
-		certificateSAN{InternalRoutes: container.InternalRoutes, OrganizationalUnits: container.CertificateProperties.OrganizationalUnit},
-		certGUID,
-	)
+	c2cCred, err := c.generateCredForSAN(logger, certSAN, certGUID, validity)
 	duration := c.clock.Since(start)
 	if err != nil {
 		logger.Error("failed-to-generate-c2c-credentials", err)
@@ -329,9 +790,9 @@ func (c *credManager) generateC2cCred(logger lager.Logger, container executor.Co
 	return c2cCred, nil
 }
 
-func (c *credManager) generateCredForSAN(logger lager.Logger, certSAN certificateSAN, certGUID string) (Credential, error) {
+func (c *credManager) generateCredForSAN(logger lager.Logger, certSAN certificateSAN, certGUID string, validity time.Duration) (Credential, error) {
 	logger.Debug("generating-private-key")
-	privateKey, err := rsa.GenerateKey(c.entropyReader, 2048)
+	privateKey, err := c.keyGenerator.GenerateKey(c.entropyReader)
 	if err != nil {
 		return Credential{}, err
 	}
@@ -342,7 +803,8 @@ func (c *credManager) generateCredForSAN(logger lager.Logger, certSAN certificat
 	template := createCertificateTemplate(certGUID,
 		certSAN,
 		startValidity,
-		startValidity.Add(c.validityPeriod),
+		startValidity.Add(validity),
+		c.keyGenerator.KeyUsage(),
 	)
 
 	logger.Debug("generating-serial-number")
@@ -357,30 +819,29 @@ func (c *credManager) generateCredForSAN(logger lager.Logger, certSAN certificat
 	template.SerialNumber.SetBytes(guidBytes[:])
 
 	logger.Debug("generating-certificate")
-	certBytes, err := x509.CreateCertificate(c.entropyReader, template, c.CaCert, privateKey.Public(), c.privateKey)
+	certs, err := c.signer.SignCertificate(logger, template, privateKey)
 	if err != nil {
 		return Credential{}, err
 	}
 	logger.Debug("generated-certificate")
 
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-
-	var keyBuf bytes.Buffer
-	err = pemEncode(privateKeyBytes, privateKeyPEMBlockType, &keyBuf)
+	privateKeyBytes, privateKeyBlockType, err := c.keyGenerator.MarshalPrivateKey(privateKey)
 	if err != nil {
 		return Credential{}, err
 	}
 
-	var certificateBuf bytes.Buffer
-	certificateWriter := &certificateBuf
-	err = pemEncode(certBytes, certificatePEMBlockType, certificateWriter)
+	var keyBuf bytes.Buffer
+	err = pemEncode(privateKeyBytes, privateKeyBlockType, &keyBuf)
 	if err != nil {
 		return Credential{}, err
 	}
 
-	err = pemEncode(c.CaCert.Raw, certificatePEMBlockType, certificateWriter)
-	if err != nil {
-		return Credential{}, err
+	var certificateBuf bytes.Buffer
+	for _, certBytes := range certs {
+		err = pemEncode(certBytes, certificatePEMBlockType, &certificateBuf)
+		if err != nil {
+			return Credential{}, err
+		}
 	}
 
 	return Credential{
@@ -401,19 +862,24 @@ type certificateSAN struct {
 	IPAddress           string
 	InternalRoutes      internalroutes.InternalRoutes
 	OrganizationalUnits []string
+	URIs                []*url.URL
+	DNSNames            []string
+	IPAddresses         []net.IP
 }
 
-func createCertificateTemplate(guid string, certSAN certificateSAN, notBefore, notAfter time.Time) *x509.Certificate {
+func createCertificateTemplate(guid string, certSAN certificateSAN, notBefore, notAfter time.Time, keyUsage x509.KeyUsage) *x509.Certificate {
 	var ipaddr []net.IP
 	if len(certSAN.IPAddress) == 0 {
 		ipaddr = []net.IP{}
 	} else {
 		ipaddr = []net.IP{net.ParseIP(certSAN.IPAddress)}
 	}
+	ipaddr = append(ipaddr, certSAN.IPAddresses...)
 	dnsNames := []string{guid}
 	for _, route := range certSAN.InternalRoutes {
 		dnsNames = append(dnsNames, route.Hostname)
 	}
+	dnsNames = append(dnsNames, certSAN.DNSNames...)
 
 	return &x509.Certificate{
 		SerialNumber: big.NewInt(0),
@@ -423,9 +889,10 @@ func createCertificateTemplate(guid string, certSAN certificateSAN, notBefore, n
 		},
 		IPAddresses: ipaddr,
 		DNSNames:    dnsNames,
+		URIs:        certSAN.URIs,
 		NotBefore:   notBefore,
 		NotAfter:    notAfter,
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+		KeyUsage:    keyUsage,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 	}
 }
@@ -1,6 +1,8 @@
 package containerstore_test
 
 import (
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -16,8 +18,10 @@ import (
 	"code.cloudfoundry.org/clock/fakeclock"
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/clockskew"
 	"code.cloudfoundry.org/executor/depot/containerstore"
 	"code.cloudfoundry.org/executor/depot/containerstore/containerstorefakes"
+	efakes "code.cloudfoundry.org/executor/depot/event/fakes"
 	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagertest"
@@ -33,6 +37,12 @@ var _ = Describe("CredManager", func() {
 		validityPeriod        time.Duration
 		CaCert                *x509.Certificate
 		privateKey            *rsa.PrivateKey
+		cas                   []containerstore.CA
+		keyGenerator          containerstore.KeyGenerator
+		trustDomain           string
+		sanAllowlist          containerstore.SANAllowlist
+		rotationConfig        containerstore.RotationConfig
+		clockJumps            *clockskew.Detector
 		reader                io.Reader
 		logger                lager.Logger
 		clock                 *fakeclock.FakeClock
@@ -63,20 +73,111 @@ var _ = Describe("CredManager", func() {
 		clock = fakeclock.NewFakeClock(time.Now().UTC().Truncate(time.Second))
 
 		CaCert, privateKey = createIntermediateCert()
+		cas = []containerstore.CA{{Cert: CaCert, Key: privateKey}}
+		keyGenerator = containerstore.NewRSAKeyGenerator(2048)
+		trustDomain = ""
+		sanAllowlist = containerstore.SANAllowlist{}
+		rotationConfig = containerstore.RotationConfig{}
+		clockJumps = nil
 		containerInfoProvider = &containerstorefakes.FakeContainerInfoProvider{}
 	})
 
 	JustBeforeEach(func() {
-		credManager = containerstore.NewCredManager(
-			logger,
-			fakeMetronClient,
-			validityPeriod,
-			reader,
-			clock,
-			CaCert,
-			privateKey,
-			fakeCredHandler,
-		)
+		var err error
+		credManager, err = containerstore.NewCredManager(containerstore.CredManagerOptions{
+			Logger:         logger,
+			MetronClient:   fakeMetronClient,
+			ValidityPeriod: validityPeriod,
+			EntropyReader:  reader,
+			Clock:          clock,
+			KeyGenerator:   keyGenerator,
+			TrustDomain:    trustDomain,
+			SANAllowlist:   sanAllowlist,
+			Rotation:       rotationConfig,
+			ClockJumps:     clockJumps,
+			Handlers:       []containerstore.CredentialHandler{fakeCredHandler},
+		}, cas)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("NewKeyGenerator", func() {
+		It("defaults to RSA keys", func() {
+			generator, err := containerstore.NewKeyGenerator("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generator).To(Equal(containerstore.NewRSAKeyGenerator(2048)))
+		})
+
+		It("supports ECDSA P-256 and Ed25519 keys", func() {
+			generator, err := containerstore.NewKeyGenerator("ecdsa-p256")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generator).To(Equal(containerstore.NewECDSAKeyGenerator(elliptic.P256())))
+
+			generator, err = containerstore.NewKeyGenerator("ed25519")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generator).To(Equal(containerstore.NewEd25519KeyGenerator()))
+		})
+
+		It("returns an error for unsupported algorithms", func() {
+			_, err := containerstore.NewKeyGenerator("dsa")
+			Expect(err).To(MatchError("unsupported key algorithm: dsa"))
+		})
+	})
+
+	Context("ParsePrivateKey", func() {
+		It("parses the keys of every key generator", func() {
+			for _, generator := range []containerstore.KeyGenerator{
+				containerstore.NewRSAKeyGenerator(2048),
+				containerstore.NewECDSAKeyGenerator(elliptic.P256()),
+				containerstore.NewEd25519KeyGenerator(),
+				containerstore.NewPKCS8KeyGenerator(containerstore.NewECDSAKeyGenerator(elliptic.P256())),
+			} {
+				key, err := generator.GenerateKey(rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				der, blockType, err := generator.MarshalPrivateKey(key)
+				Expect(err).NotTo(HaveOccurred())
+
+				parsed, err := containerstore.ParsePrivateKey(&pem.Block{Type: blockType, Bytes: der})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsed.Public()).To(Equal(key.Public()))
+			}
+		})
+
+		It("parses blocks of other types as PKCS#1 RSA keys", func() {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+
+			parsed, err := containerstore.ParsePrivateKey(&pem.Block{Type: "KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Public()).To(Equal(key.Public()))
+		})
+	})
+
+	Context("SigningCA", func() {
+		It("picks the most recently issued CA with a private key", func() {
+			oldCert, oldKey := createIntermediateCertValidFrom(time.Now().Add(-48 * time.Hour))
+			newCert, newKey := createIntermediateCertValidFrom(time.Now().Add(-time.Hour))
+			externalCert, _ := createIntermediateCertValidFrom(time.Now())
+
+			signingCA, err := containerstore.SigningCA([]containerstore.CA{
+				{Cert: oldCert, Key: oldKey},
+				{Cert: externalCert},
+				{Cert: newCert, Key: newKey},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signingCA.Cert).To(Equal(newCert))
+		})
+
+		It("returns an error when no CA has a private key", func() {
+			_, err := containerstore.SigningCA([]containerstore.CA{{Cert: CaCert}})
+			Expect(err).To(MatchError(containerstore.ErrNoSigningCA))
+		})
+	})
+
+	Context("NewCredManager", func() {
+		It("returns an error when no CA has a private key", func() {
+			_, err := containerstore.NewCredManager(containerstore.CredManagerOptions{Logger: logger}, []containerstore.CA{{Cert: CaCert}})
+			Expect(err).To(MatchError(containerstore.ErrNoSigningCA))
+		})
 	})
 
 	Context("NoopCredManager", func() {
@@ -108,17 +209,21 @@ var _ = Describe("CredManager", func() {
 			fakeCredHandler1 = &containerstorefakes.FakeCredentialHandler{}
 			fakeCredHandler2 = &containerstorefakes.FakeCredentialHandler{}
 
-			credManager = containerstore.NewCredManager(
-				logger,
-				fakeMetronClient,
-				validityPeriod,
-				reader,
-				clock,
-				CaCert,
-				privateKey,
-				fakeCredHandler1,
-				fakeCredHandler2,
-			)
+			var err error
+			credManager, err = containerstore.NewCredManager(containerstore.CredManagerOptions{
+				Logger:         logger,
+				MetronClient:   fakeMetronClient,
+				ValidityPeriod: validityPeriod,
+				EntropyReader:  reader,
+				Clock:          clock,
+				KeyGenerator:   keyGenerator,
+				TrustDomain:    trustDomain,
+				SANAllowlist:   sanAllowlist,
+				Rotation:       rotationConfig,
+				ClockJumps:     clockJumps,
+				Handlers:       []containerstore.CredentialHandler{fakeCredHandler1, fakeCredHandler2},
+			}, cas)
+			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("calls the handlers RemoveDir", func() {
@@ -164,17 +269,21 @@ var _ = Describe("CredManager", func() {
 			fakeCredHandler1 = &containerstorefakes.FakeCredentialHandler{}
 			fakeCredHandler2 = &containerstorefakes.FakeCredentialHandler{}
 
-			credManager = containerstore.NewCredManager(
-				logger,
-				fakeMetronClient,
-				validityPeriod,
-				reader,
-				clock,
-				CaCert,
-				privateKey,
-				fakeCredHandler1,
-				fakeCredHandler2,
-			)
+			var err error
+			credManager, err = containerstore.NewCredManager(containerstore.CredManagerOptions{
+				Logger:         logger,
+				MetronClient:   fakeMetronClient,
+				ValidityPeriod: validityPeriod,
+				EntropyReader:  reader,
+				Clock:          clock,
+				KeyGenerator:   keyGenerator,
+				TrustDomain:    trustDomain,
+				SANAllowlist:   sanAllowlist,
+				Rotation:       rotationConfig,
+				ClockJumps:     clockJumps,
+				Handlers:       []containerstore.CredentialHandler{fakeCredHandler1, fakeCredHandler2},
+			}, cas)
+			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("calls the handlers CreateDir", func() {
@@ -245,6 +354,72 @@ var _ = Describe("CredManager", func() {
 			}
 		})
 
+		Context("RotationDeadlines", func() {
+			var containerProcess ifrit.Process
+
+			BeforeEach(func() {
+				validityPeriod = time.Hour
+			})
+
+			JustBeforeEach(func() {
+				containerInfoProvider.InfoReturns(container)
+				containerProcess = ifrit.Background(credManager.Runner(logger, containerInfoProvider, make(chan struct{}, 1)))
+				Eventually(containerProcess.Ready()).Should(BeClosed())
+			})
+
+			AfterEach(func() {
+				containerProcess.Signal(os.Interrupt)
+				Eventually(containerProcess.Wait()).Should(Receive())
+			})
+
+			It("returns when the credentials of the container are next rotated", func() {
+				Expect(credManager.RotationDeadlines()).To(Equal(map[string]time.Time{
+					container.Guid: clock.Now().Add(52*time.Minute + 30*time.Second),
+				}))
+			})
+
+			It("forgets the container once its runner exits", func() {
+				containerProcess.Signal(os.Interrupt)
+				Eventually(containerProcess.Wait()).Should(Receive())
+				Expect(credManager.RotationDeadlines()).To(BeEmpty())
+			})
+
+			Context("when the deadline of the container was restored from a checkpoint", func() {
+				var deadline time.Time
+
+				BeforeEach(func() {
+					deadline = clock.Now().Add(10 * time.Minute)
+				})
+
+				JustBeforeEach(func() {
+					containerProcess.Signal(os.Interrupt)
+					Eventually(containerProcess.Wait()).Should(Receive())
+
+					credManager.RestoreRotationDeadlines(map[string]time.Time{container.Guid: deadline})
+					containerProcess = ifrit.Background(credManager.Runner(logger, containerInfoProvider, make(chan struct{}, 1)))
+					Eventually(containerProcess.Ready()).Should(BeClosed())
+				})
+
+				It("rotates the credentials at the restored deadline", func() {
+					Expect(credManager.RotationDeadlines()).To(HaveKeyWithValue(container.Guid, deadline))
+
+					Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+					clock.WaitForWatcherAndIncrement(10 * time.Minute)
+					Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(3))
+				})
+
+				Context("when the restored deadline is later than the next rotation", func() {
+					BeforeEach(func() {
+						deadline = clock.Now().Add(2 * time.Hour)
+					})
+
+					It("rotates the credentials before they expire", func() {
+						Expect(credManager.RotationDeadlines()).To(HaveKeyWithValue(container.Guid, clock.Now().Add(52*time.Minute+30*time.Second)))
+					})
+				})
+			})
+		})
+
 		Context("Runner", func() {
 			var (
 				containerProcess  ifrit.Process
@@ -298,6 +473,18 @@ var _ = Describe("CredManager", func() {
 				})
 			})
 
+			Context("when the container requests a SAN that is not allowed", func() {
+				BeforeEach(func() {
+					container.CertificateProperties.DNSNames = []string{"tcp.example.org"}
+					sanAllowlist = containerstore.SANAllowlist{DNSNames: []string{"*.example.com"}}
+				})
+
+				It("the runner exits", func() {
+					Eventually(containerProcess.Wait()).Should(Receive(MatchError("DNS SAN not allowed: tcp.example.org")))
+					Expect(fakeCredHandler.UpdateCallCount()).To(Equal(0))
+				})
+			})
+
 			Context("when runner becomes ready", func() {
 				AfterEach(func() {
 					containerProcess.Signal(os.Interrupt)
@@ -327,6 +514,148 @@ var _ = Describe("CredManager", func() {
 					Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
 				})
 
+				Context("when the container requests custom SANs", func() {
+					BeforeEach(func() {
+						container.CertificateProperties.DNSNames = []string{"tcp.example.com"}
+						container.CertificateProperties.IPAddresses = []string{"10.0.0.5"}
+						sanAllowlist, _ = containerstore.NewSANAllowlist([]string{"*.example.com"}, []string{"10.0.0.0/24"})
+					})
+
+					It("adds them to both certificates", func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+						creds, _ := fakeCredHandler.UpdateArgsForCall(0)
+
+						idCert, _ := parseCert(creds.InstanceIdentityCredential)
+						Expect(idCert.DNSNames).To(ContainElement("tcp.example.com"))
+						Expect(idCert.IPAddresses).To(ContainElement(net.ParseIP("10.0.0.5").To4()))
+
+						c2cCert, _ := parseCert(creds.C2CCredential)
+						Expect(c2cCert.DNSNames).To(ContainElement("tcp.example.com"))
+					})
+				})
+
+				Context("when a new CA is being rotated in", func() {
+					var newCaCert *x509.Certificate
+
+					BeforeEach(func() {
+						var newPrivateKey *rsa.PrivateKey
+						newCaCert, newPrivateKey = createIntermediateCertValidFrom(time.Now().Add(-time.Hour))
+						cas = append(cas, containerstore.CA{Cert: newCaCert, Key: newPrivateKey})
+					})
+
+					It("signs with the new CA and includes both CAs in the chain", func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+						creds, _ := fakeCredHandler.UpdateArgsForCall(0)
+
+						cert, rest := parseCert(creds.InstanceIdentityCredential)
+						Expect(cert.CheckSignatureFrom(newCaCert)).To(Succeed())
+
+						var chain []*x509.Certificate
+						for block, rest := pem.Decode(rest); block != nil; block, rest = pem.Decode(rest) {
+							certs, err := x509.ParseCertificates(block.Bytes)
+							Expect(err).NotTo(HaveOccurred())
+							chain = append(chain, certs...)
+						}
+						Expect(chain).To(Equal([]*x509.Certificate{newCaCert, CaCert}))
+					})
+
+					It("passes both CAs as the trust bundle", func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+						creds, _ := fakeCredHandler.UpdateArgsForCall(0)
+
+						newCaPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newCaCert.Raw})
+						caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: CaCert.Raw})
+						Expect(creds.TrustBundle).To(Equal(string(newCaPEM) + string(caPEM)))
+					})
+				})
+
+				It("emits the remaining validity of the credentials", func() {
+					Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(1))
+					name, value, opts := fakeMetronClient.SendMetricArgsForCall(0)
+					Expect(name).To(Equal("CredValidityRemainingSeconds"))
+					Expect(value).To(Equal(60))
+					Expect(opts).To(HaveLen(1))
+				})
+
+				Context("when the credentials are valid for longer than the report interval", func() {
+					BeforeEach(func() {
+						validityPeriod = time.Hour
+					})
+
+					It("periodically emits the remaining validity of the credentials", func() {
+						clock.WaitForWatcherAndIncrement(time.Minute)
+
+						Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(2))
+						name, value, _ := fakeMetronClient.SendMetricArgsForCall(1)
+						Expect(name).To(Equal("CredValidityRemainingSeconds"))
+						Expect(value).To(Equal(59 * 60))
+					})
+				})
+
+				Context("when the clock jumps", func() {
+					var detectorProcess ifrit.Process
+
+					BeforeEach(func() {
+						clockJumps = clockskew.NewDetector(logger, clock, fakeMetronClient, &efakes.FakeHub{}, time.Second, 10*time.Second)
+						detectorProcess = ifrit.Invoke(clockJumps)
+					})
+
+					AfterEach(func() {
+						detectorProcess.Signal(os.Interrupt)
+						Eventually(detectorProcess.Wait()).Should(Receive())
+					})
+
+					It("regenerates the credentials", func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+						Eventually(clock.WatcherCount).Should(Equal(3))
+						clock.Increment(time.Second + 20*time.Second)
+
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+						creds, _ := fakeCredHandler.UpdateArgsForCall(1)
+						Expect(creds.InstanceIdentityCredential.IsEmpty()).To(BeFalse())
+						Expect(creds.C2CCredential.IsEmpty()).To(BeFalse())
+					})
+
+					Context("when rotation jitter is configured", func() {
+						BeforeEach(func() {
+							rotationConfig.Jitter = 10 * time.Second
+						})
+
+						It("regenerates the credentials within the jitter", func() {
+							Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+							Eventually(clock.WatcherCount).Should(Equal(3))
+							clock.Increment(time.Second + 20*time.Second)
+							Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+
+							clock.Increment(10 * time.Second)
+							Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+						})
+					})
+				})
+
+				Context("when the cell drains", func() {
+					JustBeforeEach(func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+						credManager.Drain(logger, 10*time.Second)
+					})
+
+					It("rotates the credentials with a validity covering the drain window", func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+						creds, _ := fakeCredHandler.UpdateArgsForCall(1)
+
+						idCert, _ := parseCert(creds.InstanceIdentityCredential)
+						Expect(idCert.NotAfter).To(Equal(clock.Now().Add(10 * time.Second)))
+						c2cCert, _ := parseCert(creds.C2CCredential)
+						Expect(c2cCert.NotAfter).To(Equal(clock.Now().Add(10 * time.Second)))
+					})
+
+					It("stops rotating the credentials", func() {
+						Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+						clock.Increment(validityPeriod)
+						Consistently(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+					})
+				})
+
 				Context("when the certificate is about to expire", func() {
 					var (
 						credsBefore containerstore.Credentials
@@ -399,6 +728,53 @@ var _ = Describe("CredManager", func() {
 						})
 					})
 
+					Context("when rotation fails and retries are configured", func() {
+						BeforeEach(func() {
+							validityPeriod = time.Hour
+							rotationConfig.RetryAttempts = 2
+							rotationConfig.RetryBackoff = time.Minute
+							rotationConfig.MinValidity = 10 * time.Minute
+						})
+
+						JustBeforeEach(func() {
+							fakeCredHandler.UpdateReturnsOnCall(1, errors.New("boooom!"))
+							idCertBefore, _ := parseCert(credsBefore.InstanceIdentityCredential)
+							clock.WaitForWatcherAndIncrement(idCertBefore.NotAfter.Add(-30 * time.Minute).Sub(clock.Now()))
+							Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(2))
+						})
+
+						It("keeps running and retries after the backoff", func() {
+							Consistently(containerProcess.Wait()).ShouldNot(Receive())
+
+							clock.Increment(time.Minute)
+							Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(3))
+							Consistently(containerProcess.Wait()).ShouldNot(Receive())
+						})
+
+						Context("when every retry fails", func() {
+							JustBeforeEach(func() {
+								fakeCredHandler.UpdateReturns(errors.New("boooom!"))
+							})
+
+							It("the runner exits once the attempts are exhausted", func() {
+								clock.Increment(time.Minute)
+								Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(3))
+								clock.Increment(2 * time.Minute)
+								Eventually(containerProcess.Wait()).Should(Receive(MatchError("boooom!")))
+							})
+						})
+
+						Context("when the credentials are close to expiry", func() {
+							BeforeEach(func() {
+								rotationConfig.MinValidity = 45 * time.Minute
+							})
+
+							It("the runner exits", func() {
+								Eventually(containerProcess.Wait()).Should(Receive(MatchError("boooom!")))
+							})
+						})
+					})
+
 					Context("when it recieves a message on the regenerateCertsCh", func() {
 						It("regenerates a c2c certificate", func() {
 							Expect(fakeCredHandler.UpdateCallCount()).To(Equal(1))
@@ -525,6 +901,43 @@ var _ = Describe("CredManager", func() {
 						})
 					})
 
+					Context("when a rotation fraction is configured", func() {
+						BeforeEach(func() {
+							validityPeriod = time.Hour
+							rotationConfig.Fraction = 0.5
+						})
+
+						Context("when 35 minutes prior to expiry", func() {
+							It("does not rotate the credentials", func() {
+								testNoCredentialRotation(35 * time.Minute)
+							})
+						})
+
+						Context("when 30 minutes prior to expiry", func() {
+							It("rotates the certs", func() {
+								testCredentialRotation(30 * time.Minute)
+							})
+						})
+
+						Context("when rotation jitter is configured", func() {
+							BeforeEach(func() {
+								rotationConfig.Jitter = 10 * time.Minute
+							})
+
+							Context("when 45 minutes prior to expiry", func() {
+								It("does not rotate the credentials", func() {
+									testNoCredentialRotation(45 * time.Minute)
+								})
+							})
+
+							Context("when 30 minutes prior to expiry", func() {
+								It("rotates the certs", func() {
+									testCredentialRotation(30 * time.Minute)
+								})
+							})
+						})
+					})
+
 					Context("when certificate validity is longer than 4 hours", func() {
 						BeforeEach(func() {
 							validityPeriod = 24 * time.Hour
@@ -648,6 +1061,43 @@ var _ = Describe("CredManager", func() {
 							Expect(cert.IPAddresses).To(ContainElement(ip.To4()))
 						})
 
+						Context("when the container is dual-stack", func() {
+							BeforeEach(func() {
+								container.InternalIPv6 = "fd00::7"
+							})
+
+							It("has both container ips", func() {
+								Expect(cert.IPAddresses).To(ContainElement(net.ParseIP(container.InternalIP).To4()))
+								Expect(cert.IPAddresses).To(ContainElement(net.ParseIP("fd00::7")))
+							})
+						})
+
+						It("does not have a SPIFFE ID", func() {
+							Expect(cert.URIs).To(BeEmpty())
+						})
+
+						Context("when a SPIFFE trust domain is configured", func() {
+							BeforeEach(func() {
+								trustDomain = "cf.example.com"
+								container.CertificateProperties.AppGUID = "some-app-guid"
+							})
+
+							It("has the SPIFFE ID in the URI SAN", func() {
+								Expect(cert.URIs).To(HaveLen(1))
+								Expect(cert.URIs[0].String()).To(Equal("spiffe://cf.example.com/some-app-guid/" + container.Guid))
+							})
+
+							Context("when the container has no app guid", func() {
+								BeforeEach(func() {
+									container.CertificateProperties.AppGUID = ""
+								})
+
+								It("does not have a SPIFFE ID", func() {
+									Expect(cert.URIs).To(BeEmpty())
+								})
+							})
+						})
+
 						It("has the correct fields", func() {
 							testCertificateFields()
 						})
@@ -674,6 +1124,77 @@ var _ = Describe("CredManager", func() {
 				})
 			})
 
+			Context("when using ECDSA keys", func() {
+				BeforeEach(func() {
+					keyGenerator = containerstore.NewECDSAKeyGenerator(elliptic.P256())
+				})
+
+				It("generates EC private keys matching the certificate", func() {
+					Eventually(containerProcess.Ready()).Should(BeClosed())
+					Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+					creds, _ := fakeCredHandler.UpdateArgsForCall(0)
+
+					block, _ := pem.Decode([]byte(creds.InstanceIdentityCredential.Key))
+					Expect(block).NotTo(BeNil())
+					Expect(block.Type).To(Equal("EC PRIVATE KEY"))
+					key, err := x509.ParseECPrivateKey(block.Bytes)
+					Expect(err).NotTo(HaveOccurred())
+
+					cert, _ := parseCert(creds.InstanceIdentityCredential)
+					Expect(cert.PublicKey).To(Equal(key.Public()))
+					Expect(cert.KeyUsage).To(Equal(x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement))
+					Expect(cert.CheckSignatureFrom(CaCert)).To(Succeed())
+				})
+			})
+
+			Context("when using Ed25519 keys", func() {
+				BeforeEach(func() {
+					keyGenerator = containerstore.NewEd25519KeyGenerator()
+				})
+
+				It("generates PKCS#8 private keys matching the certificate", func() {
+					Eventually(containerProcess.Ready()).Should(BeClosed())
+					Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+					creds, _ := fakeCredHandler.UpdateArgsForCall(0)
+
+					block, _ := pem.Decode([]byte(creds.C2CCredential.Key))
+					Expect(block).NotTo(BeNil())
+					Expect(block.Type).To(Equal("PRIVATE KEY"))
+					key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+					Expect(err).NotTo(HaveOccurred())
+					edKey, ok := key.(ed25519.PrivateKey)
+					Expect(ok).To(BeTrue())
+
+					cert, _ := parseCert(creds.C2CCredential)
+					Expect(cert.PublicKey).To(Equal(edKey.Public()))
+					Expect(cert.KeyUsage).To(Equal(x509.KeyUsageDigitalSignature))
+					Expect(cert.CheckSignatureFrom(CaCert)).To(Succeed())
+				})
+			})
+
+			Context("when writing PKCS#8 keys", func() {
+				BeforeEach(func() {
+					keyGenerator = containerstore.NewPKCS8KeyGenerator(containerstore.NewRSAKeyGenerator(2048))
+				})
+
+				It("generates PKCS#8 RSA private keys matching the certificate", func() {
+					Eventually(containerProcess.Ready()).Should(BeClosed())
+					Eventually(fakeCredHandler.UpdateCallCount).Should(Equal(1))
+					creds, _ := fakeCredHandler.UpdateArgsForCall(0)
+
+					block, _ := pem.Decode([]byte(creds.InstanceIdentityCredential.Key))
+					Expect(block).NotTo(BeNil())
+					Expect(block.Type).To(Equal("PRIVATE KEY"))
+					key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+					Expect(err).NotTo(HaveOccurred())
+					rsaKey, ok := key.(*rsa.PrivateKey)
+					Expect(ok).To(BeTrue())
+
+					cert, _ := parseCert(creds.InstanceIdentityCredential)
+					Expect(cert.PublicKey).To(Equal(rsaKey.Public()))
+				})
+			})
+
 			Context("when signalled", func() {
 				JustBeforeEach(func() {
 					Eventually(containerProcess.Ready()).Should(BeClosed())
@@ -713,6 +1234,10 @@ var _ = Describe("CredManager", func() {
 })
 
 func createIntermediateCert() (*x509.Certificate, *rsa.PrivateKey) {
+	return createIntermediateCertValidFrom(time.Time{})
+}
+
+func createIntermediateCertValidFrom(notBefore time.Time) (*x509.Certificate, *rsa.PrivateKey) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	Expect(err).NotTo(HaveOccurred())
 
@@ -720,6 +1245,7 @@ func createIntermediateCert() (*x509.Certificate, *rsa.PrivateKey) {
 		IsCA:                  true,
 		BasicConstraintsValid: true,
 		SerialNumber:          big.NewInt(1),
+		NotBefore:             notBefore,
 		NotAfter:              time.Now().Add(36 * time.Hour),
 	}
 	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
@@ -0,0 +1,138 @@
+package containerstore
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const dependencyPollInterval = time.Second
+
+var dependencyStateOrder = map[executor.State]int{
+	executor.StateReserved:     1,
+	executor.StateInitializing: 2,
+	executor.StateCreated:      3,
+	executor.StateRunning:      4,
+	executor.StateCompleted:    5,
+}
+
+func validDependency(guid string, dependency executor.ContainerDependency) bool {
+	if dependency.Guid == "" || dependency.Guid == guid {
+		return false
+	}
+	switch dependency.State {
+	case executor.StateCreated, executor.StateRunning, executor.StateCompleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// dependencyWaiter becomes ready once every dependency has reached its
+// state. It fails if a dependency completes before reaching a state that
+// precedes completion, since it never will. Dependencies that are not on the
+// cell yet are waited for, for at most the start timeout of the container.
+// The start deadline of the container covers the wait, and starts again once
+// the dependencies are met, as the action then gets the whole start timeout.
+type dependencyWaiter struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	containers   *nodeMap
+	dependencies []executor.ContainerDependency
+	timeout      time.Duration
+	deadline     func(time.Time)
+}
+
+func newDependencyWaiter(logger lager.Logger, clock clock.Clock, containers *nodeMap, dependencies []executor.ContainerDependency, timeout time.Duration, deadline func(time.Time)) *dependencyWaiter {
+	return &dependencyWaiter{
+		logger:       logger,
+		clock:        clock,
+		containers:   containers,
+		dependencies: dependencies,
+		timeout:      timeout,
+		deadline:     deadline,
+	}
+}
+
+func (w *dependencyWaiter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := w.logger.Session("dependency-waiter")
+
+	pending := w.dependencies
+	if len(pending) > 0 {
+		logger.Info("waiting", lager.Data{"dependencies": pending})
+		w.startDeadline()
+
+		ticker := w.clock.NewTicker(dependencyPollInterval)
+		defer ticker.Stop()
+
+		var timeout <-chan time.Time
+		if w.timeout > 0 {
+			timer := w.clock.NewTimer(w.timeout)
+			defer timer.Stop()
+			timeout = timer.C()
+		}
+
+		for {
+			var err error
+			pending, err = w.unmet(pending)
+			if err != nil {
+				logger.Error("dependency-failed", err)
+				return err
+			}
+			if len(pending) == 0 {
+				break
+			}
+
+			select {
+			case <-ticker.C():
+			case <-timeout:
+				logger.Error("dependencies-timed-out", executor.ErrDependencyTimeout, lager.Data{"dependencies": pending})
+				return executor.ErrDependencyTimeout
+			case signal := <-signals:
+				logger.Info("signalled", lager.Data{"signal": signal.String()})
+				return nil
+			}
+		}
+
+		logger.Info("dependencies-met")
+		w.startDeadline()
+	}
+
+	close(ready)
+
+	signal := <-signals
+	logger.Debug("signalled", lager.Data{"signal": signal.String()})
+	return nil
+}
+
+func (w *dependencyWaiter) startDeadline() {
+	if w.timeout > 0 && w.deadline != nil {
+		w.deadline(w.clock.Now().Add(w.timeout))
+	}
+}
+
+func (w *dependencyWaiter) unmet(dependencies []executor.ContainerDependency) ([]executor.ContainerDependency, error) {
+	var unmet []executor.ContainerDependency
+	for _, dependency := range dependencies {
+		node, err := w.containers.Get(dependency.Guid)
+		if err != nil {
+			unmet = append(unmet, dependency)
+			continue
+		}
+
+		state := node.Info().State
+		switch {
+		case state == dependency.State:
+		case state == executor.StateCompleted:
+			return nil, fmt.Errorf("dependency %s completed before reaching %s", dependency.Guid, dependency.State)
+		case dependencyStateOrder[state] > dependencyStateOrder[dependency.State]:
+		default:
+			unmet = append(unmet, dependency)
+		}
+	}
+	return unmet, nil
+}
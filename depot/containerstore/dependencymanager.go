@@ -14,6 +14,13 @@ import (
 	"code.cloudfoundry.org/lager/v3"
 )
 
+const (
+	CachedDependencyCacheHits        = "CachedDependencyCacheHits"
+	CachedDependencyCacheMisses      = "CachedDependencyCacheMisses"
+	CachedDependencyDownloadedBytes  = "CachedDependencyDownloadedBytes"
+	CachedDependencyDownloadDuration = "CachedDependencyDownloadDuration"
+)
+
 //go:generate counterfeiter -o containerstorefakes/fake_bindmounter.go . DependencyManager
 
 type DependencyManager interface {
@@ -55,6 +62,8 @@ func (bm *dependencyManager) DownloadCachedDependencies(logger lager.Logger, mou
 		return bindMounts, nil
 	}
 
+	startTime := time.Now()
+
 	var wg sync.WaitGroup
 
 	for i := range mounts {
@@ -88,8 +97,10 @@ func (bm *dependencyManager) DownloadCachedDependencies(logger lager.Logger, mou
 			return bindMounts, err
 		case cachedMount := <-mountChan:
 			bindMounts.AddBindMount(cachedMount.CacheKey, cachedMount.BindMount)
+			bindMounts.addDownload(cachedMount.DownloadedBytes)
 			completed++
 			if total == completed {
+				bm.emitDownloadMetrics(logger, bindMounts, time.Now().Sub(startTime), metronClient)
 				return bindMounts, nil
 			}
 		}
@@ -143,7 +154,35 @@ func (bm *dependencyManager) downloadCachedDependency(logger lager.Logger, mount
 			metronClient.SendAppLog(fmt.Sprintf("Downloaded %s", mount.Name), sourceName, tags)
 		}
 	}
-	return newCachedBindMount(mount.CacheKey, newBindMount(dirPath, mount.To)), nil
+	cachedMount := newCachedBindMount(mount.CacheKey, newBindMount(dirPath, mount.To))
+	cachedMount.DownloadedBytes = downloadedSize
+	return cachedMount, nil
+}
+
+func (bm *dependencyManager) emitDownloadMetrics(logger lager.Logger, bindMounts BindMounts, duration time.Duration, metronClient loggingclient.IngressClient) {
+	logger.Info("downloaded-cached-dependencies", lager.Data{
+		"cache-hits":       bindMounts.CacheHits,
+		"cache-misses":     bindMounts.CacheMisses,
+		"downloaded-bytes": bindMounts.DownloadedBytes,
+		"duration":         duration.String(),
+	})
+
+	for i := 0; i < bindMounts.CacheHits; i++ {
+		if err := metronClient.IncrementCounter(CachedDependencyCacheHits); err != nil {
+			logger.Error("failed-to-send-metric", err, lager.Data{"metric-name": CachedDependencyCacheHits})
+		}
+	}
+	for i := 0; i < bindMounts.CacheMisses; i++ {
+		if err := metronClient.IncrementCounter(CachedDependencyCacheMisses); err != nil {
+			logger.Error("failed-to-send-metric", err, lager.Data{"metric-name": CachedDependencyCacheMisses})
+		}
+	}
+	if err := metronClient.SendMetric(CachedDependencyDownloadedBytes, int(bindMounts.DownloadedBytes)); err != nil {
+		logger.Error("failed-to-send-metric", err, lager.Data{"metric-name": CachedDependencyDownloadedBytes})
+	}
+	if err := metronClient.SendDuration(CachedDependencyDownloadDuration, duration); err != nil {
+		logger.Error("failed-to-send-duration", err, lager.Data{"metric-name": CachedDependencyDownloadDuration})
+	}
 }
 
 func (bm *dependencyManager) ReleaseCachedDependencies(logger lager.Logger, keys []BindMountCacheKey) error {
@@ -160,8 +199,9 @@ func (bm *dependencyManager) ReleaseCachedDependencies(logger lager.Logger, keys
 }
 
 type cachedBindMount struct {
-	CacheKey  string
-	BindMount garden.BindMount
+	CacheKey        string
+	BindMount       garden.BindMount
+	DownloadedBytes int64
 }
 
 func newCachedBindMount(key string, mount garden.BindMount) *cachedBindMount {
@@ -174,6 +214,12 @@ func newCachedBindMount(key string, mount garden.BindMount) *cachedBindMount {
 type BindMounts struct {
 	CacheKeys        []BindMountCacheKey
 	GardenBindMounts []garden.BindMount
+
+	// CacheHits and CacheMisses count the dependencies that were served from
+	// the cache and the ones that had to be downloaded.
+	CacheHits       int
+	CacheMisses     int
+	DownloadedBytes int64
 }
 
 func NewBindMounts(capacity int) BindMounts {
@@ -188,6 +234,15 @@ func (b *BindMounts) AddBindMount(cacheKey string, mount garden.BindMount) {
 	b.GardenBindMounts = append(b.GardenBindMounts, mount)
 }
 
+func (b *BindMounts) addDownload(downloadedBytes int64) {
+	if downloadedBytes == 0 {
+		b.CacheHits++
+		return
+	}
+	b.CacheMisses++
+	b.DownloadedBytes += downloadedBytes
+}
+
 type BindMountCacheKey struct {
 	CacheKey string
 	Dir      string
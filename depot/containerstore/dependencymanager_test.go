@@ -137,6 +137,43 @@ var _ = Describe("DependencyManager", func() {
 		})
 	})
 
+	Context("when some of the dependencies are cached", func() {
+		var bindMounts containerstore.BindMounts
+
+		BeforeEach(func() {
+			cache.FetchAsDirectoryStub = func(_ lager.Logger, _ *url.URL, cacheKey string, _ cacheddownloader.ChecksumInfoType, _ <-chan struct{}) (string, int64, error) {
+				if cacheKey == "cache-key-1" {
+					return "/tmp/download/dependencies", 0, nil
+				}
+				return "/tmp/download/dependencies", 2048, nil
+			}
+			var err error
+			bindMounts, err = dependencyManager.DownloadCachedDependencies(logger, dependencies, logConfig, fakeClient)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("counts the cache hits, misses and downloaded bytes", func() {
+			Expect(bindMounts.CacheHits).To(Equal(1))
+			Expect(bindMounts.CacheMisses).To(Equal(1))
+			Expect(bindMounts.DownloadedBytes).To(BeEquivalentTo(2048))
+		})
+
+		It("emits the download metrics", func() {
+			Expect(fakeClient.IncrementCounterCallCount()).To(Equal(2))
+			counters := []string{fakeClient.IncrementCounterArgsForCall(0), fakeClient.IncrementCounterArgsForCall(1)}
+			Expect(counters).To(ConsistOf(containerstore.CachedDependencyCacheHits, containerstore.CachedDependencyCacheMisses))
+
+			Expect(fakeClient.SendMetricCallCount()).To(Equal(1))
+			name, value, _ := fakeClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal(containerstore.CachedDependencyDownloadedBytes))
+			Expect(value).To(Equal(2048))
+
+			Expect(fakeClient.SendDurationCallCount()).To(Equal(1))
+			name, _, _ = fakeClient.SendDurationArgsForCall(0)
+			Expect(name).To(Equal(containerstore.CachedDependencyDownloadDuration))
+		})
+	})
+
 	Context("When a mount has an invalid 'From' field", func() {
 		BeforeEach(func() {
 			dependencies = []executor.CachedDependency{
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package containerstore
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// deviceRule is the rule of the device cgroup that allows the device node at
+// path, e.g. c 195:0 rwm.
+func deviceRule(path string) (string, error) {
+	var stat unix.Stat_t
+	err := unix.Stat(path, &stat)
+	if err != nil {
+		return "", err
+	}
+
+	var deviceType string
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		deviceType = "c"
+	case unix.S_IFBLK:
+		deviceType = "b"
+	default:
+		return "", fmt.Errorf("%s is not a device", path)
+	}
+
+	rdev := uint64(stat.Rdev)
+	return fmt.Sprintf("%s %d:%d rwm", deviceType, unix.Major(rdev), unix.Minor(rdev)), nil
+}
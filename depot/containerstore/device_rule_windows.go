@@ -0,0 +1,9 @@
+package containerstore
+
+import "errors"
+
+// Devices are exposed to Windows containers by the runtime, which has no
+// device cgroup.
+func deviceRule(path string) (string, error) {
+	return "", errors.New("device cgroups are not supported on windows")
+}
@@ -0,0 +1,136 @@
+package containerstore
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/executor"
+)
+
+// deviceAllocator hands out the GPU devices of the cell to containers. Each
+// device is assigned to at most one container at a time.
+type deviceAllocator struct {
+	lock     sync.Mutex
+	devices  []string
+	types    map[string]string
+	assigned map[string]string
+}
+
+// newDeviceAllocator returns an allocator of the devices, where types maps
+// devices to their GPU type. Devices without a type are only allocated to
+// containers that do not ask for one.
+func newDeviceAllocator(devices []string, types map[string]string) *deviceAllocator {
+	return &deviceAllocator{
+		devices:  append([]string{}, devices...),
+		types:    types,
+		assigned: make(map[string]string),
+	}
+}
+
+// Allocate assigns count free devices of gpuType, or of any type if it is
+// empty, to the container with the given guid.
+func (a *deviceAllocator) Allocate(guid string, count int, gpuType string) ([]string, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var allocated []string
+	for _, device := range a.devices {
+		if _, ok := a.assigned[device]; ok {
+			continue
+		}
+		if gpuType != "" && a.types[device] != gpuType {
+			continue
+		}
+		allocated = append(allocated, device)
+		if len(allocated) == count {
+			break
+		}
+	}
+
+	if len(allocated) < count {
+		return nil, executor.ErrInsufficientResourcesAvailable
+	}
+
+	for _, device := range allocated {
+		a.assigned[device] = guid
+	}
+	return allocated, nil
+}
+
+// Claim assigns the given devices to the container with the given guid, e.g.
+// when the container is recovered. It fails if any of them is unknown or
+// assigned to another container.
+func (a *deviceAllocator) Claim(guid string, devices []string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, device := range devices {
+		owner, assigned := a.assigned[device]
+		if !a.known(device) || (assigned && owner != guid) {
+			return executor.ErrInsufficientResourcesAvailable
+		}
+	}
+
+	for _, device := range devices {
+		a.assigned[device] = guid
+	}
+	return nil
+}
+
+// Remaining counts the free devices of each type. It is nil when no device
+// has a type.
+func (a *deviceAllocator) Remaining() map[string]int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	var remaining map[string]int
+	for _, device := range a.devices {
+		gpuType, ok := a.types[device]
+		if !ok {
+			continue
+		}
+		if remaining == nil {
+			remaining = make(map[string]int)
+		}
+		free := 0
+		if _, assigned := a.assigned[device]; !assigned {
+			free = 1
+		}
+		remaining[gpuType] += free
+	}
+	return remaining
+}
+
+func (a *deviceAllocator) known(device string) bool {
+	for _, d := range a.devices {
+		if d == device {
+			return true
+		}
+	}
+	return false
+}
+
+// Free returns devices that were allocated but never handed to a container.
+func (a *deviceAllocator) Free(devices []string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, device := range devices {
+		delete(a.assigned, device)
+	}
+}
+
+// Release frees the devices assigned to the container with the given guid.
+func (a *deviceAllocator) Release(guid string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for device, owner := range a.assigned {
+		if owner == guid {
+			delete(a.assigned, device)
+		}
+	}
+}
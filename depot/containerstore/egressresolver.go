@@ -0,0 +1,51 @@
+package containerstore
+
+import (
+	"net"
+	"os"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type egressResolver struct {
+	logger     lager.Logger
+	config     *ContainerConfig
+	clock      clock.Clock
+	containers *nodeMap
+	lookupIP   func(string) ([]net.IP, error)
+}
+
+func newEgressResolver(logger lager.Logger, config *ContainerConfig, clock clock.Clock, containers *nodeMap, lookupIP func(string) ([]net.IP, error)) *egressResolver {
+	return &egressResolver{
+		logger:     logger,
+		config:     config,
+		clock:      clock,
+		containers: containers,
+		lookupIP:   lookupIP,
+	}
+}
+
+// Run periodically resolves the hostname egress rules of every container and
+// allows the addresses that were not allowed yet. Garden cannot revoke NetOut
+// rules, so addresses a hostname no longer resolves to remain allowed for the
+// lifetime of the container.
+func (r *egressResolver) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := r.logger.Session("egress-resolver")
+	ticker := r.clock.NewTicker(r.config.EgressResolveInterval)
+
+	close(ready)
+
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			for _, node := range r.containers.List() {
+				node.refreshHostnameEgress(logger, r.lookupIP)
+			}
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			return nil
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package containerstore
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+)
+
+const (
+	GardenLimitExhaustedCount   = "GardenLimitExhaustedCount"
+	GardenLimitExhaustedMessage = "garden limit exhausted"
+)
+
+// gardenLimitErrors are the errors garden returns when one of its own limits
+// rejects the creation of a container. Garden only returns them as messages,
+// so they are matched as substrings.
+var gardenLimitErrors = []struct {
+	message string
+	limit   executor.GardenLimit
+}{
+	{"max containers reached", executor.GardenLimitContainers},
+	{"insufficient subnets remaining in the pool", executor.GardenLimitNetwork},
+	{"insufficient IPs remaining in the pool", executor.GardenLimitNetwork},
+	{"no space left on device", executor.GardenLimitDisk},
+	{"store quota", executor.GardenLimitDisk},
+}
+
+// gardenLimitFor returns the garden limit that caused err, if any.
+func gardenLimitFor(err error) (executor.GardenLimit, bool) {
+	if err == nil {
+		return "", false
+	}
+
+	message := err.Error()
+	for _, limitError := range gardenLimitErrors {
+		if strings.Contains(message, limitError.message) {
+			return limitError.limit, true
+		}
+	}
+	return "", false
+}
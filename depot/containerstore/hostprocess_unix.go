@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package containerstore
+
+// HostProcess containers are a Windows concept and are never run on other
+// platforms.
+const hostProcessContainersSupported = false
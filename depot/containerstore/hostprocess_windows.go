@@ -0,0 +1,3 @@
+package containerstore
+
+const hostProcessContainersSupported = true
@@ -0,0 +1,184 @@
+package containerstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+var ErrCredHubNotConfigured = errors.New("image credentials reference cannot be resolved without credhub")
+var ErrNoAppIdentity = errors.New("image credentials reference cannot be resolved for a container without an app guid")
+var ErrInvalidCredentialName = errors.New("image credentials reference is not a valid credential name")
+
+// imageCredentialResolver resolves the CredHub references to the registry
+// credentials of container images. References are resolved in the namespace
+// of the app of the container, so that an app can only use the credentials
+// stored for it. Resolved credentials are only kept in memory, for ttl, so
+// that credentials rotated in CredHub are picked up by the containers created
+// afterwards.
+type imageCredentialResolver struct {
+	url       string
+	namespace string
+	client    *http.Client
+	clock     clock.Clock
+	ttl       time.Duration
+
+	lock  sync.Mutex
+	cache map[imageCredentialsKey]resolvedImageCredentials
+}
+
+type imageCredentialsKey struct {
+	appGuid string
+	name    string
+}
+
+type resolvedImageCredentials struct {
+	username  string
+	password  string
+	expiresAt time.Time
+}
+
+// newImageCredentialResolver returns nil, which fails to resolve any
+// reference, unless CredHub is configured.
+func newImageCredentialResolver(config *ContainerConfig, clock clock.Clock) *imageCredentialResolver {
+	if config.CredHubURL == "" || config.CredHubClient == nil {
+		return nil
+	}
+
+	return &imageCredentialResolver{
+		url:       strings.TrimSuffix(config.CredHubURL, "/"),
+		namespace: "/" + strings.Trim(config.ImageCredentialsNamespace, "/"),
+		client:    config.CredHubClient,
+		clock:     clock,
+		ttl:       config.ImageCredentialsTTL,
+		cache:     make(map[imageCredentialsKey]resolvedImageCredentials),
+	}
+}
+
+// Resolve returns the username and password of the CredHub credential named
+// by the reference, which may be wrapped in (( )), in the namespace of the
+// app: the reference my-registry of app app-guid names the credential
+// <namespace>/app-guid/my-registry. The credential must be a user
+// credential, or a JSON one with username and password keys.
+func (r *imageCredentialResolver) Resolve(logger lager.Logger, appGuid, ref string) (string, string, error) {
+	if r == nil {
+		return "", "", ErrCredHubNotConfigured
+	}
+	key, err := r.key(appGuid, ref)
+	if err != nil {
+		logger.Error("failed-to-resolve-image-credentials", err, lager.Data{"app-guid": appGuid})
+		return "", "", err
+	}
+	logger = logger.Session("resolve-image-credentials", lager.Data{"app-guid": appGuid, "name": key.name})
+
+	r.lock.Lock()
+	cached, ok := r.cache[key]
+	r.lock.Unlock()
+	if ok && r.clock.Now().Before(cached.expiresAt) {
+		return cached.username, cached.password, nil
+	}
+
+	username, password, err := r.fetch(key.name)
+	if err != nil {
+		logger.Error("failed-to-fetch-credential", err)
+		return "", "", err
+	}
+
+	r.lock.Lock()
+	r.cache[key] = resolvedImageCredentials{username: username, password: password, expiresAt: r.clock.Now().Add(r.ttl)}
+	r.lock.Unlock()
+	return username, password, nil
+}
+
+// Forget drops the resolved credentials of the reference of the app, e.g.
+// after the registry rejected them, so that they are fetched again when next
+// resolved.
+func (r *imageCredentialResolver) Forget(appGuid, ref string) {
+	if r == nil {
+		return
+	}
+	key, err := r.key(appGuid, ref)
+	if err != nil {
+		return
+	}
+	r.lock.Lock()
+	delete(r.cache, key)
+	r.lock.Unlock()
+}
+
+// key names the credential of the reference in the namespace of the app. The
+// reference cannot leave the namespace.
+func (r *imageCredentialResolver) key(appGuid, ref string) (imageCredentialsKey, error) {
+	if appGuid == "" {
+		return imageCredentialsKey{}, ErrNoAppIdentity
+	}
+	if strings.Contains(appGuid, "/") {
+		return imageCredentialsKey{}, ErrInvalidCredentialName
+	}
+
+	name := strings.Trim(credentialName(ref), "/")
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return imageCredentialsKey{}, ErrInvalidCredentialName
+		}
+	}
+
+	return imageCredentialsKey{
+		appGuid: appGuid,
+		name:    strings.TrimSuffix(r.namespace, "/") + "/" + appGuid + "/" + name,
+	}, nil
+}
+
+func (r *imageCredentialResolver) fetch(name string) (string, string, error) {
+	resp, err := r.client.Get(r.url + "/api/v1/data?current=true&name=" + url.QueryEscape(name))
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("credhub responded with %s", resp.Status)
+	}
+
+	var body struct {
+		Data []struct {
+			Type  string `json:"type"`
+			Value struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"value"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", "", err
+	}
+	if len(body.Data) == 0 {
+		return "", "", fmt.Errorf("credential %s not found", name)
+	}
+
+	credential := body.Data[0]
+	if credential.Type != "user" && credential.Type != "json" {
+		return "", "", fmt.Errorf("credential %s is a %s credential, not a user one", name, credential.Type)
+	}
+	if credential.Value.Username == "" {
+		return "", "", fmt.Errorf("credential %s has no username", name)
+	}
+	return credential.Value.Username, credential.Value.Password, nil
+}
+
+func credentialName(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "((") && strings.HasSuffix(ref, "))") {
+		ref = strings.TrimSpace(ref[2 : len(ref)-2])
+	}
+	return ref
+}
@@ -0,0 +1,733 @@
+package containerstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	dockerHubRegistry = "registry-1.docker.io"
+	maxManifestBytes  = 4 * 1024 * 1024
+)
+
+var (
+	ErrImageDigestMismatch = errors.New("image content does not match its digest")
+	ErrImagePlatform       = errors.New("image has no manifest for the platform of the cell")
+
+	digestRegexp    = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+	challengeRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// imageManager pulls the images of containers from their registry into an
+// OCI image layout per image, from which garden creates the containers
+// instead of fetching the images itself. The blobs of the images are stored
+// once in a content-addressed cache, shared by all the images and hard linked
+// into their layouts, so that images with common layers only download them
+// once. Once the blobs outgrow the size of the cache, the least recently
+// used images that no container is being created from are evicted with the
+// blobs that no other image links.
+type imageManager struct {
+	dir      string
+	maxBytes uint64
+	insecure map[string]bool
+	client   *http.Client
+	clock    clock.Clock
+
+	lock    sync.Mutex
+	fetches map[string]*blobFetch
+	pulling int
+	inUse   map[string]int
+}
+
+// blobFetch is the download of a blob into the cache, which concurrent
+// pulls of images sharing the blob wait for instead of downloading it again.
+type blobFetch struct {
+	done chan struct{}
+	err  error
+}
+
+type imageReference struct {
+	registry   string
+	repository string
+	reference  string
+}
+
+type imageDescriptor struct {
+	MediaType string         `json:"mediaType"`
+	Digest    string         `json:"digest"`
+	Size      int64          `json:"size"`
+	Platform  *imagePlatform `json:"platform,omitempty"`
+}
+
+type imagePlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+}
+
+type imageManifest struct {
+	MediaType string            `json:"mediaType"`
+	Config    imageDescriptor   `json:"config"`
+	Layers    []imageDescriptor `json:"layers"`
+	Manifests []imageDescriptor `json:"manifests"`
+}
+
+// newImageManager returns nil, which leaves the images to garden, unless an
+// image cache directory is configured.
+func newImageManager(config *ContainerConfig, clock clock.Clock) *imageManager {
+	if config.ImageCacheDir == "" {
+		return nil
+	}
+
+	insecure := make(map[string]bool, len(config.InsecureImageRegistries))
+	for _, registry := range config.InsecureImageRegistries {
+		insecure[registry] = true
+	}
+
+	return &imageManager{
+		dir:      config.ImageCacheDir,
+		maxBytes: config.ImageCacheMaxSizeInBytes,
+		insecure: insecure,
+		client: &http.Client{
+			Timeout: config.ImagePullTimeout,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   10 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+			},
+		},
+		clock:   clock,
+		fetches: make(map[string]*blobFetch),
+		inUse:   make(map[string]int),
+	}
+}
+
+// Pull resolves the docker:// rootfs of a container, downloads the blobs of
+// its image that are not cached yet and returns the oci:// URI of the image
+// layout to create the container from. Images pinned to a digest are
+// verified against it. Its progress is written to the streamer. The image is
+// not evicted until it is released.
+func (m *imageManager) Pull(logger lager.Logger, rootFSPath, username, password string, streamer log_streamer.LogStreamer) (string, error) {
+	logger = logger.Session("pull-image")
+	start := m.clock.Now()
+
+	m.lock.Lock()
+	m.pulling++
+	m.lock.Unlock()
+	defer func() {
+		m.lock.Lock()
+		m.pulling--
+		m.lock.Unlock()
+	}()
+
+	ref, err := parseImageReference(rootFSPath)
+	if err != nil {
+		logger.Error("failed-to-parse-image-reference", err)
+		return "", err
+	}
+	logger = logger.WithData(lager.Data{"registry": ref.registry, "repository": ref.repository, "reference": ref.reference})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	fmt.Fprintf(streamer.Stdout(), "Pulling image %s/%s:%s\n", ref.registry, ref.repository, ref.reference)
+
+	session := &registrySession{
+		client:     m.client,
+		baseURL:    m.scheme(ref.registry) + "://" + ref.registry,
+		repository: ref.repository,
+		username:   username,
+		password:   password,
+	}
+
+	manifestBytes, manifest, err := m.resolveManifest(session, ref)
+	if err != nil {
+		logger.Error("failed-to-resolve-manifest", err)
+		fmt.Fprintf(streamer.Stderr(), "Failed to pull image: %s\n", err)
+		return "", err
+	}
+	manifestDigest := digestOf(manifestBytes)
+
+	err = m.storeBlob(manifestDigest, manifestBytes)
+	if err != nil {
+		logger.Error("failed-to-store-manifest", err)
+		return "", err
+	}
+
+	blobs := append([]imageDescriptor{manifest.Config}, manifest.Layers...)
+	for _, blob := range blobs {
+		downloaded, err := m.fetchBlob(session, blob)
+		if err != nil {
+			logger.Error("failed-to-fetch-blob", err, lager.Data{"digest": blob.Digest})
+			fmt.Fprintf(streamer.Stderr(), "Failed to pull image: %s\n", err)
+			return "", err
+		}
+		if downloaded {
+			fmt.Fprintf(streamer.Stdout(), "Downloaded layer %s (%s)\n", shortDigest(blob.Digest), bytefmt.ByteSize(uint64(blob.Size)))
+		}
+	}
+
+	layout, err := m.createLayout(manifestDigest, int64(len(manifestBytes)), manifest.MediaType, blobs)
+	if err != nil {
+		logger.Error("failed-to-create-image-layout", err)
+		return "", err
+	}
+	m.acquire(logger, layout)
+
+	fmt.Fprintf(streamer.Stdout(), "Pulled image %s in %s\n", manifestDigest, m.clock.Since(start))
+	return "oci://" + layout, nil
+}
+
+// Release tells that the container has been created from the pulled image,
+// and evicts images once no image is being pulled.
+func (m *imageManager) Release(logger lager.Logger, uri string) {
+	layout := strings.TrimPrefix(uri, "oci://")
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.inUse[layout]--
+	if m.inUse[layout] <= 0 {
+		delete(m.inUse, layout)
+	}
+	if m.pulling == 0 {
+		m.evict(logger.Session("evict-images"))
+	}
+}
+
+// acquire marks the image as in use, and as used most recently.
+func (m *imageManager) acquire(logger lager.Logger, layout string) {
+	m.lock.Lock()
+	m.inUse[layout]++
+	m.lock.Unlock()
+
+	now := m.clock.Now()
+	err := os.Chtimes(layout, now, now)
+	if err != nil {
+		logger.Error("failed-to-touch-image-layout", err)
+	}
+}
+
+// evict removes the least recently used images that are not in use, and the
+// blobs no remaining image links, until the blobs fit into the cache. It must
+// not run during a pull, since blobs are only linked into the layout of an
+// image once all of them are downloaded.
+func (m *imageManager) evict(logger lager.Logger) {
+	if m.maxBytes == 0 {
+		return
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(m.dir, "blobs", "sha256"))
+	if err != nil {
+		logger.Error("failed-to-read-blobs", err)
+		return
+	}
+	sizes := make(map[string]uint64, len(blobs))
+	var size uint64
+	for _, blob := range blobs {
+		info, err := blob.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		sizes[blob.Name()] = uint64(info.Size())
+		size += uint64(info.Size())
+	}
+	if size <= m.maxBytes {
+		return
+	}
+
+	layouts, err := m.layoutsByAge()
+	if err != nil {
+		logger.Error("failed-to-read-image-layouts", err)
+		return
+	}
+	links := make(map[string]int)
+	linked := make(map[string][]string, len(layouts))
+	for _, layout := range layouts {
+		entries, err := os.ReadDir(filepath.Join(layout, "blobs", "sha256"))
+		if err != nil {
+			logger.Error("failed-to-read-image-layout", err, lager.Data{"layout": layout})
+			return
+		}
+		for _, entry := range entries {
+			links[entry.Name()]++
+			linked[layout] = append(linked[layout], entry.Name())
+		}
+	}
+
+	removeUnlinked := func() {
+		for name, blobSize := range sizes {
+			if links[name] > 0 {
+				continue
+			}
+			err := os.Remove(filepath.Join(m.dir, "blobs", "sha256", name))
+			if err != nil && !os.IsNotExist(err) {
+				logger.Error("failed-to-remove-blob", err, lager.Data{"blob": name})
+				continue
+			}
+			delete(sizes, name)
+			size -= blobSize
+		}
+	}
+
+	removeUnlinked()
+	for _, layout := range layouts {
+		if size <= m.maxBytes {
+			break
+		}
+		if m.inUse[layout] > 0 {
+			continue
+		}
+
+		err := os.RemoveAll(layout)
+		if err != nil {
+			logger.Error("failed-to-remove-image-layout", err, lager.Data{"layout": layout})
+			continue
+		}
+		logger.Info("evicted-image", lager.Data{"layout": layout})
+		for _, name := range linked[layout] {
+			links[name]--
+		}
+		removeUnlinked()
+	}
+}
+
+// layoutsByAge lists the image layouts from the least to the most recently
+// used.
+func (m *imageManager) layoutsByAge() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(m.dir, "images"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type usedLayout struct {
+		path string
+		used time.Time
+	}
+	var used []usedLayout
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), "layout-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		used = append(used, usedLayout{path: filepath.Join(m.dir, "images", entry.Name()), used: info.ModTime()})
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].used.Before(used[j].used) })
+
+	layouts := make([]string, len(used))
+	for i, layout := range used {
+		layouts[i] = layout.path
+	}
+	return layouts, nil
+}
+
+func (m *imageManager) scheme(registry string) string {
+	if m.insecure[registry] {
+		return "http"
+	}
+	return "https"
+}
+
+// resolveManifest fetches the manifest of the image, and the manifest for
+// the platform of the cell when it is an index.
+func (m *imageManager) resolveManifest(session *registrySession, ref imageReference) ([]byte, imageManifest, error) {
+	manifestBytes, manifest, err := session.manifest(ref.reference)
+	if err != nil {
+		return nil, imageManifest{}, err
+	}
+	if digestRegexp.MatchString(ref.reference) && digestOf(manifestBytes) != ref.reference {
+		return nil, imageManifest{}, ErrImageDigestMismatch
+	}
+
+	switch manifest.MediaType {
+	case mediaTypeOCIManifest, mediaTypeDockerManifest:
+		return manifestBytes, manifest, nil
+	case mediaTypeOCIIndex, mediaTypeDockerManifestList:
+	default:
+		return nil, imageManifest{}, fmt.Errorf("unsupported manifest media type %q", manifest.MediaType)
+	}
+
+	for _, descriptor := range manifest.Manifests {
+		platform := descriptor.Platform
+		if platform == nil || platform.OS != "linux" || platform.Architecture != runtime.GOARCH {
+			continue
+		}
+
+		manifestBytes, manifest, err = session.manifest(descriptor.Digest)
+		if err != nil {
+			return nil, imageManifest{}, err
+		}
+		if digestOf(manifestBytes) != descriptor.Digest {
+			return nil, imageManifest{}, ErrImageDigestMismatch
+		}
+		if manifest.MediaType != mediaTypeOCIManifest && manifest.MediaType != mediaTypeDockerManifest {
+			return nil, imageManifest{}, fmt.Errorf("unsupported manifest media type %q", manifest.MediaType)
+		}
+		return manifestBytes, manifest, nil
+	}
+	return nil, imageManifest{}, ErrImagePlatform
+}
+
+// fetchBlob downloads the blob into the cache, unless it is cached already,
+// and reports whether it downloaded it.
+func (m *imageManager) fetchBlob(session *registrySession, blob imageDescriptor) (bool, error) {
+	if !digestRegexp.MatchString(blob.Digest) {
+		return false, fmt.Errorf("unsupported digest %q", blob.Digest)
+	}
+	if _, err := os.Stat(m.blobPath(blob.Digest)); err == nil {
+		return false, nil
+	}
+
+	m.lock.Lock()
+	if fetch, ok := m.fetches[blob.Digest]; ok {
+		m.lock.Unlock()
+		<-fetch.done
+		return false, fetch.err
+	}
+	fetch := &blobFetch{done: make(chan struct{})}
+	m.fetches[blob.Digest] = fetch
+	m.lock.Unlock()
+
+	fetch.err = m.downloadBlob(session, blob)
+
+	m.lock.Lock()
+	delete(m.fetches, blob.Digest)
+	m.lock.Unlock()
+	close(fetch.done)
+
+	return fetch.err == nil, fetch.err
+}
+
+func (m *imageManager) downloadBlob(session *registrySession, blob imageDescriptor) error {
+	resp, err := session.get("/blobs/"+blob.Digest, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return m.writeBlob(blob.Digest, io.LimitReader(resp.Body, blob.Size+1))
+}
+
+func (m *imageManager) storeBlob(digest string, content []byte) error {
+	if _, err := os.Stat(m.blobPath(digest)); err == nil {
+		return nil
+	}
+	return m.writeBlob(digest, bytes.NewReader(content))
+}
+
+// writeBlob writes the content to a temporary file that is only renamed into
+// the cache once it matches its digest.
+func (m *imageManager) writeBlob(digest string, content io.Reader) error {
+	dir := filepath.Dir(m.blobPath(digest))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if "sha256:"+hex.EncodeToString(hash.Sum(nil)) != digest {
+		return ErrImageDigestMismatch
+	}
+	return os.Rename(tmp.Name(), m.blobPath(digest))
+}
+
+// createLayout links the blobs of the image into its OCI image layout, which
+// is built in a temporary directory and renamed into place so that a layout
+// is only ever seen complete.
+func (m *imageManager) createLayout(manifestDigest string, manifestSize int64, mediaType string, blobs []imageDescriptor) (string, error) {
+	layout := filepath.Join(m.dir, "images", strings.TrimPrefix(manifestDigest, "sha256:"))
+	if _, err := os.Stat(layout); err == nil {
+		return layout, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(layout), 0755)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(layout), "layout-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = os.MkdirAll(filepath.Join(tmp, "blobs", "sha256"), 0755)
+	if err != nil {
+		return "", err
+	}
+	for _, digest := range append([]string{manifestDigest}, digestsOf(blobs)...) {
+		name := strings.TrimPrefix(digest, "sha256:")
+		err := os.Link(m.blobPath(digest), filepath.Join(tmp, "blobs", "sha256", name))
+		if err != nil && !os.IsExist(err) {
+			return "", err
+		}
+	}
+
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []imageDescriptor{
+			{MediaType: mediaType, Digest: manifestDigest, Size: manifestSize},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(tmp, "index.json"), index, 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(tmp, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp, layout)
+	if err != nil {
+		if _, statErr := os.Stat(layout); statErr == nil {
+			return layout, nil
+		}
+		return "", err
+	}
+	return layout, nil
+}
+
+func (m *imageManager) blobPath(digest string) string {
+	return filepath.Join(m.dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// parseImageReference parses docker://registry/repository#reference, where
+// the registry defaults to Docker Hub and the reference, a tag or a digest,
+// to latest. The digest may also follow the repository after an @.
+func parseImageReference(rootFSPath string) (imageReference, error) {
+	rootFSURL, err := url.Parse(rootFSPath)
+	if err != nil {
+		return imageReference{}, err
+	}
+	if rootFSURL.Scheme != "docker" {
+		return imageReference{}, fmt.Errorf("not a registry image: %s", rootFSPath)
+	}
+
+	ref := imageReference{
+		registry:   rootFSURL.Host,
+		repository: strings.TrimPrefix(rootFSURL.Path, "/"),
+		reference:  rootFSURL.Fragment,
+	}
+	if i := strings.Index(ref.repository, "@"); i >= 0 {
+		ref.repository, ref.reference = ref.repository[:i], ref.repository[i+1:]
+	}
+	if ref.repository == "" {
+		return imageReference{}, fmt.Errorf("image has no repository: %s", rootFSPath)
+	}
+	if ref.registry == "" || ref.registry == "docker.io" || ref.registry == "index.docker.io" {
+		ref.registry = dockerHubRegistry
+		if !strings.Contains(ref.repository, "/") {
+			ref.repository = "library/" + ref.repository
+		}
+	}
+	if ref.reference == "" {
+		ref.reference = "latest"
+	}
+	return ref, nil
+}
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func digestsOf(blobs []imageDescriptor) []string {
+	digests := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		digests = append(digests, blob.Digest)
+	}
+	return digests
+}
+
+func shortDigest(digest string) string {
+	encoded := strings.TrimPrefix(digest, "sha256:")
+	if len(encoded) > 12 {
+		return encoded[:12]
+	}
+	return encoded
+}
+
+// registrySession makes the requests of a pull to the registry API,
+// authenticating with a bearer token or basic credentials as the registry
+// challenges it to.
+type registrySession struct {
+	client     *http.Client
+	baseURL    string
+	repository string
+	username   string
+	password   string
+
+	token string
+	basic bool
+}
+
+func (s *registrySession) manifest(reference string) ([]byte, imageManifest, error) {
+	accept := strings.Join([]string{mediaTypeOCIManifest, mediaTypeOCIIndex, mediaTypeDockerManifest, mediaTypeDockerManifestList}, ", ")
+	resp, err := s.get("/manifests/"+reference, accept)
+	if err != nil {
+		return nil, imageManifest{}, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes))
+	if err != nil {
+		return nil, imageManifest{}, err
+	}
+
+	var manifest imageManifest
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, imageManifest{}, err
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	}
+	return content, manifest, nil
+}
+
+func (s *registrySession) get(path, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, s.baseURL+"/v2/"+s.repository+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		} else if s.basic {
+			req.SetBasicAuth(s.username, s.password)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return nil, fmt.Errorf("registry responded to %s with %s", path, resp.Status)
+		}
+		err = s.authenticate(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *registrySession) authenticate(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if strings.EqualFold(scheme, "basic") {
+		if s.username == "" {
+			return errors.New("registry requires credentials")
+		}
+		s.basic = true
+		return nil
+	}
+	if !strings.EqualFold(scheme, "bearer") {
+		return fmt.Errorf("unsupported registry authentication %q", scheme)
+	}
+
+	values := map[string]string{}
+	for _, match := range challengeRegexp.FindAllStringSubmatch(params, -1) {
+		values[match[1]] = match[2]
+	}
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return fmt.Errorf("invalid registry authentication realm %q", values["realm"])
+	}
+	query := tokenURL.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	query.Set("scope", "repository:"+s.repository+":pull")
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token service responded with %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return err
+	}
+	s.token = token.Token
+	if s.token == "" {
+		s.token = token.AccessToken
+	}
+	if s.token == "" {
+		return errors.New("registry token service returned no token")
+	}
+	return nil
+}
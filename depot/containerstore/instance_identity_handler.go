@@ -1,28 +1,66 @@
 package containerstore
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/lager/v3"
 )
 
+const (
+	keyPassphraseSecretSize     = 32
+	keyPassphraseSecretFileName = ".key-passphrase-secret"
+	trustBundleFileName         = "trust-bundle.crt"
+)
+
+// NewInstanceIdentityHandler returns a handler that writes the instance
+// identity credentials into the container, next to the bundle of the CAs
+// trusted for them, exposed as CF_INSTANCE_TRUST_BUNDLE. The bundle is
+// rewritten with every rotation, so that it holds both the current and the
+// previous CA while a CA is rotated.
+//
+// When encryptKey is set, the private key is written as an encrypted PKCS#8
+// key, with a passphrase unique to the container exposed as
+// CF_INSTANCE_KEY_PASSPHRASE. The passphrase is derived from the guid of the
+// container and a secret of the cell kept in credDir, so that it survives
+// restarts of the executor. It only protects the key file at rest, in
+// credDir on the cell and against readers of the files of the container
+// that cannot read the environment of its processes, e.g. through a path
+// traversal in the app; anything running as the app can read both.
 func NewInstanceIdentityHandler(
 	credDir string,
 	containerMountPath string,
+	encryptKey bool,
+	entropyReader io.Reader,
 ) *InstanceIdentityHandler {
 	return &InstanceIdentityHandler{
 		credDir:            credDir,
 		containerMountPath: containerMountPath,
+		encryptKey:         encryptKey,
+		entropyReader:      entropyReader,
 	}
 }
 
 type InstanceIdentityHandler struct {
 	containerMountPath string
 	credDir            string
+	encryptKey         bool
+	entropyReader      io.Reader
+
+	secretLock sync.Mutex
+	secret     []byte
 }
 
 func (h *InstanceIdentityHandler) CreateDir(logger lager.Logger, container executor.Container) ([]garden.BindMount, []executor.EnvironmentVariable, error) {
@@ -32,17 +70,28 @@ func (h *InstanceIdentityHandler) CreateDir(logger lager.Logger, container execu
 		return nil, nil, err
 	}
 
+	envs := []executor.EnvironmentVariable{
+		{Name: "CF_INSTANCE_CERT", Value: path.Join(h.containerMountPath, "instance.crt")},
+		{Name: "CF_INSTANCE_KEY", Value: path.Join(h.containerMountPath, "instance.key")},
+		{Name: "CF_INSTANCE_TRUST_BUNDLE", Value: path.Join(h.containerMountPath, trustBundleFileName)},
+	}
+
+	if h.encryptKey {
+		passphrase, err := h.keyPassphrase(container)
+		if err != nil {
+			return nil, nil, err
+		}
+		envs = append(envs, executor.EnvironmentVariable{Name: "CF_INSTANCE_KEY_PASSPHRASE", Value: string(passphrase)})
+	}
+
 	return []garden.BindMount{
-			{
-				SrcPath: containerDir,
-				DstPath: h.containerMountPath,
-				Mode:    garden.BindMountModeRO,
-				Origin:  garden.BindMountOriginHost,
-			},
-		}, []executor.EnvironmentVariable{
-			{Name: "CF_INSTANCE_CERT", Value: path.Join(h.containerMountPath, "instance.crt")},
-			{Name: "CF_INSTANCE_KEY", Value: path.Join(h.containerMountPath, "instance.key")},
-		}, nil
+		{
+			SrcPath: containerDir,
+			DstPath: h.containerMountPath,
+			Mode:    garden.BindMountModeRO,
+			Origin:  garden.BindMountOriginHost,
+		},
+	}, envs, nil
 }
 
 func (h *InstanceIdentityHandler) RemoveDir(logger lager.Logger, container executor.Container) error {
@@ -54,6 +103,15 @@ func (h *InstanceIdentityHandler) Update(creds Credentials, container executor.C
 		return nil
 	}
 
+	key := []byte(creds.InstanceIdentityCredential.Key)
+	if h.encryptKey {
+		var err error
+		key, err = h.encryptPrivateKey(container, key)
+		if err != nil {
+			return err
+		}
+	}
+
 	instanceKeyPath := filepath.Join(h.credDir, container.Guid, "instance.key")
 	tmpInstanceKeyPath := instanceKeyPath + ".tmp"
 	certificatePath := filepath.Join(h.credDir, container.Guid, "instance.crt")
@@ -76,7 +134,7 @@ func (h *InstanceIdentityHandler) Update(creds Credentials, container executor.C
 		return err
 	}
 
-	_, err = instanceKey.Write([]byte(creds.InstanceIdentityCredential.Key))
+	_, err = instanceKey.Write(key)
 	if err != nil {
 		return err
 	}
@@ -101,9 +159,91 @@ func (h *InstanceIdentityHandler) Update(creds Credentials, container executor.C
 		return err
 	}
 
-	return nil
+	if creds.TrustBundle == "" {
+		return nil
+	}
+
+	trustBundlePath := filepath.Join(h.credDir, container.Guid, trustBundleFileName)
+	tmpTrustBundlePath := trustBundlePath + ".tmp"
+
+	err = os.WriteFile(tmpTrustBundlePath, []byte(creds.TrustBundle), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpTrustBundlePath, trustBundlePath)
 }
 
 func (h *InstanceIdentityHandler) Close(creds Credentials, container executor.Container) error {
 	return nil
 }
+
+func (h *InstanceIdentityHandler) encryptPrivateKey(container executor.Container, keyPEM []byte) ([]byte, error) {
+	passphrase, err := h.keyPassphrase(container)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("instance identity private key is not PEM-encoded")
+	}
+	key, err := ParsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := EncryptPKCS8PrivateKey(h.entropyReader, der, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: encryptedPKCS8PrivateKeyPEMBlockType, Bytes: encrypted}), nil
+}
+
+// keyPassphrase derives the passphrase of the private key of the container
+// from the secret of the cell.
+func (h *InstanceIdentityHandler) keyPassphrase(container executor.Container) ([]byte, error) {
+	secret, err := h.keyPassphraseSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(container.Guid))
+	return []byte(hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+// keyPassphraseSecret reads the secret of the cell that the passphrases are
+// derived from, and creates it the first time.
+func (h *InstanceIdentityHandler) keyPassphraseSecret() ([]byte, error) {
+	h.secretLock.Lock()
+	defer h.secretLock.Unlock()
+
+	if h.secret != nil {
+		return h.secret, nil
+	}
+
+	secretPath := filepath.Join(h.credDir, keyPassphraseSecretFileName)
+	secret, err := os.ReadFile(secretPath)
+	if os.IsNotExist(err) {
+		secret = make([]byte, keyPassphraseSecretSize)
+		_, err = io.ReadFull(h.entropyReader, secret)
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(secretPath, secret, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != keyPassphraseSecretSize {
+		return nil, fmt.Errorf("invalid key passphrase secret in %s", secretPath)
+	}
+
+	h.secret = secret
+	return secret, nil
+}
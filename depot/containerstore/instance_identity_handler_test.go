@@ -1,6 +1,11 @@
 package containerstore_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -32,6 +37,8 @@ var _ = Describe("InstanceIdentityHandler", func() {
 		handler = containerstore.NewInstanceIdentityHandler(
 			tmpdir,
 			"containerpath",
+			false,
+			rand.Reader,
 		)
 	})
 
@@ -47,17 +54,19 @@ var _ = Describe("InstanceIdentityHandler", func() {
 			Expect(mount[0].Origin).To(Equal(garden.BindMountOriginHost))
 		})
 
-		It("returns CF_INSTANCE_CERT and CF_INSTANCE_KEY environment variable values", func() {
+		It("returns CF_INSTANCE_CERT, CF_INSTANCE_KEY and CF_INSTANCE_TRUST_BUNDLE environment variable values", func() {
 			_, envVariables, err := handler.CreateDir(logger, container)
 			Expect(err).To(Succeed())
 
-			Expect(envVariables).To(HaveLen(2))
+			Expect(envVariables).To(HaveLen(3))
 			values := map[string]string{}
-			values[envVariables[0].Name] = envVariables[0].Value
-			values[envVariables[1].Name] = envVariables[1].Value
+			for _, env := range envVariables {
+				values[env.Name] = env.Value
+			}
 			Expect(values).To(Equal(map[string]string{
-				"CF_INSTANCE_CERT": "containerpath/instance.crt",
-				"CF_INSTANCE_KEY":  "containerpath/instance.key",
+				"CF_INSTANCE_CERT":         "containerpath/instance.crt",
+				"CF_INSTANCE_KEY":          "containerpath/instance.key",
+				"CF_INSTANCE_TRUST_BUNDLE": "containerpath/trust-bundle.crt",
 			}))
 		})
 
@@ -66,6 +75,8 @@ var _ = Describe("InstanceIdentityHandler", func() {
 				handler = containerstore.NewInstanceIdentityHandler(
 					"/invalid/path",
 					"containerpath",
+					false,
+					rand.Reader,
 				)
 			})
 
@@ -144,6 +155,106 @@ var _ = Describe("InstanceIdentityHandler", func() {
 
 			Expect(string(data)).To(Equal("cert"))
 		})
+
+		It("puts the trust bundle into container directory", func() {
+			err := handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: "key"},
+				TrustBundle:                "new-ca\nold-ca",
+			}, container)
+			Expect(err).NotTo(HaveOccurred())
+
+			trustBundleFile := filepath.Join(tmpdir, "some-guid", "trust-bundle.crt")
+			data, err := ioutil.ReadFile(trustBundleFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("new-ca\nold-ca"))
+
+			By("rotating the trust bundle")
+			err = handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: "key"},
+				TrustBundle:                "new-ca",
+			}, container)
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err = ioutil.ReadFile(trustBundleFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("new-ca"))
+		})
+	})
+
+	Context("when the private key is encrypted", func() {
+		var (
+			passphrase string
+			key        *ecdsa.PrivateKey
+			keyPEM     string
+		)
+
+		BeforeEach(func() {
+			handler = containerstore.NewInstanceIdentityHandler(tmpdir, "containerpath", true, rand.Reader)
+
+			_, envVariables, err := handler.CreateDir(logger, container)
+			Expect(err).NotTo(HaveOccurred())
+			for _, env := range envVariables {
+				if env.Name == "CF_INSTANCE_KEY_PASSPHRASE" {
+					passphrase = env.Value
+				}
+			}
+
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			keyBytes, err := x509.MarshalECPrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}))
+		})
+
+		It("exposes a per-container passphrase", func() {
+			Expect(passphrase).To(HaveLen(64))
+
+			_, envVariables, err := handler.CreateDir(logger, executor.Container{Guid: "other-guid"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envVariables).To(HaveLen(3))
+			Expect(envVariables[2].Value).NotTo(Equal(passphrase))
+		})
+
+		It("writes the key as an encrypted PKCS#8 key", func() {
+			err := handler.Update(containerstore.Credentials{InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: keyPEM}}, container)
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err := ioutil.ReadFile(filepath.Join(tmpdir, "some-guid", "instance.key"))
+			Expect(err).NotTo(HaveOccurred())
+			block, _ := pem.Decode(data)
+			Expect(block).NotTo(BeNil())
+			Expect(block.Type).To(Equal("ENCRYPTED PRIVATE KEY"))
+
+			der, err := containerstore.DecryptPKCS8PrivateKey(block.Bytes, []byte(passphrase))
+			Expect(err).NotTo(HaveOccurred())
+			decrypted, err := x509.ParsePKCS8PrivateKey(der)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decrypted).To(Equal(key))
+		})
+
+		It("encrypts the key with the same passphrase after the executor restarts", func() {
+			handler = containerstore.NewInstanceIdentityHandler(tmpdir, "containerpath", true, rand.Reader)
+			err := handler.Update(containerstore.Credentials{InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: keyPEM}}, container)
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err := ioutil.ReadFile(filepath.Join(tmpdir, "some-guid", "instance.key"))
+			Expect(err).NotTo(HaveOccurred())
+			block, _ := pem.Decode(data)
+			Expect(block).NotTo(BeNil())
+			_, err = containerstore.DecryptPKCS8PrivateKey(block.Bytes, []byte(passphrase))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("keeps the secret the passphrases are derived from out of the containers", func() {
+			info, err := os.Stat(filepath.Join(tmpdir, ".key-passphrase-secret"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("returns an error when the key is not PEM-encoded", func() {
+			err := handler.Update(containerstore.Credentials{InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: "key"}}, container)
+			Expect(err).To(MatchError("instance identity private key is not PEM-encoded"))
+		})
 	})
 
 	Describe("Close", func() {
@@ -0,0 +1,69 @@
+package containerstore
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+)
+
+type retainedIP struct {
+	ip         string
+	releasedAt time.Time
+}
+
+// ipRetention remembers the internal IP of destroyed containers for a window,
+// so that a container recreated with the same guid can ask the network
+// plugin for the address it had before. C2C certificates and peer
+// connections that reference the address then stay valid.
+type ipRetention struct {
+	clock  clock.Clock
+	window time.Duration
+
+	lock sync.Mutex
+	ips  map[string]retainedIP
+}
+
+func newIPRetention(clock clock.Clock, window time.Duration) *ipRetention {
+	return &ipRetention{
+		clock:  clock,
+		window: window,
+		ips:    map[string]retainedIP{},
+	}
+}
+
+// Release records the internal IP of a container that is being destroyed.
+func (r *ipRetention) Release(container executor.Container) {
+	if r == nil || r.window <= 0 || container.InternalIP == "" {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock.Now()
+	for guid, retained := range r.ips {
+		if now.Sub(retained.releasedAt) >= r.window {
+			delete(r.ips, guid)
+		}
+	}
+	r.ips[container.Guid] = retainedIP{ip: container.InternalIP, releasedAt: now}
+}
+
+// Lookup returns the IP the previous container with the guid had, if it was
+// destroyed within the window.
+func (r *ipRetention) Lookup(guid string) (string, bool) {
+	if r == nil || r.window <= 0 {
+		return "", false
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	retained, ok := r.ips[guid]
+	if !ok || r.clock.Now().Sub(retained.releasedAt) >= r.window {
+		return "", false
+	}
+	return retained.ip, true
+}
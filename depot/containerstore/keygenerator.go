@@ -0,0 +1,182 @@
+package containerstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+)
+
+const (
+	KeyAlgorithmRSA       = "rsa"
+	KeyAlgorithmECDSAP256 = "ecdsa-p256"
+	KeyAlgorithmEd25519   = "ed25519"
+)
+
+const (
+	KeyFormatDefault = ""
+	KeyFormatPKCS8   = "pkcs8"
+)
+
+const (
+	ecPrivateKeyPEMBlockType    = "EC PRIVATE KEY"
+	pkcs8PrivateKeyPEMBlockType = "PRIVATE KEY"
+)
+
+// ParsePrivateKey parses the private key in a PEM block written by any of
+// the key generators. Blocks of other types are parsed as PKCS#1 RSA keys,
+// which is all older versions of the executor supported.
+func ParsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case ecPrivateKeyPEMBlockType:
+		return x509.ParseECPrivateKey(block.Bytes)
+	case pkcs8PrivateKeyPEMBlockType:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key: %T", key)
+		}
+		return signer, nil
+	default:
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+}
+
+// KeyGenerator generates the private keys for the credentials created by the
+// CredManager.
+type KeyGenerator interface {
+	// Generates a new private key using the given entropy source
+	GenerateKey(entropyReader io.Reader) (crypto.Signer, error)
+
+	// Returns the DER encoding of the private key and the PEM block type it
+	// should be written with
+	MarshalPrivateKey(key crypto.Signer) ([]byte, string, error)
+
+	// Returns the key usages valid for certificates issued for the generated
+	// keys
+	KeyUsage() x509.KeyUsage
+}
+
+// NewKeyGenerator returns the KeyGenerator for the given algorithm. An empty
+// algorithm defaults to RSA.
+func NewKeyGenerator(algorithm string) (KeyGenerator, error) {
+	switch algorithm {
+	case "", KeyAlgorithmRSA:
+		return NewRSAKeyGenerator(2048), nil
+	case KeyAlgorithmECDSAP256:
+		return NewECDSAKeyGenerator(elliptic.P256()), nil
+	case KeyAlgorithmEd25519:
+		return NewEd25519KeyGenerator(), nil
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+	}
+}
+
+type rsaKeyGenerator struct {
+	bits int
+}
+
+func NewRSAKeyGenerator(bits int) KeyGenerator {
+	return &rsaKeyGenerator{bits: bits}
+}
+
+func (g *rsaKeyGenerator) GenerateKey(entropyReader io.Reader) (crypto.Signer, error) {
+	return rsa.GenerateKey(entropyReader, g.bits)
+}
+
+func (g *rsaKeyGenerator) MarshalPrivateKey(key crypto.Signer) ([]byte, string, error) {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, "", fmt.Errorf("expected an RSA private key, got %T", key)
+	}
+	return x509.MarshalPKCS1PrivateKey(rsaKey), privateKeyPEMBlockType, nil
+}
+
+func (g *rsaKeyGenerator) KeyUsage() x509.KeyUsage {
+	return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
+}
+
+type ecdsaKeyGenerator struct {
+	curve elliptic.Curve
+}
+
+func NewECDSAKeyGenerator(curve elliptic.Curve) KeyGenerator {
+	return &ecdsaKeyGenerator{curve: curve}
+}
+
+func (g *ecdsaKeyGenerator) GenerateKey(entropyReader io.Reader) (crypto.Signer, error) {
+	return ecdsa.GenerateKey(g.curve, entropyReader)
+}
+
+func (g *ecdsaKeyGenerator) MarshalPrivateKey(key crypto.Signer) ([]byte, string, error) {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, "", fmt.Errorf("expected an ECDSA private key, got %T", key)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return keyBytes, ecPrivateKeyPEMBlockType, nil
+}
+
+func (g *ecdsaKeyGenerator) KeyUsage() x509.KeyUsage {
+	return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement
+}
+
+type ed25519KeyGenerator struct{}
+
+func NewEd25519KeyGenerator() KeyGenerator {
+	return &ed25519KeyGenerator{}
+}
+
+func (g *ed25519KeyGenerator) GenerateKey(entropyReader io.Reader) (crypto.Signer, error) {
+	_, privateKey, err := ed25519.GenerateKey(entropyReader)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+func (g *ed25519KeyGenerator) MarshalPrivateKey(key crypto.Signer) ([]byte, string, error) {
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, "", fmt.Errorf("expected an Ed25519 private key, got %T", key)
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return keyBytes, pkcs8PrivateKeyPEMBlockType, nil
+}
+
+func (g *ed25519KeyGenerator) KeyUsage() x509.KeyUsage {
+	return x509.KeyUsageDigitalSignature
+}
+
+type pkcs8KeyGenerator struct {
+	KeyGenerator
+}
+
+// NewPKCS8KeyGenerator returns a KeyGenerator that marshals the keys of the
+// given KeyGenerator as PKCS#8 instead of their algorithm specific format,
+// for runtimes that only read PKCS#8 keys.
+func NewPKCS8KeyGenerator(keyGenerator KeyGenerator) KeyGenerator {
+	return &pkcs8KeyGenerator{KeyGenerator: keyGenerator}
+}
+
+func (g *pkcs8KeyGenerator) MarshalPrivateKey(key crypto.Signer) ([]byte, string, error) {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return keyBytes, pkcs8PrivateKeyPEMBlockType, nil
+}
@@ -0,0 +1,123 @@
+package containerstore
+
+import (
+	"crypto"
+	"io"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/workpool"
+	"github.com/tedsuo/ifrit"
+)
+
+const KeyPoolDepth = "CredKeyPoolDepth"
+
+// KeyPoolRetryDelay is how long the pool waits before it generates a key
+// again after generating one failed.
+const KeyPoolRetryDelay = time.Second
+
+// KeyPool is a KeyGenerator that pre-generates keys in the background. Running
+// it stops the generation, and its work pool, once it is signalled.
+type KeyPool interface {
+	KeyGenerator
+	ifrit.Runner
+}
+
+type keyPool struct {
+	KeyGenerator
+
+	logger        lager.Logger
+	metronClient  loggingclient.IngressClient
+	clock         clock.Clock
+	entropyReader io.Reader
+	workPool      *workpool.WorkPool
+	keys          chan crypto.Signer
+	stopped       chan struct{}
+}
+
+// NewKeyPool returns a KeyGenerator that hands out keys pre-generated by the
+// given work pool, so that creating credentials for a large number of
+// containers at once (e.g. when a cell restarts) does not have to wait on
+// key generation. The pool keeps up to size keys and falls back to generating
+// keys on demand when it is empty. Keys that fail to generate are retried
+// after KeyPoolRetryDelay, so that the pool does not shrink.
+func NewKeyPool(
+	logger lager.Logger,
+	metronClient loggingclient.IngressClient,
+	clock clock.Clock,
+	keyGenerator KeyGenerator,
+	entropyReader io.Reader,
+	workPool *workpool.WorkPool,
+	size int,
+) KeyPool {
+	pool := &keyPool{
+		KeyGenerator:  keyGenerator,
+		logger:        logger.Session("key-pool"),
+		metronClient:  metronClient,
+		clock:         clock,
+		entropyReader: entropyReader,
+		workPool:      workPool,
+		keys:          make(chan crypto.Signer, size),
+		stopped:       make(chan struct{}),
+	}
+
+	for i := 0; i < size; i++ {
+		pool.refill()
+	}
+
+	return pool
+}
+
+func (p *keyPool) GenerateKey(entropyReader io.Reader) (crypto.Signer, error) {
+	select {
+	case key := <-p.keys:
+		p.emitDepth()
+		p.refill()
+		return key, nil
+	default:
+		p.logger.Debug("pool-empty")
+		return p.KeyGenerator.GenerateKey(entropyReader)
+	}
+}
+
+func (p *keyPool) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+	<-signals
+	p.logger.Info("stopping")
+	close(p.stopped)
+	p.workPool.Stop()
+	return nil
+}
+
+func (p *keyPool) refill() {
+	select {
+	case <-p.stopped:
+		return
+	default:
+	}
+
+	p.workPool.Submit(func() {
+		key, err := p.KeyGenerator.GenerateKey(p.entropyReader)
+		if err != nil {
+			p.logger.Error("failed-to-generate-key", err, lager.Data{"retry-in": KeyPoolRetryDelay.String()})
+			p.clock.AfterFunc(KeyPoolRetryDelay, p.refill)
+			return
+		}
+
+		select {
+		case p.keys <- key:
+			p.emitDepth()
+		default:
+		}
+	})
+}
+
+func (p *keyPool) emitDepth() {
+	err := p.metronClient.SendMetric(KeyPoolDepth, len(p.keys))
+	if err != nil {
+		p.logger.Error("failed-to-send-pool-depth-metric", err)
+	}
+}
@@ -0,0 +1,140 @@
+package containerstore_test
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/workpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+type countingKeyGenerator struct {
+	containerstore.KeyGenerator
+	generated int32
+	failures  int32
+}
+
+func (g *countingKeyGenerator) GenerateKey(entropyReader io.Reader) (crypto.Signer, error) {
+	atomic.AddInt32(&g.generated, 1)
+	if atomic.AddInt32(&g.failures, -1) >= 0 {
+		return nil, errors.New("no entropy")
+	}
+	return g.KeyGenerator.GenerateKey(entropyReader)
+}
+
+func (g *countingKeyGenerator) Generated() int {
+	return int(atomic.LoadInt32(&g.generated))
+}
+
+var _ = Describe("KeyPool", func() {
+	var (
+		fakeMetronClient *mfakes.FakeIngressClient
+		fakeClock        *fakeclock.FakeClock
+		keyGenerator     *countingKeyGenerator
+		workPool         *workpool.WorkPool
+		size             int
+		pool             containerstore.KeyPool
+	)
+
+	BeforeEach(func() {
+		var err error
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		keyGenerator = &countingKeyGenerator{KeyGenerator: containerstore.NewECDSAKeyGenerator(elliptic.P256())}
+		workPool, err = workpool.NewWorkPool(2)
+		Expect(err).NotTo(HaveOccurred())
+		size = 3
+	})
+
+	JustBeforeEach(func() {
+		pool = containerstore.NewKeyPool(logger, fakeMetronClient, fakeClock, keyGenerator, rand.Reader, workPool, size)
+	})
+
+	AfterEach(func() {
+		workPool.Stop()
+	})
+
+	lastDepth := func() int {
+		count := fakeMetronClient.SendMetricCallCount()
+		if count == 0 {
+			return -1
+		}
+		name, value, _ := fakeMetronClient.SendMetricArgsForCall(count - 1)
+		Expect(name).To(Equal(containerstore.KeyPoolDepth))
+		return value
+	}
+
+	It("pre-generates keys up to the pool size", func() {
+		Eventually(keyGenerator.Generated).Should(Equal(3))
+		Eventually(lastDepth).Should(Equal(3))
+	})
+
+	It("hands out pre-generated keys and refills the pool", func() {
+		Eventually(lastDepth).Should(Equal(3))
+
+		key, err := pool.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).NotTo(BeNil())
+
+		Eventually(keyGenerator.Generated).Should(Equal(4))
+		Eventually(lastDepth).Should(Equal(3))
+	})
+
+	It("delegates key usage to the wrapped generator", func() {
+		Expect(pool.KeyUsage()).To(Equal(keyGenerator.KeyUsage()))
+	})
+
+	Context("when generating a key fails", func() {
+		BeforeEach(func() {
+			keyGenerator.failures = 1
+		})
+
+		It("retries, so that the pool does not shrink", func() {
+			Eventually(keyGenerator.Generated).Should(Equal(3))
+			Consistently(lastDepth).Should(Equal(2))
+
+			fakeClock.WaitForWatcherAndIncrement(containerstore.KeyPoolRetryDelay)
+			Eventually(keyGenerator.Generated).Should(Equal(4))
+			Eventually(lastDepth).Should(Equal(3))
+		})
+	})
+
+	Context("when signalled", func() {
+		It("stops refilling the pool", func() {
+			Eventually(lastDepth).Should(Equal(3))
+
+			process := ifrit.Invoke(pool)
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+
+			key, err := pool.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).NotTo(BeNil())
+			Consistently(keyGenerator.Generated).Should(Equal(3))
+		})
+	})
+
+	Context("when the pool is empty", func() {
+		BeforeEach(func() {
+			size = 0
+		})
+
+		It("generates a key on demand", func() {
+			key, err := pool.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).NotTo(BeNil())
+			Expect(keyGenerator.Generated()).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package containerstore
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/garden"
+)
+
+func memoryUsageInBytes(stat garden.ContainerMemoryStat) uint64 {
+	return stat.TotalUsageTowardLimit
+}
+
+func swapUsageInBytes(stat garden.ContainerMemoryStat) uint64 {
+	return stat.TotalSwap
+}
+
+func timeSpentInCPU(stat garden.ContainerCPUStat) time.Duration {
+	return time.Duration(stat.Usage)
+}
@@ -0,0 +1,31 @@
+package containerstore
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/garden"
+)
+
+// Windows cells may not populate TotalUsageTowardLimit, in which case the
+// working set of the container's job object is reported as TotalRss.
+func memoryUsageInBytes(stat garden.ContainerMemoryStat) uint64 {
+	if stat.TotalUsageTowardLimit != 0 {
+		return stat.TotalUsageTowardLimit
+	}
+	return stat.TotalRss
+}
+
+// Windows containers do not swap on their own; the page file of the host is
+// not accounted to containers.
+func swapUsageInBytes(stat garden.ContainerMemoryStat) uint64 {
+	return 0
+}
+
+// Windows cells report user and kernel time separately and may leave the
+// total usage empty.
+func timeSpentInCPU(stat garden.ContainerCPUStat) time.Duration {
+	if stat.Usage != 0 {
+		return time.Duration(stat.Usage)
+	}
+	return time.Duration(stat.User + stat.System)
+}
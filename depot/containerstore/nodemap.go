@@ -12,15 +12,28 @@ type nodeMap struct {
 	nodes map[string]*storeNode
 	lock  *sync.RWMutex
 
+	totalResources     executor.ExecutorResources
 	remainingResources *executor.ExecutorResources
+
+	capacityChanges *CapacityNotifier
+
+	placementQuotas executor.PlacementQuotas
+
+	// exhaustedLimits are the garden limits that rejected the creation of a
+	// container since a container was last removed from garden
+	exhaustedLimits map[executor.GardenLimit]struct{}
 }
 
-func newNodeMap(totalCapacity *executor.ExecutorResources) *nodeMap {
+func newNodeMap(totalCapacity *executor.ExecutorResources, capacityChanges *CapacityNotifier, placementQuotas executor.PlacementQuotas) *nodeMap {
 	capacity := totalCapacity.Copy()
 	return &nodeMap{
 		nodes:              make(map[string]*storeNode),
 		lock:               &sync.RWMutex{},
+		totalResources:     totalCapacity.Copy(),
 		remainingResources: &capacity,
+		capacityChanges:    capacityChanges,
+		placementQuotas:    placementQuotas,
+		exhaustedLimits:    map[executor.GardenLimit]struct{}{},
 	}
 }
 
@@ -34,7 +47,95 @@ func (n *nodeMap) Contains(guid string) bool {
 func (n *nodeMap) RemainingResources() executor.ExecutorResources {
 	n.lock.RLock()
 	defer n.lock.RUnlock()
-	return n.remainingResources.Copy()
+
+	remaining := n.remaining()
+	if n.totalResources.ContainerIPs > 0 || n.totalResources.HostPorts > 0 {
+		containerIPs, hostPorts := n.networkUsage()
+		remaining.ContainerIPs = n.totalResources.ContainerIPs - containerIPs
+		remaining.HostPorts = n.totalResources.HostPorts - hostPorts
+	}
+	return remaining
+}
+
+// networkUsage counts the container IPs and host ports garden assigned to
+// the containers it created. The caller must hold the lock.
+func (n *nodeMap) networkUsage() (int, int) {
+	var containerIPs, hostPorts int
+	for _, node := range n.nodes {
+		if !node.hasGardenContainer() {
+			continue
+		}
+
+		containerIPs++
+		for _, port := range node.Info().Ports {
+			if port.HostPort != 0 {
+				hostPorts++
+			}
+			if port.HostTLSProxyPort != 0 {
+				hostPorts++
+			}
+		}
+	}
+	return containerIPs, hostPorts
+}
+
+// remaining returns the remaining resources with the dimensions of exhausted
+// garden limits zeroed out. The caller must hold the lock.
+func (n *nodeMap) remaining() executor.ExecutorResources {
+	remaining := n.remainingResources.Copy()
+	for limit := range n.exhaustedLimits {
+		switch limit {
+		case executor.GardenLimitContainers, executor.GardenLimitNetwork:
+			remaining.Containers = 0
+		case executor.GardenLimitDisk:
+			remaining.DiskMB = 0
+		}
+	}
+	return remaining
+}
+
+// ExhaustGardenLimit marks limit exhausted until a container is removed from
+// garden.
+func (n *nodeMap) ExhaustGardenLimit(limit executor.GardenLimit) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.exhaustedLimits[limit] = struct{}{}
+	n.capacityChanges.notify()
+}
+
+// SetTotalResources changes the capacity of the cell while preserving the
+// resources already allocated to containers. It fails if the new capacity
+// cannot accommodate the existing allocations.
+func (n *nodeMap) SetTotalResources(total executor.ExecutorResources) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	remaining := executor.ExecutorResources{
+		MemoryMB:   total.MemoryMB - (n.totalResources.MemoryMB - n.remainingResources.MemoryMB),
+		DiskMB:     total.DiskMB - (n.totalResources.DiskMB - n.remainingResources.DiskMB),
+		Containers: total.Containers - (n.totalResources.Containers - n.remainingResources.Containers),
+		GPUs:       n.remainingResources.GPUs,
+
+		ExclusiveCPUs: n.remainingResources.ExclusiveCPUs,
+	}
+	if remaining.MemoryMB < 0 || remaining.DiskMB < 0 || remaining.Containers < 0 {
+		return executor.ErrInsufficientResourcesAvailable
+	}
+
+	// the network and port pools belong to garden and cannot be changed
+	total.ContainerIPs = n.totalResources.ContainerIPs
+	total.HostPorts = n.totalResources.HostPorts
+	// neither can the GPU devices and the exclusive cores of the cell, which
+	// are allocated from their inventory
+	total.GPUs = n.totalResources.GPUs
+	total.GPUTypes = n.totalResources.GPUTypes
+	total.ExclusiveCPUs = n.totalResources.ExclusiveCPUs
+
+	n.totalResources = total.Copy()
+	*n.remainingResources = remaining
+	n.capacityChanges.notify()
+	return nil
 }
 
 func (n *nodeMap) Add(node *storeNode) error {
@@ -46,16 +147,55 @@ func (n *nodeMap) Add(node *storeNode) error {
 		return executor.ErrContainerGuidNotAvailable
 	}
 
+	err := n.checkPlacementTagQuota(info)
+	if err != nil {
+		return err
+	}
+
+	// reservations respect exhausted garden limits as well
+	remaining := n.remaining()
+	if !remaining.Subtract(&info.Resource) {
+		return executor.ErrInsufficientResourcesAvailable
+	}
+
 	ok := n.remainingResources.Subtract(&info.Resource)
 	if !ok {
 		return executor.ErrInsufficientResourcesAvailable
 	}
 
 	n.nodes[info.Guid] = node
+	n.capacityChanges.notify()
 
 	return nil
 }
 
+// checkPlacementTagQuota fails if adding the container would exceed the quota
+// of its placement tag. The caller must hold the lock.
+func (n *nodeMap) checkPlacementTagQuota(container executor.Container) error {
+	placementTag := container.Tags[executor.PlacementTagTag]
+	quota, ok := n.placementQuotas[placementTag]
+	if placementTag == "" || !ok {
+		return nil
+	}
+
+	memoryMB, containers := container.MemoryMB, 1
+	for _, node := range n.nodes {
+		info := node.Info()
+		if info.Tags[executor.PlacementTagTag] == placementTag {
+			memoryMB += info.MemoryMB
+			containers++
+		}
+	}
+
+	if quota.MemoryMB > 0 && memoryMB > quota.MemoryMB {
+		return executor.ErrPlacementTagMemoryExceeded
+	}
+	if quota.Containers > 0 && containers > quota.Containers {
+		return executor.ErrPlacementTagContainersExceeded
+	}
+	return nil
+}
+
 func (n *nodeMap) Remove(guid string) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
@@ -72,6 +212,10 @@ func (n *nodeMap) remove(node *storeNode) {
 	info := node.Info()
 	n.remainingResources.Add(&info.Resource)
 	delete(n.nodes, info.Guid)
+	if node.hasGardenContainer() {
+		n.exhaustedLimits = map[executor.GardenLimit]struct{}{}
+	}
+	n.capacityChanges.notify()
 }
 
 func (n *nodeMap) Get(guid string) (*storeNode, error) {
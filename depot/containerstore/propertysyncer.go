@@ -0,0 +1,47 @@
+package containerstore
+
+import (
+	"os"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type propertySyncer struct {
+	logger     lager.Logger
+	config     *ContainerConfig
+	clock      clock.Clock
+	containers *nodeMap
+}
+
+func newPropertySyncer(logger lager.Logger, config *ContainerConfig, clock clock.Clock, containers *nodeMap) *propertySyncer {
+	return &propertySyncer{
+		logger:     logger,
+		config:     config,
+		clock:      clock,
+		containers: containers,
+	}
+}
+
+// Run periodically mirrors the state, tags, ports, internal routes and
+// routability of every container into its garden properties, repairing the
+// properties that were changed or removed behind the executor's back.
+func (s *propertySyncer) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := s.logger.Session("property-syncer")
+	ticker := s.clock.NewTicker(s.config.PropertySyncInterval)
+
+	close(ready)
+
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			for _, node := range s.containers.List() {
+				node.syncProperties(logger)
+			}
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			return nil
+		}
+	}
+}
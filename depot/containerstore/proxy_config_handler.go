@@ -23,6 +23,9 @@ import (
 	envoy_endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	envoy_listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	envoy_metrics "github.com/envoyproxy/go-control-plane/envoy/config/metrics/v3"
+	envoy_route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoy_router "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	envoy_hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	envoy_tcp_proxy "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
 	envoy_tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	envoy_discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
@@ -44,12 +47,20 @@ const (
 	DefaultHTTPPort = 8080
 	C2CTLSPort      = 61443
 
+	// ProxyStatsPort serves the /stats endpoint of the Envoy admin API on
+	// the container IP when proxy stats are enabled. The rest of the admin
+	// API stays on the loopback.
+	ProxyStatsPort = 61444
+
 	TimeOut = 250000000
 
 	IngressListener = "ingress_listener"
 	TcpProxy        = "envoy.tcp_proxy"
 	AdsClusterName  = "pilot-ads"
 
+	ProxyStatsListener    = "proxy-stats"
+	ProxyAdminClusterName = "envoy-admin"
+
 	AdminAccessLog = os.DevNull
 )
 
@@ -57,6 +68,7 @@ var (
 	ErrNoPortsAvailable     = errors.New("no ports available")
 	ErrInvalidCertificate   = errors.New("cannot parse invalid certificate")
 	ErrC2CTLSPortIsReserved = fmt.Errorf("port %d is reserved for container networking", C2CTLSPort)
+	ErrStatsPortIsReserved  = fmt.Errorf("port %d is reserved for proxy stats", ProxyStatsPort)
 
 	AlpnProtocols         = []string{"h2,http/1.1"}
 	SupportedCipherSuites = []string{"ECDHE-RSA-AES256-GCM-SHA384", "ECDHE-RSA-AES128-GCM-SHA256"}
@@ -89,6 +101,7 @@ type ProxyConfigHandler struct {
 	adsServers []string
 
 	http2Enabled bool
+	statsEnabled bool
 }
 
 type NoopProxyConfigHandler struct{}
@@ -133,6 +146,7 @@ func NewProxyConfigHandler(
 	reloadClock clock.Clock,
 	adsServers []string,
 	http2Enabled bool,
+	statsEnabled bool,
 ) *ProxyConfigHandler {
 	return &ProxyConfigHandler{
 		logger:                             logger.Session("proxy-manager"),
@@ -145,6 +159,7 @@ func NewProxyConfigHandler(
 		reloadClock:                        reloadClock,
 		adsServers:                         adsServers,
 		http2Enabled:                       http2Enabled,
+		statsEnabled:                       statsEnabled,
 	}
 }
 
@@ -162,6 +177,9 @@ func (p *ProxyConfigHandler) ProxyPorts(logger lager.Logger, container *executor
 		if portMap.ContainerPort == C2CTLSPort {
 			return nil, nil, ErrC2CTLSPortIsReserved
 		}
+		if p.statsEnabled && portMap.ContainerPort == ProxyStatsPort {
+			return nil, nil, ErrStatsPortIsReserved
+		}
 		existingPorts[portMap.ContainerPort] = struct{}{}
 		containerPorts[i] = portMap.ContainerPort
 	}
@@ -182,6 +200,10 @@ func (p *ProxyConfigHandler) ProxyPorts(logger lager.Logger, container *executor
 			continue
 		}
 
+		if p.statsEnabled && port == ProxyStatsPort {
+			continue
+		}
+
 		extraPorts = append(extraPorts, port)
 		proxyPortMapping = append(proxyPortMapping, executor.ProxyPortMapping{
 			AppPort:   containerPorts[portCount],
@@ -269,7 +291,11 @@ func (p *ProxyConfigHandler) writeConfig(credentials Credentials, container exec
 	sdsC2CCertAndKeyPath := filepath.Join(p.containerProxyConfigPath, container.Guid, "sds-c2c-cert-and-key.yaml")
 	sdsIDValidationContextPath := filepath.Join(p.containerProxyConfigPath, container.Guid, "sds-id-validation-context.yaml")
 
-	adminPort, err := getAvailablePort(container.Ports)
+	var reservedPorts []uint16
+	if p.statsEnabled {
+		reservedPorts = append(reservedPorts, ProxyStatsPort)
+	}
+	adminPort, err := getAvailablePort(container.Ports, reservedPorts...)
 	if err != nil {
 		return err
 	}
@@ -280,6 +306,7 @@ func (p *ProxyConfigHandler) writeConfig(credentials Credentials, container exec
 		p.containerProxyRequireClientCerts,
 		p.adsServers,
 		p.http2Enabled,
+		p.statsEnabled,
 	)
 	if err != nil {
 		return err
@@ -336,12 +363,35 @@ func envoyAddr(ip string, port uint16) *envoy_core.Address {
 	}
 }
 
+// envoyListenerAddr listens on all the addresses of the IP family of the
+// container.
+func envoyListenerAddr(family executor.IPFamily, port uint16) *envoy_core.Address {
+	switch family {
+	case executor.IPFamilyIPv6:
+		return envoyAddr("::", port)
+	case executor.IPFamilyDualStack:
+		addr := envoyAddr("::", port)
+		addr.GetSocketAddress().Ipv4Compat = true
+		return addr
+	default:
+		return envoyAddr("0.0.0.0", port)
+	}
+}
+
+func envoyLoopback(family executor.IPFamily) string {
+	if family == executor.IPFamilyIPv6 {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
 func generateProxyConfig(
 	container executor.Container,
 	adminPort uint16,
 	requireClientCerts bool,
 	adsServers []string,
 	http2Enabled bool,
+	statsEnabled bool,
 ) (*envoy_bootstrap.Bootstrap, error) {
 	clusters := []*envoy_cluster.Cluster{}
 
@@ -385,7 +435,7 @@ func generateProxyConfig(
 	config := &envoy_bootstrap.Bootstrap{
 		Admin: &envoy_bootstrap.Admin{
 			AccessLogPath: AdminAccessLog,
-			Address:       envoyAddr("127.0.0.1", adminPort),
+			Address:       envoyAddr(envoyLoopback(container.IPFamily), adminPort),
 		},
 		StatsConfig: &envoy_metrics.StatsConfig{
 			StatsMatcher: &envoy_metrics.StatsMatcher{
@@ -485,11 +535,107 @@ func generateProxyConfig(
 		config.DynamicResources = dynamicResources
 	}
 
+	if statsEnabled {
+		statsListener, err := generateStatsListener(container)
+		if err != nil {
+			return nil, fmt.Errorf("generating stats listener: %s", err)
+		}
+		config.StaticResources.Listeners = append(config.StaticResources.Listeners, statsListener)
+
+		clusters = append(clusters, &envoy_cluster.Cluster{
+			Name:                 ProxyAdminClusterName,
+			ClusterDiscoveryType: &envoy_cluster.Cluster_Type{Type: envoy_cluster.Cluster_STATIC},
+			ConnectTimeout:       &duration.Duration{Nanos: TimeOut},
+			LoadAssignment: &envoy_endpoint.ClusterLoadAssignment{
+				ClusterName: ProxyAdminClusterName,
+				Endpoints: []*envoy_endpoint.LocalityLbEndpoints{{
+					LbEndpoints: []*envoy_endpoint.LbEndpoint{{
+						HostIdentifier: &envoy_endpoint.LbEndpoint_Endpoint{
+							Endpoint: &envoy_endpoint.Endpoint{
+								Address: envoyAddr(envoyLoopback(container.IPFamily), adminPort),
+							},
+						},
+					}},
+				}},
+			},
+		})
+
+		// only keep the stats of the listeners and of the clusters of the
+		// app ports, which are scraped by the executor
+		config.StatsConfig.StatsMatcher.StatsMatcher = &envoy_metrics.StatsMatcher_InclusionList{
+			InclusionList: &envoy_matcher.ListStringMatcher{
+				Patterns: []*envoy_matcher.StringMatcher{
+					{MatchPattern: &envoy_matcher.StringMatcher_Prefix{Prefix: "listener."}},
+					{MatchPattern: &envoy_matcher.StringMatcher_Prefix{Prefix: "cluster.service-cluster-"}},
+				},
+			},
+		}
+	}
+
 	config.StaticResources.Clusters = clusters
 
 	return config, nil
 }
 
+// generateStatsListener routes GET /stats on ProxyStatsPort to the admin API,
+// so that the stats can be read from outside the container without exposing
+// the endpoints of the admin API that change the state of the proxy.
+func generateStatsListener(container executor.Container) (*envoy_listener.Listener, error) {
+	routerConfig, err := ptypes.MarshalAny(&envoy_router.Router{})
+	if err != nil {
+		return nil, err
+	}
+
+	filterConfig, err := ptypes.MarshalAny(&envoy_hcm.HttpConnectionManager{
+		StatPrefix: ProxyStatsListener,
+		RouteSpecifier: &envoy_hcm.HttpConnectionManager_RouteConfig{
+			RouteConfig: &envoy_route.RouteConfiguration{
+				Name: ProxyStatsListener,
+				VirtualHosts: []*envoy_route.VirtualHost{{
+					Name:    ProxyStatsListener,
+					Domains: []string{"*"},
+					Routes: []*envoy_route.Route{{
+						Match: &envoy_route.RouteMatch{
+							PathSpecifier: &envoy_route.RouteMatch_Path{Path: "/stats"},
+							Headers: []*envoy_route.HeaderMatcher{{
+								Name: ":method",
+								HeaderMatchSpecifier: &envoy_route.HeaderMatcher_StringMatch{
+									StringMatch: &envoy_matcher.StringMatcher{
+										MatchPattern: &envoy_matcher.StringMatcher_Exact{Exact: "GET"},
+									},
+								},
+							}},
+						},
+						Action: &envoy_route.Route_Route{
+							Route: &envoy_route.RouteAction{
+								ClusterSpecifier: &envoy_route.RouteAction_Cluster{Cluster: ProxyAdminClusterName},
+							},
+						},
+					}},
+				}},
+			},
+		},
+		HttpFilters: []*envoy_hcm.HttpFilter{{
+			Name:       "envoy.filters.http.router",
+			ConfigType: &envoy_hcm.HttpFilter_TypedConfig{TypedConfig: routerConfig},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoy_listener.Listener{
+		Name:    ProxyStatsListener,
+		Address: envoyListenerAddr(container.IPFamily, ProxyStatsPort),
+		FilterChains: []*envoy_listener.FilterChain{{
+			Filters: []*envoy_listener.Filter{{
+				Name:       "envoy.filters.network.http_connection_manager",
+				ConfigType: &envoy_listener.Filter_TypedConfig{TypedConfig: filterConfig},
+			}},
+		}},
+	}, nil
+}
+
 var adsConfigSource = &envoy_core.ConfigSource{
 	ConfigSourceSpecifier: &envoy_core.ConfigSource_Ads{
 		Ads: &envoy_core.AggregatedConfigSource{},
@@ -590,7 +736,7 @@ func generateListeners(container executor.Container, requireClientCerts, http2En
 		listenerName := fmt.Sprintf("listener-%d-%d", portMap.ContainerPort, portMap.ContainerTLSProxyPort)
 		listener := &envoy_listener.Listener{
 			Name:    listenerName,
-			Address: envoyAddr("0.0.0.0", portMap.ContainerTLSProxyPort),
+			Address: envoyListenerAddr(container.IPFamily, portMap.ContainerTLSProxyPort),
 			FilterChains: []*envoy_listener.FilterChain{{
 				Filters: []*envoy_listener.Filter{
 					{
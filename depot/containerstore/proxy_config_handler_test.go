@@ -25,6 +25,7 @@ import (
 	envoy_core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	envoy_listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	envoy_tcp_proxy "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
 	envoy_tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	envoy_discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
@@ -63,6 +64,7 @@ var _ = Describe("ProxyConfigHandler", func() {
 		containerProxyRequireClientCerts   bool
 		adsServers                         []string
 		http2Enabled                       bool
+		statsEnabled                       bool
 		credentials                        containerstore.Credentials
 	)
 
@@ -107,6 +109,7 @@ var _ = Describe("ProxyConfigHandler", func() {
 			"10.255.217.3:15010",
 		}
 		http2Enabled = true
+		statsEnabled = false
 		cert, key, _ := generateCertAndKey()
 		credentials = containerstore.Credentials{
 			InstanceIdentityCredential: containerstore.Credential{
@@ -132,6 +135,7 @@ var _ = Describe("ProxyConfigHandler", func() {
 			reloadClock,
 			adsServers,
 			http2Enabled,
+			statsEnabled,
 		)
 		Eventually(rotatingCredChan).Should(BeSent(containerstore.Credential{
 			Cert: "some-cert",
@@ -409,6 +413,36 @@ var _ = Describe("ProxyConfigHandler", func() {
 				}))
 				Expect(extraPorts).NotTo(ContainElement(61443))
 			})
+
+			Context("and proxy stats are enabled", func() {
+				BeforeEach(func() {
+					statsEnabled = true
+				})
+
+				It("does not reserve port 61444 either", func() {
+					ports, extraPorts, err := proxyConfigHandler.ProxyPorts(logger, &container)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ports[442]).To(Equal(executor.ProxyPortMapping{
+						AppPort:   443,
+						ProxyPort: 61445,
+					}))
+					Expect(extraPorts).NotTo(ContainElement(61444))
+				})
+			})
+		})
+
+		Context("when proxy stats are enabled and the requested port is 61444", func() {
+			BeforeEach(func() {
+				statsEnabled = true
+				container.Ports = []executor.PortMapping{
+					{ContainerPort: 61444},
+				}
+			})
+
+			It("returns an error that 61444 is a reserved port", func() {
+				_, _, err := proxyConfigHandler.ProxyPorts(logger, &container)
+				Expect(err).To(MatchError("port 61444 is reserved for proxy stats"))
+			})
 		})
 	})
 
@@ -829,6 +863,90 @@ var _ = Describe("ProxyConfigHandler", func() {
 			})
 		})
 
+		Context("when the container is dual-stack", func() {
+			BeforeEach(func() {
+				container.IPFamily = executor.IPFamilyDualStack
+			})
+
+			It("listens on both IPv4 and IPv6 addresses", func() {
+				err := proxyConfigHandler.Update(credentials, container)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(proxyConfigFile).Should(BeAnExistingFile())
+
+				var proxyConfig envoy_bootstrap.Bootstrap
+				Expect(yamlFileToProto(proxyConfigFile, &proxyConfig)).To(Succeed())
+
+				Expect(proxyConfig.StaticResources.Listeners).To(HaveLen(2))
+				for _, listener := range proxyConfig.StaticResources.Listeners {
+					address := listener.Address.GetSocketAddress()
+					Expect(address.Address).To(Equal("::"))
+					Expect(address.Ipv4Compat).To(BeTrue())
+				}
+				Expect(proxyConfig.Admin.Address.GetSocketAddress().Address).To(Equal("127.0.0.1"))
+			})
+		})
+
+		Context("when proxy stats are enabled", func() {
+			BeforeEach(func() {
+				statsEnabled = true
+			})
+
+			It("serves the stats of the listeners and app clusters on the stats port", func() {
+				err := proxyConfigHandler.Update(credentials, container)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(proxyConfigFile).Should(BeAnExistingFile())
+
+				var proxyConfig envoy_bootstrap.Bootstrap
+				Expect(yamlFileToProto(proxyConfigFile, &proxyConfig)).To(Succeed())
+
+				inclusionList := proxyConfig.StatsConfig.StatsMatcher.GetInclusionList()
+				Expect(inclusionList).NotTo(BeNil())
+				Expect(inclusionList.Patterns).To(HaveLen(2))
+				Expect(inclusionList.Patterns[0].GetPrefix()).To(Equal("listener."))
+				Expect(inclusionList.Patterns[1].GetPrefix()).To(Equal("cluster.service-cluster-"))
+
+				Expect(proxyConfig.StaticResources.Listeners).To(HaveLen(3))
+				statsListener := proxyConfig.StaticResources.Listeners[2]
+				Expect(statsListener.Name).To(Equal("proxy-stats"))
+				Expect(statsListener.Address.GetSocketAddress().GetPortValue()).To(Equal(uint32(61444)))
+
+				var hcm envoy_hcm.HttpConnectionManager
+				Expect(ptypes.UnmarshalAny(statsListener.FilterChains[0].Filters[0].GetTypedConfig(), &hcm)).To(Succeed())
+				routes := hcm.GetRouteConfig().VirtualHosts[0].Routes
+				Expect(routes).To(HaveLen(1))
+				Expect(routes[0].Match.GetPath()).To(Equal("/stats"))
+				Expect(routes[0].GetRoute().GetCluster()).To(Equal("envoy-admin"))
+
+				adminCluster := proxyConfig.StaticResources.Clusters[len(proxyConfig.StaticResources.Clusters)-1]
+				Expect(adminCluster.Name).To(Equal("envoy-admin"))
+				adminAddress := adminCluster.LoadAssignment.Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress()
+				Expect(adminAddress.Address).To(Equal("127.0.0.1"))
+				Expect(adminAddress.GetPortValue()).To(Equal(proxyConfig.Admin.Address.GetSocketAddress().GetPortValue()))
+			})
+		})
+
+		Context("when the container is IPv6 only", func() {
+			BeforeEach(func() {
+				container.IPFamily = executor.IPFamilyIPv6
+			})
+
+			It("listens on IPv6 addresses and the IPv6 loopback for admin", func() {
+				err := proxyConfigHandler.Update(credentials, container)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(proxyConfigFile).Should(BeAnExistingFile())
+
+				var proxyConfig envoy_bootstrap.Bootstrap
+				Expect(yamlFileToProto(proxyConfigFile, &proxyConfig)).To(Succeed())
+
+				for _, listener := range proxyConfig.StaticResources.Listeners {
+					address := listener.Address.GetSocketAddress()
+					Expect(address.Address).To(Equal("::"))
+					Expect(address.Ipv4Compat).To(BeFalse())
+				}
+				Expect(proxyConfig.Admin.Address.GetSocketAddress().Address).To(Equal("::1"))
+			})
+		})
+
 		Context("with multiple port mappings", func() {
 			BeforeEach(func() {
 				container.Ports = []executor.PortMapping{
@@ -0,0 +1,70 @@
+package containerstore
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const DefaultMaxResultArtifactBytes = 10 * 1024
+
+// captureResultArtifacts reads the regular files matching the result globs
+// of a completed container. Only the last element of a glob may contain
+// wildcards. Once maxBytes have been captured in total, the remaining
+// content is dropped and the artifact is marked as truncated.
+func captureResultArtifacts(logger lager.Logger, gardenContainer garden.Container, globs []string, maxBytes int) []executor.ResultArtifact {
+	logger = logger.Session("capture-result-artifacts")
+
+	artifacts := []executor.ResultArtifact{}
+	remaining := maxBytes
+	for _, glob := range globs {
+		dir, pattern := path.Split(path.Clean(glob))
+
+		stream, err := gardenContainer.StreamOut(garden.StreamOutSpec{Path: dir, User: "root"})
+		if err != nil {
+			logger.Error("failed-to-stream-out", err, lager.Data{"glob": glob})
+			continue
+		}
+
+		tarReader := tar.NewReader(stream)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				logger.Error("failed-to-read-stream", err, lager.Data{"glob": glob})
+				break
+			}
+
+			name := strings.TrimPrefix(path.Clean(header.Name), "./")
+			if header.Typeflag != tar.TypeReg || strings.Contains(name, "/") {
+				continue
+			}
+			if matched, _ := path.Match(pattern, name); !matched {
+				continue
+			}
+
+			content, err := io.ReadAll(io.LimitReader(tarReader, int64(remaining)))
+			if err != nil {
+				logger.Error("failed-to-read-artifact", err, lager.Data{"path": path.Join(dir, name)})
+				continue
+			}
+			remaining -= len(content)
+
+			artifacts = append(artifacts, executor.ResultArtifact{
+				Path:      path.Join(dir, name),
+				Content:   content,
+				Truncated: int64(len(content)) < header.Size,
+			})
+		}
+		stream.Close()
+	}
+
+	return artifacts
+}
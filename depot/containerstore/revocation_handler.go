@@ -0,0 +1,116 @@
+package containerstore
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"sync"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+//go:generate counterfeiter -o containerstorefakes/fake_revoker.go . Revoker
+
+type Revoker interface {
+	Revoke(cert *x509.Certificate) error
+}
+
+// RevocationHandler revokes the instance identity and c2c certificates of a
+// container when they are replaced by a rotation, and the current ones when
+// the container is destroyed.
+type RevocationHandler struct {
+	revoker Revoker
+
+	lock  sync.Mutex
+	certs map[string]revocationCerts
+}
+
+type revocationCerts struct {
+	instanceIdentity *x509.Certificate
+	c2c              *x509.Certificate
+}
+
+func NewRevocationHandler(revoker Revoker) *RevocationHandler {
+	return &RevocationHandler{
+		revoker: revoker,
+		certs:   map[string]revocationCerts{},
+	}
+}
+
+func (h *RevocationHandler) CreateDir(logger lager.Logger, container executor.Container) ([]garden.BindMount, []executor.EnvironmentVariable, error) {
+	return nil, nil, nil
+}
+
+func (h *RevocationHandler) RemoveDir(logger lager.Logger, container executor.Container) error {
+	h.lock.Lock()
+	certs, ok := h.certs[container.Guid]
+	delete(h.certs, container.Guid)
+	h.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return h.revoke(certs.instanceIdentity, certs.c2c)
+}
+
+func (h *RevocationHandler) Update(creds Credentials, container executor.Container) error {
+	var err error
+	next := revocationCerts{}
+
+	if !creds.InstanceIdentityCredential.IsEmpty() {
+		next.instanceIdentity, err = parseCredentialCert(creds.InstanceIdentityCredential)
+		if err != nil {
+			return err
+		}
+	}
+	if !creds.C2CCredential.IsEmpty() {
+		next.c2c, err = parseCredentialCert(creds.C2CCredential)
+		if err != nil {
+			return err
+		}
+	}
+
+	h.lock.Lock()
+	previous := h.certs[container.Guid]
+	var revoked []*x509.Certificate
+	if next.instanceIdentity != nil {
+		revoked = append(revoked, previous.instanceIdentity)
+		previous.instanceIdentity = next.instanceIdentity
+	}
+	if next.c2c != nil {
+		revoked = append(revoked, previous.c2c)
+		previous.c2c = next.c2c
+	}
+	h.certs[container.Guid] = previous
+	h.lock.Unlock()
+
+	return h.revoke(revoked...)
+}
+
+func (h *RevocationHandler) Close(creds Credentials, container executor.Container) error {
+	return nil
+}
+
+func (h *RevocationHandler) revoke(certs ...*x509.Certificate) error {
+	for _, cert := range certs {
+		if cert == nil {
+			continue
+		}
+		err := h.revoker.Revoke(cert)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseCredentialCert(cred Credential) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(cred.Cert))
+	if block == nil {
+		return nil, errors.New("certificate is not PEM-encoded")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,129 @@
+package containerstore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/executor/depot/containerstore/containerstorefakes"
+)
+
+var _ = Describe("RevocationHandler", func() {
+	var (
+		revoker   *containerstorefakes.FakeRevoker
+		handler   *containerstore.RevocationHandler
+		container executor.Container
+	)
+
+	newCredential := func(serial int64) containerstore.Credential {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		Expect(err).NotTo(HaveOccurred())
+		return containerstore.Credential{
+			Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})),
+			Key:  "key",
+		}
+	}
+
+	revokedSerials := func() []int64 {
+		serials := []int64{}
+		for i := 0; i < revoker.RevokeCallCount(); i++ {
+			serials = append(serials, revoker.RevokeArgsForCall(i).SerialNumber.Int64())
+		}
+		return serials
+	}
+
+	BeforeEach(func() {
+		revoker = &containerstorefakes.FakeRevoker{}
+		handler = containerstore.NewRevocationHandler(revoker)
+		container = executor.Container{Guid: "some-guid"}
+	})
+
+	Describe("Update", func() {
+		It("does not revoke anything for the initial credentials", func() {
+			Expect(handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: newCredential(1),
+				C2CCredential:              newCredential(2),
+			}, container)).To(Succeed())
+			Expect(revoker.RevokeCallCount()).To(Equal(0))
+		})
+
+		It("revokes the certificates replaced by a rotation", func() {
+			Expect(handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: newCredential(1),
+				C2CCredential:              newCredential(2),
+			}, container)).To(Succeed())
+			Expect(handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: newCredential(3),
+				C2CCredential:              newCredential(4),
+			}, container)).To(Succeed())
+
+			Expect(revokedSerials()).To(Equal([]int64{1, 2}))
+		})
+
+		It("only revokes the credential types that were rotated", func() {
+			Expect(handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: newCredential(1),
+				C2CCredential:              newCredential(2),
+			}, container)).To(Succeed())
+			Expect(handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: newCredential(3),
+			}, container)).To(Succeed())
+
+			Expect(revokedSerials()).To(Equal([]int64{1}))
+		})
+
+		Context("when revoking fails", func() {
+			BeforeEach(func() {
+				revoker.RevokeReturns(errors.New("boom"))
+			})
+
+			It("returns the error", func() {
+				Expect(handler.Update(containerstore.Credentials{InstanceIdentityCredential: newCredential(1)}, container)).To(Succeed())
+				Expect(handler.Update(containerstore.Credentials{InstanceIdentityCredential: newCredential(2)}, container)).To(MatchError("boom"))
+			})
+		})
+
+		Context("when the certificate is not PEM-encoded", func() {
+			It("returns an error", func() {
+				err := handler.Update(containerstore.Credentials{
+					InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: "key"},
+				}, container)
+				Expect(err).To(MatchError("certificate is not PEM-encoded"))
+			})
+		})
+	})
+
+	Describe("RemoveDir", func() {
+		It("revokes the current certificates of the container", func() {
+			Expect(handler.Update(containerstore.Credentials{
+				InstanceIdentityCredential: newCredential(1),
+				C2CCredential:              newCredential(2),
+			}, container)).To(Succeed())
+
+			Expect(handler.RemoveDir(logger, container)).To(Succeed())
+			Expect(revokedSerials()).To(Equal([]int64{1, 2}))
+		})
+
+		It("does nothing for containers without credentials", func() {
+			Expect(handler.RemoveDir(logger, container)).To(Succeed())
+			Expect(revoker.RevokeCallCount()).To(Equal(0))
+		})
+	})
+})
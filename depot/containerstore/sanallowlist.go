@@ -0,0 +1,80 @@
+package containerstore
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+)
+
+// SANAllowlist restricts the additional SANs that can be requested through
+// the CertificateProperties of a container. A DNS name pattern matches the
+// name exactly, or any subdomain when it starts with "*.". An empty allowlist
+// rejects all additional SANs.
+type SANAllowlist struct {
+	DNSNames []string
+	Networks []*net.IPNet
+}
+
+// NewSANAllowlist parses the allowed networks given in CIDR notation.
+func NewSANAllowlist(dnsNames, networks []string) (SANAllowlist, error) {
+	allowlist := SANAllowlist{DNSNames: dnsNames}
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return SANAllowlist{}, err
+		}
+		allowlist.Networks = append(allowlist.Networks, ipNet)
+	}
+	return allowlist, nil
+}
+
+// Validate returns the additional SANs requested by the container, or an
+// error naming the first one that is not allowed.
+func (a SANAllowlist) Validate(props executor.CertificateProperties) ([]string, []net.IP, error) {
+	for _, name := range props.DNSNames {
+		if !a.allowsDNSName(name) {
+			return nil, nil, fmt.Errorf("DNS SAN not allowed: %s", name)
+		}
+	}
+
+	ips := make([]net.IP, 0, len(props.IPAddresses))
+	for _, address := range props.IPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid IP SAN: %s", address)
+		}
+		if !a.allowsIP(ip) {
+			return nil, nil, fmt.Errorf("IP SAN not allowed: %s", address)
+		}
+		ips = append(ips, ip)
+	}
+
+	return props.DNSNames, ips, nil
+}
+
+func (a SANAllowlist) allowsDNSName(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range a.DNSNames {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			suffix := strings.TrimPrefix(pattern, "*")
+			if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (a SANAllowlist) allowsIP(ip net.IP) bool {
+	for _, network := range a.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
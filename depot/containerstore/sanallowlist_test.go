@@ -0,0 +1,57 @@
+package containerstore_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+)
+
+var _ = Describe("SANAllowlist", func() {
+	var allowlist containerstore.SANAllowlist
+
+	BeforeEach(func() {
+		var err error
+		allowlist, err = containerstore.NewSANAllowlist([]string{"*.apps.example.com", "exact.example.com"}, []string{"10.0.0.0/24"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("allows names and addresses matching the allowlist", func() {
+		dnsNames, ips, err := allowlist.Validate(executor.CertificateProperties{
+			DNSNames:    []string{"foo.apps.example.com", "Exact.Example.com"},
+			IPAddresses: []string{"10.0.0.5"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dnsNames).To(Equal([]string{"foo.apps.example.com", "Exact.Example.com"}))
+		Expect(ips).To(Equal([]net.IP{net.ParseIP("10.0.0.5")}))
+	})
+
+	It("rejects names that do not match", func() {
+		_, _, err := allowlist.Validate(executor.CertificateProperties{DNSNames: []string{"apps.example.com"}})
+		Expect(err).To(MatchError("DNS SAN not allowed: apps.example.com"))
+
+		_, _, err = allowlist.Validate(executor.CertificateProperties{DNSNames: []string{"foo.exact.example.com"}})
+		Expect(err).To(MatchError("DNS SAN not allowed: foo.exact.example.com"))
+	})
+
+	It("rejects addresses outside the allowed networks", func() {
+		_, _, err := allowlist.Validate(executor.CertificateProperties{IPAddresses: []string{"10.0.1.5"}})
+		Expect(err).To(MatchError("IP SAN not allowed: 10.0.1.5"))
+
+		_, _, err = allowlist.Validate(executor.CertificateProperties{IPAddresses: []string{"not-an-ip"}})
+		Expect(err).To(MatchError("invalid IP SAN: not-an-ip"))
+	})
+
+	It("rejects all custom SANs when empty", func() {
+		_, _, err := containerstore.SANAllowlist{}.Validate(executor.CertificateProperties{DNSNames: []string{"foo.example.com"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails on invalid networks", func() {
+		_, err := containerstore.NewSANAllowlist(nil, []string{"10.0.0.0"})
+		Expect(err).To(HaveOccurred())
+	})
+})
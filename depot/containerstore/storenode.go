@@ -1,14 +1,22 @@
 package containerstore
 
 import (
+	"archive/tar"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/executor"
@@ -33,12 +41,19 @@ const ContainerMissingMessage = "missing garden container"
 const VolmanMountFailed = "failed to mount volume"
 const BindMountCleanupFailed = "failed to cleanup bindmount artifacts"
 const CredDirFailed = "failed to create credentials directory"
+const ImagePullFailed = "failed to pull image"
+const ImageCredentialsFailed = "failed to resolve image credentials"
 
 const ContainerCompletedCount = "ContainerCompletedCount"
 const ContainerExitedOnTimeoutCount = "ContainerExitedOnTimeoutCount"
 
 const maxErrorMsgLength = 1024
 
+const (
+	defaultRestartInitialBackoff = time.Second
+	defaultRestartMaxBackoff     = time.Minute
+)
+
 // To be deprecated
 const (
 	GardenContainerCreationSucceededDuration    = "GardenContainerCreationSucceededDuration"
@@ -46,6 +61,7 @@ const (
 	GardenContainerDestructionSucceededDuration = "GardenContainerDestructionSucceededDuration"
 	GardenContainerDestructionFailedDuration    = "GardenContainerDestructionFailedDuration"
 	ContainerSetupFailedDuration                = "ContainerSetupFailedDuration"
+	ImageFetchDuration                          = "ImageFetchDuration"
 )
 
 //go:generate counterfeiter -o containerstorefakes/fake_proxymanager.go . ProxyManager
@@ -95,7 +111,31 @@ type storeNode struct {
 	startTime         time.Time
 	regenerateCertsCh chan struct{}
 
+	// startDeadline is when the start timeout of the container runs out. It
+	// is protected by infoLock and zero when the container has no start
+	// timeout.
+	startDeadline time.Time
+
+	// timeline records when the steps of the container run. It is set by
+	// Run and attached to the run result when the container completes.
+	timeline *steps.Timeline
+
+	// egressLock protects the addresses already allowed by hostname egress
+	// rules, keyed by rule index and address
+	egressLock       sync.Mutex
+	allowedEgressIPs map[string]struct{}
+
 	jsonMarshaller func(any) ([]byte, error)
+
+	coreDumps   *coreDumpCollector
+	ipRetention *ipRetention
+	images      *imageManager
+
+	imageCredentials *imageCredentialResolver
+
+	// pulledImage is the URI of the image pulled by the image manager, from
+	// which the garden container is created instead of the rootfs.
+	pulledImage string
 }
 
 func newStoreNode(
@@ -119,6 +159,10 @@ func newStoreNode(
 	enableUnproxiedPortMappings bool,
 	advertisePreferenceForInstanceAddress bool,
 	jsonMarshaller func(any) ([]byte, error),
+	coreDumps *coreDumpCollector,
+	ipRetention *ipRetention,
+	images *imageManager,
+	imageCredentials *imageCredentialResolver,
 ) *storeNode {
 	return &storeNode{
 		config:                                config,
@@ -144,7 +188,12 @@ func newStoreNode(
 		enableUnproxiedPortMappings:           enableUnproxiedPortMappings,
 		advertisePreferenceForInstanceAddress: advertisePreferenceForInstanceAddress,
 		regenerateCertsCh:                     make(chan struct{}, 1),
+		allowedEgressIPs:                      map[string]struct{}{},
 		jsonMarshaller:                        jsonMarshaller,
+		coreDumps:                             coreDumps,
+		ipRetention:                           ipRetention,
+		images:                                images,
+		imageCredentials:                      imageCredentials,
 	}
 }
 
@@ -159,23 +208,106 @@ func (n *storeNode) releaseOpLock(logger lager.Logger) {
 	logger.Debug("ops-lock-released")
 }
 
+// hasGardenContainer reports whether garden created a container for the node.
+func (n *storeNode) hasGardenContainer() bool {
+	n.infoLock.Lock()
+	defer n.infoLock.Unlock()
+	return n.gardenContainer != nil
+}
+
 func (n *storeNode) Info() executor.Container {
 	n.infoLock.Lock()
 	defer n.infoLock.Unlock()
 
-	return n.info.Copy()
+	info := n.info.Copy()
+	if info.State == executor.StateCreated && !n.startDeadline.IsZero() {
+		remaining := n.startDeadline.Sub(n.clock.Now())
+		if remaining < 0 {
+			remaining = 0
+		}
+		info.StartTimeoutRemainingMs = remaining.Milliseconds()
+	}
+	return info
+}
+
+// gardenProcess adapts a process run in a garden container to the executor.
+type gardenProcess struct {
+	process garden.Process
+}
+
+func (p gardenProcess) ID() string         { return p.process.ID() }
+func (p gardenProcess) Wait() (int, error) { return p.process.Wait() }
+func (p gardenProcess) Kill() error        { return p.process.Signal(garden.SignalKill) }
+
+func (p gardenProcess) Resize(size executor.WindowSize) error {
+	return p.process.SetTTY(garden.TTYSpec{
+		WindowSize: &garden.WindowSize{Columns: size.Columns, Rows: size.Rows},
+	})
 }
 
 func (n *storeNode) GetFiles(logger lager.Logger, sourcePath string) (io.ReadCloser, error) {
 	n.infoLock.Lock()
 	gc := n.gardenContainer
+	guid := n.info.Guid
 	n.infoLock.Unlock()
 	if gc == nil {
 		return nil, executor.ErrContainerNotFound
 	}
+	if dir, name := path.Split(path.Clean(sourcePath)); path.Clean(dir) == executor.CoreDumpsPath {
+		return n.coreDumps.Open(guid, name)
+	}
 	return gc.StreamOut(garden.StreamOutSpec{Path: sourcePath, User: "root"})
 }
 
+// StreamIn extracts the tar stream into the container at the destination
+// path.
+func (n *storeNode) StreamIn(logger lager.Logger, destinationPath string, tarStream io.Reader) error {
+	n.infoLock.Lock()
+	gc := n.gardenContainer
+	n.infoLock.Unlock()
+	if gc == nil {
+		return executor.ErrContainerNotFound
+	}
+	return gc.StreamIn(garden.StreamInSpec{Path: destinationPath, User: "root", TarStream: tarStream})
+}
+
+func (n *storeNode) RunProcess(logger lager.Logger, spec executor.ProcessSpec, processIO executor.ProcessIO) (executor.Process, error) {
+	n.infoLock.Lock()
+	gc := n.gardenContainer
+	state := n.info.State
+	n.infoLock.Unlock()
+	if gc == nil {
+		return nil, executor.ErrContainerNotFound
+	}
+	if state != executor.StateRunning {
+		return nil, executor.ErrContainerNotRunning
+	}
+
+	processSpec := garden.ProcessSpec{
+		Path: spec.Path,
+		Args: spec.Args,
+		Env:  spec.Env,
+		Dir:  spec.Dir,
+		User: spec.User,
+	}
+	if spec.TTY != nil {
+		processSpec.TTY = &garden.TTYSpec{
+			WindowSize: &garden.WindowSize{Columns: spec.TTY.Columns, Rows: spec.TTY.Rows},
+		}
+	}
+
+	process, err := gc.Run(processSpec, garden.ProcessIO{
+		Stdin:  processIO.Stdin,
+		Stdout: processIO.Stdout,
+		Stderr: processIO.Stderr,
+	})
+	if err != nil {
+		logger.Error("failed-to-run-process", err)
+		return nil, err
+	}
+	return gardenProcess{process}, nil
+}
+
 func (n *storeNode) Initialize(logger lager.Logger, req *executor.RunRequest) error {
 	logger = logger.Session("node-initialize")
 	n.infoLock.Lock()
@@ -211,6 +343,9 @@ func (n *storeNode) Create(logger lager.Logger, traceID string) error {
 		}
 
 		n.bindMounts = mounts.GardenBindMounts
+		info.SetupMetrics.CacheHits = uint64(mounts.CacheHits)
+		info.SetupMetrics.CacheMisses = uint64(mounts.CacheMisses)
+		info.SetupMetrics.DownloadedBytes = uint64(mounts.DownloadedBytes)
 
 		if n.hostTrustedCertificatesPath != "" && info.TrustedSystemCertificatesPath != "" {
 			mount := garden.BindMount{
@@ -246,6 +381,16 @@ func (n *storeNode) Create(logger lager.Logger, traceID string) error {
 		n.bindMounts = append(n.bindMounts, credMounts...)
 		info.Env = append(info.Env, envs...)
 
+		n.bindMounts = append(n.bindMounts, n.clockBindMounts(info.Clock)...)
+
+		if info.ReadOnlyRootfs {
+			n.bindMounts = append(n.bindMounts, scratchBindMount)
+		}
+		info.Env = append(info.Env, info.Clock.Env()...)
+		if info.Clock != nil && info.Clock.OffsetSeconds != 0 {
+			info.Env = append(info.Env, executor.EnvironmentVariable{Name: "LD_PRELOAD", Value: fakeTimeLibraryPath})
+		}
+
 		if n.useDeclarativeHealthCheck {
 			logger.Info("adding-healthcheck-bindmounts")
 			n.bindMounts = append(n.bindMounts, garden.BindMount{
@@ -255,12 +400,42 @@ func (n *storeNode) Create(logger lager.Logger, traceID string) error {
 			})
 		}
 
+		// credentials resolved from CredHub are never stored in the info of
+		// the container, which is checkpointed to disk
+		username, password := info.ImageUsername, info.ImagePassword
+		if info.ImageCredentialsRef != "" {
+			username, password, err = n.imageCredentials.Resolve(logger, info.MetricsConfig.Guid, info.ImageCredentialsRef)
+			if err != nil {
+				n.complete(logger, traceID, true, fmt.Sprintf("%s: %s", ImageCredentialsFailed, err.Error()), true)
+				return err
+			}
+		}
+
+		if n.images != nil && isRegistryImage(info.RootFSPath) {
+			streamer := n.logManager.NewLogStreamer(info.LogConfig, n.metronClient, n.config.MaxLogLinesPerSecond, info.LogRateLimitBytesPerSecond, n.config.MetricReportInterval)
+			n.pulledImage, err = n.images.Pull(logger, info.RootFSPath, username, password, streamer)
+			streamer.Stop()
+			if err != nil {
+				n.imageCredentials.Forget(info.MetricsConfig.Guid, info.ImageCredentialsRef)
+				n.complete(logger, traceID, true, fmt.Sprintf("%s: %s", ImagePullFailed, err.Error()), true)
+				return err
+			}
+		}
+
 		sourceName, tags := n.info.LogConfig.GetSourceNameAndTagsForLogging()
 		n.metronClient.SendAppLog(fmt.Sprintf("Cell %s creating container for instance %s", n.cellID, n.Info().Guid), sourceName, tags)
-		gardenContainer, err := n.createGardenContainer(logger, traceID, &info)
+		gardenContainer, err := n.createGardenContainer(logger, traceID, &info, n.imageRef(&info, username, password))
+		if n.pulledImage != "" {
+			n.images.Release(logger, n.pulledImage)
+		}
 		if err != nil {
+			n.imageCredentials.Forget(info.MetricsConfig.Guid, info.ImageCredentialsRef)
 			n.metronClient.SendAppErrorLog(fmt.Sprintf("Cell %s failed to create container for instance %s: %s", n.cellID, n.Info().Guid, err.Error()), sourceName, tags)
-			n.complete(logger, traceID, true, fmt.Sprintf("%s: %s", ContainerCreationFailedMessage, err.Error()), true)
+			failureReason := fmt.Sprintf("%s: %s", ContainerCreationFailedMessage, err.Error())
+			if limit, ok := gardenLimitFor(err); ok {
+				failureReason = fmt.Sprintf("%s: %s (%s): %s", ContainerCreationFailedMessage, GardenLimitExhaustedMessage, limit, err.Error())
+			}
+			n.complete(logger, traceID, true, failureReason, true)
 			return err
 		}
 		n.metronClient.SendAppLog(fmt.Sprintf("Cell %s successfully created container for instance %s", n.cellID, n.Info().Guid), sourceName, tags)
@@ -312,6 +487,18 @@ func (n *storeNode) gardenProperties(container *executor.Container) (garden.Prop
 		}
 	}
 	properties[executor.ContainerOwnerProperty] = n.config.OwnerName
+	if container.HostProcess {
+		properties[executor.ContainerHostProcessProperty] = "true"
+	}
+	if container.IPFamily != "" {
+		properties[executor.ContainerIPFamilyProperty] = string(container.IPFamily)
+	}
+	if ip, ok := n.ipRetention.Lookup(container.Guid); ok {
+		properties[executor.ContainerRequestedIPProperty] = ip
+	}
+	if container.ReadOnlyRootfs {
+		properties[executor.ContainerReadOnlyRootfsProperty] = "true"
+	}
 	logConfig, err := n.jsonMarshaller(container.LogConfig)
 	if err != nil {
 		return nil, err
@@ -321,6 +508,63 @@ func (n *storeNode) gardenProperties(container *executor.Container) (garden.Prop
 	return properties, nil
 }
 
+// containerIPv6 returns the IPv6 address of the container, which is its only
+// address on IPv6 cells and reported in a property on dual-stack cells.
+func containerIPv6(info garden.ContainerInfo) string {
+	if ip := net.ParseIP(info.ContainerIP); ip != nil && ip.To4() == nil {
+		return info.ContainerIP
+	}
+	return info.Properties[executor.ContainerIPv6Property]
+}
+
+// deviceBindMounts exposes the devices allocated to the container at the same
+// path inside the container. The device cgroup of the container is opened to
+// them by the CgroupLimiter once the container is created.
+func deviceBindMounts(devices []string) []garden.BindMount {
+	mounts := make([]garden.BindMount, 0, len(devices))
+	for _, device := range devices {
+		mounts = append(mounts, garden.BindMount{
+			SrcPath: device,
+			DstPath: device,
+			Mode:    garden.BindMountModeRW,
+			Origin:  garden.BindMountOriginHost,
+		})
+	}
+	return mounts
+}
+
+// fakeTimeLibraryPath is where the libfaketime of the cell is mounted in the
+// containers that offset their clock.
+const fakeTimeLibraryPath = "/usr/lib/faketime/libfaketime.so.1"
+
+// clockBindMounts exposes the zone of the container clock from the time zone
+// database of the cell as /etc/localtime, for processes that ignore TZ, and
+// the libfaketime of the cell to containers that offset their clock.
+func (n *storeNode) clockBindMounts(containerClock *executor.ContainerClock) []garden.BindMount {
+	if containerClock == nil {
+		return nil
+	}
+
+	var mounts []garden.BindMount
+	if containerClock.Timezone != "" && n.config.ZoneInfoDir != "" {
+		mounts = append(mounts, garden.BindMount{
+			SrcPath: filepath.Join(n.config.ZoneInfoDir, containerClock.Timezone),
+			DstPath: "/etc/localtime",
+			Mode:    garden.BindMountModeRO,
+			Origin:  garden.BindMountOriginHost,
+		})
+	}
+	if containerClock.OffsetSeconds != 0 && n.config.FakeTimeLibraryPath != "" {
+		mounts = append(mounts, garden.BindMount{
+			SrcPath: n.config.FakeTimeLibraryPath,
+			DstPath: fakeTimeLibraryPath,
+			Mode:    garden.BindMountModeRO,
+			Origin:  garden.BindMountOriginHost,
+		})
+	}
+	return mounts
+}
+
 func dedupPorts(ports []executor.PortMapping) []executor.PortMapping {
 	seen := make(map[uint16]bool, len(ports))
 	deduped := make([]executor.PortMapping, 0, len(ports))
@@ -334,7 +578,7 @@ func dedupPorts(ports []executor.PortMapping) []executor.PortMapping {
 	return deduped
 }
 
-func (n *storeNode) createGardenContainer(logger lager.Logger, traceID string, info *executor.Container) (garden.Container, error) {
+func (n *storeNode) createGardenContainer(logger lager.Logger, traceID string, info *executor.Container, imageRef garden.ImageRef) (garden.Container, error) {
 	netOutRules, err := convertEgressToNetOut(logger, info.EgressRules)
 	if err != nil {
 		return nil, err
@@ -342,6 +586,10 @@ func (n *storeNode) createGardenContainer(logger lager.Logger, traceID string, i
 
 	info.Ports = dedupPorts(info.Ports)
 
+	if info.IPFamily == "" {
+		info.IPFamily = n.config.DefaultIPFamily
+	}
+
 	proxyPortMapping, extraPorts, err := n.proxyConfigHandler.ProxyPorts(logger, info)
 	if err != nil {
 		return nil, err
@@ -385,14 +633,10 @@ func (n *storeNode) createGardenContainer(logger lager.Logger, traceID string, i
 
 	containerSpec := garden.ContainerSpec{
 		Handle:     info.Guid,
-		Privileged: info.Privileged,
-		Image: garden.ImageRef{
-			URI:      info.RootFSPath,
-			Username: info.ImageUsername,
-			Password: info.ImagePassword,
-		},
+		Privileged: info.Privileged || info.HostProcess,
+		Image:      imageRef,
 		Env:        convertEnvVars(info.Env),
-		BindMounts: n.bindMounts,
+		BindMounts: append(deviceBindMounts(info.Devices), n.bindMounts...),
 		Limits: garden.Limits{
 			Memory: garden.MemoryLimits{
 				LimitInBytes: uint64(info.MemoryMB * 1024 * 1024),
@@ -418,11 +662,25 @@ func (n *storeNode) createGardenContainer(logger lager.Logger, traceID string, i
 		containerSpec.Limits.CPU.Weight = uint64(info.MemoryMB)
 	}
 
-	gardenContainer, err := createContainer(logger, containerSpec, n.gardenClientFactory.NewGardenClient(logger, traceID), n.metronClient)
+	if rate, burst, ok := info.Bandwidth.Egress(); ok {
+		containerSpec.Limits.Bandwidth = garden.BandwidthLimits{
+			RateInBytesPerSecond:      rate,
+			BurstRateInBytesPerSecond: burst,
+		}
+	}
+
+	gardenContainer, createDuration, err := createContainer(logger, containerSpec, n.gardenClientFactory.NewGardenClient(logger, traceID), n.metronClient)
 	if err != nil {
 		return nil, err
 	}
 
+	if isRegistryImage(info.RootFSPath) {
+		info.SetupMetrics.ImageFetchDurationInNanoseconds = uint64(createDuration)
+		if err := n.metronClient.SendDuration(ImageFetchDuration, createDuration); err != nil {
+			logger.Error("failed-to-send-duration", err, lager.Data{"metric-name": ImageFetchDuration})
+		}
+	}
+
 	containerInfo, err := gardenContainer.Info()
 	if err != nil {
 		if err := n.destroyContainer(logger, traceID); err != nil {
@@ -434,14 +692,85 @@ func (n *storeNode) createGardenContainer(logger lager.Logger, traceID string, i
 	info.Ports = n.portMappingFromContainerInfo(containerInfo, info.Ports, proxyPortMapping)
 	info.ExternalIP = containerInfo.ExternalIP
 	info.InternalIP = containerInfo.ContainerIP
+	info.InternalIPv6 = containerIPv6(containerInfo)
 	info.AdvertisePreferenceForInstanceAddress = n.advertisePreferenceForInstanceAddress
 
 	info.MemoryLimit = containerSpec.Limits.Memory.LimitInBytes
 	info.DiskLimit = containerSpec.Limits.Disk.ByteHard
 
+	if info.ReadOnlyRootfs {
+		if err := verifyReadOnlyRootfs(logger, gardenContainer); err != nil {
+			if err := n.destroyContainer(logger, traceID); err != nil {
+				logger.Error("failed-to-destroy-container", err)
+			}
+			return nil, err
+		}
+	}
+
+	if err := n.limitCgroups(logger, info); err != nil {
+		logger.Error("failed-to-limit-cgroups", err)
+		if err := n.destroyContainer(logger, traceID); err != nil {
+			logger.Error("failed-to-destroy-container", err)
+		}
+		return nil, err
+	}
+
+	if rate, burst, ok := info.Bandwidth.Ingress(); ok {
+		var err error = executor.ErrIngressBandwidthNotSupported
+		if n.config.BandwidthLimiter != nil {
+			err = n.config.BandwidthLimiter.Limit(logger, info.Guid, info.InternalIP, rate, burst)
+		}
+		if err != nil {
+			logger.Error("failed-to-limit-ingress-bandwidth", err)
+			if err := n.destroyContainer(logger, traceID); err != nil {
+				logger.Error("failed-to-destroy-container", err)
+			}
+			return nil, err
+		}
+	}
+
 	return gardenContainer, nil
 }
 
+// limitCgroups pins the container to its exclusive cores, gives it access to
+// its devices, limits its swap and sets its sysctls, which garden has no spec
+// for. None of them are allowed on cells without a CgroupLimiter.
+func (n *storeNode) limitCgroups(logger lager.Logger, info *executor.Container) error {
+	swapLimit, limitSwap := info.Swap.Enforced()
+	if len(info.CPUSet) == 0 && len(info.Devices) == 0 && len(info.Sysctls) == 0 && !limitSwap {
+		return nil
+	}
+	if n.config.CgroupLimiter == nil {
+		return executor.ErrInsufficientResourcesAvailable
+	}
+
+	if len(info.CPUSet) > 0 {
+		err := n.config.CgroupLimiter.SetCPUSet(logger, info.Guid, info.CPUSet)
+		if err != nil {
+			return err
+		}
+	}
+	if len(info.Devices) > 0 {
+		err := n.config.CgroupLimiter.AllowDevices(logger, info.Guid, info.Devices)
+		if err != nil {
+			return err
+		}
+	}
+	if limitSwap {
+		err := n.config.CgroupLimiter.SetSwapLimit(logger, info.Guid, info.MemoryLimit, swapLimit)
+		if err != nil {
+			return err
+		}
+	}
+	if len(info.Sysctls) > 0 {
+		err := n.config.CgroupLimiter.SetSysctls(logger, info.Guid, info.Sysctls)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (n *storeNode) portMappingFromContainerInfo(
 	containerInfo garden.ContainerInfo,
 	appPorts []executor.PortMapping,
@@ -501,7 +830,7 @@ func (n *storeNode) portMappingFromContainerInfo(
 	return ports
 }
 
-func (n *storeNode) Run(logger lager.Logger, traceID string) error {
+func (n *storeNode) Run(logger lager.Logger, traceID string, dependencies ifrit.Runner) error {
 	logger = logger.Session("node-run")
 
 	n.acquireOpLock(logger)
@@ -516,27 +845,152 @@ func (n *storeNode) Run(logger lager.Logger, traceID string) error {
 
 	credManagerRunner := n.credManager.Runner(logger, n, n.regenerateCertsCh)
 
+	cfg := n.stepsConfig(logger, traceID)
+	policy := n.info.RestartPolicy
+	if policy != nil && policy.MaxRestarts > 0 {
+		cfg.ActionMarker = steps.NewActionMarker()
+	}
+	runner, err := n.transformer.StepsRunner(logger, n.info, n.gardenContainer, n.logStreamer, cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.ActionMarker != nil {
+		runner = n.restartingRunner(logger, traceID, runner, cfg, *policy)
+	}
+
+	n.start(logger, traceID, grouper.Members{
+		{Name: "cred-manager-runner", Runner: credManagerRunner},
+		{Name: "dependency-waiter", Runner: dependencies},
+		{Name: "runner", Runner: runner},
+	})
+	return nil
+}
+
+// stepsConfig configures the steps of the container.
+func (n *storeNode) stepsConfig(logger lager.Logger, traceID string) transformer.Config {
 	proxyTLSPorts := make([]uint16, len(n.info.Ports))
 	for i, p := range n.info.Ports {
 		proxyTLSPorts[i] = p.ContainerTLSProxyPort
 	}
-	cfg := transformer.Config{
+	n.infoLock.Lock()
+	n.timeline = steps.NewTimeline(n.clock)
+	n.infoLock.Unlock()
+
+	return transformer.Config{
 		BindMounts:        n.bindMounts,
 		ProxyTLSPorts:     proxyTLSPorts,
 		CreationStartTime: n.startTime,
 		MetronClient:      n.metronClient,
+		HealthTransitions: func(checkType executor.HealthCheckType, healthy bool, duration time.Duration, failureOutput string) {
+			if checkType == executor.HealthCheckReadiness {
+				n.setRoutable(logger, traceID, healthy)
+			}
+			go n.eventEmitter.Emit(executor.NewContainerHealthTransitionEvent(n.Info(), checkType, healthy, duration, failureOutput, traceID))
+		},
+		LivenessWarnings: func(failures int, failureOutput string) {
+			go n.eventEmitter.Emit(executor.NewContainerLivenessWarningEvent(n.Info(), failures, failureOutput, traceID))
+		},
+		Timeline: n.timeline,
 	}
-	runner, err := n.transformer.StepsRunner(logger, n.info, n.gardenContainer, n.logStreamer, cfg)
+}
+
+// start runs the members of the container in order, and completes the
+// container once they exit. The container must become healthy within its
+// start timeout.
+func (n *storeNode) start(logger lager.Logger, traceID string, members grouper.Members) {
+	startTimeout := n.transformer.StartTimeout(n.info)
+	if startTimeout > 0 {
+		n.infoLock.Lock()
+		n.startDeadline = n.clock.Now().Add(startTimeout)
+		n.infoLock.Unlock()
+	}
+
+	n.process = ifrit.Background(grouper.NewQueueOrdered(os.Interrupt, members))
+	go n.run(logger, n.logStreamer, traceID, startTimeout)
+}
+
+// setStartDeadline moves the start deadline of the container, while it waits
+// for its dependencies.
+func (n *storeNode) setStartDeadline(deadline time.Time) {
+	n.infoLock.Lock()
+	n.startDeadline = deadline
+	n.infoLock.Unlock()
+}
+
+// Recover adopts the garden container of a node restored from a checkpoint,
+// which is nil if garden no longer has it. The steps of running containers
+// are rebuilt without their setup and attach to the processes that are still
+// running, with fresh credentials. Reserved and completed containers are left
+// as they were, and the others are completed as failed.
+func (n *storeNode) Recover(logger lager.Logger, traceID string, gc garden.Container) {
+	logger = logger.Session("node-recover")
+
+	n.acquireOpLock(logger)
+	defer n.releaseOpLock(logger)
+
+	n.infoLock.Lock()
+	n.gardenContainer = gc
+	state := n.info.State
+	n.infoLock.Unlock()
+
+	var reason string
+	switch state {
+	case executor.StateReserved, executor.StateInitializing, executor.StateCompleted:
+		return
+	case executor.StateRunning:
+		if gc == nil {
+			reason = ContainerMissingMessage
+			break
+		}
+		err := n.reattach(logger, traceID, gc)
+		if err == nil {
+			return
+		}
+		logger.Error("failed-to-reattach", err)
+		reason = ContainerRecoveryFailedMessage
+	default:
+		reason = ContainerRecoveryFailedMessage
+	}
+
+	n.complete(logger, traceID, true, reason, false)
+}
+
+func (n *storeNode) reattach(logger lager.Logger, traceID string, gc garden.Container) error {
+	info, err := gc.Info()
 	if err != nil {
 		return err
 	}
+	if len(info.ProcessIDs) == 0 {
+		return ErrNoProcessesToReattach
+	}
 
-	group := grouper.NewQueueOrdered(os.Interrupt, grouper.Members{
-		{Name: "cred-manager-runner", Runner: credManagerRunner},
+	n.infoLock.Lock()
+	n.info.State = executor.StateRunning
+	n.startTime = n.clock.Now()
+	n.infoLock.Unlock()
+
+	n.logStreamer = n.logManager.NewLogStreamer(n.info.LogConfig, n.metronClient, n.config.MaxLogLinesPerSecond, n.info.LogRateLimitBytesPerSecond, n.config.MetricReportInterval)
+
+	cfg := n.stepsConfig(logger, traceID)
+	cfg.Reattach = true
+	cfg.RunningProcesses = info.ProcessIDs
+	policy := n.info.RestartPolicy
+	if policy != nil && policy.MaxRestarts > 0 {
+		cfg.ActionMarker = steps.NewActionMarker()
+	}
+	runner, err := n.transformer.StepsRunner(logger, n.info, gc, n.logStreamer, cfg)
+	if err != nil {
+		n.logStreamer.Stop()
+		return err
+	}
+	if cfg.ActionMarker != nil {
+		runner = n.restartingRunner(logger, traceID, runner, cfg, *policy)
+	}
+
+	n.start(logger, traceID, grouper.Members{
+		{Name: "cred-manager-runner", Runner: n.credManager.Runner(logger, n, n.regenerateCertsCh)},
 		{Name: "runner", Runner: runner},
 	})
-	n.process = ifrit.Background(group)
-	go n.run(logger, n.logStreamer, traceID)
 	return nil
 }
 
@@ -574,17 +1028,35 @@ func (n *storeNode) completeWithError(logger lager.Logger, traceID string, err e
 	n.complete(logger, traceID, false, "", false)
 }
 
-func (n *storeNode) run(logger lager.Logger, logStreamer log_streamer.LogStreamer, traceID string) {
+func (n *storeNode) run(logger lager.Logger, logStreamer log_streamer.LogStreamer, traceID string, startTimeout time.Duration) {
 	defer logStreamer.Stop()
 	// wait for container runner to start
 	logger.Debug("execute-process")
 	defer n.metronClient.IncrementCounter(ContainerCompletedCount)
-	select {
-	case err := <-n.process.Wait():
-		n.completeWithError(logger, traceID, err)
-		return
-	case <-n.process.Ready():
-		// fallthrough, healthcheck passed
+
+	var startTimeoutWarning <-chan time.Time
+	threshold := n.config.StartTimeoutWarningThreshold
+	if threshold > 0 && startTimeout > threshold {
+		timer := n.clock.NewTimer(startTimeout - threshold)
+		defer timer.Stop()
+		startTimeoutWarning = timer.C()
+	}
+
+	for healthy := false; !healthy; {
+		select {
+		case err := <-n.process.Wait():
+			n.captureResultArtifacts(logger)
+			n.captureCoreDumps(logger, err)
+			n.completeWithError(logger, traceID, err)
+			return
+		case <-startTimeoutWarning:
+			logger.Info("start-timeout-warning", lager.Data{"remaining": threshold.String()})
+			go n.eventEmitter.Emit(executor.NewContainerStartTimeoutWarningEvent(n.Info(), threshold, traceID))
+			startTimeoutWarning = nil
+		case <-n.process.Ready():
+			// healthcheck passed
+			healthy = true
+		}
 	}
 	logger.Debug("healthcheck-passed")
 
@@ -595,15 +1067,139 @@ func (n *storeNode) run(logger lager.Logger, logStreamer log_streamer.LogStreame
 	go n.eventEmitter.Emit(executor.NewContainerRunningEvent(info, traceID))
 
 	err := <-n.process.Wait()
+	n.captureResultArtifacts(logger)
+	n.captureCoreDumps(logger, err)
 	n.completeWithError(logger, traceID, err)
 }
 
+// restartingRunner restarts the steps of the container in place when they
+// fail, according to its restart policy.
+func (n *storeNode) restartingRunner(logger lager.Logger, traceID string, runner ifrit.Runner, cfg transformer.Config, policy executor.RestartPolicy) ifrit.Runner {
+	initialBackoff := time.Duration(policy.InitialBackoffMs) * time.Millisecond
+	if initialBackoff <= 0 {
+		initialBackoff = defaultRestartInitialBackoff
+	}
+	maxBackoff := time.Duration(policy.MaxBackoffMs) * time.Millisecond
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRestartMaxBackoff
+	}
+	if maxBackoff < initialBackoff {
+		maxBackoff = initialBackoff
+	}
+
+	cfg.Restarted = true
+	cfg.Reattach = false
+	cfg.RunningProcesses = nil
+	return steps.NewRestart(
+		runner,
+		func() (ifrit.Runner, error) {
+			return n.transformer.StepsRunner(logger, n.Info(), n.gardenContainer, n.logStreamer, cfg)
+		},
+		cfg.ActionMarker,
+		policy.MaxRestarts,
+		initialBackoff,
+		maxBackoff,
+		func(restarts int, err error) {
+			n.restarted(logger, traceID, restarts, err)
+		},
+		func() {
+			n.setRoutable(logger, traceID, true)
+		},
+		n.clock,
+		n.logStreamer,
+		logger,
+	)
+}
+
+// restarted takes the container out of routing until its restarted action
+// is ready again, and records the restart.
+func (n *storeNode) restarted(logger lager.Logger, traceID string, restarts int, err error) {
+	n.setRoutable(logger, traceID, false)
+
+	n.infoLock.Lock()
+	n.info.Restarts = restarts
+	info := n.info.Copy()
+	n.infoLock.Unlock()
+
+	sourceName, tags := info.LogConfig.GetSourceNameAndTagsForLogging()
+	n.metronClient.SendAppLog(fmt.Sprintf("Cell %s restarting instance %s in place: %s", n.cellID, info.Guid, err.Error()), sourceName, tags)
+	go n.eventEmitter.Emit(executor.NewContainerRestartedEvent(info, restarts, err.Error(), traceID))
+}
+
+// setRoutable takes a running container out of routing, or puts it back,
+// when its readiness changes.
+func (n *storeNode) setRoutable(logger lager.Logger, traceID string, routable bool) {
+	n.infoLock.Lock()
+	defer n.infoLock.Unlock()
+
+	if n.info.State != executor.StateRunning || n.info.Unroutable == !routable {
+		return
+	}
+
+	logger.Info("routability-changed", lager.Data{"routable": routable})
+	n.info.Unroutable = !routable
+	go n.eventEmitter.Emit(executor.NewContainerRoutabilityEvent(n.info.Copy(), traceID))
+}
+
+func (n *storeNode) captureResultArtifacts(logger lager.Logger) {
+	n.infoLock.Lock()
+	gc := n.gardenContainer
+	globs := n.info.ResultFiles
+	n.infoLock.Unlock()
+
+	if gc == nil || len(globs) == 0 {
+		return
+	}
+
+	maxBytes := n.config.MaxResultArtifactBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResultArtifactBytes
+	}
+	artifacts := captureResultArtifacts(logger, gc, globs, maxBytes)
+
+	n.infoLock.Lock()
+	n.info.RunResult.Artifacts = artifacts
+	n.infoLock.Unlock()
+}
+
+// captureCoreDumps copies the core files left behind by a failed run out of
+// the container before it gets destroyed.
+func (n *storeNode) captureCoreDumps(logger lager.Logger, err error) {
+	if err == nil || n.coreDumps == nil {
+		return
+	}
+
+	n.infoLock.Lock()
+	gc := n.gardenContainer
+	guid := n.info.Guid
+	n.infoLock.Unlock()
+
+	if gc == nil {
+		return
+	}
+
+	names := n.coreDumps.Collect(logger, guid, gc)
+
+	n.infoLock.Lock()
+	n.info.RunResult.CoreDumps = names
+	n.infoLock.Unlock()
+}
+
 func (n *storeNode) Update(logger lager.Logger, req *executor.UpdateRequest) error {
 	logger = logger.Session("node-update")
 
 	n.acquireOpLock(logger)
 	defer n.releaseOpLock(logger)
 
+	var netOutRules []garden.NetOutRule
+	if len(req.EgressRules) > 0 {
+		var err error
+		netOutRules, err = convertEgressToNetOut(logger, req.EgressRules)
+		if err != nil {
+			return err
+		}
+	}
+
 	n.infoLock.Lock()
 
 	if req.InternalRoutes != nil {
@@ -624,8 +1220,26 @@ func (n *storeNode) Update(logger lager.Logger, req *executor.UpdateRequest) err
 		}
 	}
 
+	gardenContainer := n.gardenContainer
+	if len(netOutRules) > 0 && gardenContainer == nil {
+		// the rules are applied when the garden container is created
+		n.info.EgressRules = append(n.info.EgressRules, req.EgressRules...)
+	}
+
 	n.infoLock.Unlock()
 
+	if len(netOutRules) > 0 && gardenContainer != nil {
+		err := gardenContainer.BulkNetOut(netOutRules)
+		if err != nil {
+			logger.Error("failed-to-apply-egress-rules", err, lager.Data{"guid": req.Guid})
+			return err
+		}
+
+		n.infoLock.Lock()
+		n.info.EgressRules = append(n.info.EgressRules, req.EgressRules...)
+		n.infoLock.Unlock()
+	}
+
 	if req.InternalRoutes != nil {
 		n.regenerateCertsCh <- struct{}{}
 	}
@@ -642,6 +1256,141 @@ func (n *storeNode) Update(logger lager.Logger, req *executor.UpdateRequest) err
 	return nil
 }
 
+// mirroredProperties returns the garden properties that mirror the executor
+// fields of the container.
+func (n *storeNode) mirroredProperties(info executor.Container) (garden.Properties, error) {
+	properties := garden.Properties{
+		executor.ContainerExecutorStateProperty: string(info.State),
+		executor.ContainerRoutableProperty:      strconv.FormatBool(!info.Unroutable),
+	}
+	for name, value := range map[string]interface{}{
+		executor.ContainerTagsProperty:           info.Tags,
+		executor.ContainerPortsProperty:          info.Ports,
+		executor.ContainerInternalRoutesProperty: info.InternalRoutes,
+	} {
+		encoded, err := n.jsonMarshaller(value)
+		if err != nil {
+			return nil, err
+		}
+		properties[name] = string(encoded)
+	}
+	return properties, nil
+}
+
+// syncProperties sets the mirrored properties of the container that differ
+// from its executor fields.
+func (n *storeNode) syncProperties(logger lager.Logger) {
+	n.infoLock.Lock()
+	info := n.info.Copy()
+	gardenContainer := n.gardenContainer
+	n.infoLock.Unlock()
+
+	if gardenContainer == nil {
+		return
+	}
+
+	logger = logger.Session("sync-properties", lager.Data{"guid": info.Guid})
+
+	desired, err := n.mirroredProperties(info)
+	if err != nil {
+		logger.Error("failed-to-encode-properties", err)
+		return
+	}
+
+	actual, err := gardenContainer.Properties()
+	if err != nil {
+		logger.Error("failed-to-get-properties", err)
+		return
+	}
+
+	for name, value := range desired {
+		if current, ok := actual[name]; ok && current == value {
+			continue
+		}
+		err := gardenContainer.SetProperty(name, value)
+		if err != nil {
+			logger.Error("failed-to-set-property", err, lager.Data{"property": name})
+			continue
+		}
+		logger.Debug("set-property", lager.Data{"property": name})
+	}
+}
+
+// refreshHostnameEgress resolves the hostname egress rules of the container
+// and allows the addresses that are not allowed yet. Addresses that fail to
+// be applied are retried on the next refresh.
+func (n *storeNode) refreshHostnameEgress(logger lager.Logger, lookupIP func(string) ([]net.IP, error)) {
+	n.infoLock.Lock()
+	guid := n.info.Guid
+	rules := n.info.HostnameEgressRules
+	state := n.info.State
+	gardenContainer := n.gardenContainer
+	n.infoLock.Unlock()
+
+	if len(rules) == 0 || gardenContainer == nil {
+		return
+	}
+	if state != executor.StateCreated && state != executor.StateRunning {
+		return
+	}
+
+	logger = logger.Session("refresh-hostname-egress", lager.Data{"guid": guid})
+
+	n.egressLock.Lock()
+	defer n.egressLock.Unlock()
+
+	var netOutRules []garden.NetOutRule
+	var allowed []string
+	for i, rule := range rules {
+		ips, err := lookupIP(rule.Hostname)
+		if err != nil {
+			logger.Error("failed-to-resolve", err, lager.Data{"hostname": rule.Hostname})
+			continue
+		}
+
+		var destinations, keys []string
+		for _, ip := range ips {
+			key := fmt.Sprintf("%d/%s", i, ip)
+			if _, ok := n.allowedEgressIPs[key]; ok {
+				continue
+			}
+			destinations = append(destinations, ip.String())
+			keys = append(keys, key)
+		}
+		if len(destinations) == 0 {
+			continue
+		}
+
+		ruleNetOut, err := convertEgressToNetOut(logger, []*models.SecurityGroupRule{{
+			Protocol:     rule.Protocol,
+			Destinations: destinations,
+			Ports:        rule.Ports,
+			PortRange:    rule.PortRange,
+			Log:          rule.Log,
+		}})
+		if err != nil {
+			continue
+		}
+		netOutRules = append(netOutRules, ruleNetOut...)
+		allowed = append(allowed, keys...)
+	}
+
+	if len(netOutRules) == 0 {
+		return
+	}
+
+	err := gardenContainer.BulkNetOut(netOutRules)
+	if err != nil {
+		logger.Error("failed-to-apply-egress-rules", err)
+		return
+	}
+
+	for _, key := range allowed {
+		n.allowedEgressIPs[key] = struct{}{}
+	}
+	logger.Info("allowed-resolved-addresses", lager.Data{"count": len(allowed)})
+}
+
 func (n *storeNode) Stop(logger lager.Logger, traceID string) {
 	if !atomic.CompareAndSwapInt32(&n.stopping, 0, 1) {
 		return
@@ -709,6 +1458,13 @@ func (n *storeNode) Destroy(logger lager.Logger, traceID string) error {
 	}
 	n.metronClient.SendAppLog(fmt.Sprintf("Cell %s successfully destroyed container for instance %s", n.cellID, info.Guid), sourceName, tags)
 
+	if _, _, ok := info.Bandwidth.Ingress(); ok && n.config.BandwidthLimiter != nil {
+		err = n.config.BandwidthLimiter.Clear(logger, info.Guid)
+		if err != nil {
+			logger.Error("failed-to-clear-ingress-bandwidth", err)
+		}
+	}
+
 	cacheKeys := n.bindMountCacheKeys
 
 	var bindMountCleanupErr error
@@ -795,6 +1551,7 @@ func (n *storeNode) complete(logger lager.Logger, traceID string, failed bool, f
 	n.infoLock.Lock()
 	defer n.infoLock.Unlock()
 	n.info.TransitionToComplete(failed, failureReason, retryable)
+	n.info.RunResult.Timeline = n.timeline.Steps()
 	go n.eventEmitter.Emit(executor.NewContainerCompleteEvent(n.info, traceID))
 }
 
@@ -805,6 +1562,53 @@ func (n *storeNode) removeCredsDir(logger lager.Logger, info executor.Container)
 	}
 }
 
+// imageRef is the image of the garden container: the image pulled by the
+// image manager if any, or else the rootfs of the container with the
+// credentials of its registry.
+func (n *storeNode) imageRef(info *executor.Container, username, password string) garden.ImageRef {
+	if n.pulledImage != "" {
+		return garden.ImageRef{URI: n.pulledImage}
+	}
+	return garden.ImageRef{
+		URI:      info.RootFSPath,
+		Username: username,
+		Password: password,
+	}
+}
+
+// scratchBindMount keeps the /tmp of a container with a read-only rootfs
+// writable. It is bound from the /tmp of the rootfs itself, so that what is
+// written to it is counted against the disk quota of the container.
+var scratchBindMount = garden.BindMount{
+	SrcPath: "/tmp",
+	DstPath: "/tmp",
+	Mode:    garden.BindMountModeRW,
+	Origin:  garden.BindMountOriginContainer,
+}
+
+// verifyReadOnlyRootfs checks that the runtime honoured the
+// executor:read-only-rootfs property of the container, by streaming a file
+// into its root as root, which must fail.
+func verifyReadOnlyRootfs(logger lager.Logger, container garden.Container) error {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	err := tw.WriteHeader(&tar.Header{Name: ".executor-read-only-rootfs", Mode: 0644, Typeflag: tar.TypeReg})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = container.StreamIn(garden.StreamInSpec{Path: "/", User: "root", TarStream: buf})
+	if err == nil {
+		logger.Error("rootfs-is-writable", executor.ErrReadOnlyRootfsNotEnforced)
+		return executor.ErrReadOnlyRootfsNotEnforced
+	}
+	logger.Debug("rootfs-is-read-only", lager.Data{"stream-in-error": err.Error()})
+	return nil
+}
+
 func (n *storeNode) umountVolumeMounts(logger lager.Logger, info executor.Container) {
 	for _, volume := range info.VolumeMounts {
 		err := n.volumeManager.Unmount(logger, volume.Driver, volume.VolumeId, info.Guid)
@@ -814,7 +1618,7 @@ func (n *storeNode) umountVolumeMounts(logger lager.Logger, info executor.Contai
 	}
 }
 
-func createContainer(logger lager.Logger, spec garden.ContainerSpec, client garden.Client, metronClient loggingclient.IngressClient) (garden.Container, error) {
+func createContainer(logger lager.Logger, spec garden.ContainerSpec, client garden.Client, metronClient loggingclient.IngressClient) (garden.Container, time.Duration, error) {
 	logger.Info("creating-container-in-garden")
 	startTime := time.Now()
 	container, err := client.Create(spec)
@@ -827,11 +1631,21 @@ func createContainer(logger lager.Logger, spec garden.ContainerSpec, client gard
 		if err := metronClient.SendDuration(GardenContainerCreationFailedDuration, createDuration); err != nil {
 			logger.Error("failed-to-send-duration", err, lager.Data{"metric-name": GardenContainerCreationFailedDuration})
 		}
-		return nil, err
+		return nil, createDuration, err
 	}
 	logger.Info("created-container-in-garden", lager.Data{"create-took": createDuration.String()})
 	if err := metronClient.SendDuration(GardenContainerCreationSucceededDuration, createDuration); err != nil {
 		logger.Error("failed-to-send-duration", err, lager.Data{"metric-name": GardenContainerCreationSucceededDuration})
 	}
-	return container, nil
+	return container, createDuration, nil
+}
+
+// isRegistryImage tells whether garden has to pull the rootfs from an image
+// registry to create the container, as opposed to preloaded rootfses.
+func isRegistryImage(rootFSPath string) bool {
+	rootFSURL, err := url.Parse(rootFSPath)
+	if err != nil {
+		return false
+	}
+	return rootFSURL.Scheme == "docker"
 }
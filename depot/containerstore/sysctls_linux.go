@@ -0,0 +1,93 @@
+package containerstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SysctlNamespace is the namespace that isolates the sysctl, or false if the
+// sysctl is not namespaced and so cannot be set for a single container.
+func SysctlNamespace(name string) (string, bool) {
+	switch {
+	case strings.HasPrefix(name, "net."):
+		return "net", true
+	case strings.HasPrefix(name, "kernel.shm"), strings.HasPrefix(name, "kernel.msg"),
+		name == "kernel.sem", strings.HasPrefix(name, "fs.mqueue."):
+		return "ipc", true
+	}
+	return "", false
+}
+
+// setSysctls writes the sysctls in the namespaces of the process with the
+// given pid.
+func setSysctls(pid int, sysctls map[string]string) error {
+	byNamespace := map[string]map[string]string{}
+	for name, value := range sysctls {
+		namespace, ok := SysctlNamespace(name)
+		if !ok {
+			return fmt.Errorf("sysctl %s is not namespaced", name)
+		}
+		if byNamespace[namespace] == nil {
+			byNamespace[namespace] = map[string]string{}
+		}
+		byNamespace[namespace][name] = value
+	}
+
+	for namespace, sysctls := range byNamespace {
+		errs := make(chan error, 1)
+		go func(namespace string, sysctls map[string]string) {
+			errs <- setSysctlsIn(pid, namespace, sysctls)
+		}(namespace, sysctls)
+		err := <-errs
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSysctlsIn enters the namespace of the process on the thread of the
+// calling goroutine. The thread is left locked, and so terminated with the
+// goroutine, if it cannot return to its own namespace.
+func setSysctlsIn(pid int, namespace string, sysctls map[string]string) error {
+	runtime.LockOSThread()
+
+	own, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/%s", unix.Gettid(), namespace))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer own.Close()
+
+	target, err := os.Open(fmt.Sprintf("/proc/%d/ns/%s", pid, namespace))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer target.Close()
+
+	err = unix.Setns(int(target.Fd()), 0)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+
+	for name, value := range sysctls {
+		path := filepath.Join("/proc/sys", strings.ReplaceAll(name, ".", "/"))
+		err = os.WriteFile(path, []byte(value), 0644)
+		if err != nil {
+			break
+		}
+	}
+
+	if restoreErr := unix.Setns(int(own.Fd()), 0); restoreErr != nil {
+		return restoreErr
+	}
+	runtime.UnlockOSThread()
+	return err
+}
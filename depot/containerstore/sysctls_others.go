@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package containerstore
+
+import "errors"
+
+// Containers only have namespaces on Linux.
+func SysctlNamespace(name string) (string, bool) {
+	return "", false
+}
+
+func setSysctls(pid int, sysctls map[string]string) error {
+	return errors.New("sysctls can only be set on linux")
+}
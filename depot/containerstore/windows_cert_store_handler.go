@@ -0,0 +1,91 @@
+package containerstore
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	certStoreProcessUser = "ContainerAdministrator"
+
+	// installCertScript reads the PEM encoded certificate and key from stdin
+	// and replaces any previous instance identity certificate in the
+	// LocalMachine\My store of the container.
+	installCertScript = `$ErrorActionPreference = 'Stop'
+$pem = [Console]::In.ReadToEnd()
+$cert = [System.Security.Cryptography.X509Certificates.X509Certificate2]::CreateFromPem($pem, $pem)
+$flags = [System.Security.Cryptography.X509Certificates.X509KeyStorageFlags]'MachineKeySet,PersistKeySet'
+$cert = [System.Security.Cryptography.X509Certificates.X509Certificate2]::new($cert.Export('Pfx'), [string]$null, $flags)
+$store = [System.Security.Cryptography.X509Certificates.X509Store]::new('My', 'LocalMachine')
+$store.Open('ReadWrite')
+$store.Certificates | Where-Object { $_.Subject -eq $cert.Subject -and $_.Thumbprint -ne $cert.Thumbprint } | ForEach-Object { $store.Remove($_) }
+$store.Add($cert)
+$store.Close()`
+)
+
+// WindowsCertStoreHandler installs the instance identity certificate and key
+// into the LocalMachine certificate store of Windows containers, so that .NET
+// apps can use them without reading the PEM files.
+type WindowsCertStoreHandler struct {
+	gardenClient   garden.Client
+	powershellPath string
+}
+
+func NewWindowsCertStoreHandler(gardenClient garden.Client, powershellPath string) *WindowsCertStoreHandler {
+	return &WindowsCertStoreHandler{
+		gardenClient:   gardenClient,
+		powershellPath: powershellPath,
+	}
+}
+
+func (h *WindowsCertStoreHandler) CreateDir(logger lager.Logger, container executor.Container) ([]garden.BindMount, []executor.EnvironmentVariable, error) {
+	return nil, nil, nil
+}
+
+func (h *WindowsCertStoreHandler) RemoveDir(logger lager.Logger, container executor.Container) error {
+	return nil
+}
+
+func (h *WindowsCertStoreHandler) Update(creds Credentials, container executor.Container) error {
+	if creds.InstanceIdentityCredential.IsEmpty() {
+		return nil
+	}
+
+	gardenContainer, err := h.gardenClient.Lookup(container.Guid)
+	if err != nil {
+		return err
+	}
+
+	stdin := strings.NewReader(creds.InstanceIdentityCredential.Cert + "\n" + creds.InstanceIdentityCredential.Key)
+	stderr := &bytes.Buffer{}
+	process, err := gardenContainer.Run(garden.ProcessSpec{
+		Path: h.powershellPath,
+		Args: []string{"-NoProfile", "-NonInteractive", "-Command", installCertScript},
+		User: certStoreProcessUser,
+	}, garden.ProcessIO{
+		Stdin:  stdin,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return err
+	}
+
+	exitCode, err := process.Wait()
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("installing the instance identity certificate failed with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func (h *WindowsCertStoreHandler) Close(creds Credentials, container executor.Container) error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package containerstore_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+)
+
+var _ = Describe("WindowsCertStoreHandler", func() {
+	var (
+		gardenClient    *gardenfakes.FakeClient
+		gardenContainer *gardenfakes.FakeContainer
+		process         *gardenfakes.FakeProcess
+		handler         *containerstore.WindowsCertStoreHandler
+		container       executor.Container
+		creds           containerstore.Credentials
+		stdin           string
+	)
+
+	BeforeEach(func() {
+		gardenClient = &gardenfakes.FakeClient{}
+		gardenContainer = &gardenfakes.FakeContainer{}
+		process = &gardenfakes.FakeProcess{}
+		gardenClient.LookupReturns(gardenContainer, nil)
+		gardenContainer.RunStub = func(spec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+			data, err := ioutil.ReadAll(processIO.Stdin)
+			Expect(err).NotTo(HaveOccurred())
+			stdin = string(data)
+			_, err = io.WriteString(processIO.Stderr, "access denied\n")
+			Expect(err).NotTo(HaveOccurred())
+			return process, nil
+		}
+
+		container = executor.Container{Guid: "some-guid"}
+		creds = containerstore.Credentials{InstanceIdentityCredential: containerstore.Credential{Cert: "cert", Key: "key"}}
+		handler = containerstore.NewWindowsCertStoreHandler(gardenClient, "powershell.exe")
+	})
+
+	Describe("Update", func() {
+		It("installs the certificate into the certificate store of the container", func() {
+			Expect(handler.Update(creds, container)).To(Succeed())
+
+			Expect(gardenClient.LookupCallCount()).To(Equal(1))
+			Expect(gardenClient.LookupArgsForCall(0)).To(Equal("some-guid"))
+
+			Expect(gardenContainer.RunCallCount()).To(Equal(1))
+			spec, _ := gardenContainer.RunArgsForCall(0)
+			Expect(spec.Path).To(Equal("powershell.exe"))
+			Expect(spec.Args[:3]).To(Equal([]string{"-NoProfile", "-NonInteractive", "-Command"}))
+			Expect(spec.Args[3]).To(ContainSubstring("LocalMachine"))
+			Expect(stdin).To(Equal("cert\nkey"))
+		})
+
+		It("noops if no Credential is passed", func() {
+			Expect(handler.Update(containerstore.Credentials{}, container)).To(Succeed())
+			Expect(gardenContainer.RunCallCount()).To(Equal(0))
+		})
+
+		Context("when the process fails", func() {
+			BeforeEach(func() {
+				process.WaitReturns(1, nil)
+			})
+
+			It("returns an error including its output", func() {
+				err := handler.Update(creds, container)
+				Expect(err).To(MatchError("installing the instance identity certificate failed with exit code 1: access denied"))
+			})
+		})
+
+		Context("when the container cannot be found", func() {
+			BeforeEach(func() {
+				gardenClient.LookupReturns(nil, errors.New("not found"))
+			})
+
+			It("returns an error", func() {
+				Expect(handler.Update(creds, container)).To(MatchError("not found"))
+			})
+		})
+	})
+})
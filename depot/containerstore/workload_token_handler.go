@@ -0,0 +1,288 @@
+package containerstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const workloadTokenFileName = "token"
+
+// WorkloadTokenHandler writes a JWT identifying the container next to its
+// instance identity credentials, for workloads that expect OIDC-style
+// workload identity instead of x509 certificates. Bearer tokens cannot be
+// revoked, so the token is only valid for ttl, and never longer than the
+// instance identity certificate it was issued with. It is replaced every time
+// the credentials are rotated, and refreshed halfway through its validity in
+// between.
+type WorkloadTokenHandler struct {
+	logger             lager.Logger
+	clock              clock.Clock
+	credDir            string
+	containerMountPath string
+	signingKey         crypto.Signer
+	keyID              string
+	issuer             string
+	audience           []string
+	ttl                time.Duration
+
+	lock   sync.Mutex
+	tokens map[string]*workloadToken
+}
+
+// workloadToken is what the token of a container is refreshed from.
+type workloadToken struct {
+	container  executor.Container
+	certExpiry time.Time
+	stop       chan struct{}
+}
+
+func NewWorkloadTokenHandler(
+	logger lager.Logger,
+	clock clock.Clock,
+	credDir string,
+	containerMountPath string,
+	signingKey crypto.Signer,
+	keyID string,
+	issuer string,
+	audience []string,
+	ttl time.Duration,
+) *WorkloadTokenHandler {
+	return &WorkloadTokenHandler{
+		logger:             logger.Session("workload-token-handler"),
+		clock:              clock,
+		credDir:            credDir,
+		containerMountPath: containerMountPath,
+		signingKey:         signingKey,
+		keyID:              keyID,
+		issuer:             issuer,
+		audience:           audience,
+		ttl:                ttl,
+		tokens:             map[string]*workloadToken{},
+	}
+}
+
+type workloadTokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+type workloadTokenClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub"`
+	Audience  []string `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+	Expiry    int64    `json:"exp"`
+	AppGUID   string   `json:"app_guid,omitempty"`
+}
+
+func (h *WorkloadTokenHandler) containerDir(container executor.Container) string {
+	return filepath.Join(h.credDir, container.Guid+"-token")
+}
+
+func (h *WorkloadTokenHandler) CreateDir(logger lager.Logger, container executor.Container) ([]garden.BindMount, []executor.EnvironmentVariable, error) {
+	containerDir := h.containerDir(container)
+	err := os.Mkdir(containerDir, 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []garden.BindMount{
+		{
+			SrcPath: containerDir,
+			DstPath: h.containerMountPath,
+			Mode:    garden.BindMountModeRO,
+			Origin:  garden.BindMountOriginHost,
+		},
+	}, []executor.EnvironmentVariable{
+		{Name: "CF_INSTANCE_TOKEN", Value: path.Join(h.containerMountPath, workloadTokenFileName)},
+	}, nil
+}
+
+func (h *WorkloadTokenHandler) RemoveDir(logger lager.Logger, container executor.Container) error {
+	h.stopRefreshing(container)
+	return os.RemoveAll(h.containerDir(container))
+}
+
+func (h *WorkloadTokenHandler) Update(creds Credentials, container executor.Container) error {
+	if creds.InstanceIdentityCredential.IsEmpty() {
+		return nil
+	}
+
+	block, _ := pem.Decode([]byte(creds.InstanceIdentityCredential.Cert))
+	if block == nil {
+		return errors.New("instance identity certificate is not PEM-encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	token, ok := h.tokens[container.Guid]
+	if !ok {
+		token = &workloadToken{stop: make(chan struct{})}
+		h.tokens[container.Guid] = token
+		go h.refresh(token)
+	}
+	token.container = container
+	token.certExpiry = cert.NotAfter
+	h.lock.Unlock()
+
+	return h.writeToken(container, cert.NotAfter)
+}
+
+func (h *WorkloadTokenHandler) Close(creds Credentials, container executor.Container) error {
+	h.stopRefreshing(container)
+	return nil
+}
+
+// refresh replaces the token of a container halfway through its validity,
+// until the container is closed.
+func (h *WorkloadTokenHandler) refresh(token *workloadToken) {
+	timer := h.clock.NewTimer(h.ttl / 2)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-token.stop:
+			return
+		case <-timer.C():
+			h.lock.Lock()
+			container, certExpiry := token.container, token.certExpiry
+			h.lock.Unlock()
+
+			err := h.writeToken(container, certExpiry)
+			if err != nil {
+				h.logger.Error("failed-to-refresh-token", err, lager.Data{"guid": container.Guid})
+			}
+			timer.Reset(h.ttl / 2)
+		}
+	}
+}
+
+func (h *WorkloadTokenHandler) stopRefreshing(container executor.Container) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	token, ok := h.tokens[container.Guid]
+	if !ok {
+		return
+	}
+	close(token.stop)
+	delete(h.tokens, container.Guid)
+}
+
+func (h *WorkloadTokenHandler) writeToken(container executor.Container, certExpiry time.Time) error {
+	now := h.clock.Now()
+	expiry := now.Add(h.ttl)
+	if expiry.After(certExpiry) {
+		expiry = certExpiry
+	}
+
+	token, err := h.signToken(workloadTokenClaims{
+		Issuer:    h.issuer,
+		Subject:   container.Guid,
+		Audience:  h.audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		Expiry:    expiry.Unix(),
+		AppGUID:   container.CertificateProperties.AppGUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	tokenPath := filepath.Join(h.containerDir(container), workloadTokenFileName)
+	tmpTokenPath := tokenPath + ".tmp"
+
+	err = os.WriteFile(tmpTokenPath, []byte(token), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpTokenPath, tokenPath)
+}
+
+func (h *WorkloadTokenHandler) signToken(claims workloadTokenClaims) (string, error) {
+	algorithm, err := workloadTokenAlgorithm(h.signingKey)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(workloadTokenHeader{Algorithm: algorithm, Type: "JWT", KeyID: h.keyID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signWorkloadToken(h.signingKey, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func workloadTokenAlgorithm(key crypto.Signer) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve.Params().BitSize != 256 {
+			return "", fmt.Errorf("unsupported ECDSA curve for workload tokens: %s", k.Curve.Params().Name)
+		}
+		return "ES256", nil
+	case ed25519.PrivateKey:
+		return "EdDSA", nil
+	default:
+		return "", fmt.Errorf("unsupported workload token signing key: %T", key)
+	}
+}
+
+func signWorkloadToken(key crypto.Signer, signingInput []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k.Sign(rand.Reader, signingInput, crypto.Hash(0))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(signingInput)
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed size concatenation of r and s rather than ASN.1
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	default:
+		digest := sha256.Sum256(signingInput)
+		return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+}
@@ -0,0 +1,213 @@
+package containerstore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/garden"
+)
+
+var _ = Describe("WorkloadTokenHandler", func() {
+	var (
+		tmpdir     string
+		fakeClock  *fakeclock.FakeClock
+		signingKey *ecdsa.PrivateKey
+		handler    *containerstore.WorkloadTokenHandler
+		container  executor.Container
+		creds      containerstore.Credentials
+		notBefore  time.Time
+		notAfter   time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpdir = GinkgoT().TempDir()
+		container = executor.Container{
+			Guid: "some-guid",
+			RunInfo: executor.RunInfo{
+				CertificateProperties: executor.CertificateProperties{AppGUID: "some-app-guid"},
+			},
+		}
+
+		signingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		notBefore = time.Now().UTC().Truncate(time.Second)
+		notAfter = notBefore.Add(time.Hour)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+		}
+		certBytes, err := x509.CreateCertificate(rand.Reader, template, template, signingKey.Public(), signingKey)
+		Expect(err).NotTo(HaveOccurred())
+		creds = containerstore.Credentials{InstanceIdentityCredential: containerstore.Credential{
+			Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})),
+			Key:  "key",
+		}}
+
+		fakeClock = fakeclock.NewFakeClock(notBefore)
+		handler = containerstore.NewWorkloadTokenHandler(logger, fakeClock, tmpdir, "/etc/token", signingKey, "some-key-id", "https://issuer.example.com", []string{"some-audience"}, 10*time.Minute)
+	})
+
+	AfterEach(func() {
+		Expect(handler.Close(creds, container)).To(Succeed())
+	})
+
+	readToken := func() []string {
+		data, err := os.ReadFile(filepath.Join(tmpdir, "some-guid-token", "token"))
+		Expect(err).NotTo(HaveOccurred())
+		parts := strings.Split(string(data), ".")
+		Expect(parts).To(HaveLen(3))
+		return parts
+	}
+
+	decodeSegment := func(segment string) map[string]interface{} {
+		data, err := base64.RawURLEncoding.DecodeString(segment)
+		Expect(err).NotTo(HaveOccurred())
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		return decoded
+	}
+
+	Describe("CreateDir", func() {
+		It("mounts the token directory and points CF_INSTANCE_TOKEN at the token", func() {
+			mounts, envs, err := handler.CreateDir(logger, container)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(mounts).To(ConsistOf(garden.BindMount{
+				SrcPath: filepath.Join(tmpdir, "some-guid-token"),
+				DstPath: "/etc/token",
+				Mode:    garden.BindMountModeRO,
+				Origin:  garden.BindMountOriginHost,
+			}))
+			Expect(envs).To(ConsistOf(executor.EnvironmentVariable{Name: "CF_INSTANCE_TOKEN", Value: "/etc/token/token"}))
+		})
+	})
+
+	Describe("Update", func() {
+		BeforeEach(func() {
+			_, _, err := handler.CreateDir(logger, container)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("writes a signed token valid for the token TTL", func() {
+			Expect(handler.Update(creds, container)).To(Succeed())
+			parts := readToken()
+
+			Expect(decodeSegment(parts[0])).To(Equal(map[string]interface{}{
+				"alg": "ES256",
+				"typ": "JWT",
+				"kid": "some-key-id",
+			}))
+			Expect(decodeSegment(parts[1])).To(Equal(map[string]interface{}{
+				"iss":      "https://issuer.example.com",
+				"sub":      "some-guid",
+				"aud":      []interface{}{"some-audience"},
+				"iat":      float64(notBefore.Unix()),
+				"nbf":      float64(notBefore.Unix()),
+				"exp":      float64(notBefore.Add(10 * time.Minute).Unix()),
+				"app_guid": "some-app-guid",
+			}))
+
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signature).To(HaveLen(64))
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			Expect(ecdsa.Verify(&signingKey.PublicKey, digest[:], r, s)).To(BeTrue())
+		})
+
+		It("refreshes the token halfway through its validity", func() {
+			Expect(handler.Update(creds, container)).To(Succeed())
+
+			fakeClock.WaitForWatcherAndIncrement(5 * time.Minute)
+			Eventually(func() interface{} {
+				return decodeSegment(readToken()[1])["exp"]
+			}).Should(Equal(float64(notBefore.Add(15 * time.Minute).Unix())))
+			Expect(decodeSegment(readToken()[1])["iat"]).To(Equal(float64(notBefore.Add(5 * time.Minute).Unix())))
+		})
+
+		It("stops refreshing the token once the container is closed", func() {
+			Expect(handler.Update(creds, container)).To(Succeed())
+			Eventually(fakeClock.WatcherCount).Should(Equal(1))
+
+			Expect(handler.Close(creds, container)).To(Succeed())
+			Eventually(fakeClock.WatcherCount).Should(Equal(0))
+		})
+
+		Context("when the instance identity certificate expires before the token TTL", func() {
+			BeforeEach(func() {
+				handler = containerstore.NewWorkloadTokenHandler(logger, fakeClock, tmpdir, "/etc/token", signingKey, "", "", nil, 2*time.Hour)
+			})
+
+			It("expires the token with the certificate", func() {
+				Expect(handler.Update(creds, container)).To(Succeed())
+				Expect(decodeSegment(readToken()[1])["exp"]).To(Equal(float64(notAfter.Unix())))
+			})
+		})
+
+		It("noops if no Credential is passed", func() {
+			Expect(handler.Update(containerstore.Credentials{}, container)).To(Succeed())
+			Expect(filepath.Join(tmpdir, "some-guid-token", "token")).NotTo(BeAnExistingFile())
+		})
+
+		Context("when signing with an Ed25519 key", func() {
+			var publicKey ed25519.PublicKey
+
+			BeforeEach(func() {
+				var privateKey ed25519.PrivateKey
+				var err error
+				publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				handler = containerstore.NewWorkloadTokenHandler(logger, fakeClock, tmpdir, "/etc/token", privateKey, "", "", nil, 10*time.Minute)
+			})
+
+			It("writes an EdDSA token", func() {
+				Expect(handler.Update(creds, container)).To(Succeed())
+				parts := readToken()
+
+				Expect(decodeSegment(parts[0])).To(Equal(map[string]interface{}{"alg": "EdDSA", "typ": "JWT"}))
+				signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature)).To(BeTrue())
+			})
+		})
+
+		Context("when the certificate is not PEM-encoded", func() {
+			It("returns an error", func() {
+				creds.InstanceIdentityCredential.Cert = "cert"
+				Expect(handler.Update(creds, container)).To(MatchError("instance identity certificate is not PEM-encoded"))
+			})
+		})
+	})
+
+	Describe("RemoveDir", func() {
+		It("removes the token directory", func() {
+			_, _, err := handler.CreateDir(logger, container)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(handler.RemoveDir(logger, container)).To(Succeed())
+			Expect(filepath.Join(tmpdir, "some-guid-token")).NotTo(BeADirectory())
+		})
+	})
+})
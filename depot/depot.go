@@ -1,12 +1,16 @@
 package depot
 
 import (
+	"encoding/base64"
 	"io"
+	"sort"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/containerstore"
 	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/executor/featureflags"
 	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/volman"
@@ -15,6 +19,24 @@ import (
 
 const ContainerStoppedBeforeRunMessage = "Container stopped by user"
 
+// ScheduledTaskSource reports the results of the scheduled maintenance tasks
+// run on the cell.
+type ScheduledTaskSource interface {
+	Results() []executor.ScheduledTaskResult
+}
+
+// ArtifactPrefetcher fetches the artifacts of a manifest into the download
+// cache of the cell.
+type ArtifactPrefetcher interface {
+	Submit(logger lager.Logger, artifacts []executor.PrefetchArtifact) error
+	Progress() executor.PrefetchProgress
+}
+
+// ContainerDrainer stops the containers of the cell when it is drained.
+type ContainerDrainer interface {
+	Drain(logger lager.Logger, traceID string, deadline time.Duration) error
+}
+
 type client struct {
 	totalCapacity    executor.ExecutorResources
 	containerStore   containerstore.ContainerStore
@@ -25,9 +47,25 @@ type client struct {
 	deletionWorkPool *workpool.WorkPool
 	readWorkPool     *workpool.WorkPool
 	metricsWorkPool  *workpool.WorkPool
+	featureFlags     *featureflags.Flags
+
+	capacityLock  sync.RWMutex
+	placementTags []string
+	capabilities  executor.CellCapabilities
+
+	scheduledTasks ScheduledTaskSource
+	prefetcher     ArtifactPrefetcher
+	drainer        ContainerDrainer
+
+	containerTemplates executor.Templates
+
+	startRateLimiter *StartRateLimiter
 
 	healthyLock sync.RWMutex
 	healthy     bool
+
+	drainingLock sync.RWMutex
+	draining     bool
 }
 
 func NewClient(
@@ -40,6 +78,14 @@ func NewClient(
 	deletionWorkPool *workpool.WorkPool,
 	readWorkPool *workpool.WorkPool,
 	metricsWorkPool *workpool.WorkPool,
+	featureFlags *featureflags.Flags,
+	placementTags []string,
+	capabilities executor.CellCapabilities,
+	scheduledTasks ScheduledTaskSource,
+	startRateLimiter *StartRateLimiter,
+	prefetcher ArtifactPrefetcher,
+	drainer ContainerDrainer,
+	containerTemplates executor.Templates,
 ) executor.Client {
 	return &client{
 		totalCapacity:    totalCapacity,
@@ -51,7 +97,16 @@ func NewClient(
 		deletionWorkPool: deletionWorkPool,
 		readWorkPool:     readWorkPool,
 		metricsWorkPool:  metricsWorkPool,
+		featureFlags:     featureFlags,
+		placementTags:    copyStrings(placementTags),
+		capabilities:     capabilities,
+		scheduledTasks:   scheduledTasks,
+		startRateLimiter: startRateLimiter,
+		prefetcher:       prefetcher,
+		drainer:          drainer,
 		healthy:          true,
+
+		containerTemplates: containerTemplates,
 	}
 }
 
@@ -67,6 +122,14 @@ func (c *client) AllocateContainers(logger lager.Logger, traceID string, request
 	logger = logger.Session("allocate-containers")
 	failures := make([]executor.AllocationFailure, 0)
 
+	if c.isDraining() {
+		logger.Info("rejecting-allocations-while-draining", lager.Data{"requests": len(requests)})
+		for i := range requests {
+			failures = append(failures, executor.NewAllocationFailure(&requests[i], executor.ErrCellDraining.Error()))
+		}
+		return failures
+	}
+
 	for i := range requests {
 		req := &requests[i]
 		err := req.Validate()
@@ -105,8 +168,15 @@ func (c *client) RunContainer(logger lager.Logger, traceID string, request *exec
 		"guid": request.Guid,
 	})
 
+	if !c.startRateLimiter.Allow(request.MetricsConfig.Guid) {
+		logger.Info("start-rate-limited", lager.Data{"source": request.MetricsConfig.Guid})
+		return executor.ErrStartRateLimited
+	}
+
+	templated := c.containerTemplates.Apply(*request)
+
 	logger.Debug("initializing-container")
-	err := c.containerStore.Initialize(logger, request)
+	err := c.containerStore.Initialize(logger, &templated)
 	if err != nil {
 		logger.Error("failed-initializing-container", err)
 		return err
@@ -117,6 +187,22 @@ func (c *client) RunContainer(logger lager.Logger, traceID string, request *exec
 	return nil
 }
 
+// RunContainers runs the containers like RunContainer. The containers are
+// initialized in order and created in parallel, bounded by the creation work
+// pool, so the results only report the failures to initialize them.
+func (c *client) RunContainers(logger lager.Logger, traceID string, requests []executor.RunRequest) []executor.ContainerResult {
+	logger = logger.Session("run-containers", lager.Data{"containers": len(requests)})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	results := make([]executor.ContainerResult, len(requests))
+	for i := range requests {
+		err := c.RunContainer(logger, traceID, &requests[i])
+		results[i] = executor.NewContainerResult(requests[i].Guid, err)
+	}
+	return results
+}
+
 func (c *client) newRunContainerWorker(logger lager.Logger, traceID string, guid string) func() {
 	return func() {
 		logger.Info("creating-container")
@@ -148,6 +234,67 @@ func (c *client) ListContainers(logger lager.Logger) ([]executor.Container, erro
 	return c.containerStore.List(logger), nil
 }
 
+// ListContainersPage lists the containers after the guid encoded in the
+// continuation token, so that pages stay consistent while containers come
+// and go.
+func (c *client) ListContainersPage(logger lager.Logger, request executor.ListContainersRequest) (executor.ContainerPage, error) {
+	logger = logger.Session("list-containers-page")
+
+	var after string
+	if request.ContinuationToken != "" {
+		guid, err := base64.RawURLEncoding.DecodeString(request.ContinuationToken)
+		if err != nil || len(guid) == 0 {
+			logger.Error("invalid-continuation-token", executor.ErrInvalidContinuationToken)
+			return executor.ContainerPage{}, executor.ErrInvalidContinuationToken
+		}
+		after = string(guid)
+	}
+
+	containers := []executor.Container{}
+	for _, container := range c.containerStore.List(logger) {
+		if container.Guid > after && request.Filter.Matches(container) {
+			containers = append(containers, container)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Guid < containers[j].Guid
+	})
+
+	page := executor.ContainerPage{Containers: containers}
+	if request.Limit > 0 && len(containers) > request.Limit {
+		page.Containers = containers[:request.Limit]
+		page.ContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(page.Containers[request.Limit-1].Guid))
+	}
+	return page, nil
+}
+
+// Drain stops accepting allocations and rotates the credentials of the
+// containers so that they stay valid for no longer than deadline. It then
+// stops the containers in the configured order and returns
+// ErrDrainDeadlineExceeded if they have not all completed within deadline.
+func (c *client) Drain(logger lager.Logger, traceID string, deadline time.Duration) error {
+	logger = logger.Session("drain")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	c.drainingLock.Lock()
+	c.draining = true
+	c.drainingLock.Unlock()
+
+	c.containerStore.Drain(logger, deadline)
+
+	if c.drainer == nil {
+		return nil
+	}
+	return c.drainer.Drain(logger, traceID, deadline)
+}
+
+func (c *client) isDraining() bool {
+	c.drainingLock.RLock()
+	defer c.drainingLock.RUnlock()
+	return c.draining
+}
+
 func (c *client) GetBulkMetrics(logger lager.Logger) (map[string]executor.Metrics, error) {
 	errChannel := make(chan error, 1)
 	metricsChannel := make(chan map[string]executor.Metrics, 1)
@@ -210,6 +357,27 @@ func (c *client) DeleteContainer(logger lager.Logger, traceID string, guid strin
 	logger.Info("starting")
 	defer logger.Info("complete")
 
+	if c.featureFlags.Enabled(featureflags.AsyncDeletes) {
+		// the errors of Destroy cannot be returned once the request is
+		// answered, so unknown containers are rejected before and the
+		// failures of the deletion itself are logged
+		_, err := c.containerStore.Get(logger, guid)
+		if err != nil {
+			logger.Error("failed-to-get-container", err)
+			return err
+		}
+
+		c.deletionWorkPool.Submit(func() {
+			err := c.containerStore.Destroy(logger, traceID, guid)
+			if err != nil {
+				logger.Error("failed-to-delete-garden-container-async", err)
+				return
+			}
+			logger.Info("deleted-garden-container-async")
+		})
+		return nil
+	}
+
 	errChannel := make(chan error, 1)
 	c.deletionWorkPool.Submit(func() {
 		errChannel <- c.containerStore.Destroy(logger, traceID, guid)
@@ -224,6 +392,78 @@ func (c *client) DeleteContainer(logger lager.Logger, traceID string, guid strin
 	return err
 }
 
+// StopContainers stops the selected containers in parallel, bounded by the
+// deletion work pool.
+func (c *client) StopContainers(logger lager.Logger, traceID string, selector executor.ContainerSelector) []executor.ContainerResult {
+	logger = logger.Session("stop-containers")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	return c.forEachSelected(logger, selector, func(guid string) error {
+		return c.containerStore.Stop(logger, traceID, guid)
+	})
+}
+
+// DeleteContainers deletes the selected containers in parallel, bounded by
+// the deletion work pool. Unlike DeleteContainer, it always waits for the
+// containers to be destroyed.
+func (c *client) DeleteContainers(logger lager.Logger, traceID string, selector executor.ContainerSelector) []executor.ContainerResult {
+	logger = logger.Session("delete-containers")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	return c.forEachSelected(logger, selector, func(guid string) error {
+		return c.containerStore.Destroy(logger, traceID, guid)
+	})
+}
+
+func (c *client) forEachSelected(logger lager.Logger, selector executor.ContainerSelector, op func(guid string) error) []executor.ContainerResult {
+	guids := c.selectContainers(logger, selector)
+	results := make([]executor.ContainerResult, len(guids))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(guids))
+	for i, guid := range guids {
+		i, guid := i, guid
+		c.deletionWorkPool.Submit(func() {
+			defer wg.Done()
+			err := op(guid)
+			if err != nil {
+				logger.Error("failed", err, lager.Data{"guid": guid})
+			}
+			results[i] = executor.NewContainerResult(guid, err)
+		})
+	}
+	wg.Wait()
+
+	return results
+}
+
+// selectContainers returns the guids of the selected containers. Guids that
+// are explicitly selected are returned even when there is no such container,
+// so that the caller gets a result for them.
+func (c *client) selectContainers(logger lager.Logger, selector executor.ContainerSelector) []string {
+	seen := map[string]bool{}
+	var guids []string
+	for _, guid := range selector.Guids {
+		if !seen[guid] {
+			seen[guid] = true
+			guids = append(guids, guid)
+		}
+	}
+
+	if len(selector.Tags) > 0 {
+		for _, container := range c.containerStore.List(logger) {
+			if !seen[container.Guid] && tagsMatch(selector.Tags, container.Tags) {
+				seen[container.Guid] = true
+				guids = append(guids, container.Guid)
+			}
+		}
+	}
+
+	return guids
+}
+
 func (c *client) RemainingResources(logger lager.Logger) (executor.ExecutorResources, error) {
 	logger = logger.Session("remaining-resources")
 	return c.containerStore.RemainingResources(logger), nil
@@ -234,15 +474,94 @@ func (c *client) Ping(logger lager.Logger) error {
 }
 
 func (c *client) TotalResources(logger lager.Logger) (executor.ExecutorResources, error) {
-	totalCapacity := c.totalCapacity
+	c.capacityLock.RLock()
+	totalCapacity := c.totalCapacity.Copy()
+	c.capacityLock.RUnlock()
 
 	return executor.ExecutorResources{
 		MemoryMB:   totalCapacity.MemoryMB,
 		DiskMB:     totalCapacity.DiskMB,
 		Containers: totalCapacity.Containers,
+		GPUs:       totalCapacity.GPUs,
+		GPUTypes:   totalCapacity.GPUTypes,
+
+		ExclusiveCPUs: totalCapacity.ExclusiveCPUs,
+
+		ContainerIPs: totalCapacity.ContainerIPs,
+		HostPorts:    totalCapacity.HostPorts,
 	}, nil
 }
 
+func (c *client) SetTotalResources(logger lager.Logger, total executor.ExecutorResources) error {
+	logger = logger.Session("set-total-resources")
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	c.capacityLock.Lock()
+	defer c.capacityLock.Unlock()
+
+	err := c.containerStore.SetTotalResources(logger, total)
+	if err != nil {
+		return err
+	}
+	total.ContainerIPs = c.totalCapacity.ContainerIPs
+	total.HostPorts = c.totalCapacity.HostPorts
+	total.GPUs = c.totalCapacity.GPUs
+	total.GPUTypes = c.totalCapacity.GPUTypes
+	total.ExclusiveCPUs = c.totalCapacity.ExclusiveCPUs
+	c.totalCapacity = total
+	return nil
+}
+
+func (c *client) PlacementTags(logger lager.Logger) []string {
+	c.capacityLock.RLock()
+	defer c.capacityLock.RUnlock()
+	return copyStrings(c.placementTags)
+}
+
+func (c *client) SetPlacementTags(logger lager.Logger, placementTags []string) {
+	logger = logger.Session("set-placement-tags", lager.Data{"placement-tags": placementTags})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	c.capacityLock.Lock()
+	defer c.capacityLock.Unlock()
+	c.placementTags = copyStrings(placementTags)
+}
+
+func (c *client) Capabilities(logger lager.Logger) executor.CellCapabilities {
+	capabilities := c.capabilities
+	capabilities.CPUFeatures = copyStrings(c.capabilities.CPUFeatures)
+	return capabilities
+}
+
+func (c *client) ScheduledTaskResults(logger lager.Logger) []executor.ScheduledTaskResult {
+	if c.scheduledTasks == nil {
+		return nil
+	}
+	return c.scheduledTasks.Results()
+}
+
+func (c *client) PrefetchArtifacts(logger lager.Logger, artifacts []executor.PrefetchArtifact) error {
+	if c.prefetcher == nil {
+		return executor.ErrPrefetchNotSupported
+	}
+	return c.prefetcher.Submit(logger, artifacts)
+}
+
+func (c *client) PrefetchProgress(logger lager.Logger) executor.PrefetchProgress {
+	if c.prefetcher == nil {
+		return executor.PrefetchProgress{}
+	}
+	return c.prefetcher.Progress()
+}
+
+func copyStrings(strs []string) []string {
+	copied := make([]string, len(strs))
+	copy(copied, strs)
+	return copied
+}
+
 func (c *client) GetFiles(logger lager.Logger, guid, sourcePath string) (io.ReadCloser, error) {
 	logger = logger.Session("get-files", lager.Data{
 		"guid": guid,
@@ -285,8 +604,32 @@ func (c *client) VolumeDrivers(logger lager.Logger) ([]string, error) {
 	return actualDrivers, nil
 }
 
-func (c *client) SubscribeToEvents(logger lager.Logger) (executor.EventSource, error) {
-	return c.eventHub.Subscribe()
+func (c *client) StreamIn(logger lager.Logger, guid, destinationPath string, tarStream io.Reader) error {
+	logger = logger.Session("stream-in", lager.Data{
+		"guid": guid,
+		"path": destinationPath,
+	})
+
+	err := c.containerStore.StreamIn(logger, guid, destinationPath, tarStream)
+	if err != nil {
+		logger.Error("failed-to-stream-in", err)
+	}
+	return err
+}
+
+func (c *client) RunProcess(logger lager.Logger, guid string, spec executor.ProcessSpec, processIO executor.ProcessIO) (executor.Process, error) {
+	logger = logger.Session("run-process", lager.Data{"guid": guid})
+
+	process, err := c.containerStore.RunProcess(logger, guid, spec, processIO)
+	if err != nil {
+		logger.Error("failed-to-run-process", err)
+		return nil, err
+	}
+	return process, nil
+}
+
+func (c *client) SubscribeToEvents(logger lager.Logger, opts ...executor.SubscribeOption) (executor.EventSource, error) {
+	return c.eventHub.Subscribe(opts...)
 }
 
 func (c *client) Healthy(logger lager.Logger) bool {
@@ -300,3 +643,20 @@ func (c *client) SetHealthy(logger lager.Logger, healthy bool) {
 	defer c.healthyLock.Unlock()
 	c.healthy = healthy
 }
+
+func (c *client) FeatureFlags(logger lager.Logger) []string {
+	return c.featureFlags.Active()
+}
+
+func (c *client) SetFeatureFlag(logger lager.Logger, name string, enabled bool) error {
+	logger = logger.Session("set-feature-flag", lager.Data{"name": name, "enabled": enabled})
+
+	err := c.featureFlags.Set(name, enabled)
+	if err != nil {
+		logger.Error("failed-to-set-feature-flag", err)
+		return err
+	}
+
+	logger.Info("set")
+	return nil
+}
@@ -5,11 +5,13 @@ import (
 	"io"
 	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot"
 	"code.cloudfoundry.org/executor/depot/containerstore/containerstorefakes"
 	efakes "code.cloudfoundry.org/executor/depot/event/fakes"
 	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/executor/featureflags"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/routing-info/internalroutes"
@@ -35,6 +37,12 @@ var _ = Describe("Depot", func() {
 		DeleteWorkPoolSize  int
 		ReadWorkPoolSize    int
 		MetricsWorkPoolSize int
+		featureFlags        *featureflags.Flags
+		scheduledTasks      depot.ScheduledTaskSource
+		prefetcher          depot.ArtifactPrefetcher
+		startRateLimiter    *depot.StartRateLimiter
+		drainer             *containerDrainer
+		containerTemplates  executor.Templates
 	)
 
 	BeforeEach(func() {
@@ -54,6 +62,15 @@ var _ = Describe("Depot", func() {
 		DeleteWorkPoolSize = 5
 		ReadWorkPoolSize = 5
 		MetricsWorkPoolSize = 5
+
+		var err error
+		featureFlags, err = featureflags.New()
+		Expect(err).NotTo(HaveOccurred())
+		scheduledTasks = nil
+		prefetcher = nil
+		startRateLimiter = nil
+		drainer = &containerDrainer{}
+		containerTemplates = nil
 	})
 
 	JustBeforeEach(func() {
@@ -69,6 +86,13 @@ var _ = Describe("Depot", func() {
 		depotClient = depot.NewClient(
 			resources, containerStore, gardenClient, volmanClient, eventHub,
 			creationWorkPool, deletionWorkPool, readWorkPool, metricsWorkPool,
+			featureFlags, []string{"some-tag"},
+			executor.CellCapabilities{CPUFeatures: []string{"avx2"}, GPUs: 1, CgroupVersion: 2},
+			scheduledTasks,
+			startRateLimiter,
+			prefetcher,
+			drainer,
+			containerTemplates,
 		)
 	})
 
@@ -222,6 +246,38 @@ var _ = Describe("Depot", func() {
 			})
 		})
 
+		Context("when the cell has container templates", func() {
+			BeforeEach(func() {
+				containerTemplates = executor.Templates{
+					"": {
+						Env:     []executor.EnvironmentVariable{{Name: "FLEET", Value: "default"}},
+						LogTags: map[string]string{"fleet": "default"},
+					},
+					"isolated": {
+						Env: []executor.EnvironmentVariable{{Name: "FLEET", Value: "isolated"}},
+					},
+				}
+				runRequest.Tags = executor.Tags{executor.PlacementTagTag: "isolated"}
+			})
+
+			It("initializes the container with the templates applied", func() {
+				err := depotClient.RunContainer(logger, "some-trace-id", runRequest)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(containerStore.InitializeCallCount()).To(Equal(1))
+				_, req := containerStore.InitializeArgsForCall(0)
+				Expect(req.Env).To(Equal([]executor.EnvironmentVariable{{Name: "FLEET", Value: "isolated"}}))
+				Expect(req.LogConfig.Tags).To(Equal(map[string]string{"fleet": "default"}))
+			})
+
+			It("does not modify the request", func() {
+				err := depotClient.RunContainer(logger, "some-trace-id", runRequest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(runRequest.Env).To(BeEmpty())
+				Expect(runRequest.LogConfig.Tags).To(BeEmpty())
+			})
+		})
+
 		Context("when the container fails to initialize", func() {
 			BeforeEach(func() {
 				containerStore.InitializeReturns(executor.ErrContainerNotFound)
@@ -259,6 +315,54 @@ var _ = Describe("Depot", func() {
 				Expect(logger).To(gbytes.Say("run-container.failed-running-container-in-garden"))
 			})
 		})
+
+		Context("when starts are rate limited per app", func() {
+			var fakeClock *fakeclock.FakeClock
+
+			BeforeEach(func() {
+				fakeClock = fakeclock.NewFakeClock(time.Now())
+				startRateLimiter = depot.NewStartRateLimiter(fakeClock, 2)
+			})
+
+			runApp := func(appGuid string) error {
+				request := newRunRequest(containerGuid)
+				request.MetricsConfig.Guid = appGuid
+				return depotClient.RunContainer(logger, "some-trace-id", request)
+			}
+
+			It("rejects starts over the limit with a retriable error", func() {
+				Expect(runApp("app-1")).To(Succeed())
+				Expect(runApp("app-1")).To(Succeed())
+
+				err := runApp("app-1")
+				Expect(err).To(Equal(executor.ErrStartRateLimited))
+				Expect(executor.IsRetriable(err)).To(BeTrue())
+				Expect(containerStore.InitializeCallCount()).To(Equal(2))
+				Expect(logger).To(gbytes.Say("run-container.start-rate-limited"))
+			})
+
+			It("limits each app separately", func() {
+				Expect(runApp("app-1")).To(Succeed())
+				Expect(runApp("app-1")).To(Succeed())
+				Expect(runApp("app-2")).To(Succeed())
+			})
+
+			It("does not limit containers without an app", func() {
+				for i := 0; i < 3; i++ {
+					Expect(runApp("")).To(Succeed())
+				}
+			})
+
+			It("allows more starts as time passes", func() {
+				Expect(runApp("app-1")).To(Succeed())
+				Expect(runApp("app-1")).To(Succeed())
+				Expect(runApp("app-1")).To(Equal(executor.ErrStartRateLimited))
+
+				fakeClock.Increment(30 * time.Second)
+				Expect(runApp("app-1")).To(Succeed())
+				Expect(runApp("app-1")).To(Equal(executor.ErrStartRateLimited))
+			})
+		})
 	})
 
 	Describe("Throttling", func() {
@@ -473,6 +577,94 @@ var _ = Describe("Depot", func() {
 		})
 	})
 
+	Describe("ListContainersPage", func() {
+		var (
+			lrp1, lrp2, task executor.Container
+			request          executor.ListContainersRequest
+		)
+
+		BeforeEach(func() {
+			lrp1 = executor.Container{Guid: "guid-1", State: executor.StateRunning, Tags: executor.Tags{executor.LifecycleTag: executor.LRPLifecycle, executor.ProcessGuidTag: "process-1"}}
+			lrp2 = executor.Container{Guid: "guid-2", State: executor.StateCreated, Tags: executor.Tags{executor.LifecycleTag: executor.LRPLifecycle, executor.ProcessGuidTag: "process-2"}}
+			task = executor.Container{Guid: "guid-3", State: executor.StateRunning, Tags: executor.Tags{executor.LifecycleTag: executor.TaskLifecycle}}
+			containerStore.ListReturns([]executor.Container{task, lrp2, lrp1})
+			request = executor.ListContainersRequest{}
+		})
+
+		It("lists all the containers in the order of their guids", func() {
+			page, err := depotClient.ListContainersPage(logger, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Containers).To(Equal([]executor.Container{lrp1, lrp2, task}))
+			Expect(page.ContinuationToken).To(BeEmpty())
+		})
+
+		It("filters the containers", func() {
+			request.Filter = executor.ContainerFilter{States: []executor.State{executor.StateRunning}, Lifecycle: executor.LRPLifecycle}
+			page, err := depotClient.ListContainersPage(logger, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Containers).To(Equal([]executor.Container{lrp1}))
+
+			request.Filter = executor.ContainerFilter{ProcessGuid: "process-2"}
+			page, err = depotClient.ListContainersPage(logger, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Containers).To(Equal([]executor.Container{lrp2}))
+		})
+
+		It("pages through the containers", func() {
+			request.Limit = 2
+			page, err := depotClient.ListContainersPage(logger, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Containers).To(Equal([]executor.Container{lrp1, lrp2}))
+			Expect(page.ContinuationToken).NotTo(BeEmpty())
+
+			request.ContinuationToken = page.ContinuationToken
+			page, err = depotClient.ListContainersPage(logger, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Containers).To(Equal([]executor.Container{task}))
+			Expect(page.ContinuationToken).To(BeEmpty())
+		})
+
+		It("rejects invalid continuation tokens", func() {
+			request.ContinuationToken = "not base64!"
+			_, err := depotClient.ListContainersPage(logger, request)
+			Expect(err).To(Equal(executor.ErrInvalidContinuationToken))
+		})
+	})
+
+	Describe("Drain", func() {
+		It("drains the container store", func() {
+			Expect(depotClient.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+			Expect(containerStore.DrainCallCount()).To(Equal(1))
+			_, window := containerStore.DrainArgsForCall(0)
+			Expect(window).To(Equal(time.Minute))
+		})
+
+		It("stops the containers within the deadline", func() {
+			Expect(depotClient.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+			Expect(drainer.traceID).To(Equal("some-trace-id"))
+			Expect(drainer.deadline).To(Equal(time.Minute))
+		})
+
+		It("stops accepting allocations", func() {
+			Expect(depotClient.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+
+			requests := []executor.AllocationRequest{newAllocationRequest("guid-1")}
+			failures := depotClient.AllocateContainers(logger, "some-trace-id", requests)
+			Expect(failures).To(ConsistOf(executor.NewAllocationFailure(&requests[0], executor.ErrCellDraining.Error())))
+			Expect(containerStore.ReserveCallCount()).To(Equal(0))
+		})
+
+		Context("when the containers do not stop within the deadline", func() {
+			BeforeEach(func() {
+				drainer.err = executor.ErrDrainDeadlineExceeded
+			})
+
+			It("returns the error", func() {
+				Expect(depotClient.Drain(logger, "some-trace-id", time.Minute)).To(Equal(executor.ErrDrainDeadlineExceeded))
+			})
+		})
+	})
+
 	Describe("GetBulkMetrics", func() {
 		var metrics map[string]executor.Metrics
 		var metricsErr error
@@ -595,6 +787,143 @@ var _ = Describe("Depot", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
+
+		Context("when async deletes are enabled", func() {
+			BeforeEach(func() {
+				Expect(featureFlags.Set(featureflags.AsyncDeletes, true)).To(Succeed())
+				containerStore.DestroyReturns(errors.New("some-error"))
+			})
+
+			It("returns without waiting for the container to be destroyed", func() {
+				err := depotClient.DeleteContainer(logger, "some-trace-id", "guid-1")
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(containerStore.DestroyCallCount).Should(Equal(1))
+				_, traceID, guid := containerStore.DestroyArgsForCall(0)
+				Expect(traceID).To(Equal("some-trace-id"))
+				Expect(guid).To(Equal("guid-1"))
+			})
+
+			It("logs the failure to destroy the container", func() {
+				err := depotClient.DeleteContainer(logger, "some-trace-id", "guid-1")
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(logger).Should(gbytes.Say("failed-to-delete-garden-container-async"))
+			})
+
+			Context("when the container does not exist", func() {
+				BeforeEach(func() {
+					containerStore.GetReturns(executor.Container{}, executor.ErrContainerNotFound)
+				})
+
+				It("returns the error without destroying the container", func() {
+					err := depotClient.DeleteContainer(logger, "some-trace-id", "guid-1")
+					Expect(err).To(Equal(executor.ErrContainerNotFound))
+					Consistently(containerStore.DestroyCallCount).Should(Equal(0))
+				})
+			})
+		})
+	})
+
+	Describe("RunContainers", func() {
+		BeforeEach(func() {
+			containerStore.InitializeStub = func(_ lager.Logger, req *executor.RunRequest) error {
+				if req.Guid == "missing-guid" {
+					return executor.ErrContainerNotFound
+				}
+				return nil
+			}
+		})
+
+		It("runs the containers and returns the result of each", func() {
+			results := depotClient.RunContainers(logger, "some-trace-id", []executor.RunRequest{
+				*newRunRequest("guid-1"),
+				*newRunRequest("missing-guid"),
+				*newRunRequest("guid-2"),
+			})
+			Expect(results).To(Equal([]executor.ContainerResult{
+				{Guid: "guid-1"},
+				{Guid: "missing-guid", ErrorMsg: executor.ErrContainerNotFound.Error()},
+				{Guid: "guid-2"},
+			}))
+
+			Eventually(containerStore.RunCallCount).Should(Equal(2))
+			var guids []string
+			for i := 0; i < containerStore.RunCallCount(); i++ {
+				_, _, guid := containerStore.RunArgsForCall(i)
+				guids = append(guids, guid)
+			}
+			Expect(guids).To(ConsistOf("guid-1", "guid-2"))
+		})
+	})
+
+	Describe("StopContainers", func() {
+		BeforeEach(func() {
+			containerStore.ListReturns([]executor.Container{
+				{Guid: "guid-1", Tags: executor.Tags{"app": "a"}},
+				{Guid: "guid-2", Tags: executor.Tags{"app": "b"}},
+				{Guid: "guid-3", Tags: executor.Tags{"app": "a"}},
+			})
+			containerStore.StopStub = func(logger lager.Logger, traceID, guid string) error {
+				if guid == "guid-3" {
+					return errors.New("boom!")
+				}
+				return nil
+			}
+		})
+
+		It("stops the containers with the selected guids and tags", func() {
+			results := depotClient.StopContainers(logger, "some-trace-id", executor.ContainerSelector{
+				Guids: []string{"guid-2"},
+				Tags:  executor.Tags{"app": "a"},
+			})
+			Expect(results).To(ConsistOf(
+				executor.ContainerResult{Guid: "guid-1"},
+				executor.ContainerResult{Guid: "guid-2"},
+				executor.ContainerResult{Guid: "guid-3", ErrorMsg: "boom!"},
+			))
+
+			Expect(containerStore.StopCallCount()).To(Equal(3))
+			_, traceID, _ := containerStore.StopArgsForCall(0)
+			Expect(traceID).To(Equal("some-trace-id"))
+		})
+	})
+
+	Describe("DeleteContainers", func() {
+		BeforeEach(func() {
+			containerStore.DestroyStub = func(logger lager.Logger, traceID, guid string) error {
+				if guid == "missing-guid" {
+					return executor.ErrContainerNotFound
+				}
+				return nil
+			}
+		})
+
+		It("deletes the containers with the selected guids", func() {
+			results := depotClient.DeleteContainers(logger, "some-trace-id", executor.ContainerSelector{
+				Guids: []string{"guid-1", "missing-guid", "guid-1"},
+			})
+			Expect(results).To(Equal([]executor.ContainerResult{
+				{Guid: "guid-1"},
+				{Guid: "missing-guid", ErrorMsg: executor.ErrContainerNotFound.Error()},
+			}))
+			Expect(containerStore.DestroyCallCount()).To(Equal(2))
+			Expect(containerStore.ListCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("FeatureFlags", func() {
+		It("returns the active feature flags", func() {
+			Expect(depotClient.FeatureFlags(logger)).To(BeEmpty())
+
+			Expect(depotClient.SetFeatureFlag(logger, featureflags.AsyncDeletes, true)).To(Succeed())
+			Expect(depotClient.FeatureFlags(logger)).To(Equal([]string{featureflags.AsyncDeletes}))
+		})
+
+		It("rejects unknown feature flags", func() {
+			err := depotClient.SetFeatureFlag(logger, "bogus", true)
+			Expect(err).To(MatchError(featureflags.ErrUnknownFlag("bogus")))
+		})
 	})
 
 	Describe("UpdateContainer", func() {
@@ -716,6 +1045,136 @@ var _ = Describe("Depot", func() {
 		})
 	})
 
+	Describe("SetTotalResources", func() {
+		var newResources executor.ExecutorResources
+
+		BeforeEach(func() {
+			newResources = executor.NewExecutorResources(2048, 4096, 10)
+		})
+
+		It("updates the container store capacity and the advertised total", func() {
+			Expect(depotClient.SetTotalResources(logger, newResources)).To(Succeed())
+
+			Expect(containerStore.SetTotalResourcesCallCount()).To(Equal(1))
+			_, total := containerStore.SetTotalResourcesArgsForCall(0)
+			Expect(total).To(Equal(newResources))
+			Expect(depotClient.TotalResources(logger)).To(Equal(newResources))
+		})
+
+		Context("when the cell has GPUs", func() {
+			BeforeEach(func() {
+				resources.GPUs = 2
+			})
+
+			It("keeps advertising them", func() {
+				Expect(depotClient.SetTotalResources(logger, newResources)).To(Succeed())
+
+				total, err := depotClient.TotalResources(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(total.GPUs).To(Equal(2))
+			})
+		})
+
+		Context("when the container store rejects the new capacity", func() {
+			BeforeEach(func() {
+				containerStore.SetTotalResourcesReturns(executor.ErrInsufficientResourcesAvailable)
+			})
+
+			It("returns the error and keeps advertising the old capacity", func() {
+				err := depotClient.SetTotalResources(logger, newResources)
+				Expect(err).To(Equal(executor.ErrInsufficientResourcesAvailable))
+				Expect(depotClient.TotalResources(logger)).To(Equal(resources))
+			})
+		})
+	})
+
+	Describe("PlacementTags", func() {
+		It("returns the configured placement tags", func() {
+			Expect(depotClient.PlacementTags(logger)).To(Equal([]string{"some-tag"}))
+		})
+
+		It("replaces the placement tags at runtime", func() {
+			depotClient.SetPlacementTags(logger, []string{"isolation-segment-a", "gpu"})
+			Expect(depotClient.PlacementTags(logger)).To(Equal([]string{"isolation-segment-a", "gpu"}))
+		})
+	})
+
+	Describe("Capabilities", func() {
+		It("returns the capabilities of the cell", func() {
+			Expect(depotClient.Capabilities(logger)).To(Equal(executor.CellCapabilities{
+				CPUFeatures:   []string{"avx2"},
+				GPUs:          1,
+				CgroupVersion: 2,
+			}))
+		})
+	})
+
+	Describe("ScheduledTaskResults", func() {
+		It("returns nothing when no tasks are scheduled", func() {
+			Expect(depotClient.ScheduledTaskResults(logger)).To(BeEmpty())
+		})
+
+		Context("when tasks are scheduled", func() {
+			BeforeEach(func() {
+				scheduledTasks = scheduledTaskResults{{Name: "log-rotation", Guid: "some-guid", Failed: true}}
+			})
+
+			It("returns their results", func() {
+				Expect(depotClient.ScheduledTaskResults(logger)).To(Equal([]executor.ScheduledTaskResult{
+					{Name: "log-rotation", Guid: "some-guid", Failed: true},
+				}))
+			})
+		})
+	})
+
+	Describe("SubscribeToEvents", func() {
+		It("subscribes to the hub with the options", func() {
+			source := &fakes.FakeEventSource{}
+			eventHub.SubscribeReturns(source, nil)
+
+			subscribed, err := depotClient.SubscribeToEvents(logger, executor.WithContainerGuids("some-guid"), executor.WithReplay(10))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(subscribed).To(Equal(source))
+
+			Expect(eventHub.SubscribeCallCount()).To(Equal(1))
+			Expect(executor.NewEventSubscription(eventHub.SubscribeArgsForCall(0)...)).To(Equal(executor.EventSubscription{
+				ContainerGuids: []string{"some-guid"},
+				Replay:         10,
+			}))
+		})
+	})
+
+	Describe("PrefetchArtifacts", func() {
+		artifacts := []executor.PrefetchArtifact{
+			{From: "http://example.com/buildpack.zip", CacheKey: "buildpack"},
+		}
+
+		It("is not supported when prefetching is disabled", func() {
+			Expect(depotClient.PrefetchArtifacts(logger, artifacts)).To(MatchError(executor.ErrPrefetchNotSupported))
+			Expect(depotClient.PrefetchProgress(logger)).To(Equal(executor.PrefetchProgress{}))
+		})
+
+		Context("when prefetching is enabled", func() {
+			var fakePrefetcher *artifactPrefetcher
+
+			BeforeEach(func() {
+				fakePrefetcher = &artifactPrefetcher{
+					progress: executor.PrefetchProgress{Total: 1, Fetched: 1},
+				}
+				prefetcher = fakePrefetcher
+			})
+
+			It("submits the manifest to the prefetcher", func() {
+				Expect(depotClient.PrefetchArtifacts(logger, artifacts)).To(Succeed())
+				Expect(fakePrefetcher.submitted).To(Equal(artifacts))
+			})
+
+			It("returns the progress of the prefetcher", func() {
+				Expect(depotClient.PrefetchProgress(logger)).To(Equal(executor.PrefetchProgress{Total: 1, Fetched: 1}))
+			})
+		})
+	})
+
 	Describe("VolumeDrivers", func() {
 		Context("when getting volume drivers succeeds", func() {
 			BeforeEach(func() {
@@ -781,3 +1240,35 @@ func newRunningContainer(req *executor.RunRequest, res executor.Resource) execut
 	c.RunInfo = req.RunInfo
 	return c
 }
+
+type scheduledTaskResults []executor.ScheduledTaskResult
+
+func (r scheduledTaskResults) Results() []executor.ScheduledTaskResult {
+	return r
+}
+
+type artifactPrefetcher struct {
+	submitted []executor.PrefetchArtifact
+	progress  executor.PrefetchProgress
+}
+
+func (p *artifactPrefetcher) Submit(_ lager.Logger, artifacts []executor.PrefetchArtifact) error {
+	p.submitted = artifacts
+	return nil
+}
+
+func (p *artifactPrefetcher) Progress() executor.PrefetchProgress {
+	return p.progress
+}
+
+type containerDrainer struct {
+	traceID  string
+	deadline time.Duration
+	err      error
+}
+
+func (d *containerDrainer) Drain(_ lager.Logger, traceID string, deadline time.Duration) error {
+	d.traceID = traceID
+	d.deadline = deadline
+	return d.err
+}
@@ -0,0 +1,208 @@
+package drain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/executor/depot/event"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// PollInterval is how often the drainer checks whether the containers it
+// stopped have completed.
+const PollInterval = time.Second
+
+// DefaultStopOrder stops tasks before LRPs.
+var DefaultStopOrder = []string{executor.TaskLifecycle, executor.LRPLifecycle}
+
+// Drainer stops the containers of a draining cell in waves. There is a wave
+// per lifecycle of the stop order, except for LRPs, which are stopped in a
+// wave per instance index, lowest first. Containers of other lifecycles are
+// stopped last. Each wave is stopped once the previous one has completed, and
+// all of them are stopped at once when the deadline passes.
+type Drainer struct {
+	clock          clock.Clock
+	containerStore containerstore.ContainerStore
+	eventHub       event.Hub
+	stopOrder      []string
+}
+
+func New(
+	clock clock.Clock,
+	containerStore containerstore.ContainerStore,
+	eventHub event.Hub,
+	stopOrder []string,
+) *Drainer {
+	if len(stopOrder) == 0 {
+		stopOrder = DefaultStopOrder
+	}
+
+	return &Drainer{
+		clock:          clock,
+		containerStore: containerStore,
+		eventHub:       eventHub,
+		stopOrder:      stopOrder,
+	}
+}
+
+type wave struct {
+	name  string
+	guids []string
+}
+
+// Drain stops the containers and waits for them to complete. It returns
+// ErrDrainDeadlineExceeded if they have not completed within deadline.
+func (d *Drainer) Drain(logger lager.Logger, traceID string, deadline time.Duration) error {
+	logger = logger.Session("drain-containers", lager.Data{"deadline": deadline.String()})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	waves := d.waves(d.containerStore.List(logger))
+	total := 0
+	for _, w := range waves {
+		total += len(w.guids)
+	}
+
+	timer := d.clock.NewTimer(deadline)
+	defer timer.Stop()
+
+	stopped := 0
+	d.eventHub.Emit(executor.CellDrainProgressEvent{Stopped: stopped, Total: total})
+
+	for i, w := range waves {
+		logger.Info("stopping-wave", lager.Data{"wave": w.name, "containers": len(w.guids)})
+		d.stop(logger, traceID, w.guids)
+
+		if !d.wait(logger, w.guids, timer.C()) {
+			for _, remaining := range waves[i+1:] {
+				d.stop(logger, traceID, remaining.guids)
+			}
+			logger.Error("deadline-exceeded", executor.ErrDrainDeadlineExceeded, lager.Data{"wave": w.name})
+			d.eventHub.Emit(executor.CellDrainProgressEvent{
+				Wave:             w.name,
+				Stopped:          stopped,
+				Total:            total,
+				Done:             true,
+				DeadlineExceeded: true,
+			})
+			return executor.ErrDrainDeadlineExceeded
+		}
+
+		stopped += len(w.guids)
+		d.eventHub.Emit(executor.CellDrainProgressEvent{Wave: w.name, Stopped: stopped, Total: total})
+	}
+
+	d.eventHub.Emit(executor.CellDrainProgressEvent{Stopped: stopped, Total: total, Done: true})
+	return nil
+}
+
+// waves groups the containers that have not completed yet in the order in
+// which they are stopped.
+func (d *Drainer) waves(containers []executor.Container) []wave {
+	byLifecycle := map[string][]executor.Container{}
+	for _, container := range containers {
+		if container.State == executor.StateCompleted {
+			continue
+		}
+		lifecycle := container.Tags[executor.LifecycleTag]
+		if !d.ordered(lifecycle) {
+			lifecycle = ""
+		}
+		byLifecycle[lifecycle] = append(byLifecycle[lifecycle], container)
+	}
+
+	// containers of other lifecycles are grouped under the empty lifecycle
+	order := make([]string, 0, len(d.stopOrder)+1)
+	order = append(order, d.stopOrder...)
+	order = append(order, "")
+
+	waves := []wave{}
+	for _, lifecycle := range order {
+		containers := byLifecycle[lifecycle]
+		if len(containers) == 0 {
+			continue
+		}
+
+		if lifecycle != executor.LRPLifecycle {
+			name := lifecycle
+			if name == "" {
+				name = "other"
+			}
+			waves = append(waves, wave{name: name, guids: guidsOf(containers)})
+			continue
+		}
+
+		sort.SliceStable(containers, func(i, j int) bool {
+			return containers[i].MetricsConfig.Index < containers[j].MetricsConfig.Index
+		})
+		for len(containers) > 0 {
+			index := containers[0].MetricsConfig.Index
+			n := 1
+			for n < len(containers) && containers[n].MetricsConfig.Index == index {
+				n++
+			}
+			waves = append(waves, wave{name: fmt.Sprintf("%s/%d", lifecycle, index), guids: guidsOf(containers[:n])})
+			containers = containers[n:]
+		}
+	}
+	return waves
+}
+
+func (d *Drainer) ordered(lifecycle string) bool {
+	for _, l := range d.stopOrder {
+		if l == lifecycle {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Drainer) stop(logger lager.Logger, traceID string, guids []string) {
+	for _, guid := range guids {
+		err := d.containerStore.Stop(logger, traceID, guid)
+		if err != nil && err != executor.ErrContainerNotFound {
+			logger.Error("failed-to-stop-container", err, lager.Data{"guid": guid})
+		}
+	}
+}
+
+// wait polls the containers until they have all completed or been deleted,
+// or until deadline fires, in which case it returns false.
+func (d *Drainer) wait(logger lager.Logger, guids []string, deadline <-chan time.Time) bool {
+	ticker := d.clock.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if d.completed(logger, guids) {
+			return true
+		}
+
+		select {
+		case <-ticker.C():
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func (d *Drainer) completed(logger lager.Logger, guids []string) bool {
+	for _, guid := range guids {
+		container, err := d.containerStore.Get(logger, guid)
+		if err == nil && container.State != executor.StateCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+func guidsOf(containers []executor.Container) []string {
+	guids := make([]string, len(containers))
+	for i, container := range containers {
+		guids[i] = container.Guid
+	}
+	return guids
+}
@@ -0,0 +1,202 @@
+package drain_test
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/containerstore/containerstorefakes"
+	"code.cloudfoundry.org/executor/depot/drain"
+	efakes "code.cloudfoundry.org/executor/depot/event/fakes"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Drainer", func() {
+	var (
+		logger         *lagertest.TestLogger
+		fakeClock      *fakeclock.FakeClock
+		containerStore *containerstorefakes.FakeContainerStore
+		eventHub       *efakes.FakeHub
+		stopOrder      []string
+		drainer        *drain.Drainer
+
+		lock         sync.Mutex
+		states       map[string]executor.State
+		stopped      []string
+		autoComplete bool
+	)
+
+	container := func(guid string, lifecycle string, index int) executor.Container {
+		c := executor.Container{Guid: guid, State: executor.StateRunning, Tags: executor.Tags{}}
+		if lifecycle != "" {
+			c.Tags[executor.LifecycleTag] = lifecycle
+		}
+		c.MetricsConfig.Index = index
+		return c
+	}
+
+	complete := func(guids ...string) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, guid := range guids {
+			states[guid] = executor.StateCompleted
+		}
+	}
+
+	stoppedGuids := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, stopped...)
+	}
+
+	progress := func() []executor.CellDrainProgressEvent {
+		events := []executor.CellDrainProgressEvent{}
+		for i := 0; i < eventHub.EmitCallCount(); i++ {
+			events = append(events, eventHub.EmitArgsForCall(i).(executor.CellDrainProgressEvent))
+		}
+		return events
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		containerStore = &containerstorefakes.FakeContainerStore{}
+		eventHub = &efakes.FakeHub{}
+		stopOrder = nil
+
+		states = map[string]executor.State{}
+		stopped = nil
+		autoComplete = false
+
+		completed := container("completed-task", executor.TaskLifecycle, 0)
+		completed.State = executor.StateCompleted
+		containerStore.ListReturns([]executor.Container{
+			container("lrp-a-1", executor.LRPLifecycle, 1),
+			container("other", "", 0),
+			container("lrp-a-0", executor.LRPLifecycle, 0),
+			container("task", executor.TaskLifecycle, 0),
+			container("lrp-b-0", executor.LRPLifecycle, 0),
+			completed,
+		})
+		containerStore.StopStub = func(_ lager.Logger, _ string, guid string) error {
+			lock.Lock()
+			defer lock.Unlock()
+			stopped = append(stopped, guid)
+			if autoComplete {
+				states[guid] = executor.StateCompleted
+			}
+			return nil
+		}
+		containerStore.GetStub = func(_ lager.Logger, guid string) (executor.Container, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			state, ok := states[guid]
+			if !ok {
+				state = executor.StateRunning
+			}
+			return executor.Container{Guid: guid, State: state}, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		drainer = drain.New(fakeClock, containerStore, eventHub, stopOrder)
+	})
+
+	Context("when the containers stop right away", func() {
+		BeforeEach(func() {
+			autoComplete = true
+		})
+
+		It("stops tasks, then LRPs by index, then the other containers", func() {
+			Expect(drainer.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+			Expect(stoppedGuids()).To(Equal([]string{"task", "lrp-a-0", "lrp-b-0", "lrp-a-1", "other"}))
+
+			_, traceID, _ := containerStore.StopArgsForCall(0)
+			Expect(traceID).To(Equal("some-trace-id"))
+		})
+
+		It("emits the progress of the drain", func() {
+			Expect(drainer.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+			Expect(progress()).To(Equal([]executor.CellDrainProgressEvent{
+				{Stopped: 0, Total: 5},
+				{Wave: "task", Stopped: 1, Total: 5},
+				{Wave: "lrp/0", Stopped: 3, Total: 5},
+				{Wave: "lrp/1", Stopped: 4, Total: 5},
+				{Wave: "other", Stopped: 5, Total: 5},
+				{Stopped: 5, Total: 5, Done: true},
+			}))
+		})
+
+		Context("when the stop order is configured", func() {
+			BeforeEach(func() {
+				stopOrder = []string{executor.LRPLifecycle, executor.TaskLifecycle}
+			})
+
+			It("stops the containers in that order", func() {
+				Expect(drainer.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+				Expect(stoppedGuids()).To(Equal([]string{"lrp-a-0", "lrp-b-0", "lrp-a-1", "task", "other"}))
+			})
+		})
+
+		Context("when a container is deleted while draining", func() {
+			BeforeEach(func() {
+				autoComplete = false
+				containerStore.GetReturns(executor.Container{}, executor.ErrContainerNotFound)
+				containerStore.GetStub = nil
+			})
+
+			It("does not wait for it", func() {
+				Expect(drainer.Drain(logger, "some-trace-id", time.Minute)).To(Succeed())
+				Expect(stoppedGuids()).To(HaveLen(5))
+			})
+		})
+	})
+
+	Context("when the containers take a while to stop", func() {
+		var errCh chan error
+
+		JustBeforeEach(func() {
+			errCh = make(chan error, 1)
+			go func() {
+				errCh <- drainer.Drain(logger, "some-trace-id", time.Minute)
+			}()
+		})
+
+		It("waits for a wave to complete before stopping the next one", func() {
+			Eventually(stoppedGuids).Should(Equal([]string{"task"}))
+
+			fakeClock.WaitForNWatchersAndIncrement(drain.PollInterval, 2)
+			Consistently(stoppedGuids).Should(Equal([]string{"task"}))
+
+			complete("task")
+			fakeClock.WaitForNWatchersAndIncrement(drain.PollInterval, 2)
+			Eventually(stoppedGuids).Should(Equal([]string{"task", "lrp-a-0", "lrp-b-0"}))
+
+			complete("lrp-a-0", "lrp-b-0", "lrp-a-1", "other")
+			fakeClock.WaitForNWatchersAndIncrement(drain.PollInterval, 2)
+			Eventually(errCh).Should(Receive(BeNil()))
+		})
+
+		Context("when the deadline passes", func() {
+			It("stops the remaining containers at once", func() {
+				Eventually(stoppedGuids).Should(Equal([]string{"task"}))
+
+				fakeClock.WaitForNWatchersAndIncrement(time.Minute, 2)
+				Eventually(errCh).Should(Receive(Equal(executor.ErrDrainDeadlineExceeded)))
+				Expect(stoppedGuids()).To(Equal([]string{"task", "lrp-a-0", "lrp-b-0", "lrp-a-1", "other"}))
+
+				events := progress()
+				Expect(events[len(events)-1]).To(Equal(executor.CellDrainProgressEvent{
+					Wave:             "task",
+					Total:            5,
+					Done:             true,
+					DeadlineExceeded: true,
+				}))
+			})
+		})
+	})
+})
@@ -24,9 +24,10 @@ type FakeHub struct {
 	emitArgsForCall []struct {
 		arg1 executor.Event
 	}
-	SubscribeStub        func() (executor.EventSource, error)
+	SubscribeStub        func(...executor.SubscribeOption) (executor.EventSource, error)
 	subscribeMutex       sync.RWMutex
 	subscribeArgsForCall []struct {
+		arg1 []executor.SubscribeOption
 	}
 	subscribeReturns struct {
 		result1 executor.EventSource
@@ -125,17 +126,18 @@ func (fake *FakeHub) EmitArgsForCall(i int) executor.Event {
 	return argsForCall.arg1
 }
 
-func (fake *FakeHub) Subscribe() (executor.EventSource, error) {
+func (fake *FakeHub) Subscribe(arg1 ...executor.SubscribeOption) (executor.EventSource, error) {
 	fake.subscribeMutex.Lock()
 	ret, specificReturn := fake.subscribeReturnsOnCall[len(fake.subscribeArgsForCall)]
 	fake.subscribeArgsForCall = append(fake.subscribeArgsForCall, struct {
-	}{})
+		arg1 []executor.SubscribeOption
+	}{arg1})
 	stub := fake.SubscribeStub
 	fakeReturns := fake.subscribeReturns
-	fake.recordInvocation("Subscribe", []interface{}{})
+	fake.recordInvocation("Subscribe", []interface{}{arg1})
 	fake.subscribeMutex.Unlock()
 	if stub != nil {
-		return stub()
+		return stub(arg1...)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -149,12 +151,19 @@ func (fake *FakeHub) SubscribeCallCount() int {
 	return len(fake.subscribeArgsForCall)
 }
 
-func (fake *FakeHub) SubscribeCalls(stub func() (executor.EventSource, error)) {
+func (fake *FakeHub) SubscribeCalls(stub func(...executor.SubscribeOption) (executor.EventSource, error)) {
 	fake.subscribeMutex.Lock()
 	defer fake.subscribeMutex.Unlock()
 	fake.SubscribeStub = stub
 }
 
+func (fake *FakeHub) SubscribeArgsForCall(i int) []executor.SubscribeOption {
+	fake.subscribeMutex.RLock()
+	defer fake.subscribeMutex.RUnlock()
+	argsForCall := fake.subscribeArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeHub) SubscribeReturns(result1 executor.EventSource, result2 error) {
 	fake.subscribeMutex.Lock()
 	defer fake.subscribeMutex.Unlock()
@@ -1,16 +1,22 @@
 package event
 
 import (
+	"sync"
+
 	"code.cloudfoundry.org/eventhub"
 	"code.cloudfoundry.org/executor"
 )
 
 const SUBSCRIBER_BUFFER = 1024
 
+// REPLAY_BUFFER is the number of recent events that are kept to be replayed
+// to new subscribers.
+const REPLAY_BUFFER = 1024
+
 //go:generate counterfeiter -o fakes/fake_hub.go . Hub
 type Hub interface {
 	Emit(executor.Event)
-	Subscribe() (executor.EventSource, error)
+	Subscribe(opts ...executor.SubscribeOption) (executor.EventSource, error)
 	Close() error
 }
 
@@ -22,18 +28,58 @@ func NewHub() Hub {
 
 type hub struct {
 	rawHub eventhub.Hub
+
+	// recentLock orders Emit and Subscribe, so that a subscriber receives
+	// every event either as a replayed or as a live event, but not both
+	recentLock sync.Mutex
+	recent     []executor.Event
 }
 
-func (hub *hub) Subscribe() (executor.EventSource, error) {
+func (hub *hub) Subscribe(opts ...executor.SubscribeOption) (executor.EventSource, error) {
+	subscription := executor.NewEventSubscription(opts...)
+
+	hub.recentLock.Lock()
+	defer hub.recentLock.Unlock()
+
 	rawSource, err := hub.rawHub.Subscribe()
 	if err != nil {
 		return nil, err
 	}
 
-	return executorSource{rawSource}, nil
+	return &executorSource{
+		rawSource:    rawSource,
+		subscription: subscription,
+		replay:       hub.replay(subscription),
+	}, nil
+}
+
+// replay returns the most recent events selected by the subscription, oldest
+// first.
+func (hub *hub) replay(subscription executor.EventSubscription) []executor.Event {
+	if subscription.Replay <= 0 {
+		return nil
+	}
+
+	replay := []executor.Event{}
+	for i := len(hub.recent) - 1; i >= 0 && len(replay) < subscription.Replay; i-- {
+		if subscription.Matches(hub.recent[i]) {
+			replay = append(replay, hub.recent[i])
+		}
+	}
+	for i, j := 0, len(replay)-1; i < j; i, j = i+1, j-1 {
+		replay[i], replay[j] = replay[j], replay[i]
+	}
+	return replay
 }
 
 func (hub *hub) Emit(ev executor.Event) {
+	hub.recentLock.Lock()
+	defer hub.recentLock.Unlock()
+
+	hub.recent = append(hub.recent, ev)
+	if len(hub.recent) > REPLAY_BUFFER {
+		hub.recent = hub.recent[len(hub.recent)-REPLAY_BUFFER:]
+	}
 	hub.rawHub.Emit(ev)
 }
 
@@ -42,18 +88,30 @@ func (hub *hub) Close() error {
 }
 
 type executorSource struct {
-	rawSource eventhub.Source
+	rawSource    eventhub.Source
+	subscription executor.EventSubscription
+	replay       []executor.Event
 }
 
-func (source executorSource) Next() (executor.Event, error) {
-	ev, err := source.rawSource.Next()
-	if err != nil {
-		return nil, err
+func (source *executorSource) Next() (executor.Event, error) {
+	if len(source.replay) > 0 {
+		ev := source.replay[0]
+		source.replay = source.replay[1:]
+		return ev, nil
 	}
 
-	return ev.(executor.Event), nil
+	for {
+		ev, err := source.rawSource.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if source.subscription.Matches(ev.(executor.Event)) {
+			return ev.(executor.Event), nil
+		}
+	}
 }
 
-func (source executorSource) Close() error {
+func (source *executorSource) Close() error {
 	return source.rawSource.Close()
 }
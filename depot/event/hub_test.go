@@ -0,0 +1,92 @@
+package event_test
+
+import (
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hub", func() {
+	var (
+		hub event.Hub
+
+		reserved executor.Event
+		running  executor.Event
+		other    executor.Event
+	)
+
+	BeforeEach(func() {
+		hub = event.NewHub()
+
+		reserved = executor.NewContainerReservedEvent(executor.Container{Guid: "some-guid"}, "trace-id")
+		running = executor.NewContainerRunningEvent(executor.Container{Guid: "some-guid"}, "trace-id")
+		other = executor.NewContainerRunningEvent(executor.Container{Guid: "other-guid"}, "trace-id")
+	})
+
+	AfterEach(func() {
+		Expect(hub.Close()).To(Succeed())
+	})
+
+	next := func(source executor.EventSource) executor.Event {
+		ev, err := source.Next()
+		Expect(err).NotTo(HaveOccurred())
+		return ev
+	}
+
+	It("delivers the events emitted after subscribing", func() {
+		hub.Emit(reserved)
+
+		source, err := hub.Subscribe()
+		Expect(err).NotTo(HaveOccurred())
+
+		hub.Emit(running)
+		Expect(next(source)).To(Equal(running))
+	})
+
+	It("filters the events by container guid", func() {
+		source, err := hub.Subscribe(executor.WithContainerGuids("other-guid"))
+		Expect(err).NotTo(HaveOccurred())
+
+		hub.Emit(running)
+		hub.Emit(other)
+		Expect(next(source)).To(Equal(other))
+	})
+
+	It("filters the events by type", func() {
+		source, err := hub.Subscribe(executor.WithEventTypes(executor.EventTypeContainerRunning))
+		Expect(err).NotTo(HaveOccurred())
+
+		hub.Emit(reserved)
+		hub.Emit(running)
+		Expect(next(source)).To(Equal(running))
+	})
+
+	It("replays the most recent selected events before the live ones", func() {
+		hub.Emit(reserved)
+		hub.Emit(other)
+		hub.Emit(running)
+
+		source, err := hub.Subscribe(executor.WithContainerGuids("some-guid"), executor.WithReplay(5))
+		Expect(err).NotTo(HaveOccurred())
+
+		live := executor.NewContainerCompleteEvent(executor.Container{Guid: "some-guid"}, "trace-id")
+		hub.Emit(live)
+
+		Expect(next(source)).To(Equal(reserved))
+		Expect(next(source)).To(Equal(running))
+		Expect(next(source)).To(Equal(live))
+	})
+
+	It("replays at most the requested number of events", func() {
+		hub.Emit(reserved)
+		hub.Emit(running)
+
+		source, err := hub.Subscribe(executor.WithReplay(1))
+		Expect(err).NotTo(HaveOccurred())
+
+		hub.Emit(other)
+		Expect(next(source)).To(Equal(running))
+		Expect(next(source)).To(Equal(other))
+	})
+})
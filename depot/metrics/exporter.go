@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	ExporterMetron = "metron"
+	ExporterOTLP   = "otlp"
+
+	UnitMebiBytes    = "MiBy"
+	UnitCount        = "1"
+	UnitMilliseconds = "ms"
+	UnitPercent      = "%"
+	UnitSeconds      = "s"
+
+	otlpMeterName = "code.cloudfoundry.org/executor/depot/metrics"
+)
+
+// Gauge is a metric emitted by the Reporter. Units follow UCUM, as expected
+// by OpenTelemetry.
+type Gauge struct {
+	Name  string
+	Value int
+	Unit  string
+	Tags  map[string]string
+}
+
+//go:generate counterfeiter -o metricsfakes/fake_exporter.go . Exporter
+
+// Exporter pushes the metrics of a report of the Reporter to another
+// metrics backend than metron.
+type Exporter interface {
+	Export(logger lager.Logger, gauges []Gauge) error
+}
+
+type otlpExporter struct {
+	timeout  time.Duration
+	exporter sdkmetric.Exporter
+	reader   *sdkmetric.ManualReader
+	meter    metric.Meter
+
+	lock   sync.Mutex
+	gauges map[string]metric.Int64Gauge
+}
+
+// NewOTLPExporter pushes the metrics to an OpenTelemetry collector over
+// OTLP/gRPC. The connection is not encrypted when tlsConfig is nil.
+func NewOTLPExporter(endpoint string, tlsConfig *tls.Config, timeout time.Duration) (Exporter, error) {
+	options := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(endpoint),
+		otlpmetricgrpc.WithTimeout(timeout),
+	}
+	if tlsConfig == nil {
+		options = append(options, otlpmetricgrpc.WithInsecure())
+	} else {
+		options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	exporter, err := otlpmetricgrpc.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// with delta temporality only the gauges recorded by the last report
+	// are exported, so e.g. GPUs that got released are not reported as
+	// allocated forever
+	reader := sdkmetric.NewManualReader(
+		sdkmetric.WithTemporalitySelector(func(sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		}),
+		sdkmetric.WithAggregationSelector(exporter.Aggregation),
+	)
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", "executor"))),
+	)
+
+	return &otlpExporter{
+		timeout:  timeout,
+		exporter: exporter,
+		reader:   reader,
+		meter:    provider.Meter(otlpMeterName),
+		gauges:   map[string]metric.Int64Gauge{},
+	}, nil
+}
+
+func (e *otlpExporter) Export(logger lager.Logger, gauges []Gauge) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, gauge := range gauges {
+		instrument, err := e.instrument(gauge)
+		if err != nil {
+			logger.Error("failed-to-create-instrument", err, lager.Data{"metric": gauge.Name})
+			continue
+		}
+
+		attributes := make([]attribute.KeyValue, 0, len(gauge.Tags))
+		for k, v := range gauge.Tags {
+			attributes = append(attributes, attribute.String(k, v))
+		}
+		instrument.Record(ctx, int64(gauge.Value), metric.WithAttributes(attributes...))
+	}
+
+	var metrics metricdata.ResourceMetrics
+	err := e.reader.Collect(ctx, &metrics)
+	if err != nil {
+		return err
+	}
+	return e.exporter.Export(ctx, &metrics)
+}
+
+func (e *otlpExporter) instrument(gauge Gauge) (metric.Int64Gauge, error) {
+	if instrument, ok := e.gauges[gauge.Name]; ok {
+		return instrument, nil
+	}
+
+	instrument, err := e.meter.Int64Gauge(gauge.Name, metric.WithUnit(gauge.Unit))
+	if err != nil {
+		return nil, err
+	}
+	e.gauges[gauge.Name] = instrument
+	return instrument, nil
+}
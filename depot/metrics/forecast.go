@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/executor"
+)
+
+const (
+	// the estimates are tagged with the resource, one of memory, disk or
+	// containers; they are -1 when there is no estimate, e.g. because the
+	// remaining capacity did not decrease over the window
+	secondsUntilCapacityExhaustedMetric = "EstimatedSecondsUntilCapacityExhausted"
+
+	noEstimate = -1
+)
+
+type capacitySample struct {
+	at        time.Time
+	remaining executor.ExecutorResources
+}
+
+// CapacityForecaster estimates when the cell runs out of capacity from the
+// rate at which the remaining capacity decreased over a sliding window, so
+// that cells can be provisioned before they are full.
+type CapacityForecaster struct {
+	window time.Duration
+
+	lock    sync.Mutex
+	samples []capacitySample
+}
+
+func NewCapacityForecaster(window time.Duration) *CapacityForecaster {
+	return &CapacityForecaster{
+		window: window,
+	}
+}
+
+// Observe records the remaining capacity at the given time and forgets the
+// samples that fell out of the window.
+func (f *CapacityForecaster) Observe(at time.Time, remaining executor.ExecutorResources) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.samples = append(f.samples, capacitySample{at: at, remaining: remaining})
+
+	cutoff := at.Add(-f.window)
+	expired := 0
+	for expired < len(f.samples)-1 && f.samples[expired].at.Before(cutoff) {
+		expired++
+	}
+	f.samples = f.samples[expired:]
+}
+
+// SecondsUntilExhausted extrapolates the allocations between the oldest and
+// the newest sample of the window. Resources whose remaining capacity did
+// not decrease have no estimate.
+func (f *CapacityForecaster) SecondsUntilExhausted() executor.ExecutorResources {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	estimates := executor.ExecutorResources{
+		MemoryMB:   noEstimate,
+		DiskMB:     noEstimate,
+		Containers: noEstimate,
+	}
+	if len(f.samples) < 2 {
+		return estimates
+	}
+
+	oldest, newest := f.samples[0], f.samples[len(f.samples)-1]
+	elapsed := newest.at.Sub(oldest.at).Seconds()
+	if elapsed <= 0 {
+		return estimates
+	}
+
+	estimates.MemoryMB = secondsUntilExhausted(oldest.remaining.MemoryMB, newest.remaining.MemoryMB, elapsed)
+	estimates.DiskMB = secondsUntilExhausted(oldest.remaining.DiskMB, newest.remaining.DiskMB, elapsed)
+	estimates.Containers = secondsUntilExhausted(oldest.remaining.Containers, newest.remaining.Containers, elapsed)
+	return estimates
+}
+
+func (f *CapacityForecaster) gauges() []Gauge {
+	estimates := f.SecondsUntilExhausted()
+	return []Gauge{
+		{Name: secondsUntilCapacityExhaustedMetric, Value: estimates.MemoryMB, Unit: UnitSeconds, Tags: map[string]string{"resource": "memory"}},
+		{Name: secondsUntilCapacityExhaustedMetric, Value: estimates.DiskMB, Unit: UnitSeconds, Tags: map[string]string{"resource": "disk"}},
+		{Name: secondsUntilCapacityExhaustedMetric, Value: estimates.Containers, Unit: UnitSeconds, Tags: map[string]string{"resource": "containers"}},
+	}
+}
+
+func secondsUntilExhausted(before, after int, elapsed float64) int {
+	allocated := before - after
+	if allocated <= 0 {
+		return noEstimate
+	}
+	if after <= 0 {
+		return 0
+	}
+	return int(float64(after) / (float64(allocated) / elapsed))
+}
@@ -0,0 +1,51 @@
+package metrics_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CapacityForecaster", func() {
+	var (
+		forecaster *metrics.CapacityForecaster
+		start      time.Time
+	)
+
+	BeforeEach(func() {
+		forecaster = metrics.NewCapacityForecaster(time.Minute)
+		start = time.Now()
+	})
+
+	noEstimates := executor.ExecutorResources{MemoryMB: -1, DiskMB: -1, Containers: -1}
+
+	It("has no estimates without enough samples", func() {
+		Expect(forecaster.SecondsUntilExhausted()).To(Equal(noEstimates))
+
+		forecaster.Observe(start, executor.ExecutorResources{MemoryMB: 1024, DiskMB: 2048, Containers: 10})
+		Expect(forecaster.SecondsUntilExhausted()).To(Equal(noEstimates))
+	})
+
+	It("extrapolates the allocation rate over the window", func() {
+		forecaster.Observe(start, executor.ExecutorResources{MemoryMB: 1024, DiskMB: 2048, Containers: 10})
+		forecaster.Observe(start.Add(10*time.Second), executor.ExecutorResources{MemoryMB: 768, DiskMB: 2048, Containers: 9})
+		forecaster.Observe(start.Add(20*time.Second), executor.ExecutorResources{MemoryMB: 512, DiskMB: 2560, Containers: 0})
+
+		Expect(forecaster.SecondsUntilExhausted()).To(Equal(executor.ExecutorResources{
+			MemoryMB:   20,
+			DiskMB:     -1,
+			Containers: 0,
+		}))
+	})
+
+	It("forgets the samples that fell out of the window", func() {
+		forecaster.Observe(start, executor.ExecutorResources{MemoryMB: 2048, DiskMB: 2048, Containers: 10})
+		forecaster.Observe(start.Add(50*time.Second), executor.ExecutorResources{MemoryMB: 1024, DiskMB: 2048, Containers: 10})
+		forecaster.Observe(start.Add(70*time.Second), executor.ExecutorResources{MemoryMB: 1024, DiskMB: 2048, Containers: 10})
+
+		Expect(forecaster.SecondsUntilExhausted()).To(Equal(noEstimates))
+	})
+})
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const gpuMonitorTimeout = 10 * time.Second
+
+//go:generate counterfeiter -o metricsfakes/fake_gpu_monitor.go . GPUMonitor
+
+// GPUMonitor measures the utilization of the GPU devices of the cell, in
+// percent, by device.
+type GPUMonitor interface {
+	Utilization(logger lager.Logger) (map[string]int, error)
+}
+
+type commandGPUMonitor struct {
+	command []string
+}
+
+// NewCommandGPUMonitor returns a GPUMonitor that runs the command on the
+// cell, which prints a line per device with the path of the device and its
+// utilization in percent, separated by a comma or by spaces, e.g.
+//
+//	/dev/nvidia0, 87
+//
+// The command is killed when it takes longer than 10 seconds.
+func NewCommandGPUMonitor(command []string) GPUMonitor {
+	return &commandGPUMonitor{command: command}
+}
+
+func (m *commandGPUMonitor) Utilization(logger lager.Logger) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gpuMonitorTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, m.command[0], m.command[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpu monitor failed: %s", err)
+	}
+
+	utilization := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(strings.ReplaceAll(scanner.Text(), ",", " "))
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid gpu utilization %q", scanner.Text())
+		}
+		percent, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid gpu utilization %q", scanner.Text())
+		}
+		utilization[fields[0]] = percent
+	}
+	return utilization, nil
+}
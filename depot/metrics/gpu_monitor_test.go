@@ -0,0 +1,50 @@
+package metrics_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"code.cloudfoundry.org/executor/depot/metrics"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CommandGPUMonitor", func() {
+	var (
+		logger  *lagertest.TestLogger
+		command string
+	)
+
+	BeforeEach(func() {
+		if runtime.GOOS == "windows" {
+			Skip("the command is a shell script")
+		}
+
+		logger = lagertest.NewTestLogger("test")
+		command = filepath.Join(GinkgoT().TempDir(), "gpu-utilization")
+	})
+
+	It("parses the utilization of each device", func() {
+		Expect(os.WriteFile(command, []byte("#!/bin/sh\necho '/dev/nvidia0, 87'\necho\necho '/dev/nvidia1 3'\n"), 0755)).To(Succeed())
+
+		utilization, err := metrics.NewCommandGPUMonitor([]string{command}).Utilization(logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utilization).To(Equal(map[string]int{"/dev/nvidia0": 87, "/dev/nvidia1": 3}))
+	})
+
+	It("fails on output it cannot parse", func() {
+		Expect(os.WriteFile(command, []byte("#!/bin/sh\necho '/dev/nvidia0, N/A'\n"), 0755)).To(Succeed())
+
+		_, err := metrics.NewCommandGPUMonitor([]string{command}).Utilization(logger)
+		Expect(err).To(MatchError(ContainSubstring("invalid gpu utilization")))
+	})
+
+	It("fails when the command fails", func() {
+		Expect(os.WriteFile(command, []byte("#!/bin/sh\nexit 1\n"), 0755)).To(Succeed())
+
+		_, err := metrics.NewCommandGPUMonitor([]string{command}).Utilization(logger)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1 @@
+package metricsfakes // import "code.cloudfoundry.org/executor/depot/metrics/metricsfakes"
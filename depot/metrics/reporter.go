@@ -1,12 +1,18 @@
 package metrics
 
 import (
+	"encoding/json"
+	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/clockskew"
 	loggregator "code.cloudfoundry.org/go-loggregator/v8"
 	"code.cloudfoundry.org/lager/v3"
 )
@@ -23,13 +29,85 @@ const (
 	allocatedMemoryMetric = "CapacityAllocatedMemory"
 	allocatedDiskMetric   = "CapacityAllocatedDisk"
 
+	// the total capacity is what containers can allocate; the reserved
+	// capacity is set aside for the system on top of it
+	reservedMemoryMetric = "CapacityReservedMemory"
+	reservedDiskMetric   = "CapacityReservedDisk"
+
 	containerUsageMemoryMetric = "ContainerUsageMemory"
 	containerUsageDiskMetric   = "ContainerUsageDisk"
+	containerUsageSwapMetric   = "ContainerUsageSwap"
+
+	// the CPU time is cumulative over the lifetime of the containers; the
+	// entitlement is the CPU time of all containers as a percentage of the
+	// CPU time they are entitled to
+	containerUsageCPUTimeMetric        = "ContainerUsageCPUTime"
+	containerUsageCPUEntitlementMetric = "ContainerUsageCPUEntitlement"
+	containerCPUSpikeCount             = "ContainerCPUSpikeCount"
+
+	// the network traffic is cumulative over the lifetime of the containers,
+	// and only reported when garden reports it
+	containerUsageNetworkRxMetric = "ContainerUsageNetworkRx"
+	containerUsageNetworkTxMetric = "ContainerUsageNetworkTx"
+
+	totalGPUsMetric      = "CapacityTotalGPUs"
+	remainingGPUsMetric  = "CapacityRemainingGPUs"
+	gpuUtilizationMetric = "GPUUtilization"
+
+	// the GPUs of each type, tagged with the type, for cells whose GPU
+	// devices have types
+	totalGPUsByTypeMetric     = "CapacityTotalGPUsByType"
+	remainingGPUsByTypeMetric = "CapacityRemainingGPUsByType"
+
+	totalExclusiveCPUsMetric     = "CapacityTotalExclusiveCPUs"
+	remainingExclusiveCPUsMetric = "CapacityRemainingExclusiveCPUs"
+
+	// cells can run out of container IPs or host ports before they run out
+	// of memory or disk; these are only reported when the pools are tracked
+	totalContainerIPsMetric     = "CapacityTotalContainerIPs"
+	remainingContainerIPsMetric = "CapacityRemainingContainerIPs"
+	totalHostPortsMetric        = "CapacityTotalHostPorts"
+	remainingHostPortsMetric    = "CapacityRemainingHostPorts"
 
 	containerCount         = "ContainerCount"
 	startingContainerCount = "StartingContainerCount"
+
+	// the containers by state and by lifecycle, so that containers stuck in
+	// a state show up; these are -1 when the containers cannot be listed
+	reservedContainerCount     = "ReservedContainerCount"
+	initializingContainerCount = "InitializingContainerCount"
+	createdContainerCount      = "CreatedContainerCount"
+	runningContainerCount      = "RunningContainerCount"
+	completedContainerCount    = "CompletedContainerCount"
+	taskContainerCount         = "TaskContainerCount"
+	lrpContainerCount          = "LRPContainerCount"
+
+	// per container metrics, tagged with the app guid and instance index
+	instanceMemoryMetric  = "InstanceMemory"
+	instanceDiskMetric    = "InstanceDisk"
+	instanceCPUTimeMetric = "InstanceCPUTime"
+	instanceStateMetric   = "InstanceState"
+
+	instanceNetworkRxMetric = "InstanceNetworkRx"
+	instanceNetworkTxMetric = "InstanceNetworkTx"
+
+	// a report is successful when both the bulk metrics and the containers
+	// could be listed; the staleness is the time since the last one, or
+	// since the Reporter started if there was none yet
+	stalenessMetric                     = "MetricsReportStaleness"
+	lastSuccessfulReportTimestampMetric = "LastSuccessfulMetricsReportTimestamp"
+
+	defaultStaleReports = 3
 )
 
+var reportedStates = []executor.State{
+	executor.StateReserved,
+	executor.StateInitializing,
+	executor.StateCreated,
+	executor.StateRunning,
+	executor.StateCompleted,
+}
+
 type ExecutorSource interface {
 	GetBulkMetrics(logger lager.Logger) (map[string]executor.Metrics, error)
 	RemainingResources(lager.Logger) (executor.ExecutorResources, error)
@@ -44,131 +122,497 @@ type Reporter struct {
 	Logger         lager.Logger
 	MetronClient   loggingclient.IngressClient
 	Tags           map[string]string
+	ClockJumps     *clockskew.Detector
+	Reserved       executor.ExecutorResources
+
+	// Exporter, if set, receives the same metrics as metron. MetronClient
+	// may be nil to only export them.
+	Exporter Exporter
+
+	// PerContainer additionally reports the usage and state of each
+	// container with an app guid, for at most PerContainerLimit containers
+	// if it is positive.
+	PerContainer      bool
+	PerContainerLimit int
+
+	// Prefix is prepended to the names of the metrics. If AllowedMetrics is
+	// not empty, only the metrics it names are reported; the metrics named
+	// by DeniedMetrics are never reported. Both name metrics without the
+	// prefix.
+	Prefix         string
+	AllowedMetrics []string
+	DeniedMetrics  []string
+
+	// CapacityChanges, if set, notifies the Reporter when containers are
+	// allocated or deallocated, which reports the capacity metrics right
+	// away. All metrics are still reported every Interval.
+	CapacityChanges CapacityNotifier
+
+	// StaleAfter is how long reports may keep failing before HealthHandler
+	// reports the Reporter as unhealthy. It defaults to three Intervals.
+	StaleAfter time.Duration
+
+	// Forecaster, if set, is fed the remaining capacity of every report and
+	// reports when the cell is estimated to run out of capacity.
+	Forecaster *CapacityForecaster
+
+	// GPUMonitor, if set, measures the utilization of each GPU device, which
+	// is reported tagged with the device and with the guid of the container
+	// it is allocated to.
+	GPUMonitor GPUMonitor
+
+	lock                 sync.Mutex
+	startedAt            time.Time
+	lastSuccessfulReport time.Time
+}
+
+type healthResponse struct {
+	Healthy              bool   `json:"healthy"`
+	LastSuccessfulReport string `json:"last_successful_report,omitempty"`
+	Staleness            string `json:"staleness"`
+}
+
+// CapacityNotifier is implemented by *containerstore.CapacityNotifier.
+type CapacityNotifier interface {
+	Subscribe() <-chan struct{}
+	Unsubscribe(<-chan struct{})
 }
 
 func (reporter *Reporter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	logger := reporter.Logger.Session("metrics-reporter")
 
+	reporter.lock.Lock()
+	reporter.startedAt = reporter.Clock.Now()
+	reporter.lock.Unlock()
+
 	close(ready)
 
 	timer := reporter.Clock.NewTimer(reporter.Interval)
 
+	clockJumps := reporter.ClockJumps.Subscribe()
+	defer reporter.ClockJumps.Unsubscribe(clockJumps)
+
+	var capacityChanges <-chan struct{}
+	if reporter.CapacityChanges != nil {
+		capacityChanges = reporter.CapacityChanges.Subscribe()
+		defer reporter.CapacityChanges.Unsubscribe(capacityChanges)
+	}
+
 	for {
 		select {
 		case <-signals:
 			logger.Info("signalled")
 			return nil
 
+		case jump := <-clockJumps:
+			logger.Info("clock-jump-detected", lager.Data{"skew": jump.Skew.String()})
+			timer.Reset(reporter.Interval)
+
+		case <-capacityChanges:
+			gauges, _, _ := reporter.capacityGauges(logger)
+			reporter.send(logger, gauges)
+
 		case <-timer.C():
-			var allocatedMemoryMB, allocatedDiskMB, containerUsageDiskMB, containerUsageMemoryMB int
+			reporter.report(logger)
+			timer.Reset(reporter.Interval)
+		}
+	}
+}
 
-			remainingCapacity, err := reporter.ExecutorSource.RemainingResources(logger)
-			if err != nil {
-				reporter.Logger.Error("failed-remaining-resources", err)
-				remainingCapacity.Containers = -1
-				remainingCapacity.DiskMB = -1
-				remainingCapacity.MemoryMB = -1
-				allocatedDiskMB = -1
-				allocatedMemoryMB = -1
-			}
+// capacityGauges reports the total, remaining and allocated capacity of the
+// cell, which only takes the allocation lock of the depot.
+func (reporter *Reporter) capacityGauges(logger lager.Logger) ([]Gauge, executor.ExecutorResources, executor.ExecutorResources) {
+	var allocatedMemoryMB, allocatedDiskMB int
 
-			totalCapacity, err := reporter.ExecutorSource.TotalResources(logger)
-			if err != nil {
-				reporter.Logger.Error("failed-total-resources", err)
-				totalCapacity.Containers = -1
-				totalCapacity.DiskMB = -1
-				totalCapacity.MemoryMB = -1
-				allocatedDiskMB = -1
-				allocatedMemoryMB = -1
-			}
+	remainingCapacity, err := reporter.ExecutorSource.RemainingResources(logger)
+	if err != nil {
+		reporter.Logger.Error("failed-remaining-resources", err)
+		remainingCapacity.Containers = -1
+		remainingCapacity.DiskMB = -1
+		remainingCapacity.MemoryMB = -1
+		remainingCapacity.GPUs = -1
+		remainingCapacity.ExclusiveCPUs = -1
+		allocatedDiskMB = -1
+		allocatedMemoryMB = -1
+	}
 
-			if allocatedDiskMB == 0 && allocatedMemoryMB == 0 {
-				allocatedDiskMB = totalCapacity.DiskMB - remainingCapacity.DiskMB
-				allocatedMemoryMB = totalCapacity.MemoryMB - remainingCapacity.MemoryMB
-			}
+	totalCapacity, err := reporter.ExecutorSource.TotalResources(logger)
+	if err != nil {
+		reporter.Logger.Error("failed-total-resources", err)
+		totalCapacity.Containers = -1
+		totalCapacity.DiskMB = -1
+		totalCapacity.MemoryMB = -1
+		allocatedDiskMB = -1
+		allocatedMemoryMB = -1
+	}
 
-			bulkMetrics, err := reporter.ExecutorSource.GetBulkMetrics(logger)
-			if err != nil {
-				reporter.Logger.Error("failed-bulk-metrics", err)
-				containerUsageDiskMB = -1
-				containerUsageMemoryMB = -1
-			} else {
-				containerUsageMemoryMB, containerUsageDiskMB = calculateUsageMetrics(bulkMetrics)
-			}
+	if allocatedDiskMB == 0 && allocatedMemoryMB == 0 {
+		allocatedDiskMB = totalCapacity.DiskMB - remainingCapacity.DiskMB
+		allocatedMemoryMB = totalCapacity.MemoryMB - remainingCapacity.MemoryMB
+	}
 
-			var nContainers, startingCount int
-			containers, err := reporter.ExecutorSource.ListContainers(logger)
-			if err != nil {
-				reporter.Logger.Error("failed-to-list-containers", err)
-				nContainers = -1
-			} else {
-				nContainers = len(containers)
-				for _, c := range containers {
-					if containerIsStarting(c) {
-						startingCount++
-					}
-				}
-			}
+	gauges := []Gauge{
+		{Name: totalMemoryMetric, Value: totalCapacity.MemoryMB, Unit: UnitMebiBytes},
+		{Name: totalDiskMetric, Value: totalCapacity.DiskMB, Unit: UnitMebiBytes},
+		{Name: totalContainersMetric, Value: totalCapacity.Containers, Unit: UnitCount},
+		{Name: remainingMemoryMetric, Value: remainingCapacity.MemoryMB, Unit: UnitMebiBytes},
+		{Name: remainingDiskMetric, Value: remainingCapacity.DiskMB, Unit: UnitMebiBytes},
+		{Name: remainingContainersMetric, Value: remainingCapacity.Containers, Unit: UnitCount},
+		{Name: allocatedMemoryMetric, Value: allocatedMemoryMB, Unit: UnitMebiBytes},
+		{Name: allocatedDiskMetric, Value: allocatedDiskMB, Unit: UnitMebiBytes},
+	}
+	return gauges, totalCapacity, remainingCapacity
+}
 
-			tagOption := loggregator.WithEnvelopeTags(reporter.Tags)
+func (reporter *Reporter) report(logger lager.Logger) {
+	var containerUsageDiskMB, containerUsageMemoryMB, containerUsageSwapMB int
+	var containerUsageCPUTimeMS, containerUsageCPUEntitlement, cpuSpikeCount int
 
-			err = reporter.MetronClient.SendMebiBytes(totalMemoryMetric, totalCapacity.MemoryMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-total-memory-metric", err)
-			}
-			err = reporter.MetronClient.SendMebiBytes(totalDiskMetric, totalCapacity.DiskMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-total-disk-metric", err)
-			}
-			err = reporter.MetronClient.SendMetric(totalContainersMetric, totalCapacity.Containers, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-total-container-metric", err)
-			}
+	gauges, totalCapacity, remainingCapacity := reporter.capacityGauges(logger)
 
-			err = reporter.MetronClient.SendMebiBytes(remainingMemoryMetric, remainingCapacity.MemoryMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-remaining-memory-metric", err)
+	bulkMetrics, err := reporter.ExecutorSource.GetBulkMetrics(logger)
+	if err != nil {
+		reporter.Logger.Error("failed-bulk-metrics", err)
+		containerUsageDiskMB = -1
+		containerUsageMemoryMB = -1
+		containerUsageSwapMB = -1
+		containerUsageCPUTimeMS = -1
+		containerUsageCPUEntitlement = -1
+		cpuSpikeCount = -1
+	} else {
+		containerUsageMemoryMB, containerUsageDiskMB, containerUsageSwapMB = calculateUsageMetrics(bulkMetrics)
+		containerUsageCPUTimeMS, containerUsageCPUEntitlement, cpuSpikeCount = calculateCPUMetrics(bulkMetrics)
+	}
+	bulkMetricsFailed := err != nil
+
+	if reporter.Forecaster != nil {
+		// the remaining capacity is -1 when it could not be determined
+		if remainingCapacity.MemoryMB >= 0 {
+			reporter.Forecaster.Observe(reporter.Clock.Now(), remainingCapacity)
+		}
+		gauges = append(gauges, reporter.Forecaster.gauges()...)
+	}
+
+	var nContainers, startingCount, taskCount, lrpCount int
+	allocatedDevices := map[string]string{}
+	stateCounts := map[executor.State]int{}
+	containers, err := reporter.ExecutorSource.ListContainers(logger)
+	if err != nil {
+		reporter.Logger.Error("failed-to-list-containers", err)
+		nContainers = -1
+		taskCount = -1
+		lrpCount = -1
+		for _, state := range reportedStates {
+			stateCounts[state] = -1
+		}
+	} else {
+		nContainers = len(containers)
+		for _, c := range containers {
+			if containerIsStarting(c) {
+				startingCount++
 			}
-			err = reporter.MetronClient.SendMebiBytes(remainingDiskMetric, remainingCapacity.DiskMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-remaining-disk-metric", err)
+			stateCounts[c.State]++
+			switch c.Tags[executor.LifecycleTag] {
+			case executor.TaskLifecycle:
+				taskCount++
+			case executor.LRPLifecycle:
+				lrpCount++
 			}
-			err = reporter.MetronClient.SendMetric(remainingContainersMetric, remainingCapacity.Containers, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-remaining-containers-metric", err)
+			for _, device := range c.Devices {
+				allocatedDevices[device] = c.Guid
 			}
+		}
+	}
+	listContainersFailed := err != nil
 
-			err = reporter.MetronClient.SendMebiBytes(allocatedMemoryMetric, allocatedMemoryMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-allocated-memory-metric", err)
-			}
-			err = reporter.MetronClient.SendMebiBytes(allocatedDiskMetric, allocatedDiskMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-allocated-disk-metric", err)
+	gauges = append(gauges,
+		Gauge{Name: containerUsageMemoryMetric, Value: containerUsageMemoryMB, Unit: UnitMebiBytes},
+		Gauge{Name: containerUsageDiskMetric, Value: containerUsageDiskMB, Unit: UnitMebiBytes},
+		Gauge{Name: containerUsageSwapMetric, Value: containerUsageSwapMB, Unit: UnitMebiBytes},
+		Gauge{Name: containerUsageCPUTimeMetric, Value: containerUsageCPUTimeMS, Unit: UnitMilliseconds},
+		Gauge{Name: containerUsageCPUEntitlementMetric, Value: containerUsageCPUEntitlement, Unit: UnitPercent},
+		Gauge{Name: containerCPUSpikeCount, Value: cpuSpikeCount, Unit: UnitCount},
+		Gauge{Name: containerCount, Value: nContainers, Unit: UnitCount},
+		Gauge{Name: startingContainerCount, Value: startingCount, Unit: UnitCount},
+		Gauge{Name: reservedContainerCount, Value: stateCounts[executor.StateReserved], Unit: UnitCount},
+		Gauge{Name: initializingContainerCount, Value: stateCounts[executor.StateInitializing], Unit: UnitCount},
+		Gauge{Name: createdContainerCount, Value: stateCounts[executor.StateCreated], Unit: UnitCount},
+		Gauge{Name: runningContainerCount, Value: stateCounts[executor.StateRunning], Unit: UnitCount},
+		Gauge{Name: completedContainerCount, Value: stateCounts[executor.StateCompleted], Unit: UnitCount},
+		Gauge{Name: taskContainerCount, Value: taskCount, Unit: UnitCount},
+		Gauge{Name: lrpContainerCount, Value: lrpCount, Unit: UnitCount},
+	)
+
+	if rxMB, txMB, ok := calculateNetworkMetrics(bulkMetrics); ok {
+		gauges = append(gauges,
+			Gauge{Name: containerUsageNetworkRxMetric, Value: rxMB, Unit: UnitMebiBytes},
+			Gauge{Name: containerUsageNetworkTxMetric, Value: txMB, Unit: UnitMebiBytes},
+		)
+	}
+
+	if reporter.Reserved.MemoryMB > 0 || reporter.Reserved.DiskMB > 0 {
+		gauges = append(gauges,
+			Gauge{Name: reservedMemoryMetric, Value: reporter.Reserved.MemoryMB, Unit: UnitMebiBytes},
+			Gauge{Name: reservedDiskMetric, Value: reporter.Reserved.DiskMB, Unit: UnitMebiBytes},
+		)
+	}
+
+	if totalCapacity.GPUs > 0 {
+		gauges = append(gauges, reporter.gpuGauges(logger, totalCapacity, remainingCapacity, allocatedDevices)...)
+	}
+
+	if totalCapacity.ExclusiveCPUs > 0 {
+		gauges = append(gauges,
+			Gauge{Name: totalExclusiveCPUsMetric, Value: totalCapacity.ExclusiveCPUs, Unit: UnitCount},
+			Gauge{Name: remainingExclusiveCPUsMetric, Value: remainingCapacity.ExclusiveCPUs, Unit: UnitCount},
+		)
+	}
+
+	if totalCapacity.ContainerIPs > 0 {
+		gauges = append(gauges,
+			Gauge{Name: totalContainerIPsMetric, Value: totalCapacity.ContainerIPs, Unit: UnitCount},
+			Gauge{Name: remainingContainerIPsMetric, Value: remainingCapacity.ContainerIPs, Unit: UnitCount},
+		)
+	}
+
+	if totalCapacity.HostPorts > 0 {
+		gauges = append(gauges,
+			Gauge{Name: totalHostPortsMetric, Value: totalCapacity.HostPorts, Unit: UnitCount},
+			Gauge{Name: remainingHostPortsMetric, Value: remainingCapacity.HostPorts, Unit: UnitCount},
+		)
+	}
+
+	if reporter.PerContainer && !bulkMetricsFailed {
+		gauges = append(gauges, reporter.instanceGauges(logger, bulkMetrics, containers)...)
+	}
+
+	gauges = append(gauges, reporter.stalenessGauges(!bulkMetricsFailed && !listContainersFailed)...)
+
+	reporter.send(logger, gauges)
+}
+
+// stalenessGauges records the time of the report if it was successful and
+// reports how stale the metrics are. The timestamp is 0 until the first
+// successful report.
+func (reporter *Reporter) stalenessGauges(successful bool) []Gauge {
+	now := reporter.Clock.Now()
+	if successful {
+		reporter.lock.Lock()
+		reporter.lastSuccessfulReport = now
+		reporter.lock.Unlock()
+	}
+
+	lastSuccessfulReport, staleness := reporter.staleness(now)
+	var timestamp int
+	if !lastSuccessfulReport.IsZero() {
+		timestamp = int(lastSuccessfulReport.Unix())
+	}
+
+	return []Gauge{
+		{Name: stalenessMetric, Value: int(staleness.Milliseconds()), Unit: UnitMilliseconds},
+		{Name: lastSuccessfulReportTimestampMetric, Value: timestamp, Unit: UnitSeconds},
+	}
+}
+
+func (reporter *Reporter) staleness(now time.Time) (time.Time, time.Duration) {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+
+	if reporter.lastSuccessfulReport.IsZero() {
+		return time.Time{}, now.Sub(reporter.startedAt)
+	}
+	return reporter.lastSuccessfulReport, now.Sub(reporter.lastSuccessfulReport)
+}
+
+// HealthHandler responds with 200 while the last successful report is at
+// most StaleAfter old, and with 503 otherwise, so that monitoring can tell
+// when the bulk metrics or the containers persistently fail to be listed.
+func (reporter *Reporter) HealthHandler() http.Handler {
+	staleAfter := reporter.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultStaleReports * reporter.Interval
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lastSuccessfulReport, staleness := reporter.staleness(reporter.Clock.Now())
+
+		response := healthResponse{
+			Healthy:   staleness <= staleAfter,
+			Staleness: staleness.String(),
+		}
+		if !lastSuccessfulReport.IsZero() {
+			response.LastSuccessfulReport = lastSuccessfulReport.UTC().Format(time.RFC3339)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !response.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+func (reporter *Reporter) gpuGauges(logger lager.Logger, total, remaining executor.ExecutorResources, allocatedDevices map[string]string) []Gauge {
+	gauges := []Gauge{
+		{Name: totalGPUsMetric, Value: total.GPUs, Unit: UnitCount},
+		{Name: remainingGPUsMetric, Value: remaining.GPUs, Unit: UnitCount},
+	}
+
+	gpuTypes := make([]string, 0, len(total.GPUTypes))
+	for gpuType := range total.GPUTypes {
+		gpuTypes = append(gpuTypes, gpuType)
+	}
+	sort.Strings(gpuTypes)
+	for _, gpuType := range gpuTypes {
+		remainingOfType := remaining.GPUTypes[gpuType]
+		if remaining.GPUs < 0 {
+			remainingOfType = -1
+		}
+		tags := map[string]string{"gpu_type": gpuType}
+		gauges = append(gauges,
+			Gauge{Name: totalGPUsByTypeMetric, Value: total.GPUTypes[gpuType], Unit: UnitCount, Tags: tags},
+			Gauge{Name: remainingGPUsByTypeMetric, Value: remainingOfType, Unit: UnitCount, Tags: tags},
+		)
+	}
+
+	if reporter.GPUMonitor == nil {
+		return gauges
+	}
+	utilization, err := reporter.GPUMonitor.Utilization(logger)
+	if err != nil {
+		logger.Error("failed-to-measure-gpu-utilization", err)
+		return gauges
+	}
+	devices := make([]string, 0, len(utilization))
+	for device := range utilization {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		tags := map[string]string{"device": device}
+		if guid, ok := allocatedDevices[device]; ok {
+			tags["container_guid"] = guid
+		}
+		gauges = append(gauges, Gauge{Name: gpuUtilizationMetric, Value: utilization[device], Unit: UnitPercent, Tags: tags})
+	}
+	return gauges
+}
+
+// instanceGauges reports the usage and state of the containers with an app
+// guid, in the order of their guids so that the same containers are reported
+// when there are more than PerContainerLimit.
+func (reporter *Reporter) instanceGauges(logger lager.Logger, bulkMetrics map[string]executor.Metrics, containers []executor.Container) []Gauge {
+	states := map[string]executor.State{}
+	for _, c := range containers {
+		states[c.Guid] = c.State
+	}
+
+	guids := make([]string, 0, len(bulkMetrics))
+	for guid, m := range bulkMetrics {
+		if m.MetricsConfig.Guid != "" {
+			guids = append(guids, guid)
+		}
+	}
+	sort.Strings(guids)
+
+	if reporter.PerContainerLimit > 0 && len(guids) > reporter.PerContainerLimit {
+		logger.Info("limiting-per-container-metrics", lager.Data{"containers": len(guids), "limit": reporter.PerContainerLimit})
+		guids = guids[:reporter.PerContainerLimit]
+	}
+
+	gauges := make([]Gauge, 0, 4*len(guids))
+	for _, guid := range guids {
+		m := bulkMetrics[guid]
+		tags := map[string]string{
+			"app_guid":       m.MetricsConfig.Guid,
+			"instance_index": strconv.Itoa(m.MetricsConfig.Index),
+		}
+		gauges = append(gauges,
+			Gauge{Name: instanceMemoryMetric, Value: bytesToMebibytes(int(m.MemoryUsageInBytes)), Unit: UnitMebiBytes, Tags: tags},
+			Gauge{Name: instanceDiskMetric, Value: bytesToMebibytes(int(m.DiskUsageInBytes)), Unit: UnitMebiBytes, Tags: tags},
+			Gauge{Name: instanceCPUTimeMetric, Value: int(m.TimeSpentInCPU.Milliseconds()), Unit: UnitMilliseconds, Tags: tags},
+		)
+		if state, ok := states[guid]; ok {
+			stateTags := map[string]string{"state": string(state)}
+			for k, v := range tags {
+				stateTags[k] = v
 			}
+			gauges = append(gauges, Gauge{Name: instanceStateMetric, Value: 1, Unit: UnitCount, Tags: stateTags})
+		}
+		if m.NetworkUsage != nil {
+			gauges = append(gauges,
+				Gauge{Name: instanceNetworkRxMetric, Value: bytesToMebibytes(int(m.NetworkUsage.RxBytes)), Unit: UnitMebiBytes, Tags: tags},
+				Gauge{Name: instanceNetworkTxMetric, Value: bytesToMebibytes(int(m.NetworkUsage.TxBytes)), Unit: UnitMebiBytes, Tags: tags},
+			)
+		}
+	}
+	return gauges
+}
 
-			err = reporter.MetronClient.SendMebiBytes(containerUsageMemoryMetric, containerUsageMemoryMB, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-container-memory-metric", err)
+// send emits the allowed gauges to metron, unless it is disabled, and to the
+// exporter, if any. The prefix is added to the name and the tags of the
+// reporter are added to the tags of each gauge.
+func (reporter *Reporter) send(logger lager.Logger, gauges []Gauge) {
+	gauges = reporter.filter(gauges)
+	for i := range gauges {
+		gauges[i].Name = reporter.Prefix + gauges[i].Name
+		tags := map[string]string{}
+		for k, v := range reporter.Tags {
+			tags[k] = v
+		}
+		for k, v := range gauges[i].Tags {
+			tags[k] = v
+		}
+		gauges[i].Tags = tags
+	}
+
+	if reporter.MetronClient != nil {
+		for _, gauge := range gauges {
+			var err error
+			if gauge.Unit == UnitMebiBytes {
+				err = reporter.MetronClient.SendMebiBytes(gauge.Name, gauge.Value, loggregator.WithEnvelopeTags(gauge.Tags))
+			} else {
+				err = reporter.MetronClient.SendMetric(gauge.Name, gauge.Value, loggregator.WithEnvelopeTags(gauge.Tags))
 			}
-			err = reporter.MetronClient.SendMebiBytes(containerUsageDiskMetric, containerUsageDiskMB, tagOption)
 			if err != nil {
-				logger.Error("failed-to-send-container-disk-metric", err)
+				logger.Error("failed-to-send-metric", err, lager.Data{"metric": gauge.Name})
 			}
+		}
+	}
 
-			err = reporter.MetronClient.SendMetric(containerCount, nContainers, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-container-count-metric", err)
-			}
+	if reporter.Exporter != nil {
+		err := reporter.Exporter.Export(logger, gauges)
+		if err != nil {
+			logger.Error("failed-to-export-metrics", err)
+		}
+	}
+}
 
-			err = reporter.MetronClient.SendMetric(startingContainerCount, startingCount, tagOption)
-			if err != nil {
-				logger.Error("failed-to-send-starting-container-count-metric", err)
-			}
+func (reporter *Reporter) filter(gauges []Gauge) []Gauge {
+	if len(reporter.AllowedMetrics) == 0 && len(reporter.DeniedMetrics) == 0 {
+		return gauges
+	}
 
-			timer.Reset(reporter.Interval)
+	filtered := make([]Gauge, 0, len(gauges))
+	for _, gauge := range gauges {
+		if len(reporter.AllowedMetrics) > 0 && !containsName(reporter.AllowedMetrics, gauge.Name) {
+			continue
+		}
+		if containsName(reporter.DeniedMetrics, gauge.Name) {
+			continue
 		}
+		filtered = append(filtered, gauge)
 	}
+	return filtered
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
 func containerIsStarting(container executor.Container) bool {
@@ -181,11 +625,50 @@ func bytesToMebibytes(bytes int) int {
 	return bytes / 1024 / 1024
 }
 
-func calculateUsageMetrics(metrics map[string]executor.Metrics) (int, int) {
-	var memUsageMB, diskUsageMB int
+func calculateUsageMetrics(metrics map[string]executor.Metrics) (int, int, int) {
+	var memUsageMB, diskUsageMB, swapUsageMB int
 	for _, m := range metrics {
 		memUsageMB += bytesToMebibytes(int(m.MemoryUsageInBytes))
 		diskUsageMB += bytesToMebibytes(int(m.DiskUsageInBytes))
+		swapUsageMB += bytesToMebibytes(int(m.SwapUsageInBytes))
+	}
+	return memUsageMB, diskUsageMB, swapUsageMB
+}
+
+// calculateNetworkMetrics returns the traffic received and sent by all
+// containers in MiB, and false when garden reports it for none of them.
+func calculateNetworkMetrics(metrics map[string]executor.Metrics) (int, int, bool) {
+	var rxMB, txMB int
+	var reported bool
+	for _, m := range metrics {
+		if m.NetworkUsage == nil {
+			continue
+		}
+		reported = true
+		rxMB += bytesToMebibytes(int(m.NetworkUsage.RxBytes))
+		txMB += bytesToMebibytes(int(m.NetworkUsage.TxBytes))
+	}
+	return rxMB, txMB, reported
+}
+
+// calculateCPUMetrics returns the CPU time of all containers in
+// milliseconds, that time as a percentage of their CPU entitlement, and the
+// number of containers that exceed their entitlement.
+func calculateCPUMetrics(metrics map[string]executor.Metrics) (int, int, int) {
+	var cpuTime time.Duration
+	var entitlementNS uint64
+	var spiking int
+	for _, m := range metrics {
+		cpuTime += m.TimeSpentInCPU
+		entitlementNS += m.AbsoluteCPUEntitlementInNanoseconds
+		if uint64(m.TimeSpentInCPU.Nanoseconds()) > m.AbsoluteCPUEntitlementInNanoseconds {
+			spiking++
+		}
+	}
+
+	var entitlementPercent int
+	if entitlementNS > 0 {
+		entitlementPercent = int(uint64(cpuTime.Nanoseconds()) * 100 / entitlementNS)
 	}
-	return memUsageMB, diskUsageMB
+	return int(cpuTime.Milliseconds()), entitlementPercent, spiking
 }
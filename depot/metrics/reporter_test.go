@@ -2,17 +2,22 @@ package metrics_test
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 
 	"code.cloudfoundry.org/clock/fakeclock"
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/metrics"
+	"code.cloudfoundry.org/executor/depot/metrics/metricsfakes"
 	"code.cloudfoundry.org/executor/fakes"
 	loggregator "code.cloudfoundry.org/go-loggregator/v8"
 	"code.cloudfoundry.org/go-loggregator/v8/rpc/loggregator_v2"
@@ -25,13 +30,38 @@ type metricEnvelope struct {
 	tags  map[string]string
 }
 
+type fakeCapacityNotifier struct {
+	changes chan struct{}
+}
+
+func (n *fakeCapacityNotifier) Subscribe() <-chan struct{} {
+	return n.changes
+}
+
+func (n *fakeCapacityNotifier) Unsubscribe(<-chan struct{}) {}
+
 var _ = Describe("Reporter", func() {
 	var (
 		reportInterval   time.Duration
 		executorClient   *fakes.FakeClient
 		fakeClock        *fakeclock.FakeClock
 		fakeMetronClient *mfakes.FakeIngressClient
+		reserved         executor.ExecutorResources
+		gpuMonitor       *metricsfakes.FakeGPUMonitor
+		exporter         *metricsfakes.FakeExporter
+		disableMetron    bool
+
+		perContainer      bool
+		perContainerLimit int
 
+		prefix         string
+		allowedMetrics []string
+		deniedMetrics  []string
+
+		capacityChanges *fakeCapacityNotifier
+		forecaster      *metrics.CapacityForecaster
+
+		runner    *metrics.Reporter
 		reporter  ifrit.Process
 		logger    *lagertest.TestLogger
 		metricMap map[string]metricEnvelope
@@ -45,20 +75,37 @@ var _ = Describe("Reporter", func() {
 
 		fakeClock = fakeclock.NewFakeClock(time.Now())
 		fakeMetronClient = new(mfakes.FakeIngressClient)
+		reserved = executor.ExecutorResources{}
+		gpuMonitor = nil
+		exporter = nil
+		perContainer = false
+		perContainerLimit = 0
+		prefix = ""
+		allowedMetrics = nil
+		deniedMetrics = nil
+		capacityChanges = nil
+		forecaster = nil
+		disableMetron = false
 
 		executorClient.GetBulkMetricsReturns(map[string]executor.Metrics{
 			"container-1": executor.Metrics{
 				MetricsConfig: executor.MetricsConfig{},
 				ContainerMetrics: executor.ContainerMetrics{
-					MemoryUsageInBytes: 256 * 1024 * 1024,
-					DiskUsageInBytes:   800 * 1024 * 1024,
+					MemoryUsageInBytes:                  256 * 1024 * 1024,
+					DiskUsageInBytes:                    800 * 1024 * 1024,
+					SwapUsageInBytes:                    16 * 1024 * 1024,
+					TimeSpentInCPU:                      3 * time.Second,
+					AbsoluteCPUEntitlementInNanoseconds: uint64(2 * time.Second),
 				},
 			},
 			"container-2": executor.Metrics{
 				MetricsConfig: executor.MetricsConfig{},
 				ContainerMetrics: executor.ContainerMetrics{
-					MemoryUsageInBytes: 300 * 1024 * 1024,
-					DiskUsageInBytes:   512 * 1024 * 1024,
+					MemoryUsageInBytes:                  300 * 1024 * 1024,
+					DiskUsageInBytes:                    512 * 1024 * 1024,
+					SwapUsageInBytes:                    8 * 1024 * 1024,
+					TimeSpentInCPU:                      time.Second,
+					AbsoluteCPUEntitlementInNanoseconds: uint64(6 * time.Second),
 				},
 			},
 		}, nil)
@@ -76,10 +123,10 @@ var _ = Describe("Reporter", func() {
 		}, nil)
 
 		executorClient.ListContainersReturns([]executor.Container{
-			{Guid: "container-1", State: executor.StateInitializing},
+			{Guid: "container-1", State: executor.StateInitializing, Tags: executor.Tags{executor.LifecycleTag: executor.TaskLifecycle}},
 			{Guid: "container-2", State: executor.StateReserved},
-			{Guid: "container-3", State: executor.StateCreated},
-			{Guid: "container-4", State: executor.StateRunning},
+			{Guid: "container-3", State: executor.StateCreated, Tags: executor.Tags{executor.LifecycleTag: executor.LRPLifecycle}},
+			{Guid: "container-4", State: executor.StateRunning, Tags: executor.Tags{executor.LifecycleTag: executor.LRPLifecycle}},
 			{Guid: "container-5"},
 		}, nil)
 
@@ -104,14 +151,38 @@ var _ = Describe("Reporter", func() {
 		fakeMetronClient.SendMetricStub = sendStub
 		fakeMetronClient.SendMebiBytesStub = sendStub
 
-		reporter = ifrit.Invoke(&metrics.Reporter{
+		runner = &metrics.Reporter{
 			ExecutorSource: executorClient,
 			Interval:       reportInterval,
 			Clock:          fakeClock,
 			Logger:         logger,
 			MetronClient:   fakeMetronClient,
 			Tags:           map[string]string{"foo": "bar"},
-		})
+			Reserved:       reserved,
+
+			PerContainer:      perContainer,
+			PerContainerLimit: perContainerLimit,
+
+			Prefix:         prefix,
+			AllowedMetrics: allowedMetrics,
+			DeniedMetrics:  deniedMetrics,
+		}
+		if gpuMonitor != nil {
+			runner.GPUMonitor = gpuMonitor
+		}
+		if exporter != nil {
+			runner.Exporter = exporter
+		}
+		if disableMetron {
+			runner.MetronClient = nil
+		}
+		if capacityChanges != nil {
+			runner.CapacityChanges = capacityChanges
+		}
+		if forecaster != nil {
+			runner.Forecaster = forecaster
+		}
+		reporter = ifrit.Invoke(runner)
 		fakeClock.WaitForWatcherAndIncrement(reportInterval)
 
 	})
@@ -122,8 +193,8 @@ var _ = Describe("Reporter", func() {
 	})
 
 	It("reports the current capacity on the given interval", func() {
-		Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
-		Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(4))
+		Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
+		Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
 
 		m.RLock()
 		remainingMemory := metricMap["CapacityRemainingMemory"]
@@ -156,12 +227,33 @@ var _ = Describe("Reporter", func() {
 		Eventually(metricMap["ContainerUsageMemory"].tags).Should(Equal(expectedTags))
 		Eventually(metricMap["ContainerUsageDisk"].value).Should(Equal(1312))
 		Eventually(metricMap["ContainerUsageDisk"].tags).Should(Equal(expectedTags))
+		Eventually(metricMap["ContainerUsageSwap"].value).Should(Equal(24))
+		Eventually(metricMap["ContainerUsageSwap"].tags).Should(Equal(expectedTags))
+
+		Eventually(metricMap["ContainerUsageCPUTime"].value).Should(Equal(4000))
+		Eventually(metricMap["ContainerUsageCPUTime"].tags).Should(Equal(expectedTags))
+		Eventually(metricMap["ContainerUsageCPUEntitlement"].value).Should(Equal(50))
+		Eventually(metricMap["ContainerUsageCPUEntitlement"].tags).Should(Equal(expectedTags))
+		Eventually(metricMap["ContainerCPUSpikeCount"].value).Should(Equal(1))
+		Eventually(metricMap["ContainerCPUSpikeCount"].tags).Should(Equal(expectedTags))
 
 		Eventually(metricMap["ContainerCount"].value).Should(Equal(5))
 		Eventually(metricMap["ContainerCount"].tags).Should(Equal(expectedTags))
 		Eventually(metricMap["StartingContainerCount"].value).Should(Equal(3))
 		Eventually(metricMap["StartingContainerCount"].tags).Should(Equal(expectedTags))
 
+		Eventually(metricMap["ReservedContainerCount"].value).Should(Equal(1))
+		Eventually(metricMap["InitializingContainerCount"].value).Should(Equal(1))
+		Eventually(metricMap["CreatedContainerCount"].value).Should(Equal(1))
+		Eventually(metricMap["RunningContainerCount"].value).Should(Equal(1))
+		Eventually(metricMap["CompletedContainerCount"].value).Should(Equal(0))
+		Eventually(metricMap["TaskContainerCount"].value).Should(Equal(1))
+		Eventually(metricMap["LRPContainerCount"].value).Should(Equal(2))
+		Eventually(metricMap["LRPContainerCount"].tags).Should(Equal(expectedTags))
+
+		Eventually(metricMap["MetricsReportStaleness"].value).Should(Equal(0))
+		Eventually(metricMap["LastSuccessfulMetricsReportTimestamp"].value).Should(Equal(int(fakeClock.Now().Unix())))
+
 		executorClient.GetBulkMetricsReturns(map[string]executor.Metrics{
 			"container-1": executor.Metrics{
 				MetricsConfig: executor.MetricsConfig{},
@@ -194,8 +286,8 @@ var _ = Describe("Reporter", func() {
 
 		m.RUnlock()
 
-		Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(16))
-		Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(8))
+		Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(18))
+		Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(32))
 
 		m.RLock()
 
@@ -210,6 +302,9 @@ var _ = Describe("Reporter", func() {
 
 		Eventually(metricMap["ContainerUsageMemory"].value).Should(Equal(500))
 		Eventually(metricMap["ContainerUsageDisk"].value).Should(Equal(700))
+		Eventually(metricMap["ContainerUsageCPUTime"].value).Should(Equal(0))
+		Eventually(metricMap["ContainerUsageCPUEntitlement"].value).Should(Equal(0))
+		Eventually(metricMap["ContainerCPUSpikeCount"].value).Should(Equal(0))
 
 		Eventually(metricMap["ContainerCount"].value).Should(Equal(2))
 		Eventually(metricMap["StartingContainerCount"].value).Should(Equal(0))
@@ -217,13 +312,282 @@ var _ = Describe("Reporter", func() {
 		m.RUnlock()
 	})
 
+	Context("when the cell has GPUs", func() {
+		BeforeEach(func() {
+			executorClient.TotalResourcesReturns(executor.ExecutorResources{
+				MemoryMB:   1024,
+				DiskMB:     2048,
+				Containers: 4096,
+				GPUs:       2,
+			}, nil)
+			executorClient.RemainingResourcesReturns(executor.ExecutorResources{
+				MemoryMB:   128,
+				DiskMB:     256,
+				Containers: 512,
+				GPUs:       1,
+			}, nil)
+			executorClient.ListContainersReturns([]executor.Container{
+				{Guid: "container-1", State: executor.StateRunning, Devices: []string{"/dev/nvidia1"}},
+				{Guid: "container-2", State: executor.StateRunning},
+			}, nil)
+		})
+
+		It("reports the GPU capacity", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(18))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["CapacityTotalGPUs"].value).To(Equal(2))
+			Expect(metricMap["CapacityRemainingGPUs"].value).To(Equal(1))
+			Expect(metricMap).NotTo(HaveKey("GPUUtilization"))
+		})
+
+		Context("when the cell has a GPU monitor", func() {
+			BeforeEach(func() {
+				exporter = new(metricsfakes.FakeExporter)
+				gpuMonitor = new(metricsfakes.FakeGPUMonitor)
+				gpuMonitor.UtilizationReturns(map[string]int{"/dev/nvidia1": 87, "/dev/nvidia0": 3}, nil)
+			})
+
+			It("reports the utilization of each device with the container it is allocated to", func() {
+				Eventually(exporter.ExportCallCount).Should(BeNumerically(">=", 1))
+				_, gauges := exporter.ExportArgsForCall(0)
+				var utilization []metrics.Gauge
+				for _, gauge := range gauges {
+					if gauge.Name == "GPUUtilization" {
+						utilization = append(utilization, gauge)
+					}
+				}
+
+				Expect(utilization).To(Equal([]metrics.Gauge{
+					{Name: "GPUUtilization", Value: 3, Unit: metrics.UnitPercent, Tags: map[string]string{"foo": "bar", "device": "/dev/nvidia0"}},
+					{Name: "GPUUtilization", Value: 87, Unit: metrics.UnitPercent, Tags: map[string]string{"foo": "bar", "device": "/dev/nvidia1", "container_guid": "container-1"}},
+				}))
+			})
+
+			Context("when the utilization cannot be measured", func() {
+				BeforeEach(func() {
+					gpuMonitor.UtilizationReturns(nil, errors.New("nvidia-smi failed"))
+				})
+
+				It("still reports the GPU capacity", func() {
+					Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(18))
+
+					m.RLock()
+					defer m.RUnlock()
+					Expect(metricMap["CapacityTotalGPUs"].value).To(Equal(2))
+					Expect(metricMap).NotTo(HaveKey("GPUUtilization"))
+				})
+			})
+		})
+	})
+
+	Context("when the GPUs of the cell have types", func() {
+		BeforeEach(func() {
+			exporter = new(metricsfakes.FakeExporter)
+			executorClient.TotalResourcesReturns(executor.ExecutorResources{
+				MemoryMB:   1024,
+				DiskMB:     2048,
+				Containers: 4096,
+				GPUs:       3,
+				GPUTypes:   map[string]int{"a100": 2, "t4": 1},
+			}, nil)
+			executorClient.RemainingResourcesReturns(executor.ExecutorResources{
+				MemoryMB:   128,
+				DiskMB:     256,
+				Containers: 512,
+				GPUs:       2,
+				GPUTypes:   map[string]int{"a100": 1, "t4": 1},
+			}, nil)
+		})
+
+		It("reports the GPU capacity of each type", func() {
+			Eventually(exporter.ExportCallCount).Should(BeNumerically(">=", 1))
+			_, gauges := exporter.ExportArgsForCall(0)
+			var byType []metrics.Gauge
+			for _, gauge := range gauges {
+				if strings.HasSuffix(gauge.Name, "GPUsByType") {
+					byType = append(byType, gauge)
+				}
+			}
+
+			Expect(byType).To(Equal([]metrics.Gauge{
+				{Name: "CapacityTotalGPUsByType", Value: 2, Unit: metrics.UnitCount, Tags: map[string]string{"foo": "bar", "gpu_type": "a100"}},
+				{Name: "CapacityRemainingGPUsByType", Value: 1, Unit: metrics.UnitCount, Tags: map[string]string{"foo": "bar", "gpu_type": "a100"}},
+				{Name: "CapacityTotalGPUsByType", Value: 1, Unit: metrics.UnitCount, Tags: map[string]string{"foo": "bar", "gpu_type": "t4"}},
+				{Name: "CapacityRemainingGPUsByType", Value: 1, Unit: metrics.UnitCount, Tags: map[string]string{"foo": "bar", "gpu_type": "t4"}},
+			}))
+		})
+	})
+
+	Context("when garden reports the network traffic of the containers", func() {
+		BeforeEach(func() {
+			exporter = new(metricsfakes.FakeExporter)
+			perContainer = true
+			executorClient.GetBulkMetricsReturns(map[string]executor.Metrics{
+				"container-1": executor.Metrics{
+					MetricsConfig: executor.MetricsConfig{Guid: "app-1", Index: 0},
+					ContainerMetrics: executor.ContainerMetrics{
+						NetworkUsage: &executor.NetworkUsage{RxBytes: 3 * 1024 * 1024, TxBytes: 1024 * 1024},
+					},
+				},
+				"container-2": executor.Metrics{
+					ContainerMetrics: executor.ContainerMetrics{
+						NetworkUsage: &executor.NetworkUsage{RxBytes: 2 * 1024 * 1024, TxBytes: 4 * 1024 * 1024},
+					},
+				},
+				"container-3": executor.Metrics{},
+			}, nil)
+		})
+
+		It("reports the network usage of the cell and of each app instance", func() {
+			Eventually(exporter.ExportCallCount).Should(BeNumerically(">=", 1))
+			_, gauges := exporter.ExportArgsForCall(0)
+			var network []metrics.Gauge
+			for _, gauge := range gauges {
+				if strings.Contains(gauge.Name, "Network") {
+					network = append(network, gauge)
+				}
+			}
+
+			instanceTags := map[string]string{"foo": "bar", "app_guid": "app-1", "instance_index": "0"}
+			Expect(network).To(ConsistOf(
+				metrics.Gauge{Name: "ContainerUsageNetworkRx", Value: 5, Unit: metrics.UnitMebiBytes, Tags: map[string]string{"foo": "bar"}},
+				metrics.Gauge{Name: "ContainerUsageNetworkTx", Value: 5, Unit: metrics.UnitMebiBytes, Tags: map[string]string{"foo": "bar"}},
+				metrics.Gauge{Name: "InstanceNetworkRx", Value: 3, Unit: metrics.UnitMebiBytes, Tags: instanceTags},
+				metrics.Gauge{Name: "InstanceNetworkTx", Value: 1, Unit: metrics.UnitMebiBytes, Tags: instanceTags},
+			))
+		})
+	})
+
+	Context("when the cell has exclusive CPUs", func() {
+		BeforeEach(func() {
+			executorClient.TotalResourcesReturns(executor.ExecutorResources{
+				MemoryMB:      1024,
+				DiskMB:        2048,
+				Containers:    4096,
+				ExclusiveCPUs: 8,
+			}, nil)
+			executorClient.RemainingResourcesReturns(executor.ExecutorResources{
+				MemoryMB:      128,
+				DiskMB:        256,
+				Containers:    512,
+				ExclusiveCPUs: 6,
+			}, nil)
+		})
+
+		It("reports the exclusive CPU capacity", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(18))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["CapacityTotalExclusiveCPUs"].value).To(Equal(8))
+			Expect(metricMap["CapacityRemainingExclusiveCPUs"].value).To(Equal(6))
+		})
+	})
+
+	Context("when the network and port pools are tracked", func() {
+		BeforeEach(func() {
+			executorClient.TotalResourcesReturns(executor.ExecutorResources{
+				MemoryMB:     1024,
+				DiskMB:       2048,
+				Containers:   4096,
+				ContainerIPs: 250,
+				HostPorts:    5000,
+			}, nil)
+			executorClient.RemainingResourcesReturns(executor.ExecutorResources{
+				MemoryMB:     128,
+				DiskMB:       256,
+				Containers:   512,
+				ContainerIPs: 3,
+				HostPorts:    12,
+			}, nil)
+		})
+
+		It("reports the capacity of the pools", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(20))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["CapacityTotalContainerIPs"].value).To(Equal(250))
+			Expect(metricMap["CapacityRemainingContainerIPs"].value).To(Equal(3))
+			Expect(metricMap["CapacityTotalHostPorts"].value).To(Equal(5000))
+			Expect(metricMap["CapacityRemainingHostPorts"].value).To(Equal(12))
+		})
+	})
+
+	Context("when capacity is reserved for the system", func() {
+		BeforeEach(func() {
+			reserved = executor.ExecutorResources{MemoryMB: 512, DiskMB: 1024}
+		})
+
+		It("reports the reserved capacity next to the allocatable capacity", func() {
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(11))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["CapacityReservedMemory"]).To(Equal(metricEnvelope{value: 512, tags: map[string]string{"foo": "bar"}}))
+			Expect(metricMap["CapacityReservedDisk"]).To(Equal(metricEnvelope{value: 1024, tags: map[string]string{"foo": "bar"}}))
+			Expect(metricMap["CapacityTotalMemory"].value).To(Equal(1024))
+		})
+	})
+
+	Context("when there is an exporter", func() {
+		BeforeEach(func() {
+			exporter = new(metricsfakes.FakeExporter)
+		})
+
+		It("exports the same metrics as it sends to metron", func() {
+			Eventually(exporter.ExportCallCount).Should(Equal(1))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
+
+			_, gauges := exporter.ExportArgsForCall(0)
+			Expect(gauges).To(HaveLen(25))
+			Expect(gauges).To(ContainElement(metrics.Gauge{
+				Name:  "CapacityTotalMemory",
+				Value: 1024,
+				Unit:  metrics.UnitMebiBytes,
+				Tags:  map[string]string{"foo": "bar"},
+			}))
+			Expect(gauges).To(ContainElement(metrics.Gauge{
+				Name:  "ContainerCount",
+				Value: 5,
+				Unit:  metrics.UnitCount,
+				Tags:  map[string]string{"foo": "bar"},
+			}))
+		})
+
+		Context("and metron is disabled", func() {
+			BeforeEach(func() {
+				disableMetron = true
+			})
+
+			It("only exports the metrics", func() {
+				Eventually(exporter.ExportCallCount).Should(Equal(1))
+				Expect(fakeMetronClient.SendMebiBytesCallCount()).To(Equal(0))
+				Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("and exporting fails", func() {
+			BeforeEach(func() {
+				exporter.ExportReturns(errors.New("collector unavailable"))
+			})
+
+			It("still sends the metrics to metron", func() {
+				Eventually(logger).Should(gbytes.Say("failed-to-export-metrics"))
+				Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
+			})
+		})
+	})
+
 	Context("when getting remaining resources fails", func() {
 		BeforeEach(func() {
 			executorClient.RemainingResourcesReturns(executor.ExecutorResources{}, errors.New("oh no!"))
 		})
 
 		It("sends missing remaining resources", func() {
-			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
 
 			m.RLock()
 			Eventually(metricMap["CapacityRemainingMemory"].value).Should(Equal(-1))
@@ -233,7 +597,7 @@ var _ = Describe("Reporter", func() {
 		})
 
 		It("sends missing allocated resources", func() {
-			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
 
 			m.RLock()
 			Eventually(metricMap["CapacityAllocatedMemory"].value).Should(Equal(-1))
@@ -248,7 +612,7 @@ var _ = Describe("Reporter", func() {
 		})
 
 		It("sends missing total resources", func() {
-			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
 
 			m.RLock()
 			Eventually(metricMap["CapacityTotalMemory"].value).Should(Equal(-1))
@@ -258,7 +622,7 @@ var _ = Describe("Reporter", func() {
 		})
 
 		It("sends missing allocated resources", func() {
-			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
 
 			m.RLock()
 			Eventually(metricMap["CapacityAllocatedMemory"].value).Should(Equal(-1))
@@ -273,13 +637,205 @@ var _ = Describe("Reporter", func() {
 		})
 
 		It("reports garden.containers as -1", func() {
-			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(4))
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
 
 			m.RLock()
 			Eventually(metricMap["ContainerCount"].value).Should(Equal(-1))
 			Eventually(metricMap["StartingContainerCount"].value).Should(Equal(0))
+			Eventually(metricMap["RunningContainerCount"].value).Should(Equal(-1))
+			Eventually(metricMap["TaskContainerCount"].value).Should(Equal(-1))
 			m.RUnlock()
 		})
+
+		It("reports the staleness since the reporter started", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["MetricsReportStaleness"].value).To(Equal(1))
+			Expect(metricMap["LastSuccessfulMetricsReportTimestamp"].value).To(Equal(0))
+		})
+	})
+
+	Context("when the capacity changes", func() {
+		BeforeEach(func() {
+			capacityChanges = &fakeCapacityNotifier{changes: make(chan struct{})}
+		})
+
+		It("reports the capacity right away", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
+			Expect(executorClient.RemainingResourcesCallCount()).To(Equal(1))
+
+			executorClient.RemainingResourcesReturns(executor.ExecutorResources{
+				MemoryMB:   64,
+				DiskMB:     128,
+				Containers: 256,
+			}, nil)
+			capacityChanges.changes <- struct{}{}
+
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(15))
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(18))
+			Expect(executorClient.GetBulkMetricsCallCount()).To(Equal(1))
+			Expect(executorClient.ListContainersCallCount()).To(Equal(1))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["CapacityRemainingMemory"].value).To(Equal(64))
+			Expect(metricMap["CapacityAllocatedMemory"].value).To(Equal(960))
+			Expect(metricMap["CapacityRemainingContainers"].value).To(Equal(256))
+		})
+	})
+
+	Context("when the capacity is forecast", func() {
+		BeforeEach(func() {
+			forecaster = metrics.NewCapacityForecaster(time.Minute)
+			forecaster.Observe(fakeClock.Now().Add(-10*time.Second), executor.ExecutorResources{
+				MemoryMB:   128,
+				DiskMB:     256,
+				Containers: 1024,
+			})
+		})
+
+		It("reports the estimated time until the capacity is exhausted", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(19))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap["EstimatedSecondsUntilCapacityExhausted"].value).To(Equal(10))
+			Expect(metricMap["EstimatedSecondsUntilCapacityExhausted"].tags).To(HaveKeyWithValue("resource", "containers"))
+		})
+	})
+
+	Context("when the metric names are prefixed", func() {
+		BeforeEach(func() {
+			prefix = "iso-seg-1."
+		})
+
+		It("reports the metrics with the prefix", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap).To(HaveKey("iso-seg-1.ContainerCount"))
+			Expect(metricMap).NotTo(HaveKey("ContainerCount"))
+		})
+	})
+
+	Context("when only some metrics are allowed", func() {
+		BeforeEach(func() {
+			exporter = new(metricsfakes.FakeExporter)
+			prefix = "iso-seg-1."
+			allowedMetrics = []string{"CapacityTotalMemory", "ContainerCount", "ContainerUsageSwap"}
+			deniedMetrics = []string{"ContainerUsageSwap"}
+		})
+
+		It("only reports the allowed metrics that are not denied", func() {
+			Eventually(exporter.ExportCallCount).Should(Equal(1))
+			_, gauges := exporter.ExportArgsForCall(0)
+
+			var names []string
+			for _, gauge := range gauges {
+				names = append(names, gauge.Name)
+			}
+			Expect(names).To(ConsistOf("iso-seg-1.CapacityTotalMemory", "iso-seg-1.ContainerCount"))
+			Expect(fakeMetronClient.SendMebiBytesCallCount()).To(Equal(1))
+			Expect(fakeMetronClient.SendMetricCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when some metrics are denied", func() {
+		BeforeEach(func() {
+			deniedMetrics = []string{"ContainerUsageSwap", "StartingContainerCount"}
+		})
+
+		It("reports all other metrics", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(15))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
+
+			m.RLock()
+			defer m.RUnlock()
+			Expect(metricMap).NotTo(HaveKey("ContainerUsageSwap"))
+			Expect(metricMap).NotTo(HaveKey("StartingContainerCount"))
+		})
+	})
+
+	Context("when per container metrics are enabled", func() {
+		BeforeEach(func() {
+			exporter = new(metricsfakes.FakeExporter)
+			perContainer = true
+
+			executorClient.GetBulkMetricsReturns(map[string]executor.Metrics{
+				"container-1": executor.Metrics{
+					MetricsConfig: executor.MetricsConfig{Guid: "app-1", Index: 0},
+					ContainerMetrics: executor.ContainerMetrics{
+						MemoryUsageInBytes: 256 * 1024 * 1024,
+						DiskUsageInBytes:   800 * 1024 * 1024,
+						TimeSpentInCPU:     3 * time.Second,
+					},
+				},
+				"container-2": executor.Metrics{
+					MetricsConfig: executor.MetricsConfig{Guid: "app-1", Index: 1},
+					ContainerMetrics: executor.ContainerMetrics{
+						MemoryUsageInBytes: 300 * 1024 * 1024,
+					},
+				},
+				"task-1": executor.Metrics{
+					ContainerMetrics: executor.ContainerMetrics{
+						MemoryUsageInBytes: 100 * 1024 * 1024,
+					},
+				},
+			}, nil)
+		})
+
+		instanceGauges := func() []metrics.Gauge {
+			Eventually(exporter.ExportCallCount).Should(BeNumerically(">=", 1))
+			_, gauges := exporter.ExportArgsForCall(0)
+			var instance []metrics.Gauge
+			for _, gauge := range gauges {
+				if strings.HasPrefix(gauge.Name, "Instance") {
+					instance = append(instance, gauge)
+				}
+			}
+			return instance
+		}
+
+		It("reports the usage and state of each app instance", func() {
+			tags := map[string]string{"foo": "bar", "app_guid": "app-1", "instance_index": "0"}
+			Expect(instanceGauges()).To(ConsistOf(
+				metrics.Gauge{Name: "InstanceMemory", Value: 256, Unit: metrics.UnitMebiBytes, Tags: tags},
+				metrics.Gauge{Name: "InstanceDisk", Value: 800, Unit: metrics.UnitMebiBytes, Tags: tags},
+				metrics.Gauge{Name: "InstanceCPUTime", Value: 3000, Unit: metrics.UnitMilliseconds, Tags: tags},
+				metrics.Gauge{Name: "InstanceState", Value: 1, Unit: metrics.UnitCount, Tags: map[string]string{
+					"foo": "bar", "app_guid": "app-1", "instance_index": "0", "state": "initializing",
+				}},
+				metrics.Gauge{Name: "InstanceMemory", Value: 300, Unit: metrics.UnitMebiBytes, Tags: map[string]string{
+					"foo": "bar", "app_guid": "app-1", "instance_index": "1",
+				}},
+				metrics.Gauge{Name: "InstanceDisk", Value: 0, Unit: metrics.UnitMebiBytes, Tags: map[string]string{
+					"foo": "bar", "app_guid": "app-1", "instance_index": "1",
+				}},
+				metrics.Gauge{Name: "InstanceCPUTime", Value: 0, Unit: metrics.UnitMilliseconds, Tags: map[string]string{
+					"foo": "bar", "app_guid": "app-1", "instance_index": "1",
+				}},
+				metrics.Gauge{Name: "InstanceState", Value: 1, Unit: metrics.UnitCount, Tags: map[string]string{
+					"foo": "bar", "app_guid": "app-1", "instance_index": "1", "state": "reserved",
+				}},
+			))
+		})
+
+		Context("and the number of containers is limited", func() {
+			BeforeEach(func() {
+				perContainerLimit = 1
+			})
+
+			It("only reports the first containers", func() {
+				Expect(instanceGauges()).To(HaveLen(4))
+				for _, gauge := range instanceGauges() {
+					Expect(gauge.Tags).To(HaveKeyWithValue("instance_index", "0"))
+				}
+				Expect(logger).To(gbytes.Say("limiting-per-container-metrics"))
+			})
+		})
 	})
 
 	Context("when getting the bulk metrics fails", func() {
@@ -288,12 +844,57 @@ var _ = Describe("Reporter", func() {
 		})
 
 		It("reports container usage as -1", func() {
-			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(8))
+			Eventually(fakeMetronClient.SendMebiBytesCallCount).Should(Equal(9))
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
 
 			m.RLock()
 			Eventually(metricMap["ContainerUsageDisk"].value).Should(Equal(-1))
 			Eventually(metricMap["ContainerUsageMemory"].value).Should(Equal(-1))
+			Eventually(metricMap["ContainerUsageSwap"].value).Should(Equal(-1))
+			Eventually(metricMap["ContainerUsageCPUTime"].value).Should(Equal(-1))
+			Eventually(metricMap["ContainerUsageCPUEntitlement"].value).Should(Equal(-1))
+			Eventually(metricMap["ContainerCPUSpikeCount"].value).Should(Equal(-1))
 			m.RUnlock()
 		})
 	})
+
+	Describe("HealthHandler", func() {
+		getHealth := func() *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			runner.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			return recorder
+		}
+
+		It("is healthy after a successful report", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
+
+			recorder := getHealth()
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{
+				"healthy": true,
+				"last_successful_report": "` + fakeClock.Now().UTC().Format(time.RFC3339) + `",
+				"staleness": "0s"
+			}`))
+		})
+
+		Context("when the reports keep failing", func() {
+			BeforeEach(func() {
+				executorClient.GetBulkMetricsReturns(nil, errors.New("oh no!"))
+			})
+
+			It("is unhealthy once the metrics are stale for three intervals", func() {
+				Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(16))
+				Expect(getHealth().Code).To(Equal(http.StatusOK))
+
+				fakeClock.WaitForWatcherAndIncrement(reportInterval)
+				fakeClock.WaitForWatcherAndIncrement(reportInterval)
+				Expect(getHealth().Code).To(Equal(http.StatusOK))
+
+				fakeClock.WaitForWatcherAndIncrement(reportInterval)
+				recorder := getHealth()
+				Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(recorder.Body.String()).To(MatchJSON(`{"healthy": false, "staleness": "4ms"}`))
+			})
+		})
+	})
 })
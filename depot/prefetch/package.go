@@ -0,0 +1 @@
+package prefetch // import "code.cloudfoundry.org/executor/depot/prefetch"
@@ -0,0 +1,215 @@
+package prefetch
+
+import (
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cacheddownloader"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Prefetcher fetches the artifacts of a manifest into the download cache of
+// the cell while it is idle, i.e. while no container is downloading its
+// cached dependencies. It shares the download rate limiter of the dependency
+// manager and fetches at most one artifact at a time, so it never takes more
+// than one download slot.
+type Prefetcher struct {
+	logger              lager.Logger
+	clock               clock.Clock
+	cache               cacheddownloader.CachedDownloader
+	downloadRateLimiter chan struct{}
+	interval            time.Duration
+
+	lock     sync.Mutex
+	pending  []executor.PrefetchArtifact
+	progress executor.PrefetchProgress
+
+	// manifest is incremented by Submit, so that fetches of a replaced
+	// manifest do not count towards the progress of the new one
+	manifest int
+}
+
+func New(
+	logger lager.Logger,
+	clock clock.Clock,
+	cache cacheddownloader.CachedDownloader,
+	downloadRateLimiter chan struct{},
+	interval time.Duration,
+) *Prefetcher {
+	return &Prefetcher{
+		logger:              logger.Session("prefetcher"),
+		clock:               clock,
+		cache:               cache,
+		downloadRateLimiter: downloadRateLimiter,
+		interval:            interval,
+	}
+}
+
+// Submit replaces the manifest that is being prefetched. Artifacts that were
+// already fetched stay in the cache until it evicts them.
+func (p *Prefetcher) Submit(logger lager.Logger, artifacts []executor.PrefetchArtifact) error {
+	logger = logger.Session("submit-prefetch-manifest", lager.Data{"artifacts": len(artifacts)})
+
+	for _, artifact := range artifacts {
+		if !validArtifact(artifact) {
+			logger.Error("invalid-artifact", executor.ErrInvalidPrefetchArtifact, lager.Data{"cache-key": artifact.CacheKey})
+			return executor.ErrInvalidPrefetchArtifact
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.pending = append([]executor.PrefetchArtifact{}, artifacts...)
+	p.progress = executor.PrefetchProgress{Total: len(artifacts)}
+	p.manifest++
+	logger.Info("submitted")
+	return nil
+}
+
+func (p *Prefetcher) Progress() executor.PrefetchProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	progress := p.progress
+	if len(p.progress.Failures) > 0 {
+		progress.Failures = make(map[string]string, len(p.progress.Failures))
+		for k, v := range p.progress.Failures {
+			progress.Failures[k] = v
+		}
+	}
+	return progress
+}
+
+func (p *Prefetcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := p.logger
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	cancel := make(chan struct{})
+	timer := p.clock.NewTimer(p.interval)
+	defer timer.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			return nil
+
+		case <-timer.C():
+			artifact, manifest, ok := p.next()
+			if ok && p.acquireIdleSlot() {
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					defer func() { <-p.downloadRateLimiter }()
+					p.fetch(logger, artifact, manifest, cancel)
+				}()
+
+				select {
+				case <-done:
+				case signal := <-signals:
+					logger.Info("signalled", lager.Data{"signal": signal.String()})
+					close(cancel)
+					<-done
+					return nil
+				}
+			} else if ok {
+				p.requeue(artifact, manifest)
+			}
+			timer.Reset(p.interval)
+		}
+	}
+}
+
+// acquireIdleSlot takes a download slot if no other download is in progress.
+func (p *Prefetcher) acquireIdleSlot() bool {
+	if len(p.downloadRateLimiter) > 0 {
+		return false
+	}
+
+	select {
+	case p.downloadRateLimiter <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Prefetcher) next() (executor.PrefetchArtifact, int, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.pending) == 0 {
+		return executor.PrefetchArtifact{}, p.manifest, false
+	}
+	artifact := p.pending[0]
+	p.pending = p.pending[1:]
+	return artifact, p.manifest, true
+}
+
+func (p *Prefetcher) requeue(artifact executor.PrefetchArtifact, manifest int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if manifest == p.manifest {
+		p.pending = append([]executor.PrefetchArtifact{artifact}, p.pending...)
+	}
+}
+
+func (p *Prefetcher) fetch(logger lager.Logger, artifact executor.PrefetchArtifact, manifest int, cancel <-chan struct{}) {
+	logger = logger.Session("fetch", lager.Data{"cache-key": artifact.CacheKey})
+	logger.Info("starting")
+	defer logger.Info("complete")
+
+	downloadURL, _ := url.Parse(artifact.From)
+	dir, downloadedSize, err := p.cache.FetchAsDirectory(
+		logger.Session("downloader"),
+		downloadURL,
+		artifact.CacheKey,
+		cacheddownloader.ChecksumInfoType{
+			Algorithm: artifact.ChecksumAlgorithm,
+			Value:     artifact.ChecksumValue,
+		},
+		cancel,
+	)
+	if err == nil {
+		// the artifact stays in the cache once no one uses it
+		err = p.cache.CloseDirectory(logger, artifact.CacheKey, dir)
+	}
+
+	if err != nil {
+		logger.Error("failed", err)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if manifest != p.manifest {
+		return
+	}
+	if err != nil {
+		p.progress.Failed++
+		if p.progress.Failures == nil {
+			p.progress.Failures = map[string]string{}
+		}
+		p.progress.Failures[artifact.CacheKey] = err.Error()
+		return
+	}
+	p.progress.Fetched++
+	p.progress.DownloadedBytes += downloadedSize
+}
+
+func validArtifact(artifact executor.PrefetchArtifact) bool {
+	if artifact.CacheKey == "" {
+		return false
+	}
+	downloadURL, err := url.Parse(artifact.From)
+	return err == nil && downloadURL.Scheme != "" && downloadURL.Host != ""
+}
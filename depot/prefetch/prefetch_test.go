@@ -0,0 +1,131 @@
+package prefetch_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cacheddownloader/cacheddownloaderfakes"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/prefetch"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Prefetcher", func() {
+	var (
+		logger              *lagertest.TestLogger
+		fakeClock           *fakeclock.FakeClock
+		cache               *cacheddownloaderfakes.FakeCachedDownloader
+		downloadRateLimiter chan struct{}
+		prefetcher          *prefetch.Prefetcher
+		process             ifrit.Process
+		artifacts           []executor.PrefetchArtifact
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		cache = &cacheddownloaderfakes.FakeCachedDownloader{}
+		cache.FetchAsDirectoryReturns("/tmp/cache/buildpack", 123, nil)
+		downloadRateLimiter = make(chan struct{}, 2)
+		prefetcher = prefetch.New(logger, fakeClock, cache, downloadRateLimiter, time.Minute)
+		artifacts = []executor.PrefetchArtifact{
+			{From: "http://example.com/buildpack.zip", CacheKey: "buildpack", ChecksumAlgorithm: "sha256", ChecksumValue: "abc"},
+			{From: "http://example.com/lifecycle.tgz", CacheKey: "lifecycle"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Invoke(prefetcher)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	Describe("Submit", func() {
+		It("resets the progress", func() {
+			Expect(prefetcher.Submit(logger, artifacts)).To(Succeed())
+			Expect(prefetcher.Progress()).To(Equal(executor.PrefetchProgress{Total: 2}))
+		})
+
+		It("rejects artifacts without a cache key", func() {
+			artifacts[1].CacheKey = ""
+			Expect(prefetcher.Submit(logger, artifacts)).To(MatchError(executor.ErrInvalidPrefetchArtifact))
+		})
+
+		It("rejects artifacts without an absolute url", func() {
+			artifacts[1].From = "lifecycle.tgz"
+			Expect(prefetcher.Submit(logger, artifacts)).To(MatchError(executor.ErrInvalidPrefetchArtifact))
+		})
+	})
+
+	Context("when a manifest is submitted", func() {
+		JustBeforeEach(func() {
+			Expect(prefetcher.Submit(logger, artifacts)).To(Succeed())
+		})
+
+		It("fetches one artifact per interval into the cache", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(cache.CloseDirectoryCallCount).Should(Equal(1))
+
+			_, url, cacheKey, checksum, _ := cache.FetchAsDirectoryArgsForCall(0)
+			Expect(url.String()).To(Equal("http://example.com/buildpack.zip"))
+			Expect(cacheKey).To(Equal("buildpack"))
+			Expect(checksum.Algorithm).To(Equal("sha256"))
+			Expect(checksum.Value).To(Equal("abc"))
+
+			_, cacheKey, dir := cache.CloseDirectoryArgsForCall(0)
+			Expect(cacheKey).To(Equal("buildpack"))
+			Expect(dir).To(Equal("/tmp/cache/buildpack"))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(cache.CloseDirectoryCallCount).Should(Equal(2))
+			Eventually(prefetcher.Progress).Should(Equal(executor.PrefetchProgress{
+				Total:           2,
+				Fetched:         2,
+				DownloadedBytes: 246,
+			}))
+			Expect(downloadRateLimiter).To(BeEmpty())
+		})
+
+		Context("when a container is downloading its dependencies", func() {
+			BeforeEach(func() {
+				downloadRateLimiter <- struct{}{}
+			})
+
+			It("waits until the cell is idle", func() {
+				fakeClock.WaitForWatcherAndIncrement(time.Minute)
+				fakeClock.WaitForWatcherAndIncrement(time.Minute)
+				Consistently(cache.FetchAsDirectoryCallCount).Should(Equal(0))
+
+				<-downloadRateLimiter
+				fakeClock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(cache.FetchAsDirectoryCallCount).Should(Equal(1))
+				_, _, cacheKey, _, _ := cache.FetchAsDirectoryArgsForCall(0)
+				Expect(cacheKey).To(Equal("buildpack"))
+			})
+		})
+
+		Context("when fetching an artifact fails", func() {
+			BeforeEach(func() {
+				cache.FetchAsDirectoryReturns("", 0, errors.New("connection refused"))
+			})
+
+			It("records the failure", func() {
+				fakeClock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(prefetcher.Progress).Should(Equal(executor.PrefetchProgress{
+					Total:    2,
+					Failed:   1,
+					Failures: map[string]string{"buildpack": "connection refused"},
+				}))
+				Expect(cache.CloseDirectoryCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
@@ -0,0 +1 @@
+package probe // import "code.cloudfoundry.org/executor/depot/probe"
@@ -0,0 +1,197 @@
+package probe
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/guidgen"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	SyntheticProbeDurationMetric = "SyntheticProbeDuration"
+	SyntheticProbeFailedMetric   = "SyntheticProbeFailed"
+
+	pollInterval = time.Second
+	guidPrefix   = "synthetic-probe-"
+	memoryMB     = 32
+	diskMB       = 32
+)
+
+type run struct {
+	guid      string
+	startedAt time.Time
+}
+
+// Probe periodically allocates and runs a tiny container through the same
+// client as the containers of the cell, waits for its action to complete and
+// deletes it again. Every run emits its end-to-end duration and whether it
+// failed, which covers the container store, the transformer and the
+// resource accounting of the cell, unlike the garden healthcheck.
+type Probe struct {
+	logger        lager.Logger
+	clock         clock.Clock
+	client        executor.Client
+	guidGenerator guidgen.Generator
+	metronClient  loggingclient.IngressClient
+	interval      time.Duration
+	timeout       time.Duration
+	runInfo       executor.RunInfo
+}
+
+// New constructs a probe that runs the process in the rootfs every
+// interval. A run that has not completed within timeout counts as failed.
+func New(
+	logger lager.Logger,
+	clock clock.Clock,
+	client executor.Client,
+	guidGenerator guidgen.Generator,
+	metronClient loggingclient.IngressClient,
+	interval time.Duration,
+	timeout time.Duration,
+	rootFSPath string,
+	process *models.RunAction,
+) *Probe {
+	return &Probe{
+		logger:        logger.Session("synthetic-probe"),
+		clock:         clock,
+		client:        client,
+		guidGenerator: guidGenerator,
+		metronClient:  metronClient,
+		interval:      interval,
+		timeout:       timeout,
+		runInfo: executor.RunInfo{
+			RootFSPath: rootFSPath,
+			Action:     models.WrapAction(process),
+		},
+	}
+}
+
+func (p *Probe) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := p.logger
+	logger.Info("starting", lager.Data{"interval": p.interval.String()})
+	defer logger.Info("complete")
+
+	var inFlight *run
+	timer := p.clock.NewTimer(p.interval)
+	defer timer.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			if inFlight != nil {
+				p.deleteContainer(logger, inFlight.guid)
+			}
+			return nil
+
+		case <-timer.C():
+			now := p.clock.Now()
+
+			if inFlight == nil {
+				inFlight = p.start(logger, now)
+			} else if p.checkCompleted(logger, now, inFlight) {
+				inFlight = nil
+			}
+
+			if inFlight == nil {
+				timer.Reset(p.interval)
+			} else {
+				timer.Reset(pollInterval)
+			}
+		}
+	}
+}
+
+func (p *Probe) start(logger lager.Logger, now time.Time) *run {
+	traceID := "" // probes are not originated through API
+	guid := guidPrefix + p.guidGenerator.Guid(logger)
+	logger = logger.Session("start", lager.Data{"guid": guid})
+	tags := executor.Tags{executor.SyntheticProbeTag: "true"}
+
+	resource := executor.NewResource(memoryMB, diskMB, 0)
+	allocationRequest := executor.NewAllocationRequest(guid, &resource, tags)
+	failures := p.client.AllocateContainers(logger, traceID, []executor.AllocationRequest{allocationRequest})
+	if len(failures) > 0 {
+		logger.Error("failed-to-allocate-container", &failures[0])
+		p.emit(logger, 0, true)
+		return nil
+	}
+
+	runInfo := p.runInfo
+	runRequest := executor.NewRunRequest(guid, &runInfo, tags)
+	err := p.client.RunContainer(logger, traceID, &runRequest)
+	if err != nil {
+		logger.Error("failed-to-run-container", err)
+		p.deleteContainer(logger, guid)
+		p.emit(logger, 0, true)
+		return nil
+	}
+
+	return &run{guid: guid, startedAt: now}
+}
+
+func (p *Probe) checkCompleted(logger lager.Logger, now time.Time, r *run) bool {
+	logger = logger.Session("check-completed", lager.Data{"guid": r.guid})
+	duration := now.Sub(r.startedAt)
+
+	container, err := p.client.GetContainer(logger, r.guid)
+	if err == executor.ErrContainerNotFound {
+		logger.Error("container-disappeared", err)
+		p.emit(logger, duration, true)
+		return true
+	}
+	if err != nil {
+		logger.Error("failed-to-get-container", err)
+	}
+
+	if err != nil || container.State != executor.StateCompleted {
+		if duration < p.timeout {
+			return false
+		}
+		logger.Info("timed-out", lager.Data{"duration": duration.String()})
+		p.deleteContainer(logger, r.guid)
+		p.emit(logger, duration, true)
+		return true
+	}
+
+	if container.RunResult.Failed {
+		logger.Info("failed", lager.Data{"failure-reason": container.RunResult.FailureReason})
+	}
+	p.deleteContainer(logger, r.guid)
+	p.emit(logger, p.clock.Since(r.startedAt), container.RunResult.Failed)
+	return true
+}
+
+func (p *Probe) emit(logger lager.Logger, duration time.Duration, failed bool) {
+	failedValue := 0
+	if failed {
+		failedValue = 1
+	}
+
+	err := p.metronClient.SendMetric(SyntheticProbeFailedMetric, failedValue)
+	if err != nil {
+		logger.Error("failed-to-send-probe-failed-metric", err)
+	}
+
+	if duration > 0 {
+		err = p.metronClient.SendDuration(SyntheticProbeDurationMetric, duration)
+		if err != nil {
+			logger.Error("failed-to-send-probe-duration-metric", err)
+		}
+	}
+}
+
+func (p *Probe) deleteContainer(logger lager.Logger, guid string) {
+	traceID := "" // probes are not originated through API
+	err := p.client.DeleteContainer(logger, traceID, guid)
+	if err != nil {
+		logger.Error("failed-to-delete-container", err)
+	}
+}
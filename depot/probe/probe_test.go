@@ -0,0 +1,185 @@
+package probe_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/probe"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/executor/guidgen/fakeguidgen"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Probe", func() {
+	var (
+		fakeClock        *fakeclock.FakeClock
+		fakeClient       *fakes.FakeClient
+		fakeMetronClient *mfakes.FakeIngressClient
+		guidGenerator    *fakeguidgen.FakeGenerator
+		process          ifrit.Process
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		fakeClient = &fakes.FakeClient{}
+		fakeMetronClient = new(mfakes.FakeIngressClient)
+		guidGenerator = &fakeguidgen.FakeGenerator{}
+		guidGenerator.GuidReturns("some-guid")
+	})
+
+	JustBeforeEach(func() {
+		p := probe.New(
+			lagertest.NewTestLogger("test"),
+			fakeClock,
+			fakeClient,
+			guidGenerator,
+			fakeMetronClient,
+			time.Minute,
+			10*time.Second,
+			"/some/rootfs",
+			&models.RunAction{Path: "/bin/true", User: "vcap"},
+		)
+		process = ifrit.Invoke(p)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	failedMetric := func(i int) int {
+		name, value, _ := fakeMetronClient.SendMetricArgsForCall(i)
+		Expect(name).To(Equal(probe.SyntheticProbeFailedMetric))
+		return value
+	}
+
+	It("allocates and runs a tagged container every interval", func() {
+		fakeClock.WaitForWatcherAndIncrement(time.Minute)
+		Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+
+		tags := executor.Tags{executor.SyntheticProbeTag: "true"}
+		_, _, requests := fakeClient.AllocateContainersArgsForCall(0)
+		Expect(requests).To(Equal([]executor.AllocationRequest{{
+			Guid:     "synthetic-probe-some-guid",
+			Resource: executor.NewResource(32, 32, 0),
+			Tags:     tags,
+		}}))
+
+		_, _, runRequest := fakeClient.RunContainerArgsForCall(0)
+		Expect(runRequest.Guid).To(Equal("synthetic-probe-some-guid"))
+		Expect(runRequest.RootFSPath).To(Equal("/some/rootfs"))
+		Expect(runRequest.Action).To(Equal(models.WrapAction(&models.RunAction{Path: "/bin/true", User: "vcap"})))
+		Expect(runRequest.Tags).To(Equal(tags))
+	})
+
+	Context("when the container completes", func() {
+		BeforeEach(func() {
+			fakeClient.GetContainerReturns(executor.Container{State: executor.StateCompleted}, nil)
+		})
+
+		It("deletes the container and emits the duration of the run", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+
+			Eventually(fakeClient.DeleteContainerCallCount).Should(Equal(1))
+			_, _, guid := fakeClient.DeleteContainerArgsForCall(0)
+			Expect(guid).To(Equal("synthetic-probe-some-guid"))
+
+			Eventually(fakeMetronClient.SendDurationCallCount).Should(Equal(1))
+			name, duration, _ := fakeMetronClient.SendDurationArgsForCall(0)
+			Expect(name).To(Equal(probe.SyntheticProbeDurationMetric))
+			Expect(duration).To(Equal(time.Second))
+			Expect(failedMetric(0)).To(Equal(0))
+		})
+
+		It("runs the next probe after the interval", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(fakeClient.DeleteContainerCallCount).Should(Equal(1))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeClient.RunContainerCallCount).Should(Equal(2))
+		})
+
+		Context("with a failure", func() {
+			BeforeEach(func() {
+				fakeClient.GetContainerReturns(executor.Container{
+					State:     executor.StateCompleted,
+					RunResult: executor.ContainerRunResult{Failed: true, FailureReason: "exit status 1"},
+				}, nil)
+			})
+
+			It("emits that the probe failed", func() {
+				fakeClock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+				fakeClock.WaitForWatcherAndIncrement(time.Second)
+
+				Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+				Expect(failedMetric(0)).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when the container does not complete in time", func() {
+		BeforeEach(func() {
+			fakeClient.GetContainerReturns(executor.Container{State: executor.StateRunning}, nil)
+		})
+
+		It("deletes the container and emits that the probe failed", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+
+			for i := 0; i < 9; i++ {
+				fakeClock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(fakeClient.GetContainerCallCount).Should(Equal(i + 1))
+			}
+			Consistently(fakeClient.DeleteContainerCallCount).Should(Equal(0))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(fakeClient.DeleteContainerCallCount).Should(Equal(1))
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+			Expect(failedMetric(0)).To(Equal(1))
+		})
+	})
+
+	Context("when the container cannot be allocated", func() {
+		BeforeEach(func() {
+			fakeClient.AllocateContainersReturns([]executor.AllocationFailure{
+				executor.NewAllocationFailure(&executor.AllocationRequest{}, "insufficient resources"),
+			})
+		})
+
+		It("emits that the probe failed without running a container", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+			Expect(failedMetric(0)).To(Equal(1))
+			Expect(fakeClient.RunContainerCallCount()).To(Equal(0))
+			Expect(fakeMetronClient.SendDurationCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the container cannot be run", func() {
+		BeforeEach(func() {
+			fakeClient.RunContainerReturns(errors.New("boom"))
+		})
+
+		It("deletes the container and emits that the probe failed", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(fakeClient.DeleteContainerCallCount).Should(Equal(1))
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+			Expect(failedMetric(0)).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1 @@
+package quarantine // import "code.cloudfoundry.org/executor/depot/quarantine"
@@ -0,0 +1,114 @@
+package quarantine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// FailurePolicy decides what happens to an artifact when it could not be
+// scanned, e.g. because the scanner timed out. Artifacts the scanner
+// rejects are never let through.
+type FailurePolicy string
+
+const (
+	FailOpen   FailurePolicy = "fail-open"
+	FailClosed FailurePolicy = "fail-closed"
+)
+
+var ErrInvalidFailurePolicy = errors.New("failure policy must be fail-open or fail-closed")
+
+// RejectedError is returned by scanners that found a problem with an
+// artifact.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("artifact rejected by scanner: %s", e.Reason)
+}
+
+//go:generate counterfeiter -o quarantinefakes/fake_scanner.go . Scanner
+
+// Scanner inspects the artifact at path. It returns a *RejectedError when the
+// artifact must not be used and any other error when it could not scan it.
+type Scanner interface {
+	Scan(logger lager.Logger, path string) error
+}
+
+// Quarantine holds downloaded artifacts in a directory of the cell until the
+// scanner let them through, before they are extracted into containers.
+type Quarantine struct {
+	dir     string
+	scanner Scanner
+	policy  FailurePolicy
+}
+
+func New(dir string, scanner Scanner, policy FailurePolicy) (*Quarantine, error) {
+	if policy != FailOpen && policy != FailClosed {
+		return nil, ErrInvalidFailurePolicy
+	}
+	return &Quarantine{
+		dir:     dir,
+		scanner: scanner,
+		policy:  policy,
+	}, nil
+}
+
+// Inspect copies the artifact into the quarantine and scans it. It returns a
+// reader of the quarantined copy, which is removed once the reader is
+// closed. The artifact is closed in any case.
+func (q *Quarantine) Inspect(logger lager.Logger, artifact io.ReadCloser) (io.ReadCloser, error) {
+	logger = logger.Session("quarantine")
+	defer artifact.Close()
+
+	file, err := os.CreateTemp(q.dir, "artifact-")
+	if err != nil {
+		logger.Error("failed-to-create-file", err)
+		return nil, err
+	}
+
+	_, err = io.Copy(file, artifact)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		logger.Error("failed-to-copy-artifact", err)
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	quarantined := &removeOnClose{File: file}
+
+	err = q.scanner.Scan(logger, file.Name())
+	var rejected *RejectedError
+	switch {
+	case err == nil:
+		logger.Info("artifact-passed")
+		return quarantined, nil
+	case errors.As(err, &rejected):
+		logger.Error("artifact-rejected", err)
+		quarantined.Close()
+		return nil, err
+	case q.policy == FailOpen:
+		logger.Error("scan-failed-letting-artifact-through", err)
+		return quarantined, nil
+	default:
+		logger.Error("scan-failed", err)
+		quarantined.Close()
+		return nil, err
+	}
+}
+
+type removeOnClose struct {
+	*os.File
+}
+
+func (r *removeOnClose) Close() error {
+	err := r.File.Close()
+	os.Remove(r.File.Name())
+	return err
+}
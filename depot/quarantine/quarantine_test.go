@@ -0,0 +1,116 @@
+package quarantine_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/executor/depot/quarantine"
+	"code.cloudfoundry.org/executor/depot/quarantine/quarantinefakes"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quarantine", func() {
+	var (
+		dir     string
+		scanner *quarantinefakes.FakeScanner
+		policy  quarantine.FailurePolicy
+		logger  *lagertest.TestLogger
+
+		scanned string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		scanner = new(quarantinefakes.FakeScanner)
+		scanner.ScanStub = func(_ lager.Logger, path string) error {
+			contents, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			scanned = string(contents)
+			return nil
+		}
+		policy = quarantine.FailClosed
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	inspect := func() (io.ReadCloser, error) {
+		q, err := quarantine.New(dir, scanner, policy)
+		Expect(err).NotTo(HaveOccurred())
+		return q.Inspect(logger, io.NopCloser(strings.NewReader("the-artifact")))
+	}
+
+	quarantined := func() []os.DirEntry {
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		return entries
+	}
+
+	It("scans a copy of the artifact in the quarantine directory", func() {
+		artifact, err := inspect()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scanned).To(Equal("the-artifact"))
+		Expect(scanner.ScanCallCount()).To(Equal(1))
+		_, path := scanner.ScanArgsForCall(0)
+		Expect(path).To(HavePrefix(dir))
+
+		contents, err := io.ReadAll(artifact)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("the-artifact"))
+
+		Expect(quarantined()).To(HaveLen(1))
+		Expect(artifact.Close()).To(Succeed())
+		Expect(quarantined()).To(BeEmpty())
+	})
+
+	It("rejects artifacts the scanner rejects", func() {
+		scanner.ScanReturns(&quarantine.RejectedError{Reason: "Eicar-Test-Signature FOUND"})
+
+		_, err := inspect()
+		Expect(err).To(MatchError("artifact rejected by scanner: Eicar-Test-Signature FOUND"))
+		Expect(quarantined()).To(BeEmpty())
+	})
+
+	Context("when the scan fails", func() {
+		BeforeEach(func() {
+			scanner.ScanReturns(errors.New("scanner timed out after 1s"))
+		})
+
+		It("rejects the artifact", func() {
+			_, err := inspect()
+			Expect(err).To(MatchError("scanner timed out after 1s"))
+			Expect(quarantined()).To(BeEmpty())
+		})
+
+		Context("and the policy is to fail open", func() {
+			BeforeEach(func() {
+				policy = quarantine.FailOpen
+			})
+
+			It("lets the artifact through", func() {
+				artifact, err := inspect()
+				Expect(err).NotTo(HaveOccurred())
+				defer artifact.Close()
+
+				contents, err := io.ReadAll(artifact)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("the-artifact"))
+			})
+
+			It("still rejects artifacts the scanner rejects", func() {
+				scanner.ScanReturns(&quarantine.RejectedError{Reason: "infected"})
+
+				_, err := inspect()
+				Expect(err).To(BeAssignableToTypeOf(&quarantine.RejectedError{}))
+			})
+		})
+	})
+
+	It("requires a known failure policy", func() {
+		_, err := quarantine.New(dir, scanner, "fail-sometimes")
+		Expect(err).To(Equal(quarantine.ErrInvalidFailurePolicy))
+	})
+})
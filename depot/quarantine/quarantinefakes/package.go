@@ -0,0 +1 @@
+package quarantinefakes // import "code.cloudfoundry.org/executor/depot/quarantine/quarantinefakes"
@@ -0,0 +1,109 @@
+package quarantine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// rejectedExitStatus is the exit status with which scanner commands report
+// infected files, following clamscan.
+const rejectedExitStatus = 1
+
+type commandScanner struct {
+	path    string
+	args    []string
+	timeout time.Duration
+}
+
+// NewCommandScanner runs the command with the path of the artifact as its
+// last argument. The command must exit with 0 for clean artifacts and with 1
+// for rejected ones; any other exit status counts as a failed scan.
+func NewCommandScanner(path string, args []string, timeout time.Duration) Scanner {
+	return &commandScanner{
+		path:    path,
+		args:    args,
+		timeout: timeout,
+	}
+}
+
+func (s *commandScanner) Scan(logger lager.Logger, path string) error {
+	logger = logger.Session("command-scanner", lager.Data{"scanner": s.path})
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	output := &bytes.Buffer{}
+	args := append(append([]string{}, s.args...), path)
+	cmd := exec.CommandContext(ctx, s.path, args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("scanner timed out after %s", s.timeout)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == rejectedExitStatus {
+		return &RejectedError{Reason: strings.TrimSpace(output.String())}
+	}
+	if err != nil {
+		logger.Error("failed-to-scan", err, lager.Data{"output": output.String()})
+		return err
+	}
+	return nil
+}
+
+type httpScanner struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPScanner posts the artifact to the endpoint. The endpoint must
+// respond with 200 for clean artifacts and with 406 for rejected ones, with
+// the reason in the body; any other response counts as a failed scan.
+func NewHTTPScanner(client *http.Client, url string, timeout time.Duration) Scanner {
+	c := *client
+	c.Timeout = timeout
+	return &httpScanner{
+		client: &c,
+		url:    url,
+	}
+}
+
+func (s *httpScanner) Scan(logger lager.Logger, path string) error {
+	logger = logger.Session("http-scanner", lager.Data{"scanner": s.url})
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	resp, err := s.client.Post(s.url, "application/octet-stream", file)
+	if err != nil {
+		logger.Error("failed-to-scan", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotAcceptable:
+		return &RejectedError{Reason: strings.TrimSpace(string(body))}
+	default:
+		return fmt.Errorf("scanner responded with status code %d", resp.StatusCode)
+	}
+}
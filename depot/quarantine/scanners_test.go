@@ -0,0 +1,96 @@
+package quarantine_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/executor/depot/quarantine"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scanners", func() {
+	var (
+		artifact string
+		logger   *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		artifact = filepath.Join(GinkgoT().TempDir(), "artifact")
+		Expect(os.WriteFile(artifact, []byte("the-artifact"), 0644)).To(Succeed())
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	Describe("CommandScanner", func() {
+		scan := func(script string, timeout time.Duration) error {
+			return quarantine.NewCommandScanner("/bin/sh", []string{"-c", script, "scanner"}, timeout).Scan(logger, artifact)
+		}
+
+		It("passes the artifact to the command", func() {
+			Expect(scan(`grep -q the-artifact "$1"`, time.Minute)).To(Succeed())
+		})
+
+		It("rejects the artifact when the command exits with 1", func() {
+			err := scan(`echo "$1: Eicar-Test-Signature FOUND"; exit 1`, time.Minute)
+			Expect(err).To(MatchError(ContainSubstring("Eicar-Test-Signature FOUND")))
+			Expect(err).To(BeAssignableToTypeOf(&quarantine.RejectedError{}))
+		})
+
+		It("fails when the command exits with another status", func() {
+			err := scan("exit 2", time.Minute)
+			Expect(err).To(HaveOccurred())
+			Expect(err).NotTo(BeAssignableToTypeOf(&quarantine.RejectedError{}))
+		})
+
+		It("fails when the command times out", func() {
+			Expect(scan("exec sleep 10", 10*time.Millisecond)).To(MatchError("scanner timed out after 10ms"))
+		})
+	})
+
+	Describe("HTTPScanner", func() {
+		var (
+			server *httptest.Server
+			status int
+			body   string
+		)
+
+		BeforeEach(func() {
+			status = http.StatusOK
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				contents, err := io.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				body = string(contents)
+				w.WriteHeader(status)
+				w.Write([]byte("infected"))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		scan := func() error {
+			return quarantine.NewHTTPScanner(server.Client(), server.URL, time.Minute).Scan(logger, artifact)
+		}
+
+		It("posts the artifact to the endpoint", func() {
+			Expect(scan()).To(Succeed())
+			Expect(body).To(Equal("the-artifact"))
+		})
+
+		It("rejects the artifact when the endpoint responds with 406", func() {
+			status = http.StatusNotAcceptable
+			Expect(scan()).To(MatchError("artifact rejected by scanner: infected"))
+		})
+
+		It("fails when the endpoint responds with another status", func() {
+			status = http.StatusServiceUnavailable
+			Expect(scan()).To(MatchError("scanner responded with status code 503"))
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package scheduler_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/executor/depot/scheduler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseSchedule", func() {
+	// a Wednesday
+	start := time.Date(2024, time.January, 10, 10, 30, 15, 0, time.UTC)
+
+	DescribeTable("computes the next activation",
+		func(spec string, expected time.Time) {
+			schedule, err := scheduler.ParseSchedule(spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(schedule.Next(start)).To(Equal(expected))
+		},
+		Entry("every minute", "* * * * *", time.Date(2024, time.January, 10, 10, 31, 0, 0, time.UTC)),
+		Entry("a fixed time of day", "15 3 * * *", time.Date(2024, time.January, 11, 3, 15, 0, 0, time.UTC)),
+		Entry("steps", "*/20 * * * *", time.Date(2024, time.January, 10, 10, 40, 0, 0, time.UTC)),
+		Entry("ranges and lists", "0 8-9,12 * * *", time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)),
+		Entry("a day of week", "0 0 * * 0", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)),
+		Entry("Sunday as 7", "0 0 * * 7", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)),
+		Entry("a day of month", "0 0 1 * *", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)),
+		Entry("either day of month or day of week", "0 0 1 * 5", time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)),
+		Entry("a month", "0 0 1 3 *", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)),
+		Entry("@hourly", "@hourly", time.Date(2024, time.January, 10, 11, 0, 0, 0, time.UTC)),
+		Entry("@daily", "@daily", time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC)),
+		Entry("@every", "@every 90s", time.Date(2024, time.January, 10, 10, 31, 45, 0, time.UTC)),
+	)
+
+	It("never activates schedules that cannot match", func() {
+		schedule, err := scheduler.ParseSchedule("0 0 30 2 *")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(schedule.Next(start)).To(BeZero())
+	})
+
+	DescribeTable("rejects invalid schedules",
+		func(spec string) {
+			_, err := scheduler.ParseSchedule(spec)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("too few fields", "* * * *"),
+		Entry("out of range", "60 * * * *"),
+		Entry("an inverted range", "0 5-3 * * *"),
+		Entry("a zero step", "*/0 * * * *"),
+		Entry("garbage", "a * * * *"),
+		Entry("an invalid interval", "@every soon"),
+		Entry("a sub-second interval", "@every 10ms"),
+	)
+})
@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/guidgen"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	pollInterval      = time.Second
+	maxResultsPerTask = 10
+)
+
+// Results holds the outcome of the most recent runs of each scheduled task.
+type Results struct {
+	lock    sync.Mutex
+	results map[string][]executor.ScheduledTaskResult
+}
+
+func NewResults() *Results {
+	return &Results{results: map[string][]executor.ScheduledTaskResult{}}
+}
+
+// Results returns the recorded runs of all tasks, oldest first.
+func (r *Results) Results() []executor.ScheduledTaskResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	results := []executor.ScheduledTaskResult{}
+	for _, taskResults := range r.results {
+		results = append(results, taskResults...)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].StartedAt < results[j].StartedAt
+	})
+	return results
+}
+
+func (r *Results) record(result executor.ScheduledTaskResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	taskResults := append(r.results[result.Name], result)
+	if len(taskResults) > maxResultsPerTask {
+		taskResults = taskResults[len(taskResults)-maxResultsPerTask:]
+	}
+	r.results[result.Name] = taskResults
+}
+
+type scheduledTask struct {
+	executor.ScheduledTask
+	schedule Schedule
+}
+
+// Scheduler runs the maintenance containers of the cell. Every run allocates
+// and runs a regular container tagged with ScheduledTaskTag, so it reserves
+// resources and emits lifecycle events like any other container. A run is
+// skipped if the previous run of the same task has not completed yet.
+type Scheduler struct {
+	logger        lager.Logger
+	clock         clock.Clock
+	client        executor.Client
+	guidGenerator guidgen.Generator
+	results       *Results
+	tasks         []scheduledTask
+}
+
+func New(
+	logger lager.Logger,
+	clock clock.Clock,
+	client executor.Client,
+	guidGenerator guidgen.Generator,
+	results *Results,
+	tasks []executor.ScheduledTask,
+) (*Scheduler, error) {
+	names := map[string]bool{}
+	scheduled := make([]scheduledTask, 0, len(tasks))
+	for _, task := range tasks {
+		if task.Name == "" {
+			return nil, errors.New("scheduled task name must be set")
+		}
+		if names[task.Name] {
+			return nil, fmt.Errorf("duplicate scheduled task: %s", task.Name)
+		}
+		names[task.Name] = true
+
+		if task.Action == nil {
+			return nil, fmt.Errorf("scheduled task %s has no action", task.Name)
+		}
+
+		schedule, err := ParseSchedule(task.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, scheduledTask{ScheduledTask: task, schedule: schedule})
+	}
+
+	return &Scheduler{
+		logger:        logger.Session("scheduler"),
+		clock:         clock,
+		client:        client,
+		guidGenerator: guidGenerator,
+		results:       results,
+		tasks:         scheduled,
+	}, nil
+}
+
+func (s *Scheduler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := s.logger
+	logger.Info("starting", lager.Data{"tasks": len(s.tasks)})
+	defer logger.Info("complete")
+
+	now := s.clock.Now()
+	next := make([]time.Time, len(s.tasks))
+	for i, task := range s.tasks {
+		next[i] = task.schedule.Next(now)
+	}
+	inFlight := map[string]executor.ScheduledTaskResult{}
+
+	timer := s.clock.NewTimer(s.wait(now, next, inFlight))
+	defer timer.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String(), "in-flight": len(inFlight)})
+			return nil
+
+		case <-timer.C():
+			now := s.clock.Now()
+
+			for name, result := range inFlight {
+				if s.checkCompleted(logger, now, result) {
+					delete(inFlight, name)
+				}
+			}
+
+			for i, task := range s.tasks {
+				if next[i].IsZero() || now.Before(next[i]) {
+					continue
+				}
+				next[i] = task.schedule.Next(now)
+
+				if _, running := inFlight[task.Name]; running {
+					logger.Info("skipping-overlapping-run", lager.Data{"task": task.Name})
+					continue
+				}
+
+				if result, started := s.start(logger, now, task); started {
+					inFlight[task.Name] = result
+				}
+			}
+
+			timer.Reset(s.wait(now, next, inFlight))
+		}
+	}
+}
+
+func (s *Scheduler) wait(now time.Time, next []time.Time, inFlight map[string]executor.ScheduledTaskResult) time.Duration {
+	var wake time.Time
+	for _, t := range next {
+		if !t.IsZero() && (wake.IsZero() || t.Before(wake)) {
+			wake = t
+		}
+	}
+	if len(inFlight) > 0 && (wake.IsZero() || now.Add(pollInterval).Before(wake)) {
+		wake = now.Add(pollInterval)
+	}
+	if wake.IsZero() {
+		return maxScheduleSearch
+	}
+	return wake.Sub(now)
+}
+
+func (s *Scheduler) start(logger lager.Logger, now time.Time, task scheduledTask) (executor.ScheduledTaskResult, bool) {
+	traceID := "" // scheduled runs are not originated through API
+	guid := task.Name + "-" + s.guidGenerator.Guid(logger)
+	logger = logger.Session("start", lager.Data{"task": task.Name, "guid": guid})
+
+	result := executor.ScheduledTaskResult{
+		Name:      task.Name,
+		Guid:      guid,
+		StartedAt: now.UnixNano(),
+	}
+	tags := executor.Tags{executor.ScheduledTaskTag: task.Name}
+
+	allocationRequest := executor.NewAllocationRequest(guid, &task.Resource, tags)
+	failures := s.client.AllocateContainers(logger, traceID, []executor.AllocationRequest{allocationRequest})
+	if len(failures) > 0 {
+		logger.Error("failed-to-allocate-container", &failures[0])
+		s.fail(result, now, failures[0].ErrorMsg)
+		return result, false
+	}
+
+	runRequest := executor.NewRunRequest(guid, &task.RunInfo, tags)
+	err := s.client.RunContainer(logger, traceID, &runRequest)
+	if err != nil {
+		logger.Error("failed-to-run-container", err)
+		s.fail(result, now, err.Error())
+		s.deleteContainer(logger, guid)
+		return result, false
+	}
+
+	logger.Info("started")
+	return result, true
+}
+
+func (s *Scheduler) checkCompleted(logger lager.Logger, now time.Time, result executor.ScheduledTaskResult) bool {
+	logger = logger.Session("check-completed", lager.Data{"task": result.Name, "guid": result.Guid})
+
+	container, err := s.client.GetContainer(logger, result.Guid)
+	if err == executor.ErrContainerNotFound {
+		logger.Error("container-disappeared", err)
+		s.fail(result, now, "container disappeared")
+		return true
+	}
+	if err != nil {
+		logger.Error("failed-to-get-container", err)
+		return false
+	}
+
+	if container.State != executor.StateCompleted {
+		return false
+	}
+
+	result.CompletedAt = now.UnixNano()
+	result.Failed = container.RunResult.Failed
+	result.FailureReason = container.RunResult.FailureReason
+	s.results.record(result)
+	logger.Info("completed", lager.Data{"failed": result.Failed})
+
+	s.deleteContainer(logger, result.Guid)
+	return true
+}
+
+func (s *Scheduler) fail(result executor.ScheduledTaskResult, now time.Time, reason string) {
+	result.CompletedAt = now.UnixNano()
+	result.Failed = true
+	result.FailureReason = reason
+	s.results.record(result)
+}
+
+func (s *Scheduler) deleteContainer(logger lager.Logger, guid string) {
+	traceID := "" // scheduled runs are not originated through API
+	err := s.client.DeleteContainer(logger, traceID, guid)
+	if err != nil {
+		logger.Error("failed-to-delete-container", err)
+	}
+}
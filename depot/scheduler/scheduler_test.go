@@ -0,0 +1,181 @@
+package scheduler_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/scheduler"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/executor/guidgen/fakeguidgen"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		fakeClock     *fakeclock.FakeClock
+		fakeClient    *fakes.FakeClient
+		guidGenerator *fakeguidgen.FakeGenerator
+		results       *scheduler.Results
+		tasks         []executor.ScheduledTask
+		process       ifrit.Process
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Date(2024, time.January, 10, 10, 30, 0, 0, time.UTC))
+		fakeClient = &fakes.FakeClient{}
+		guidGenerator = &fakeguidgen.FakeGenerator{}
+		guidGenerator.GuidReturns("some-guid")
+		results = scheduler.NewResults()
+		tasks = []executor.ScheduledTask{{
+			Name:     "log-rotation",
+			Schedule: "@every 1m",
+			Resource: executor.NewResource(64, 128, 10),
+			RunInfo: executor.RunInfo{
+				RootFSPath: "docker:///busybox",
+				Action:     models.WrapAction(&models.RunAction{Path: "logrotate", User: "root"}),
+			},
+		}}
+	})
+
+	JustBeforeEach(func() {
+		s, err := scheduler.New(lagertest.NewTestLogger("test"), fakeClock, fakeClient, guidGenerator, results, tasks)
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(s)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("does not run tasks before they are due", func() {
+		fakeClock.WaitForWatcherAndIncrement(30 * time.Second)
+		Consistently(fakeClient.AllocateContainersCallCount).Should(Equal(0))
+	})
+
+	It("allocates and runs a tagged container when the task is due", func() {
+		fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+		Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+
+		_, _, requests := fakeClient.AllocateContainersArgsForCall(0)
+		Expect(requests).To(Equal([]executor.AllocationRequest{{
+			Guid:     "log-rotation-some-guid",
+			Resource: executor.NewResource(64, 128, 10),
+			Tags:     executor.Tags{executor.ScheduledTaskTag: "log-rotation"},
+		}}))
+
+		_, _, runRequest := fakeClient.RunContainerArgsForCall(0)
+		Expect(runRequest.Guid).To(Equal("log-rotation-some-guid"))
+		Expect(runRequest.RunInfo).To(Equal(tasks[0].RunInfo))
+		Expect(runRequest.Tags).To(Equal(executor.Tags{executor.ScheduledTaskTag: "log-rotation"}))
+	})
+
+	Context("when the container completes", func() {
+		BeforeEach(func() {
+			fakeClient.GetContainerReturns(executor.Container{
+				Guid:      "log-rotation-some-guid",
+				State:     executor.StateCompleted,
+				RunResult: executor.ContainerRunResult{Failed: true, FailureReason: "exit status 1"},
+			}, nil)
+		})
+
+		It("records the result and deletes the container", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+			startedAt := fakeClock.Now().UnixNano()
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+
+			Eventually(fakeClient.DeleteContainerCallCount).Should(Equal(1))
+			_, _, guid := fakeClient.DeleteContainerArgsForCall(0)
+			Expect(guid).To(Equal("log-rotation-some-guid"))
+
+			Expect(results.Results()).To(Equal([]executor.ScheduledTaskResult{{
+				Name:          "log-rotation",
+				Guid:          "log-rotation-some-guid",
+				StartedAt:     startedAt,
+				CompletedAt:   fakeClock.Now().UnixNano(),
+				Failed:        true,
+				FailureReason: "exit status 1",
+			}}))
+		})
+	})
+
+	Context("when the previous run is still in progress", func() {
+		BeforeEach(func() {
+			fakeClient.GetContainerReturns(executor.Container{State: executor.StateRunning}, nil)
+		})
+
+		It("skips the run", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeClient.RunContainerCallCount).Should(Equal(1))
+
+			for i := 0; i < 60; i++ {
+				fakeClock.WaitForWatcherAndIncrement(time.Second)
+			}
+
+			Eventually(fakeClient.GetContainerCallCount).Should(BeNumerically(">=", 60))
+			Expect(fakeClient.AllocateContainersCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when allocating the container fails", func() {
+		BeforeEach(func() {
+			fakeClient.AllocateContainersStub = func(_ lager.Logger, _ string, requests []executor.AllocationRequest) []executor.AllocationFailure {
+				return []executor.AllocationFailure{executor.NewAllocationFailure(&requests[0], "insufficient resources")}
+			}
+		})
+
+		It("records a failed result without running the container", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(results.Results).Should(HaveLen(1))
+			Expect(results.Results()[0].Failed).To(BeTrue())
+			Expect(results.Results()[0].FailureReason).To(Equal("insufficient resources"))
+			Expect(fakeClient.RunContainerCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when running the container fails", func() {
+		BeforeEach(func() {
+			fakeClient.RunContainerReturns(errors.New("boom"))
+		})
+
+		It("records a failed result and deletes the container", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(results.Results).Should(HaveLen(1))
+			Expect(results.Results()[0].FailureReason).To(Equal("boom"))
+			Expect(fakeClient.DeleteContainerCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("New", func() {
+		It("rejects invalid schedules", func() {
+			tasks[0].Schedule = "whenever"
+			_, err := scheduler.New(lagertest.NewTestLogger("test"), fakeClock, fakeClient, guidGenerator, results, tasks)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects duplicate task names", func() {
+			tasks = append(tasks, tasks[0])
+			_, err := scheduler.New(lagertest.NewTestLogger("test"), fakeClock, fakeClient, guidGenerator, results, tasks)
+			Expect(err).To(MatchError("duplicate scheduled task: log-rotation"))
+		})
+
+		It("rejects tasks without an action", func() {
+			tasks[0].Action = nil
+			_, err := scheduler.New(lagertest.NewTestLogger("test"), fakeClock, fakeClient, guidGenerator, results, tasks)
+			Expect(err).To(MatchError("scheduled task log-rotation has no action"))
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package depot
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"golang.org/x/time/rate"
+)
+
+// StartRateLimiter limits how many containers of a single source may be
+// started on the cell per minute, so that a misbehaving scheduler cannot
+// flood the cell with one app. The source of a container is the guid of its
+// metrics config, which is the app guid for LRPs.
+type StartRateLimiter struct {
+	clock           clock.Clock
+	startsPerMinute int
+
+	lock     sync.Mutex
+	limiters map[string]*sourceLimiter
+}
+
+type sourceLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+func NewStartRateLimiter(clock clock.Clock, startsPerMinute int) *StartRateLimiter {
+	return &StartRateLimiter{
+		clock:           clock,
+		startsPerMinute: startsPerMinute,
+		limiters:        map[string]*sourceLimiter{},
+	}
+}
+
+// Allow reports whether a container of the source may be started now. A
+// source may start startsPerMinute containers at once and then one more
+// every 1/startsPerMinute minute. Containers without a source are never
+// limited.
+func (l *StartRateLimiter) Allow(source string) bool {
+	if l == nil || l.startsPerMinute <= 0 || source == "" {
+		return true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.clock.Now()
+	for s, sl := range l.limiters {
+		// a limiter that has not been used for a minute is full again
+		if now.Sub(sl.lastUsed) >= time.Minute {
+			delete(l.limiters, s)
+		}
+	}
+
+	sl, ok := l.limiters[source]
+	if !ok {
+		sl = &sourceLimiter{
+			limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.startsPerMinute)), l.startsPerMinute),
+		}
+		l.limiters[source] = sl
+	}
+	sl.lastUsed = now
+	return sl.limiter.AllowN(now, 1)
+}
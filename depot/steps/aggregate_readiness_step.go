@@ -0,0 +1,84 @@
+package steps
+
+import (
+	"os"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/hashicorp/go-multierror"
+	"github.com/tedsuo/ifrit"
+)
+
+// NamedCheck is a readiness check together with the name its outcome is
+// logged under.
+type NamedCheck struct {
+	Name  string
+	Check ifrit.Runner
+}
+
+type aggregateReadinessStep struct {
+	checks     []NamedCheck
+	requireAll bool
+	logger     lager.Logger
+}
+
+// NewAggregateReadiness runs the readiness checks in parallel. When
+// requireAll is set it succeeds once every check passed and fails when any
+// check fails, like NewParallel. Otherwise it succeeds as soon as one check
+// passes, cancelling the others, and only fails when all of them failed.
+func NewAggregateReadiness(checks []NamedCheck, requireAll bool, logger lager.Logger) ifrit.Runner {
+	return &aggregateReadinessStep{
+		checks:     checks,
+		requireAll: requireAll,
+		logger:     logger.Session("aggregate-readiness"),
+	}
+}
+
+type namedResult struct {
+	name string
+	err  error
+}
+
+func (step *aggregateReadinessStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	results := make(chan namedResult, len(step.checks))
+
+	var subProcesses []ifrit.Process
+	for _, check := range step.checks {
+		subProcess := ifrit.Background(check.Check)
+		subProcesses = append(subProcesses, subProcess)
+		go func(name string) {
+			results <- namedResult{name: name, err: <-subProcess.Wait()}
+		}(check.Name)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go waitForSignal(done, signals, subProcesses)
+	go waitForChildrenToBeReady(done, subProcesses, ready)
+
+	aggregate := &multierror.Error{}
+	aggregate.ErrorFormat = multiErrorFormat
+
+	var passed bool
+	for range subProcesses {
+		result := <-results
+		if result.err != nil {
+			if !passed {
+				step.logger.Info("check-failed", lager.Data{"check": result.name, "error": result.err.Error()})
+				aggregate = multierror.Append(aggregate, result.err)
+			}
+			continue
+		}
+
+		step.logger.Info("check-passed", lager.Data{"check": result.name})
+		if !step.requireAll && !passed {
+			passed = true
+			cancel(subProcesses, os.Interrupt)
+		}
+	}
+
+	if passed {
+		return nil
+	}
+	return aggregate.ErrorOrNil()
+}
@@ -0,0 +1,107 @@
+package steps_test
+
+import (
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
+
+	"code.cloudfoundry.org/executor/depot/steps"
+)
+
+var _ = Describe("AggregateReadinessStep", func() {
+	var (
+		process    ifrit.Process
+		requireAll bool
+		logger     *lagertest.TestLogger
+
+		httpCheck *fake_runner.TestRunner
+		execCheck *fake_runner.TestRunner
+	)
+
+	BeforeEach(func() {
+		httpCheck = fake_runner.NewTestRunner()
+		execCheck = fake_runner.NewTestRunner()
+		requireAll = true
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Background(steps.NewAggregateReadiness([]steps.NamedCheck{
+			{Name: "http-8080", Check: httpCheck},
+			{Name: "exec-/bin/probe", Check: execCheck},
+		}, requireAll, logger))
+		Eventually(httpCheck.RunCallCount).Should(Equal(1))
+		Eventually(execCheck.RunCallCount).Should(Equal(1))
+	})
+
+	AfterEach(func() {
+		httpCheck.EnsureExit()
+		execCheck.EnsureExit()
+	})
+
+	Context("when all checks must pass", func() {
+		It("succeeds once every check passed", func() {
+			httpCheck.TriggerExit(nil)
+			Consistently(process.Wait()).ShouldNot(Receive())
+
+			execCheck.TriggerExit(nil)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("fails when a check fails and attributes the failure to it", func() {
+			httpCheck.TriggerExit(nil)
+			Eventually(logger).Should(gbytes.Say(`check-passed.*"check":"http-8080"`))
+
+			execCheck.TriggerExit(errors.New("exited with status 1"))
+			Eventually(process.Wait()).Should(Receive(MatchError("exited with status 1")))
+			Expect(logger).To(gbytes.Say(`check-failed.*"check":"exec-/bin/probe"`))
+		})
+	})
+
+	Context("when any check may pass", func() {
+		BeforeEach(func() {
+			requireAll = false
+		})
+
+		It("succeeds as soon as one check passed and cancels the others", func() {
+			execCheck.TriggerExit(nil)
+
+			Eventually(httpCheck.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+			httpCheck.TriggerExit(new(steps.CancelledError))
+
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(logger).To(gbytes.Say(`check-passed.*"check":"exec-/bin/probe"`))
+		})
+
+		It("fails when every check failed", func() {
+			httpCheck.TriggerExit(errors.New("connection refused"))
+			Consistently(process.Wait()).ShouldNot(Receive())
+
+			execCheck.TriggerExit(errors.New("exited with status 1"))
+
+			var err error
+			Eventually(process.Wait()).Should(Receive(&err))
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+			Expect(err).To(MatchError(ContainSubstring("exited with status 1")))
+		})
+	})
+
+	Context("when signalled", func() {
+		It("cancels the checks", func() {
+			process.Signal(os.Interrupt)
+
+			Eventually(httpCheck.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+			Eventually(execCheck.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+			httpCheck.TriggerExit(new(steps.CancelledError))
+			execCheck.TriggerExit(new(steps.CancelledError))
+
+			Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+		})
+	})
+})
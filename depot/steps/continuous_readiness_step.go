@@ -0,0 +1,119 @@
+package steps
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+type continuousReadinessStep struct {
+	create            func() ifrit.Runner
+	logger            lager.Logger
+	clock             clock.Clock
+	logStreamer       log_streamer.LogStreamer
+	healthyInterval   time.Duration
+	unhealthyInterval time.Duration
+	failureThreshold  int
+	onTransition      HealthTransitionFunc
+}
+
+// NewContinuousReadinessStep keeps running the readiness check of a container
+// that already became healthy. Unlike a liveness check, a failing check does
+// not fail the step: every change between ready and not ready is reported to
+// onTransition instead, so that the container can be taken out of and put
+// back into routing. A ready container only becomes not ready after
+// failureThreshold consecutive failures, or on the first failure when it is
+// not positive. It only exits when signalled.
+func NewContinuousReadinessStep(
+	create func() ifrit.Runner,
+	logger lager.Logger,
+	clock clock.Clock,
+	logStreamer log_streamer.LogStreamer,
+	healthyInterval time.Duration,
+	unhealthyInterval time.Duration,
+	failureThreshold int,
+	onTransition HealthTransitionFunc,
+) ifrit.Runner {
+	return &continuousReadinessStep{
+		create:            create,
+		logger:            logger.Session("continuous-readiness-step"),
+		clock:             clock,
+		logStreamer:       logStreamer,
+		healthyInterval:   healthyInterval,
+		unhealthyInterval: unhealthyInterval,
+		failureThreshold:  failureThreshold,
+		onTransition:      onTransition,
+	}
+}
+
+func (step *continuousReadinessStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	isReady := true
+	failures := 0
+	lastTransition := step.clock.Now()
+
+	t := step.clock.NewTimer(step.healthyInterval)
+	defer t.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return new(CancelledError)
+		case <-t.C():
+		}
+
+		process := ifrit.Background(step.create())
+
+		var err error
+		select {
+		case err = <-process.Wait():
+		case s := <-signals:
+			process.Signal(s)
+			<-process.Wait()
+			return new(CancelledError)
+		}
+
+		if err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		if isReady && err != nil && failures < step.failureThreshold {
+			step.logger.Info("tolerated-readiness-failure", lager.Data{"step-error": err.Error(), "failures": failures})
+		} else if (err == nil) != isReady {
+			isReady = err == nil
+			duration := step.clock.Since(lastTransition)
+			lastTransition = step.clock.Now()
+
+			if isReady {
+				step.logger.Info("transitioned-to-ready")
+				fmt.Fprint(step.logStreamer.Stdout(), "Container became ready\n")
+				step.transition(isReady, duration, "")
+			} else {
+				step.logger.Info("transitioned-to-not-ready", lager.Data{"step-error": err.Error()})
+				fmt.Fprint(step.logStreamer.Stderr(), "Container became not ready\n")
+				step.transition(isReady, duration, err.Error())
+			}
+		}
+
+		if isReady {
+			t.Reset(step.healthyInterval)
+		} else {
+			t.Reset(step.unhealthyInterval)
+		}
+	}
+}
+
+func (step *continuousReadinessStep) transition(ready bool, duration time.Duration, failureOutput string) {
+	if step.onTransition != nil {
+		step.onTransition(executor.HealthCheckReadiness, ready, duration, failureOutput)
+	}
+}
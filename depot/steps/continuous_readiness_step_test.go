@@ -0,0 +1,138 @@
+package steps_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
+)
+
+var _ = Describe("ContinuousReadinessStep", func() {
+	var (
+		checks       chan *fake_runner.TestRunner
+		clock        *fakeclock.FakeClock
+		fakeStreamer *fake_log_streamer.FakeLogStreamer
+		logger       *lagertest.TestLogger
+		transitions  chan healthTransition
+
+		failureThreshold int
+
+		process ifrit.Process
+	)
+
+	const (
+		healthyInterval   = time.Second
+		unhealthyInterval = 100 * time.Millisecond
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		fakeStreamer = newFakeStreamer()
+		logger = lagertest.NewTestLogger("test")
+		transitions = make(chan healthTransition, 10)
+		checks = make(chan *fake_runner.TestRunner, 1)
+		failureThreshold = 0
+	})
+
+	JustBeforeEach(func() {
+		step := steps.NewContinuousReadinessStep(
+			func() ifrit.Runner {
+				return <-checks
+			},
+			logger,
+			clock,
+			fakeStreamer,
+			healthyInterval,
+			unhealthyInterval,
+			failureThreshold,
+			func(checkType executor.HealthCheckType, healthy bool, duration time.Duration, failureOutput string) {
+				transitions <- healthTransition{checkType: checkType, healthy: healthy, failureOutput: failureOutput}
+			},
+		)
+		process = ifrit.Background(step)
+		Eventually(process.Ready()).Should(BeClosed())
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	runCheck := func(interval time.Duration, err error) {
+		check := fake_runner.NewTestRunner()
+		checks <- check
+		clock.WaitForWatcherAndIncrement(interval)
+		Eventually(check.RunCallCount).Should(Equal(1))
+		check.TriggerExit(err)
+	}
+
+	It("does not report anything while the check keeps passing", func() {
+		runCheck(healthyInterval, nil)
+		runCheck(healthyInterval, nil)
+		Consistently(transitions).ShouldNot(Receive())
+	})
+
+	Context("when the check starts failing", func() {
+		JustBeforeEach(func() {
+			runCheck(healthyInterval, errors.New("not ready"))
+		})
+
+		It("reports the container as not ready without exiting", func() {
+			Eventually(transitions).Should(Receive(Equal(healthTransition{
+				checkType:     executor.HealthCheckReadiness,
+				healthy:       false,
+				failureOutput: "not ready",
+			})))
+			Eventually(fakeStreamer.Stderr().(*gbytes.Buffer)).Should(gbytes.Say("Container became not ready\n"))
+			Consistently(process.Wait()).ShouldNot(Receive())
+		})
+
+		It("checks again after the unhealthy interval and reports the container ready once the check passes", func() {
+			Eventually(transitions).Should(Receive())
+
+			runCheck(unhealthyInterval, nil)
+			Eventually(transitions).Should(Receive(Equal(healthTransition{
+				checkType: executor.HealthCheckReadiness,
+				healthy:   true,
+			})))
+			Eventually(fakeStreamer.Stdout().(*gbytes.Buffer)).Should(gbytes.Say("Container became ready\n"))
+		})
+	})
+
+	Context("when there is a failure threshold", func() {
+		BeforeEach(func() {
+			failureThreshold = 2
+		})
+
+		It("only reports the container as not ready after consecutive failures", func() {
+			runCheck(healthyInterval, errors.New("not ready"))
+			runCheck(healthyInterval, nil)
+			runCheck(healthyInterval, errors.New("not ready"))
+			Consistently(transitions).ShouldNot(Receive())
+
+			runCheck(healthyInterval, errors.New("still not ready"))
+			Eventually(transitions).Should(Receive(Equal(healthTransition{
+				checkType:     executor.HealthCheckReadiness,
+				healthy:       false,
+				failureOutput: "still not ready",
+			})))
+		})
+	})
+
+	Context("when signalled", func() {
+		It("exits with a cancelled error", func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+		})
+	})
+})
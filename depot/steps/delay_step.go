@@ -0,0 +1,42 @@
+package steps
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"github.com/tedsuo/ifrit"
+)
+
+type delayStep struct {
+	substep ifrit.Runner
+	delay   time.Duration
+	clock   clock.Clock
+}
+
+// NewDelay runs substep once delay has passed. It is cancelled without
+// running substep when it is signalled before.
+func NewDelay(substep ifrit.Runner, delay time.Duration, clock clock.Clock) ifrit.Runner {
+	if delay <= 0 {
+		return substep
+	}
+
+	return &delayStep{
+		substep: substep,
+		delay:   delay,
+		clock:   clock,
+	}
+}
+
+func (step *delayStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	timer := step.clock.NewTimer(step.delay)
+	defer timer.Stop()
+
+	select {
+	case <-signals:
+		return new(CancelledError)
+	case <-timer.C():
+	}
+
+	return step.substep.Run(signals, ready)
+}
@@ -0,0 +1,55 @@
+package steps_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor/depot/steps"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
+)
+
+var _ = Describe("DelayStep", func() {
+	var (
+		substep *fake_runner.TestRunner
+		clock   *fakeclock.FakeClock
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		substep = fake_runner.NewTestRunner()
+		clock = fakeclock.NewFakeClock(time.Now())
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Background(steps.NewDelay(substep, time.Second, clock))
+	})
+
+	It("runs the substep once the delay has passed", func() {
+		Consistently(substep.RunCallCount).Should(Equal(0))
+
+		clock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(substep.RunCallCount).Should(Equal(1))
+
+		substep.TriggerExit(nil)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("does not run the substep when signalled before", func() {
+		Eventually(clock.WatcherCount).Should(Equal(1))
+		process.Signal(os.Interrupt)
+
+		Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+		Expect(substep.RunCallCount()).To(Equal(0))
+	})
+
+	It("runs the substep right away without a delay", func() {
+		Expect(steps.NewDelay(substep, 0, clock)).To(BeIdenticalTo(substep))
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+})
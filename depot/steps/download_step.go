@@ -1,6 +1,7 @@
 package steps
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -10,6 +11,7 @@ import (
 	"code.cloudfoundry.org/bytefmt"
 	"code.cloudfoundry.org/cacheddownloader"
 	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/executor/depot/quarantine"
 	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/lager/v3"
 	"github.com/tedsuo/ifrit"
@@ -19,6 +21,7 @@ type downloadStep struct {
 	container        garden.Container
 	model            models.DownloadAction
 	cachedDownloader cacheddownloader.CachedDownloader
+	quarantine       *quarantine.Quarantine
 	streamer         log_streamer.LogStreamer
 	rateLimiter      chan struct{}
 	cancelDownload   chan struct{}
@@ -33,6 +36,20 @@ func NewDownload(
 	rateLimiter chan struct{},
 	streamer log_streamer.LogStreamer,
 	logger lager.Logger,
+) ifrit.Runner {
+	return NewDownloadWithQuarantine(container, model, cachedDownloader, nil, rateLimiter, streamer, logger)
+}
+
+// NewDownloadWithQuarantine scans the downloaded artifact in the quarantine,
+// if any, before extracting it into the container.
+func NewDownloadWithQuarantine(
+	container garden.Container,
+	model models.DownloadAction,
+	cachedDownloader cacheddownloader.CachedDownloader,
+	quarantine *quarantine.Quarantine,
+	rateLimiter chan struct{},
+	streamer log_streamer.LogStreamer,
+	logger lager.Logger,
 ) ifrit.Runner {
 	logger = logger.Session("download-step", lager.Data{
 		"to":       model.To,
@@ -44,6 +61,7 @@ func NewDownload(
 		container:        container,
 		model:            model,
 		cachedDownloader: cachedDownloader,
+		quarantine:       quarantine,
 		streamer:         streamer,
 		rateLimiter:      rateLimiter,
 		logger:           logger,
@@ -95,6 +113,22 @@ func (step *downloadStep) perform() error {
 		return NewEmittableError(err, errString)
 	}
 
+	if step.quarantine != nil {
+		downloadedFile, err = step.quarantine.Inspect(step.logger, downloadedFile)
+		if err != nil {
+			errString := "Scanning failed"
+			if step.model.Artifact != "" {
+				errString = fmt.Sprintf("Scanning %s failed", step.model.Artifact)
+			}
+			var rejected *quarantine.RejectedError
+			if errors.As(err, &rejected) {
+				errString = fmt.Sprintf("%s: %s", errString, rejected.Reason)
+			}
+			step.emitError(fmt.Sprintf("%s\n", errString))
+			return NewEmittableError(err, errString)
+		}
+	}
+
 	err = step.streamIn(step.model.To, downloadedFile)
 	if err != nil {
 		var errString string
@@ -19,6 +19,8 @@ import (
 	"code.cloudfoundry.org/garden"
 
 	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
+	"code.cloudfoundry.org/executor/depot/quarantine"
+	"code.cloudfoundry.org/executor/depot/quarantine/quarantinefakes"
 	"code.cloudfoundry.org/executor/depot/steps"
 	"code.cloudfoundry.org/executor/fakes"
 	. "github.com/onsi/ginkgo/v2"
@@ -330,6 +332,60 @@ var _ = Describe("DownloadAction", func() {
 		})
 	})
 
+	Describe("Quarantine", func() {
+		var (
+			scanner *quarantinefakes.FakeScanner
+			stepErr error
+		)
+
+		BeforeEach(func() {
+			scanner = new(quarantinefakes.FakeScanner)
+			downloadAction.Artifact = "artifact"
+		})
+
+		JustBeforeEach(func() {
+			container, err := gardenClient.Create(garden.ContainerSpec{
+				Handle: handle,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			q, err := quarantine.New(GinkgoT().TempDir(), scanner, quarantine.FailClosed)
+			Expect(err).NotTo(HaveOccurred())
+
+			step = steps.NewDownloadWithQuarantine(
+				container,
+				downloadAction,
+				cache,
+				q,
+				rateLimiter,
+				fakeStreamer,
+				logger,
+			)
+
+			stepErr = <-ifrit.Invoke(step).Wait()
+		})
+
+		It("scans the artifact before streaming it into the container", func() {
+			Expect(stepErr).NotTo(HaveOccurred())
+			Expect(scanner.ScanCallCount()).To(Equal(1))
+			Expect(gardenClient.Connection.StreamInCallCount()).To(Equal(1))
+		})
+
+		Context("when the scanner rejects the artifact", func() {
+			BeforeEach(func() {
+				scanner.ScanReturns(&quarantine.RejectedError{Reason: "infected"})
+			})
+
+			It("fails without streaming it into the container", func() {
+				Expect(stepErr).To(MatchError("Scanning artifact failed: infected"))
+				Expect(gardenClient.Connection.StreamInCallCount()).To(Equal(0))
+
+				stderr := fakeStreamer.Stderr().(*gbytes.Buffer)
+				Expect(stderr).To(gbytes.Say("Scanning artifact failed: infected\n"))
+			})
+		})
+	})
+
 	Describe("Ready", func() {
 		var (
 			p ifrit.Process
@@ -0,0 +1,105 @@
+package steps
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+type execCheckStep struct {
+	container garden.Container
+	check     executor.ExecCheck
+	timeout   time.Duration
+	clock     clock.Clock
+	logger    lager.Logger
+}
+
+// NewExecCheck runs the command of check once in the container and fails
+// unless it exits in time with one of the success exit codes.
+func NewExecCheck(
+	container garden.Container,
+	check executor.ExecCheck,
+	timeout time.Duration,
+	clock clock.Clock,
+	logger lager.Logger,
+) ifrit.Runner {
+	return &execCheckStep{
+		container: container,
+		check:     check,
+		timeout:   timeout,
+		clock:     clock,
+		logger:    logger.Session("exec-check-step"),
+	}
+}
+
+func (step *execCheckStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	output := log_streamer.NewConcurrentBuffer(bytes.NewBuffer(nil))
+	process, err := step.container.Run(garden.ProcessSpec{
+		Path: step.check.Path,
+		Args: step.check.Args,
+		User: step.check.User,
+	}, garden.ProcessIO{
+		Stdout: output,
+		Stderr: output,
+	})
+	if err != nil {
+		step.logger.Error("failed-to-run", err)
+		return err
+	}
+
+	close(ready)
+
+	exited := make(chan error, 1)
+	exitCode := 0
+	go func() {
+		var err error
+		exitCode, err = process.Wait()
+		exited <- err
+	}()
+
+	timer := step.clock.NewTimer(step.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			step.logger.Error("failed-to-wait", err)
+			return err
+		}
+	case <-timer.C():
+		step.kill(process, exited)
+		return fmt.Errorf("Command %s timed out after %s", step.command(), step.timeout)
+	case <-signals:
+		step.kill(process, exited)
+		return new(CancelledError)
+	}
+
+	if !step.check.Succeeded(exitCode) {
+		out, _ := io.ReadAll(output)
+		return fmt.Errorf("Command %s exited with status %d: %s", step.command(), exitCode, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (step *execCheckStep) kill(process garden.Process, exited <-chan error) {
+	err := process.Signal(garden.SignalKill)
+	if err != nil {
+		step.logger.Error("failed-to-kill", err)
+		return
+	}
+	<-exited
+}
+
+func (step *execCheckStep) command() string {
+	return strings.Join(append([]string{step.check.Path}, step.check.Args...), " ")
+}
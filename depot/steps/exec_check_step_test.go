@@ -0,0 +1,123 @@
+package steps_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("ExecCheckStep", func() {
+	var (
+		container   *gardenfakes.FakeContainer
+		fakeProcess *gardenfakes.FakeProcess
+		check       executor.ExecCheck
+		clock       *fakeclock.FakeClock
+		logger      *lagertest.TestLogger
+		exitCodes   chan int
+
+		process ifrit.Process
+	)
+
+	const timeout = 5 * time.Second
+
+	BeforeEach(func() {
+		exitCodes = make(chan int, 1)
+		fakeProcess = &gardenfakes.FakeProcess{}
+		fakeProcess.WaitStub = func() (int, error) {
+			return <-exitCodes, nil
+		}
+		fakeProcess.SignalStub = func(garden.Signal) error {
+			exitCodes <- 137
+			return nil
+		}
+
+		container = &gardenfakes.FakeContainer{}
+		container.RunStub = func(spec garden.ProcessSpec, io garden.ProcessIO) (garden.Process, error) {
+			fmt.Fprint(io.Stderr, "not ready yet\n")
+			return fakeProcess, nil
+		}
+
+		check = executor.ExecCheck{Path: "/bin/probe", Args: []string{"-v"}, User: "vcap"}
+		clock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Background(steps.NewExecCheck(container, check, timeout, clock, logger))
+	})
+
+	It("runs the command in the container", func() {
+		exitCodes <- 0
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+
+		Expect(container.RunCallCount()).To(Equal(1))
+		spec, _ := container.RunArgsForCall(0)
+		Expect(spec.Path).To(Equal("/bin/probe"))
+		Expect(spec.Args).To(Equal([]string{"-v"}))
+		Expect(spec.User).To(Equal("vcap"))
+	})
+
+	It("fails with the output of the command when it exits with another status", func() {
+		exitCodes <- 1
+		var err error
+		Eventually(process.Wait()).Should(Receive(&err))
+		Expect(err).To(MatchError("Command /bin/probe -v exited with status 1: not ready yet"))
+	})
+
+	Context("when there are success exit codes", func() {
+		BeforeEach(func() {
+			check.SuccessExitCodes = []int{0, 3}
+		})
+
+		It("succeeds when the command exits with one of them", func() {
+			exitCodes <- 3
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+	})
+
+	Context("when the command does not exit in time", func() {
+		It("kills the command and fails", func() {
+			clock.WaitForWatcherAndIncrement(timeout)
+
+			var err error
+			Eventually(process.Wait()).Should(Receive(&err))
+			Expect(err).To(MatchError("Command /bin/probe -v timed out after 5s"))
+			Expect(fakeProcess.SignalCallCount()).To(Equal(1))
+			Expect(fakeProcess.SignalArgsForCall(0)).To(Equal(garden.SignalKill))
+		})
+	})
+
+	Context("when running the command fails", func() {
+		disaster := errors.New("boom")
+
+		BeforeEach(func() {
+			container.RunStub = nil
+			container.RunReturns(nil, disaster)
+		})
+
+		It("fails", func() {
+			Eventually(process.Wait()).Should(Receive(Equal(disaster)))
+		})
+	})
+
+	Context("when signalled", func() {
+		It("kills the command", func() {
+			Eventually(container.RunCallCount).Should(Equal(1))
+			process.Signal(os.Interrupt)
+
+			Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+			Expect(fakeProcess.SignalArgsForCall(0)).To(Equal(garden.SignalKill))
+		})
+	})
+})
@@ -6,48 +6,136 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/log_streamer"
 	"code.cloudfoundry.org/lager/v3"
 	"github.com/tedsuo/ifrit"
 )
 
 const (
-	readinessFailureMessage = "Failed after %s: readiness health check never passed.\n"
-	timeoutCrashReason      = "Instance never healthy after %s: %s"
-	healthcheckNowUnhealthy = "Instance became unhealthy: %s"
+	readinessFailureMessage  = "Failed after %s: readiness health check never passed.\n"
+	readinessWaitingMessage  = "Readiness health check has not passed after %s, continuing to wait.\n"
+	timeoutCrashReason       = "Instance never healthy after %s: %s"
+	healthcheckNowUnhealthy  = "Instance became unhealthy: %s"
+	livenessToleratedMessage = "Liveness health check failed (%d of %d tolerated failures), restarting the check.\n"
+	startupProgressMessage   = "Still waiting for startup check to pass (%s / %s)\n"
+	startupProgressNoTimeout = "Still waiting for startup check to pass (%s)\n"
 )
 
+// HealthTransitionFunc is called every time the health check step observes
+// the container becoming healthy or unhealthy. The duration is the time spent
+// in the previous state.
+type HealthTransitionFunc func(checkType executor.HealthCheckType, healthy bool, duration time.Duration, failureOutput string)
+
+// ReadinessFailurePolicy decides what happens to a container whose readiness
+// check has not passed within its start timeout.
+type ReadinessFailurePolicy string
+
+const (
+	// ReadinessFailurePolicyCrash fails the container once the start timeout
+	// has passed. It is the default.
+	ReadinessFailurePolicyCrash ReadinessFailurePolicy = "crash"
+
+	// ReadinessFailurePolicyKeepWaiting reports that the start timeout has
+	// passed and keeps waiting for the readiness check. The readiness check
+	// must not enforce the start timeout itself for this to have an effect.
+	ReadinessFailurePolicyKeepWaiting ReadinessFailurePolicy = "keep-waiting"
+)
+
+// HealthCheckLogSources are the log sources of the output of the readiness
+// check while the container starts, of the liveness check, and of the
+// readiness check once the container is running. The output of a check type
+// whose source is empty stays on the health check log stream.
+type HealthCheckLogSources struct {
+	Startup   string
+	Liveness  string
+	Readiness string
+}
+
+// DefaultHealthCheckLogSources let app developers tell which check produced
+// a failure in their logs.
+var DefaultHealthCheckLogSources = HealthCheckLogSources{
+	Startup:   "STARTUP",
+	Liveness:  "LIVENESS",
+	Readiness: "READINESS",
+}
+
+func withLogSource(streamer log_streamer.LogStreamer, source string) log_streamer.LogStreamer {
+	if source == "" {
+		return streamer
+	}
+	return streamer.WithSource(source)
+}
+
+// LivenessFailureBudget tolerates up to MaxFailures liveness check failures
+// within Window, restarting the liveness check after each of them, before the
+// next failure crashes the container. This keeps transient stalls, like long
+// GC pauses, from crash looping instances. Failures never expire when Window
+// is 0. The zero budget crashes the container on the first failure.
+type LivenessFailureBudget struct {
+	MaxFailures int
+	Window      time.Duration
+}
+
+// LivenessWarningFunc is called for every liveness check failure that is
+// tolerated by the LivenessFailureBudget, with the number of failures within
+// the window so far.
+type LivenessWarningFunc func(failures int, failureOutput string)
+
 type healthCheckStep struct {
-	readinessCheck ifrit.Runner
-	livenessCheck  ifrit.Runner
+	readinessCheck   ifrit.Runner
+	livenessCheck    ifrit.Runner
+	readinessMonitor ifrit.Runner
 
-	logger              lager.Logger
-	clock               clock.Clock
-	logStreamer         log_streamer.LogStreamer
-	healthCheckStreamer log_streamer.LogStreamer
+	logger           lager.Logger
+	clock            clock.Clock
+	logStreamer      log_streamer.LogStreamer
+	startupStreamer  log_streamer.LogStreamer
+	livenessStreamer log_streamer.LogStreamer
 
-	startTimeout time.Duration
+	startTimeout            time.Duration
+	readinessPolicy         ReadinessFailurePolicy
+	startupProgressInterval time.Duration
+	livenessBudget          LivenessFailureBudget
+	onTransition            HealthTransitionFunc
+	onLivenessWarning       LivenessWarningFunc
 }
 
+// NewHealthCheckStep reports on the log stream every startupProgressInterval
+// that the readiness check has not passed yet, unless the interval is 0.
 func NewHealthCheckStep(
 	readinessCheck ifrit.Runner,
 	livenessCheck ifrit.Runner,
+	readinessMonitor ifrit.Runner,
 	logger lager.Logger,
 	clock clock.Clock,
 	logStreamer log_streamer.LogStreamer,
 	healthcheckStreamer log_streamer.LogStreamer,
+	logSources HealthCheckLogSources,
 	startTimeout time.Duration,
+	readinessPolicy ReadinessFailurePolicy,
+	startupProgressInterval time.Duration,
+	livenessBudget LivenessFailureBudget,
+	onTransition HealthTransitionFunc,
+	onLivenessWarning LivenessWarningFunc,
 ) ifrit.Runner {
 	logger = logger.Session("health-check-step")
 
 	return &healthCheckStep{
-		readinessCheck:      readinessCheck,
-		livenessCheck:       livenessCheck,
-		logger:              logger,
-		clock:               clock,
-		logStreamer:         logStreamer,
-		healthCheckStreamer: healthcheckStreamer,
-		startTimeout:        startTimeout,
+		readinessCheck:          readinessCheck,
+		livenessCheck:           livenessCheck,
+		readinessMonitor:        readinessMonitor,
+		logger:                  logger,
+		clock:                   clock,
+		logStreamer:             logStreamer,
+		startupStreamer:         withLogSource(healthcheckStreamer, logSources.Startup),
+		livenessStreamer:        withLogSource(healthcheckStreamer, logSources.Liveness),
+		startTimeout:            startTimeout,
+		readinessPolicy:         readinessPolicy,
+		startupProgressInterval: startupProgressInterval,
+		livenessBudget:          livenessBudget,
+		onTransition:            onTransition,
+		onLivenessWarning:       onLivenessWarning,
 	}
 }
 
@@ -59,41 +147,126 @@ func (step *healthCheckStep) Run(signals <-chan os.Signal, ready chan<- struct{}
 
 	healthCheckStartedTime := time.Now()
 
-	select {
-	case err := <-readinessProcess.Wait():
-		if err != nil {
-			healthCheckFailedTime := time.Since(healthCheckStartedTime).Round(time.Millisecond)
-			//TODO: make this use metron agent directly, don't use log streamer, shouldn't be rate limited.
-			fmt.Fprintf(step.healthCheckStreamer.Stderr(), "%s\n", err.Error())
-			fmt.Fprintf(step.logStreamer.Stderr(), readinessFailureMessage, healthCheckFailedTime)
-			step.logger.Info("timed-out-before-healthy", lager.Data{
-				"step-error": err.Error(),
+	var startTimeoutPassed <-chan time.Time
+	if step.readinessPolicy == ReadinessFailurePolicyKeepWaiting && step.startTimeout > 0 {
+		timer := step.clock.NewTimer(step.startTimeout)
+		defer timer.Stop()
+		startTimeoutPassed = timer.C()
+	}
+
+	var startupProgress <-chan time.Time
+	startupStartedTime := step.clock.Now()
+	if step.startupProgressInterval > 0 {
+		ticker := step.clock.NewTicker(step.startupProgressInterval)
+		defer ticker.Stop()
+		startupProgress = ticker.C()
+	}
+
+waitForReadiness:
+	for {
+		select {
+		case err := <-readinessProcess.Wait():
+			if err != nil {
+				healthCheckFailedTime := time.Since(healthCheckStartedTime).Round(time.Millisecond)
+				//TODO: make this use metron agent directly, don't use log streamer, shouldn't be rate limited.
+				fmt.Fprintf(step.startupStreamer.Stderr(), "%s\n", err.Error())
+				fmt.Fprintf(step.logStreamer.Stderr(), readinessFailureMessage, healthCheckFailedTime)
+				step.logger.Info("timed-out-before-healthy", lager.Data{
+					"step-error": err.Error(),
+				})
+				step.transition(executor.HealthCheckReadiness, false, healthCheckFailedTime, err.Error())
+				return NewEmittableError(err, timeoutCrashReason, healthCheckFailedTime, err.Error())
+			}
+			break waitForReadiness
+		case <-startTimeoutPassed:
+			startTimeoutPassed = nil
+			step.logger.Info("start-timeout-passed-waiting-for-readiness", lager.Data{
+				"start-timeout": step.startTimeout.String(),
 			})
-			return NewEmittableError(err, timeoutCrashReason, healthCheckFailedTime, err.Error())
+			fmt.Fprintf(step.logStreamer.Stderr(), readinessWaitingMessage, step.startTimeout)
+		case <-startupProgress:
+			waited := step.clock.Since(startupStartedTime).Round(time.Second)
+			if step.startTimeout > 0 {
+				fmt.Fprintf(step.logStreamer.Stdout(), startupProgressMessage, waited, step.startTimeout)
+			} else {
+				fmt.Fprintf(step.logStreamer.Stdout(), startupProgressNoTimeout, waited)
+			}
+		case s := <-signals:
+			readinessProcess.Signal(s)
+			<-readinessProcess.Wait()
+			return new(CancelledError)
 		}
-	case s := <-signals:
-		readinessProcess.Signal(s)
-		<-readinessProcess.Wait()
-		return new(CancelledError)
 	}
 
 	step.logger.Info("transitioned-to-healthy")
+	step.transition(executor.HealthCheckReadiness, true, time.Since(healthCheckStartedTime), "")
 	//TODO: make this use metron agent directly, don't use log streamer, shouldn't be rate limited.
 	fmt.Fprint(step.logStreamer.Stdout(), "Container became healthy\n")
 	close(ready)
 
-	livenessProcess := ifrit.Background(step.livenessCheck)
-
-	select {
-	case err := <-livenessProcess.Wait():
-		step.logger.Info("transitioned-to-unhealthy")
-		//TODO: make this use metron agent directly, don't use log streamer, shouldn't be rate limited.
-		fmt.Fprintf(step.healthCheckStreamer.Stderr(), "%s\n", err.Error())
-		fmt.Fprint(step.logStreamer.Stderr(), "Container became unhealthy\n")
-		return NewEmittableError(err, healthcheckNowUnhealthy, err.Error())
-	case s := <-signals:
-		livenessProcess.Signal(s)
-		<-livenessProcess.Wait()
-		return new(CancelledError)
+	// the readiness monitor, if any, only reports changes in readiness while
+	// the liveness check decides whether the container keeps running
+	if step.readinessMonitor != nil {
+		readinessMonitorProcess := ifrit.Background(step.readinessMonitor)
+		defer func() {
+			readinessMonitorProcess.Signal(os.Interrupt)
+			<-readinessMonitorProcess.Wait()
+		}()
+	}
+
+	healthyTime := time.Now()
+	var livenessFailures []time.Time
+
+	for {
+		livenessProcess := ifrit.Background(step.livenessCheck)
+
+		select {
+		case err := <-livenessProcess.Wait():
+			livenessFailures = step.recentLivenessFailures(append(livenessFailures, step.clock.Now()))
+			if len(livenessFailures) <= step.livenessBudget.MaxFailures {
+				step.logger.Info("tolerated-liveness-failure", lager.Data{
+					"step-error": err.Error(),
+					"failures":   len(livenessFailures),
+				})
+				fmt.Fprintf(step.livenessStreamer.Stderr(), "%s\n", err.Error())
+				fmt.Fprintf(step.logStreamer.Stderr(), livenessToleratedMessage, len(livenessFailures), step.livenessBudget.MaxFailures)
+				if step.onLivenessWarning != nil {
+					step.onLivenessWarning(len(livenessFailures), err.Error())
+				}
+				continue
+			}
+
+			step.logger.Info("transitioned-to-unhealthy")
+			step.transition(executor.HealthCheckLiveness, false, time.Since(healthyTime), err.Error())
+			//TODO: make this use metron agent directly, don't use log streamer, shouldn't be rate limited.
+			fmt.Fprintf(step.livenessStreamer.Stderr(), "%s\n", err.Error())
+			fmt.Fprint(step.logStreamer.Stderr(), "Container became unhealthy\n")
+			return NewEmittableError(err, healthcheckNowUnhealthy, err.Error())
+		case s := <-signals:
+			livenessProcess.Signal(s)
+			<-livenessProcess.Wait()
+			return new(CancelledError)
+		}
+	}
+}
+
+func (step *healthCheckStep) recentLivenessFailures(failures []time.Time) []time.Time {
+	if step.livenessBudget.Window <= 0 {
+		return failures
+	}
+
+	now := step.clock.Now()
+	var recent []time.Time
+	for _, t := range failures {
+		if now.Sub(t) < step.livenessBudget.Window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+func (step *healthCheckStep) transition(checkType executor.HealthCheckType, healthy bool, duration time.Duration, failureOutput string) {
+	if step.onTransition != nil {
+		step.onTransition(checkType, healthy, duration, failureOutput)
 	}
 }
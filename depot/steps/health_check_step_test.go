@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
 	"code.cloudfoundry.org/executor/depot/steps"
 	"code.cloudfoundry.org/lager/v3/lagertest"
@@ -18,14 +19,27 @@ import (
 	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
 )
 
+type healthTransition struct {
+	checkType     executor.HealthCheckType
+	healthy       bool
+	failureOutput string
+}
+
 var _ = Describe("NewHealthCheckStep", func() {
 	var (
 		readinessCheck, livenessCheck *fake_runner.TestRunner
+		readinessMonitor              ifrit.Runner
 		clock                         *fakeclock.FakeClock
 		fakeStreamer                  *fake_log_streamer.FakeLogStreamer
 		fakeHealthCheckStreamer       *fake_log_streamer.FakeLogStreamer
+		logSources                    steps.HealthCheckLogSources
 
-		startTimeout time.Duration
+		startTimeout            time.Duration
+		readinessPolicy         steps.ReadinessFailurePolicy
+		startupProgressInterval time.Duration
+		livenessBudget          steps.LivenessFailureBudget
+		transitions             chan healthTransition
+		warnings                chan int
 
 		step    ifrit.Runner
 		process ifrit.Process
@@ -34,9 +48,16 @@ var _ = Describe("NewHealthCheckStep", func() {
 
 	BeforeEach(func() {
 		startTimeout = 1 * time.Second
+		readinessPolicy = steps.ReadinessFailurePolicyCrash
+		startupProgressInterval = 0
+		livenessBudget = steps.LivenessFailureBudget{}
+		transitions = make(chan healthTransition, 10)
+		warnings = make(chan int, 10)
 
 		readinessCheck = fake_runner.NewTestRunner()
 		livenessCheck = fake_runner.NewTestRunner()
+		readinessMonitor = nil
+		logSources = steps.HealthCheckLogSources{}
 
 		clock = fakeclock.NewFakeClock(time.Now())
 
@@ -52,11 +73,22 @@ var _ = Describe("NewHealthCheckStep", func() {
 		step = steps.NewHealthCheckStep(
 			readinessCheck,
 			livenessCheck,
+			readinessMonitor,
 			logger,
 			clock,
 			fakeStreamer,
 			fakeHealthCheckStreamer,
+			logSources,
 			startTimeout,
+			readinessPolicy,
+			startupProgressInterval,
+			livenessBudget,
+			func(checkType executor.HealthCheckType, healthy bool, duration time.Duration, failureOutput string) {
+				transitions <- healthTransition{checkType: checkType, healthy: healthy, failureOutput: failureOutput}
+			},
+			func(failures int, failureOutput string) {
+				warnings <- failures
+			},
 		)
 
 		process = ifrit.Background(step)
@@ -107,6 +139,81 @@ var _ = Describe("NewHealthCheckStep", func() {
 					"Failed after .*: readiness health check never passed.\n",
 				))
 			})
+
+			It("reports the readiness failure", func() {
+				Eventually(transitions).Should(Receive(Equal(healthTransition{
+					checkType:     executor.HealthCheckReadiness,
+					healthy:       false,
+					failureOutput: "booom!",
+				})))
+			})
+		})
+
+		Context("when the start timeout passes", func() {
+			It("does not report it", func() {
+				clock.Increment(startTimeout)
+				Consistently(fakeStreamer.Stderr().(*gbytes.Buffer)).ShouldNot(gbytes.Say("continuing to wait"))
+				readinessCheck.TriggerExit(nil)
+				Eventually(process.Ready()).Should(BeClosed())
+			})
+
+			Context("with the keep-waiting policy", func() {
+				BeforeEach(func() {
+					readinessPolicy = steps.ReadinessFailurePolicyKeepWaiting
+				})
+
+				It("reports the timeout and keeps waiting for the readiness check", func() {
+					clock.WaitForWatcherAndIncrement(startTimeout)
+					Eventually(fakeStreamer.Stderr().(*gbytes.Buffer)).Should(gbytes.Say(
+						"Readiness health check has not passed after 1s, continuing to wait.\n",
+					))
+					Eventually(logger.TestSink.LogMessages).Should(ContainElement(
+						"test.health-check-step.start-timeout-passed-waiting-for-readiness",
+					))
+					Consistently(process.Wait()).ShouldNot(Receive())
+
+					readinessCheck.TriggerExit(nil)
+					Eventually(process.Ready()).Should(BeClosed())
+				})
+			})
+		})
+
+		Context("when there is a startup progress interval", func() {
+			BeforeEach(func() {
+				startTimeout = 5 * time.Minute
+				startupProgressInterval = 15 * time.Second
+			})
+
+			It("reports how long it has been waiting for the readiness check", func() {
+				clock.WaitForWatcherAndIncrement(15 * time.Second)
+				Eventually(fakeStreamer.Stdout().(*gbytes.Buffer)).Should(gbytes.Say(
+					`Still waiting for startup check to pass \(15s / 5m0s\)\n`,
+				))
+
+				clock.Increment(15 * time.Second)
+				Eventually(fakeStreamer.Stdout().(*gbytes.Buffer)).Should(gbytes.Say(
+					`Still waiting for startup check to pass \(30s / 5m0s\)\n`,
+				))
+
+				readinessCheck.TriggerExit(nil)
+				Eventually(process.Ready()).Should(BeClosed())
+
+				clock.Increment(15 * time.Second)
+				Consistently(fakeStreamer.Stdout().(*gbytes.Buffer)).ShouldNot(gbytes.Say("Still waiting"))
+			})
+
+			Context("and no start timeout", func() {
+				BeforeEach(func() {
+					startTimeout = 0
+				})
+
+				It("only reports how long it has been waiting", func() {
+					clock.WaitForWatcherAndIncrement(15 * time.Second)
+					Eventually(fakeStreamer.Stdout().(*gbytes.Buffer)).Should(gbytes.Say(
+						`Still waiting for startup check to pass \(15s\)\n`,
+					))
+				})
+			})
 		})
 
 		Context("when the readiness check passes", func() {
@@ -130,6 +237,42 @@ var _ = Describe("NewHealthCheckStep", func() {
 				}))
 			})
 
+			It("reports the container becoming healthy", func() {
+				Eventually(transitions).Should(Receive(Equal(healthTransition{
+					checkType: executor.HealthCheckReadiness,
+					healthy:   true,
+				})))
+			})
+
+			Context("and there is a readiness monitor", func() {
+				var monitor *fake_runner.TestRunner
+
+				BeforeEach(func() {
+					monitor = fake_runner.NewTestRunner()
+					readinessMonitor = monitor
+				})
+
+				AfterEach(func() {
+					monitor.EnsureExit()
+				})
+
+				It("runs the readiness monitor once the container is healthy", func() {
+					Eventually(process.Ready()).Should(BeClosed())
+					Eventually(monitor.RunCallCount).Should(Equal(1))
+				})
+
+				It("stops the readiness monitor when the liveness check fails", func() {
+					Eventually(monitor.RunCallCount).Should(Equal(1))
+
+					livenessCheck.TriggerExit(errors.New("oh no!"))
+					livenessCheck = nil
+
+					Eventually(monitor.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+					monitor.TriggerExit(nil)
+					Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+				})
+			})
+
 			Context("and the liveness check fails", func() {
 				disaster := errors.New("oh no!")
 
@@ -157,11 +300,99 @@ var _ = Describe("NewHealthCheckStep", func() {
 					)
 				})
 
+				Context("when there are per check type log sources", func() {
+					var fakeLivenessStreamer *fake_log_streamer.FakeLogStreamer
+
+					BeforeEach(func() {
+						logSources = steps.DefaultHealthCheckLogSources
+						fakeLivenessStreamer = newFakeStreamer()
+						fakeHealthCheckStreamer.WithSourceReturns(fakeLivenessStreamer)
+					})
+
+					It("emits the healthcheck process response under the liveness source", func() {
+						Eventually(fakeLivenessStreamer.Stderr().(*gbytes.Buffer)).Should(
+							gbytes.Say("oh no!\n"),
+						)
+						Expect(fakeHealthCheckStreamer.WithSourceCallCount()).To(Equal(2))
+						Expect(fakeHealthCheckStreamer.WithSourceArgsForCall(1)).To(Equal("LIVENESS"))
+					})
+				})
+
 				It("completes with failure", func() {
 					var err *steps.EmittableError
 					Eventually(process.Wait()).Should(Receive(&err))
 					Expect(err.WrappedError()).To(Equal(disaster))
 				})
+
+				It("reports the liveness failure after the container became healthy", func() {
+					Eventually(transitions).Should(Receive(Equal(healthTransition{
+						checkType: executor.HealthCheckReadiness,
+						healthy:   true,
+					})))
+					Eventually(transitions).Should(Receive(Equal(healthTransition{
+						checkType:     executor.HealthCheckLiveness,
+						healthy:       false,
+						failureOutput: "oh no!",
+					})))
+				})
+			})
+
+			Context("and there is a liveness failure budget", func() {
+				var budgetedCheck *fake_runner.TestRunner
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					livenessBudget = steps.LivenessFailureBudget{MaxFailures: 1, Window: time.Minute}
+				})
+
+				JustBeforeEach(func() {
+					budgetedCheck = livenessCheck
+					livenessCheck = nil
+					budgetedCheck.TriggerExit(disaster)
+					Eventually(budgetedCheck.RunCallCount).Should(Equal(2))
+				})
+
+				AfterEach(func() {
+					if budgetedCheck != nil {
+						budgetedCheck.TriggerExit(disaster)
+						Eventually(process.Wait()).Should(Receive())
+					}
+				})
+
+				It("restarts the liveness check and reports a warning", func() {
+					Eventually(warnings).Should(Receive(Equal(1)))
+					Eventually(fakeStreamer.Stderr().(*gbytes.Buffer)).Should(
+						gbytes.Say("Liveness health check failed \\(1 of 1 tolerated failures\\), restarting the check.\n"),
+					)
+					Consistently(process.Wait()).ShouldNot(Receive())
+				})
+
+				Context("when the liveness check fails again within the window", func() {
+					JustBeforeEach(func() {
+						budgetedCheck.TriggerExit(disaster)
+					})
+
+					It("completes with failure", func() {
+						var err *steps.EmittableError
+						Eventually(process.Wait()).Should(Receive(&err))
+						Expect(err.WrappedError()).To(Equal(disaster))
+						budgetedCheck = nil
+					})
+				})
+
+				Context("when the liveness check fails again after the window", func() {
+					JustBeforeEach(func() {
+						clock.Increment(2 * time.Minute)
+						budgetedCheck.TriggerExit(disaster)
+					})
+
+					It("tolerates the failure", func() {
+						Eventually(budgetedCheck.RunCallCount).Should(Equal(3))
+						Eventually(warnings).Should(Receive(Equal(1)))
+						Eventually(warnings).Should(Receive(Equal(1)))
+						Consistently(process.Wait()).ShouldNot(Receive())
+					})
+				})
 			})
 		})
 	})
@@ -180,6 +411,17 @@ var _ = Describe("NewHealthCheckStep", func() {
 				readinessCheck.TriggerExit(nil)
 				Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
 			})
+
+			It("does not exit until the in-flight check has exited", func() {
+				Eventually(readinessCheck.RunCallCount).Should(Equal(1))
+
+				process.Signal(os.Interrupt)
+				Eventually(readinessCheck.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+				Consistently(process.Wait()).ShouldNot(Receive())
+
+				readinessCheck.TriggerExit(nil)
+				Eventually(process.Wait()).Should(Receive())
+			})
 		})
 
 		Context("when readiness check passes", func() {
@@ -195,6 +437,45 @@ var _ = Describe("NewHealthCheckStep", func() {
 					livenessCheck = nil
 					Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
 				})
+
+				It("does not exit until the in-flight check has exited", func() {
+					readinessCheck.TriggerExit(nil)
+					Eventually(livenessCheck.RunCallCount).Should(Equal(1))
+
+					process.Signal(os.Interrupt)
+					Eventually(livenessCheck.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+					Consistently(process.Wait()).ShouldNot(Receive())
+
+					livenessCheck.TriggerExit(nil)
+					livenessCheck = nil
+					Eventually(process.Wait()).Should(Receive())
+				})
+			})
+
+			Context("and there is a readiness monitor", func() {
+				var monitor *fake_runner.TestRunner
+
+				BeforeEach(func() {
+					monitor = fake_runner.NewTestRunner()
+					readinessMonitor = monitor
+				})
+
+				It("does not exit until the readiness monitor has exited", func() {
+					readinessCheck.TriggerExit(nil)
+					Eventually(monitor.RunCallCount).Should(Equal(1))
+					Eventually(livenessCheck.RunCallCount).Should(Equal(1))
+
+					process.Signal(os.Interrupt)
+					Eventually(livenessCheck.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+					livenessCheck.TriggerExit(nil)
+					livenessCheck = nil
+
+					Eventually(monitor.WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+					Consistently(process.Wait()).ShouldNot(Receive())
+
+					monitor.TriggerExit(nil)
+					Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+				})
 			})
 		})
 	})
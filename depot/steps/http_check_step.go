@@ -0,0 +1,102 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+// maxHTTPCheckBodyBytes bounds how much of a response body is searched for
+// the expected substring.
+const maxHTTPCheckBodyBytes = 1024 * 1024
+
+type httpCheckStep struct {
+	client  *http.Client
+	url     string
+	options executor.HTTPCheckOptions
+	timeout time.Duration
+	logger  lager.Logger
+}
+
+// NewHTTPCheck makes a single request to url and fails unless the response
+// matches the expectations of options.
+func NewHTTPCheck(
+	client *http.Client,
+	url string,
+	options executor.HTTPCheckOptions,
+	timeout time.Duration,
+	logger lager.Logger,
+) ifrit.Runner {
+	return &httpCheckStep{
+		client:  client,
+		url:     url,
+		options: options,
+		timeout: timeout,
+		logger:  logger.Session("http-check-step"),
+	}
+}
+
+func (step *httpCheckStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), step.timeout)
+	defer cancel()
+
+	close(ready)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- step.check(ctx)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-signals:
+		cancel()
+		<-errs
+		return new(CancelledError)
+	}
+}
+
+func (step *httpCheckStep) check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, step.url, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range step.options.Headers {
+		req.Header.Set(name, value)
+	}
+	if step.options.Host != "" {
+		req.Host = step.options.Host
+	}
+
+	resp, err := step.client.Do(req)
+	if err != nil {
+		step.logger.Debug("request-failed", lager.Data{"error": err.Error()})
+		return fmt.Errorf("Failed to make HTTP request to '%s': %s", step.url, err)
+	}
+	defer resp.Body.Close()
+
+	if !step.options.ExpectsStatus(resp.StatusCode) {
+		return fmt.Errorf("Failed to make HTTP request to '%s': received status code %d", step.url, resp.StatusCode)
+	}
+
+	if step.options.BodyContains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPCheckBodyBytes))
+		if err != nil {
+			return fmt.Errorf("Failed to read HTTP response from '%s': %s", step.url, err)
+		}
+		if !strings.Contains(string(body), step.options.BodyContains) {
+			return fmt.Errorf("HTTP response from '%s' does not contain %q", step.url, step.options.BodyContains)
+		}
+	}
+
+	return nil
+}
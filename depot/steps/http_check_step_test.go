@@ -0,0 +1,143 @@
+package steps_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("HTTPCheckStep", func() {
+	var (
+		server   *httptest.Server
+		handler  http.HandlerFunc
+		requests chan *http.Request
+		options  executor.HTTPCheckOptions
+		timeout  time.Duration
+		logger   *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 1)
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("all good"))
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests <- req
+			handler(w, req)
+		}))
+		options = executor.HTTPCheckOptions{}
+		timeout = time.Second
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	runCheck := func() error {
+		step := steps.NewHTTPCheck(server.Client(), server.URL+"/health", options, timeout, logger)
+		return <-ifrit.Invoke(step).Wait()
+	}
+
+	It("succeeds when the response has a 2xx status code", func() {
+		Expect(runCheck()).To(Succeed())
+
+		var req *http.Request
+		Expect(requests).To(Receive(&req))
+		Expect(req.URL.Path).To(Equal("/health"))
+	})
+
+	It("fails when the response has another status code", func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		Expect(runCheck()).To(MatchError(ContainSubstring("received status code 503")))
+	})
+
+	Context("when there are custom headers and a host", func() {
+		BeforeEach(func() {
+			options.Headers = map[string]string{"X-Probe": "executor"}
+			options.Host = "app.example.com"
+		})
+
+		It("sends them with the request", func() {
+			Expect(runCheck()).To(Succeed())
+
+			var req *http.Request
+			Expect(requests).To(Receive(&req))
+			Expect(req.Header.Get("X-Probe")).To(Equal("executor"))
+			Expect(req.Host).To(Equal("app.example.com"))
+		})
+	})
+
+	Context("when there are expected status ranges", func() {
+		BeforeEach(func() {
+			options.ExpectedStatuses = []executor.StatusRange{{Min: 300, Max: 399}}
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNotModified)
+			}
+		})
+
+		It("succeeds when the status code is in a range", func() {
+			Expect(runCheck()).To(Succeed())
+		})
+
+		It("fails when the status code is not in a range", func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {}
+			Expect(runCheck()).To(MatchError(ContainSubstring("received status code 200")))
+		})
+	})
+
+	Context("when the body must contain a substring", func() {
+		BeforeEach(func() {
+			options.BodyContains = "good"
+		})
+
+		It("succeeds when the body contains it", func() {
+			Expect(runCheck()).To(Succeed())
+		})
+
+		It("fails when the body does not contain it", func() {
+			options.BodyContains = "bad"
+			Expect(runCheck()).To(MatchError(ContainSubstring(`does not contain "bad"`)))
+		})
+	})
+
+	Context("when the request times out", func() {
+		BeforeEach(func() {
+			timeout = 10 * time.Millisecond
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				<-req.Context().Done()
+			}
+		})
+
+		It("fails", func() {
+			Expect(runCheck()).To(MatchError(ContainSubstring("Failed to make HTTP request")))
+		})
+	})
+
+	Context("when signalled", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				<-req.Context().Done()
+			}
+		})
+
+		It("cancels the request", func() {
+			step := steps.NewHTTPCheck(server.Client(), server.URL, options, time.Minute, logger)
+			process := ifrit.Background(step)
+			Eventually(requests).Should(Receive())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+		})
+	})
+})
@@ -12,24 +12,35 @@ import (
 
 func NewMonitor(
 	checkFunc func() ifrit.Runner,
+	readinessMonitor ifrit.Runner,
 	logger lager.Logger,
 	clock clock.Clock,
 	logStreamer log_streamer.LogStreamer,
 	startTimeout time.Duration,
+	readinessPolicy ReadinessFailurePolicy,
+	startupProgressInterval time.Duration,
+	livenessBudget LivenessFailureBudget,
 	healthyInterval time.Duration,
 	unhealthyInterval time.Duration,
 	workPool *workpool.WorkPool,
+	onTransition HealthTransitionFunc,
+	onLivenessWarning LivenessWarningFunc,
 	proxyReadinessChecks ...ifrit.Runner,
 ) ifrit.Runner {
 	throttledCheckFunc := func() ifrit.Runner {
 		return NewThrottle(checkFunc(), workPool)
 	}
 
-	readiness := NewEventuallySucceedsStep(throttledCheckFunc, unhealthyInterval, startTimeout, clock)
+	readinessTimeout := startTimeout
+	if readinessPolicy == ReadinessFailurePolicyKeepWaiting {
+		readinessTimeout = 0
+	}
+
+	readiness := NewEventuallySucceedsStep(throttledCheckFunc, unhealthyInterval, readinessTimeout, clock)
 	liveness := NewConsistentlySucceedsStep(throttledCheckFunc, healthyInterval, clock)
 
 	// add the proxy readiness checks (if any)
 	readiness = NewParallel(append(proxyReadinessChecks, readiness))
 
-	return NewHealthCheckStep(readiness, liveness, logger, clock, logStreamer, logStreamer, startTimeout)
+	return NewHealthCheckStep(readiness, liveness, readinessMonitor, logger, clock, logStreamer, logStreamer, HealthCheckLogSources{}, startTimeout, readinessPolicy, startupProgressInterval, livenessBudget, onTransition, onLivenessWarning)
 }
@@ -30,6 +30,7 @@ var _ = Describe("MonitorStep", func() {
 		fakeStreamer *fake_log_streamer.FakeLogStreamer
 
 		startTimeout      time.Duration
+		readinessPolicy   steps.ReadinessFailurePolicy
 		healthyInterval   time.Duration
 		unhealthyInterval time.Duration
 
@@ -48,6 +49,7 @@ var _ = Describe("MonitorStep", func() {
 		checkGoroutines = false
 
 		startTimeout = 0
+		readinessPolicy = steps.ReadinessFailurePolicyCrash
 		healthyInterval = 1 * time.Second
 		unhealthyInterval = 500 * time.Millisecond
 
@@ -77,13 +79,19 @@ var _ = Describe("MonitorStep", func() {
 
 		step = steps.NewMonitor(
 			checkFunc,
+			nil,
 			logger,
 			clock,
 			fakeStreamer,
 			startTimeout,
+			readinessPolicy,
+			0,
+			steps.LivenessFailureBudget{},
 			healthyInterval,
 			unhealthyInterval,
 			workPool,
+			nil,
+			nil,
 		)
 	})
 
@@ -264,6 +272,23 @@ var _ = Describe("MonitorStep", func() {
 				})
 			})
 
+			Context("and the start timeout is exceeded with the keep-waiting policy", func() {
+				BeforeEach(func() {
+					startTimeout = 60 * time.Millisecond
+					unhealthyInterval = 30 * time.Millisecond
+					readinessPolicy = steps.ReadinessFailurePolicyKeepWaiting
+				})
+
+				It("reports the timeout and keeps checking", func() {
+					expectCheckAfterInterval(fakeStep1, unhealthyInterval)
+					expectCheckAfterInterval(fakeStep2, unhealthyInterval)
+					Eventually(fakeStreamer.Stderr().(*gbytes.Buffer)).Should(gbytes.Say(
+						"Readiness health check has not passed after 60ms, continuing to wait.\n",
+					))
+					Consistently(process.Wait()).ShouldNot(Receive())
+				})
+			})
+
 			Context("and the unhealthy interval passes", func() {
 				JustBeforeEach(func() {
 					expectCheckAfterInterval(fakeStep1, unhealthyInterval)
@@ -0,0 +1,180 @@
+package steps
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	ProcessWatchdogLimitExceeded = "ProcessWatchdogLimitExceeded"
+
+	processWatchdogWarning = "Process watchdog: %s\n"
+	processWatchdogReason  = "Instance exceeded process watchdog limit: %s"
+)
+
+// processWatchdogScript prints the number of processes, zombie processes and
+// open file descriptors visible in /proc of the container. It only relies on
+// a POSIX shell so that it works with any rootfs.
+const processWatchdogScript = `p=0; z=0; f=0
+for d in /proc/[0-9]*; do
+  s=$(cat "$d/stat" 2>/dev/null) || continue
+  p=$((p+1))
+  case "${s##*) }" in Z*) z=$((z+1));; esac
+  f=$((f+$(ls "$d/fd" 2>/dev/null | wc -l)))
+done
+echo "$p $z $f"`
+
+type processStats struct {
+	Processes int
+	Zombies   int
+	OpenFiles int
+}
+
+type processWatchdogStep struct {
+	container    garden.Container
+	limits       executor.ProcessWatchdog
+	logger       lager.Logger
+	clock        clock.Clock
+	logStreamer  log_streamer.LogStreamer
+	metronClient loggingclient.IngressClient
+	interval     time.Duration
+}
+
+// NewProcessWatchdog periodically samples the processes of the container and
+// warns about the samples that exceed the limits. It only exits, with an
+// EmittableError, when limits.FailOnLimit is set.
+func NewProcessWatchdog(
+	container garden.Container,
+	limits executor.ProcessWatchdog,
+	logger lager.Logger,
+	clock clock.Clock,
+	logStreamer log_streamer.LogStreamer,
+	metronClient loggingclient.IngressClient,
+	interval time.Duration,
+) ifrit.Runner {
+	return &processWatchdogStep{
+		container:    container,
+		limits:       limits,
+		logger:       logger.Session("process-watchdog-step"),
+		clock:        clock,
+		logStreamer:  logStreamer,
+		metronClient: metronClient,
+		interval:     interval,
+	}
+}
+
+func (step *processWatchdogStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := step.clock.NewTicker(step.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	// only warn when a limit starts being exceeded, not on every sample
+	exceeded := map[string]bool{}
+
+	for {
+		select {
+		case <-signals:
+			return new(CancelledError)
+
+		case <-ticker.C():
+			stats, err := step.sample()
+			if err != nil {
+				step.logger.Error("failed-to-sample", err)
+				continue
+			}
+
+			current := map[string]bool{}
+			for _, violation := range step.check(stats) {
+				current[violation.resource] = true
+				if exceeded[violation.resource] {
+					continue
+				}
+
+				step.logger.Info("limit-exceeded", lager.Data{
+					"resource": violation.resource,
+					"count":    violation.count,
+					"limit":    violation.limit,
+				})
+				fmt.Fprintf(step.logStreamer.Stderr(), processWatchdogWarning, violation)
+
+				err := step.metronClient.IncrementCounter(ProcessWatchdogLimitExceeded)
+				if err != nil {
+					step.logger.Error("failed-to-increment-counter", err)
+				}
+
+				if step.limits.FailOnLimit {
+					return NewEmittableError(nil, processWatchdogReason, violation)
+				}
+			}
+			exceeded = current
+		}
+	}
+}
+
+type processWatchdogViolation struct {
+	resource string
+	count    int
+	limit    int
+}
+
+func (v processWatchdogViolation) String() string {
+	return fmt.Sprintf("%d %s exceeds the limit of %d", v.count, v.resource, v.limit)
+}
+
+func (step *processWatchdogStep) check(stats processStats) []processWatchdogViolation {
+	var violations []processWatchdogViolation
+	for _, v := range []processWatchdogViolation{
+		{resource: "processes", count: stats.Processes, limit: step.limits.MaxProcesses},
+		{resource: "zombie processes", count: stats.Zombies, limit: step.limits.MaxZombies},
+		{resource: "open files", count: stats.OpenFiles, limit: step.limits.MaxOpenFiles},
+	} {
+		if v.limit > 0 && v.count > v.limit {
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
+
+func (step *processWatchdogStep) sample() (processStats, error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	process, err := step.container.Run(garden.ProcessSpec{
+		Path: "sh",
+		Args: []string{"-c", processWatchdogScript},
+		User: "root",
+	}, garden.ProcessIO{
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return processStats{}, err
+	}
+
+	exitCode, err := process.Wait()
+	if err != nil {
+		return processStats{}, err
+	}
+	if exitCode != 0 {
+		return processStats{}, fmt.Errorf("process watchdog sampler exited with status %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	var stats processStats
+	_, err = fmt.Sscan(stdout.String(), &stats.Processes, &stats.Zombies, &stats.OpenFiles)
+	if err != nil {
+		return processStats{}, fmt.Errorf("invalid process watchdog sample %q: %w", stdout.String(), err)
+	}
+
+	return stats, nil
+}
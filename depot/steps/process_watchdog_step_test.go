@@ -0,0 +1,148 @@
+package steps_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/garden"
+	"code.cloudfoundry.org/garden/gardenfakes"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("ProcessWatchdog", func() {
+	var (
+		container        *gardenfakes.FakeContainer
+		limits           executor.ProcessWatchdog
+		clock            *fakeclock.FakeClock
+		fakeStreamer     *fake_log_streamer.FakeLogStreamer
+		fakeMetronClient *mfakes.FakeIngressClient
+		logger           *lagertest.TestLogger
+		samples          chan string
+
+		process ifrit.Process
+	)
+
+	const interval = 30 * time.Second
+
+	BeforeEach(func() {
+		samples = make(chan string, 10)
+		container = &gardenfakes.FakeContainer{}
+		container.RunStub = func(spec garden.ProcessSpec, io garden.ProcessIO) (garden.Process, error) {
+			fmt.Fprintln(io.Stdout, <-samples)
+			fakeProcess := &gardenfakes.FakeProcess{}
+			fakeProcess.WaitReturns(0, nil)
+			return fakeProcess, nil
+		}
+
+		limits = executor.ProcessWatchdog{MaxProcesses: 100, MaxZombies: 5, MaxOpenFiles: 1000}
+		clock = fakeclock.NewFakeClock(time.Now())
+		fakeStreamer = newFakeStreamer()
+		fakeMetronClient = new(mfakes.FakeIngressClient)
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	JustBeforeEach(func() {
+		step := steps.NewProcessWatchdog(container, limits, logger, clock, fakeStreamer, fakeMetronClient, interval)
+		process = ifrit.Background(step)
+		Eventually(process.Ready()).Should(BeClosed())
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	sample := func(s string) {
+		samples <- s
+		clock.WaitForWatcherAndIncrement(interval)
+		Eventually(samples).Should(BeEmpty())
+	}
+
+	It("samples the processes of the container on every interval", func() {
+		Consistently(container.RunCallCount).Should(Equal(0))
+
+		sample("3 0 12")
+		Eventually(container.RunCallCount).Should(Equal(1))
+
+		spec, _ := container.RunArgsForCall(0)
+		Expect(spec.Path).To(Equal("sh"))
+		Expect(spec.Args[0]).To(Equal("-c"))
+		Expect(spec.User).To(Equal("root"))
+	})
+
+	Context("when the samples are within the limits", func() {
+		It("does not warn", func() {
+			sample("3 0 12")
+			Consistently(fakeStreamer.Stderr().(*gbytes.Buffer).Contents).Should(BeEmpty())
+			Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when a sample exceeds a limit", func() {
+		It("writes a warning to the log stream and increments the metric", func() {
+			sample("3 6 12")
+			Eventually(fakeStreamer.Stderr().(*gbytes.Buffer)).Should(gbytes.Say(
+				"Process watchdog: 6 zombie processes exceeds the limit of 5\n",
+			))
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal(steps.ProcessWatchdogLimitExceeded))
+			Consistently(process.Wait()).ShouldNot(Receive())
+		})
+
+		It("only warns again once the limit was no longer exceeded", func() {
+			sample("3 6 12")
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+
+			sample("3 7 12")
+			Consistently(fakeMetronClient.IncrementCounterCallCount).Should(Equal(1))
+
+			sample("3 0 12")
+			sample("3 6 12")
+			Eventually(fakeMetronClient.IncrementCounterCallCount).Should(Equal(2))
+		})
+
+		Context("when the watchdog fails on limits", func() {
+			BeforeEach(func() {
+				limits.FailOnLimit = true
+			})
+
+			It("exits with an emittable error", func() {
+				sample("101 0 12")
+
+				var err *steps.EmittableError
+				Eventually(process.Wait()).Should(Receive(&err))
+				Expect(err.Error()).To(Equal("Instance exceeded process watchdog limit: 101 processes exceeds the limit of 100"))
+			})
+		})
+	})
+
+	Context("when sampling fails", func() {
+		BeforeEach(func() {
+			container.RunReturns(nil, errors.New("boom"))
+		})
+
+		It("logs the error and keeps running", func() {
+			clock.WaitForWatcherAndIncrement(interval)
+			Eventually(logger).Should(gbytes.Say("failed-to-sample"))
+			Consistently(process.Wait()).ShouldNot(Receive())
+		})
+	})
+
+	Context("when signalled", func() {
+		It("exits with a cancelled error", func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+		})
+	})
+})
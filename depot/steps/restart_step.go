@@ -0,0 +1,172 @@
+package steps
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+// ActionMarker records whether the action of a container started, i.e.
+// whether its setup, post-setup and init steps succeeded, so that only
+// failures of the action are restarted.
+//
+// A nil ActionMarker marks nothing, and considers the action always started.
+type ActionMarker struct {
+	lock    sync.Mutex
+	started bool
+}
+
+func NewActionMarker() *ActionMarker {
+	return &ActionMarker{}
+}
+
+// Step runs substep after marking the action as started.
+func (m *ActionMarker) Step(substep ifrit.Runner) ifrit.Runner {
+	if m == nil {
+		return substep
+	}
+
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		m.lock.Lock()
+		m.started = true
+		m.lock.Unlock()
+		return substep.Run(signals, ready)
+	})
+}
+
+func (m *ActionMarker) reset() {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.started = false
+}
+
+// Started reports whether the action started since the step last ran.
+func (m *ActionMarker) Started() bool {
+	if m == nil {
+		return true
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.started
+}
+
+type restartStep struct {
+	step           ifrit.Runner
+	newStep        func() (ifrit.Runner, error)
+	marker         *ActionMarker
+	maxRestarts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	onRestart      func(restarts int, err error)
+	onReady        func()
+	clock          clock.Clock
+	streamer       log_streamer.LogStreamer
+	logger         lager.Logger
+}
+
+// NewRestart runs step and, every time it fails after its action started, as
+// recorded by marker, runs the step returned by newStep instead after an
+// exponential backoff, up to maxRestarts times. Steps that fail before their
+// action started, e.g. because a download failed, are not restarted: their
+// setup would not be run again. onRestart is called before each restart with
+// the number of restarts and the error of the failed step, and onReady
+// whenever a restarted step becomes ready. The step is ready once the first
+// step is, and exits with the error of the last step it ran.
+func NewRestart(
+	step ifrit.Runner,
+	newStep func() (ifrit.Runner, error),
+	marker *ActionMarker,
+	maxRestarts int,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration,
+	onRestart func(restarts int, err error),
+	onReady func(),
+	clock clock.Clock,
+	streamer log_streamer.LogStreamer,
+	logger lager.Logger,
+) ifrit.Runner {
+	return &restartStep{
+		step:           step,
+		newStep:        newStep,
+		marker:         marker,
+		maxRestarts:    maxRestarts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		onRestart:      onRestart,
+		onReady:        onReady,
+		clock:          clock,
+		streamer:       streamer,
+		logger:         logger.Session("restart-step"),
+	}
+}
+
+func (step *restartStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	current := step.step
+	backoff := step.initialBackoff
+	for restarts := 0; ; {
+		step.marker.reset()
+		process := ifrit.Background(current)
+		processReady := process.Ready()
+
+		var err error
+	wait:
+		for {
+			select {
+			case <-processReady:
+				processReady = nil
+				if ready != nil {
+					close(ready)
+					ready = nil
+				} else {
+					step.onReady()
+				}
+
+			case err = <-process.Wait():
+				break wait
+
+			case signal := <-signals:
+				process.Signal(signal)
+				return <-process.Wait()
+			}
+		}
+
+		if err == nil || restarts >= step.maxRestarts {
+			return err
+		}
+		if !step.marker.Started() {
+			step.logger.Info("not-restarting-before-action-started", lager.Data{"error": err.Error()})
+			return err
+		}
+
+		restarts++
+		step.logger.Info("restarting", lager.Data{"restarts": restarts, "backoff": backoff.String(), "error": err.Error()})
+		step.onRestart(restarts, err)
+		fmt.Fprintf(step.streamer.Stdout(), "Restarting in %s (restart %d of %d)\n", backoff, restarts, step.maxRestarts)
+
+		select {
+		case <-step.clock.After(backoff):
+		case <-signals:
+			return new(CancelledError)
+		}
+
+		current, err = step.newStep()
+		if err != nil {
+			step.logger.Error("failed-to-create-step", err)
+			return err
+		}
+
+		backoff *= 2
+		if backoff > step.maxBackoff {
+			backoff = step.maxBackoff
+		}
+	}
+}
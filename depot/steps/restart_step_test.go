@@ -0,0 +1,194 @@
+package steps_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
+)
+
+var _ = Describe("RestartStep", func() {
+	var (
+		lock         sync.Mutex
+		runners      []*fake_runner.TestRunner
+		restarts     []int
+		restartErrs  []error
+		readyCount   int
+		maxRestarts  int
+		fakeClock    *fakeclock.FakeClock
+		fakeStreamer *fake_log_streamer.FakeLogStreamer
+		marker       *steps.ActionMarker
+		setupFails   bool
+		process      ifrit.Process
+	)
+
+	runner := func(i int) func() *fake_runner.TestRunner {
+		return func() *fake_runner.TestRunner {
+			lock.Lock()
+			defer lock.Unlock()
+			if i < len(runners) {
+				return runners[i]
+			}
+			return nil
+		}
+	}
+
+	newRunner := func() *fake_runner.TestRunner {
+		lock.Lock()
+		defer lock.Unlock()
+		r := fake_runner.NewTestRunner()
+		runners = append(runners, r)
+		return r
+	}
+
+	BeforeEach(func() {
+		runners = nil
+		restarts = nil
+		restartErrs = nil
+		readyCount = 0
+		maxRestarts = 2
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		fakeStreamer = fake_log_streamer.NewFakeLogStreamer()
+		marker = steps.NewActionMarker()
+		setupFails = false
+	})
+
+	// newStep runs the action of the step, marked as started, unless its
+	// setup fails
+	newStep := func() ifrit.Runner {
+		action := newRunner()
+		if setupFails {
+			return action
+		}
+		return marker.Step(action)
+	}
+
+	JustBeforeEach(func() {
+		process = ifrit.Background(steps.NewRestart(
+			newStep(),
+			func() (ifrit.Runner, error) {
+				return newStep(), nil
+			},
+			marker,
+			maxRestarts,
+			time.Second,
+			3*time.Second,
+			func(restart int, err error) {
+				lock.Lock()
+				defer lock.Unlock()
+				restarts = append(restarts, restart)
+				restartErrs = append(restartErrs, err)
+			},
+			func() {
+				lock.Lock()
+				defer lock.Unlock()
+				readyCount++
+			},
+			fakeClock,
+			fakeStreamer,
+			lagertest.NewTestLogger("test"),
+		))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Kill)
+		lock.Lock()
+		defer lock.Unlock()
+		for _, r := range runners {
+			r.EnsureExit()
+		}
+	})
+
+	It("becomes ready when the step is ready", func() {
+		Consistently(process.Ready()).ShouldNot(BeClosed())
+		runner(0)().TriggerReady()
+		Eventually(process.Ready()).Should(BeClosed())
+	})
+
+	It("exits when the step succeeds", func() {
+		runner(0)().TriggerExit(nil)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		Expect(runners).To(HaveLen(1))
+	})
+
+	It("restarts the step after a backoff when it fails", func() {
+		runner(0)().TriggerReady()
+		Eventually(process.Ready()).Should(BeClosed())
+		runner(0)().TriggerExit(errors.New("boom"))
+
+		Eventually(func() []int {
+			lock.Lock()
+			defer lock.Unlock()
+			return restarts
+		}).Should(Equal([]int{1}))
+		Expect(restartErrs[0]).To(MatchError("boom"))
+		Expect(fakeStreamer.Stdout().(*gbytes.Buffer)).To(gbytes.Say("Restarting in 1s \\(restart 1 of 2\\)"))
+		Consistently(runner(1)).Should(BeNil())
+
+		fakeClock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(runner(1)).ShouldNot(BeNil())
+
+		runner(1)().TriggerReady()
+		Eventually(func() int {
+			lock.Lock()
+			defer lock.Unlock()
+			return readyCount
+		}).Should(Equal(1))
+	})
+
+	It("fails with the error of the step once it was restarted its maximum of times", func() {
+		runner(0)().TriggerExit(errors.New("boom"))
+		fakeClock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(runner(1)).ShouldNot(BeNil())
+
+		runner(1)().TriggerExit(errors.New("boom"))
+		fakeClock.WaitForWatcherAndIncrement(2 * time.Second)
+		Eventually(runner(2)).ShouldNot(BeNil())
+
+		runner(2)().TriggerExit(errors.New("last boom"))
+		Eventually(process.Wait()).Should(Receive(MatchError("last boom")))
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(restarts).To(Equal([]int{1, 2}))
+	})
+
+	Context("when the step fails before its action started", func() {
+		BeforeEach(func() {
+			setupFails = true
+		})
+
+		It("fails without restarting it", func() {
+			runner(0)().TriggerExit(errors.New("download failed"))
+			Eventually(process.Wait()).Should(Receive(MatchError("download failed")))
+			Expect(restarts).To(BeEmpty())
+			Expect(runners).To(HaveLen(1))
+		})
+	})
+
+	It("forwards signals to the step", func() {
+		process.Signal(os.Interrupt)
+		Eventually(runner(0)().WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+		runner(0)().TriggerExit(errors.New("interrupted"))
+		Eventually(process.Wait()).Should(Receive(MatchError("interrupted")))
+		Expect(restarts).To(BeEmpty())
+	})
+
+	It("is cancelled when it is signalled while backing off", func() {
+		runner(0)().TriggerExit(errors.New("boom"))
+		Eventually(fakeClock.WatcherCount).Should(Equal(1))
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+		Expect(runners).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,167 @@
+package steps
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	sidecarInitialBackoff = time.Second
+	sidecarMaxBackoff     = 30 * time.Second
+)
+
+var ErrSidecarUnhealthy = errors.New("sidecar monitor failed")
+
+type sidecarStep struct {
+	name            string
+	newProcess      func() ifrit.Runner
+	newMonitor      func() ifrit.Runner
+	policy          executor.SidecarRestartPolicy
+	maxRestarts     int
+	monitorInterval time.Duration
+	clock           clock.Clock
+	streamer        log_streamer.LogStreamer
+	logger          lager.Logger
+}
+
+// NewSidecar runs the process of a sidecar and restarts it according to the
+// restart policy, with an exponential backoff. When newMonitor is not nil,
+// it runs the monitor every monitorInterval and stops the process when the
+// monitor fails, which counts as a failure of the process. The step only
+// exits once the process is not restarted anymore, with its error.
+func NewSidecar(
+	name string,
+	newProcess func() ifrit.Runner,
+	newMonitor func() ifrit.Runner,
+	policy executor.SidecarRestartPolicy,
+	maxRestarts int,
+	monitorInterval time.Duration,
+	clock clock.Clock,
+	streamer log_streamer.LogStreamer,
+	logger lager.Logger,
+) ifrit.Runner {
+	return &sidecarStep{
+		name:            name,
+		newProcess:      newProcess,
+		newMonitor:      newMonitor,
+		policy:          policy,
+		maxRestarts:     maxRestarts,
+		monitorInterval: monitorInterval,
+		clock:           clock,
+		streamer:        streamer,
+		logger:          logger.Session("sidecar-step", lager.Data{"sidecar": name}),
+	}
+}
+
+func (step *sidecarStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	backoff := sidecarInitialBackoff
+	for restarts := 0; ; restarts++ {
+		signalled, err := step.runOnce(signals, &ready)
+		if signalled || !step.restart(err) {
+			return err
+		}
+
+		if step.maxRestarts > 0 && restarts >= step.maxRestarts {
+			step.logger.Info("exceeded-max-restarts", lager.Data{"restarts": restarts})
+			return NewEmittableError(err, "%s exceeded its %d restarts", step.name, step.maxRestarts)
+		}
+
+		step.logger.Info("restarting", lager.Data{"restarts": restarts + 1, "backoff": backoff.String()})
+		fmt.Fprintf(step.streamer.Stdout(), "Restarting %s in %s\n", step.name, backoff)
+		select {
+		case <-step.clock.After(backoff):
+		case <-signals:
+			return new(CancelledError)
+		}
+
+		backoff *= 2
+		if backoff > sidecarMaxBackoff {
+			backoff = sidecarMaxBackoff
+		}
+	}
+}
+
+// runOnce runs the process until it exits, its monitor fails or the step is
+// signalled. It closes ready the first time the process becomes ready.
+func (step *sidecarStep) runOnce(signals <-chan os.Signal, ready *chan<- struct{}) (bool, error) {
+	process := ifrit.Background(step.newProcess())
+	processReady := process.Ready()
+
+	var monitorTick <-chan time.Time
+	if step.newMonitor != nil {
+		ticker := step.clock.NewTicker(step.monitorInterval)
+		defer ticker.Stop()
+		monitorTick = ticker.C()
+	}
+
+	var monitor ifrit.Process
+	var monitorExit <-chan error
+	defer func() {
+		if monitor != nil {
+			monitor.Signal(os.Interrupt)
+		}
+	}()
+
+	for {
+		select {
+		case <-processReady:
+			processReady = nil
+			if *ready != nil {
+				close(*ready)
+				*ready = nil
+			}
+
+		case err := <-process.Wait():
+			step.logger.Info("process-exited", lager.Data{"error": errorString(err)})
+			return false, err
+
+		case signal := <-signals:
+			process.Signal(signal)
+			return true, <-process.Wait()
+
+		case <-monitorTick:
+			if monitor == nil {
+				monitor = ifrit.Background(step.newMonitor())
+				monitorExit = monitor.Wait()
+			}
+
+		case err := <-monitorExit:
+			monitor, monitorExit = nil, nil
+			if err == nil {
+				continue
+			}
+
+			step.logger.Info("monitor-failed", lager.Data{"error": err.Error()})
+			fmt.Fprintf(step.streamer.Stderr(), "%s failed its monitor, stopping it\n", step.name)
+			process.Signal(os.Interrupt)
+			<-process.Wait()
+			return false, ErrSidecarUnhealthy
+		}
+	}
+}
+
+func (step *sidecarStep) restart(err error) bool {
+	switch step.policy {
+	case executor.SidecarRestartAlways:
+		return true
+	case executor.SidecarRestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,200 @@
+package steps_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/log_streamer/fake_log_streamer"
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
+)
+
+var _ = Describe("SidecarStep", func() {
+	var (
+		lock       sync.Mutex
+		runners    []*fake_runner.TestRunner
+		monitors   []*fake_runner.TestRunner
+		newMonitor func() ifrit.Runner
+
+		policy      executor.SidecarRestartPolicy
+		maxRestarts int
+		fakeClock   *fakeclock.FakeClock
+		process     ifrit.Process
+	)
+
+	runner := func(i int) func() *fake_runner.TestRunner {
+		return func() *fake_runner.TestRunner {
+			lock.Lock()
+			defer lock.Unlock()
+			if i < len(runners) {
+				return runners[i]
+			}
+			return nil
+		}
+	}
+
+	monitor := func(i int) func() *fake_runner.TestRunner {
+		return func() *fake_runner.TestRunner {
+			lock.Lock()
+			defer lock.Unlock()
+			if i < len(monitors) {
+				return monitors[i]
+			}
+			return nil
+		}
+	}
+
+	BeforeEach(func() {
+		runners = nil
+		monitors = nil
+		newMonitor = nil
+		policy = ""
+		maxRestarts = 0
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+	})
+
+	JustBeforeEach(func() {
+		newProcess := func() ifrit.Runner {
+			lock.Lock()
+			defer lock.Unlock()
+			r := fake_runner.NewTestRunner()
+			runners = append(runners, r)
+			return r
+		}
+
+		process = ifrit.Background(steps.NewSidecar(
+			"sidecar[0]",
+			newProcess,
+			newMonitor,
+			policy,
+			maxRestarts,
+			10*time.Second,
+			fakeClock,
+			new(fake_log_streamer.FakeLogStreamer),
+			lagertest.NewTestLogger("test"),
+		))
+		Eventually(runner(0)).ShouldNot(BeNil())
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Kill)
+		lock.Lock()
+		defer lock.Unlock()
+		for _, r := range append(runners, monitors...) {
+			r.EnsureExit()
+		}
+	})
+
+	It("becomes ready when the process is ready", func() {
+		Consistently(process.Ready()).ShouldNot(BeClosed())
+		runner(0)().TriggerReady()
+		Eventually(process.Ready()).Should(BeClosed())
+	})
+
+	It("exits with the error of the process without a restart policy", func() {
+		runner(0)().TriggerExit(errors.New("boom"))
+		Eventually(process.Wait()).Should(Receive(MatchError("boom")))
+	})
+
+	It("stops the process when it is signalled", func() {
+		process.Signal(os.Interrupt)
+		Eventually(runner(0)().WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+		runner(0)().TriggerExit(new(steps.CancelledError))
+		Eventually(process.Wait()).Should(Receive(Equal(new(steps.CancelledError))))
+	})
+
+	Context("when the sidecar is restarted on failure", func() {
+		BeforeEach(func() {
+			policy = executor.SidecarRestartOnFailure
+		})
+
+		It("restarts the process after a backoff when it fails", func() {
+			runner(0)().TriggerExit(errors.New("boom"))
+			Consistently(runner(1)).Should(BeNil())
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(runner(1)).ShouldNot(BeNil())
+
+			runner(1)().TriggerExit(errors.New("boom"))
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Consistently(runner(2)).Should(BeNil())
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(runner(2)).ShouldNot(BeNil())
+		})
+
+		It("exits when the process exits successfully", func() {
+			runner(0)().TriggerExit(nil)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		Context("when the sidecar has a maximum of restarts", func() {
+			BeforeEach(func() {
+				maxRestarts = 1
+			})
+
+			It("fails once the process failed after its last restart", func() {
+				runner(0)().TriggerExit(errors.New("boom"))
+				fakeClock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(runner(1)).ShouldNot(BeNil())
+
+				runner(1)().TriggerExit(errors.New("boom"))
+				Eventually(process.Wait()).Should(Receive(MatchError("sidecar[0] exceeded its 1 restarts")))
+			})
+		})
+	})
+
+	Context("when the sidecar is always restarted", func() {
+		BeforeEach(func() {
+			policy = executor.SidecarRestartAlways
+		})
+
+		It("restarts the process when it exits successfully", func() {
+			runner(0)().TriggerExit(nil)
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(runner(1)).ShouldNot(BeNil())
+		})
+	})
+
+	Context("when the sidecar has a monitor", func() {
+		BeforeEach(func() {
+			policy = executor.SidecarRestartOnFailure
+			newMonitor = func() ifrit.Runner {
+				lock.Lock()
+				defer lock.Unlock()
+				m := fake_runner.NewTestRunner()
+				monitors = append(monitors, m)
+				return m
+			}
+		})
+
+		It("runs the monitor every interval", func() {
+			fakeClock.WaitForWatcherAndIncrement(10 * time.Second)
+			Eventually(monitor(0)).ShouldNot(BeNil())
+			monitor(0)().TriggerExit(nil)
+
+			fakeClock.WaitForWatcherAndIncrement(10 * time.Second)
+			Eventually(monitor(1)).ShouldNot(BeNil())
+			Expect(runner(1)()).To(BeNil())
+		})
+
+		It("stops and restarts the process when the monitor fails", func() {
+			fakeClock.WaitForWatcherAndIncrement(10 * time.Second)
+			Eventually(monitor(0)).ShouldNot(BeNil())
+			monitor(0)().TriggerExit(errors.New("unhealthy"))
+
+			Eventually(runner(0)().WaitForCall()).Should(Receive(Equal(os.Interrupt)))
+			runner(0)().TriggerExit(new(steps.CancelledError))
+
+			fakeClock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(runner(1)).ShouldNot(BeNil())
+		})
+	})
+})
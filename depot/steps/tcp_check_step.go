@@ -0,0 +1,59 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+type tcpCheckStep struct {
+	address string
+	timeout time.Duration
+	logger  lager.Logger
+}
+
+// NewTCPCheck dials address once and fails unless the connection is
+// accepted within timeout.
+func NewTCPCheck(address string, timeout time.Duration, logger lager.Logger) ifrit.Runner {
+	return &tcpCheckStep{
+		address: address,
+		timeout: timeout,
+		logger:  logger.Session("tcp-check-step"),
+	}
+}
+
+func (step *tcpCheckStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), step.timeout)
+	defer cancel()
+
+	close(ready)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- step.check(ctx)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-signals:
+		cancel()
+		<-errs
+		return new(CancelledError)
+	}
+}
+
+func (step *tcpCheckStep) check(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", step.address)
+	if err != nil {
+		step.logger.Debug("dial-failed", lager.Data{"error": err.Error()})
+		return fmt.Errorf("Failed to connect to '%s': %s", step.address, err)
+	}
+	return conn.Close()
+}
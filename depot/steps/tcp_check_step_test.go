@@ -0,0 +1,44 @@
+package steps_test
+
+import (
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/executor/depot/steps"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("TCPCheckStep", func() {
+	var (
+		listener net.Listener
+		logger   *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	runCheck := func() error {
+		step := steps.NewTCPCheck(listener.Addr().String(), time.Second, logger)
+		return <-ifrit.Invoke(step).Wait()
+	}
+
+	It("succeeds when the connection is accepted", func() {
+		Expect(runCheck()).To(Succeed())
+	})
+
+	It("fails when nothing is listening", func() {
+		listener.Close()
+		Expect(runCheck()).To(MatchError(ContainSubstring("Failed to connect to '" + listener.Addr().String() + "'")))
+	})
+})
@@ -0,0 +1,101 @@
+package steps
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"github.com/tedsuo/ifrit"
+)
+
+// Timeline records when the steps of a container ran. It keeps one entry per
+// step, in the order the steps first started, so that steps that run
+// repeatedly, like monitor checks, do not grow it without bound.
+//
+// A nil Timeline records nothing.
+type Timeline struct {
+	clock clock.Clock
+
+	lock    sync.Mutex
+	entries []executor.StepTiming
+	indices map[string]int
+}
+
+func NewTimeline(clock clock.Clock) *Timeline {
+	return &Timeline{
+		clock:   clock,
+		indices: map[string]int{},
+	}
+}
+
+// Step records every run of substep under name.
+func (t *Timeline) Step(name string, substep ifrit.Runner) ifrit.Runner {
+	if t == nil || substep == nil {
+		return substep
+	}
+
+	return &timelineStep{
+		timeline: t,
+		name:     name,
+		substep:  substep,
+	}
+}
+
+// Steps returns a copy of the entries recorded so far.
+func (t *Timeline) Steps() []executor.StepTiming {
+	if t == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.entries) == 0 {
+		return nil
+	}
+	return append([]executor.StepTiming{}, t.entries...)
+}
+
+func (t *Timeline) start(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	index, ok := t.indices[name]
+	if !ok {
+		index = len(t.entries)
+		t.indices[name] = index
+		t.entries = append(t.entries, executor.StepTiming{Step: name})
+	}
+
+	entry := &t.entries[index]
+	entry.StartedAt = t.clock.Now().UnixNano()
+	entry.FinishedAt = 0
+	entry.Failed = false
+	entry.Runs++
+}
+
+func (t *Timeline) finish(name string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entry := &t.entries[t.indices[name]]
+	entry.FinishedAt = t.clock.Now().UnixNano()
+
+	var cancelled *CancelledError
+	entry.Failed = err != nil && !errors.As(err, &cancelled)
+}
+
+type timelineStep struct {
+	timeline *Timeline
+	name     string
+	substep  ifrit.Runner
+}
+
+func (step *timelineStep) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	step.timeline.start(step.name)
+	err := step.substep.Run(signals, ready)
+	step.timeline.finish(step.name, err)
+	return err
+}
@@ -0,0 +1,91 @@
+package steps_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/steps"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	fake_runner "github.com/tedsuo/ifrit/fake_runner_v2"
+)
+
+var _ = Describe("Timeline", func() {
+	var (
+		substep  *fake_runner.TestRunner
+		clock    *fakeclock.FakeClock
+		timeline *steps.Timeline
+		start    time.Time
+	)
+
+	BeforeEach(func() {
+		substep = fake_runner.NewTestRunner()
+		start = time.Now()
+		clock = fakeclock.NewFakeClock(start)
+		timeline = steps.NewTimeline(clock)
+	})
+
+	It("records when the step starts and finishes", func() {
+		process := ifrit.Background(timeline.Step("setup/download", substep))
+		Eventually(substep.RunCallCount).Should(Equal(1))
+		Expect(timeline.Steps()).To(Equal([]executor.StepTiming{
+			{Step: "setup/download", StartedAt: start.UnixNano(), Runs: 1},
+		}))
+
+		clock.Increment(time.Second)
+		substep.TriggerExit(nil)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		Expect(timeline.Steps()).To(Equal([]executor.StepTiming{
+			{Step: "setup/download", StartedAt: start.UnixNano(), FinishedAt: start.Add(time.Second).UnixNano(), Runs: 1},
+		}))
+	})
+
+	It("records failed steps", func() {
+		process := ifrit.Background(timeline.Step("action/run", substep))
+		Eventually(substep.RunCallCount).Should(Equal(1))
+		substep.TriggerExit(errors.New("boom"))
+		Eventually(process.Wait()).Should(Receive(MatchError("boom")))
+
+		Expect(timeline.Steps()[0].Failed).To(BeTrue())
+	})
+
+	It("does not record cancelled steps as failed", func() {
+		process := ifrit.Background(timeline.Step("action/run", substep))
+		Eventually(substep.RunCallCount).Should(Equal(1))
+		process.Signal(os.Interrupt)
+		substep.TriggerExit(new(steps.CancelledError))
+		Eventually(process.Wait()).Should(Receive())
+
+		Expect(timeline.Steps()[0].Failed).To(BeFalse())
+	})
+
+	It("keeps only the last run of steps that run repeatedly", func() {
+		for i := 0; i < 3; i++ {
+			check := fake_runner.NewTestRunner()
+			process := ifrit.Background(timeline.Step("monitor/run", check))
+			Eventually(check.RunCallCount).Should(Equal(1))
+			check.TriggerExit(nil)
+			Eventually(process.Wait()).Should(Receive())
+			clock.Increment(time.Second)
+		}
+
+		Expect(timeline.Steps()).To(Equal([]executor.StepTiming{
+			{
+				Step:       "monitor/run",
+				StartedAt:  start.Add(2 * time.Second).UnixNano(),
+				FinishedAt: start.Add(2 * time.Second).UnixNano(),
+				Runs:       3,
+			},
+		}))
+	})
+
+	It("records nothing when it is nil", func() {
+		var nilTimeline *steps.Timeline
+		Expect(nilTimeline.Step("action/run", substep)).To(BeIdenticalTo(substep))
+		Expect(nilTimeline.Steps()).To(BeNil())
+	})
+})
@@ -3,6 +3,7 @@ package faketransformer
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/log_streamer"
@@ -13,6 +14,17 @@ import (
 )
 
 type FakeTransformer struct {
+	StartTimeoutStub        func(executor.Container) time.Duration
+	startTimeoutMutex       sync.RWMutex
+	startTimeoutArgsForCall []struct {
+		arg1 executor.Container
+	}
+	startTimeoutReturns struct {
+		result1 time.Duration
+	}
+	startTimeoutReturnsOnCall map[int]struct {
+		result1 time.Duration
+	}
 	StepsRunnerStub        func(lager.Logger, executor.Container, garden.Container, log_streamer.LogStreamer, transformer.Config) (ifrit.Runner, error)
 	stepsRunnerMutex       sync.RWMutex
 	stepsRunnerArgsForCall []struct {
@@ -34,6 +46,67 @@ type FakeTransformer struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeTransformer) StartTimeout(arg1 executor.Container) time.Duration {
+	fake.startTimeoutMutex.Lock()
+	ret, specificReturn := fake.startTimeoutReturnsOnCall[len(fake.startTimeoutArgsForCall)]
+	fake.startTimeoutArgsForCall = append(fake.startTimeoutArgsForCall, struct {
+		arg1 executor.Container
+	}{arg1})
+	stub := fake.StartTimeoutStub
+	fakeReturns := fake.startTimeoutReturns
+	fake.recordInvocation("StartTimeout", []interface{}{arg1})
+	fake.startTimeoutMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeTransformer) StartTimeoutCallCount() int {
+	fake.startTimeoutMutex.RLock()
+	defer fake.startTimeoutMutex.RUnlock()
+	return len(fake.startTimeoutArgsForCall)
+}
+
+func (fake *FakeTransformer) StartTimeoutCalls(stub func(executor.Container) time.Duration) {
+	fake.startTimeoutMutex.Lock()
+	defer fake.startTimeoutMutex.Unlock()
+	fake.StartTimeoutStub = stub
+}
+
+func (fake *FakeTransformer) StartTimeoutArgsForCall(i int) executor.Container {
+	fake.startTimeoutMutex.RLock()
+	defer fake.startTimeoutMutex.RUnlock()
+	argsForCall := fake.startTimeoutArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeTransformer) StartTimeoutReturns(result1 time.Duration) {
+	fake.startTimeoutMutex.Lock()
+	defer fake.startTimeoutMutex.Unlock()
+	fake.StartTimeoutStub = nil
+	fake.startTimeoutReturns = struct {
+		result1 time.Duration
+	}{result1}
+}
+
+func (fake *FakeTransformer) StartTimeoutReturnsOnCall(i int, result1 time.Duration) {
+	fake.startTimeoutMutex.Lock()
+	defer fake.startTimeoutMutex.Unlock()
+	fake.StartTimeoutStub = nil
+	if fake.startTimeoutReturnsOnCall == nil {
+		fake.startTimeoutReturnsOnCall = make(map[int]struct {
+			result1 time.Duration
+		})
+	}
+	fake.startTimeoutReturnsOnCall[i] = struct {
+		result1 time.Duration
+	}{result1}
+}
+
 func (fake *FakeTransformer) StepsRunner(arg1 lager.Logger, arg2 executor.Container, arg3 garden.Container, arg4 log_streamer.LogStreamer, arg5 transformer.Config) (ifrit.Runner, error) {
 	fake.stepsRunnerMutex.Lock()
 	ret, specificReturn := fake.stepsRunnerReturnsOnCall[len(fake.stepsRunnerArgsForCall)]
@@ -105,6 +178,8 @@ func (fake *FakeTransformer) StepsRunnerReturnsOnCall(i int, result1 ifrit.Runne
 func (fake *FakeTransformer) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.startTimeoutMutex.RLock()
+	defer fake.startTimeoutMutex.RUnlock()
 	fake.stepsRunnerMutex.RLock()
 	defer fake.stepsRunnerMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
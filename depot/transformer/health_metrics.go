@@ -0,0 +1,103 @@
+package transformer
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/executor"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	StartupCheckDuration      = "StartupCheckDuration"
+	LivenessCheckFailureCount = "LivenessCheckFailureCount"
+	ReadinessTransitionCount  = "ReadinessTransitionCount"
+)
+
+// healthMetrics emits the health check metrics of a container instance,
+// tagged with its source_id and instance_id. The counts are cumulative over
+// the life of the instance.
+type healthMetrics struct {
+	logger       lager.Logger
+	metronClient loggingclient.IngressClient
+	tags         loggregator.EmitGaugeOption
+
+	lock                 sync.Mutex
+	started              bool
+	livenessFailures     int
+	readinessTransitions int
+}
+
+// withHealthMetrics wraps the health callbacks of config so that they also
+// emit the health check metrics of the container.
+func withHealthMetrics(logger lager.Logger, container executor.Container, config Config) Config {
+	if config.MetronClient == nil {
+		return config
+	}
+
+	m := &healthMetrics{
+		logger:       logger.Session("health-metrics"),
+		metronClient: config.MetronClient,
+		tags: loggregator.WithEnvelopeTags(map[string]string{
+			"source_id":   container.LogConfig.Guid,
+			"instance_id": strconv.Itoa(container.LogConfig.Index),
+		}),
+	}
+
+	onTransition := config.HealthTransitions
+	config.HealthTransitions = func(checkType executor.HealthCheckType, healthy bool, duration time.Duration, failureOutput string) {
+		m.transition(checkType, healthy, duration)
+		if onTransition != nil {
+			onTransition(checkType, healthy, duration, failureOutput)
+		}
+	}
+
+	onLivenessWarning := config.LivenessWarnings
+	config.LivenessWarnings = func(failures int, failureOutput string) {
+		m.livenessFailure()
+		if onLivenessWarning != nil {
+			onLivenessWarning(failures, failureOutput)
+		}
+	}
+
+	return config
+}
+
+func (m *healthMetrics) transition(checkType executor.HealthCheckType, healthy bool, duration time.Duration) {
+	switch checkType {
+	case executor.HealthCheckReadiness:
+		m.lock.Lock()
+		startup := !m.started
+		m.started = true
+		m.readinessTransitions++
+		transitions := m.readinessTransitions
+		m.lock.Unlock()
+
+		if startup {
+			m.send(m.metronClient.SendDuration(StartupCheckDuration, duration, m.tags))
+		}
+		m.send(m.metronClient.SendMetric(ReadinessTransitionCount, transitions, m.tags))
+	case executor.HealthCheckLiveness:
+		if !healthy {
+			m.livenessFailure()
+		}
+	}
+}
+
+func (m *healthMetrics) livenessFailure() {
+	m.lock.Lock()
+	m.livenessFailures++
+	failures := m.livenessFailures
+	m.lock.Unlock()
+
+	m.send(m.metronClient.SendMetric(LivenessCheckFailureCount, failures, m.tags))
+}
+
+func (m *healthMetrics) send(err error) {
+	if err != nil {
+		m.logger.Error("failed-to-send-metric", err)
+	}
+}
@@ -0,0 +1,105 @@
+package transformer
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/depot/steps"
+)
+
+var (
+	ErrInvalidProbe              = errors.New("probe timeout exceeds its interval")
+	ErrInvalidReadinessCondition = errors.New("invalid startup condition")
+)
+
+// probeSettings are the settings of a probe of a container, with the
+// defaults of the cell filled in.
+type probeSettings struct {
+	initialDelay     time.Duration
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+}
+
+func (p probeSettings) timeoutMs() int {
+	return int(p.timeout / time.Millisecond)
+}
+
+type containerProbes struct {
+	startup, liveness, readiness probeSettings
+
+	// requireAllStartupChecks is unset when any one of the checks passing
+	// makes the container healthy
+	requireAllStartupChecks bool
+}
+
+// probes validates the probes of the container and defaults them. Startup
+// probes default to the unhealthy monitoring interval and liveness and
+// readiness probes to the healthy monitoring interval of the cell.
+func (t *transformer) probes(container *executor.Container) (containerProbes, error) {
+	var probes executor.Probes
+	if container.Probes != nil {
+		probes = *container.Probes
+	}
+
+	startup, err := resolveProbe(probes.Startup, t.unhealthyMonitoringInterval)
+	if err != nil {
+		return containerProbes{}, err
+	}
+	liveness, err := resolveProbe(probes.Liveness, t.healthyMonitoringInterval)
+	if err != nil {
+		return containerProbes{}, err
+	}
+	readiness, err := resolveProbe(probes.Readiness, t.healthyMonitoringInterval)
+	if err != nil {
+		return containerProbes{}, err
+	}
+
+	var requireAll bool
+	switch probes.StartupCondition {
+	case "", executor.ReadinessConditionAll:
+		requireAll = true
+	case executor.ReadinessConditionAny:
+	default:
+		return containerProbes{}, ErrInvalidReadinessCondition
+	}
+
+	return containerProbes{startup: startup, liveness: liveness, readiness: readiness, requireAllStartupChecks: requireAll}, nil
+}
+
+func resolveProbe(probe *executor.Probe, defaultInterval time.Duration) (probeSettings, error) {
+	settings := probeSettings{
+		interval: defaultInterval,
+		timeout:  time.Duration(DefaultDeclarativeHealthcheckRequestTimeout) * time.Millisecond,
+	}
+	if probe == nil {
+		return settings, nil
+	}
+
+	if probe.IntervalMs > 0 && probe.TimeoutMs > probe.IntervalMs {
+		return probeSettings{}, ErrInvalidProbe
+	}
+
+	settings.initialDelay = time.Duration(probe.InitialDelayMs) * time.Millisecond
+	if probe.IntervalMs > 0 {
+		settings.interval = time.Duration(probe.IntervalMs) * time.Millisecond
+	}
+	if probe.TimeoutMs > 0 {
+		settings.timeout = time.Duration(probe.TimeoutMs) * time.Millisecond
+	}
+	settings.failureThreshold = int(probe.FailureThreshold)
+	return settings, nil
+}
+
+// livenessBudget tolerates failureThreshold-1 liveness failures within the
+// time it takes to run that many checks, in place of the budget of the cell.
+func (t *transformer) livenessBudget(liveness probeSettings) steps.LivenessFailureBudget {
+	if liveness.failureThreshold <= 0 {
+		return t.livenessFailureBudget
+	}
+	return steps.LivenessFailureBudget{
+		MaxFailures: liveness.failureThreshold - 1,
+		Window:      time.Duration(liveness.failureThreshold) * (liveness.interval + liveness.timeout),
+	}
+}
@@ -0,0 +1,70 @@
+package transformer
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/garden"
+)
+
+// longLivedStep matches the names of the run steps of the action and of the
+// sidecars of a container, whose processes live as long as the container.
+var longLivedStep = regexp.MustCompile(`^(action|sidecar\[\d+\])/`)
+
+// processID names the processes of the long-lived steps of a container after
+// their step, so that the executor can attach to them again when it recovers
+// the container after a restart. The processes of the other steps get random
+// IDs.
+func processID(handle, step string) string {
+	if !longLivedStep.MatchString(step) {
+		return ""
+	}
+	return handle + "-" + strings.ReplaceAll(step, "/", "-")
+}
+
+// reattachingContainer attaches to the processes of a recovered container
+// instead of starting them again. The processes of the long-lived steps are
+// always attached to, so that a process that exited while the executor was
+// down completes the container, and other processes, like the health checks
+// and the proxy, only while they are still running. Each process is attached
+// to once; when a step starts it again later, it is run as usual.
+type reattachingContainer struct {
+	garden.Container
+
+	lock     sync.Mutex
+	running  map[string]bool
+	attached map[string]bool
+}
+
+func newReattachingContainer(container garden.Container, running []string) *reattachingContainer {
+	c := &reattachingContainer{
+		Container: container,
+		running:   make(map[string]bool, len(running)),
+		attached:  make(map[string]bool),
+	}
+	for _, id := range running {
+		c.running[id] = true
+	}
+	return c
+}
+
+func (c *reattachingContainer) Run(spec garden.ProcessSpec, io garden.ProcessIO) (garden.Process, error) {
+	c.lock.Lock()
+	attach := false
+	if spec.ID != "" && !c.attached[spec.ID] {
+		c.attached[spec.ID] = true
+		attach = c.running[spec.ID] || c.longLived(spec.ID)
+	}
+	c.lock.Unlock()
+
+	if attach {
+		return c.Container.Attach(spec.ID, io)
+	}
+	return c.Container.Run(spec, io)
+}
+
+func (c *reattachingContainer) longLived(id string) bool {
+	prefix := c.Container.Handle() + "-"
+	return strings.HasPrefix(id, prefix) && longLivedStep.MatchString(strings.Replace(strings.TrimPrefix(id, prefix), "-", "/", 1))
+}
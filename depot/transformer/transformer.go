@@ -2,8 +2,11 @@ package transformer
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -16,6 +19,7 @@ import (
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/executor/depot/quarantine"
 	"code.cloudfoundry.org/executor/depot/steps"
 	"code.cloudfoundry.org/executor/depot/uploader"
 	"code.cloudfoundry.org/garden"
@@ -37,6 +41,7 @@ var HealthCheckDstPath string = filepath.Join(string(os.PathSeparator), "etc", "
 
 type Transformer interface {
 	StepsRunner(lager.Logger, executor.Container, garden.Container, log_streamer.LogStreamer, Config) (ifrit.Runner, error)
+	StartTimeout(executor.Container) time.Duration
 }
 
 type Config struct {
@@ -44,6 +49,27 @@ type Config struct {
 	BindMounts        []garden.BindMount
 	CreationStartTime time.Time
 	MetronClient      loggingclient.IngressClient
+	HealthTransitions steps.HealthTransitionFunc
+	LivenessWarnings  steps.LivenessWarningFunc
+
+	// Timeline records when the steps of the container run.
+	Timeline *steps.Timeline
+
+	// ActionMarker marks when the action of the container starts, once its
+	// setup, post-setup and init actions succeeded.
+	ActionMarker *steps.ActionMarker
+
+	// Restarted is set when the action of the container is restarted in
+	// place, in which case its setup and post-setup are not run again: it is
+	// only restarted once they succeeded.
+	Restarted bool
+
+	// Reattach is set when the executor recovers a running container after
+	// it restarted. Its setup, post-setup and init actions are not run again,
+	// and the steps attach to the processes of the action and the sidecars,
+	// and to the other RunningProcesses, rather than starting them again.
+	Reattach         bool
+	RunningProcesses []string
 }
 
 type transformer struct {
@@ -67,6 +93,19 @@ type transformer struct {
 
 	postSetupHook []string
 	postSetupUser string
+
+	processWatchdogInterval time.Duration
+
+	defaultStartTimeout    time.Duration
+	readinessFailurePolicy steps.ReadinessFailurePolicy
+
+	healthCheckLogSources steps.HealthCheckLogSources
+
+	livenessFailureBudget steps.LivenessFailureBudget
+
+	startupProgressInterval time.Duration
+
+	quarantine *quarantine.Quarantine
 }
 
 type Option func(*transformer)
@@ -99,6 +138,57 @@ func WithPostSetupHook(user string, hook []string) Option {
 	}
 }
 
+// WithProcessWatchdog samples the processes of containers that enable the
+// process watchdog every interval.
+func WithProcessWatchdog(interval time.Duration) Option {
+	return func(t *transformer) {
+		t.processWatchdogInterval = interval
+	}
+}
+
+// WithReadinessPolicy sets the start timeout of containers that do not
+// specify one, and what happens to containers that are not ready within their
+// start timeout.
+func WithReadinessPolicy(defaultStartTimeout time.Duration, policy steps.ReadinessFailurePolicy) Option {
+	return func(t *transformer) {
+		t.defaultStartTimeout = defaultStartTimeout
+		t.readinessFailurePolicy = policy
+	}
+}
+
+// WithHealthCheckLogSources emits the output of each type of declarative
+// health check, and the readiness changes of running containers, under its
+// own log source.
+func WithHealthCheckLogSources(sources steps.HealthCheckLogSources) Option {
+	return func(t *transformer) {
+		t.healthCheckLogSources = sources
+	}
+}
+
+// WithLivenessFailureBudget restarts the liveness check of containers that
+// fail it, up to the budget, instead of crashing them right away.
+func WithLivenessFailureBudget(budget steps.LivenessFailureBudget) Option {
+	return func(t *transformer) {
+		t.livenessFailureBudget = budget
+	}
+}
+
+// WithStartupProgressInterval tells developers every interval that the
+// startup check of their container has not passed yet.
+func WithStartupProgressInterval(interval time.Duration) Option {
+	return func(t *transformer) {
+		t.startupProgressInterval = interval
+	}
+}
+
+// WithQuarantine scans downloaded artifacts in the quarantine before they are
+// extracted into containers.
+func WithQuarantine(q *quarantine.Quarantine) Option {
+	return func(t *transformer) {
+		t.quarantine = q
+	}
+}
+
 func NewTransformer(
 	clock clock.Clock,
 	cachedDownloader cacheddownloader.CachedDownloader,
@@ -144,11 +234,16 @@ func (t *transformer) stepFor(
 	suppressExitStatusCode bool,
 	monitorOutputWrapper bool,
 	logger lager.Logger,
-) ifrit.Runner {
+	timeline *steps.Timeline,
+	path string,
+) (step ifrit.Runner) {
 	a := action.GetValue()
+	name := path + "/" + stepName(a)
+	defer func() { step = timeline.Step(name, step) }()
+
 	switch actionModel := a.(type) {
 	case *models.RunAction:
-		return steps.NewRun(
+		return steps.NewRunWithSidecar(
 			container,
 			*actionModel,
 			logStreamer.WithSource(actionModel.LogSource),
@@ -159,13 +254,16 @@ func (t *transformer) stepFor(
 			t.clock,
 			t.gracefulShutdownInterval,
 			suppressExitStatusCode,
+			steps.Sidecar{Name: processID(container.Handle(), name)},
+			false,
 		)
 
 	case *models.DownloadAction:
-		return steps.NewDownload(
+		return steps.NewDownloadWithQuarantine(
 			container,
 			*actionModel,
 			t.cachedDownloader,
+			t.quarantine,
 			t.downloadLimiter,
 			logStreamer.WithSource(actionModel.LogSource),
 			logger,
@@ -195,6 +293,8 @@ func (t *transformer) stepFor(
 				suppressExitStatusCode,
 				monitorOutputWrapper,
 				logger,
+				timeline,
+				name,
 			),
 			actionModel.StartMessage,
 			actionModel.SuccessMessage,
@@ -215,6 +315,8 @@ func (t *transformer) stepFor(
 				suppressExitStatusCode,
 				monitorOutputWrapper,
 				logger,
+				timeline,
+				name,
 			),
 			time.Duration(actionModel.TimeoutMs)*time.Millisecond,
 			t.clock,
@@ -233,6 +335,8 @@ func (t *transformer) stepFor(
 				suppressExitStatusCode,
 				monitorOutputWrapper,
 				logger,
+				timeline,
+				name,
 			),
 			logger,
 		)
@@ -254,6 +358,8 @@ func (t *transformer) stepFor(
 					suppressExitStatusCode,
 					monitorOutputWrapper,
 					logger,
+					timeline,
+					fmt.Sprintf("%s[%d]", name, i),
 				),
 					buffer,
 				)
@@ -268,6 +374,8 @@ func (t *transformer) stepFor(
 					suppressExitStatusCode,
 					monitorOutputWrapper,
 					logger,
+					timeline,
+					fmt.Sprintf("%s[%d]", name, i),
 				)
 			}
 			subSteps[i] = subStep
@@ -291,6 +399,8 @@ func (t *transformer) stepFor(
 					suppressExitStatusCode,
 					monitorOutputWrapper,
 					logger,
+					timeline,
+					fmt.Sprintf("%s[%d]", name, i),
 				),
 					buffer,
 				)
@@ -305,6 +415,8 @@ func (t *transformer) stepFor(
 					suppressExitStatusCode,
 					monitorOutputWrapper,
 					logger,
+					timeline,
+					fmt.Sprintf("%s[%d]", name, i),
 				)
 			}
 			subSteps[i] = subStep
@@ -325,6 +437,8 @@ func (t *transformer) stepFor(
 				suppressExitStatusCode,
 				monitorOutputWrapper,
 				logger,
+				timeline,
+				fmt.Sprintf("%s[%d]", name, i),
 			)
 		}
 		return steps.NewSerial(subSteps)
@@ -333,6 +447,31 @@ func (t *transformer) stepFor(
 	panic(fmt.Sprintf("unknown action: %T", action))
 }
 
+// stepName names the steps of actions in the timeline of a container.
+func stepName(action interface{}) string {
+	switch action.(type) {
+	case *models.RunAction:
+		return "run"
+	case *models.DownloadAction:
+		return "download"
+	case *models.UploadAction:
+		return "upload"
+	case *models.EmitProgressAction:
+		return "emit-progress"
+	case *models.TimeoutAction:
+		return "timeout"
+	case *models.TryAction:
+		return "try"
+	case *models.ParallelAction:
+		return "parallel"
+	case *models.CodependentAction:
+		return "codependent"
+	case *models.SerialAction:
+		return "serial"
+	}
+	return "unknown"
+}
+
 func overrideSuppressLogOutput(monitorAction *models.Action) {
 	if monitorAction.RunAction != nil {
 		monitorAction.RunAction.SuppressLogOutput = false
@@ -366,6 +505,16 @@ func (t *transformer) StepsRunner(
 	var setup, action, postSetup, monitor, longLivedAction ifrit.Runner
 	var substeps []ifrit.Runner
 
+	probes, err := t.probes(&container)
+	if err != nil {
+		logger.Error("invalid-probes", err)
+		return nil, err
+	}
+	config = withHealthMetrics(logger, container, config)
+	if config.Reattach {
+		gardenContainer = newReattachingContainer(gardenContainer, config.RunningProcesses)
+	}
+
 	if container.Setup != nil {
 		setup = t.stepFor(
 			logStreamer,
@@ -377,6 +526,8 @@ func (t *transformer) StepsRunner(
 			false,
 			false,
 			logger.Session("setup"),
+			config.Timeline,
+			"setup",
 		)
 	}
 	setup = steps.NewTimedStep(logger, setup, config.MetronClient, t.clock, config.CreationStartTime)
@@ -400,6 +551,7 @@ func (t *transformer) StepsRunner(
 			t.gracefulShutdownInterval,
 			suppressExitStatusCode,
 		)
+		postSetup = config.Timeline.Step("post-setup", postSetup)
 	}
 
 	if container.Action == nil {
@@ -408,6 +560,34 @@ func (t *transformer) StepsRunner(
 		return nil, err
 	}
 
+	var inits []ifrit.Runner
+	for index, init := range container.InitActions {
+		if init.Action == nil {
+			err := errors.New("init action cannot be empty")
+			logger.Error("steps-runner-empty-init-action", err)
+			return nil, err
+		}
+
+		initLogger := logger.Session("init", lager.Data{"index": index})
+		initStep := t.stepFor(
+			logStreamer.WithSource(init.LogSource),
+			init.Action,
+			gardenContainer,
+			container.ExternalIP,
+			container.InternalIP,
+			container.Ports,
+			false,
+			false,
+			initLogger,
+			config.Timeline,
+			fmt.Sprintf("init[%d]", index),
+		)
+		if init.TimeoutMs > 0 {
+			initStep = steps.NewTimeout(initStep, time.Duration(init.TimeoutMs)*time.Millisecond, t.clock, initLogger)
+		}
+		inits = append(inits, initStep)
+	}
+
 	action = t.stepFor(
 		logStreamer,
 		container.Action,
@@ -418,21 +598,71 @@ func (t *transformer) StepsRunner(
 		false,
 		false,
 		logger.Session("action"),
+		config.Timeline,
+		"action",
 	)
 
-	substeps = append(substeps, action)
+	var sidecarReadinessChecks []steps.NamedCheck
+	sidecarReadinessLogger := logger.Session("sidecar-readiness-check")
+	for index, sidecar := range container.Sidecars {
+		substeps = append(substeps, t.sidecarStep(logger, container, gardenContainer, logStreamer, config, probes, index, sidecar))
 
-	for _, sidecar := range container.Sidecars {
-		substeps = append(substeps, t.stepFor(logStreamer,
-			sidecar.Action,
-			gardenContainer,
-			container.ExternalIP,
-			container.InternalIP,
-			container.Ports,
-			false,
-			false,
-			logger.Session("sidecar"),
-		))
+		if check := sidecar.ReadinessCheck; check != nil {
+			timeout := probes.startup.timeout
+			if check.TimeoutMs > 0 {
+				timeout = time.Duration(check.TimeoutMs) * time.Millisecond
+			}
+			interval := probes.startup.interval
+			if check.IntervalMs > 0 {
+				interval = time.Duration(check.IntervalMs) * time.Millisecond
+			}
+			sidecarReadinessChecks = append(sidecarReadinessChecks, steps.NamedCheck{
+				Name:  fmt.Sprintf("sidecar-%d", index),
+				Check: t.createExecCheck(&container, gardenContainer, *check, timeout, true, interval, sidecarReadinessLogger),
+			})
+		}
+	}
+
+	// the action only starts once its sidecars are ready
+	if len(sidecarReadinessChecks) > 0 {
+		action = steps.NewSerial([]ifrit.Runner{
+			steps.NewAggregateReadiness(sidecarReadinessChecks, true, sidecarReadinessLogger),
+			action,
+		})
+	}
+	substeps = append([]ifrit.Runner{action}, substeps...)
+
+	var readinessMonitor ifrit.Runner
+	if container.ReadinessMonitor != nil {
+		overrideSuppressLogOutput(container.ReadinessMonitor)
+		readinessStreamer := logStreamer
+		if t.healthCheckLogSources.Readiness != "" {
+			readinessStreamer = logStreamer.WithSource(t.healthCheckLogSources.Readiness)
+		}
+		readinessMonitor = steps.NewDelay(steps.NewContinuousReadinessStep(
+			func() ifrit.Runner {
+				return steps.NewThrottle(t.stepFor(
+					logStreamer,
+					container.ReadinessMonitor,
+					gardenContainer,
+					container.ExternalIP,
+					container.InternalIP,
+					container.Ports,
+					true,
+					true,
+					logger.Session("readiness-monitor-run"),
+					config.Timeline,
+					"readiness-monitor",
+				), t.healthCheckWorkPool)
+			},
+			logger.Session("readiness-monitor"),
+			t.clock,
+			readinessStreamer,
+			probes.readiness.interval,
+			t.unhealthyMonitoringInterval,
+			probes.readiness.failureThreshold,
+			config.HealthTransitions,
+		), probes.readiness.initialDelay, t.clock)
 	}
 
 	var proxyReadinessChecks []ifrit.Runner
@@ -460,16 +690,35 @@ func (t *transformer) StepsRunner(
 			)
 			proxyReadinessChecks = append(proxyReadinessChecks, step)
 		}
+	} else if t.useContainerProxy {
+		// without the healthcheck binary, dial the proxy ports from the
+		// executor so the container is not reported healthy before envoy
+		// accepts connections
+		envoyReadinessLogger := logger.Session("envoy-readiness-check")
+		for _, p := range config.ProxyTLSPorts {
+			proxyReadinessChecks = append(proxyReadinessChecks, t.createTCPCheck(
+				&container,
+				int(p),
+				time.Duration(DefaultDeclarativeHealthcheckRequestTimeout)*time.Millisecond,
+				t.unhealthyMonitoringInterval,
+				envoyReadinessLogger,
+			))
+		}
 	}
 
-	if container.CheckDefinition != nil && t.useDeclarativeHealthCheck {
+	if (container.CheckDefinition != nil && t.useDeclarativeHealthCheck) || len(container.ExecChecks) > 0 {
 		monitor = t.transformCheckDefinition(logger,
 			&container,
 			gardenContainer,
 			logStreamer,
 			config.BindMounts,
 			proxyReadinessChecks,
+			readinessMonitor,
+			probes,
+			config.HealthTransitions,
+			config.LivenessWarnings,
 		)
+		monitor = config.Timeline.Step("monitor", monitor)
 		substeps = append(substeps, monitor)
 	} else if container.Monitor != nil {
 		overrideSuppressLogOutput(container.Monitor)
@@ -485,20 +734,41 @@ func (t *transformer) StepsRunner(
 					true,
 					true,
 					logger.Session("monitor-run"),
+					config.Timeline,
+					"monitor",
 				)
 			},
+			readinessMonitor,
 			logger.Session("monitor"),
 			t.clock,
 			logStreamer,
-			time.Duration(container.StartTimeoutMs)*time.Millisecond,
-			t.healthyMonitoringInterval,
-			t.unhealthyMonitoringInterval,
+			t.startTimeout(container),
+			t.readinessPolicy(),
+			t.startupProgressInterval,
+			t.livenessBudget(probes.liveness),
+			probes.liveness.interval,
+			probes.startup.interval,
 			t.healthCheckWorkPool,
+			config.HealthTransitions,
+			config.LivenessWarnings,
 			proxyReadinessChecks...,
 		)
+		monitor = config.Timeline.Step("monitor", monitor)
 		substeps = append(substeps, monitor)
 	}
 
+	if container.ProcessWatchdog != nil && t.processWatchdogInterval > 0 {
+		substeps = append(substeps, steps.NewProcessWatchdog(
+			gardenContainer,
+			*container.ProcessWatchdog,
+			logger,
+			t.clock,
+			logStreamer,
+			config.MetronClient,
+			t.processWatchdogInterval,
+		))
+	}
+
 	if len(substeps) > 1 {
 		longLivedAction = steps.NewCodependent(substeps, false, false)
 	} else {
@@ -516,20 +786,117 @@ func (t *transformer) StepsRunner(
 		longLivedAction = steps.NewCodependent([]ifrit.Runner{longLivedAction, containerProxyStep}, false, true)
 	}
 
+	longLivedAction = config.ActionMarker.Step(longLivedAction)
+
 	var cumulativeStep ifrit.Runner
 	if setup == nil {
 		cumulativeStep = longLivedAction
 	} else {
-		if postSetup == nil {
-			cumulativeStep = steps.NewSerial([]ifrit.Runner{setup, longLivedAction})
-		} else {
-			cumulativeStep = steps.NewSerial([]ifrit.Runner{setup, postSetup, longLivedAction})
+		var serialSteps []ifrit.Runner
+		if !config.Restarted && !config.Reattach {
+			serialSteps = append(serialSteps, setup)
+			if postSetup != nil {
+				serialSteps = append(serialSteps, postSetup)
+			}
 		}
+		if !config.Reattach {
+			serialSteps = append(serialSteps, inits...)
+		}
+		cumulativeStep = steps.NewSerial(append(serialSteps, longLivedAction))
 	}
 
 	return cumulativeStep, nil
 }
 
+// sidecarStep runs the action of a sidecar. Sidecars with a monitor or a
+// restart policy are restarted without affecting the action, and the
+// processes of sidecars with a memory sub-limit run in their own cgroup.
+func (t *transformer) sidecarStep(
+	logger lager.Logger,
+	container executor.Container,
+	gardenContainer garden.Container,
+	logStreamer log_streamer.LogStreamer,
+	config Config,
+	probes containerProbes,
+	index int,
+	sidecar executor.Sidecar,
+) ifrit.Runner {
+	path := fmt.Sprintf("sidecar[%d]", index)
+	newProcess := func() ifrit.Runner {
+		runAction := sidecar.Action.GetRunAction()
+		if sidecar.MemoryMB <= 0 || runAction == nil {
+			return t.stepFor(logStreamer,
+				sidecar.Action,
+				gardenContainer,
+				container.ExternalIP,
+				container.InternalIP,
+				container.Ports,
+				false,
+				false,
+				logger.Session("sidecar"),
+				config.Timeline,
+				path,
+			)
+		}
+
+		return config.Timeline.Step(path+"/run", steps.NewRunWithSidecar(
+			gardenContainer,
+			*runAction,
+			logStreamer.WithSource(runAction.LogSource),
+			logger.Session("sidecar"),
+			container.ExternalIP,
+			container.InternalIP,
+			container.Ports,
+			t.clock,
+			t.gracefulShutdownInterval,
+			false,
+			steps.Sidecar{
+				Name: processID(gardenContainer.Handle(), path+"/run"),
+				OverrideContainerLimits: &garden.ProcessLimits{
+					Memory: garden.MemoryLimits{LimitInBytes: uint64(sidecar.MemoryMB) * 1024 * 1024},
+				},
+			},
+			false,
+		))
+	}
+
+	if sidecar.Monitor == nil && sidecar.RestartPolicy == "" {
+		return newProcess()
+	}
+
+	var newMonitor func() ifrit.Runner
+	if sidecar.Monitor != nil {
+		overrideSuppressLogOutput(sidecar.Monitor)
+		newMonitor = func() ifrit.Runner {
+			return t.stepFor(
+				logStreamer,
+				sidecar.Monitor,
+				gardenContainer,
+				container.ExternalIP,
+				container.InternalIP,
+				container.Ports,
+				true,
+				true,
+				logger.Session("sidecar-monitor-run"),
+				config.Timeline,
+				path+"-monitor",
+			)
+		}
+	}
+
+	return steps.NewSidecar(
+		path,
+		newProcess,
+		newMonitor,
+		sidecar.RestartPolicy,
+		sidecar.MaxRestarts,
+		probes.liveness.interval,
+		t.clock,
+		logStreamer,
+		logger,
+	)
+}
+
 func (t *transformer) createCheck(
 	container *executor.Container,
 	gardenContainer garden.Container,
@@ -561,9 +928,18 @@ func (t *transformer) createCheck(
 		args = append(args, fmt.Sprintf("-uri=%s", path))
 	}
 
+	// the probe dials the IPv4 address of the container unless told otherwise
+	if container.IPFamily == executor.IPFamilyIPv6 {
+		args = append(args, "-network=tcp6")
+	}
+
 	if readiness {
 		args = append(args, fmt.Sprintf("-readiness-interval=%s", interval))
-		args = append(args, fmt.Sprintf("-readiness-timeout=%s", time.Duration(container.StartTimeoutMs)*time.Millisecond))
+		readinessTimeout := t.startTimeout(*container)
+		if t.readinessPolicy() == steps.ReadinessFailurePolicyKeepWaiting {
+			readinessTimeout = 0
+		}
+		args = append(args, fmt.Sprintf("-readiness-timeout=%s", readinessTimeout))
 	} else {
 		args = append(args, fmt.Sprintf("-liveness-interval=%s", interval))
 	}
@@ -604,6 +980,89 @@ func (t *transformer) createCheck(
 	return steps.NewOutputWrapper(runStep, buffer)
 }
 
+// createHTTPCheck probes the container from the executor instead of running
+// the healthcheck binary in a sidecar. Like the binary, the readiness check
+// polls until the first success and the liveness check until the first
+// failure.
+func (t *transformer) createHTTPCheck(
+	container *executor.Container,
+	options executor.HTTPCheckOptions,
+	path string,
+	timeout time.Duration,
+	readiness bool,
+	interval time.Duration,
+	logger lager.Logger,
+) ifrit.Runner {
+	scheme := options.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	ip := container.InternalIP
+	if container.IPFamily == executor.IPFamilyIPv6 {
+		ip = container.InternalIPv6
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(ip, strconv.Itoa(int(options.Port))), path)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: options.SkipTLSVerify},
+		},
+	}
+
+	return t.pollCheck(container, func() ifrit.Runner {
+		return steps.NewHTTPCheck(client, url, options, timeout, logger)
+	}, readiness, interval)
+}
+
+// createTCPCheck waits until a port of the container accepts connections.
+func (t *transformer) createTCPCheck(
+	container *executor.Container,
+	port int,
+	timeout time.Duration,
+	interval time.Duration,
+	logger lager.Logger,
+) ifrit.Runner {
+	ip := container.InternalIP
+	if container.IPFamily == executor.IPFamilyIPv6 {
+		ip = container.InternalIPv6
+	}
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
+
+	return t.pollCheck(container, func() ifrit.Runner {
+		return steps.NewTCPCheck(address, timeout, logger)
+	}, true, interval)
+}
+
+// createExecCheck runs the command of an exec check in the container.
+func (t *transformer) createExecCheck(
+	container *executor.Container,
+	gardenContainer garden.Container,
+	check executor.ExecCheck,
+	timeout time.Duration,
+	readiness bool,
+	interval time.Duration,
+	logger lager.Logger,
+) ifrit.Runner {
+	return t.pollCheck(container, func() ifrit.Runner {
+		return steps.NewExecCheck(gardenContainer, check, timeout, t.clock, logger)
+	}, readiness, interval)
+}
+
+// pollCheck runs check every interval, until it first succeeds for readiness
+// checks and until it first fails for liveness checks.
+func (t *transformer) pollCheck(container *executor.Container, check func() ifrit.Runner, readiness bool, interval time.Duration) ifrit.Runner {
+	if readiness {
+		readinessTimeout := t.startTimeout(*container)
+		if t.readinessPolicy() == steps.ReadinessFailurePolicyKeepWaiting {
+			readinessTimeout = 0
+		}
+		return steps.NewEventuallySucceedsStep(check, interval, readinessTimeout, t.clock)
+	}
+	return steps.NewConsistentlySucceedsStep(check, interval, t.clock)
+}
+
 func (t *transformer) transformCheckDefinition(
 	logger lager.Logger,
 	container *executor.Container,
@@ -611,15 +1070,26 @@ func (t *transformer) transformCheckDefinition(
 	logstreamer log_streamer.LogStreamer,
 	bindMounts []garden.BindMount,
 	proxyReadinessChecks []ifrit.Runner,
+	readinessMonitor ifrit.Runner,
+	probes containerProbes,
+	onTransition steps.HealthTransitionFunc,
+	onLivenessWarning steps.LivenessWarningFunc,
 ) ifrit.Runner {
-	var readinessChecks []ifrit.Runner
+	var readinessChecks []steps.NamedCheck
 	var livenessChecks []ifrit.Runner
 
 	sourceName := HealthLogSource
-	if container.CheckDefinition.LogSource != "" {
+	if container.CheckDefinition != nil && container.CheckDefinition.LogSource != "" {
 		sourceName = container.CheckDefinition.LogSource
 	}
 
+	// the checks of the check definition run the healthcheck binary, which
+	// is only available with declarative health checks
+	var checks []*models.Check
+	if container.CheckDefinition != nil && t.useDeclarativeHealthCheck {
+		checks = container.CheckDefinition.Checks
+	}
+
 	logger.Info("transform-check-definitions-starting")
 	defer func() {
 		logger.Info("transform-check-definitions-finished")
@@ -628,7 +1098,7 @@ func (t *transformer) transformCheckDefinition(
 	readinessLogger := logger.Session("readiness-check")
 	livenessLogger := logger.Session("liveness-check")
 
-	for index, check := range container.CheckDefinition.Checks {
+	for index, check := range checks {
 
 		readinessSidecarName := fmt.Sprintf("%s-readiness-healthcheck-%d", gardenContainer.Handle(), index)
 		livenessSidecarName := fmt.Sprintf("%s-liveness-healthcheck-%d", gardenContainer.Handle(), index)
@@ -636,9 +1106,10 @@ func (t *transformer) transformCheckDefinition(
 		if err := check.Validate(); err != nil {
 			logger.Error("invalid-check", err, lager.Data{"check": check})
 		} else if check.HttpCheck != nil {
-			timeout := int(check.HttpCheck.RequestTimeoutMs)
-			if timeout == 0 {
-				timeout = DefaultDeclarativeHealthcheckRequestTimeout
+			readinessTimeout, livenessTimeout := probes.startup.timeoutMs(), probes.liveness.timeoutMs()
+			if check.HttpCheck.RequestTimeoutMs > 0 {
+				readinessTimeout = int(check.HttpCheck.RequestTimeoutMs)
+				livenessTimeout = readinessTimeout
 			}
 			path := check.HttpCheck.Path
 			if path == "" {
@@ -647,23 +1118,35 @@ func (t *transformer) transformCheckDefinition(
 			// we can use the fact that time.Duration is an int64 to simplify creating the proper time.Duration object from desired number of Milliseconds
 			interval := time.Duration(check.HttpCheck.IntervalMs) * time.Millisecond
 			if interval == 0 {
-				interval = t.healthyMonitoringInterval
+				interval = probes.liveness.interval
 			}
 
-			readinessChecks = append(readinessChecks, t.createCheck(
-				container,
-				gardenContainer,
-				bindMounts,
-				path,
-				readinessSidecarName,
-				int(check.HttpCheck.Port),
-				timeout,
-				true,
-				true,
-				t.unhealthyMonitoringInterval,
-				readinessLogger,
-				"",
-			))
+			if options, ok := container.HTTPCheck(check.HttpCheck.Port); ok {
+				readinessChecks = append(readinessChecks, steps.NamedCheck{
+					Name:  fmt.Sprintf("http-%d", check.HttpCheck.Port),
+					Check: t.createHTTPCheck(container, options, path, time.Duration(readinessTimeout)*time.Millisecond, true, probes.startup.interval, readinessLogger),
+				})
+				livenessChecks = append(livenessChecks, t.createHTTPCheck(container, options, path, time.Duration(livenessTimeout)*time.Millisecond, false, interval, livenessLogger))
+				continue
+			}
+
+			readinessChecks = append(readinessChecks, steps.NamedCheck{
+				Name: fmt.Sprintf("http-%d", check.HttpCheck.Port),
+				Check: t.createCheck(
+					container,
+					gardenContainer,
+					bindMounts,
+					path,
+					readinessSidecarName,
+					int(check.HttpCheck.Port),
+					readinessTimeout,
+					true,
+					true,
+					probes.startup.interval,
+					readinessLogger,
+					"",
+				),
+			})
 			livenessChecks = append(livenessChecks, t.createCheck(
 				container,
 				gardenContainer,
@@ -671,7 +1154,7 @@ func (t *transformer) transformCheckDefinition(
 				path,
 				livenessSidecarName,
 				int(check.HttpCheck.Port),
-				timeout,
+				livenessTimeout,
 				true,
 				false,
 				interval,
@@ -680,30 +1163,34 @@ func (t *transformer) transformCheckDefinition(
 			))
 
 		} else if check.TcpCheck != nil {
-			timeout := int(check.TcpCheck.ConnectTimeoutMs)
-			if timeout == 0 {
-				timeout = DefaultDeclarativeHealthcheckRequestTimeout
+			readinessTimeout, livenessTimeout := probes.startup.timeoutMs(), probes.liveness.timeoutMs()
+			if check.TcpCheck.ConnectTimeoutMs > 0 {
+				readinessTimeout = int(check.TcpCheck.ConnectTimeoutMs)
+				livenessTimeout = readinessTimeout
 			}
 			// we can use the fact that time.Duration is an int64 to simplify creating the proper time.Duration object from desired number of Milliseconds
 			interval := time.Duration(check.TcpCheck.IntervalMs) * time.Millisecond
 			if interval == 0 {
-				interval = t.healthyMonitoringInterval
+				interval = probes.liveness.interval
 			}
 
-			readinessChecks = append(readinessChecks, t.createCheck(
-				container,
-				gardenContainer,
-				bindMounts,
-				"",
-				readinessSidecarName,
-				int(check.TcpCheck.Port),
-				timeout,
-				false,
-				true,
-				t.unhealthyMonitoringInterval,
-				readinessLogger,
-				"",
-			))
+			readinessChecks = append(readinessChecks, steps.NamedCheck{
+				Name: fmt.Sprintf("tcp-%d", check.TcpCheck.Port),
+				Check: t.createCheck(
+					container,
+					gardenContainer,
+					bindMounts,
+					"",
+					readinessSidecarName,
+					int(check.TcpCheck.Port),
+					readinessTimeout,
+					false,
+					true,
+					probes.startup.interval,
+					readinessLogger,
+					"",
+				),
+			})
 			livenessChecks = append(livenessChecks, t.createCheck(
 				container,
 				gardenContainer,
@@ -711,7 +1198,7 @@ func (t *transformer) transformCheckDefinition(
 				"",
 				livenessSidecarName,
 				int(check.TcpCheck.Port),
-				timeout,
+				livenessTimeout,
 				false,
 				false,
 				interval,
@@ -721,17 +1208,46 @@ func (t *transformer) transformCheckDefinition(
 		}
 	}
 
-	readinessCheck := steps.NewParallel(append(proxyReadinessChecks, readinessChecks...))
-	livenessCheck := steps.NewCodependent(livenessChecks, false, false)
+	for _, check := range container.ExecChecks {
+		readinessTimeout, livenessTimeout := probes.startup.timeout, probes.liveness.timeout
+		if check.TimeoutMs > 0 {
+			readinessTimeout = time.Duration(check.TimeoutMs) * time.Millisecond
+			livenessTimeout = readinessTimeout
+		}
+		// we can use the fact that time.Duration is an int64 to simplify creating the proper time.Duration object from desired number of Milliseconds
+		interval := time.Duration(check.IntervalMs) * time.Millisecond
+		if interval == 0 {
+			interval = probes.liveness.interval
+		}
+
+		readinessChecks = append(readinessChecks, steps.NamedCheck{
+			Name:  "exec-" + check.Path,
+			Check: t.createExecCheck(container, gardenContainer, check, readinessTimeout, true, probes.startup.interval, readinessLogger),
+		})
+		livenessChecks = append(livenessChecks, t.createExecCheck(container, gardenContainer, check, livenessTimeout, false, interval, livenessLogger))
+	}
+
+	// the proxy must come up regardless of the startup condition of the
+	// container
+	aggregateReadiness := steps.NewAggregateReadiness(readinessChecks, probes.requireAllStartupChecks, readinessLogger)
+	readinessCheck := steps.NewDelay(steps.NewParallel(append(proxyReadinessChecks, aggregateReadiness)), probes.startup.initialDelay, t.clock)
+	livenessCheck := steps.NewDelay(steps.NewCodependent(livenessChecks, false, false), probes.liveness.initialDelay, t.clock)
 
 	return steps.NewHealthCheckStep(
 		readinessCheck,
 		livenessCheck,
+		readinessMonitor,
 		logger,
 		t.clock,
 		logstreamer,
 		logstreamer.WithSource(sourceName),
-		time.Duration(container.StartTimeoutMs)*time.Millisecond,
+		t.healthCheckLogSources,
+		t.startTimeout(*container),
+		t.readinessPolicy(),
+		t.startupProgressInterval,
+		t.livenessBudget(probes.liveness),
+		onTransition,
+		onLivenessWarning,
 	)
 }
 
@@ -774,3 +1290,31 @@ func (t *transformer) transformContainerProxyStep(
 		execContainer.Privileged,
 	), proxyLogger)
 }
+
+// StartTimeout is how long the container may take to become healthy. It is
+// 0 when the container has no start timeout.
+func (t *transformer) StartTimeout(container executor.Container) time.Duration {
+	return t.startTimeout(container)
+}
+
+func (t *transformer) startTimeout(container executor.Container) time.Duration {
+	if container.Probes != nil && container.Probes.Startup != nil && container.Probes.Startup.FailureThreshold > 0 {
+		startup := container.Probes.Startup
+		interval := t.unhealthyMonitoringInterval
+		if startup.IntervalMs > 0 {
+			interval = time.Duration(startup.IntervalMs) * time.Millisecond
+		}
+		return time.Duration(startup.InitialDelayMs)*time.Millisecond + time.Duration(startup.FailureThreshold)*interval
+	}
+	if container.StartTimeoutMs == 0 {
+		return t.defaultStartTimeout
+	}
+	return time.Duration(container.StartTimeoutMs) * time.Millisecond
+}
+
+func (t *transformer) readinessPolicy() steps.ReadinessFailurePolicy {
+	if t.readinessFailurePolicy == "" {
+		return steps.ReadinessFailurePolicyCrash
+	}
+	return t.readinessFailurePolicy
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,9 +18,12 @@ import (
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/executor"
 	"code.cloudfoundry.org/executor/depot/log_streamer"
+	"code.cloudfoundry.org/executor/depot/steps"
 	"code.cloudfoundry.org/executor/depot/transformer"
 	"code.cloudfoundry.org/garden"
 	"code.cloudfoundry.org/garden/gardenfakes"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/go-loggregator/v8/rpc/loggregator_v2"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/workpool"
@@ -129,6 +133,129 @@ var _ = Describe("Transformer", func() {
 			})
 		})
 
+		Context("when a probe times out after its interval", func() {
+			BeforeEach(func() {
+				container.Probes = &executor.Probes{Liveness: &executor.Probe{IntervalMs: 100, TimeoutMs: 200}}
+			})
+
+			It("returns an error", func() {
+				_, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).To(Equal(transformer.ErrInvalidProbe))
+			})
+		})
+
+		Context("when the startup condition is unknown", func() {
+			BeforeEach(func() {
+				container.Probes = &executor.Probes{StartupCondition: "most"}
+			})
+
+			It("returns an error", func() {
+				_, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).To(Equal(transformer.ErrInvalidReadinessCondition))
+			})
+		})
+
+		Context("when the process watchdog is enabled", func() {
+			BeforeEach(func() {
+				options = append(options, transformer.WithProcessWatchdog(time.Second))
+				container.Setup = nil
+				container.Monitor = nil
+				container.ProcessWatchdog = &executor.ProcessWatchdog{MaxZombies: 1, FailOnLimit: true}
+			})
+
+			It("runs the watchdog alongside the action", func() {
+				actionExited := make(chan struct{})
+				gardenContainer.RunStub = func(processSpec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+					fakeProcess := &gardenfakes.FakeProcess{}
+					if processSpec.Path == "sh" {
+						fmt.Fprintln(processIO.Stdout, "3 2 10")
+						return fakeProcess, nil
+					}
+					fakeProcess.WaitStub = func() (int, error) {
+						<-actionExited
+						return 143, nil
+					}
+					fakeProcess.SignalStub = func(garden.Signal) error {
+						close(actionExited)
+						return nil
+					}
+					return fakeProcess, nil
+				}
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(gardenContainer.RunCallCount).Should(Equal(1))
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(process.Wait()).Should(Receive(MatchError(ContainSubstring("Instance exceeded process watchdog limit: 2 zombie processes exceeds the limit of 1"))))
+			})
+
+			Context("when the container does not enable the watchdog", func() {
+				BeforeEach(func() {
+					container.ProcessWatchdog = nil
+				})
+
+				It("does not sample the processes of the container", func() {
+					gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+
+					runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+					Expect(err).NotTo(HaveOccurred())
+
+					ifrit.Background(runner)
+					Eventually(gardenContainer.RunCallCount).Should(Equal(1))
+					Consistently(gardenContainer.RunCallCount).Should(Equal(1))
+					processSpec, _ := gardenContainer.RunArgsForCall(0)
+					Expect(processSpec.Path).To(Equal("/action/path"))
+				})
+			})
+		})
+
+		Context("when a timeline is configured", func() {
+			BeforeEach(func() {
+				cfg.Timeline = steps.NewTimeline(clock)
+				container.Setup = &models.Action{
+					SerialAction: &models.SerialAction{
+						Actions: []*models.Action{
+							{RunAction: &models.RunAction{Path: "/setup/first"}},
+							{RunAction: &models.RunAction{Path: "/setup/second"}},
+						},
+					},
+				}
+				container.Monitor = nil
+			})
+
+			It("records when each step ran", func() {
+				gardenContainer.RunStub = func(processSpec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+					fakeProcess := &gardenfakes.FakeProcess{}
+					if processSpec.Path == "/action/path" {
+						fakeProcess.WaitReturns(1, nil)
+					}
+					return fakeProcess, nil
+				}
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+
+				var names []string
+				for _, timing := range cfg.Timeline.Steps() {
+					names = append(names, timing.Step)
+					Expect(timing.FinishedAt).NotTo(BeZero())
+					Expect(timing.Failed).To(Equal(timing.Step == "action/run"), timing.Step)
+				}
+				Expect(names).To(Equal([]string{
+					"setup/serial",
+					"setup/serial[0]/run",
+					"setup/serial[1]/run",
+					"action/run",
+				}))
+			})
+		})
+
 		Context("when there is a specified setup, post-setup, action, sidecars and monitor", func() {
 			BeforeEach(func() {
 				options = []transformer.Option{
@@ -213,6 +340,285 @@ var _ = Describe("Transformer", func() {
 			})
 		})
 
+		Context("when a sidecar has a readiness check", func() {
+			BeforeEach(func() {
+				container.Setup = nil
+				container.Monitor = nil
+				container.Sidecars = []executor.Sidecar{
+					{
+						Action: &models.Action{
+							RunAction: &models.RunAction{
+								Path: "/sidecar-action",
+							},
+						},
+						ReadinessCheck: &executor.ExecCheck{Path: "/sidecar/ready", IntervalMs: 100},
+					},
+				}
+			})
+
+			It("starts the action once the check passed", func() {
+				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+				ifrit.Background(runner)
+
+				Eventually(gardenContainer.RunCallCount).Should(Equal(1))
+				processSpec, _ := gardenContainer.RunArgsForCall(0)
+				Expect(processSpec.Path).To(Equal("/sidecar-action"))
+				Consistently(gardenContainer.RunCallCount).Should(Equal(1))
+
+				clock.WaitForWatcherAndIncrement(100 * time.Millisecond)
+				Eventually(gardenContainer.RunCallCount).Should(Equal(3))
+				processSpec, _ = gardenContainer.RunArgsForCall(1)
+				Expect(processSpec.Path).To(Equal("/sidecar/ready"))
+				processSpec, _ = gardenContainer.RunArgsForCall(2)
+				Expect(processSpec.Path).To(Equal("/action/path"))
+			})
+		})
+
+		Context("when the container has init actions", func() {
+			BeforeEach(func() {
+				container.Monitor = nil
+				container.InitActions = []executor.InitAction{
+					{Action: &models.Action{RunAction: &models.RunAction{Path: "/init/first"}}},
+					{Action: &models.Action{RunAction: &models.RunAction{Path: "/init/second"}}, TimeoutMs: 1000, LogSource: "INIT"},
+				}
+			})
+
+			It("runs them in order between the setup and the action", func() {
+				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+
+				var paths []string
+				for i := 0; i < gardenContainer.RunCallCount(); i++ {
+					processSpec, _ := gardenContainer.RunArgsForCall(i)
+					paths = append(paths, processSpec.Path)
+				}
+				Expect(paths).To(Equal([]string{"/setup/path", "/init/first", "/init/second", "/action/path"}))
+			})
+
+			It("does not run the action when an init action fails", func() {
+				gardenContainer.RunStub = func(processSpec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+					fakeProcess := &gardenfakes.FakeProcess{}
+					if processSpec.Path == "/init/first" {
+						fakeProcess.WaitReturns(1, nil)
+					}
+					return fakeProcess, nil
+				}
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+				Expect(gardenContainer.RunCallCount()).To(Equal(2))
+			})
+
+			It("marks the action as started only once the init actions succeeded", func() {
+				gardenContainer.RunStub = func(processSpec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+					fakeProcess := &gardenfakes.FakeProcess{}
+					if processSpec.Path == "/init/second" {
+						fakeProcess.WaitReturns(1, nil)
+					}
+					return fakeProcess, nil
+				}
+				cfg.ActionMarker = steps.NewActionMarker()
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+				Expect(cfg.ActionMarker.Started()).To(BeFalse())
+
+				gardenContainer.RunStub = nil
+				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+				runner, err = optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process = ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+				Expect(cfg.ActionMarker.Started()).To(BeTrue())
+			})
+
+			It("runs them again, but not the setup, when the container is restarted", func() {
+				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+				cfg.Restarted = true
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+
+				var paths []string
+				for i := 0; i < gardenContainer.RunCallCount(); i++ {
+					processSpec, _ := gardenContainer.RunArgsForCall(i)
+					paths = append(paths, processSpec.Path)
+				}
+				Expect(paths).To(Equal([]string{"/init/first", "/init/second", "/action/path"}))
+			})
+
+			It("returns an error when an init action is empty", func() {
+				container.InitActions = append(container.InitActions, executor.InitAction{})
+				_, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).To(MatchError("init action cannot be empty"))
+			})
+		})
+
+		Context("when the container is reattached", func() {
+			var exitStatus int
+
+			BeforeEach(func() {
+				exitStatus = 0
+				container.Monitor = nil
+				container.InitActions = []executor.InitAction{
+					{Action: &models.Action{RunAction: &models.RunAction{Path: "/init/first"}}},
+				}
+				gardenContainer.HandleReturns("some-handle")
+				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+				gardenContainer.AttachStub = func(processID string, processIO garden.ProcessIO) (garden.Process, error) {
+					fakeProcess := &gardenfakes.FakeProcess{}
+					fakeProcess.IDReturns(processID)
+					fakeProcess.WaitReturns(exitStatus, nil)
+					return fakeProcess, nil
+				}
+
+				cfg.Reattach = true
+				cfg.RunningProcesses = []string{"some-handle-action-run"}
+			})
+
+			It("attaches to the process of the action without running the setup and the init actions", func() {
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				process := ifrit.Background(runner)
+				Eventually(process.Wait()).Should(Receive(BeNil()))
+
+				Expect(gardenContainer.RunCallCount()).To(Equal(0))
+				Expect(gardenContainer.AttachCallCount()).To(Equal(1))
+				processID, _ := gardenContainer.AttachArgsForCall(0)
+				Expect(processID).To(Equal("some-handle-action-run"))
+			})
+
+			Context("when the process of the action exited while the executor was down", func() {
+				BeforeEach(func() {
+					exitStatus = 1
+					cfg.RunningProcesses = nil
+				})
+
+				It("attaches to it anyway to fail with its exit status", func() {
+					runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+					Expect(err).NotTo(HaveOccurred())
+
+					process := ifrit.Background(runner)
+					Eventually(process.Wait()).Should(Receive(MatchError(ContainSubstring("Exited with status 1"))))
+					Expect(gardenContainer.RunCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the container has a proxy", func() {
+				BeforeEach(func() {
+					container.EnableContainerProxy = true
+					options = append(options, transformer.WithContainerProxy(time.Second))
+
+					gardenContainer.AttachStub = func(processID string, processIO garden.ProcessIO) (garden.Process, error) {
+						fakeProcess := &gardenfakes.FakeProcess{}
+						fakeProcess.IDReturns(processID)
+						fakeProcess.WaitStub = func() (int, error) {
+							select {}
+						}
+						return fakeProcess, nil
+					}
+				})
+
+				It("attaches to the proxy only while it is still running", func() {
+					cfg.RunningProcesses = append(cfg.RunningProcesses, "some-handle-envoy")
+					runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+					Expect(err).NotTo(HaveOccurred())
+
+					ifrit.Background(runner)
+					Eventually(gardenContainer.AttachCallCount).Should(Equal(2))
+					var ids []string
+					for i := 0; i < gardenContainer.AttachCallCount(); i++ {
+						id, _ := gardenContainer.AttachArgsForCall(i)
+						ids = append(ids, id)
+					}
+					Expect(ids).To(ConsistOf("some-handle-action-run", "some-handle-envoy"))
+					Expect(gardenContainer.RunCallCount()).To(Equal(0))
+				})
+
+				It("runs the proxy again when it is gone", func() {
+					runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+					Expect(err).NotTo(HaveOccurred())
+
+					ifrit.Background(runner)
+					Eventually(gardenContainer.RunCallCount).Should(Equal(1))
+					processSpec, _ := gardenContainer.RunArgsForCall(0)
+					Expect(processSpec.ID).To(Equal("some-handle-envoy"))
+				})
+			})
+		})
+
+		Context("when a sidecar has a restart policy and a memory limit", func() {
+			BeforeEach(func() {
+				container.Setup = nil
+				container.Monitor = nil
+				container.Sidecars = []executor.Sidecar{
+					{
+						Action: &models.Action{
+							RunAction: &models.RunAction{
+								Path: "/sidecar-action",
+							},
+						},
+						MemoryMB:      64,
+						RestartPolicy: executor.SidecarRestartOnFailure,
+					},
+				}
+			})
+
+			It("runs the sidecar with its memory limit and restarts it when it fails", func() {
+				actionExit := make(chan int)
+				defer close(actionExit)
+				gardenContainer.RunStub = func(processSpec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
+					fakeProcess := &gardenfakes.FakeProcess{}
+					if processSpec.Path == "/sidecar-action" {
+						fakeProcess.WaitReturns(1, nil)
+					} else {
+						fakeProcess.WaitStub = func() (int, error) { return <-actionExit, nil }
+					}
+					return fakeProcess, nil
+				}
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+				ifrit.Background(runner)
+
+				Eventually(gardenContainer.RunCallCount).Should(Equal(2))
+				var sidecarSpec garden.ProcessSpec
+				for i := 0; i < 2; i++ {
+					processSpec, _ := gardenContainer.RunArgsForCall(i)
+					if processSpec.Path == "/sidecar-action" {
+						sidecarSpec = processSpec
+					}
+				}
+				Expect(sidecarSpec.OverrideContainerLimits).To(Equal(&garden.ProcessLimits{
+					Memory: garden.MemoryLimits{LimitInBytes: 64 * 1024 * 1024},
+				}))
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(gardenContainer.RunCallCount).Should(Equal(3))
+				processSpec, _ := gardenContainer.RunArgsForCall(2)
+				Expect(processSpec.Path).To(Equal("/sidecar-action"))
+			})
+		})
+
 		It("logs container setup time", func() {
 			gardenContainer.RunStub = func(processSpec garden.ProcessSpec, processIO garden.ProcessIO) (garden.Process, error) {
 				if processSpec.Path == "/setup/path" {
@@ -575,7 +981,7 @@ var _ = Describe("Transformer", func() {
 							livenessIOCh <- io
 							return livenessProcess, nil
 						}
-					case "/monitor/path":
+					case "/monitor/path", "/exec/probe":
 						return monitorProcess, nil
 					}
 
@@ -626,6 +1032,25 @@ var _ = Describe("Transformer", func() {
 					process.Signal(os.Kill)
 				})
 
+				Context("and there is an exec check", func() {
+					BeforeEach(func() {
+						container.ExecChecks = []executor.ExecCheck{{Path: "/exec/probe", Args: []string{"ready"}}}
+					})
+
+					JustBeforeEach(func() {
+						clock.WaitForWatcherAndIncrement(unhealthyMonitoringInterval)
+					})
+
+					It("runs the command in the container instead of the monitor action", func() {
+						Eventually(specs).Should(Receive(WithTransform(func(spec garden.ProcessSpec) string {
+							return spec.Path
+						}, Equal("/exec/probe"))))
+						Expect(specs).NotTo(Receive(WithTransform(func(spec garden.ProcessSpec) string {
+							return spec.Path
+						}, Equal("/monitor/path"))))
+					})
+				})
+
 				Context("and no check definitions exist", func() {
 					JustBeforeEach(func() {
 						clock.WaitForWatcherAndIncrement(unhealthyMonitoringInterval)
@@ -714,6 +1139,18 @@ var _ = Describe("Transformer", func() {
 						}
 					})
 
+					Context("and the http check is probed by the executor", func() {
+						BeforeEach(func() {
+							container.HTTPChecks = []executor.HTTPCheckOptions{{Port: 5432, Scheme: "https"}}
+						})
+
+						It("does not run the healthcheck in a sidecar container", func() {
+							Consistently(specs).ShouldNot(Receive(WithTransform(func(spec garden.ProcessSpec) string {
+								return spec.Path
+							}, Equal(filepath.Join(transformer.HealthCheckDstPath, "healthcheck")))))
+						})
+					})
+
 					Context("and container proxy is enabled", func() {
 						BeforeEach(func() {
 							options = append(options, transformer.WithContainerProxy(time.Second))
@@ -869,6 +1306,77 @@ var _ = Describe("Transformer", func() {
 						})
 					})
 
+					Context("and the starttimeout is set to 0 with a default start timeout", func() {
+						BeforeEach(func() {
+							container.StartTimeoutMs = 0
+							options = append(options, transformer.WithReadinessPolicy(time.Minute, steps.ReadinessFailurePolicyCrash))
+						})
+
+						It("runs the healthcheck with the default readiness timeout", func() {
+							Eventually(gardenContainer.RunCallCount).Should(Equal(2))
+							args := [][]string{}
+							for i := 0; i < gardenContainer.RunCallCount(); i++ {
+								spec, _ := gardenContainer.RunArgsForCall(i)
+								args = append(args, spec.Args)
+							}
+
+							Expect(args).To(ContainElement([]string{
+								"-port=5432",
+								"-timeout=100ms",
+								"-uri=/some/path",
+								"-readiness-interval=1ms",
+								"-readiness-timeout=1m0s",
+							}))
+						})
+					})
+
+					Context("and the readiness failure policy is keep-waiting", func() {
+						BeforeEach(func() {
+							options = append(options, transformer.WithReadinessPolicy(0, steps.ReadinessFailurePolicyKeepWaiting))
+						})
+
+						It("does not let the healthcheck enforce the readiness timeout", func() {
+							Eventually(gardenContainer.RunCallCount).Should(Equal(2))
+							args := [][]string{}
+							for i := 0; i < gardenContainer.RunCallCount(); i++ {
+								spec, _ := gardenContainer.RunArgsForCall(i)
+								args = append(args, spec.Args)
+							}
+
+							Expect(args).To(ContainElement([]string{
+								"-port=5432",
+								"-timeout=100ms",
+								"-uri=/some/path",
+								"-readiness-interval=1ms",
+								"-readiness-timeout=0s",
+							}))
+						})
+					})
+
+					Context("and the container is IPv6 only", func() {
+						BeforeEach(func() {
+							container.IPFamily = executor.IPFamilyIPv6
+						})
+
+						It("probes the IPv6 address of the container", func() {
+							Eventually(gardenContainer.RunCallCount).Should(Equal(2))
+							args := [][]string{}
+							for i := 0; i < gardenContainer.RunCallCount(); i++ {
+								spec, _ := gardenContainer.RunArgsForCall(i)
+								args = append(args, spec.Args)
+							}
+
+							Expect(args).To(ContainElement([]string{
+								"-port=5432",
+								"-timeout=100ms",
+								"-uri=/some/path",
+								"-network=tcp6",
+								"-readiness-interval=1ms",
+								"-readiness-timeout=1s",
+							}))
+						})
+					})
+
 					Context("and optional fields are missing", func() {
 						BeforeEach(func() {
 							container.CheckDefinition = &models.CheckDefinition{
@@ -970,6 +1478,19 @@ var _ = Describe("Transformer", func() {
 						It("returns the readiness check output in the error", func() {
 							Eventually(process.Wait()).Should(Receive(MatchError(MatchRegexp("Instance never healthy after 1\\d\\dms: readiness check starting\nreadiness check failed"))))
 						})
+
+						Context("when health check log sources are enabled", func() {
+							BeforeEach(func() {
+								options = append(options, transformer.WithHealthCheckLogSources(steps.DefaultHealthCheckLogSources))
+							})
+
+							It("logs the readiness check output under the startup source", func() {
+								Eventually(fakeMetronClient.SendAppErrorLogCallCount).Should(Equal(3))
+								msg, source, _ := fakeMetronClient.SendAppErrorLogArgsForCall(0)
+								Expect(source).To(Equal("STARTUP"))
+								Expect(msg).To(Equal("readiness check starting"))
+							})
+						})
 					})
 
 					Context("when the readiness check passes", func() {
@@ -1071,6 +1592,19 @@ var _ = Describe("Transformer", func() {
 							It("returns the liveness check output in the error", func() {
 								Eventually(process.Wait()).Should(Receive(MatchError(ContainSubstring("Instance became unhealthy: liveness check failed"))))
 							})
+
+							Context("when health check log sources are enabled", func() {
+								BeforeEach(func() {
+									options = append(options, transformer.WithHealthCheckLogSources(steps.DefaultHealthCheckLogSources))
+								})
+
+								It("logs the liveness check output under the liveness source", func() {
+									Eventually(fakeMetronClient.SendAppErrorLogCallCount).Should(Equal(2))
+									msg, source, _ := fakeMetronClient.SendAppErrorLogArgsForCall(0)
+									Expect(source).To(Equal("LIVENESS"))
+									Expect(msg).To(Equal("liveness check failed"))
+								})
+							})
 						})
 					})
 				})
@@ -1121,6 +1655,30 @@ var _ = Describe("Transformer", func() {
 								"-readiness-timeout=1s",
 							}))
 						})
+
+						Context("and there is a startup probe", func() {
+							BeforeEach(func() {
+								container.Probes = &executor.Probes{
+									Startup: &executor.Probe{IntervalMs: 2000, TimeoutMs: 500, FailureThreshold: 3},
+								}
+							})
+
+							It("uses the settings of the probe", func() {
+								Eventually(gardenContainer.RunCallCount).Should(Equal(2))
+								args := [][]string{}
+								for i := 0; i < gardenContainer.RunCallCount(); i++ {
+									spec, _ := gardenContainer.RunArgsForCall(i)
+									args = append(args, spec.Args)
+								}
+
+								Expect(args).To(ContainElement([]string{
+									"-port=6432",
+									"-timeout=500ms",
+									"-readiness-interval=2s",
+									"-readiness-timeout=6s",
+								}))
+							})
+						})
 					})
 
 					It("uses the readiness check definition", func() {
@@ -1485,6 +2043,47 @@ var _ = Describe("Transformer", func() {
 							},
 						})))
 					})
+
+					Context("and the container is reachable from the executor", func() {
+						var (
+							listener net.Listener
+							address  string
+						)
+
+						BeforeEach(func() {
+							var err error
+							listener, err = net.Listen("tcp", "127.0.0.1:0")
+							Expect(err).NotTo(HaveOccurred())
+							address = listener.Addr().String()
+							listener.Close()
+
+							container.InternalIP = "127.0.0.1"
+							cfg.ProxyTLSPorts = []uint16{uint16(listener.Addr().(*net.TCPAddr).Port)}
+						})
+
+						AfterEach(func() {
+							listener.Close()
+						})
+
+						It("does not become ready until envoy accepts connections on the proxy ports", func() {
+							Eventually(func() int {
+								clock.Increment(unhealthyMonitoringInterval)
+								return gardenContainer.RunCallCount()
+							}).Should(Equal(2))
+							monitorCh <- 0
+
+							ready := func() <-chan struct{} {
+								clock.Increment(unhealthyMonitoringInterval)
+								return process.Ready()
+							}
+							Consistently(ready).ShouldNot(BeClosed())
+
+							var err error
+							listener, err = net.Listen("tcp", address)
+							Expect(err).NotTo(HaveOccurred())
+							Eventually(ready).Should(BeClosed())
+						})
+					})
 				})
 
 				Context("and there is no monitor action", func() {
@@ -1537,6 +2136,42 @@ var _ = Describe("Transformer", func() {
 				Eventually(process.Wait()).Should(Receive(nil))
 			})
 
+			It("emits the health check metrics of the instance", func() {
+				container.LogConfig = executor.LogConfig{Guid: "app-guid", Index: 3}
+				tags := make(chan map[string]string, 10)
+				fakeMetronClient.SendMetricStub = func(name string, value int, opts ...loggregator.EmitGaugeOption) error {
+					if name == transformer.ReadinessTransitionCount {
+						e := &loggregator_v2.Envelope{Tags: map[string]string{}}
+						for _, opt := range opts {
+							opt(e)
+						}
+						tags <- e.Tags
+					}
+					return nil
+				}
+				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
+
+				runner, err := optimusPrime.StepsRunner(logger, container, gardenContainer, logStreamer, cfg)
+				Expect(err).NotTo(HaveOccurred())
+				process := ifrit.Background(runner)
+
+				Eventually(gardenContainer.RunCallCount).Should(Equal(1))
+				clock.Increment(1 * time.Second)
+				Eventually(process.Ready()).Should(BeClosed())
+
+				Eventually(tags).Should(Receive(Equal(map[string]string{"source_id": "app-guid", "instance_id": "3"})))
+				durations := []string{}
+				for i := 0; i < fakeMetronClient.SendDurationCallCount(); i++ {
+					name, _, _ := fakeMetronClient.SendDurationArgsForCall(i)
+					durations = append(durations, name)
+				}
+				Expect(durations).To(ContainElement(transformer.StartupCheckDuration))
+
+				process.Signal(os.Interrupt)
+				clock.Increment(1 * time.Second)
+				Eventually(process.Wait()).Should(Receive(nil))
+			})
+
 			It("logs the container creation time", func() {
 				gardenContainer.RunReturns(&gardenfakes.FakeProcess{}, nil)
 				cfg.CreationStartTime = clock.Now()
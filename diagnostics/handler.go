@@ -0,0 +1,154 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+
+	"code.cloudfoundry.org/executor/loglevel"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// RuntimeStats is a snapshot of the Go runtime of the executor.
+type RuntimeStats struct {
+	Goroutines     int    `json:"goroutines"`
+	NumCPU         int    `json:"num_cpu"`
+	GOMAXPROCS     int    `json:"gomaxprocs"`
+	GOGC           int    `json:"gogc"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64 `json:"heap_sys_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	NumGC          uint32 `json:"num_gc"`
+	PauseTotalNs   uint64 `json:"pause_total_ns"`
+}
+
+// RuntimeSettings adjusts the Go runtime. Unset fields are left unchanged; a
+// negative GOGC turns the garbage collector off.
+type RuntimeSettings struct {
+	GOGC       *int `json:"gogc,omitempty"`
+	GOMAXPROCS *int `json:"gomaxprocs,omitempty"`
+}
+
+// Handler serves profiles and runtime diagnostics to operators:
+//
+//	GET /debug/pprof/...
+//	GET /debug/runtime
+//	PUT /debug/runtime
+//	    /debug/log-level/... (see loglevel.Handler)
+//
+// Requests must present a verified client certificate whose common name or
+// one of whose URI SANs is one of the operator identities.
+func Handler(logger lager.Logger, operatorIdentities []string, logLevels *loglevel.Controller) http.Handler {
+	logger = logger.Session("diagnostics-handler")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	logLevelHandler := http.StripPrefix("/debug/log-level", loglevel.Handler(logger, logLevels))
+	mux.Handle("/debug/log-level", logLevelHandler)
+	mux.Handle("/debug/log-level/", logLevelHandler)
+	mux.HandleFunc("/debug/runtime", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var settings RuntimeSettings
+			err := json.NewDecoder(r.Body).Decode(&settings)
+			if err != nil || (settings.GOMAXPROCS != nil && *settings.GOMAXPROCS < 1) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			apply(logger, settings)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats())
+	})
+
+	return RequireOperator(logger, operatorIdentities, mux)
+}
+
+type operatorKey struct{}
+
+// RequireOperator forbids requests that do not present a verified client
+// certificate of one of the operator identities.
+func RequireOperator(logger lager.Logger, operatorIdentities []string, handler http.Handler) http.Handler {
+	identities := map[string]bool{}
+	for _, identity := range operatorIdentities {
+		identities[identity] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := authorized(r, identities)
+		if !ok {
+			logger.Info("unauthorized-request", lager.Data{"path": r.URL.Path})
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), operatorKey{}, operator)))
+	})
+}
+
+// Operator is the identity of the operator that RequireOperator allowed the
+// request of, or empty when the request did not go through it.
+func Operator(r *http.Request) string {
+	operator, _ := r.Context().Value(operatorKey{}).(string)
+	return operator
+}
+
+func authorized(r *http.Request, identities map[string]bool) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	if identities[cert.Subject.CommonName] {
+		return cert.Subject.CommonName, true
+	}
+	for _, uri := range cert.URIs {
+		if identities[uri.String()] {
+			return uri.String(), true
+		}
+	}
+	return "", false
+}
+
+func apply(logger lager.Logger, settings RuntimeSettings) {
+	if settings.GOGC != nil {
+		previous := debug.SetGCPercent(*settings.GOGC)
+		logger.Info("set-gogc", lager.Data{"previous": previous, "gogc": *settings.GOGC})
+	}
+	if settings.GOMAXPROCS != nil {
+		previous := runtime.GOMAXPROCS(*settings.GOMAXPROCS)
+		logger.Info("set-gomaxprocs", lager.Data{"previous": previous, "gomaxprocs": *settings.GOMAXPROCS})
+	}
+}
+
+func stats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	// the only way to read the GC percent is to set it
+	gogc := debug.SetGCPercent(-1)
+	debug.SetGCPercent(gogc)
+
+	return RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		NumCPU:         runtime.NumCPU(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		GOGC:           gogc,
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapSysBytes:   mem.HeapSys,
+		HeapObjects:    mem.HeapObjects,
+		NumGC:          mem.NumGC,
+		PauseTotalNs:   mem.PauseTotalNs,
+	}
+}
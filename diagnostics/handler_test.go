@@ -0,0 +1,155 @@
+package diagnostics_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"code.cloudfoundry.org/executor/diagnostics"
+	"code.cloudfoundry.org/executor/loglevel"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		handler   http.Handler
+		logLevels *loglevel.Controller
+		peer      *x509.Certificate
+		response  *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		logLevels = loglevel.NewController(lager.INFO)
+		handler = diagnostics.Handler(lagertest.NewTestLogger("test"), []string{"operator", "spiffe://cf/operator"}, logLevels)
+		peer = &x509.Certificate{Subject: pkix.Name{CommonName: "operator"}}
+		response = httptest.NewRecorder()
+	})
+
+	serve := func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if peer != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{peer}}}
+		}
+		handler.ServeHTTP(response, req)
+	}
+
+	It("serves pprof profiles", func() {
+		serve(http.MethodGet, "/debug/pprof/goroutine?debug=1", "")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(ContainSubstring("goroutine profile"))
+	})
+
+	It("serves runtime stats", func() {
+		serve(http.MethodGet, "/debug/runtime", "")
+		Expect(response.Code).To(Equal(http.StatusOK))
+
+		var stats diagnostics.RuntimeStats
+		Expect(json.Unmarshal(response.Body.Bytes(), &stats)).To(Succeed())
+		Expect(stats.Goroutines).To(BeNumerically(">", 0))
+		Expect(stats.GOMAXPROCS).To(Equal(runtime.GOMAXPROCS(0)))
+	})
+
+	It("changes log levels", func() {
+		serve(http.MethodPut, "/debug/log-level/cred-manager-runner", `{"level": "debug"}`)
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(logLevels.Enabled("executor.cred-manager-runner", lager.DEBUG)).To(BeTrue())
+	})
+
+	Describe("adjusting the runtime", func() {
+		var gogc, gomaxprocs int
+
+		BeforeEach(func() {
+			gogc = debug.SetGCPercent(100)
+			gomaxprocs = runtime.GOMAXPROCS(0)
+		})
+
+		AfterEach(func() {
+			debug.SetGCPercent(gogc)
+			runtime.GOMAXPROCS(gomaxprocs)
+		})
+
+		It("sets GOGC and GOMAXPROCS", func() {
+			serve(http.MethodPut, "/debug/runtime", `{"gogc": 50, "gomaxprocs": 1}`)
+			Expect(response.Code).To(Equal(http.StatusOK))
+
+			var stats diagnostics.RuntimeStats
+			Expect(json.Unmarshal(response.Body.Bytes(), &stats)).To(Succeed())
+			Expect(stats.GOGC).To(Equal(50))
+			Expect(stats.GOMAXPROCS).To(Equal(1))
+		})
+
+		It("leaves unset settings unchanged", func() {
+			serve(http.MethodPut, "/debug/runtime", `{"gogc": 50}`)
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(runtime.GOMAXPROCS(0)).To(Equal(gomaxprocs))
+		})
+
+		It("rejects invalid settings", func() {
+			serve(http.MethodPut, "/debug/runtime", `{"gomaxprocs": 0}`)
+			Expect(response.Code).To(Equal(http.StatusBadRequest))
+			Expect(runtime.GOMAXPROCS(0)).To(Equal(gomaxprocs))
+		})
+	})
+
+	Context("when the client certificate has an operator URI SAN", func() {
+		BeforeEach(func() {
+			uri, err := url.Parse("spiffe://cf/operator")
+			Expect(err).NotTo(HaveOccurred())
+			peer = &x509.Certificate{Subject: pkix.Name{CommonName: "someone"}, URIs: []*url.URL{uri}}
+		})
+
+		It("allows the request", func() {
+			serve(http.MethodGet, "/debug/runtime", "")
+			Expect(response.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("RequireOperator", func() {
+		var operator string
+
+		BeforeEach(func() {
+			operator = ""
+			handler = diagnostics.RequireOperator(lagertest.NewTestLogger("test"), []string{"operator"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				operator = diagnostics.Operator(r)
+			}))
+		})
+
+		It("passes the identity of the operator to the handler", func() {
+			serve(http.MethodGet, "/exec/some-guid", "")
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(operator).To(Equal("operator"))
+		})
+	})
+
+	Context("when the client certificate is not an operator's", func() {
+		BeforeEach(func() {
+			peer = &x509.Certificate{Subject: pkix.Name{CommonName: "app"}}
+		})
+
+		It("forbids the request", func() {
+			serve(http.MethodGet, "/debug/runtime", "")
+			Expect(response.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Context("when there is no client certificate", func() {
+		BeforeEach(func() {
+			peer = nil
+		})
+
+		It("forbids the request", func() {
+			serve(http.MethodGet, "/debug/pprof/", "")
+			Expect(response.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
@@ -0,0 +1 @@
+package diagnostics // import "code.cloudfoundry.org/executor/diagnostics"
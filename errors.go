@@ -39,4 +39,32 @@ var (
 	ErrFailureToCheckSpace            = registerError("ErrFailureToCheckSpace", "failed to check available space")
 	ErrInvalidSecurityGroup           = registerError("ErrInvalidSecurityGroup", "security group has invalid values")
 	ErrNoProcessToStop                = registerError("ErrNoProcessToStop", "failed to find a process to stop")
+	ErrHostProcessNotAllowed          = registerError("HostProcessNotAllowed", "host process containers are not allowed on this cell")
+	ErrInvalidDependency              = registerError("InvalidDependency", "container dependency is invalid")
+	ErrDependencyTimeout              = registerError("DependencyTimeout", "container dependencies were not met within the start timeout")
+	ErrInvalidIPFamily                = registerError("InvalidIPFamily", "container ip family is invalid")
+	ErrInvalidTimezone                = registerError("InvalidTimezone", "container timezone is invalid")
+	ErrClockOffsetNotSupported        = registerError("ClockOffsetNotSupported", "container clock offsets are not supported on this cell")
+	ErrSysctlNotAllowed               = registerError("SysctlNotAllowed", "container sysctl is not allowed on this cell")
+	ErrReadOnlyRootfsNotSupported     = registerError("ReadOnlyRootfsNotSupported", "read-only root filesystems are not supported on this cell")
+	ErrSwapLimitsNotSupported         = registerError("SwapLimitsNotSupported", "swap limits are not supported on this cell")
+	ErrReadOnlyRootfsNotEnforced      = registerError("ReadOnlyRootfsNotEnforced", "the root filesystem of the container is writable")
+	ErrInvalidContinuationToken       = registerError("InvalidContinuationToken", "continuation token is invalid")
+	ErrInvalidPrefetchArtifact        = registerError("InvalidPrefetchArtifact", "prefetch artifact must have a valid url and a cache key")
+	ErrPrefetchNotSupported           = registerError("PrefetchNotSupported", "prefetching artifacts is not supported on this cell")
+	ErrContainerNotRunning            = registerError("ContainerNotRunning", "container must be running to run a process in it")
+	ErrPlacementTagMemoryExceeded     = registerError("PlacementTagMemoryExceeded", "memory quota of the placement tag exceeded")
+	ErrPlacementTagContainersExceeded = registerError("PlacementTagContainersExceeded", "container quota of the placement tag exceeded")
+	ErrInvalidSidecar                 = registerError("InvalidSidecar", "sidecar restart policy or limits are invalid")
+	ErrInvalidRestartPolicy           = registerError("InvalidRestartPolicy", "restart policy limits must not be negative")
+	ErrIngressBandwidthNotSupported   = registerError("IngressBandwidthNotSupported", "cell cannot limit the ingress bandwidth of containers")
+	ErrCellDraining                   = registerError("CellDraining", "cell is draining and does not accept containers")
+	ErrDrainDeadlineExceeded          = registerError("DrainDeadlineExceeded", "containers did not stop before the drain deadline")
+	ErrStartRateLimited               = registerError("StartRateLimited", "too many containers of the source started on this cell")
 )
+
+// IsRetriable reports whether a request that failed with the error may
+// succeed when it is retried later, without changing it.
+func IsRetriable(err error) bool {
+	return err == ErrStartRateLimited
+}
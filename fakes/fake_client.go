@@ -4,6 +4,7 @@ package fakes
 import (
 	"io"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/executor"
 	lager "code.cloudfoundry.org/lager/v3"
@@ -23,6 +24,17 @@ type FakeClient struct {
 	allocateContainersReturnsOnCall map[int]struct {
 		result1 []executor.AllocationFailure
 	}
+	CapabilitiesStub        func(lager.Logger) executor.CellCapabilities
+	capabilitiesMutex       sync.RWMutex
+	capabilitiesArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	capabilitiesReturns struct {
+		result1 executor.CellCapabilities
+	}
+	capabilitiesReturnsOnCall map[int]struct {
+		result1 executor.CellCapabilities
+	}
 	CleanupStub        func(lager.Logger)
 	cleanupMutex       sync.RWMutex
 	cleanupArgsForCall []struct {
@@ -41,6 +53,43 @@ type FakeClient struct {
 	deleteContainerReturnsOnCall map[int]struct {
 		result1 error
 	}
+	DeleteContainersStub        func(lager.Logger, string, executor.ContainerSelector) []executor.ContainerResult
+	deleteContainersMutex       sync.RWMutex
+	deleteContainersArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ContainerSelector
+	}
+	deleteContainersReturns struct {
+		result1 []executor.ContainerResult
+	}
+	deleteContainersReturnsOnCall map[int]struct {
+		result1 []executor.ContainerResult
+	}
+	DrainStub        func(lager.Logger, string, time.Duration) error
+	drainMutex       sync.RWMutex
+	drainArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 time.Duration
+	}
+	drainReturns struct {
+		result1 error
+	}
+	drainReturnsOnCall map[int]struct {
+		result1 error
+	}
+	FeatureFlagsStub        func(lager.Logger) []string
+	featureFlagsMutex       sync.RWMutex
+	featureFlagsArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	featureFlagsReturns struct {
+		result1 []string
+	}
+	featureFlagsReturnsOnCall map[int]struct {
+		result1 []string
+	}
 	GetBulkMetricsStub        func(lager.Logger) (map[string]executor.Metrics, error)
 	getBulkMetricsMutex       sync.RWMutex
 	getBulkMetricsArgsForCall []struct {
@@ -107,6 +156,20 @@ type FakeClient struct {
 		result1 []executor.Container
 		result2 error
 	}
+	ListContainersPageStub        func(lager.Logger, executor.ListContainersRequest) (executor.ContainerPage, error)
+	listContainersPageMutex       sync.RWMutex
+	listContainersPageArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 executor.ListContainersRequest
+	}
+	listContainersPageReturns struct {
+		result1 executor.ContainerPage
+		result2 error
+	}
+	listContainersPageReturnsOnCall map[int]struct {
+		result1 executor.ContainerPage
+		result2 error
+	}
 	PingStub        func(lager.Logger) error
 	pingMutex       sync.RWMutex
 	pingArgsForCall []struct {
@@ -118,6 +181,40 @@ type FakeClient struct {
 	pingReturnsOnCall map[int]struct {
 		result1 error
 	}
+	PlacementTagsStub        func(lager.Logger) []string
+	placementTagsMutex       sync.RWMutex
+	placementTagsArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	placementTagsReturns struct {
+		result1 []string
+	}
+	placementTagsReturnsOnCall map[int]struct {
+		result1 []string
+	}
+	PrefetchArtifactsStub        func(lager.Logger, []executor.PrefetchArtifact) error
+	prefetchArtifactsMutex       sync.RWMutex
+	prefetchArtifactsArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 []executor.PrefetchArtifact
+	}
+	prefetchArtifactsReturns struct {
+		result1 error
+	}
+	prefetchArtifactsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	PrefetchProgressStub        func(lager.Logger) executor.PrefetchProgress
+	prefetchProgressMutex       sync.RWMutex
+	prefetchProgressArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	prefetchProgressReturns struct {
+		result1 executor.PrefetchProgress
+	}
+	prefetchProgressReturnsOnCall map[int]struct {
+		result1 executor.PrefetchProgress
+	}
 	RemainingResourcesStub        func(lager.Logger) (executor.ExecutorResources, error)
 	remainingResourcesMutex       sync.RWMutex
 	remainingResourcesArgsForCall []struct {
@@ -144,12 +241,83 @@ type FakeClient struct {
 	runContainerReturnsOnCall map[int]struct {
 		result1 error
 	}
+	RunContainersStub        func(lager.Logger, string, []executor.RunRequest) []executor.ContainerResult
+	runContainersMutex       sync.RWMutex
+	runContainersArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 []executor.RunRequest
+	}
+	runContainersReturns struct {
+		result1 []executor.ContainerResult
+	}
+	runContainersReturnsOnCall map[int]struct {
+		result1 []executor.ContainerResult
+	}
+	RunProcessStub        func(lager.Logger, string, executor.ProcessSpec, executor.ProcessIO) (executor.Process, error)
+	runProcessMutex       sync.RWMutex
+	runProcessArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ProcessSpec
+		arg4 executor.ProcessIO
+	}
+	runProcessReturns struct {
+		result1 executor.Process
+		result2 error
+	}
+	runProcessReturnsOnCall map[int]struct {
+		result1 executor.Process
+		result2 error
+	}
+	ScheduledTaskResultsStub        func(lager.Logger) []executor.ScheduledTaskResult
+	scheduledTaskResultsMutex       sync.RWMutex
+	scheduledTaskResultsArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	scheduledTaskResultsReturns struct {
+		result1 []executor.ScheduledTaskResult
+	}
+	scheduledTaskResultsReturnsOnCall map[int]struct {
+		result1 []executor.ScheduledTaskResult
+	}
+	SetFeatureFlagStub        func(lager.Logger, string, bool) error
+	setFeatureFlagMutex       sync.RWMutex
+	setFeatureFlagArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 bool
+	}
+	setFeatureFlagReturns struct {
+		result1 error
+	}
+	setFeatureFlagReturnsOnCall map[int]struct {
+		result1 error
+	}
 	SetHealthyStub        func(lager.Logger, bool)
 	setHealthyMutex       sync.RWMutex
 	setHealthyArgsForCall []struct {
 		arg1 lager.Logger
 		arg2 bool
 	}
+	SetPlacementTagsStub        func(lager.Logger, []string)
+	setPlacementTagsMutex       sync.RWMutex
+	setPlacementTagsArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 []string
+	}
+	SetTotalResourcesStub        func(lager.Logger, executor.ExecutorResources) error
+	setTotalResourcesMutex       sync.RWMutex
+	setTotalResourcesArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 executor.ExecutorResources
+	}
+	setTotalResourcesReturns struct {
+		result1 error
+	}
+	setTotalResourcesReturnsOnCall map[int]struct {
+		result1 error
+	}
 	StopContainerStub        func(lager.Logger, string, string) error
 	stopContainerMutex       sync.RWMutex
 	stopContainerArgsForCall []struct {
@@ -163,10 +331,38 @@ type FakeClient struct {
 	stopContainerReturnsOnCall map[int]struct {
 		result1 error
 	}
-	SubscribeToEventsStub        func(lager.Logger) (executor.EventSource, error)
+	StopContainersStub        func(lager.Logger, string, executor.ContainerSelector) []executor.ContainerResult
+	stopContainersMutex       sync.RWMutex
+	stopContainersArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ContainerSelector
+	}
+	stopContainersReturns struct {
+		result1 []executor.ContainerResult
+	}
+	stopContainersReturnsOnCall map[int]struct {
+		result1 []executor.ContainerResult
+	}
+	StreamInStub        func(lager.Logger, string, string, io.Reader) error
+	streamInMutex       sync.RWMutex
+	streamInArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 string
+		arg4 io.Reader
+	}
+	streamInReturns struct {
+		result1 error
+	}
+	streamInReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SubscribeToEventsStub        func(lager.Logger, ...executor.SubscribeOption) (executor.EventSource, error)
 	subscribeToEventsMutex       sync.RWMutex
 	subscribeToEventsArgsForCall []struct {
 		arg1 lager.Logger
+		arg2 []executor.SubscribeOption
 	}
 	subscribeToEventsReturns struct {
 		result1 executor.EventSource
@@ -286,6 +482,67 @@ func (fake *FakeClient) AllocateContainersReturnsOnCall(i int, result1 []executo
 	}{result1}
 }
 
+func (fake *FakeClient) Capabilities(arg1 lager.Logger) executor.CellCapabilities {
+	fake.capabilitiesMutex.Lock()
+	ret, specificReturn := fake.capabilitiesReturnsOnCall[len(fake.capabilitiesArgsForCall)]
+	fake.capabilitiesArgsForCall = append(fake.capabilitiesArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	stub := fake.CapabilitiesStub
+	fakeReturns := fake.capabilitiesReturns
+	fake.recordInvocation("Capabilities", []interface{}{arg1})
+	fake.capabilitiesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) CapabilitiesCallCount() int {
+	fake.capabilitiesMutex.RLock()
+	defer fake.capabilitiesMutex.RUnlock()
+	return len(fake.capabilitiesArgsForCall)
+}
+
+func (fake *FakeClient) CapabilitiesCalls(stub func(lager.Logger) executor.CellCapabilities) {
+	fake.capabilitiesMutex.Lock()
+	defer fake.capabilitiesMutex.Unlock()
+	fake.CapabilitiesStub = stub
+}
+
+func (fake *FakeClient) CapabilitiesArgsForCall(i int) lager.Logger {
+	fake.capabilitiesMutex.RLock()
+	defer fake.capabilitiesMutex.RUnlock()
+	argsForCall := fake.capabilitiesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) CapabilitiesReturns(result1 executor.CellCapabilities) {
+	fake.capabilitiesMutex.Lock()
+	defer fake.capabilitiesMutex.Unlock()
+	fake.CapabilitiesStub = nil
+	fake.capabilitiesReturns = struct {
+		result1 executor.CellCapabilities
+	}{result1}
+}
+
+func (fake *FakeClient) CapabilitiesReturnsOnCall(i int, result1 executor.CellCapabilities) {
+	fake.capabilitiesMutex.Lock()
+	defer fake.capabilitiesMutex.Unlock()
+	fake.CapabilitiesStub = nil
+	if fake.capabilitiesReturnsOnCall == nil {
+		fake.capabilitiesReturnsOnCall = make(map[int]struct {
+			result1 executor.CellCapabilities
+		})
+	}
+	fake.capabilitiesReturnsOnCall[i] = struct {
+		result1 executor.CellCapabilities
+	}{result1}
+}
+
 func (fake *FakeClient) Cleanup(arg1 lager.Logger) {
 	fake.cleanupMutex.Lock()
 	fake.cleanupArgsForCall = append(fake.cleanupArgsForCall, struct {
@@ -381,6 +638,193 @@ func (fake *FakeClient) DeleteContainerReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeClient) DeleteContainers(arg1 lager.Logger, arg2 string, arg3 executor.ContainerSelector) []executor.ContainerResult {
+	fake.deleteContainersMutex.Lock()
+	ret, specificReturn := fake.deleteContainersReturnsOnCall[len(fake.deleteContainersArgsForCall)]
+	fake.deleteContainersArgsForCall = append(fake.deleteContainersArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ContainerSelector
+	}{arg1, arg2, arg3})
+	stub := fake.DeleteContainersStub
+	fakeReturns := fake.deleteContainersReturns
+	fake.recordInvocation("DeleteContainers", []interface{}{arg1, arg2, arg3})
+	fake.deleteContainersMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) DeleteContainersCallCount() int {
+	fake.deleteContainersMutex.RLock()
+	defer fake.deleteContainersMutex.RUnlock()
+	return len(fake.deleteContainersArgsForCall)
+}
+
+func (fake *FakeClient) DeleteContainersCalls(stub func(lager.Logger, string, executor.ContainerSelector) []executor.ContainerResult) {
+	fake.deleteContainersMutex.Lock()
+	defer fake.deleteContainersMutex.Unlock()
+	fake.DeleteContainersStub = stub
+}
+
+func (fake *FakeClient) DeleteContainersArgsForCall(i int) (lager.Logger, string, executor.ContainerSelector) {
+	fake.deleteContainersMutex.RLock()
+	defer fake.deleteContainersMutex.RUnlock()
+	argsForCall := fake.deleteContainersArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) DeleteContainersReturns(result1 []executor.ContainerResult) {
+	fake.deleteContainersMutex.Lock()
+	defer fake.deleteContainersMutex.Unlock()
+	fake.DeleteContainersStub = nil
+	fake.deleteContainersReturns = struct {
+		result1 []executor.ContainerResult
+	}{result1}
+}
+
+func (fake *FakeClient) DeleteContainersReturnsOnCall(i int, result1 []executor.ContainerResult) {
+	fake.deleteContainersMutex.Lock()
+	defer fake.deleteContainersMutex.Unlock()
+	fake.DeleteContainersStub = nil
+	if fake.deleteContainersReturnsOnCall == nil {
+		fake.deleteContainersReturnsOnCall = make(map[int]struct {
+			result1 []executor.ContainerResult
+		})
+	}
+	fake.deleteContainersReturnsOnCall[i] = struct {
+		result1 []executor.ContainerResult
+	}{result1}
+}
+
+func (fake *FakeClient) Drain(arg1 lager.Logger, arg2 string, arg3 time.Duration) error {
+	fake.drainMutex.Lock()
+	ret, specificReturn := fake.drainReturnsOnCall[len(fake.drainArgsForCall)]
+	fake.drainArgsForCall = append(fake.drainArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 time.Duration
+	}{arg1, arg2, arg3})
+	stub := fake.DrainStub
+	fakeReturns := fake.drainReturns
+	fake.recordInvocation("Drain", []interface{}{arg1, arg2, arg3})
+	fake.drainMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) DrainCallCount() int {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	return len(fake.drainArgsForCall)
+}
+
+func (fake *FakeClient) DrainCalls(stub func(lager.Logger, string, time.Duration) error) {
+	fake.drainMutex.Lock()
+	defer fake.drainMutex.Unlock()
+	fake.DrainStub = stub
+}
+
+func (fake *FakeClient) DrainArgsForCall(i int) (lager.Logger, string, time.Duration) {
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	argsForCall := fake.drainArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) DrainReturns(result1 error) {
+	fake.drainMutex.Lock()
+	defer fake.drainMutex.Unlock()
+	fake.DrainStub = nil
+	fake.drainReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) DrainReturnsOnCall(i int, result1 error) {
+	fake.drainMutex.Lock()
+	defer fake.drainMutex.Unlock()
+	fake.DrainStub = nil
+	if fake.drainReturnsOnCall == nil {
+		fake.drainReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.drainReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) FeatureFlags(arg1 lager.Logger) []string {
+	fake.featureFlagsMutex.Lock()
+	ret, specificReturn := fake.featureFlagsReturnsOnCall[len(fake.featureFlagsArgsForCall)]
+	fake.featureFlagsArgsForCall = append(fake.featureFlagsArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	stub := fake.FeatureFlagsStub
+	fakeReturns := fake.featureFlagsReturns
+	fake.recordInvocation("FeatureFlags", []interface{}{arg1})
+	fake.featureFlagsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) FeatureFlagsCallCount() int {
+	fake.featureFlagsMutex.RLock()
+	defer fake.featureFlagsMutex.RUnlock()
+	return len(fake.featureFlagsArgsForCall)
+}
+
+func (fake *FakeClient) FeatureFlagsCalls(stub func(lager.Logger) []string) {
+	fake.featureFlagsMutex.Lock()
+	defer fake.featureFlagsMutex.Unlock()
+	fake.FeatureFlagsStub = stub
+}
+
+func (fake *FakeClient) FeatureFlagsArgsForCall(i int) lager.Logger {
+	fake.featureFlagsMutex.RLock()
+	defer fake.featureFlagsMutex.RUnlock()
+	argsForCall := fake.featureFlagsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) FeatureFlagsReturns(result1 []string) {
+	fake.featureFlagsMutex.Lock()
+	defer fake.featureFlagsMutex.Unlock()
+	fake.FeatureFlagsStub = nil
+	fake.featureFlagsReturns = struct {
+		result1 []string
+	}{result1}
+}
+
+func (fake *FakeClient) FeatureFlagsReturnsOnCall(i int, result1 []string) {
+	fake.featureFlagsMutex.Lock()
+	defer fake.featureFlagsMutex.Unlock()
+	fake.FeatureFlagsStub = nil
+	if fake.featureFlagsReturnsOnCall == nil {
+		fake.featureFlagsReturnsOnCall = make(map[int]struct {
+			result1 []string
+		})
+	}
+	fake.featureFlagsReturnsOnCall[i] = struct {
+		result1 []string
+	}{result1}
+}
+
 func (fake *FakeClient) GetBulkMetrics(arg1 lager.Logger) (map[string]executor.Metrics, error) {
 	fake.getBulkMetricsMutex.Lock()
 	ret, specificReturn := fake.getBulkMetricsReturnsOnCall[len(fake.getBulkMetricsArgsForCall)]
@@ -701,6 +1145,71 @@ func (fake *FakeClient) ListContainersReturnsOnCall(i int, result1 []executor.Co
 	}{result1, result2}
 }
 
+func (fake *FakeClient) ListContainersPage(arg1 lager.Logger, arg2 executor.ListContainersRequest) (executor.ContainerPage, error) {
+	fake.listContainersPageMutex.Lock()
+	ret, specificReturn := fake.listContainersPageReturnsOnCall[len(fake.listContainersPageArgsForCall)]
+	fake.listContainersPageArgsForCall = append(fake.listContainersPageArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 executor.ListContainersRequest
+	}{arg1, arg2})
+	stub := fake.ListContainersPageStub
+	fakeReturns := fake.listContainersPageReturns
+	fake.recordInvocation("ListContainersPage", []interface{}{arg1, arg2})
+	fake.listContainersPageMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) ListContainersPageCallCount() int {
+	fake.listContainersPageMutex.RLock()
+	defer fake.listContainersPageMutex.RUnlock()
+	return len(fake.listContainersPageArgsForCall)
+}
+
+func (fake *FakeClient) ListContainersPageCalls(stub func(lager.Logger, executor.ListContainersRequest) (executor.ContainerPage, error)) {
+	fake.listContainersPageMutex.Lock()
+	defer fake.listContainersPageMutex.Unlock()
+	fake.ListContainersPageStub = stub
+}
+
+func (fake *FakeClient) ListContainersPageArgsForCall(i int) (lager.Logger, executor.ListContainersRequest) {
+	fake.listContainersPageMutex.RLock()
+	defer fake.listContainersPageMutex.RUnlock()
+	argsForCall := fake.listContainersPageArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) ListContainersPageReturns(result1 executor.ContainerPage, result2 error) {
+	fake.listContainersPageMutex.Lock()
+	defer fake.listContainersPageMutex.Unlock()
+	fake.ListContainersPageStub = nil
+	fake.listContainersPageReturns = struct {
+		result1 executor.ContainerPage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ListContainersPageReturnsOnCall(i int, result1 executor.ContainerPage, result2 error) {
+	fake.listContainersPageMutex.Lock()
+	defer fake.listContainersPageMutex.Unlock()
+	fake.ListContainersPageStub = nil
+	if fake.listContainersPageReturnsOnCall == nil {
+		fake.listContainersPageReturnsOnCall = make(map[int]struct {
+			result1 executor.ContainerPage
+			result2 error
+		})
+	}
+	fake.listContainersPageReturnsOnCall[i] = struct {
+		result1 executor.ContainerPage
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeClient) Ping(arg1 lager.Logger) error {
 	fake.pingMutex.Lock()
 	ret, specificReturn := fake.pingReturnsOnCall[len(fake.pingArgsForCall)]
@@ -762,47 +1271,236 @@ func (fake *FakeClient) PingReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeClient) RemainingResources(arg1 lager.Logger) (executor.ExecutorResources, error) {
-	fake.remainingResourcesMutex.Lock()
-	ret, specificReturn := fake.remainingResourcesReturnsOnCall[len(fake.remainingResourcesArgsForCall)]
-	fake.remainingResourcesArgsForCall = append(fake.remainingResourcesArgsForCall, struct {
+func (fake *FakeClient) PlacementTags(arg1 lager.Logger) []string {
+	fake.placementTagsMutex.Lock()
+	ret, specificReturn := fake.placementTagsReturnsOnCall[len(fake.placementTagsArgsForCall)]
+	fake.placementTagsArgsForCall = append(fake.placementTagsArgsForCall, struct {
 		arg1 lager.Logger
 	}{arg1})
-	stub := fake.RemainingResourcesStub
-	fakeReturns := fake.remainingResourcesReturns
-	fake.recordInvocation("RemainingResources", []interface{}{arg1})
-	fake.remainingResourcesMutex.Unlock()
+	stub := fake.PlacementTagsStub
+	fakeReturns := fake.placementTagsReturns
+	fake.recordInvocation("PlacementTags", []interface{}{arg1})
+	fake.placementTagsMutex.Unlock()
 	if stub != nil {
 		return stub(arg1)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2
+		return ret.result1
 	}
-	return fakeReturns.result1, fakeReturns.result2
+	return fakeReturns.result1
 }
 
-func (fake *FakeClient) RemainingResourcesCallCount() int {
-	fake.remainingResourcesMutex.RLock()
-	defer fake.remainingResourcesMutex.RUnlock()
-	return len(fake.remainingResourcesArgsForCall)
+func (fake *FakeClient) PlacementTagsCallCount() int {
+	fake.placementTagsMutex.RLock()
+	defer fake.placementTagsMutex.RUnlock()
+	return len(fake.placementTagsArgsForCall)
 }
 
-func (fake *FakeClient) RemainingResourcesCalls(stub func(lager.Logger) (executor.ExecutorResources, error)) {
-	fake.remainingResourcesMutex.Lock()
-	defer fake.remainingResourcesMutex.Unlock()
-	fake.RemainingResourcesStub = stub
+func (fake *FakeClient) PlacementTagsCalls(stub func(lager.Logger) []string) {
+	fake.placementTagsMutex.Lock()
+	defer fake.placementTagsMutex.Unlock()
+	fake.PlacementTagsStub = stub
 }
 
-func (fake *FakeClient) RemainingResourcesArgsForCall(i int) lager.Logger {
-	fake.remainingResourcesMutex.RLock()
-	defer fake.remainingResourcesMutex.RUnlock()
-	argsForCall := fake.remainingResourcesArgsForCall[i]
+func (fake *FakeClient) PlacementTagsArgsForCall(i int) lager.Logger {
+	fake.placementTagsMutex.RLock()
+	defer fake.placementTagsMutex.RUnlock()
+	argsForCall := fake.placementTagsArgsForCall[i]
 	return argsForCall.arg1
 }
 
-func (fake *FakeClient) RemainingResourcesReturns(result1 executor.ExecutorResources, result2 error) {
-	fake.remainingResourcesMutex.Lock()
-	defer fake.remainingResourcesMutex.Unlock()
+func (fake *FakeClient) PlacementTagsReturns(result1 []string) {
+	fake.placementTagsMutex.Lock()
+	defer fake.placementTagsMutex.Unlock()
+	fake.PlacementTagsStub = nil
+	fake.placementTagsReturns = struct {
+		result1 []string
+	}{result1}
+}
+
+func (fake *FakeClient) PlacementTagsReturnsOnCall(i int, result1 []string) {
+	fake.placementTagsMutex.Lock()
+	defer fake.placementTagsMutex.Unlock()
+	fake.PlacementTagsStub = nil
+	if fake.placementTagsReturnsOnCall == nil {
+		fake.placementTagsReturnsOnCall = make(map[int]struct {
+			result1 []string
+		})
+	}
+	fake.placementTagsReturnsOnCall[i] = struct {
+		result1 []string
+	}{result1}
+}
+
+func (fake *FakeClient) PrefetchArtifacts(arg1 lager.Logger, arg2 []executor.PrefetchArtifact) error {
+	var arg2Copy []executor.PrefetchArtifact
+	if arg2 != nil {
+		arg2Copy = make([]executor.PrefetchArtifact, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.prefetchArtifactsMutex.Lock()
+	ret, specificReturn := fake.prefetchArtifactsReturnsOnCall[len(fake.prefetchArtifactsArgsForCall)]
+	fake.prefetchArtifactsArgsForCall = append(fake.prefetchArtifactsArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 []executor.PrefetchArtifact
+	}{arg1, arg2Copy})
+	stub := fake.PrefetchArtifactsStub
+	fakeReturns := fake.prefetchArtifactsReturns
+	fake.recordInvocation("PrefetchArtifacts", []interface{}{arg1, arg2Copy})
+	fake.prefetchArtifactsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) PrefetchArtifactsCallCount() int {
+	fake.prefetchArtifactsMutex.RLock()
+	defer fake.prefetchArtifactsMutex.RUnlock()
+	return len(fake.prefetchArtifactsArgsForCall)
+}
+
+func (fake *FakeClient) PrefetchArtifactsCalls(stub func(lager.Logger, []executor.PrefetchArtifact) error) {
+	fake.prefetchArtifactsMutex.Lock()
+	defer fake.prefetchArtifactsMutex.Unlock()
+	fake.PrefetchArtifactsStub = stub
+}
+
+func (fake *FakeClient) PrefetchArtifactsArgsForCall(i int) (lager.Logger, []executor.PrefetchArtifact) {
+	fake.prefetchArtifactsMutex.RLock()
+	defer fake.prefetchArtifactsMutex.RUnlock()
+	argsForCall := fake.prefetchArtifactsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) PrefetchArtifactsReturns(result1 error) {
+	fake.prefetchArtifactsMutex.Lock()
+	defer fake.prefetchArtifactsMutex.Unlock()
+	fake.PrefetchArtifactsStub = nil
+	fake.prefetchArtifactsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) PrefetchArtifactsReturnsOnCall(i int, result1 error) {
+	fake.prefetchArtifactsMutex.Lock()
+	defer fake.prefetchArtifactsMutex.Unlock()
+	fake.PrefetchArtifactsStub = nil
+	if fake.prefetchArtifactsReturnsOnCall == nil {
+		fake.prefetchArtifactsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.prefetchArtifactsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) PrefetchProgress(arg1 lager.Logger) executor.PrefetchProgress {
+	fake.prefetchProgressMutex.Lock()
+	ret, specificReturn := fake.prefetchProgressReturnsOnCall[len(fake.prefetchProgressArgsForCall)]
+	fake.prefetchProgressArgsForCall = append(fake.prefetchProgressArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	stub := fake.PrefetchProgressStub
+	fakeReturns := fake.prefetchProgressReturns
+	fake.recordInvocation("PrefetchProgress", []interface{}{arg1})
+	fake.prefetchProgressMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) PrefetchProgressCallCount() int {
+	fake.prefetchProgressMutex.RLock()
+	defer fake.prefetchProgressMutex.RUnlock()
+	return len(fake.prefetchProgressArgsForCall)
+}
+
+func (fake *FakeClient) PrefetchProgressCalls(stub func(lager.Logger) executor.PrefetchProgress) {
+	fake.prefetchProgressMutex.Lock()
+	defer fake.prefetchProgressMutex.Unlock()
+	fake.PrefetchProgressStub = stub
+}
+
+func (fake *FakeClient) PrefetchProgressArgsForCall(i int) lager.Logger {
+	fake.prefetchProgressMutex.RLock()
+	defer fake.prefetchProgressMutex.RUnlock()
+	argsForCall := fake.prefetchProgressArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) PrefetchProgressReturns(result1 executor.PrefetchProgress) {
+	fake.prefetchProgressMutex.Lock()
+	defer fake.prefetchProgressMutex.Unlock()
+	fake.PrefetchProgressStub = nil
+	fake.prefetchProgressReturns = struct {
+		result1 executor.PrefetchProgress
+	}{result1}
+}
+
+func (fake *FakeClient) PrefetchProgressReturnsOnCall(i int, result1 executor.PrefetchProgress) {
+	fake.prefetchProgressMutex.Lock()
+	defer fake.prefetchProgressMutex.Unlock()
+	fake.PrefetchProgressStub = nil
+	if fake.prefetchProgressReturnsOnCall == nil {
+		fake.prefetchProgressReturnsOnCall = make(map[int]struct {
+			result1 executor.PrefetchProgress
+		})
+	}
+	fake.prefetchProgressReturnsOnCall[i] = struct {
+		result1 executor.PrefetchProgress
+	}{result1}
+}
+
+func (fake *FakeClient) RemainingResources(arg1 lager.Logger) (executor.ExecutorResources, error) {
+	fake.remainingResourcesMutex.Lock()
+	ret, specificReturn := fake.remainingResourcesReturnsOnCall[len(fake.remainingResourcesArgsForCall)]
+	fake.remainingResourcesArgsForCall = append(fake.remainingResourcesArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	stub := fake.RemainingResourcesStub
+	fakeReturns := fake.remainingResourcesReturns
+	fake.recordInvocation("RemainingResources", []interface{}{arg1})
+	fake.remainingResourcesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) RemainingResourcesCallCount() int {
+	fake.remainingResourcesMutex.RLock()
+	defer fake.remainingResourcesMutex.RUnlock()
+	return len(fake.remainingResourcesArgsForCall)
+}
+
+func (fake *FakeClient) RemainingResourcesCalls(stub func(lager.Logger) (executor.ExecutorResources, error)) {
+	fake.remainingResourcesMutex.Lock()
+	defer fake.remainingResourcesMutex.Unlock()
+	fake.RemainingResourcesStub = stub
+}
+
+func (fake *FakeClient) RemainingResourcesArgsForCall(i int) lager.Logger {
+	fake.remainingResourcesMutex.RLock()
+	defer fake.remainingResourcesMutex.RUnlock()
+	argsForCall := fake.remainingResourcesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) RemainingResourcesReturns(result1 executor.ExecutorResources, result2 error) {
+	fake.remainingResourcesMutex.Lock()
+	defer fake.remainingResourcesMutex.Unlock()
 	fake.RemainingResourcesStub = nil
 	fake.remainingResourcesReturns = struct {
 		result1 executor.ExecutorResources
@@ -889,6 +1587,265 @@ func (fake *FakeClient) RunContainerReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeClient) RunContainers(arg1 lager.Logger, arg2 string, arg3 []executor.RunRequest) []executor.ContainerResult {
+	var arg3Copy []executor.RunRequest
+	if arg3 != nil {
+		arg3Copy = make([]executor.RunRequest, len(arg3))
+		copy(arg3Copy, arg3)
+	}
+	fake.runContainersMutex.Lock()
+	ret, specificReturn := fake.runContainersReturnsOnCall[len(fake.runContainersArgsForCall)]
+	fake.runContainersArgsForCall = append(fake.runContainersArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 []executor.RunRequest
+	}{arg1, arg2, arg3Copy})
+	stub := fake.RunContainersStub
+	fakeReturns := fake.runContainersReturns
+	fake.recordInvocation("RunContainers", []interface{}{arg1, arg2, arg3Copy})
+	fake.runContainersMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) RunContainersCallCount() int {
+	fake.runContainersMutex.RLock()
+	defer fake.runContainersMutex.RUnlock()
+	return len(fake.runContainersArgsForCall)
+}
+
+func (fake *FakeClient) RunContainersCalls(stub func(lager.Logger, string, []executor.RunRequest) []executor.ContainerResult) {
+	fake.runContainersMutex.Lock()
+	defer fake.runContainersMutex.Unlock()
+	fake.RunContainersStub = stub
+}
+
+func (fake *FakeClient) RunContainersArgsForCall(i int) (lager.Logger, string, []executor.RunRequest) {
+	fake.runContainersMutex.RLock()
+	defer fake.runContainersMutex.RUnlock()
+	argsForCall := fake.runContainersArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) RunContainersReturns(result1 []executor.ContainerResult) {
+	fake.runContainersMutex.Lock()
+	defer fake.runContainersMutex.Unlock()
+	fake.RunContainersStub = nil
+	fake.runContainersReturns = struct {
+		result1 []executor.ContainerResult
+	}{result1}
+}
+
+func (fake *FakeClient) RunContainersReturnsOnCall(i int, result1 []executor.ContainerResult) {
+	fake.runContainersMutex.Lock()
+	defer fake.runContainersMutex.Unlock()
+	fake.RunContainersStub = nil
+	if fake.runContainersReturnsOnCall == nil {
+		fake.runContainersReturnsOnCall = make(map[int]struct {
+			result1 []executor.ContainerResult
+		})
+	}
+	fake.runContainersReturnsOnCall[i] = struct {
+		result1 []executor.ContainerResult
+	}{result1}
+}
+
+func (fake *FakeClient) RunProcess(arg1 lager.Logger, arg2 string, arg3 executor.ProcessSpec, arg4 executor.ProcessIO) (executor.Process, error) {
+	fake.runProcessMutex.Lock()
+	ret, specificReturn := fake.runProcessReturnsOnCall[len(fake.runProcessArgsForCall)]
+	fake.runProcessArgsForCall = append(fake.runProcessArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ProcessSpec
+		arg4 executor.ProcessIO
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.RunProcessStub
+	fakeReturns := fake.runProcessReturns
+	fake.recordInvocation("RunProcess", []interface{}{arg1, arg2, arg3, arg4})
+	fake.runProcessMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) RunProcessCallCount() int {
+	fake.runProcessMutex.RLock()
+	defer fake.runProcessMutex.RUnlock()
+	return len(fake.runProcessArgsForCall)
+}
+
+func (fake *FakeClient) RunProcessCalls(stub func(lager.Logger, string, executor.ProcessSpec, executor.ProcessIO) (executor.Process, error)) {
+	fake.runProcessMutex.Lock()
+	defer fake.runProcessMutex.Unlock()
+	fake.RunProcessStub = stub
+}
+
+func (fake *FakeClient) RunProcessArgsForCall(i int) (lager.Logger, string, executor.ProcessSpec, executor.ProcessIO) {
+	fake.runProcessMutex.RLock()
+	defer fake.runProcessMutex.RUnlock()
+	argsForCall := fake.runProcessArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeClient) RunProcessReturns(result1 executor.Process, result2 error) {
+	fake.runProcessMutex.Lock()
+	defer fake.runProcessMutex.Unlock()
+	fake.RunProcessStub = nil
+	fake.runProcessReturns = struct {
+		result1 executor.Process
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) RunProcessReturnsOnCall(i int, result1 executor.Process, result2 error) {
+	fake.runProcessMutex.Lock()
+	defer fake.runProcessMutex.Unlock()
+	fake.RunProcessStub = nil
+	if fake.runProcessReturnsOnCall == nil {
+		fake.runProcessReturnsOnCall = make(map[int]struct {
+			result1 executor.Process
+			result2 error
+		})
+	}
+	fake.runProcessReturnsOnCall[i] = struct {
+		result1 executor.Process
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ScheduledTaskResults(arg1 lager.Logger) []executor.ScheduledTaskResult {
+	fake.scheduledTaskResultsMutex.Lock()
+	ret, specificReturn := fake.scheduledTaskResultsReturnsOnCall[len(fake.scheduledTaskResultsArgsForCall)]
+	fake.scheduledTaskResultsArgsForCall = append(fake.scheduledTaskResultsArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	stub := fake.ScheduledTaskResultsStub
+	fakeReturns := fake.scheduledTaskResultsReturns
+	fake.recordInvocation("ScheduledTaskResults", []interface{}{arg1})
+	fake.scheduledTaskResultsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) ScheduledTaskResultsCallCount() int {
+	fake.scheduledTaskResultsMutex.RLock()
+	defer fake.scheduledTaskResultsMutex.RUnlock()
+	return len(fake.scheduledTaskResultsArgsForCall)
+}
+
+func (fake *FakeClient) ScheduledTaskResultsCalls(stub func(lager.Logger) []executor.ScheduledTaskResult) {
+	fake.scheduledTaskResultsMutex.Lock()
+	defer fake.scheduledTaskResultsMutex.Unlock()
+	fake.ScheduledTaskResultsStub = stub
+}
+
+func (fake *FakeClient) ScheduledTaskResultsArgsForCall(i int) lager.Logger {
+	fake.scheduledTaskResultsMutex.RLock()
+	defer fake.scheduledTaskResultsMutex.RUnlock()
+	argsForCall := fake.scheduledTaskResultsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeClient) ScheduledTaskResultsReturns(result1 []executor.ScheduledTaskResult) {
+	fake.scheduledTaskResultsMutex.Lock()
+	defer fake.scheduledTaskResultsMutex.Unlock()
+	fake.ScheduledTaskResultsStub = nil
+	fake.scheduledTaskResultsReturns = struct {
+		result1 []executor.ScheduledTaskResult
+	}{result1}
+}
+
+func (fake *FakeClient) ScheduledTaskResultsReturnsOnCall(i int, result1 []executor.ScheduledTaskResult) {
+	fake.scheduledTaskResultsMutex.Lock()
+	defer fake.scheduledTaskResultsMutex.Unlock()
+	fake.ScheduledTaskResultsStub = nil
+	if fake.scheduledTaskResultsReturnsOnCall == nil {
+		fake.scheduledTaskResultsReturnsOnCall = make(map[int]struct {
+			result1 []executor.ScheduledTaskResult
+		})
+	}
+	fake.scheduledTaskResultsReturnsOnCall[i] = struct {
+		result1 []executor.ScheduledTaskResult
+	}{result1}
+}
+
+func (fake *FakeClient) SetFeatureFlag(arg1 lager.Logger, arg2 string, arg3 bool) error {
+	fake.setFeatureFlagMutex.Lock()
+	ret, specificReturn := fake.setFeatureFlagReturnsOnCall[len(fake.setFeatureFlagArgsForCall)]
+	fake.setFeatureFlagArgsForCall = append(fake.setFeatureFlagArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 bool
+	}{arg1, arg2, arg3})
+	stub := fake.SetFeatureFlagStub
+	fakeReturns := fake.setFeatureFlagReturns
+	fake.recordInvocation("SetFeatureFlag", []interface{}{arg1, arg2, arg3})
+	fake.setFeatureFlagMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) SetFeatureFlagCallCount() int {
+	fake.setFeatureFlagMutex.RLock()
+	defer fake.setFeatureFlagMutex.RUnlock()
+	return len(fake.setFeatureFlagArgsForCall)
+}
+
+func (fake *FakeClient) SetFeatureFlagCalls(stub func(lager.Logger, string, bool) error) {
+	fake.setFeatureFlagMutex.Lock()
+	defer fake.setFeatureFlagMutex.Unlock()
+	fake.SetFeatureFlagStub = stub
+}
+
+func (fake *FakeClient) SetFeatureFlagArgsForCall(i int) (lager.Logger, string, bool) {
+	fake.setFeatureFlagMutex.RLock()
+	defer fake.setFeatureFlagMutex.RUnlock()
+	argsForCall := fake.setFeatureFlagArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) SetFeatureFlagReturns(result1 error) {
+	fake.setFeatureFlagMutex.Lock()
+	defer fake.setFeatureFlagMutex.Unlock()
+	fake.SetFeatureFlagStub = nil
+	fake.setFeatureFlagReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) SetFeatureFlagReturnsOnCall(i int, result1 error) {
+	fake.setFeatureFlagMutex.Lock()
+	defer fake.setFeatureFlagMutex.Unlock()
+	fake.SetFeatureFlagStub = nil
+	if fake.setFeatureFlagReturnsOnCall == nil {
+		fake.setFeatureFlagReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setFeatureFlagReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeClient) SetHealthy(arg1 lager.Logger, arg2 bool) {
 	fake.setHealthyMutex.Lock()
 	fake.setHealthyArgsForCall = append(fake.setHealthyArgsForCall, struct {
@@ -922,6 +1879,106 @@ func (fake *FakeClient) SetHealthyArgsForCall(i int) (lager.Logger, bool) {
 	return argsForCall.arg1, argsForCall.arg2
 }
 
+func (fake *FakeClient) SetPlacementTags(arg1 lager.Logger, arg2 []string) {
+	var arg2Copy []string
+	if arg2 != nil {
+		arg2Copy = make([]string, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.setPlacementTagsMutex.Lock()
+	fake.setPlacementTagsArgsForCall = append(fake.setPlacementTagsArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 []string
+	}{arg1, arg2Copy})
+	stub := fake.SetPlacementTagsStub
+	fake.recordInvocation("SetPlacementTags", []interface{}{arg1, arg2Copy})
+	fake.setPlacementTagsMutex.Unlock()
+	if stub != nil {
+		fake.SetPlacementTagsStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeClient) SetPlacementTagsCallCount() int {
+	fake.setPlacementTagsMutex.RLock()
+	defer fake.setPlacementTagsMutex.RUnlock()
+	return len(fake.setPlacementTagsArgsForCall)
+}
+
+func (fake *FakeClient) SetPlacementTagsCalls(stub func(lager.Logger, []string)) {
+	fake.setPlacementTagsMutex.Lock()
+	defer fake.setPlacementTagsMutex.Unlock()
+	fake.SetPlacementTagsStub = stub
+}
+
+func (fake *FakeClient) SetPlacementTagsArgsForCall(i int) (lager.Logger, []string) {
+	fake.setPlacementTagsMutex.RLock()
+	defer fake.setPlacementTagsMutex.RUnlock()
+	argsForCall := fake.setPlacementTagsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) SetTotalResources(arg1 lager.Logger, arg2 executor.ExecutorResources) error {
+	fake.setTotalResourcesMutex.Lock()
+	ret, specificReturn := fake.setTotalResourcesReturnsOnCall[len(fake.setTotalResourcesArgsForCall)]
+	fake.setTotalResourcesArgsForCall = append(fake.setTotalResourcesArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 executor.ExecutorResources
+	}{arg1, arg2})
+	stub := fake.SetTotalResourcesStub
+	fakeReturns := fake.setTotalResourcesReturns
+	fake.recordInvocation("SetTotalResources", []interface{}{arg1, arg2})
+	fake.setTotalResourcesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) SetTotalResourcesCallCount() int {
+	fake.setTotalResourcesMutex.RLock()
+	defer fake.setTotalResourcesMutex.RUnlock()
+	return len(fake.setTotalResourcesArgsForCall)
+}
+
+func (fake *FakeClient) SetTotalResourcesCalls(stub func(lager.Logger, executor.ExecutorResources) error) {
+	fake.setTotalResourcesMutex.Lock()
+	defer fake.setTotalResourcesMutex.Unlock()
+	fake.SetTotalResourcesStub = stub
+}
+
+func (fake *FakeClient) SetTotalResourcesArgsForCall(i int) (lager.Logger, executor.ExecutorResources) {
+	fake.setTotalResourcesMutex.RLock()
+	defer fake.setTotalResourcesMutex.RUnlock()
+	argsForCall := fake.setTotalResourcesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) SetTotalResourcesReturns(result1 error) {
+	fake.setTotalResourcesMutex.Lock()
+	defer fake.setTotalResourcesMutex.Unlock()
+	fake.SetTotalResourcesStub = nil
+	fake.setTotalResourcesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) SetTotalResourcesReturnsOnCall(i int, result1 error) {
+	fake.setTotalResourcesMutex.Lock()
+	defer fake.setTotalResourcesMutex.Unlock()
+	fake.SetTotalResourcesStub = nil
+	if fake.setTotalResourcesReturnsOnCall == nil {
+		fake.setTotalResourcesReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setTotalResourcesReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeClient) StopContainer(arg1 lager.Logger, arg2 string, arg3 string) error {
 	fake.stopContainerMutex.Lock()
 	ret, specificReturn := fake.stopContainerReturnsOnCall[len(fake.stopContainerArgsForCall)]
@@ -985,18 +2042,146 @@ func (fake *FakeClient) StopContainerReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
-func (fake *FakeClient) SubscribeToEvents(arg1 lager.Logger) (executor.EventSource, error) {
+func (fake *FakeClient) StopContainers(arg1 lager.Logger, arg2 string, arg3 executor.ContainerSelector) []executor.ContainerResult {
+	fake.stopContainersMutex.Lock()
+	ret, specificReturn := fake.stopContainersReturnsOnCall[len(fake.stopContainersArgsForCall)]
+	fake.stopContainersArgsForCall = append(fake.stopContainersArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 executor.ContainerSelector
+	}{arg1, arg2, arg3})
+	stub := fake.StopContainersStub
+	fakeReturns := fake.stopContainersReturns
+	fake.recordInvocation("StopContainers", []interface{}{arg1, arg2, arg3})
+	fake.stopContainersMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) StopContainersCallCount() int {
+	fake.stopContainersMutex.RLock()
+	defer fake.stopContainersMutex.RUnlock()
+	return len(fake.stopContainersArgsForCall)
+}
+
+func (fake *FakeClient) StopContainersCalls(stub func(lager.Logger, string, executor.ContainerSelector) []executor.ContainerResult) {
+	fake.stopContainersMutex.Lock()
+	defer fake.stopContainersMutex.Unlock()
+	fake.StopContainersStub = stub
+}
+
+func (fake *FakeClient) StopContainersArgsForCall(i int) (lager.Logger, string, executor.ContainerSelector) {
+	fake.stopContainersMutex.RLock()
+	defer fake.stopContainersMutex.RUnlock()
+	argsForCall := fake.stopContainersArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) StopContainersReturns(result1 []executor.ContainerResult) {
+	fake.stopContainersMutex.Lock()
+	defer fake.stopContainersMutex.Unlock()
+	fake.StopContainersStub = nil
+	fake.stopContainersReturns = struct {
+		result1 []executor.ContainerResult
+	}{result1}
+}
+
+func (fake *FakeClient) StopContainersReturnsOnCall(i int, result1 []executor.ContainerResult) {
+	fake.stopContainersMutex.Lock()
+	defer fake.stopContainersMutex.Unlock()
+	fake.StopContainersStub = nil
+	if fake.stopContainersReturnsOnCall == nil {
+		fake.stopContainersReturnsOnCall = make(map[int]struct {
+			result1 []executor.ContainerResult
+		})
+	}
+	fake.stopContainersReturnsOnCall[i] = struct {
+		result1 []executor.ContainerResult
+	}{result1}
+}
+
+func (fake *FakeClient) StreamIn(arg1 lager.Logger, arg2 string, arg3 string, arg4 io.Reader) error {
+	fake.streamInMutex.Lock()
+	ret, specificReturn := fake.streamInReturnsOnCall[len(fake.streamInArgsForCall)]
+	fake.streamInArgsForCall = append(fake.streamInArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+		arg3 string
+		arg4 io.Reader
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.StreamInStub
+	fakeReturns := fake.streamInReturns
+	fake.recordInvocation("StreamIn", []interface{}{arg1, arg2, arg3, arg4})
+	fake.streamInMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) StreamInCallCount() int {
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
+	return len(fake.streamInArgsForCall)
+}
+
+func (fake *FakeClient) StreamInCalls(stub func(lager.Logger, string, string, io.Reader) error) {
+	fake.streamInMutex.Lock()
+	defer fake.streamInMutex.Unlock()
+	fake.StreamInStub = stub
+}
+
+func (fake *FakeClient) StreamInArgsForCall(i int) (lager.Logger, string, string, io.Reader) {
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
+	argsForCall := fake.streamInArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeClient) StreamInReturns(result1 error) {
+	fake.streamInMutex.Lock()
+	defer fake.streamInMutex.Unlock()
+	fake.StreamInStub = nil
+	fake.streamInReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) StreamInReturnsOnCall(i int, result1 error) {
+	fake.streamInMutex.Lock()
+	defer fake.streamInMutex.Unlock()
+	fake.StreamInStub = nil
+	if fake.streamInReturnsOnCall == nil {
+		fake.streamInReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.streamInReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) SubscribeToEvents(arg1 lager.Logger, arg2 ...executor.SubscribeOption) (executor.EventSource, error) {
 	fake.subscribeToEventsMutex.Lock()
 	ret, specificReturn := fake.subscribeToEventsReturnsOnCall[len(fake.subscribeToEventsArgsForCall)]
 	fake.subscribeToEventsArgsForCall = append(fake.subscribeToEventsArgsForCall, struct {
 		arg1 lager.Logger
-	}{arg1})
+		arg2 []executor.SubscribeOption
+	}{arg1, arg2})
 	stub := fake.SubscribeToEventsStub
 	fakeReturns := fake.subscribeToEventsReturns
-	fake.recordInvocation("SubscribeToEvents", []interface{}{arg1})
+	fake.recordInvocation("SubscribeToEvents", []interface{}{arg1, arg2})
 	fake.subscribeToEventsMutex.Unlock()
 	if stub != nil {
-		return stub(arg1)
+		return stub(arg1, arg2...)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -1010,17 +2195,17 @@ func (fake *FakeClient) SubscribeToEventsCallCount() int {
 	return len(fake.subscribeToEventsArgsForCall)
 }
 
-func (fake *FakeClient) SubscribeToEventsCalls(stub func(lager.Logger) (executor.EventSource, error)) {
+func (fake *FakeClient) SubscribeToEventsCalls(stub func(lager.Logger, ...executor.SubscribeOption) (executor.EventSource, error)) {
 	fake.subscribeToEventsMutex.Lock()
 	defer fake.subscribeToEventsMutex.Unlock()
 	fake.SubscribeToEventsStub = stub
 }
 
-func (fake *FakeClient) SubscribeToEventsArgsForCall(i int) lager.Logger {
+func (fake *FakeClient) SubscribeToEventsArgsForCall(i int) (lager.Logger, []executor.SubscribeOption) {
 	fake.subscribeToEventsMutex.RLock()
 	defer fake.subscribeToEventsMutex.RUnlock()
 	argsForCall := fake.subscribeToEventsArgsForCall[i]
-	return argsForCall.arg1
+	return argsForCall.arg1, argsForCall.arg2
 }
 
 func (fake *FakeClient) SubscribeToEventsReturns(result1 executor.EventSource, result2 error) {
@@ -1244,10 +2429,18 @@ func (fake *FakeClient) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.allocateContainersMutex.RLock()
 	defer fake.allocateContainersMutex.RUnlock()
+	fake.capabilitiesMutex.RLock()
+	defer fake.capabilitiesMutex.RUnlock()
 	fake.cleanupMutex.RLock()
 	defer fake.cleanupMutex.RUnlock()
 	fake.deleteContainerMutex.RLock()
 	defer fake.deleteContainerMutex.RUnlock()
+	fake.deleteContainersMutex.RLock()
+	defer fake.deleteContainersMutex.RUnlock()
+	fake.drainMutex.RLock()
+	defer fake.drainMutex.RUnlock()
+	fake.featureFlagsMutex.RLock()
+	defer fake.featureFlagsMutex.RUnlock()
 	fake.getBulkMetricsMutex.RLock()
 	defer fake.getBulkMetricsMutex.RUnlock()
 	fake.getContainerMutex.RLock()
@@ -1258,16 +2451,40 @@ func (fake *FakeClient) Invocations() map[string][][]interface{} {
 	defer fake.healthyMutex.RUnlock()
 	fake.listContainersMutex.RLock()
 	defer fake.listContainersMutex.RUnlock()
+	fake.listContainersPageMutex.RLock()
+	defer fake.listContainersPageMutex.RUnlock()
 	fake.pingMutex.RLock()
 	defer fake.pingMutex.RUnlock()
+	fake.placementTagsMutex.RLock()
+	defer fake.placementTagsMutex.RUnlock()
+	fake.prefetchArtifactsMutex.RLock()
+	defer fake.prefetchArtifactsMutex.RUnlock()
+	fake.prefetchProgressMutex.RLock()
+	defer fake.prefetchProgressMutex.RUnlock()
 	fake.remainingResourcesMutex.RLock()
 	defer fake.remainingResourcesMutex.RUnlock()
 	fake.runContainerMutex.RLock()
 	defer fake.runContainerMutex.RUnlock()
+	fake.runContainersMutex.RLock()
+	defer fake.runContainersMutex.RUnlock()
+	fake.runProcessMutex.RLock()
+	defer fake.runProcessMutex.RUnlock()
+	fake.scheduledTaskResultsMutex.RLock()
+	defer fake.scheduledTaskResultsMutex.RUnlock()
+	fake.setFeatureFlagMutex.RLock()
+	defer fake.setFeatureFlagMutex.RUnlock()
 	fake.setHealthyMutex.RLock()
 	defer fake.setHealthyMutex.RUnlock()
+	fake.setPlacementTagsMutex.RLock()
+	defer fake.setPlacementTagsMutex.RUnlock()
+	fake.setTotalResourcesMutex.RLock()
+	defer fake.setTotalResourcesMutex.RUnlock()
 	fake.stopContainerMutex.RLock()
 	defer fake.stopContainerMutex.RUnlock()
+	fake.stopContainersMutex.RLock()
+	defer fake.stopContainersMutex.RUnlock()
+	fake.streamInMutex.RLock()
+	defer fake.streamInMutex.RUnlock()
 	fake.subscribeToEventsMutex.RLock()
 	defer fake.subscribeToEventsMutex.RUnlock()
 	fake.totalResourcesMutex.RLock()
@@ -0,0 +1,91 @@
+package featureflags
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	AsyncDeletes = "async_deletes"
+)
+
+// Known lists every flag that can be toggled on a cell. Flags that are not in
+// this list are rejected so that typos in the configuration are caught early.
+var Known = []string{
+	AsyncDeletes,
+}
+
+type ErrUnknownFlag string
+
+func (e ErrUnknownFlag) Error() string {
+	return fmt.Sprintf("unknown feature flag: %s", string(e))
+}
+
+// Flags is the set of feature flags enabled on this cell. It is safe for
+// concurrent use so that flags can be toggled at runtime.
+type Flags struct {
+	lock    sync.RWMutex
+	enabled map[string]bool
+}
+
+func New(enabled ...string) (*Flags, error) {
+	flags := &Flags{enabled: map[string]bool{}}
+	for _, name := range enabled {
+		err := flags.Set(name, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return flags, nil
+}
+
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.enabled[name]
+}
+
+func (f *Flags) Set(name string, enabled bool) error {
+	if !isKnown(name) {
+		return ErrUnknownFlag(name)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if enabled {
+		f.enabled[name] = true
+	} else {
+		delete(f.enabled, name)
+	}
+	return nil
+}
+
+// Active returns the sorted names of all enabled flags.
+func (f *Flags) Active() []string {
+	active := []string{}
+	if f == nil {
+		return active
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for name := range f.enabled {
+		active = append(active, name)
+	}
+	sort.Strings(active)
+	return active
+}
+
+func isKnown(name string) bool {
+	for _, known := range Known {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package featureflags_test
+
+import (
+	"code.cloudfoundry.org/executor/featureflags"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flags", func() {
+	var flags *featureflags.Flags
+
+	BeforeEach(func() {
+		var err error
+		flags, err = featureflags.New(featureflags.AsyncDeletes)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("enables the configured flags", func() {
+		Expect(flags.Enabled(featureflags.AsyncDeletes)).To(BeTrue())
+		Expect(flags.Enabled("bogus")).To(BeFalse())
+	})
+
+	It("returns the active flags", func() {
+		Expect(flags.Active()).To(Equal([]string{featureflags.AsyncDeletes}))
+	})
+
+	It("disables flags at runtime", func() {
+		Expect(flags.Set(featureflags.AsyncDeletes, false)).To(Succeed())
+		Expect(flags.Enabled(featureflags.AsyncDeletes)).To(BeFalse())
+		Expect(flags.Active()).To(BeEmpty())
+	})
+
+	It("rejects unknown flags", func() {
+		Expect(flags.Set("bogus", true)).To(MatchError(featureflags.ErrUnknownFlag("bogus")))
+
+		_, err := featureflags.New("bogus")
+		Expect(err).To(MatchError("unknown feature flag: bogus"))
+	})
+
+	Context("when the flags are nil", func() {
+		BeforeEach(func() {
+			flags = nil
+		})
+
+		It("treats every flag as disabled", func() {
+			Expect(flags.Enabled(featureflags.AsyncDeletes)).To(BeFalse())
+			Expect(flags.Active()).To(BeEmpty())
+		})
+	})
+})
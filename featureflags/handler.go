@@ -0,0 +1,54 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Active is the JSON representation of the enabled flags of a cell.
+type Active struct {
+	Enabled []string `json:"enabled"`
+}
+
+type flagRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Handler reads and toggles the flags, relative to the path it is mounted
+// on:
+//
+//	GET /
+//	PUT /:flag   {"enabled": true}
+func Handler(logger lager.Logger, flags *Flags) http.Handler {
+	logger = logger.Session("feature-flags-handler")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodGet && name == "":
+		case r.Method == http.MethodPut && name != "":
+			var req flagRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			err = flags.Set(name, req.Enabled)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			logger.Info("set-feature-flag", lager.Data{"name": name, "enabled": req.Enabled})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Active{Enabled: flags.Active()})
+	})
+}
@@ -0,0 +1,65 @@
+package featureflags_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/executor/featureflags"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		flags   *featureflags.Flags
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		var err error
+		flags, err = featureflags.New()
+		Expect(err).NotTo(HaveOccurred())
+		handler = featureflags.Handler(lagertest.NewTestLogger("test"), flags)
+	})
+
+	serve := func(method, path, body string) (int, featureflags.Active) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		var active featureflags.Active
+		if response.Code == http.StatusOK {
+			Expect(json.Unmarshal(response.Body.Bytes(), &active)).To(Succeed())
+		}
+		return response.Code, active
+	}
+
+	It("lists the enabled flags", func() {
+		code, active := serve(http.MethodGet, "/", "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(active.Enabled).To(BeEmpty())
+	})
+
+	It("toggles a flag", func() {
+		code, active := serve(http.MethodPut, "/"+featureflags.AsyncDeletes, `{"enabled": true}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(active.Enabled).To(Equal([]string{featureflags.AsyncDeletes}))
+		Expect(flags.Enabled(featureflags.AsyncDeletes)).To(BeTrue())
+
+		code, active = serve(http.MethodPut, "/"+featureflags.AsyncDeletes, `{"enabled": false}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(active.Enabled).To(BeEmpty())
+	})
+
+	It("rejects unknown flags", func() {
+		code, _ := serve(http.MethodPut, "/bogus", `{"enabled": true}`)
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects malformed requests", func() {
+		code, _ := serve(http.MethodPut, "/"+featureflags.AsyncDeletes, `enabled`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1 @@
+package featureflags // import "code.cloudfoundry.org/executor/featureflags"
@@ -0,0 +1,13 @@
+package filecopy_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFileCopy(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FileCopy Suite")
+}
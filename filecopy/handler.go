@@ -0,0 +1,116 @@
+package filecopy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Handler copies tarballs out of and into containers, e.g. to salvage logs:
+//
+//	GET /files/:guid?path=/path/in/container
+//	PUT /files/:guid?path=/path/in/container
+//
+// Only paths under one of the allowed paths can be copied, and tarballs are
+// limited to maxBytes. Tarballs that are copied out are cut off when they
+// exceed the limit, so the client gets a truncated tarball instead of a
+// complete one.
+func Handler(logger lager.Logger, client executor.Client, allowedPaths []string, maxBytes int64) http.Handler {
+	logger = logger.Session("file-copy-handler")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] != "files" || parts[1] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		guid := parts[1]
+
+		containerPath := r.URL.Query().Get("path")
+		if !allowed(containerPath, allowedPaths) {
+			logger.Info("path-not-allowed", lager.Data{"guid": guid, "path": containerPath})
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		containerPath = path.Clean(containerPath)
+
+		switch r.Method {
+		case http.MethodGet:
+			streamOut(logger, client, w, guid, containerPath, maxBytes)
+		case http.MethodPut:
+			streamIn(logger, client, w, r, guid, containerPath, maxBytes)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func streamOut(logger lager.Logger, client executor.Client, w http.ResponseWriter, guid, containerPath string, maxBytes int64) {
+	logger = logger.Session("stream-out", lager.Data{"guid": guid, "path": containerPath})
+
+	stream, err := client.GetFiles(logger, guid, containerPath)
+	if err != nil {
+		w.WriteHeader(statusCode(err))
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	copied, err := io.Copy(w, io.LimitReader(stream, maxBytes+1))
+	if err != nil {
+		logger.Error("failed-to-stream-out", err)
+		return
+	}
+	if copied > maxBytes {
+		logger.Info("tarball-too-large", lager.Data{"max-bytes": maxBytes})
+		// abort the response, so that the client does not mistake the
+		// truncated tarball for a complete one
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func streamIn(logger lager.Logger, client executor.Client, w http.ResponseWriter, r *http.Request, guid, containerPath string, maxBytes int64) {
+	logger = logger.Session("stream-in", lager.Data{"guid": guid, "path": containerPath})
+
+	err := client.StreamIn(logger, guid, containerPath, http.MaxBytesReader(w, r.Body, maxBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		logger.Info("tarball-too-large", lager.Data{"max-bytes": maxBytes})
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(statusCode(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowed reports whether the path is one of the allowed paths or under one
+// of them.
+func allowed(containerPath string, allowedPaths []string) bool {
+	if !path.IsAbs(containerPath) {
+		return false
+	}
+
+	containerPath = path.Clean(containerPath)
+	for _, allowedPath := range allowedPaths {
+		allowedPath = path.Clean(allowedPath)
+		if containerPath == allowedPath || strings.HasPrefix(containerPath, strings.TrimSuffix(allowedPath, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func statusCode(err error) int {
+	if err == executor.ErrContainerNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,104 @@
+package filecopy_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/executor/filecopy"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		client   *fakes.FakeClient
+		handler  http.Handler
+		response *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		client = &fakes.FakeClient{}
+		client.GetFilesStub = func(lager.Logger, string, string) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("some-tarball")), nil
+		}
+		client.StreamInStub = func(_ lager.Logger, _ string, _ string, tarStream io.Reader) error {
+			_, err := io.ReadAll(tarStream)
+			return err
+		}
+		handler = filecopy.Handler(lagertest.NewTestLogger("test"), client, []string{"/home/vcap/logs", "/tmp/"}, 16)
+		response = httptest.NewRecorder()
+	})
+
+	Describe("copying files out of a container", func() {
+		It("responds with the tarball of the path", func() {
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/files/some-guid?path=/home/vcap/logs/app.log", nil))
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(Equal("some-tarball"))
+
+			_, guid, path := client.GetFilesArgsForCall(0)
+			Expect(guid).To(Equal("some-guid"))
+			Expect(path).To(Equal("/home/vcap/logs/app.log"))
+		})
+
+		It("forbids paths that are not allowed", func() {
+			for _, path := range []string{"/etc/passwd", "/home/vcap/logs/../app", "/tmpfoo", "tmp/foo", ""} {
+				response = httptest.NewRecorder()
+				handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/files/some-guid?path="+path, nil))
+				Expect(response.Code).To(Equal(http.StatusForbidden), path)
+			}
+			Expect(client.GetFilesCallCount()).To(Equal(0))
+		})
+
+		It("aborts tarballs that exceed the limit", func() {
+			client.GetFilesStub = func(lager.Logger, string, string) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("a-very-large-tarball")), nil
+			}
+			Expect(func() {
+				handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/files/some-guid?path=/tmp", nil))
+			}).To(PanicWith(http.ErrAbortHandler))
+		})
+
+		It("responds with 404 when the container does not exist", func() {
+			client.GetFilesStub = nil
+			client.GetFilesReturns(nil, executor.ErrContainerNotFound)
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/files/some-guid?path=/tmp", nil))
+			Expect(response.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("copying files into a container", func() {
+		It("streams the tarball into the path", func() {
+			var streamed string
+			client.StreamInStub = func(_ lager.Logger, _ string, _ string, tarStream io.Reader) error {
+				tarball, err := io.ReadAll(tarStream)
+				streamed = string(tarball)
+				return err
+			}
+
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodPut, "/files/some-guid?path=/tmp/debug", strings.NewReader("some-tarball")))
+			Expect(response.Code).To(Equal(http.StatusNoContent))
+			Expect(streamed).To(Equal("some-tarball"))
+
+			_, guid, path, _ := client.StreamInArgsForCall(0)
+			Expect(guid).To(Equal("some-guid"))
+			Expect(path).To(Equal("/tmp/debug"))
+		})
+
+		It("rejects tarballs that exceed the limit", func() {
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodPut, "/files/some-guid?path=/tmp", strings.NewReader("a-very-large-tarball")))
+			Expect(response.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+
+		It("forbids paths that are not allowed", func() {
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodPut, "/files/some-guid?path=/var/vcap", strings.NewReader("some-tarball")))
+			Expect(response.Code).To(Equal(http.StatusForbidden))
+			Expect(client.StreamInCallCount()).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1 @@
+package filecopy // import "code.cloudfoundry.org/executor/filecopy"
@@ -7,6 +7,7 @@ import (
 	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/clockskew"
 	"code.cloudfoundry.org/lager/v3"
 )
 
@@ -34,13 +35,15 @@ type Runner struct {
 	executorClient   executor.Client
 	metronClient     loggingclient.IngressClient
 	clock            clock.Clock
+	clockJumps       *clockskew.Detector
 }
 
 // NewRunner constructs a healthcheck runner.
 //
 // The checkInterval parameter controls how often the healthcheck should run, and
 // the timeoutInterval sets the time to wait for the healthcheck to complete before
-// marking the executor as unhealthy.
+// marking the executor as unhealthy. When clockJumps is not nil, the timers are
+// re-armed whenever it detects a jump of the wall clock.
 func NewRunner(
 	checkInterval time.Duration,
 	emissionInterval time.Duration,
@@ -50,6 +53,7 @@ func NewRunner(
 	executorClient executor.Client,
 	metronClient loggingclient.IngressClient,
 	clock clock.Clock,
+	clockJumps *clockskew.Detector,
 ) *Runner {
 	return &Runner{
 		checkInterval:    checkInterval,
@@ -60,6 +64,7 @@ func NewRunner(
 		executorClient:   executorClient,
 		metronClient:     metronClient,
 		clock:            clock,
+		clockJumps:       clockJumps,
 		healthy:          false,
 		failures:         0,
 	}
@@ -109,13 +114,26 @@ func (r *Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	emitInterval := r.clock.NewTicker(r.emissionInterval)
 	defer emitInterval.Stop()
 
+	clockJumps := r.clockJumps.Subscribe()
+	defer r.clockJumps.Unsubscribe(clockJumps)
+
+	checking := false
 	for {
 		select {
 		case signal := <-signals:
 			logger.Info("signalled-complete", lager.Data{"signal": signal.String()})
 			return nil
 
+		case jump := <-clockJumps:
+			logger.Info("clock-jump-detected", lager.Data{"skew": jump.Skew.String(), "checking": checking})
+			if checking {
+				healthcheckTimeout.Reset(r.timeoutInterval)
+			} else {
+				startHealthcheck.Reset(r.checkInterval)
+			}
+
 		case <-startHealthcheck.C():
+			checking = true
 			healthcheckTimeout.Reset(r.timeoutInterval)
 			go r.healthcheckCycle(logger, healthcheckComplete)
 
@@ -128,6 +146,7 @@ func (r *Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 			r.emitUnhealthyCellMetric(logger)
 
 		case err := <-healthcheckComplete:
+			checking = false
 			timeoutOk := healthcheckTimeout.Stop()
 			switch err.(type) {
 			case nil:
@@ -73,7 +73,7 @@ var _ = Describe("Runner", func() {
 			return nil
 		}
 
-		runner = gardenhealth.NewRunner(checkInterval, emissionInterval, timeoutDuration, logger, checker, executorClient, fakeMetronClient, fakeClock)
+		runner = gardenhealth.NewRunner(checkInterval, emissionInterval, timeoutDuration, logger, checker, executorClient, fakeMetronClient, fakeClock, nil)
 		process = ifrit.Background(runner)
 
 	})
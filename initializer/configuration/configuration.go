@@ -21,6 +21,7 @@ var (
 	ErrMemoryFlagInvalid       = fmt.Errorf("memory limit must be a positive number or '%s'", Automatic)
 	ErrDiskFlagInvalid         = fmt.Errorf("disk limit must be a positive number or '%s'", Automatic)
 	ErrAutoDiskCapacityInvalid = fmt.Errorf("auto disk limit must result in a positive number")
+	ErrReservationInvalid      = fmt.Errorf("reserved memory and disk must not be negative and must leave a positive capacity")
 )
 
 func ConfigureCapacity(
@@ -53,6 +54,22 @@ func ConfigureCapacity(
 	}, nil
 }
 
+// ReserveCapacity subtracts the memory and disk reserved for the system, e.g.
+// the executor, garden and the logging agents, from the capacity of the
+// cell.
+func ReserveCapacity(capacity executor.ExecutorResources, reservedMemoryMB, reservedDiskMB int) (executor.ExecutorResources, error) {
+	if reservedMemoryMB < 0 || reservedDiskMB < 0 {
+		return executor.ExecutorResources{}, ErrReservationInvalid
+	}
+
+	capacity.MemoryMB -= reservedMemoryMB
+	capacity.DiskMB -= reservedDiskMB
+	if capacity.MemoryMB <= 0 || capacity.DiskMB <= 0 {
+		return executor.ExecutorResources{}, ErrReservationInvalid
+	}
+	return capacity, nil
+}
+
 //go:generate counterfeiter -o configurationfakes/fake_rootfssizer.go . RootFSSizer
 type RootFSSizer interface {
 	RootFSSizeFromPath(path string) uint64
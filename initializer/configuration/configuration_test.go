@@ -261,6 +261,26 @@ var _ = Describe("configuration", func() {
 		})
 	})
 
+	Describe("ReserveCapacity", func() {
+		capacity := executor.ExecutorResources{MemoryMB: 4096, DiskMB: 8192, Containers: 249}
+
+		It("subtracts the reserved memory and disk", func() {
+			reserved, err := configuration.ReserveCapacity(capacity, 1024, 2048)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reserved).To(Equal(executor.ExecutorResources{MemoryMB: 3072, DiskMB: 6144, Containers: 249}))
+		})
+
+		It("fails when the reservation is negative", func() {
+			_, err := configuration.ReserveCapacity(capacity, -1, 0)
+			Expect(err).To(Equal(configuration.ErrReservationInvalid))
+		})
+
+		It("fails when the reservation leaves no capacity", func() {
+			_, err := configuration.ReserveCapacity(capacity, 0, 8192)
+			Expect(err).To(Equal(configuration.ErrReservationInvalid))
+		})
+	})
+
 	Describe("GetRootFSSizes", func() {
 		var (
 			logger   lager.Logger
@@ -2,6 +2,7 @@ package initializer
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
@@ -11,27 +12,47 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/archiver/compressor"
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/cacheddownloader"
 	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/durationjson"
 	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/capabilities"
+	"code.cloudfoundry.org/executor/capacity"
+	"code.cloudfoundry.org/executor/clockskew"
+	"code.cloudfoundry.org/executor/containerexec"
 	"code.cloudfoundry.org/executor/containermetrics"
 	"code.cloudfoundry.org/executor/depot"
+	"code.cloudfoundry.org/executor/depot/callbacks"
 	"code.cloudfoundry.org/executor/depot/containerstore"
+	"code.cloudfoundry.org/executor/depot/drain"
 	"code.cloudfoundry.org/executor/depot/event"
 	"code.cloudfoundry.org/executor/depot/metrics"
+	"code.cloudfoundry.org/executor/depot/prefetch"
+	"code.cloudfoundry.org/executor/depot/probe"
+	"code.cloudfoundry.org/executor/depot/quarantine"
+	"code.cloudfoundry.org/executor/depot/scheduler"
+	"code.cloudfoundry.org/executor/depot/steps"
 	"code.cloudfoundry.org/executor/depot/transformer"
 	"code.cloudfoundry.org/executor/depot/uploader"
+	"code.cloudfoundry.org/executor/diagnostics"
+	"code.cloudfoundry.org/executor/featureflags"
+	"code.cloudfoundry.org/executor/filecopy"
 	"code.cloudfoundry.org/executor/gardenhealth"
 	"code.cloudfoundry.org/executor/guidgen"
 	"code.cloudfoundry.org/executor/initializer/configuration"
+	"code.cloudfoundry.org/executor/loglevel"
+	"code.cloudfoundry.org/executor/revocation"
+	"code.cloudfoundry.org/executor/supportbundle"
 	"code.cloudfoundry.org/garden"
 	GardenClient "code.cloudfoundry.org/garden/client"
 	GardenConnection "code.cloudfoundry.org/garden/client/connection"
@@ -43,15 +64,39 @@ import (
 	"github.com/google/shlex"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 )
 
 const (
-	PingGardenInterval             = time.Second
-	StalledMetricHeartbeatInterval = 5 * time.Second
-	StalledGardenDuration          = "StalledGardenDuration"
-	maxConcurrentUploads           = 5
-	metricsReportInterval          = 1 * time.Minute
-	megabytesToBytes               = 1024 * 1024
+	PingGardenInterval               = time.Second
+	StalledMetricHeartbeatInterval   = 5 * time.Second
+	StalledGardenDuration            = "StalledGardenDuration"
+	maxConcurrentUploads             = 5
+	metricsReportInterval            = 1 * time.Minute
+	otlpExportTimeout                = 10 * time.Second
+	proxyStatsScrapeTimeout          = 5 * time.Second
+	defaultAssetScannerTimeout       = time.Minute
+	clockJumpCheckInterval           = 5 * time.Second
+	completionCallbackTimeout        = 30 * time.Second
+	completionCallbackMaxAttempts    = 5
+	completionCallbackRetryDelay     = time.Second
+	defaultWindowsPowershellPath     = "pwsh.exe"
+	defaultProcessWatchdogInterval   = 30 * time.Second
+	defaultCrashLoopWindow           = 5 * time.Minute
+	defaultCrashLoopMaxBackoff       = 5 * time.Minute
+	defaultCPUBurstWindow            = 5 * time.Minute
+	defaultSyntheticProbeTimeout     = 2 * time.Minute
+	defaultCheckpointInterval        = 30 * time.Second
+	defaultImageCredentialsTTL       = 5 * time.Minute
+	defaultImagePullTimeout          = 10 * time.Minute
+	defaultInstanceIdentityTokenTTL  = 10 * time.Minute
+	defaultImageCacheMaxSizeInBytes  = 10 * 1024 * megabytesToBytes
+	defaultImageCredentialsNamespace = "/image-credentials"
+	credHubTimeout                   = 10 * time.Second
+	megabytesToBytes                 = 1024 * 1024
+	supportBundleEvents              = 50
+	supportBundleContainers          = 500
+	defaultFileCopyMaxBytes          = 100 * megabytesToBytes
 )
 
 type executorContainers struct {
@@ -84,73 +129,215 @@ func (s systemcertsRetriever) SystemCerts() (*x509.CertPool, error) {
 	return caCertPool.AsX509CertPool(), nil
 }
 
+// InstanceIdentityCA is an additional CA trusted for instance identity
+// credentials, e.g. the new CA while the CA is being rotated.
+type InstanceIdentityCA struct {
+	CAPath         string `json:"ca_path"`
+	PrivateKeyPath string `json:"private_key_path,omitempty"`
+}
+
 type ExecutorConfig struct {
-	AdvertisePreferenceForInstanceAddress bool                  `json:"advertise_preference_for_instance_address"`
-	AutoDiskOverheadMB                    int                   `json:"auto_disk_capacity_overhead_mb"`
-	CachePath                             string                `json:"cache_path,omitempty"`
-	ContainerInodeLimit                   uint64                `json:"container_inode_limit,omitempty"`
-	ContainerMaxCpuShares                 uint64                `json:"container_max_cpu_shares,omitempty"`
-	ContainerMetricsReportInterval        durationjson.Duration `json:"container_metrics_report_interval,omitempty"`
-	ContainerOwnerName                    string                `json:"container_owner_name,omitempty"`
-	ContainerProxyADSServers              []string              `json:"container_proxy_ads_addresses,omitempty"`
-	ContainerProxyConfigPath              string                `json:"container_proxy_config_path,omitempty"`
-	ContainerProxyPath                    string                `json:"container_proxy_path,omitempty"`
-	ContainerProxyRequireClientCerts      bool                  `json:"container_proxy_require_and_verify_client_certs"`
-	ContainerProxyTrustedCACerts          []string              `json:"container_proxy_trusted_ca_certs"`
-	ContainerProxyVerifySubjectAltName    []string              `json:"container_proxy_verify_subject_alt_name"`
-	ContainerReapInterval                 durationjson.Duration `json:"container_reap_interval,omitempty"`
-	CreateWorkPoolSize                    int                   `json:"create_work_pool_size,omitempty"`
-	DeclarativeHealthcheckPath            string                `json:"declarative_healthcheck_path,omitempty"`
-	DeleteWorkPoolSize                    int                   `json:"delete_work_pool_size,omitempty"`
-	DiskMB                                string                `json:"disk_mb,omitempty"`
-	EnableContainerProxy                  bool                  `json:"enable_container_proxy,omitempty"`
-	EnableDeclarativeHealthcheck          bool                  `json:"enable_declarative_healthcheck,omitempty"`
-	EnableUnproxiedPortMappings           bool                  `json:"enable_unproxied_port_mappings"`
-	EnvoyConfigRefreshDelay               durationjson.Duration `json:"envoy_config_refresh_delay"`
-	EnvoyConfigReloadDuration             durationjson.Duration `json:"envoy_config_reload_duration"`
-	EnvoyDrainTimeout                     durationjson.Duration `json:"envoy_drain_timeout,omitempty"`
-	ExportNetworkEnvVars                  bool                  `json:"export_network_env_vars,omitempty"` // DEPRECATED. Kept around for dusts compatability
-	GardenAddr                            string                `json:"garden_addr,omitempty"`
-	GardenHealthcheckCommandRetryPause    durationjson.Duration `json:"garden_healthcheck_command_retry_pause,omitempty"`
-	GardenHealthcheckEmissionInterval     durationjson.Duration `json:"garden_healthcheck_emission_interval,omitempty"`
-	GardenHealthcheckInterval             durationjson.Duration `json:"garden_healthcheck_interval,omitempty"`
-	GardenHealthcheckProcessArgs          []string              `json:"garden_healthcheck_process_args,omitempty"`
-	GardenHealthcheckProcessDir           string                `json:"garden_healthcheck_process_dir"`
-	GardenHealthcheckProcessEnv           []string              `json:"garden_healthcheck_process_env,omitempty"`
-	GardenHealthcheckProcessPath          string                `json:"garden_healthcheck_process_path"`
-	GardenHealthcheckProcessUser          string                `json:"garden_healthcheck_process_user"`
-	GardenHealthcheckTimeout              durationjson.Duration `json:"garden_healthcheck_timeout,omitempty"`
-	GardenNetwork                         string                `json:"garden_network,omitempty"`
-	GracefulShutdownInterval              durationjson.Duration `json:"graceful_shutdown_interval,omitempty"`
-	HealthCheckContainerOwnerName         string                `json:"healthcheck_container_owner_name,omitempty"`
-	HealthCheckWorkPoolSize               int                   `json:"healthcheck_work_pool_size,omitempty"`
-	HealthyMonitoringInterval             durationjson.Duration `json:"healthy_monitoring_interval,omitempty"`
-	InstanceIdentityCAPath                string                `json:"instance_identity_ca_path,omitempty"`
-	InstanceIdentityCredDir               string                `json:"instance_identity_cred_dir,omitempty"`
-	InstanceIdentityPrivateKeyPath        string                `json:"instance_identity_private_key_path,omitempty"`
-	InstanceIdentityValidityPeriod        durationjson.Duration `json:"instance_identity_validity_period,omitempty"`
-	MaxCacheSizeInBytes                   uint64                `json:"max_cache_size_in_bytes,omitempty"`
-	MaxConcurrentDownloads                int                   `json:"max_concurrent_downloads,omitempty"`
-	MaxLogLinesPerSecond                  int                   `json:"max_log_lines_per_second"`
-	MemoryMB                              string                `json:"memory_mb,omitempty"`
-	MetricsWorkPoolSize                   int                   `json:"metrics_work_pool_size,omitempty"`
-	PathToCACertsForDownloads             string                `json:"path_to_ca_certs_for_downloads"`
-	PathToTLSCACert                       string                `json:"path_to_tls_ca_cert"`
-	PathToTLSCert                         string                `json:"path_to_tls_cert"`
-	PathToTLSKey                          string                `json:"path_to_tls_key"`
-	PostSetupHook                         string                `json:"post_setup_hook"`
-	PostSetupUser                         string                `json:"post_setup_user"`
-	ProxyEnableHttp2                      bool                  `json:"proxy_enable_http2"`
-	ProxyMemoryAllocationMB               int                   `json:"proxy_memory_allocation_mb,omitempty"`
-	ReadWorkPoolSize                      int                   `json:"read_work_pool_size,omitempty"`
-	ReservedExpirationTime                durationjson.Duration `json:"reserved_expiration_time,omitempty"`
-	SetCPUWeight                          bool                  `json:"set_cpu_weight,omitempty"`
-	SkipCertVerify                        bool                  `json:"skip_cert_verify,omitempty"`
-	TempDir                               string                `json:"temp_dir,omitempty"`
-	TrustedSystemCertificatesPath         string                `json:"trusted_system_certificates_path"`
-	UnhealthyMonitoringInterval           durationjson.Duration `json:"unhealthy_monitoring_interval,omitempty"`
-	UseSchedulableDiskSize                bool                  `json:"use_schedulable_disk_size,omitempty"`
-	VolmanDriverPaths                     string                `json:"volman_driver_paths"`
+	AdminCACertPath                       string                   `json:"admin_ca_cert_path,omitempty"`
+	AdminCertPath                         string                   `json:"admin_cert_path,omitempty"`
+	AdminKeyPath                          string                   `json:"admin_key_path,omitempty"`
+	AdminListenAddress                    string                   `json:"admin_listen_address,omitempty"`
+	AdminOperatorIdentities               []string                 `json:"admin_operator_identities,omitempty"`
+	AdvertisePreferenceForInstanceAddress bool                     `json:"advertise_preference_for_instance_address"`
+	AllowHostProcessContainers            bool                     `json:"allow_host_process_containers,omitempty"`
+	AllowedSysctls                        []string                 `json:"allowed_sysctls,omitempty"`
+	ArtifactPrefetchInterval              durationjson.Duration    `json:"artifact_prefetch_interval,omitempty"`
+	AssetScannerArgs                      []string                 `json:"asset_scanner_args,omitempty"`
+	AssetScannerFailurePolicy             string                   `json:"asset_scanner_failure_policy,omitempty"`
+	AssetScannerPath                      string                   `json:"asset_scanner_path,omitempty"`
+	AssetScannerTimeout                   durationjson.Duration    `json:"asset_scanner_timeout,omitempty"`
+	AssetScannerURL                       string                   `json:"asset_scanner_url,omitempty"`
+	AutoDiskOverheadMB                    int                      `json:"auto_disk_capacity_overhead_mb"`
+	BandwidthLimitHook                    string                   `json:"bandwidth_limit_hook,omitempty"`
+	CPUBurstCgroupRoot                    string                   `json:"cpu_burst_cgroup_root,omitempty"`
+	CPUBurstFactor                        float64                  `json:"cpu_burst_factor,omitempty"`
+	CPUBurstWindow                        durationjson.Duration    `json:"cpu_burst_window,omitempty"`
+	CachePath                             string                   `json:"cache_path,omitempty"`
+	CapacityForecastWindow                durationjson.Duration    `json:"capacity_forecast_window,omitempty"`
+	ClockJumpThreshold                    durationjson.Duration    `json:"clock_jump_threshold,omitempty"`
+	CompletionCallbackAllowedHosts        []string                 `json:"completion_callback_allowed_hosts,omitempty"`
+	CompletionCallbackMaxAttempts         int                      `json:"completion_callback_max_attempts,omitempty"`
+	CompletionCallbackRetryDelay          durationjson.Duration    `json:"completion_callback_retry_delay,omitempty"`
+	CompressCoreDumps                     bool                     `json:"compress_core_dumps,omitempty"`
+	ConnectionAccountingCgroupRoot        string                   `json:"connection_accounting_cgroup_root,omitempty"`
+	ConnectionCeilingsEnforced            bool                     `json:"connection_ceilings_enforced,omitempty"`
+	ContainerCgroupRoot                   string                   `json:"container_cgroup_root,omitempty"`
+	ContainerCheckpointInterval           durationjson.Duration    `json:"container_checkpoint_interval,omitempty"`
+	ContainerCheckpointPath               string                   `json:"container_checkpoint_path,omitempty"`
+	ContainerIPFamily                     string                   `json:"container_ip_family,omitempty"`
+	ContainerIPPoolSize                   int                      `json:"container_ip_pool_size,omitempty"`
+	ContainerInodeLimit                   uint64                   `json:"container_inode_limit,omitempty"`
+	ContainerMaxCpuShares                 uint64                   `json:"container_max_cpu_shares,omitempty"`
+	ContainerMaxNewConnectionsPerMinute   uint64                   `json:"container_max_new_connections_per_minute,omitempty"`
+	ContainerMaxOpenConnections           uint64                   `json:"container_max_open_connections,omitempty"`
+	ContainerMetricsReportInterval        durationjson.Duration    `json:"container_metrics_report_interval,omitempty"`
+	ContainerOwnerName                    string                   `json:"container_owner_name,omitempty"`
+	ContainerProxyADSServers              []string                 `json:"container_proxy_ads_addresses,omitempty"`
+	ContainerProxyConfigPath              string                   `json:"container_proxy_config_path,omitempty"`
+	ContainerProxyPath                    string                   `json:"container_proxy_path,omitempty"`
+	ContainerProxyRequireClientCerts      bool                     `json:"container_proxy_require_and_verify_client_certs"`
+	ContainerProxyStatsEnabled            bool                     `json:"container_proxy_stats_enabled,omitempty"`
+	ContainerProxyTrustedCACerts          []string                 `json:"container_proxy_trusted_ca_certs"`
+	ContainerProxyVerifySubjectAltName    []string                 `json:"container_proxy_verify_subject_alt_name"`
+	ContainerReapInterval                 durationjson.Duration    `json:"container_reap_interval,omitempty"`
+	ContainerTemplates                    executor.Templates       `json:"container_templates,omitempty"`
+	CoreDumpDir                           string                   `json:"core_dump_dir,omitempty"`
+	CoreDumpGlobs                         []string                 `json:"core_dump_globs,omitempty"`
+	CoreDumpQuotaBytes                    int64                    `json:"core_dump_quota_bytes,omitempty"`
+	CrashLoopMaxBackoff                   durationjson.Duration    `json:"crash_loop_max_backoff,omitempty"`
+	CrashLoopThreshold                    int                      `json:"crash_loop_threshold,omitempty"`
+	CrashLoopWindow                       durationjson.Duration    `json:"crash_loop_window,omitempty"`
+	CreateWorkPoolSize                    int                      `json:"create_work_pool_size,omitempty"`
+	CredHubCACertPath                     string                   `json:"credhub_ca_cert_path,omitempty"`
+	CredHubClientCertPath                 string                   `json:"credhub_client_cert_path,omitempty"`
+	CredHubClientKeyPath                  string                   `json:"credhub_client_key_path,omitempty"`
+	CredHubURL                            string                   `json:"credhub_url,omitempty"`
+	DeclarativeHealthcheckPath            string                   `json:"declarative_healthcheck_path,omitempty"`
+	DefaultStartTimeout                   durationjson.Duration    `json:"default_start_timeout,omitempty"`
+	DeleteWorkPoolSize                    int                      `json:"delete_work_pool_size,omitempty"`
+	DiskMB                                string                   `json:"disk_mb,omitempty"`
+	DrainStopOrder                        []string                 `json:"drain_stop_order,omitempty"`
+	EgressResolveInterval                 durationjson.Duration    `json:"egress_resolve_interval,omitempty"`
+	EnableContainerProxy                  bool                     `json:"enable_container_proxy,omitempty"`
+	EnableDeclarativeHealthcheck          bool                     `json:"enable_declarative_healthcheck,omitempty"`
+	EnableHealthCheckLogSources           bool                     `json:"enable_health_check_log_sources,omitempty"`
+	EnableUnproxiedPortMappings           bool                     `json:"enable_unproxied_port_mappings"`
+	EnvoyConfigRefreshDelay               durationjson.Duration    `json:"envoy_config_refresh_delay"`
+	EnvoyConfigReloadDuration             durationjson.Duration    `json:"envoy_config_reload_duration"`
+	EnvoyDrainTimeout                     durationjson.Duration    `json:"envoy_drain_timeout,omitempty"`
+	ExclusiveCPUs                         string                   `json:"exclusive_cpus,omitempty"`
+	ExportNetworkEnvVars                  bool                     `json:"export_network_env_vars,omitempty"` // DEPRECATED. Kept around for dusts compatability
+	FakeTimeLibraryPath                   string                   `json:"faketime_library_path,omitempty"`
+	FeatureFlags                          []string                 `json:"feature_flags,omitempty"`
+	FileCopyAllowedPaths                  []string                 `json:"file_copy_allowed_paths,omitempty"`
+	FileCopyMaxBytes                      int64                    `json:"file_copy_max_bytes,omitempty"`
+	GardenAddr                            string                   `json:"garden_addr,omitempty"`
+	GardenHealthcheckCommandRetryPause    durationjson.Duration    `json:"garden_healthcheck_command_retry_pause,omitempty"`
+	GardenHealthcheckEmissionInterval     durationjson.Duration    `json:"garden_healthcheck_emission_interval,omitempty"`
+	GardenHealthcheckInterval             durationjson.Duration    `json:"garden_healthcheck_interval,omitempty"`
+	GardenHealthcheckProcessArgs          []string                 `json:"garden_healthcheck_process_args,omitempty"`
+	GardenHealthcheckProcessDir           string                   `json:"garden_healthcheck_process_dir"`
+	GardenHealthcheckProcessEnv           []string                 `json:"garden_healthcheck_process_env,omitempty"`
+	GardenHealthcheckProcessPath          string                   `json:"garden_healthcheck_process_path"`
+	GardenHealthcheckProcessUser          string                   `json:"garden_healthcheck_process_user"`
+	GardenHealthcheckTimeout              durationjson.Duration    `json:"garden_healthcheck_timeout,omitempty"`
+	GardenNetwork                         string                   `json:"garden_network,omitempty"`
+	GracefulShutdownInterval              durationjson.Duration    `json:"graceful_shutdown_interval,omitempty"`
+	GPUDevices                            []string                 `json:"gpu_devices,omitempty"`
+	GPUDeviceTypes                        map[string]string        `json:"gpu_device_types,omitempty"`
+	GPUUtilizationCommand                 string                   `json:"gpu_utilization_command,omitempty"`
+	HealthCheckContainerOwnerName         string                   `json:"healthcheck_container_owner_name,omitempty"`
+	HealthCheckWorkPoolSize               int                      `json:"healthcheck_work_pool_size,omitempty"`
+	HealthyMonitoringInterval             durationjson.Duration    `json:"healthy_monitoring_interval,omitempty"`
+	HostPortPoolSize                      int                      `json:"host_port_pool_size,omitempty"`
+	IPRetentionWindow                     durationjson.Duration    `json:"ip_retention_window,omitempty"`
+	ImageCacheDir                         string                   `json:"image_cache_dir,omitempty"`
+	ImageCacheMaxSizeInBytes              uint64                   `json:"image_cache_max_size_in_bytes,omitempty"`
+	ImageCredentialsNamespace             string                   `json:"image_credentials_namespace,omitempty"`
+	ImageCredentialsTTL                   durationjson.Duration    `json:"image_credentials_ttl,omitempty"`
+	ImagePullTimeout                      durationjson.Duration    `json:"image_pull_timeout,omitempty"`
+	InsecureImageRegistries               []string                 `json:"insecure_image_registries,omitempty"`
+	InstanceIdentityCAPath                string                   `json:"instance_identity_ca_path,omitempty"`
+	InstanceIdentityCAs                   []InstanceIdentityCA     `json:"instance_identity_cas,omitempty"`
+	InstanceIdentityCRLPath               string                   `json:"instance_identity_crl_path,omitempty"`
+	InstanceIdentityCRLURL                string                   `json:"instance_identity_crl_url,omitempty"`
+	InstanceIdentityCRLValidity           durationjson.Duration    `json:"instance_identity_crl_validity,omitempty"`
+	InstanceIdentityCredDir               string                   `json:"instance_identity_cred_dir,omitempty"`
+	InstanceIdentityEncryptKey            bool                     `json:"instance_identity_encrypt_key,omitempty"`
+	InstanceIdentityKeyAlgorithm          string                   `json:"instance_identity_key_algorithm,omitempty"`
+	InstanceIdentityKeyFormat             string                   `json:"instance_identity_key_format,omitempty"`
+	InstanceIdentityKeyPoolSize           int                      `json:"instance_identity_key_pool_size,omitempty"`
+	InstanceIdentityKeyPoolWorkers        int                      `json:"instance_identity_key_pool_workers,omitempty"`
+	InstanceIdentityOCSPListenAddress     string                   `json:"instance_identity_ocsp_listen_address,omitempty"`
+	InstanceIdentityOCSPURL               string                   `json:"instance_identity_ocsp_url,omitempty"`
+	InstanceIdentityPrivateKeyPath        string                   `json:"instance_identity_private_key_path,omitempty"`
+	InstanceIdentityRotationFraction      float64                  `json:"instance_identity_rotation_fraction,omitempty"`
+	InstanceIdentityRotationJitter        durationjson.Duration    `json:"instance_identity_rotation_jitter,omitempty"`
+	InstanceIdentityRotationMinValidity   durationjson.Duration    `json:"instance_identity_rotation_min_validity,omitempty"`
+	InstanceIdentityRotationRetryAttempts int                      `json:"instance_identity_rotation_retry_attempts,omitempty"`
+	InstanceIdentityRotationRetryBackoff  durationjson.Duration    `json:"instance_identity_rotation_retry_backoff,omitempty"`
+	InstanceIdentitySANAllowedDNSNames    []string                 `json:"instance_identity_san_allowed_dns_names,omitempty"`
+	InstanceIdentitySANAllowedNetworks    []string                 `json:"instance_identity_san_allowed_networks,omitempty"`
+	InstanceIdentitySPIFFETrustDomain     string                   `json:"instance_identity_spiffe_trust_domain,omitempty"`
+	InstanceIdentitySigner                string                   `json:"instance_identity_signer,omitempty"`
+	InstanceIdentitySignerCACertPath      string                   `json:"instance_identity_signer_ca_cert_path,omitempty"`
+	InstanceIdentitySignerCFSSLProfile    string                   `json:"instance_identity_signer_cfssl_profile,omitempty"`
+	InstanceIdentitySignerMaxAttempts     int                      `json:"instance_identity_signer_max_attempts,omitempty"`
+	InstanceIdentitySignerRetryDelay      durationjson.Duration    `json:"instance_identity_signer_retry_delay,omitempty"`
+	InstanceIdentitySignerURL             string                   `json:"instance_identity_signer_url,omitempty"`
+	InstanceIdentitySignerVaultMount      string                   `json:"instance_identity_signer_vault_mount,omitempty"`
+	InstanceIdentitySignerVaultRole       string                   `json:"instance_identity_signer_vault_role,omitempty"`
+	InstanceIdentitySignerVaultToken      string                   `json:"instance_identity_signer_vault_token,omitempty"`
+	InstanceIdentityTokenAudience         []string                 `json:"instance_identity_token_audience,omitempty"`
+	InstanceIdentityTokenIssuer           string                   `json:"instance_identity_token_issuer,omitempty"`
+	InstanceIdentityTokenKeyID            string                   `json:"instance_identity_token_key_id,omitempty"`
+	InstanceIdentityTokenMountPath        string                   `json:"instance_identity_token_mount_path,omitempty"`
+	InstanceIdentityTokenSigningKeyPath   string                   `json:"instance_identity_token_signing_key_path,omitempty"`
+	InstanceIdentityTokenTTL              durationjson.Duration    `json:"instance_identity_token_ttl,omitempty"`
+	InstanceIdentityValidityPeriod        durationjson.Duration    `json:"instance_identity_validity_period,omitempty"`
+	InstanceIdentityWindowsCertStore      bool                     `json:"instance_identity_windows_cert_store,omitempty"`
+	InstanceIdentityWindowsPowershellPath string                   `json:"instance_identity_windows_powershell_path,omitempty"`
+	LifecycleWebhookCACertPath            string                   `json:"lifecycle_webhook_ca_cert_path,omitempty"`
+	LifecycleWebhookCertPath              string                   `json:"lifecycle_webhook_cert_path,omitempty"`
+	LifecycleWebhookKeyPath               string                   `json:"lifecycle_webhook_key_path,omitempty"`
+	LifecycleWebhooks                     []callbacks.Webhook      `json:"lifecycle_webhooks,omitempty"`
+	LivenessFailureWindow                 durationjson.Duration    `json:"liveness_failure_window,omitempty"`
+	MaxCacheSizeInBytes                   uint64                   `json:"max_cache_size_in_bytes,omitempty"`
+	MaxConcurrentDownloads                int                      `json:"max_concurrent_downloads,omitempty"`
+	MaxContainerStartsPerAppPerMinute     int                      `json:"max_container_starts_per_app_per_minute,omitempty"`
+	MaxCoreDumpBytes                      int64                    `json:"max_core_dump_bytes,omitempty"`
+	MaxLogLinesPerSecond                  int                      `json:"max_log_lines_per_second"`
+	MaxResultArtifactBytes                int                      `json:"max_result_artifact_bytes,omitempty"`
+	MaxToleratedLivenessFailures          int                      `json:"max_tolerated_liveness_failures,omitempty"`
+	MemoryMB                              string                   `json:"memory_mb,omitempty"`
+	MetricNamePrefix                      string                   `json:"metric_name_prefix,omitempty"`
+	MetricsAllowlist                      []string                 `json:"metrics_allowlist,omitempty"`
+	MetricsDenylist                       []string                 `json:"metrics_denylist,omitempty"`
+	MetricsExporters                      []string                 `json:"metrics_exporters,omitempty"`
+	MetricsHealthListenAddress            string                   `json:"metrics_health_listen_address,omitempty"`
+	MetricsStaleAfter                     durationjson.Duration    `json:"metrics_stale_after,omitempty"`
+	MetricsWorkPoolSize                   int                      `json:"metrics_work_pool_size,omitempty"`
+	OTLPMetricsCACertPath                 string                   `json:"otlp_metrics_ca_cert_path,omitempty"`
+	OTLPMetricsCertPath                   string                   `json:"otlp_metrics_cert_path,omitempty"`
+	OTLPMetricsEndpoint                   string                   `json:"otlp_metrics_endpoint,omitempty"`
+	OTLPMetricsKeyPath                    string                   `json:"otlp_metrics_key_path,omitempty"`
+	PathToCACertsForDownloads             string                   `json:"path_to_ca_certs_for_downloads"`
+	PathToTLSCACert                       string                   `json:"path_to_tls_ca_cert"`
+	PathToTLSCert                         string                   `json:"path_to_tls_cert"`
+	PathToTLSKey                          string                   `json:"path_to_tls_key"`
+	PerContainerMetrics                   bool                     `json:"per_container_metrics,omitempty"`
+	PerContainerMetricsLimit              int                      `json:"per_container_metrics_limit,omitempty"`
+	PlacementQuotas                       executor.PlacementQuotas `json:"placement_quotas,omitempty"`
+	PlacementTags                         []string                 `json:"placement_tags,omitempty"`
+	PostSetupHook                         string                   `json:"post_setup_hook"`
+	PostSetupUser                         string                   `json:"post_setup_user"`
+	ProcessWatchdogInterval               durationjson.Duration    `json:"process_watchdog_interval,omitempty"`
+	PropertySyncInterval                  durationjson.Duration    `json:"property_sync_interval,omitempty"`
+	ProxyEnableHttp2                      bool                     `json:"proxy_enable_http2"`
+	ProxyMemoryAllocationMB               int                      `json:"proxy_memory_allocation_mb,omitempty"`
+	ReadOnlyRootfsSupported               bool                     `json:"read_only_rootfs_supported,omitempty"`
+	ReadWorkPoolSize                      int                      `json:"read_work_pool_size,omitempty"`
+	ReadinessFailurePolicy                string                   `json:"readiness_failure_policy,omitempty"`
+	ReservedDiskMB                        int                      `json:"reserved_disk_mb,omitempty"`
+	ReservedExpirationTime                durationjson.Duration    `json:"reserved_expiration_time,omitempty"`
+	ReservedMemoryMB                      int                      `json:"reserved_memory_mb,omitempty"`
+	ScheduledTasks                        []executor.ScheduledTask `json:"scheduled_tasks,omitempty"`
+	SetCPUWeight                          bool                     `json:"set_cpu_weight,omitempty"`
+	SkipCertVerify                        bool                     `json:"skip_cert_verify,omitempty"`
+	StartTimeoutWarningThreshold          durationjson.Duration    `json:"start_timeout_warning_threshold,omitempty"`
+	StartupProgressInterval               durationjson.Duration    `json:"startup_progress_interval,omitempty"`
+	SyntheticProbeInterval                durationjson.Duration    `json:"synthetic_probe_interval,omitempty"`
+	SyntheticProbeTimeout                 durationjson.Duration    `json:"synthetic_probe_timeout,omitempty"`
+	TempDir                               string                   `json:"temp_dir,omitempty"`
+	TrustedSystemCertificatesPath         string                   `json:"trusted_system_certificates_path"`
+	UnhealthyMonitoringInterval           durationjson.Duration    `json:"unhealthy_monitoring_interval,omitempty"`
+	UseSchedulableDiskSize                bool                     `json:"use_schedulable_disk_size,omitempty"`
+	VolmanDriverPaths                     string                   `json:"volman_driver_paths"`
+	ZoneInfoDir                           string                   `json:"zoneinfo_dir,omitempty"`
 }
 
 var (
@@ -161,6 +348,8 @@ var (
 func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 	rootFSes map[string]string, metronClient loggingclient.IngressClient,
 	clock clock.Clock) (executor.Client, *containermetrics.StatsReporter, grouper.Members, error) {
+	logLevels := loglevel.NewController(lager.DEBUG)
+	logger = logLevels.Logger(logger)
 
 	var gardenHealthcheckRootFS string
 	for _, rootFSPath := range rootFSes {
@@ -203,9 +392,13 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 		return nil, nil, nil, err
 	}
 
-	err = destroyContainers(gardenClient, containersFetcher, logger)
-	if err != nil {
-		return nil, nil, nil, err
+	// the containers are recovered from the checkpoint instead, once the
+	// container store exists
+	if config.ContainerCheckpointPath == "" {
+		err = destroyContainers(gardenClient, containersFetcher, logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	healthCheckWorkPool, err := workpool.NewWorkPool(config.HealthCheckWorkPoolSize)
@@ -236,9 +429,20 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 
 	downloadRateLimiter := make(chan struct{}, uint(config.MaxConcurrentDownloads))
 
+	processWatchdogInterval := time.Duration(config.ProcessWatchdogInterval)
+	if processWatchdogInterval <= 0 {
+		processWatchdogInterval = defaultProcessWatchdogInterval
+	}
+
+	workDir := setupWorkDir(logger, config.TempDir)
+	assetQuarantine, err := assetQuarantineFromConfig(logger, config, workDir, assetTLSConfig)
+	if err != nil {
+		return nil, nil, grouper.Members{}, err
+	}
+
 	transformer := initializeTransformer(
 		cachedDownloader,
-		setupWorkDir(logger, config.TempDir),
+		workDir,
 		downloadRateLimiter,
 		maxConcurrentUploads,
 		uploader,
@@ -253,28 +457,143 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 		gardenHealthcheckRootFS,
 		config.EnableContainerProxy,
 		time.Duration(config.EnvoyDrainTimeout),
+		processWatchdogInterval,
+		time.Duration(config.DefaultStartTimeout),
+		steps.ReadinessFailurePolicy(config.ReadinessFailurePolicy),
+		config.EnableHealthCheckLogSources,
+		steps.LivenessFailureBudget{
+			MaxFailures: config.MaxToleratedLivenessFailures,
+			Window:      time.Duration(config.LivenessFailureWindow),
+		},
+		time.Duration(config.StartupProgressInterval),
+		assetQuarantine,
 	)
 
+	featureFlags, err := featureflags.New(config.FeatureFlags...)
+	if err != nil {
+		logger.Error("invalid-feature-flags", err)
+		return nil, nil, grouper.Members{}, err
+	}
+	logger.Info("feature-flags", lager.Data{"active": featureFlags.Active()})
+
 	hub := event.NewHub()
 
 	totalCapacity, err := fetchCapacity(logger, gardenClient, config)
 	if err != nil {
 		return nil, nil, grouper.Members{}, err
 	}
+	for _, name := range config.AllowedSysctls {
+		if _, ok := containerstore.SysctlNamespace(name); !ok {
+			return nil, nil, grouper.Members{}, fmt.Errorf("allowed sysctl %s is not namespaced", name)
+		}
+	}
+	if len(config.AllowedSysctls) > 0 && config.ContainerCgroupRoot == "" {
+		return nil, nil, grouper.Members{}, errors.New("container_cgroup_root is required to set the sysctls of containers")
+	}
+	if len(config.GPUDevices) > 0 && config.ContainerCgroupRoot == "" {
+		return nil, nil, grouper.Members{}, errors.New("container_cgroup_root is required to give containers access to gpu devices")
+	}
+	totalCapacity.GPUs = len(config.GPUDevices)
+	totalCapacity.GPUTypes = gpuTypes(config.GPUDevices, config.GPUDeviceTypes)
+	exclusiveCPUs, err := containerstore.ParseCPUSet(config.ExclusiveCPUs)
+	if err != nil {
+		logger.Error("invalid-exclusive-cpus", err, lager.Data{"exclusive-cpus": config.ExclusiveCPUs})
+		return nil, nil, grouper.Members{}, err
+	}
+	if len(exclusiveCPUs) > 0 && config.ContainerCgroupRoot == "" {
+		return nil, nil, grouper.Members{}, errors.New("container_cgroup_root is required to pin containers to exclusive cpus")
+	}
+	totalCapacity.ExclusiveCPUs = len(exclusiveCPUs)
+	totalCapacity.ContainerIPs = config.ContainerIPPoolSize
+	totalCapacity.HostPorts = config.HostPortPoolSize
 	rootFSSizer, err := configuration.GetRootFSSizes(logger, gardenClient, guidgen.DefaultGenerator, config.ContainerOwnerName, rootFSes)
 	if err != nil {
 		return nil, nil, grouper.Members{}, err
 	}
 
+	capacityChanges := containerstore.NewCapacityNotifier()
 	containerConfig := containerstore.ContainerConfig{
-		OwnerName:              config.ContainerOwnerName,
-		INodeLimit:             config.ContainerInodeLimit,
-		MaxCPUShares:           config.ContainerMaxCpuShares,
-		SetCPUWeight:           config.SetCPUWeight,
-		ReservedExpirationTime: time.Duration(config.ReservedExpirationTime),
-		ReapInterval:           time.Duration(config.ContainerReapInterval),
-		MaxLogLinesPerSecond:   config.MaxLogLinesPerSecond,
-		MetricReportInterval:   time.Duration(config.ContainerMetricsReportInterval),
+		OwnerName:                    config.ContainerOwnerName,
+		INodeLimit:                   config.ContainerInodeLimit,
+		MaxCPUShares:                 config.ContainerMaxCpuShares,
+		SetCPUWeight:                 config.SetCPUWeight,
+		AllowHostProcessContainers:   config.AllowHostProcessContainers,
+		AllowedSysctls:               config.AllowedSysctls,
+		ReservedExpirationTime:       time.Duration(config.ReservedExpirationTime),
+		ReapInterval:                 time.Duration(config.ContainerReapInterval),
+		EgressResolveInterval:        time.Duration(config.EgressResolveInterval),
+		PropertySyncInterval:         time.Duration(config.PropertySyncInterval),
+		MaxLogLinesPerSecond:         config.MaxLogLinesPerSecond,
+		MetricReportInterval:         time.Duration(config.ContainerMetricsReportInterval),
+		MaxResultArtifactBytes:       config.MaxResultArtifactBytes,
+		CrashLoopThreshold:           config.CrashLoopThreshold,
+		CrashLoopWindow:              time.Duration(config.CrashLoopWindow),
+		CrashLoopMaxBackoff:          time.Duration(config.CrashLoopMaxBackoff),
+		IPRetentionWindow:            time.Duration(config.IPRetentionWindow),
+		StartTimeoutWarningThreshold: time.Duration(config.StartTimeoutWarningThreshold),
+		CoreDumpDir:                  config.CoreDumpDir,
+		CoreDumpGlobs:                config.CoreDumpGlobs,
+		MaxCoreDumpBytes:             config.MaxCoreDumpBytes,
+		CoreDumpQuotaBytes:           config.CoreDumpQuotaBytes,
+		CompressCoreDumps:            config.CompressCoreDumps,
+		DefaultIPFamily:              executor.IPFamily(config.ContainerIPFamily),
+		ZoneInfoDir:                  config.ZoneInfoDir,
+		FakeTimeLibraryPath:          config.FakeTimeLibraryPath,
+		GracefulShutdownInterval:     time.Duration(config.GracefulShutdownInterval),
+		ReadOnlyRootfsSupported:      config.ReadOnlyRootfsSupported,
+		PlacementQuotas:              config.PlacementQuotas,
+		CapacityChanges:              capacityChanges,
+		ImageCacheDir:                config.ImageCacheDir,
+		ImageCacheMaxSizeInBytes:     imageCacheMaxSizeInBytes(config),
+		ImagePullTimeout:             time.Duration(config.ImagePullTimeout),
+		InsecureImageRegistries:      config.InsecureImageRegistries,
+		CredHubURL:                   config.CredHubURL,
+		ImageCredentialsNamespace:    config.ImageCredentialsNamespace,
+		ImageCredentialsTTL:          time.Duration(config.ImageCredentialsTTL),
+		GPUDeviceTypes:               config.GPUDeviceTypes,
+		ExclusiveCPUs:                exclusiveCPUs,
+	}
+	bandwidthLimitHook, err := shlex.Split(config.BandwidthLimitHook)
+	if err != nil {
+		logger.Error("failed-to-parse-bandwidth-limit-hook", err)
+		return nil, nil, grouper.Members{}, err
+	}
+	if len(bandwidthLimitHook) > 0 {
+		containerConfig.BandwidthLimiter = containerstore.NewCommandBandwidthLimiter(bandwidthLimitHook)
+	}
+	if containerConfig.CrashLoopWindow <= 0 {
+		containerConfig.CrashLoopWindow = defaultCrashLoopWindow
+	}
+	if containerConfig.CrashLoopMaxBackoff <= 0 {
+		containerConfig.CrashLoopMaxBackoff = defaultCrashLoopMaxBackoff
+	}
+	if containerConfig.ImagePullTimeout <= 0 {
+		containerConfig.ImagePullTimeout = defaultImagePullTimeout
+	}
+	if containerConfig.ImageCredentialsTTL <= 0 {
+		containerConfig.ImageCredentialsTTL = defaultImageCredentialsTTL
+	}
+	if containerConfig.ImageCredentialsNamespace == "" {
+		containerConfig.ImageCredentialsNamespace = defaultImageCredentialsNamespace
+	}
+	if config.CredHubURL != "" {
+		credHubTLSConfig, err := tlsconfig.Build(
+			tlsconfig.WithInternalServiceDefaults(),
+			tlsconfig.WithIdentityFromFile(config.CredHubClientCertPath, config.CredHubClientKeyPath),
+		).Client(
+			tlsconfig.WithAuthorityFromFile(config.CredHubCACertPath),
+		)
+		if err != nil {
+			logger.Error("failed-to-configure-credhub-tls", err)
+			return nil, nil, grouper.Members{}, err
+		}
+		containerConfig.CredHubClient = &http.Client{
+			Timeout:   credHubTimeout,
+			Transport: &http.Transport{TLSClientConfig: credHubTLSConfig},
+		}
+	}
+	if config.ContainerCgroupRoot != "" {
+		containerConfig.CgroupLimiter = containerstore.NewCgroupLimiter(config.ContainerCgroupRoot)
 	}
 
 	driverConfig := vollocal.NewDriverConfig()
@@ -294,6 +613,7 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 			clock,
 			config.ContainerProxyADSServers,
 			config.ProxyEnableHttp2,
+			config.ContainerProxyStatsEnabled,
 		)
 	} else {
 		proxyConfigHandler = containerstore.NewNoopProxyConfigHandler()
@@ -302,9 +622,41 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 	instanceIdentityHandler := containerstore.NewInstanceIdentityHandler(
 		config.InstanceIdentityCredDir,
 		"/etc/cf-instance-credentials",
+		config.InstanceIdentityEncryptKey,
+		rand.Reader,
 	)
 
-	credManager, err := CredManagerFromConfig(logger, metronClient, config, clock, proxyConfigHandler, instanceIdentityHandler)
+	var clockJumps *clockskew.Detector
+	if config.ClockJumpThreshold > 0 {
+		clockJumps = clockskew.NewDetector(logger, clock, metronClient, hub, clockJumpCheckInterval, time.Duration(config.ClockJumpThreshold))
+	}
+
+	credHandlers := []containerstore.CredentialHandler{proxyConfigHandler, instanceIdentityHandler}
+	if config.InstanceIdentityTokenSigningKeyPath != "" {
+		workloadTokenHandler, err := workloadTokenHandlerFromConfig(logger, config, clock)
+		if err != nil {
+			return nil, nil, grouper.Members{}, err
+		}
+		credHandlers = append(credHandlers, workloadTokenHandler)
+	}
+	if config.InstanceIdentityWindowsCertStore {
+		powershellPath := config.InstanceIdentityWindowsPowershellPath
+		if powershellPath == "" {
+			powershellPath = defaultWindowsPowershellPath
+		}
+		credHandlers = append(credHandlers, containerstore.NewWindowsCertStoreHandler(gardenClient, powershellPath))
+	}
+
+	var revocationList *revocation.List
+	if config.InstanceIdentityCRLPath != "" {
+		revocationList, err = revocationListFromConfig(logger, config, clock)
+		if err != nil {
+			return nil, nil, grouper.Members{}, err
+		}
+		credHandlers = append(credHandlers, containerstore.NewRevocationHandler(revocationList))
+	}
+
+	credManager, credManagerMembers, err := CredManagerFromConfig(logger, metronClient, config, clock, clockJumps, credHandlers...)
 	if err != nil {
 		return nil, nil, grouper.Members{}, err
 	}
@@ -332,8 +684,32 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 		config.EnableUnproxiedPortMappings,
 		config.AdvertisePreferenceForInstanceAddress,
 		json.Marshal,
+		config.GPUDevices,
 	)
 
+	if config.ContainerCheckpointPath != "" {
+		checkpoint, err := containerstore.ReadCheckpoint(config.ContainerCheckpointPath)
+		if err != nil {
+			// recovering from an empty checkpoint would destroy every
+			// container, so the executor does not start without it
+			logger.Error("failed-to-read-container-checkpoint", err, lager.Data{"path": config.ContainerCheckpointPath})
+			return nil, nil, grouper.Members{}, err
+		}
+		err = containerStore.Recover(logger, "", checkpoint)
+		if err != nil {
+			return nil, nil, grouper.Members{}, err
+		}
+	}
+
+	// prefetching is disabled unless an interval is configured
+	var artifactPrefetcher *prefetch.Prefetcher
+	var depotPrefetcher depot.ArtifactPrefetcher
+	if config.ArtifactPrefetchInterval > 0 {
+		artifactPrefetcher = prefetch.New(logger, clock, cachedDownloader, downloadRateLimiter, time.Duration(config.ArtifactPrefetchInterval))
+		depotPrefetcher = artifactPrefetcher
+	}
+
+	scheduledTaskResults := scheduler.NewResults()
 	depotClient := depot.NewClient(
 		totalCapacity,
 		containerStore,
@@ -344,8 +720,21 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 		deletionWorkPool,
 		readWorkPool,
 		metricsWorkPool,
+		featureFlags,
+		config.PlacementTags,
+		capabilities.Detect(logger, "/"),
+		scheduledTaskResults,
+		depot.NewStartRateLimiter(clock, config.MaxContainerStartsPerAppPerMinute),
+		depotPrefetcher,
+		drain.New(clock, containerStore, hub, config.DrainStopOrder),
+		config.ContainerTemplates,
 	)
 
+	taskScheduler, err := scheduler.New(logger, clock, depotClient, guidgen.DefaultGenerator, scheduledTaskResults, config.ScheduledTasks)
+	if err != nil {
+		return nil, nil, grouper.Members{}, err
+	}
+
 	healthcheckSpec := garden.ProcessSpec{
 		Path: config.GardenHealthcheckProcessPath,
 		Args: config.GardenHealthcheckProcessArgs,
@@ -363,6 +752,11 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 		guidgen.DefaultGenerator,
 	)
 
+	capacityReporter, err := metricsReporter(logger, config, zone, depotClient, metronClient, clock, clockJumps, capacityChanges)
+	if err != nil {
+		return nil, nil, grouper.Members{}, err
+	}
+
 	metricsCache := &atomic.Value{}
 	containerStatsReporter := containermetrics.NewStatsReporter(
 		metronClient,
@@ -371,43 +765,291 @@ func Initialize(logger lager.Logger, config ExecutorConfig, cellID, zone string,
 		metricsCache,
 	)
 	cpuSpikeReporter := containermetrics.NewCPUSpikeReporter(metronClient)
+	containerMetricsReporters := []containermetrics.MetricsReporter{containerStatsReporter, cpuSpikeReporter}
+
+	if config.EnableContainerProxy && config.ContainerProxyStatsEnabled {
+		containerMetricsReporters = append(containerMetricsReporters, containermetrics.NewProxyStatsReporter(
+			metronClient,
+			containerstore.ProxyStatsPort,
+			proxyStatsScrapeTimeout,
+		))
+	}
+
+	if config.CPUBurstFactor > 1 {
+		if config.CPUBurstCgroupRoot == "" {
+			return nil, nil, grouper.Members{}, errors.New("cpu_burst_cgroup_root is required to burst CPU shares")
+		}
+		cpuBurstWindow := time.Duration(config.CPUBurstWindow)
+		if cpuBurstWindow <= 0 {
+			cpuBurstWindow = defaultCPUBurstWindow
+		}
+		containerMetricsReporters = append(containerMetricsReporters, containermetrics.NewCPUBurstPolicy(
+			metronClient,
+			containermetrics.NewCgroupCPUSharesSetter(config.CPUBurstCgroupRoot),
+			config.ContainerMaxCpuShares,
+			cpuBurstWindow,
+			config.CPUBurstFactor,
+		))
+	}
+
+	if config.ConnectionAccountingCgroupRoot != "" {
+		containerMetricsReporters = append(containerMetricsReporters, containermetrics.NewConnectionPolicy(
+			metronClient,
+			containermetrics.NewNetnsConnectionTracker(config.ConnectionAccountingCgroupRoot, "/proc"),
+			depotClient,
+			cellID,
+			config.ContainerMaxOpenConnections,
+			config.ContainerMaxNewConnectionsPerMinute,
+			config.ConnectionCeilingsEnforced,
+		))
+	}
 
 	reportersRunner := containermetrics.NewReportersRunner(
 		logger,
 		time.Duration(config.ContainerMetricsReportInterval),
 		clock,
 		depotClient,
-		containerStatsReporter,
-		cpuSpikeReporter,
+		containerMetricsReporters...,
 	)
 
-	return depotClient, containerStatsReporter,
-		grouper.Members{
-			{Name: "volman-driver-syncer", Runner: volmanDriverSyncer},
-			{Name: "metrics-reporter", Runner: &metrics.Reporter{
-				ExecutorSource: depotClient,
-				Interval:       metricsReportInterval,
-				Clock:          clock,
-				Logger:         logger,
-				MetronClient:   metronClient,
-				Tags:           map[string]string{"zone": zone},
-			}},
-			{Name: "hub-closer", Runner: closeHub(logger, hub)},
-			{Name: "container-metrics-reporter", Runner: reportersRunner},
-			{Name: "garden_health_checker", Runner: gardenhealth.NewRunner(
-				time.Duration(config.GardenHealthcheckInterval),
-				time.Duration(config.GardenHealthcheckEmissionInterval),
-				time.Duration(config.GardenHealthcheckTimeout),
-				logger,
-				gardenHealthcheck,
-				depotClient,
-				metronClient,
-				clock,
-			)},
-			{Name: "registry-pruner", Runner: containerStore.NewRegistryPruner(logger)},
-			{Name: "container-reaper", Runner: containerStore.NewContainerReaper(logger)},
-		},
-		nil
+	callbackNotifier, err := completionCallbackNotifier(logger, config, hub, certsRetriever, clock)
+	if err != nil {
+		return nil, nil, grouper.Members{}, err
+	}
+
+	members := grouper.Members{
+		{Name: "volman-driver-syncer", Runner: volmanDriverSyncer},
+		{Name: "metrics-reporter", Runner: capacityReporter},
+		{Name: "hub-closer", Runner: closeHub(logger, hub)},
+		{Name: "completion-callbacks", Runner: callbackNotifier},
+		{Name: "container-metrics-reporter", Runner: reportersRunner},
+		{Name: "garden_health_checker", Runner: gardenhealth.NewRunner(
+			time.Duration(config.GardenHealthcheckInterval),
+			time.Duration(config.GardenHealthcheckEmissionInterval),
+			time.Duration(config.GardenHealthcheckTimeout),
+			logger,
+			gardenHealthcheck,
+			depotClient,
+			metronClient,
+			clock,
+			clockJumps,
+		)},
+		{Name: "registry-pruner", Runner: containerStore.NewRegistryPruner(logger)},
+		{Name: "container-reaper", Runner: containerStore.NewContainerReaper(logger)},
+	}
+	if config.ContainerCheckpointPath != "" {
+		checkpointInterval := time.Duration(config.ContainerCheckpointInterval)
+		if checkpointInterval <= 0 {
+			checkpointInterval = defaultCheckpointInterval
+		}
+		members = append(members, grouper.Member{Name: "container-checkpointer", Runner: containerStore.NewCheckpointer(logger, config.ContainerCheckpointPath, checkpointInterval)})
+	}
+	if len(config.ScheduledTasks) > 0 {
+		members = append(members, grouper.Member{Name: "scheduler", Runner: taskScheduler})
+	}
+	if artifactPrefetcher != nil {
+		members = append(members, grouper.Member{Name: "artifact-prefetcher", Runner: artifactPrefetcher})
+	}
+	if config.SyntheticProbeInterval > 0 {
+		syntheticProbeTimeout := time.Duration(config.SyntheticProbeTimeout)
+		if syntheticProbeTimeout <= 0 {
+			syntheticProbeTimeout = defaultSyntheticProbeTimeout
+		}
+		members = append(members, grouper.Member{Name: "synthetic-probe", Runner: probe.New(
+			logger,
+			clock,
+			depotClient,
+			guidgen.DefaultGenerator,
+			metronClient,
+			time.Duration(config.SyntheticProbeInterval),
+			syntheticProbeTimeout,
+			gardenHealthcheckRootFS,
+			&models.RunAction{
+				Path: config.GardenHealthcheckProcessPath,
+				Args: config.GardenHealthcheckProcessArgs,
+				User: config.GardenHealthcheckProcessUser,
+				Dir:  config.GardenHealthcheckProcessDir,
+			},
+		)})
+	}
+	if len(config.LifecycleWebhooks) > 0 {
+		webhookNotifier, err := lifecycleWebhookNotifier(logger, config, hub, clock, cellID)
+		if err != nil {
+			return nil, nil, grouper.Members{}, err
+		}
+		members = append(members, grouper.Member{Name: "lifecycle-webhooks", Runner: webhookNotifier})
+	}
+	if config.MetricsHealthListenAddress != "" {
+		members = append(members, grouper.Member{
+			Name:   "metrics-reporter-health",
+			Runner: http_server.New(config.MetricsHealthListenAddress, capacityReporter.HealthHandler()),
+		})
+	}
+	if config.EgressResolveInterval > 0 {
+		members = append(members, grouper.Member{Name: "egress-resolver", Runner: containerStore.NewEgressResolver(logger, net.LookupIP)})
+	}
+	if config.PropertySyncInterval > 0 {
+		members = append(members, grouper.Member{Name: "property-syncer", Runner: containerStore.NewPropertySyncer(logger)})
+	}
+	if revocationList != nil {
+		members = append(members, grouper.Member{Name: "instance-identity-crl", Runner: revocationList})
+		if config.InstanceIdentityOCSPListenAddress != "" {
+			members = append(members, grouper.Member{
+				Name:   "instance-identity-ocsp",
+				Runner: http_server.New(config.InstanceIdentityOCSPListenAddress, revocationList.OCSPHandler()),
+			})
+		}
+	}
+	if config.AdminListenAddress != "" {
+		recorder := supportbundle.NewRecorder(logger, depotClient, clock, supportBundleEvents, supportBundleContainers)
+		bundler := supportbundle.NewBundler(depotClient, recorder, clock, config, config.CachePath, config.MaxCacheSizeInBytes)
+		server, err := adminServer(logger, config, depotClient, supportbundle.Handler(logger, bundler), logLevels, featureFlags)
+		if err != nil {
+			return nil, nil, grouper.Members{}, err
+		}
+		members = append(members,
+			grouper.Member{Name: "support-bundle-recorder", Runner: recorder},
+			grouper.Member{Name: "admin-server", Runner: server},
+		)
+	}
+	members = append(members, credManagerMembers...)
+	if clockJumps != nil {
+		members = append(grouper.Members{{Name: "clock-skew-detector", Runner: clockJumps}}, members...)
+	}
+
+	return depotClient, containerStatsReporter, members, nil
+}
+
+// metricsReporter sends the capacity metrics of the cell to the configured
+// exporters, metron unless configured otherwise.
+func metricsReporter(
+	logger lager.Logger,
+	config ExecutorConfig,
+	zone string,
+	depotClient executor.Client,
+	metronClient loggingclient.IngressClient,
+	clock clock.Clock,
+	clockJumps *clockskew.Detector,
+	capacityChanges *containerstore.CapacityNotifier,
+) (*metrics.Reporter, error) {
+	reporter := &metrics.Reporter{
+		ExecutorSource: depotClient,
+		Interval:       metricsReportInterval,
+		Clock:          clock,
+		Logger:         logger,
+		Tags:           map[string]string{"zone": zone},
+		ClockJumps:     clockJumps,
+		Reserved:       executor.ExecutorResources{MemoryMB: config.ReservedMemoryMB, DiskMB: config.ReservedDiskMB},
+
+		PerContainer:      config.PerContainerMetrics,
+		PerContainerLimit: config.PerContainerMetricsLimit,
+
+		Prefix:         config.MetricNamePrefix,
+		AllowedMetrics: config.MetricsAllowlist,
+		DeniedMetrics:  config.MetricsDenylist,
+
+		CapacityChanges: capacityChanges,
+		StaleAfter:      time.Duration(config.MetricsStaleAfter),
+	}
+
+	if config.CapacityForecastWindow > 0 {
+		reporter.Forecaster = metrics.NewCapacityForecaster(time.Duration(config.CapacityForecastWindow))
+	}
+
+	gpuUtilizationCommand, err := shlex.Split(config.GPUUtilizationCommand)
+	if err != nil {
+		logger.Error("failed-to-parse-gpu-utilization-command", err)
+		return nil, err
+	}
+	if len(gpuUtilizationCommand) > 0 {
+		reporter.GPUMonitor = metrics.NewCommandGPUMonitor(gpuUtilizationCommand)
+	}
+
+	exporters := config.MetricsExporters
+	if len(exporters) == 0 {
+		exporters = []string{metrics.ExporterMetron}
+	}
+
+	for _, exporter := range exporters {
+		switch exporter {
+		case metrics.ExporterMetron:
+			reporter.MetronClient = metronClient
+		case metrics.ExporterOTLP:
+			var tlsConfig *tls.Config
+			if config.OTLPMetricsCACertPath != "" {
+				options := []tlsconfig.TLSOption{tlsconfig.WithInternalServiceDefaults()}
+				if config.OTLPMetricsCertPath != "" {
+					options = append(options, tlsconfig.WithIdentityFromFile(config.OTLPMetricsCertPath, config.OTLPMetricsKeyPath))
+				}
+				var err error
+				tlsConfig, err = tlsconfig.Build(options...).Client(
+					tlsconfig.WithAuthorityFromFile(config.OTLPMetricsCACertPath),
+				)
+				if err != nil {
+					logger.Error("failed-to-configure-otlp-tls", err)
+					return nil, err
+				}
+			}
+
+			otlpExporter, err := metrics.NewOTLPExporter(config.OTLPMetricsEndpoint, tlsConfig, otlpExportTimeout)
+			if err != nil {
+				logger.Error("failed-to-create-otlp-exporter", err)
+				return nil, err
+			}
+			reporter.Exporter = otlpExporter
+		default:
+			err := fmt.Errorf("unknown metrics exporter %q", exporter)
+			logger.Error("invalid-metrics-exporter", err)
+			return nil, err
+		}
+	}
+
+	return reporter, nil
+}
+
+// adminServer serves support bundles, runtime diagnostics, log level,
+// feature flag and capacity control, runs processes in containers and copies
+// files from and to them, all over mTLS and only to the operator identities;
+// it refuses to start without a certificate and a CA to verify the clients
+// with.
+func adminServer(logger lager.Logger, config ExecutorConfig, client executor.Client, bundles http.Handler, logLevels *loglevel.Controller, featureFlags *featureflags.Flags) (ifrit.Runner, error) {
+	if config.AdminCertPath == "" || config.AdminKeyPath == "" || config.AdminCACertPath == "" {
+		return nil, errors.New("admin_cert_path, admin_key_path and admin_ca_cert_path are required when admin_listen_address is set")
+	}
+	if len(config.AdminOperatorIdentities) == 0 {
+		return nil, errors.New("admin_operator_identities are required when admin_listen_address is set")
+	}
+
+	tlsConfig, err := tlsconfig.Build(
+		tlsconfig.WithInternalServiceDefaults(),
+		tlsconfig.WithIdentityFromFile(config.AdminCertPath, config.AdminKeyPath),
+	).Server(
+		tlsconfig.WithClientAuthenticationFromFile(config.AdminCACertPath),
+	)
+	if err != nil {
+		logger.Error("failed-to-configure-admin-tls", err)
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", diagnostics.RequireOperator(logger, config.AdminOperatorIdentities, bundles))
+	mux.Handle("/debug/", diagnostics.Handler(logger, config.AdminOperatorIdentities, logLevels))
+	flagsHandler := diagnostics.RequireOperator(logger, config.AdminOperatorIdentities, http.StripPrefix("/feature-flags", featureflags.Handler(logger, featureFlags)))
+	mux.Handle("/feature-flags", flagsHandler)
+	mux.Handle("/feature-flags/", flagsHandler)
+	capacityHandler := diagnostics.RequireOperator(logger, config.AdminOperatorIdentities, http.StripPrefix("/capacity", capacity.Handler(logger, client)))
+	mux.Handle("/capacity", capacityHandler)
+	mux.Handle("/capacity/", capacityHandler)
+	mux.Handle("/exec/", diagnostics.RequireOperator(logger, config.AdminOperatorIdentities, containerexec.Handler(logger, client)))
+	if len(config.FileCopyAllowedPaths) > 0 {
+		maxBytes := config.FileCopyMaxBytes
+		if maxBytes <= 0 {
+			maxBytes = defaultFileCopyMaxBytes
+		}
+		files := filecopy.Handler(logger, client, config.FileCopyAllowedPaths, maxBytes)
+		mux.Handle("/files/", diagnostics.RequireOperator(logger, config.AdminOperatorIdentities, files))
+	}
+	return http_server.NewTLSServer(config.AdminListenAddress, mux, tlsConfig), nil
 }
 
 // Until we get a successful response from garden,
@@ -459,19 +1101,58 @@ func waitForGarden(logger lager.Logger, gardenClient GardenClient.Client, metron
 }
 
 func fetchCapacity(logger lager.Logger, gardenClient GardenClient.Client, config ExecutorConfig) (executor.ExecutorResources, error) {
-	capacity, err := configuration.ConfigureCapacity(gardenClient, config.MemoryMB, config.DiskMB, config.MaxCacheSizeInBytes, config.AutoDiskOverheadMB, config.UseSchedulableDiskSize)
+	// the image cache shares the disk of the cell with the download cache
+	cacheSizeInBytes := config.MaxCacheSizeInBytes + imageCacheMaxSizeInBytes(config)
+	capacity, err := configuration.ConfigureCapacity(gardenClient, config.MemoryMB, config.DiskMB, cacheSizeInBytes, config.AutoDiskOverheadMB, config.UseSchedulableDiskSize)
 	if err != nil {
 		logger.Error("failed-to-configure-capacity", err)
 		return executor.ExecutorResources{}, err
 	}
 
+	capacity, err = configuration.ReserveCapacity(capacity, config.ReservedMemoryMB, config.ReservedDiskMB)
+	if err != nil {
+		logger.Error("failed-to-reserve-capacity", err)
+		return executor.ExecutorResources{}, err
+	}
+
 	logger.Info("initial-capacity", lager.Data{
-		"capacity": capacity,
+		"capacity":           capacity,
+		"reserved-memory-mb": config.ReservedMemoryMB,
+		"reserved-disk-mb":   config.ReservedDiskMB,
 	})
 
 	return capacity, nil
 }
 
+// imageCacheMaxSizeInBytes is the size of the image cache, or 0 when images
+// are not pulled into the cache.
+func imageCacheMaxSizeInBytes(config ExecutorConfig) uint64 {
+	if config.ImageCacheDir == "" {
+		return 0
+	}
+	if config.ImageCacheMaxSizeInBytes == 0 {
+		return defaultImageCacheMaxSizeInBytes
+	}
+	return config.ImageCacheMaxSizeInBytes
+}
+
+// gpuTypes counts the GPU devices of each type, ignoring the types of devices
+// that are not configured.
+func gpuTypes(devices []string, types map[string]string) map[string]int {
+	var counts map[string]int
+	for _, device := range devices {
+		gpuType, ok := types[device]
+		if !ok {
+			continue
+		}
+		if counts == nil {
+			counts = make(map[string]int)
+		}
+		counts[gpuType]++
+	}
+	return counts
+}
+
 func destroyContainers(gardenClient garden.Client, containersFetcher *executorContainers, logger lager.Logger) error {
 	logger.Info("executor-fetching-containers-to-destroy")
 	containers, err := containersFetcher.Containers()
@@ -534,6 +1215,45 @@ func setupWorkDir(logger lager.Logger, tempDir string) string {
 	return workDir
 }
 
+// assetQuarantineFromConfig scans downloaded artifacts with the scanner
+// command or endpoint of the operator, if any, in a directory of the work dir.
+func assetQuarantineFromConfig(logger lager.Logger, config ExecutorConfig, workDir string, tlsConfig *tls.Config) (*quarantine.Quarantine, error) {
+	timeout := time.Duration(config.AssetScannerTimeout)
+	if timeout <= 0 {
+		timeout = defaultAssetScannerTimeout
+	}
+
+	var scanner quarantine.Scanner
+	switch {
+	case config.AssetScannerPath != "":
+		scanner = quarantine.NewCommandScanner(config.AssetScannerPath, config.AssetScannerArgs, timeout)
+	case config.AssetScannerURL != "":
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		scanner = quarantine.NewHTTPScanner(client, config.AssetScannerURL, timeout)
+	default:
+		return nil, nil
+	}
+
+	policy := quarantine.FailurePolicy(config.AssetScannerFailurePolicy)
+	if policy == "" {
+		policy = quarantine.FailClosed
+	}
+
+	dir := filepath.Join(workDir, "quarantine")
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		logger.Error("failed-to-create-quarantine-dir", err)
+		return nil, err
+	}
+
+	assetQuarantine, err := quarantine.New(dir, scanner, policy)
+	if err != nil {
+		logger.Error("invalid-asset-scanner-failure-policy", err)
+		return nil, err
+	}
+	return assetQuarantine, nil
+}
+
 func initializeTransformer(
 	cache cacheddownloader.CachedDownloader,
 	workDir string,
@@ -551,6 +1271,13 @@ func initializeTransformer(
 	declarativeHealthcheckRootFS string,
 	enableContainerProxy bool,
 	drainWait time.Duration,
+	processWatchdogInterval time.Duration,
+	defaultStartTimeout time.Duration,
+	readinessFailurePolicy steps.ReadinessFailurePolicy,
+	enableHealthCheckLogSources bool,
+	livenessFailureBudget steps.LivenessFailureBudget,
+	startupProgressInterval time.Duration,
+	assetQuarantine *quarantine.Quarantine,
 ) transformer.Transformer {
 	var options []transformer.Option
 	compressor := compressor.NewTgz()
@@ -566,6 +1293,19 @@ func initializeTransformer(
 	}
 
 	options = append(options, transformer.WithPostSetupHook(postSetupUser, postSetupHook))
+	options = append(options, transformer.WithProcessWatchdog(processWatchdogInterval))
+	options = append(options, transformer.WithReadinessPolicy(defaultStartTimeout, readinessFailurePolicy))
+
+	if enableHealthCheckLogSources {
+		options = append(options, transformer.WithHealthCheckLogSources(steps.DefaultHealthCheckLogSources))
+	}
+
+	options = append(options, transformer.WithLivenessFailureBudget(livenessFailureBudget))
+	options = append(options, transformer.WithStartupProgressInterval(startupProgressInterval))
+
+	if assetQuarantine != nil {
+		options = append(options, transformer.WithQuarantine(assetQuarantine))
+	}
 
 	return transformer.NewTransformer(
 		clock,
@@ -646,53 +1386,382 @@ func TLSConfigFromConfig(logger lager.Logger, certsRetriever CertPoolRetriever,
 	return tlsConfig, nil
 }
 
-func CredManagerFromConfig(logger lager.Logger, metronClient loggingclient.IngressClient, config ExecutorConfig, clock clock.Clock, handlers ...containerstore.CredentialHandler) (containerstore.CredManager, error) {
+// CredManagerFromConfig returns the credential manager of the cell, and the
+// members that must run alongside it.
+func CredManagerFromConfig(logger lager.Logger, metronClient loggingclient.IngressClient, config ExecutorConfig, clock clock.Clock, clockJumps *clockskew.Detector, handlers ...containerstore.CredentialHandler) (containerstore.CredManager, grouper.Members, error) {
 	if config.InstanceIdentityCredDir != "" {
 		logger.Info("instance-identity-enabled")
-		keyData, err := ioutil.ReadFile(config.InstanceIdentityPrivateKeyPath)
+		var members grouper.Members
+		externalSigner := config.InstanceIdentitySigner != "" && config.InstanceIdentitySigner != containerstore.SignerTypeLocal
+
+		cas, err := instanceIdentityCAsFromConfig(config)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		if config.InstanceIdentityValidityPeriod <= 0 {
+			return nil, nil, errors.New("instance ID validity period needs to be set and positive")
 		}
-		keyBlock, _ := pem.Decode(keyData)
-		if keyBlock == nil {
-			return nil, errors.New("instance ID key is not PEM-encoded")
+
+		if config.InstanceIdentityRotationFraction < 0 || config.InstanceIdentityRotationFraction >= 1 {
+			return nil, nil, errors.New("instance ID rotation fraction needs to be between 0 and 1")
+		}
+
+		sanAllowlist, err := containerstore.NewSANAllowlist(config.InstanceIdentitySANAllowedDNSNames, config.InstanceIdentitySANAllowedNetworks)
+		if err != nil {
+			return nil, nil, err
 		}
-		privateKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+
+		keyGenerator, err := containerstore.NewKeyGenerator(config.InstanceIdentityKeyAlgorithm)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch config.InstanceIdentityKeyFormat {
+		case containerstore.KeyFormatDefault:
+		case containerstore.KeyFormatPKCS8:
+			keyGenerator = containerstore.NewPKCS8KeyGenerator(keyGenerator)
+		default:
+			return nil, nil, fmt.Errorf("unsupported instance ID key format: %s", config.InstanceIdentityKeyFormat)
+		}
+
+		if config.InstanceIdentityKeyPoolSize > 0 {
+			workers := config.InstanceIdentityKeyPoolWorkers
+			if workers < 1 {
+				workers = 1
+			}
+			keyPoolWorkPool, err := workpool.NewWorkPool(workers)
+			if err != nil {
+				return nil, nil, err
+			}
+			logger.Info("instance-identity-key-pool-enabled", lager.Data{
+				"size":    config.InstanceIdentityKeyPoolSize,
+				"workers": workers,
+			})
+			keyPool := containerstore.NewKeyPool(logger, metronClient, clock, keyGenerator, rand.Reader, keyPoolWorkPool, config.InstanceIdentityKeyPoolSize)
+			members = append(members, grouper.Member{Name: "instance-identity-key-pool", Runner: keyPool})
+			keyGenerator = keyPool
+		}
+
+		var localSigner containerstore.CertificateSigner
+		if signingCA, err := containerstore.SigningCA(cas); err == nil {
+			logger.Info("instance-identity-signing-ca", lager.Data{"subject": signingCA.Cert.Subject.String(), "trusted-cas": len(cas)})
+			localSigner = containerstore.NewLocalSigner(rand.Reader, signingCA.Cert, signingCA.Key, containerstore.TrustBundle(cas))
+			if config.InstanceIdentityCRLPath != "" {
+				// the CRL and the OCSP responder of the cell only cover the
+				// certificates signed by its signing CA
+				localSigner = containerstore.NewRevocationEndpointsSigner(localSigner, config.InstanceIdentityCRLURL, config.InstanceIdentityOCSPURL)
+			}
+		}
+
+		signer := localSigner
+		if externalSigner {
+			signer, err = externalSignerFromConfig(logger, config, clock, localSigner)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		options := containerstore.CredManagerOptions{
+			Logger:         logger,
+			MetronClient:   metronClient,
+			ValidityPeriod: time.Duration(config.InstanceIdentityValidityPeriod),
+			EntropyReader:  rand.Reader,
+			Clock:          clock,
+			KeyGenerator:   keyGenerator,
+			TrustDomain:    config.InstanceIdentitySPIFFETrustDomain,
+			SANAllowlist:   sanAllowlist,
+			Rotation: containerstore.RotationConfig{
+				Fraction:      config.InstanceIdentityRotationFraction,
+				Jitter:        time.Duration(config.InstanceIdentityRotationJitter),
+				RetryAttempts: config.InstanceIdentityRotationRetryAttempts,
+				RetryBackoff:  time.Duration(config.InstanceIdentityRotationRetryBackoff),
+				MinValidity:   time.Duration(config.InstanceIdentityRotationMinValidity),
+			},
+			ClockJumps: clockJumps,
+			Handlers:   handlers,
+		}
+		return containerstore.NewCredManagerWithSigner(options, containerstore.TrustBundle(cas), signer), members, nil
+	}
+
+	logger.Info("instance-identity-disabled")
+	return containerstore.NewNoopCredManager(), nil, nil
+}
+
+func instanceIdentityCAsFromConfig(config ExecutorConfig) ([]containerstore.CA, error) {
+	externalSigner := config.InstanceIdentitySigner != "" && config.InstanceIdentitySigner != containerstore.SignerTypeLocal
+
+	var privateKey crypto.Signer
+	if !externalSigner || config.InstanceIdentityPrivateKeyPath != "" {
+		var err error
+		privateKey, err = loadInstanceIdentityKey(config.InstanceIdentityPrivateKeyPath)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	caCert, err := loadInstanceIdentityCACert(config.InstanceIdentityCAPath)
+	if err != nil {
+		return nil, err
+	}
+	cas := []containerstore.CA{{Cert: caCert, Key: privateKey}}
+
+	for _, additionalCA := range config.InstanceIdentityCAs {
+		ca := containerstore.CA{}
+		ca.Cert, err = loadInstanceIdentityCACert(additionalCA.CAPath)
+		if err != nil {
+			return nil, err
+		}
+		if additionalCA.PrivateKeyPath != "" {
+			ca.Key, err = loadInstanceIdentityKey(additionalCA.PrivateKeyPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cas = append(cas, ca)
+	}
+
+	return cas, nil
+}
 
-		certData, err := ioutil.ReadFile(config.InstanceIdentityCAPath)
+func revocationListFromConfig(logger lager.Logger, config ExecutorConfig, clock clock.Clock) (*revocation.List, error) {
+	if config.InstanceIdentityCredDir == "" {
+		return nil, errors.New("instance ID CRL requires instance identity to be enabled")
+	}
+
+	cas, err := instanceIdentityCAsFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	signingCA, err := containerstore.SigningCA(cas)
+	if err != nil {
+		return nil, errors.New("instance ID CRL requires a CA private key")
+	}
+
+	validity := time.Duration(config.InstanceIdentityCRLValidity)
+	if validity <= 0 {
+		validity = time.Duration(config.InstanceIdentityValidityPeriod)
+	}
+	if validity <= 0 {
+		return nil, errors.New("instance ID CRL validity needs to be positive")
+	}
+
+	if config.InstanceIdentityCRLURL == "" {
+		return nil, errors.New("instance ID CRL requires the URL the CRL is served at")
+	}
+	if config.InstanceIdentityOCSPListenAddress != "" && config.InstanceIdentityOCSPURL == "" {
+		return nil, errors.New("instance ID OCSP responder requires the URL it is reachable at")
+	}
+
+	return revocation.NewList(logger, clock, signingCA.Cert, signingCA.Key, config.InstanceIdentityCRLPath, validity)
+}
+
+// completionCallbackNotifier posts the results of the containers to their
+// callback URLs, which are chosen by the tenants. The callbacks are only
+// called on the hosts allowed by the operator, without the identity of the
+// cell and without following redirects.
+func completionCallbackNotifier(logger lager.Logger, config ExecutorConfig, hub event.Hub, certsRetriever CertPoolRetriever, clock clock.Clock) (*callbacks.Notifier, error) {
+	maxAttempts := config.CompletionCallbackMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = completionCallbackMaxAttempts
+	}
+	retryDelay := time.Duration(config.CompletionCallbackRetryDelay)
+	if retryDelay <= 0 {
+		retryDelay = completionCallbackRetryDelay
+	}
+
+	caCertPool, err := certsRetriever.SystemCerts()
+	if err != nil {
+		logger.Error("failed-to-load-completion-callback-cas", err)
+		return nil, err
+	}
+	if config.PathToCACertsForDownloads != "" {
+		caCertPool, err = appendCACerts(caCertPool, config.PathToCACertsForDownloads)
 		if err != nil {
+			logger.Error("failed-to-load-completion-callback-cas", err)
 			return nil, err
 		}
-		certBlock, _ := pem.Decode(certData)
-		if certBlock == nil {
-			return nil, errors.New("instance ID CA is not PEM-encoded")
+	}
+
+	httpClient := &http.Client{
+		Timeout: completionCallbackTimeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig: &tls.Config{
+				RootCAs:    caCertPool,
+				MinVersion: tls.VersionTLS12,
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return callbacks.NewNotifier(logger, hub, httpClient, clock, maxAttempts, retryDelay, config.CompletionCallbackAllowedHosts), nil
+}
+
+// lifecycleWebhookNotifier posts the lifecycle events of the containers to
+// the webhooks of the operator, retrying like the completion callbacks. The
+// webhooks are called over mTLS when a CA certificate is configured.
+func lifecycleWebhookNotifier(logger lager.Logger, config ExecutorConfig, hub event.Hub, clock clock.Clock, cellID string) (*callbacks.WebhookNotifier, error) {
+	maxAttempts := config.CompletionCallbackMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = completionCallbackMaxAttempts
+	}
+	retryDelay := time.Duration(config.CompletionCallbackRetryDelay)
+	if retryDelay <= 0 {
+		retryDelay = completionCallbackRetryDelay
+	}
+
+	var tlsConfig *tls.Config
+	if config.LifecycleWebhookCACertPath != "" {
+		options := []tlsconfig.TLSOption{tlsconfig.WithInternalServiceDefaults()}
+		if config.LifecycleWebhookCertPath != "" {
+			options = append(options, tlsconfig.WithIdentityFromFile(config.LifecycleWebhookCertPath, config.LifecycleWebhookKeyPath))
 		}
-		certs, err := x509.ParseCertificates(certBlock.Bytes)
+		var err error
+		tlsConfig, err = tlsconfig.Build(options...).Client(
+			tlsconfig.WithAuthorityFromFile(config.LifecycleWebhookCACertPath),
+		)
 		if err != nil {
+			logger.Error("failed-to-configure-lifecycle-webhook-tls", err)
 			return nil, err
 		}
+	}
 
-		if config.InstanceIdentityValidityPeriod <= 0 {
-			return nil, errors.New("instance ID validity period needs to be set and positive")
+	httpClient := &http.Client{
+		Timeout: completionCallbackTimeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		},
+	}
+
+	notifier, err := callbacks.NewWebhookNotifier(logger, hub, httpClient, clock, maxAttempts, retryDelay, cellID, config.LifecycleWebhooks)
+	if err != nil {
+		logger.Error("invalid-lifecycle-webhooks", err)
+		return nil, err
+	}
+	return notifier, nil
+}
+
+func workloadTokenHandlerFromConfig(logger lager.Logger, config ExecutorConfig, clock clock.Clock) (*containerstore.WorkloadTokenHandler, error) {
+	keyData, err := ioutil.ReadFile(config.InstanceIdentityTokenSigningKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(keyData)
+	if keyBlock == nil {
+		return nil, errors.New("instance ID token signing key is not PEM-encoded")
+	}
+	signingKey, err := containerstore.ParsePrivateKey(keyBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	mountPath := config.InstanceIdentityTokenMountPath
+	if mountPath == "" {
+		mountPath = "/etc/cf-instance-token"
+	}
+
+	ttl := time.Duration(config.InstanceIdentityTokenTTL)
+	if ttl <= 0 {
+		ttl = defaultInstanceIdentityTokenTTL
+	}
+
+	return containerstore.NewWorkloadTokenHandler(
+		logger,
+		clock,
+		config.InstanceIdentityCredDir,
+		mountPath,
+		signingKey,
+		config.InstanceIdentityTokenKeyID,
+		config.InstanceIdentityTokenIssuer,
+		config.InstanceIdentityTokenAudience,
+		ttl,
+	), nil
+}
+
+func externalSignerFromConfig(logger lager.Logger, config ExecutorConfig, clock clock.Clock, fallback containerstore.CertificateSigner) (containerstore.CertificateSigner, error) {
+	if config.InstanceIdentitySignerURL == "" {
+		return nil, errors.New("instance ID signer URL needs to be set for an external signer")
+	}
+
+	caCertPool, err := systemcertsRetriever{}.SystemCerts()
+	if err != nil {
+		return nil, err
+	}
+	if config.InstanceIdentitySignerCACertPath != "" {
+		caCertPool, err = appendCACerts(caCertPool, config.InstanceIdentitySignerCACertPath)
+		if err != nil {
+			return nil, err
 		}
+	}
+	httpClient := containerstore.NewSignerHTTPClient(30*time.Second, &tls.Config{
+		RootCAs:    caCertPool,
+		MinVersion: tls.VersionTLS12,
+	})
 
-		return containerstore.NewCredManager(
-			logger,
-			metronClient,
-			time.Duration(config.InstanceIdentityValidityPeriod),
+	var signer containerstore.CertificateSigner
+	switch config.InstanceIdentitySigner {
+	case containerstore.SignerTypeCFSSL:
+		signer = containerstore.NewCFSSLSigner(httpClient, rand.Reader, config.InstanceIdentitySignerURL, config.InstanceIdentitySignerCFSSLProfile)
+	case containerstore.SignerTypeVault:
+		signer = containerstore.NewVaultSigner(
+			httpClient,
 			rand.Reader,
-			clock,
-			certs[0],
-			privateKey,
-			handlers...,
-		), nil
+			config.InstanceIdentitySignerURL,
+			config.InstanceIdentitySignerVaultMount,
+			config.InstanceIdentitySignerVaultRole,
+			config.InstanceIdentitySignerVaultToken,
+		)
+	default:
+		return nil, fmt.Errorf("unsupported instance ID signer: %s", config.InstanceIdentitySigner)
 	}
 
-	logger.Info("instance-identity-disabled")
-	return containerstore.NewNoopCredManager(), nil
+	logger.Info("instance-identity-external-signer", lager.Data{
+		"signer":       config.InstanceIdentitySigner,
+		"url":          config.InstanceIdentitySignerURL,
+		"has-fallback": fallback != nil,
+	})
+
+	return containerstore.NewRetryingSigner(
+		signer,
+		fallback,
+		clock,
+		config.InstanceIdentitySignerMaxAttempts,
+		time.Duration(config.InstanceIdentitySignerRetryDelay),
+	), nil
+}
+
+func loadInstanceIdentityKey(path string) (crypto.Signer, error) {
+	keyData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(keyData)
+	if keyBlock == nil {
+		return nil, errors.New("instance ID key is not PEM-encoded")
+	}
+	return containerstore.ParsePrivateKey(keyBlock)
+}
+
+func loadInstanceIdentityCACert(path string) (*x509.Certificate, error) {
+	certData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certBlock, _ := pem.Decode(certData)
+	if certBlock == nil {
+		return nil, errors.New("instance ID CA is not PEM-encoded")
+	}
+	certs, err := x509.ParseCertificates(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
 }
 
 func (config *ExecutorConfig) Validate(logger lager.Logger) bool {
@@ -733,6 +1802,18 @@ func (config *ExecutorConfig) Validate(logger lager.Logger) bool {
 		valid = false
 	}
 
+	switch steps.ReadinessFailurePolicy(config.ReadinessFailurePolicy) {
+	case "", steps.ReadinessFailurePolicyCrash, steps.ReadinessFailurePolicyKeepWaiting:
+	default:
+		logger.Error("readiness-failure-policy-invalid", nil, lager.Data{"policy": config.ReadinessFailurePolicy})
+		valid = false
+	}
+
+	if config.ContainerIPFamily != "" && !executor.IPFamily(config.ContainerIPFamily).Valid() {
+		logger.Error("container-ip-family-invalid", nil, lager.Data{"ip-family": config.ContainerIPFamily})
+		valid = false
+	}
+
 	return valid
 }
 
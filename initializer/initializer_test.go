@@ -31,6 +31,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
+	"github.com/tedsuo/ifrit/grouper"
 )
 
 var _ = Describe("Initializer", func() {
@@ -329,6 +330,20 @@ var _ = Describe("Initializer", func() {
 		})
 	})
 
+	Context("when the container checkpoint cannot be read", func() {
+		BeforeEach(func() {
+			config.ContainerCheckpointPath = filepath.Join(GinkgoT().TempDir(), "checkpoint.json")
+			Expect(os.WriteFile(config.ContainerCheckpointPath, []byte("{"), 0600)).To(Succeed())
+		})
+
+		It("fails instead of destroying the containers", func() {
+			Eventually(errCh).Should(Receive(MatchError("unexpected end of JSON input")))
+			Expect(fakeGarden.ReceivedRequests()).NotTo(ContainElement(WithTransform(func(r *http.Request) string {
+				return r.Method
+			}, Equal("DELETE"))))
+		})
+	})
+
 	Describe("with the TLS configuration", func() {
 		Context("when the TLS config is valid", func() {
 			BeforeEach(func() {
@@ -575,6 +590,7 @@ var _ = Describe("Initializer", func() {
 
 	Describe("CredManagerFromConfig", func() {
 		var credManager containerstore.CredManager
+		var credManagerMembers grouper.Members
 		var err error
 		var container executor.Container
 		var logger *lagertest.TestLogger
@@ -594,7 +610,7 @@ var _ = Describe("Initializer", func() {
 			}
 			fakeCredHandler := &containerstorefakes.FakeCredentialHandler{}
 			fakeCredHandler.CreateDirReturns(mounts, nil, nil)
-			credManager, err = initializer.CredManagerFromConfig(logger, fakeMetronClient, config, fakeClock, fakeCredHandler)
+			credManager, credManagerMembers, err = initializer.CredManagerFromConfig(logger, fakeMetronClient, config, fakeClock, nil, fakeCredHandler)
 		})
 
 		Describe("when instance identity creds directory is not set", func() {
@@ -693,6 +709,76 @@ var _ = Describe("Initializer", func() {
 					Eventually(err).Should(MatchError(ContainSubstring("instance ID validity period needs to be set and positive")))
 				})
 			})
+
+			Context("when the rotation fraction is out of range", func() {
+				BeforeEach(func() {
+					config.InstanceIdentityRotationFraction = 1.5
+				})
+
+				It("fails", func() {
+					Expect(err).To(MatchError("instance ID rotation fraction needs to be between 0 and 1"))
+				})
+			})
+
+			Context("when an external signer is configured", func() {
+				BeforeEach(func() {
+					config.InstanceIdentitySigner = "vault"
+					config.InstanceIdentitySignerURL = "https://vault.example.com"
+					config.InstanceIdentityPrivateKeyPath = ""
+				})
+
+				It("does not require the CA private key", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(credManager).NotTo(BeNil())
+				})
+
+				Context("when the signer URL is not set", func() {
+					BeforeEach(func() {
+						config.InstanceIdentitySignerURL = ""
+					})
+
+					It("fails", func() {
+						Expect(err).To(MatchError("instance ID signer URL needs to be set for an external signer"))
+					})
+				})
+
+				Context("when the signer is not supported", func() {
+					BeforeEach(func() {
+						config.InstanceIdentitySigner = "acme"
+					})
+
+					It("fails", func() {
+						Expect(err).To(MatchError("unsupported instance ID signer: acme"))
+					})
+				})
+			})
+
+			Context("when a key pool is configured", func() {
+				BeforeEach(func() {
+					config.InstanceIdentityKeyPoolSize = 2
+					config.InstanceIdentityKeyPoolWorkers = 0
+				})
+
+				It("creates the cred manager", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(credManager).NotTo(BeNil())
+				})
+
+				It("runs the key pool alongside the cred manager", func() {
+					Expect(credManagerMembers).To(HaveLen(1))
+					Expect(credManagerMembers[0].Name).To(Equal("instance-identity-key-pool"))
+				})
+			})
+
+			Context("when the key algorithm is not supported", func() {
+				BeforeEach(func() {
+					config.InstanceIdentityKeyAlgorithm = "dsa"
+				})
+
+				It("fails", func() {
+					Eventually(err).Should(MatchError("unsupported key algorithm: dsa"))
+				})
+			})
 		})
 	})
 })
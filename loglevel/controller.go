@@ -0,0 +1,82 @@
+package loglevel
+
+import (
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Controller holds the minimum log level of the executor, globally and per
+// logger session, and can change them at runtime. A session level applies
+// to every logger whose session name contains the session, e.g.
+// cred-manager-runner, and to its sub-sessions; the innermost session with
+// a level wins.
+//
+// Levels can only restrict what the sinks of the wrapped logger let through,
+// so verbose debugging requires those sinks to accept debug messages.
+type Controller struct {
+	lock     sync.RWMutex
+	global   lager.LogLevel
+	sessions map[string]lager.LogLevel
+}
+
+func NewController(global lager.LogLevel) *Controller {
+	return &Controller{
+		global:   global,
+		sessions: map[string]lager.LogLevel{},
+	}
+}
+
+// Levels returns the global level and the level of every session that has
+// one.
+func (c *Controller) Levels() (lager.LogLevel, map[string]lager.LogLevel) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	sessions := make(map[string]lager.LogLevel, len(c.sessions))
+	for session, level := range c.sessions {
+		sessions[session] = level
+	}
+	return c.global, sessions
+}
+
+func (c *Controller) SetGlobal(level lager.LogLevel) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.global = level
+}
+
+func (c *Controller) SetSession(session string, level lager.LogLevel) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sessions[session] = level
+}
+
+// ResetSession makes the session use the global level again.
+func (c *Controller) ResetSession(session string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.sessions, session)
+}
+
+// Enabled reports whether messages of the level are logged by the loggers of
+// the session name.
+func (c *Controller) Enabled(sessionName string, level lager.LogLevel) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	min := c.global
+	for _, session := range strings.Split(sessionName, ".") {
+		if l, ok := c.sessions[session]; ok {
+			min = l
+		}
+	}
+	return level >= min
+}
+
+// Logger wraps logger so that its messages, and those of its sessions, are
+// only logged when their level is enabled.
+func (c *Controller) Logger(logger lager.Logger) lager.Logger {
+	return &controlledLogger{Logger: logger, controller: c}
+}
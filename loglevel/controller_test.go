@@ -0,0 +1,78 @@
+package loglevel_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/executor/loglevel"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		controller *loglevel.Controller
+		testLogger *lagertest.TestLogger
+		logger     lager.Logger
+	)
+
+	BeforeEach(func() {
+		controller = loglevel.NewController(lager.INFO)
+		testLogger = lagertest.NewTestLogger("executor")
+		logger = controller.Logger(testLogger)
+	})
+
+	It("drops messages below the global level", func() {
+		logger.Debug("debug")
+		logger.Session("metrics-reporter").Debug("debug")
+		logger.Info("info")
+		logger.Error("error", errors.New("boom"))
+
+		Expect(testLogger.LogMessages()).To(Equal([]string{"executor.info", "executor.error"}))
+	})
+
+	It("changes the global level at runtime", func() {
+		session := logger.Session("metrics-reporter")
+		controller.SetGlobal(lager.ERROR)
+
+		session.Info("info")
+		session.Error("error", errors.New("boom"))
+
+		Expect(testLogger.LogMessages()).To(Equal([]string{"executor.metrics-reporter.error"}))
+	})
+
+	Context("when a session has a level", func() {
+		BeforeEach(func() {
+			controller.SetSession("cred-manager-runner", lager.DEBUG)
+		})
+
+		It("applies it to the session and its sub-sessions", func() {
+			session := logger.Session("container").Session("cred-manager-runner")
+			session.Debug("debug")
+			session.Session("rotate").WithData(lager.Data{"guid": "guid-1"}).Debug("debug")
+			logger.Session("metrics-reporter").Debug("debug")
+
+			Expect(testLogger.LogMessages()).To(Equal([]string{
+				"executor.container.cred-manager-runner.debug",
+				"executor.container.cred-manager-runner.rotate.debug",
+			}))
+		})
+
+		It("lets an inner session override it", func() {
+			controller.SetSession("rotate", lager.ERROR)
+
+			logger.Session("cred-manager-runner").Session("rotate").Info("info")
+
+			Expect(testLogger.LogMessages()).To(BeEmpty())
+		})
+
+		It("uses the global level again once reset", func() {
+			controller.ResetSession("cred-manager-runner")
+
+			logger.Session("cred-manager-runner").Debug("debug")
+
+			Expect(testLogger.LogMessages()).To(BeEmpty())
+		})
+	})
+})
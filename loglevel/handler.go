@@ -0,0 +1,72 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Levels is the JSON representation of the levels of a Controller.
+type Levels struct {
+	Global   string            `json:"global"`
+	Sessions map[string]string `json:"sessions"`
+}
+
+type levelRequest struct {
+	Level string `json:"level"`
+}
+
+// Handler reads and changes the levels of the controller, relative to the
+// path it is mounted on:
+//
+//	GET    /
+//	PUT    /           {"level": "debug"}
+//	PUT    /:session   {"level": "debug"}
+//	DELETE /:session
+func Handler(logger lager.Logger, controller *Controller) http.Handler {
+	logger = logger.Session("log-level-handler")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := strings.Trim(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodGet && session == "":
+		case r.Method == http.MethodPut:
+			var req levelRequest
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			level, err := lager.LogLevelFromString(req.Level)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if session == "" {
+				controller.SetGlobal(level)
+			} else {
+				controller.SetSession(session, level)
+			}
+			logger.Info("set-log-level", lager.Data{"session": session, "level": level.String()})
+		case r.Method == http.MethodDelete && session != "":
+			controller.ResetSession(session)
+			logger.Info("reset-log-level", lager.Data{"session": session})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		global, sessions := controller.Levels()
+		levels := Levels{Global: global.String(), Sessions: map[string]string{}}
+		for session, level := range sessions {
+			levels.Sessions[session] = level.String()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(levels)
+	})
+}
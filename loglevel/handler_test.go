@@ -0,0 +1,77 @@
+package loglevel_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/executor/loglevel"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		controller *loglevel.Controller
+		handler    http.Handler
+	)
+
+	BeforeEach(func() {
+		controller = loglevel.NewController(lager.INFO)
+		controller.SetSession("metrics-reporter", lager.ERROR)
+		handler = loglevel.Handler(lagertest.NewTestLogger("test"), controller)
+	})
+
+	serve := func(method, path, body string) (int, loglevel.Levels) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		var levels loglevel.Levels
+		if response.Code == http.StatusOK {
+			Expect(json.Unmarshal(response.Body.Bytes(), &levels)).To(Succeed())
+		}
+		return response.Code, levels
+	}
+
+	It("lists the levels", func() {
+		code, levels := serve(http.MethodGet, "/", "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(levels).To(Equal(loglevel.Levels{
+			Global:   "info",
+			Sessions: map[string]string{"metrics-reporter": "error"},
+		}))
+	})
+
+	It("sets the global level", func() {
+		code, levels := serve(http.MethodPut, "/", `{"level": "debug"}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(levels.Global).To(Equal("debug"))
+		Expect(controller.Enabled("executor", lager.DEBUG)).To(BeTrue())
+	})
+
+	It("sets the level of a session", func() {
+		code, levels := serve(http.MethodPut, "/cred-manager-runner", `{"level": "debug"}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(levels.Sessions).To(HaveKeyWithValue("cred-manager-runner", "debug"))
+		Expect(controller.Enabled("executor.cred-manager-runner", lager.DEBUG)).To(BeTrue())
+	})
+
+	It("resets the level of a session", func() {
+		code, levels := serve(http.MethodDelete, "/metrics-reporter", "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(levels.Sessions).To(BeEmpty())
+	})
+
+	It("rejects unknown levels", func() {
+		code, _ := serve(http.MethodPut, "/", `{"level": "loud"}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("does not reset the global level", func() {
+		code, _ := serve(http.MethodDelete, "/", "")
+		Expect(code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,46 @@
+package loglevel
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type controlledLogger struct {
+	lager.Logger
+	controller *Controller
+}
+
+func (l *controlledLogger) wrap(logger lager.Logger) lager.Logger {
+	return &controlledLogger{Logger: logger, controller: l.controller}
+}
+
+func (l *controlledLogger) Session(task string, data ...lager.Data) lager.Logger {
+	return l.wrap(l.Logger.Session(task, data...))
+}
+
+func (l *controlledLogger) WithData(data lager.Data) lager.Logger {
+	return l.wrap(l.Logger.WithData(data))
+}
+
+func (l *controlledLogger) WithTraceInfo(req *http.Request) lager.Logger {
+	return l.wrap(l.Logger.WithTraceInfo(req))
+}
+
+func (l *controlledLogger) Debug(action string, data ...lager.Data) {
+	if l.controller.Enabled(l.SessionName(), lager.DEBUG) {
+		l.Logger.Debug(action, data...)
+	}
+}
+
+func (l *controlledLogger) Info(action string, data ...lager.Data) {
+	if l.controller.Enabled(l.SessionName(), lager.INFO) {
+		l.Logger.Info(action, data...)
+	}
+}
+
+func (l *controlledLogger) Error(action string, err error, data ...lager.Data) {
+	if l.controller.Enabled(l.SessionName(), lager.ERROR) {
+		l.Logger.Error(action, err, data...)
+	}
+}
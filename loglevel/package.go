@@ -0,0 +1 @@
+package loglevel // import "code.cloudfoundry.org/executor/loglevel"
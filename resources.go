@@ -3,6 +3,8 @@ package executor
 import (
 	"errors"
 	"fmt"
+	"path"
+	"regexp"
 	"strconv"
 	"time"
 
@@ -13,6 +15,33 @@ import (
 const (
 	ContainerOwnerProperty = "executor:owner"
 	ContainerStateProperty = "garden.state"
+
+	ContainerHostProcessProperty = "executor:host-process"
+	ContainerIPFamilyProperty    = "executor:ip-family"
+
+	// ContainerReadOnlyRootfsProperty asks the runtime to mount the root
+	// filesystem of the container read-only. Bind mounts keep their own
+	// mode.
+	ContainerReadOnlyRootfsProperty = "executor:read-only-rootfs"
+
+	// The executor mirrors these fields of its containers into their garden
+	// properties so that garden-level tooling can see them. The tags, ports
+	// and internal routes are JSON encoded.
+	ContainerExecutorStateProperty  = "executor:state"
+	ContainerTagsProperty           = "executor:tags"
+	ContainerPortsProperty          = "executor:ports"
+	ContainerInternalRoutesProperty = "executor:internal-routes"
+	ContainerRoutableProperty       = "executor:routable"
+
+	// ContainerRequestedIPProperty asks the network plugin for a specific
+	// internal IP. It is set when a container is recreated shortly after a
+	// container with the same guid was destroyed, and is ignored by plugins
+	// that cannot honour it.
+	ContainerRequestedIPProperty = "network.requested_ip"
+
+	// ContainerIPv6Property is set by the network plugin of dual-stack cells
+	// to the IPv6 address of the container.
+	ContainerIPv6Property = "garden.network.container-ipv6"
 )
 
 type State string
@@ -29,8 +58,122 @@ const (
 const (
 	HealthcheckTag      = "executor-healthcheck"
 	HealthcheckTagValue = "executor-healthcheck"
+
+	ScheduledTaskTag  = "executor-scheduled-task"
+	SyntheticProbeTag = "executor-synthetic-probe"
+
+	// LifecycleTag is set by the rep to tell tasks from LRPs.
+	LifecycleTag  = "lifecycle"
+	TaskLifecycle = "task"
+	LRPLifecycle  = "lrp"
+
+	// ProcessGuidTag is set by the rep to the process guid of LRPs.
+	ProcessGuidTag = "process-guid"
+
+	// PlacementTagTag is set to the placement tag, i.e. the isolation
+	// segment, that a container was placed on the cell for.
+	PlacementTagTag = "placement-tag"
 )
 
+// PlacementTagQuota caps the resources allocated to the containers of a
+// placement tag, so that isolation segments can share a cell. Zero fields
+// are not capped.
+type PlacementTagQuota struct {
+	MemoryMB   int `json:"memory_mb,omitempty"`
+	Containers int `json:"containers,omitempty"`
+}
+
+// PlacementQuotas are the quotas of the placement tags of a cell.
+type PlacementQuotas map[string]PlacementTagQuota
+
+// ContainerTemplate holds the default settings of the containers of a cell.
+// The settings of a run request take precedence: env variables and log tags
+// of the template are only used when the request does not set them, while
+// its volume mounts and egress rules are added to the ones of the request,
+// unless it already mounts the same container path.
+type ContainerTemplate struct {
+	Env          []EnvironmentVariable       `json:"env,omitempty"`
+	VolumeMounts []VolumeMount               `json:"volume_mounts,omitempty"`
+	LogTags      map[string]string           `json:"log_tags,omitempty"`
+	EgressRules  []*models.SecurityGroupRule `json:"egress_rules,omitempty"`
+}
+
+// Templates are the container templates of a cell, by placement
+// tag. The template of the empty placement tag applies to every container,
+// and the template of the placement tag of a container on top of it.
+type Templates map[string]ContainerTemplate
+
+// Apply returns a copy of the request with the templates for its placement
+// tag applied. The request itself is left untouched.
+func (t Templates) Apply(req RunRequest) RunRequest {
+	if placementTag := req.Tags[PlacementTagTag]; placementTag != "" {
+		if template, ok := t[placementTag]; ok {
+			req.RunInfo = template.apply(req.RunInfo)
+		}
+	}
+	if template, ok := t[""]; ok {
+		req.RunInfo = template.apply(req.RunInfo)
+	}
+	return req
+}
+
+func (t ContainerTemplate) apply(runInfo RunInfo) RunInfo {
+	if len(t.Env) > 0 {
+		env := append([]EnvironmentVariable{}, runInfo.Env...)
+		for _, variable := range t.Env {
+			if !hasEnvironmentVariable(runInfo.Env, variable.Name) {
+				env = append(env, variable)
+			}
+		}
+		runInfo.Env = env
+	}
+
+	if len(t.VolumeMounts) > 0 {
+		mounts := append([]VolumeMount{}, runInfo.VolumeMounts...)
+		for _, mount := range t.VolumeMounts {
+			if !hasVolumeMount(runInfo.VolumeMounts, mount.ContainerPath) {
+				mounts = append(mounts, mount)
+			}
+		}
+		runInfo.VolumeMounts = mounts
+	}
+
+	if len(t.LogTags) > 0 {
+		tags := make(map[string]string, len(runInfo.LogConfig.Tags)+len(t.LogTags))
+		for k, v := range t.LogTags {
+			tags[k] = v
+		}
+		for k, v := range runInfo.LogConfig.Tags {
+			tags[k] = v
+		}
+		runInfo.LogConfig.Tags = tags
+	}
+
+	if len(t.EgressRules) > 0 {
+		runInfo.EgressRules = append(append([]*models.SecurityGroupRule{}, runInfo.EgressRules...), t.EgressRules...)
+	}
+
+	return runInfo
+}
+
+func hasEnvironmentVariable(env []EnvironmentVariable, name string) bool {
+	for _, variable := range env {
+		if variable.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolumeMount(mounts []VolumeMount, containerPath string) bool {
+	for _, mount := range mounts {
+		if mount.ContainerPath == containerPath {
+			return true
+		}
+	}
+	return false
+}
+
 type ProxyPortMapping struct {
 	AppPort   uint16 `json:"app_port"`
 	ProxyPort uint16 `json:"proxy_port"`
@@ -45,10 +188,40 @@ type Container struct {
 	AllocatedAt                           int64              `json:"allocated_at"`
 	ExternalIP                            string             `json:"external_ip"`
 	InternalIP                            string             `json:"internal_ip"`
+	InternalIPv6                          string             `json:"internal_ipv6,omitempty"`
 	RunResult                             ContainerRunResult `json:"run_result"`
 	MemoryLimit                           uint64             `json:"memory_limit"`
 	DiskLimit                             uint64             `json:"disk_limit"`
 	AdvertisePreferenceForInstanceAddress bool               `json:"advertise_preference_for_instance_address"`
+	Devices                               []string           `json:"devices,omitempty"`
+	CPUSet                                []int              `json:"cpuset,omitempty"`
+
+	// Unroutable is set while the ReadinessMonitor of a running container
+	// is failing.
+	Unroutable bool `json:"unroutable,omitempty"`
+
+	SetupMetrics SetupMetrics `json:"setup_metrics"`
+
+	// StartTimeoutRemainingMs is how much of its start timeout a container
+	// that is still starting has left. It is measured from when the container
+	// started running, and is only set for created containers with a start
+	// timeout.
+	StartTimeoutRemainingMs int64 `json:"start_timeout_remaining_ms,omitempty"`
+
+	// Restarts is how many times the action of the container was restarted
+	// in place according to its RestartPolicy.
+	Restarts int `json:"restarts,omitempty"`
+}
+
+// SetupMetrics describe the downloads done while creating a container.
+// Garden pulls the rootfs image while creating the container, so the image
+// fetch duration is the duration of the garden create call for images pulled
+// from a registry.
+type SetupMetrics struct {
+	ImageFetchDurationInNanoseconds uint64 `json:"image_fetch_duration_in_ns"`
+	CacheHits                       uint64 `json:"cache_hits"`
+	CacheMisses                     uint64 `json:"cache_misses"`
+	DownloadedBytes                 uint64 `json:"downloaded_bytes"`
 }
 
 func NewContainerFromResource(guid string, resource *Resource, tags Tags) Container {
@@ -106,6 +279,12 @@ func (c *Container) TransitionToComplete(failed bool, failureReason string, retr
 
 func (newContainer Container) Copy() Container {
 	newContainer.Tags = newContainer.Tags.Copy()
+	if newContainer.Devices != nil {
+		newContainer.Devices = append([]string{}, newContainer.Devices...)
+	}
+	if newContainer.CPUSet != nil {
+		newContainer.CPUSet = append([]int{}, newContainer.CPUSet...)
+	}
 	return newContainer
 }
 
@@ -143,6 +322,19 @@ type Resource struct {
 	MemoryMB int `json:"memory_mb"`
 	DiskMB   int `json:"disk_mb"`
 	MaxPids  int `json:"max_pids"`
+	GPUs     int `json:"gpus,omitempty"`
+
+	// GPUType restricts the GPUs of the container to devices of that type,
+	// e.g. a GPU model. Devices of any type are allocated when it is empty.
+	GPUType string `json:"gpu_type,omitempty"`
+
+	// ExclusiveCPUs is the number of cores dedicated to the container, which
+	// no other container with exclusive cores is pinned to.
+	ExclusiveCPUs int `json:"exclusive_cpus,omitempty"`
+
+	// Bandwidth limits the network traffic of the container. It is not
+	// limited when it is nil.
+	Bandwidth *BandwidthLimits `json:"bandwidth,omitempty"`
 }
 
 func NewResource(memoryMB, diskMB, maxPids int) Resource {
@@ -165,12 +357,64 @@ type CachedDependency struct {
 
 type CertificateProperties struct {
 	OrganizationalUnit []string `json:"organizational_unit"`
+	AppGUID            string   `json:"app_guid,omitempty"`
+	// DNSNames and IPAddresses are added to the SANs of the generated
+	// certificates, if allowed by the cell.
+	DNSNames    []string `json:"dns_names,omitempty"`
+	IPAddresses []string `json:"ip_addresses,omitempty"`
 }
 
+// Sidecar is a process that runs next to the action of a container. The
+// action of a container only starts once the ReadinessChecks of all of its
+// sidecars passed, so that e.g. the app does not boot before its proxy.
+//
+// The Monitor of a sidecar is run at the liveness interval of the container,
+// and the sidecar is stopped when it fails. A sidecar that exits, or is
+// stopped, is restarted according to its RestartPolicy, up to MaxRestarts
+// times when it is positive, without affecting the health of the container.
+// The container only fails when the sidecar is not restarted and exits with
+// an error.
+//
+// When MemoryMB is set and the sidecar is a run action, its processes run in
+// their own cgroup with that memory limit, within the limit of the container.
 type Sidecar struct {
-	Action   *models.Action `json:"run"`
-	DiskMB   int32          `json:"disk_mb"`
-	MemoryMB int32          `json:"memory_mb"`
+	Action         *models.Action       `json:"run"`
+	DiskMB         int32                `json:"disk_mb"`
+	MemoryMB       int32                `json:"memory_mb"`
+	ReadinessCheck *ExecCheck           `json:"readiness_check,omitempty"`
+	Monitor        *models.Action       `json:"monitor,omitempty"`
+	RestartPolicy  SidecarRestartPolicy `json:"restart_policy,omitempty"`
+	MaxRestarts    int                  `json:"max_restarts,omitempty"`
+}
+
+// SidecarRestartPolicy decides when a sidecar is restarted. Sidecars are not
+// restarted when it is empty.
+type SidecarRestartPolicy string
+
+const (
+	SidecarRestartNever     SidecarRestartPolicy = "never"
+	SidecarRestartOnFailure SidecarRestartPolicy = "on_failure"
+	SidecarRestartAlways    SidecarRestartPolicy = "always"
+)
+
+func (p SidecarRestartPolicy) Valid() bool {
+	switch p {
+	case "", SidecarRestartNever, SidecarRestartOnFailure, SidecarRestartAlways:
+		return true
+	default:
+		return false
+	}
+}
+
+// InitAction is a one-shot action that prepares a container for its action,
+// e.g. by migrating a database or templating configuration files. It fails
+// the container when it fails or runs for longer than TimeoutMs, when
+// positive. Its output is logged with LogSource, or with the source of the
+// container when empty.
+type InitAction struct {
+	Action    *models.Action `json:"action"`
+	TimeoutMs int64          `json:"timeout_ms,omitempty"`
+	LogSource string         `json:"log_source,omitempty"`
 }
 
 type RunInfo struct {
@@ -186,8 +430,10 @@ type RunInfo struct {
 	Setup                         *models.Action                `json:"setup"`
 	Action                        *models.Action                `json:"run"`
 	Monitor                       *models.Action                `json:"monitor"`
+	ReadinessMonitor              *models.Action                `json:"readiness_monitor,omitempty"`
 	CheckDefinition               *models.CheckDefinition       `json:"check_definition"`
 	EgressRules                   []*models.SecurityGroupRule   `json:"egress_rules,omitempty"`
+	HostnameEgressRules           []HostnameEgressRule          `json:"hostname_egress_rules,omitempty"`
 	Env                           []EnvironmentVariable         `json:"env,omitempty"`
 	TrustedSystemCertificatesPath string                        `json:"trusted_system_certificates_path,omitempty"`
 	VolumeMounts                  []VolumeMount                 `json:"volume_mounts"`
@@ -198,6 +444,368 @@ type RunInfo struct {
 	EnableContainerProxy          bool                          `json:"enable_container_proxy"`
 	Sidecars                      []Sidecar                     `json:"sidecars"`
 	LogRateLimitBytesPerSecond    int64                         `json:"log_rate_limit_bytes_per_second"`
+	HostProcess                   bool                          `json:"host_process,omitempty"`
+	DependsOn                     []ContainerDependency         `json:"depends_on,omitempty"`
+	ResultFiles                   []string                      `json:"result_files,omitempty"`
+	CompletionCallbackURLs        []string                      `json:"completion_callback_urls,omitempty"`
+	ProcessWatchdog               *ProcessWatchdog              `json:"process_watchdog,omitempty"`
+	Swap                          *SwapLimits                   `json:"swap,omitempty"`
+	IPFamily                      IPFamily                      `json:"ip_family,omitempty"`
+	Clock                         *ContainerClock               `json:"clock,omitempty"`
+	HTTPChecks                    []HTTPCheckOptions            `json:"http_checks,omitempty"`
+	Sysctls                       map[string]string             `json:"sysctls,omitempty"`
+	ExecChecks                    []ExecCheck                   `json:"exec_checks,omitempty"`
+	Probes                        *Probes                       `json:"probes,omitempty"`
+
+	// ReadOnlyRootfs mounts the root filesystem of the container read-only.
+	// The container gets a writable /tmp and its volume mounts keep the mode
+	// they declare.
+	ReadOnlyRootfs bool `json:"read_only_rootfs,omitempty"`
+
+	// InitActions run in order, each to completion, after the setup and
+	// before the action of the container, every time its action is started.
+	InitActions []InitAction `json:"init_actions,omitempty"`
+
+	// ImageCredentialsRef names the CredHub credential holding the registry
+	// credentials of the image, instead of ImageUsername and ImagePassword.
+	// It is resolved by the cell when the container is created.
+	ImageCredentialsRef string `json:"image_credentials_ref,omitempty"`
+
+	// RestartPolicy restarts the action of the container in place when it
+	// fails, instead of completing the container.
+	RestartPolicy *RestartPolicy `json:"restart_policy,omitempty"`
+}
+
+// RestartPolicy restarts the action of a container that failed in the same
+// garden container, keeping its IP, volumes and credentials, up to
+// MaxRestarts times. The setup of the container is not run again, but its
+// init actions and health checks are. Restarts are delayed by an exponential
+// backoff starting at InitialBackoffMs, of at most MaxBackoffMs.
+type RestartPolicy struct {
+	MaxRestarts      int   `json:"max_restarts"`
+	InitialBackoffMs int64 `json:"initial_backoff_ms,omitempty"`
+	MaxBackoffMs     int64 `json:"max_backoff_ms,omitempty"`
+}
+
+func (p *RestartPolicy) Valid() bool {
+	return p == nil || (p.MaxRestarts >= 0 && p.InitialBackoffMs >= 0 && p.MaxBackoffMs >= 0)
+}
+
+// Probes tune the health checks of a container. The startup probe applies
+// to the checks run until the container becomes healthy, the liveness probe
+// to the checks run afterwards and the readiness probe to the readiness
+// monitor. StartupCondition decides whether all the checks of the container
+// or any one of them must pass for it to become healthy.
+type Probes struct {
+	Startup          *Probe             `json:"startup,omitempty"`
+	Liveness         *Probe             `json:"liveness,omitempty"`
+	Readiness        *Probe             `json:"readiness,omitempty"`
+	StartupCondition ReadinessCondition `json:"startup_condition,omitempty"`
+}
+
+// ReadinessCondition combines the checks run until a container becomes
+// healthy. The readiness checks of the container proxy must pass regardless.
+type ReadinessCondition string
+
+const (
+	ReadinessConditionAll ReadinessCondition = "all"
+	ReadinessConditionAny ReadinessCondition = "any"
+)
+
+// Probe overrides the defaults of the cell for a probe. The interval and
+// timeout of a check of the check definition take precedence over the ones
+// of its probe. A startup FailureThreshold replaces the start timeout of the
+// container with the time it takes to run that many checks. Monitor actions
+// ignore the initial delays of startup and liveness probes.
+type Probe struct {
+	InitialDelayMs   uint32 `json:"initial_delay_ms,omitempty"`
+	IntervalMs       uint32 `json:"interval_ms,omitempty"`
+	TimeoutMs        uint32 `json:"timeout_ms,omitempty"`
+	FailureThreshold uint32 `json:"failure_threshold,omitempty"`
+}
+
+// ExecCheck is a health check that runs a command in the container, in
+// addition to the checks of the check definition. The check passes when the
+// command exits within TimeoutMs with one of SuccessExitCodes (0 when there
+// are none). Like the other checks, it decides both when the container
+// becomes healthy and whether it stays alive.
+type ExecCheck struct {
+	Path             string   `json:"path"`
+	Args             []string `json:"args,omitempty"`
+	User             string   `json:"user,omitempty"`
+	TimeoutMs        uint32   `json:"timeout_ms,omitempty"`
+	IntervalMs       uint32   `json:"interval_ms,omitempty"`
+	SuccessExitCodes []int    `json:"success_exit_codes,omitempty"`
+}
+
+func (c ExecCheck) Succeeded(exitCode int) bool {
+	if len(c.SuccessExitCodes) == 0 {
+		return exitCode == 0
+	}
+	for _, code := range c.SuccessExitCodes {
+		if exitCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPCheckOptions replaces the healthcheck binary of the HTTP checks of the
+// check definition on Port with a probe run by the executor itself. The probe
+// requests the path of the check from the internal address of the container
+// and succeeds when the status code is in one of ExpectedStatuses (2xx when
+// there are none) and the body contains BodyContains.
+type HTTPCheckOptions struct {
+	Port             uint32            `json:"port"`
+	Scheme           string            `json:"scheme,omitempty"`
+	Host             string            `json:"host,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	ExpectedStatuses []StatusRange     `json:"expected_statuses,omitempty"`
+	BodyContains     string            `json:"body_contains,omitempty"`
+	SkipTLSVerify    bool              `json:"skip_tls_verify,omitempty"`
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func (o HTTPCheckOptions) ExpectsStatus(code int) bool {
+	if len(o.ExpectedStatuses) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, r := range o.ExpectedStatuses {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPCheck returns the options of the native HTTP checks on port, if any.
+func (r *RunInfo) HTTPCheck(port uint32) (HTTPCheckOptions, bool) {
+	for _, options := range r.HTTPChecks {
+		if options.Port == port {
+			return options, true
+		}
+	}
+	return HTTPCheckOptions{}, false
+}
+
+// ContainerClock sets the time seen by the processes of a container.
+// Timezone is the name of a zone of the IANA time zone database, like
+// "Europe/Berlin". OffsetSeconds shifts the clock of the processes of the
+// container through the libfaketime of the cell, which is preloaded into
+// them, and is only meant for testing. It does not affect statically linked
+// processes.
+type ContainerClock struct {
+	Timezone      string `json:"timezone,omitempty"`
+	OffsetSeconds int64  `json:"offset_seconds,omitempty"`
+}
+
+var timezonePattern = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+
+func (c *ContainerClock) Valid() bool {
+	if c == nil || c.Timezone == "" {
+		return true
+	}
+	return timezonePattern.MatchString(c.Timezone) && path.Clean(c.Timezone) == c.Timezone
+}
+
+// Env returns the environment variables that set the clock of the
+// container.
+func (c *ContainerClock) Env() []EnvironmentVariable {
+	if c == nil {
+		return nil
+	}
+
+	var env []EnvironmentVariable
+	if c.Timezone != "" {
+		env = append(env, EnvironmentVariable{Name: "TZ", Value: c.Timezone})
+	}
+	if c.OffsetSeconds != 0 {
+		env = append(env, EnvironmentVariable{Name: "FAKETIME", Value: fmt.Sprintf("%+ds", c.OffsetSeconds)})
+	}
+	return env
+}
+
+// IPFamily selects the IP versions of the addresses of a container. When a
+// container does not select one, the default of the cell is used.
+type IPFamily string
+
+const (
+	IPFamilyIPv4      IPFamily = "ipv4"
+	IPFamilyIPv6      IPFamily = "ipv6"
+	IPFamilyDualStack IPFamily = "dual-stack"
+)
+
+func (f IPFamily) Valid() bool {
+	switch f {
+	case IPFamilyIPv4, IPFamilyIPv6, IPFamilyDualStack:
+		return true
+	default:
+		return false
+	}
+}
+
+// BandwidthLimits bounds the rate of the egress and ingress traffic of a
+// container, in bytes per second, allowing bursts of up to the burst rates.
+// A direction is not limited when its rate is 0, and a burst rate below the
+// rate is raised to the rate.
+type BandwidthLimits struct {
+	EgressRateInBytesPerSecond       uint64 `json:"egress_rate_in_bytes_per_second,omitempty"`
+	EgressBurstRateInBytesPerSecond  uint64 `json:"egress_burst_rate_in_bytes_per_second,omitempty"`
+	IngressRateInBytesPerSecond      uint64 `json:"ingress_rate_in_bytes_per_second,omitempty"`
+	IngressBurstRateInBytesPerSecond uint64 `json:"ingress_burst_rate_in_bytes_per_second,omitempty"`
+}
+
+// Egress returns the rate and burst rate of the egress traffic, and false
+// when it is not limited.
+func (b *BandwidthLimits) Egress() (uint64, uint64, bool) {
+	if b == nil || b.EgressRateInBytesPerSecond == 0 {
+		return 0, 0, false
+	}
+	return b.EgressRateInBytesPerSecond, burstRate(b.EgressRateInBytesPerSecond, b.EgressBurstRateInBytesPerSecond), true
+}
+
+// Ingress returns the rate and burst rate of the ingress traffic, and false
+// when it is not limited.
+func (b *BandwidthLimits) Ingress() (uint64, uint64, bool) {
+	if b == nil || b.IngressRateInBytesPerSecond == 0 {
+		return 0, 0, false
+	}
+	return b.IngressRateInBytesPerSecond, burstRate(b.IngressRateInBytesPerSecond, b.IngressBurstRateInBytesPerSecond), true
+}
+
+func burstRate(rate, burst uint64) uint64 {
+	if burst < rate {
+		return rate
+	}
+	return burst
+}
+
+// SwapLimits bounds the swap a container may use on top of its memory limit.
+// Disabled prevents the container from swapping at all and takes precedence
+// over LimitInBytes. The limits are written to the memory cgroup of the
+// container; containers without swap limits get the default of the garden
+// runtime.
+type SwapLimits struct {
+	LimitInBytes uint64 `json:"limit_in_bytes,omitempty"`
+	Disabled     bool   `json:"disabled,omitempty"`
+}
+
+// Enforced returns the number of bytes of swap that the memory cgroup of the
+// container is limited to, and false when the limits leave the default of
+// the runtime in place.
+func (s *SwapLimits) Enforced() (uint64, bool) {
+	switch {
+	case s == nil:
+		return 0, false
+	case s.Disabled:
+		return 0, true
+	case s.LimitInBytes > 0:
+		return s.LimitInBytes, true
+	default:
+		return 0, false
+	}
+}
+
+// Limit returns the number of bytes of swap the container may use, or 0
+// when it is not limited by the executor.
+func (s *SwapLimits) Limit() uint64 {
+	if s == nil || s.Disabled {
+		return 0
+	}
+	return s.LimitInBytes
+}
+
+// ProcessWatchdog enables periodic sampling of the processes, zombie
+// processes and open file descriptors inside a running container. A warning
+// is written to the application logs when a sample exceeds one of the
+// non-zero limits. When FailOnLimit is set the container is treated as
+// unhealthy instead, before the kernel limits of the container are hit.
+type ProcessWatchdog struct {
+	MaxProcesses int  `json:"max_processes,omitempty"`
+	MaxZombies   int  `json:"max_zombies,omitempty"`
+	MaxOpenFiles int  `json:"max_open_files,omitempty"`
+	FailOnLimit  bool `json:"fail_on_limit,omitempty"`
+}
+
+// ContainerDependency delays running the action tree of a container until
+// the container with the given guid, on the same cell, reaches State. State
+// is one of StateCreated, StateRunning or StateCompleted.
+type ContainerDependency struct {
+	Guid  string `json:"guid"`
+	State State  `json:"state"`
+}
+
+// HostnameEgressRule allows egress to the addresses a hostname resolves to.
+// The executor periodically re-resolves the hostname and allows any new
+// addresses on the running container.
+type HostnameEgressRule struct {
+	Hostname  string            `json:"hostname"`
+	Protocol  string            `json:"protocol"`
+	Ports     []uint32          `json:"ports,omitempty"`
+	PortRange *models.PortRange `json:"port_range,omitempty"`
+	Log       bool              `json:"log,omitempty"`
+}
+
+// ScheduledTask is a maintenance container, e.g. log rotation or image
+// garbage collection, that the cell runs on its own on a cron-like schedule.
+// Schedule is either a five field cron expression or "@every <duration>".
+type ScheduledTask struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Resource
+	RunInfo
+}
+
+type ScheduledTaskResult struct {
+	Name          string `json:"name"`
+	Guid          string `json:"guid"`
+	StartedAt     int64  `json:"started_at"`
+	CompletedAt   int64  `json:"completed_at"`
+	Failed        bool   `json:"failed"`
+	FailureReason string `json:"failure_reason"`
+}
+
+// PrefetchArtifact is an artifact fetched into the download cache of the
+// cell ahead of time. It must have the cache key and checksum with which
+// containers will declare it as a CachedDependency to be a cache hit.
+type PrefetchArtifact struct {
+	From              string `json:"from"`
+	CacheKey          string `json:"cache_key"`
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"`
+	ChecksumValue     string `json:"checksum_value,omitempty"`
+}
+
+// PrefetchProgress reports how far the cell got with the last submitted
+// prefetch manifest. Failures maps the cache keys of the artifacts that
+// could not be fetched to the reason.
+type PrefetchProgress struct {
+	Total           int               `json:"total"`
+	Fetched         int               `json:"fetched"`
+	Failed          int               `json:"failed"`
+	DownloadedBytes int64             `json:"downloaded_bytes"`
+	Failures        map[string]string `json:"failures,omitempty"`
+}
+
+// ProcessSpec is a process run in a running container, e.g. to debug it.
+// When TTY is set, the process runs with a pseudo terminal of that size and
+// its stderr is merged into its stdout.
+type ProcessSpec struct {
+	Path string      `json:"path"`
+	Args []string    `json:"args,omitempty"`
+	Env  []string    `json:"env,omitempty"`
+	Dir  string      `json:"dir,omitempty"`
+	User string      `json:"user,omitempty"`
+	TTY  *WindowSize `json:"tty,omitempty"`
+}
+
+type WindowSize struct {
+	Columns uint16 `json:"columns"`
+	Rows    uint16 `json:"rows"`
 }
 
 type BindMountMode uint8
@@ -226,6 +834,17 @@ type EnvironmentVariable struct {
 	Value string `json:"value"`
 }
 
+// CellCapabilities describes the hardware and kernel features of a cell, so
+// that workloads with special requirements can be placed on capable cells.
+type CellCapabilities struct {
+	CPUFeatures    []string `json:"cpu_features,omitempty"`
+	GPUs           int      `json:"gpus"`
+	HugePagesTotal int      `json:"huge_pages_total"`
+	HugePageSizeKB int      `json:"huge_page_size_kb"`
+	KernelVersion  string   `json:"kernel_version,omitempty"`
+	CgroupVersion  int      `json:"cgroup_version,omitempty"`
+}
+
 type ContainerMetrics struct {
 	MemoryUsageInBytes                  uint64        `json:"memory_usage_in_bytes"`
 	DiskUsageInBytes                    uint64        `json:"disk_usage_in_bytes"`
@@ -234,6 +853,20 @@ type ContainerMetrics struct {
 	TimeSpentInCPU                      time.Duration `json:"time_spent_in_cpu"`
 	AbsoluteCPUEntitlementInNanoseconds uint64        `json:"absolute_cpu_entitlement_in_ns"`
 	ContainerAgeInNanoseconds           uint64        `json:"container_age_in_ns"`
+	SwapUsageInBytes                    uint64        `json:"swap_usage_in_bytes"`
+	SwapLimitInBytes                    uint64        `json:"swap_limit_in_bytes"`
+	SetupMetrics                        SetupMetrics  `json:"setup_metrics"`
+
+	// NetworkUsage is nil when garden does not report the network traffic
+	// of the container.
+	NetworkUsage *NetworkUsage `json:"network_usage,omitempty"`
+}
+
+// NetworkUsage counts the bytes a container received and sent since it was
+// created.
+type NetworkUsage struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
 }
 
 type MetricsConfig struct {
@@ -288,12 +921,62 @@ type ContainerRunResult struct {
 	Retryable     bool
 
 	Stopped bool `json:"stopped"`
+
+	Artifacts []ResultArtifact `json:"artifacts,omitempty"`
+
+	// CoreDumps names the core files captured from the failed container.
+	// Each of them can be retrieved with GetFiles at
+	// path.Join(CoreDumpsPath, name) until the container is deleted.
+	CoreDumps []string `json:"core_dumps,omitempty"`
+
+	// Timeline records when each step of the setup, action and monitor of
+	// the container last ran, in the order the steps first started.
+	Timeline []StepTiming `json:"timeline,omitempty"`
+}
+
+// StepTiming records the last run of a step of a container. Steps are named
+// after their path in the action tree, e.g. "setup/serial[0]/download".
+// FinishedAt is zero while the step is running.
+type StepTiming struct {
+	Step       string `json:"step"`
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	Failed     bool   `json:"failed,omitempty"`
+	Runs       int    `json:"runs"`
+}
+
+// CoreDumpsPath is the directory under which GetFiles serves the core dumps
+// captured from a container, instead of streaming them out of the container.
+const CoreDumpsPath = "/.executor/core-dumps"
+
+// ResultArtifact holds the content of a file matching one of the
+// ResultFiles globs of a container, captured when the container completed.
+type ResultArtifact struct {
+	Path      string `json:"path"`
+	Content   []byte `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
 }
 
 type ExecutorResources struct {
 	MemoryMB   int `json:"memory_mb"`
 	DiskMB     int `json:"disk_mb"`
 	Containers int `json:"containers"`
+	GPUs       int `json:"gpus,omitempty"`
+
+	// GPUTypes counts the GPUs of each type, for cells whose GPU devices
+	// have types. GPUs also counts them.
+	GPUTypes map[string]int `json:"gpu_types,omitempty"`
+
+	// ExclusiveCPUs counts the cores of the cell that can be dedicated to
+	// containers.
+	ExclusiveCPUs int `json:"exclusive_cpus,omitempty"`
+
+	// ContainerIPs and HostPorts count the addresses of the container network
+	// pool and the ports of the host port pool of garden. They are not
+	// allocated by reservations, but by garden when it creates containers,
+	// and are zero when the pools are not tracked.
+	ContainerIPs int `json:"container_ips,omitempty"`
+	HostPorts    int `json:"host_ports,omitempty"`
 }
 
 func NewExecutorResources(memoryMB, diskMB, containers int) ExecutorResources {
@@ -305,11 +988,18 @@ func NewExecutorResources(memoryMB, diskMB, containers int) ExecutorResources {
 }
 
 func (e ExecutorResources) Copy() ExecutorResources {
+	if e.GPUTypes != nil {
+		gpuTypes := make(map[string]int, len(e.GPUTypes))
+		for gpuType, count := range e.GPUTypes {
+			gpuTypes[gpuType] = count
+		}
+		e.GPUTypes = gpuTypes
+	}
 	return e
 }
 
 func (r *ExecutorResources) canSubtract(res *Resource) bool {
-	return r.MemoryMB >= res.MemoryMB && r.DiskMB >= res.DiskMB && r.Containers > 0
+	return r.MemoryMB >= res.MemoryMB && r.DiskMB >= res.DiskMB && r.GPUs >= res.GPUs && r.ExclusiveCPUs >= res.ExclusiveCPUs && r.Containers > 0
 }
 
 func (r *ExecutorResources) Subtract(res *Resource) bool {
@@ -318,6 +1008,8 @@ func (r *ExecutorResources) Subtract(res *Resource) bool {
 	}
 	r.MemoryMB -= res.MemoryMB
 	r.DiskMB -= res.DiskMB
+	r.GPUs -= res.GPUs
+	r.ExclusiveCPUs -= res.ExclusiveCPUs
 	r.Containers -= 1
 	return true
 }
@@ -325,6 +1017,8 @@ func (r *ExecutorResources) Subtract(res *Resource) bool {
 func (r *ExecutorResources) Add(res *Resource) {
 	r.MemoryMB += res.MemoryMB
 	r.DiskMB += res.DiskMB
+	r.GPUs += res.GPUs
+	r.ExclusiveCPUs += res.ExclusiveCPUs
 	r.Containers += 1
 }
 
@@ -359,6 +1053,19 @@ const (
 	EventTypeContainerComplete EventType = "container_complete"
 	EventTypeContainerRunning  EventType = "container_running"
 	EventTypeContainerReserved EventType = "container_reserved"
+
+	EventTypeContainerHealthTransition EventType = "container_health_transition"
+	EventTypeContainerCrashLooping     EventType = "container_crash_looping"
+	EventTypeContainerRoutability      EventType = "container_routability"
+	EventTypeContainerLivenessWarning  EventType = "container_liveness_warning"
+	EventTypeContainerRestarted        EventType = "container_restarted"
+
+	EventTypeContainerStartTimeoutWarning EventType = "container_start_timeout_warning"
+
+	EventTypeContainerGardenLimitExhausted EventType = "container_garden_limit_exhausted"
+
+	EventTypeCellDrainProgress EventType = "cell_drain_progress"
+	EventTypeCellClockJump     EventType = "cell_clock_jump"
 )
 
 type LifecycleEvent interface {
@@ -418,6 +1125,216 @@ func (e ContainerReservedEvent) TraceID() string      { return e.traceID }
 func (e ContainerReservedEvent) Container() Container { return e.RawContainer }
 func (ContainerReservedEvent) lifecycleEvent()        {}
 
+type HealthCheckType string
+
+const (
+	HealthCheckReadiness HealthCheckType = "readiness"
+	HealthCheckLiveness  HealthCheckType = "liveness"
+)
+
+// ContainerHealthTransitionEvent is emitted whenever the health check of a
+// running container passes or fails, so that consumers do not have to scrape
+// the application logs to learn why a container was marked unhealthy.
+type ContainerHealthTransitionEvent struct {
+	RawContainer  Container       `json:"container"`
+	CheckType     HealthCheckType `json:"check_type"`
+	Healthy       bool            `json:"healthy"`
+	Duration      time.Duration   `json:"duration"`
+	FailureOutput string          `json:"failure_output,omitempty"`
+	traceID       string
+}
+
+func NewContainerHealthTransitionEvent(
+	container Container,
+	checkType HealthCheckType,
+	healthy bool,
+	duration time.Duration,
+	failureOutput string,
+	traceID string,
+) ContainerHealthTransitionEvent {
+	return ContainerHealthTransitionEvent{
+		RawContainer:  container,
+		CheckType:     checkType,
+		Healthy:       healthy,
+		Duration:      duration,
+		FailureOutput: failureOutput,
+		traceID:       traceID,
+	}
+}
+
+func (ContainerHealthTransitionEvent) EventType() EventType {
+	return EventTypeContainerHealthTransition
+}
+
+func (e ContainerHealthTransitionEvent) TraceID() string      { return e.traceID }
+func (e ContainerHealthTransitionEvent) Container() Container { return e.RawContainer }
+
+// ContainerCrashLoopingEvent is emitted when the cell delays running a
+// container because containers with the same process guid and index failed
+// repeatedly on the cell.
+type ContainerCrashLoopingEvent struct {
+	RawContainer Container     `json:"container"`
+	Crashes      int           `json:"crashes"`
+	Backoff      time.Duration `json:"backoff"`
+	traceID      string
+}
+
+func NewContainerCrashLoopingEvent(container Container, crashes int, backoff time.Duration, traceID string) ContainerCrashLoopingEvent {
+	return ContainerCrashLoopingEvent{
+		RawContainer: container,
+		Crashes:      crashes,
+		Backoff:      backoff,
+		traceID:      traceID,
+	}
+}
+
+func (ContainerCrashLoopingEvent) EventType() EventType   { return EventTypeContainerCrashLooping }
+func (e ContainerCrashLoopingEvent) TraceID() string      { return e.traceID }
+func (e ContainerCrashLoopingEvent) Container() Container { return e.RawContainer }
+
+// ContainerRoutabilityEvent is emitted when a running container is taken out
+// of routing because its readiness monitor started failing, and when it is
+// put back once the readiness monitor passes again.
+type ContainerRoutabilityEvent struct {
+	RawContainer Container `json:"container"`
+	traceID      string
+}
+
+func NewContainerRoutabilityEvent(container Container, traceID string) ContainerRoutabilityEvent {
+	return ContainerRoutabilityEvent{
+		RawContainer: container,
+		traceID:      traceID,
+	}
+}
+
+func (ContainerRoutabilityEvent) EventType() EventType   { return EventTypeContainerRoutability }
+func (e ContainerRoutabilityEvent) TraceID() string      { return e.traceID }
+func (e ContainerRoutabilityEvent) Container() Container { return e.RawContainer }
+
+// ContainerRestartedEvent is emitted when the action of a container that
+// failed with FailureReason is restarted in place, for the Restarts time.
+type ContainerRestartedEvent struct {
+	RawContainer  Container `json:"container"`
+	Restarts      int       `json:"restarts"`
+	FailureReason string    `json:"failure_reason"`
+	traceID       string
+}
+
+func NewContainerRestartedEvent(container Container, restarts int, failureReason string, traceID string) ContainerRestartedEvent {
+	return ContainerRestartedEvent{
+		RawContainer:  container,
+		Restarts:      restarts,
+		FailureReason: failureReason,
+		traceID:       traceID,
+	}
+}
+
+func (ContainerRestartedEvent) EventType() EventType   { return EventTypeContainerRestarted }
+func (e ContainerRestartedEvent) TraceID() string      { return e.traceID }
+func (e ContainerRestartedEvent) Container() Container { return e.RawContainer }
+
+// ContainerLivenessWarningEvent is emitted for every liveness check failure
+// that the cell tolerates instead of crashing the container.
+type ContainerLivenessWarningEvent struct {
+	RawContainer  Container `json:"container"`
+	Failures      int       `json:"failures"`
+	FailureOutput string    `json:"failure_output,omitempty"`
+	traceID       string
+}
+
+func NewContainerLivenessWarningEvent(container Container, failures int, failureOutput string, traceID string) ContainerLivenessWarningEvent {
+	return ContainerLivenessWarningEvent{
+		RawContainer:  container,
+		Failures:      failures,
+		FailureOutput: failureOutput,
+		traceID:       traceID,
+	}
+}
+
+func (ContainerLivenessWarningEvent) EventType() EventType   { return EventTypeContainerLivenessWarning }
+func (e ContainerLivenessWarningEvent) TraceID() string      { return e.traceID }
+func (e ContainerLivenessWarningEvent) Container() Container { return e.RawContainer }
+
+// ContainerStartTimeoutWarningEvent is emitted when a starting container has
+// Remaining of its start timeout left and is not healthy yet.
+type ContainerStartTimeoutWarningEvent struct {
+	RawContainer Container     `json:"container"`
+	Remaining    time.Duration `json:"remaining"`
+	traceID      string
+}
+
+func NewContainerStartTimeoutWarningEvent(container Container, remaining time.Duration, traceID string) ContainerStartTimeoutWarningEvent {
+	return ContainerStartTimeoutWarningEvent{
+		RawContainer: container,
+		Remaining:    remaining,
+		traceID:      traceID,
+	}
+}
+
+func (ContainerStartTimeoutWarningEvent) EventType() EventType {
+	return EventTypeContainerStartTimeoutWarning
+}
+
+func (e ContainerStartTimeoutWarningEvent) TraceID() string      { return e.traceID }
+func (e ContainerStartTimeoutWarningEvent) Container() Container { return e.RawContainer }
+
+// GardenLimit names a limit of garden itself, as opposed to the resources
+// the executor accounts for, that can reject the creation of a container.
+type GardenLimit string
+
+const (
+	GardenLimitContainers GardenLimit = "containers"
+	GardenLimitNetwork    GardenLimit = "network"
+	GardenLimitDisk       GardenLimit = "disk"
+)
+
+// ContainerGardenLimitExhaustedEvent is emitted when garden fails to create a
+// container because Limit is exhausted. Reason is the error garden returned.
+type ContainerGardenLimitExhaustedEvent struct {
+	RawContainer Container   `json:"container"`
+	Limit        GardenLimit `json:"limit"`
+	Reason       string      `json:"reason"`
+	traceID      string
+}
+
+func NewContainerGardenLimitExhaustedEvent(container Container, limit GardenLimit, reason string, traceID string) ContainerGardenLimitExhaustedEvent {
+	return ContainerGardenLimitExhaustedEvent{
+		RawContainer: container,
+		Limit:        limit,
+		Reason:       reason,
+		traceID:      traceID,
+	}
+}
+
+func (ContainerGardenLimitExhaustedEvent) EventType() EventType {
+	return EventTypeContainerGardenLimitExhausted
+}
+
+func (e ContainerGardenLimitExhaustedEvent) TraceID() string      { return e.traceID }
+func (e ContainerGardenLimitExhaustedEvent) Container() Container { return e.RawContainer }
+
+// CellDrainProgressEvent is emitted when the cell starts stopping its
+// containers to drain, whenever a wave of them has completed, and when the
+// drain is done. Stopped counts the containers of the waves that completed.
+type CellDrainProgressEvent struct {
+	Wave             string `json:"wave,omitempty"`
+	Stopped          int    `json:"stopped"`
+	Total            int    `json:"total"`
+	Done             bool   `json:"done,omitempty"`
+	DeadlineExceeded bool   `json:"deadline_exceeded,omitempty"`
+}
+
+func (CellDrainProgressEvent) EventType() EventType { return EventTypeCellDrainProgress }
+
+// CellClockJumpEvent warns that the wall clock of the cell jumped by Skew,
+// e.g. after an NTP step or a pause of the VM, and that the timers of the
+// executor were re-armed.
+type CellClockJumpEvent struct {
+	Skew time.Duration `json:"skew"`
+}
+
+func (CellClockJumpEvent) EventType() EventType { return EventTypeCellClockJump }
+
 func truncateString(s string, length int) string {
 	if len(s) <= length {
 		return s
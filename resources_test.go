@@ -6,6 +6,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/executor"
 )
 
@@ -76,6 +77,17 @@ var _ = Describe("Container", func() {
 		})
 	})
 
+	Describe("Copy", func() {
+		It("does not share the GPU types with the copy", func() {
+			resources := executor.NewExecutorResources(10, 20, 3)
+			resources.GPUTypes = map[string]int{"a100": 2}
+
+			copied := resources.Copy()
+			copied.GPUTypes["a100"] = 1
+			Expect(resources.GPUTypes).To(Equal(map[string]int{"a100": 2}))
+		})
+	})
+
 	Describe("TransitionToComplete", func() {
 		var (
 			container     *executor.Container
@@ -107,3 +119,67 @@ var _ = Describe("Container", func() {
 		})
 	})
 })
+
+var _ = Describe("Templates", func() {
+	var (
+		templates executor.Templates
+		request   executor.RunRequest
+	)
+
+	BeforeEach(func() {
+		templates = executor.Templates{
+			"": {
+				Env:          []executor.EnvironmentVariable{{Name: "FLEET", Value: "default"}, {Name: "REGION", Value: "eu"}},
+				VolumeMounts: []executor.VolumeMount{{Driver: "nfs", ContainerPath: "/shared"}},
+				LogTags:      map[string]string{"fleet": "default", "source": "template"},
+				EgressRules:  []*models.SecurityGroupRule{{Protocol: "tcp", Destinations: []string{"10.0.0.0/8"}}},
+			},
+			"isolated": {
+				Env:         []executor.EnvironmentVariable{{Name: "FLEET", Value: "isolated"}},
+				EgressRules: []*models.SecurityGroupRule{{Protocol: "udp", Destinations: []string{"10.1.0.0/16"}}},
+			},
+		}
+
+		request = executor.NewRunRequest("some-guid", &executor.RunInfo{
+			Env:          []executor.EnvironmentVariable{{Name: "REGION", Value: "us"}},
+			VolumeMounts: []executor.VolumeMount{{Driver: "smb", ContainerPath: "/shared"}},
+			LogConfig:    executor.LogConfig{Tags: map[string]string{"source": "app"}},
+		}, nil)
+	})
+
+	It("fills in the settings that the request does not set", func() {
+		applied := templates.Apply(request)
+		Expect(applied.Env).To(Equal([]executor.EnvironmentVariable{
+			{Name: "REGION", Value: "us"},
+			{Name: "FLEET", Value: "default"},
+		}))
+		Expect(applied.VolumeMounts).To(Equal([]executor.VolumeMount{{Driver: "smb", ContainerPath: "/shared"}}))
+		Expect(applied.LogConfig.Tags).To(Equal(map[string]string{"fleet": "default", "source": "app"}))
+		Expect(applied.EgressRules).To(HaveLen(1))
+	})
+
+	It("keeps the log tags of the request", func() {
+		applied := templates.Apply(request)
+		Expect(applied.LogConfig.Tags["source"]).To(Equal("app"))
+	})
+
+	It("applies the template of the placement tag on top of the default one", func() {
+		request.Tags = executor.Tags{executor.PlacementTagTag: "isolated"}
+		applied := templates.Apply(request)
+		Expect(applied.Env).To(ContainElement(executor.EnvironmentVariable{Name: "FLEET", Value: "isolated"}))
+		Expect(applied.Env).NotTo(ContainElement(executor.EnvironmentVariable{Name: "FLEET", Value: "default"}))
+		Expect(applied.EgressRules).To(HaveLen(2))
+	})
+
+	It("does not modify the request", func() {
+		templates.Apply(request)
+		Expect(request.Env).To(HaveLen(1))
+		Expect(request.LogConfig.Tags).To(Equal(map[string]string{"source": "app"}))
+		Expect(request.VolumeMounts).To(HaveLen(1))
+	})
+
+	It("leaves the request as it is without templates", func() {
+		var none executor.Templates
+		Expect(none.Apply(request)).To(Equal(request))
+	})
+})
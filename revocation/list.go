@@ -0,0 +1,269 @@
+package revocation
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const crlPEMBlockType = "X509 CRL"
+
+type entry struct {
+	serial    *big.Int
+	revokedAt time.Time
+	expiry    time.Time
+}
+
+// state is what the List persists next to the CRL, so that revoked
+// certificates stay revoked and CRL numbers keep increasing across restarts.
+type state struct {
+	CRLNumber int64        `json:"crl_number"`
+	Entries   []stateEntry `json:"entries"`
+}
+
+type stateEntry struct {
+	Serial    string    `json:"serial"`
+	RevokedAt time.Time `json:"revoked_at"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// List keeps track of the instance identity certificates that were replaced
+// or belonged to destroyed containers, and publishes them as a CRL signed by
+// the instance identity CA. Certificates are dropped from the list once they
+// expire. The list and the number of the last CRL are persisted in
+// <crl path>.json.
+type List struct {
+	logger    lager.Logger
+	clock     clock.Clock
+	caCert    *x509.Certificate
+	caKey     crypto.Signer
+	crlPath   string
+	statePath string
+	validity  time.Duration
+
+	lock      sync.Mutex
+	entries   map[string]entry
+	crlNumber int64
+}
+
+// NewList returns a List with the entries persisted by a previous List for
+// the same CRL path. Its CRL numbers continue from the persisted number, or
+// from the number of the CRL at crlPath if it is higher.
+func NewList(
+	logger lager.Logger,
+	clock clock.Clock,
+	caCert *x509.Certificate,
+	caKey crypto.Signer,
+	crlPath string,
+	validity time.Duration,
+) (*List, error) {
+	l := &List{
+		logger:    logger.Session("revocation-list"),
+		clock:     clock,
+		caCert:    caCert,
+		caKey:     caKey,
+		crlPath:   crlPath,
+		statePath: crlPath + ".json",
+		validity:  validity,
+		entries:   map[string]entry{},
+	}
+
+	err := l.load()
+	if err != nil {
+		l.logger.Error("failed-to-load-state", err, lager.Data{"state-path": l.statePath})
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *List) load() error {
+	contents, err := os.ReadFile(l.statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var persisted state
+		err = json.Unmarshal(contents, &persisted)
+		if err != nil {
+			return err
+		}
+		l.crlNumber = persisted.CRLNumber
+		for _, e := range persisted.Entries {
+			serial, ok := new(big.Int).SetString(e.Serial, 10)
+			if !ok {
+				return fmt.Errorf("invalid serial number %q", e.Serial)
+			}
+			l.entries[e.Serial] = entry{serial: serial, revokedAt: e.RevokedAt, expiry: e.Expiry}
+		}
+	}
+
+	// the state may have been lost while the CRL was kept; relying parties
+	// reject CRLs whose number does not increase
+	contents, err = os.ReadFile(l.crlPath)
+	if err != nil {
+		return nil
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != crlPEMBlockType {
+		return nil
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil || crl.Number == nil {
+		return nil
+	}
+	if crl.Number.IsInt64() && crl.Number.Int64() > l.crlNumber {
+		l.crlNumber = crl.Number.Int64()
+	}
+	return nil
+}
+
+// Revoke adds the certificate to the list and publishes a new CRL.
+func (l *List) Revoke(cert *x509.Certificate) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	key := cert.SerialNumber.String()
+	if _, ok := l.entries[key]; ok {
+		return nil
+	}
+	l.entries[key] = entry{
+		serial:    cert.SerialNumber,
+		revokedAt: l.clock.Now(),
+		expiry:    cert.NotAfter,
+	}
+
+	return l.publish()
+}
+
+// Status returns when the certificate with the given serial number was
+// revoked, if it was.
+func (l *List) Status(serial *big.Int) (time.Time, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	e, ok := l.entries[serial.String()]
+	return e.revokedAt, ok
+}
+
+// Run publishes the CRL, and publishes it again halfway through its validity
+// so that relying parties never see a stale CRL.
+func (l *List) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := l.logger
+	logger.Info("starting", lager.Data{"crl-path": l.crlPath})
+	defer logger.Info("complete")
+
+	l.lock.Lock()
+	err := l.publish()
+	l.lock.Unlock()
+	if err != nil {
+		logger.Error("failed-to-publish-crl", err)
+		return err
+	}
+
+	ticker := l.clock.NewTicker(l.validity / 2)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case signal := <-signals:
+			logger.Info("signalled", lager.Data{"signal": signal.String()})
+			return nil
+		case <-ticker.C():
+			l.lock.Lock()
+			err := l.publish()
+			l.lock.Unlock()
+			if err != nil {
+				logger.Error("failed-to-publish-crl", err)
+			}
+		}
+	}
+}
+
+// publish must be called with the lock held.
+func (l *List) publish() error {
+	now := l.clock.Now()
+
+	revoked := make([]pkix.RevokedCertificate, 0, len(l.entries))
+	for key, e := range l.entries {
+		if e.expiry.Before(now) {
+			delete(l.entries, key)
+			continue
+		}
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   e.serial,
+			RevocationTime: e.revokedAt,
+		})
+	}
+
+	l.crlNumber++
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              big.NewInt(l.crlNumber),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(l.validity),
+	}, l.caCert, l.caKey)
+	if err != nil {
+		return err
+	}
+
+	// the state is saved first, so that the number of a published CRL is
+	// never reused
+	persisted := state{CRLNumber: l.crlNumber, Entries: make([]stateEntry, 0, len(l.entries))}
+	for key, e := range l.entries {
+		persisted.Entries = append(persisted.Entries, stateEntry{Serial: key, RevokedAt: e.revokedAt, Expiry: e.expiry})
+	}
+	contents, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+	err = writeFile(l.statePath, contents, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(l.crlPath, pem.EncodeToMemory(&pem.Block{Type: crlPEMBlockType, Bytes: crl}), 0644)
+	if err != nil {
+		return err
+	}
+	l.logger.Debug("published-crl", lager.Data{"revoked": len(revoked), "number": l.crlNumber})
+	return nil
+}
+
+// writeFile replaces the file at path atomically.
+func writeFile(path string, contents []byte, mode os.FileMode) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(contents)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmpFile.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,319 @@
+package revocation_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor/revocation"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"golang.org/x/crypto/ocsp"
+)
+
+var _ = Describe("List", func() {
+	const validity = time.Hour
+
+	var (
+		fakeClock *fakeclock.FakeClock
+		caCert    *x509.Certificate
+		caKey     *ecdsa.PrivateKey
+		crlPath   string
+		list      *revocation.List
+	)
+
+	issueCert := func(serial int64, notAfter time.Time) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "some-instance"},
+			NotBefore:    fakeClock.Now().Add(-time.Minute),
+			NotAfter:     notAfter,
+		}
+		certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+		Expect(err).NotTo(HaveOccurred())
+		cert, err := x509.ParseCertificate(certBytes)
+		Expect(err).NotTo(HaveOccurred())
+		return cert
+	}
+
+	readCRL := func() *x509.RevocationList {
+		data, err := os.ReadFile(crlPath)
+		Expect(err).NotTo(HaveOccurred())
+		block, _ := pem.Decode(data)
+		Expect(block).NotTo(BeNil())
+		Expect(block.Type).To(Equal("X509 CRL"))
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(crl.CheckSignatureFrom(caCert)).To(Succeed())
+		return crl
+	}
+
+	revokedSerials := func(crl *x509.RevocationList) []int64 {
+		serials := []int64{}
+		for _, revoked := range crl.RevokedCertificateEntries {
+			serials = append(serials, revoked.SerialNumber.Int64())
+		}
+		return serials
+	}
+
+	BeforeEach(func() {
+		var err error
+		fakeClock = fakeclock.NewFakeClock(time.Now().Truncate(time.Second))
+
+		caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "instance-identity-ca"},
+			SubjectKeyId:          []byte{1, 2, 3, 4},
+			NotBefore:             fakeClock.Now().Add(-time.Hour),
+			NotAfter:              fakeClock.Now().Add(24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		}
+		caBytes, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+		Expect(err).NotTo(HaveOccurred())
+		caCert, err = x509.ParseCertificate(caBytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		crlPath = filepath.Join(GinkgoT().TempDir(), "instance-identity.crl")
+		list, err = revocation.NewList(lagertest.NewTestLogger("test"), fakeClock, caCert, caKey, crlPath, validity)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Revoke", func() {
+		It("publishes a CRL containing the revoked certificate", func() {
+			Expect(list.Revoke(issueCert(10, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+
+			crl := readCRL()
+			Expect(revokedSerials(crl)).To(ConsistOf(int64(10)))
+			Expect(crl.ThisUpdate).To(BeTemporally("==", fakeClock.Now()))
+			Expect(crl.NextUpdate).To(BeTemporally("==", fakeClock.Now().Add(validity)))
+		})
+
+		It("increments the CRL number on every publish", func() {
+			Expect(list.Revoke(issueCert(10, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+			Expect(readCRL().Number.Int64()).To(Equal(int64(1)))
+
+			Expect(list.Revoke(issueCert(11, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+			crl := readCRL()
+			Expect(crl.Number.Int64()).To(Equal(int64(2)))
+			Expect(revokedSerials(crl)).To(ConsistOf(int64(10), int64(11)))
+		})
+
+		It("drops certificates from the CRL once they expire", func() {
+			Expect(list.Revoke(issueCert(10, fakeClock.Now().Add(time.Minute)))).To(Succeed())
+			fakeClock.Increment(2 * time.Minute)
+			Expect(list.Revoke(issueCert(11, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+
+			Expect(revokedSerials(readCRL())).To(ConsistOf(int64(11)))
+			_, revoked := list.Status(big.NewInt(10))
+			Expect(revoked).To(BeFalse())
+		})
+
+		It("reports the revocation time", func() {
+			Expect(list.Revoke(issueCert(10, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+
+			revokedAt, revoked := list.Status(big.NewInt(10))
+			Expect(revoked).To(BeTrue())
+			Expect(revokedAt).To(Equal(fakeClock.Now()))
+		})
+
+		Context("when the list is created again", func() {
+			var restarted *revocation.List
+
+			JustBeforeEach(func() {
+				var err error
+				restarted, err = revocation.NewList(lagertest.NewTestLogger("test"), fakeClock, caCert, caKey, crlPath, validity)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			BeforeEach(func() {
+				Expect(list.Revoke(issueCert(10, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+				Expect(list.Revoke(issueCert(11, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+			})
+
+			It("keeps the revoked certificates and increases the CRL number", func() {
+				revokedAt, revoked := restarted.Status(big.NewInt(10))
+				Expect(revoked).To(BeTrue())
+				Expect(revokedAt).To(BeTemporally("==", fakeClock.Now()))
+
+				Expect(restarted.Revoke(issueCert(12, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+				crl := readCRL()
+				Expect(crl.Number.Int64()).To(Equal(int64(3)))
+				Expect(revokedSerials(crl)).To(ConsistOf(int64(10), int64(11), int64(12)))
+			})
+
+			Context("when the persisted state was lost", func() {
+				BeforeEach(func() {
+					Expect(os.Remove(crlPath + ".json")).To(Succeed())
+				})
+
+				It("continues from the number of the published CRL", func() {
+					Expect(restarted.Revoke(issueCert(12, fakeClock.Now().Add(time.Hour)))).To(Succeed())
+					Expect(readCRL().Number.Int64()).To(Equal(int64(3)))
+				})
+			})
+		})
+
+		Context("when the persisted state is corrupt", func() {
+			BeforeEach(func() {
+				Expect(os.WriteFile(crlPath+".json", []byte("{"), 0600)).To(Succeed())
+			})
+
+			It("fails to create the list", func() {
+				_, err := revocation.NewList(lagertest.NewTestLogger("test"), fakeClock, caCert, caKey, crlPath, validity)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when the CRL cannot be written", func() {
+			BeforeEach(func() {
+				var err error
+				list, err = revocation.NewList(lagertest.NewTestLogger("test"), fakeClock, caCert, caKey, "/non/existent/dir/crl", validity)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				Expect(list.Revoke(issueCert(10, fakeClock.Now().Add(time.Hour)))).NotTo(Succeed())
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			process = ifrit.Invoke(list)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("publishes an empty CRL on start", func() {
+			crl := readCRL()
+			Expect(crl.RevokedCertificateEntries).To(BeEmpty())
+		})
+
+		It("republishes the CRL halfway through its validity", func() {
+			fakeClock.WaitForWatcherAndIncrement(validity / 2)
+
+			Eventually(func() time.Time {
+				return readCRL().NextUpdate
+			}).Should(BeTemporally("==", fakeClock.Now().Add(validity)))
+		})
+	})
+
+	Describe("OCSPHandler", func() {
+		var (
+			server *httptest.Server
+			cert   *x509.Certificate
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(list.OCSPHandler())
+			cert = issueCert(10, fakeClock.Now().Add(time.Hour))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		query := func() *ocsp.Response {
+			req, err := ocsp.CreateRequest(cert, caCert, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := http.Post(server.URL, "application/ocsp-request", bytes.NewReader(req))
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/ocsp-response"))
+
+			var body bytes.Buffer
+			_, err = body.ReadFrom(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			ocspResp, err := ocsp.ParseResponseForCert(body.Bytes(), cert, caCert)
+			Expect(err).NotTo(HaveOccurred())
+			return ocspResp
+		}
+
+		It("reports certificates that were not revoked as good", func() {
+			Expect(query().Status).To(Equal(ocsp.Good))
+		})
+
+		It("reports revoked certificates", func() {
+			Expect(list.Revoke(cert)).To(Succeed())
+
+			resp := query()
+			Expect(resp.Status).To(Equal(ocsp.Revoked))
+			Expect(resp.RevokedAt).To(BeTemporally("==", fakeClock.Now()))
+		})
+
+		Context("when the certificate was issued by another CA", func() {
+			var otherCA *x509.Certificate
+
+			BeforeEach(func() {
+				otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				template := &x509.Certificate{
+					SerialNumber:          big.NewInt(2),
+					Subject:               pkix.Name{CommonName: "other-ca"},
+					NotBefore:             fakeClock.Now().Add(-time.Hour),
+					NotAfter:              fakeClock.Now().Add(24 * time.Hour),
+					IsCA:                  true,
+					BasicConstraintsValid: true,
+					KeyUsage:              x509.KeyUsageCertSign,
+				}
+				otherBytes, err := x509.CreateCertificate(rand.Reader, template, template, otherKey.Public(), otherKey)
+				Expect(err).NotTo(HaveOccurred())
+				otherCA, err = x509.ParseCertificate(otherBytes)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("reports it as unknown", func() {
+				req, err := ocsp.CreateRequest(cert, otherCA, nil)
+				Expect(err).NotTo(HaveOccurred())
+				resp, err := http.Post(server.URL, "application/ocsp-request", bytes.NewReader(req))
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+
+				var body bytes.Buffer
+				_, err = body.ReadFrom(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				ocspResp, err := ocsp.ParseResponse(body.Bytes(), caCert)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ocspResp.Status).To(Equal(ocsp.Unknown))
+			})
+		})
+
+		It("rejects malformed requests", func() {
+			resp, err := http.Post(server.URL, "application/ocsp-request", bytes.NewReader([]byte("garbage")))
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			var body bytes.Buffer
+			_, err = body.ReadFrom(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body.Bytes()).To(Equal(ocsp.MalformedRequestErrorResponse))
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"golang.org/x/crypto/ocsp"
+)
+
+const maxOCSPRequestSize = 4096
+
+// OCSPHandler answers OCSP requests, over GET or POST as described in RFC
+// 6960 appendix A, for certificates issued by the instance identity CA.
+// Certificates that are not on the list are reported as good, and
+// certificates of other issuers as unknown.
+func (l *List) OCSPHandler() http.Handler {
+	logger := l.logger.Session("ocsp")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var der []byte
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			der, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, "/"))
+		case http.MethodPost:
+			der, err = io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		req, err := ocsp.ParseRequest(der)
+		if err != nil {
+			logger.Debug("invalid-request", lager.Data{"error": err.Error()})
+			w.Header().Set("Content-Type", "application/ocsp-response")
+			w.Write(ocsp.MalformedRequestErrorResponse)
+			return
+		}
+
+		now := l.clock.Now()
+		template := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(l.validity),
+		}
+		if !issuedBy(req, l.caCert) {
+			template.Status = ocsp.Unknown
+		} else if revokedAt, revoked := l.Status(req.SerialNumber); revoked {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = revokedAt
+			template.RevocationReason = ocsp.Superseded
+		}
+
+		resp, err := ocsp.CreateResponse(l.caCert, l.caCert, template, l.caKey)
+		if err != nil {
+			logger.Error("failed-to-create-response", err)
+			w.Header().Set("Content-Type", "application/ocsp-response")
+			w.Write(ocsp.InternalErrorErrorResponse)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	})
+}
+
+// issuedBy reports whether the request is for a certificate of the CA, by
+// comparing the hashes of its name and public key, as described in RFC 6960
+// section 4.1.1.
+func issuedBy(req *ocsp.Request, caCert *x509.Certificate) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	_, err := asn1.Unmarshal(caCert.RawSubjectPublicKeyInfo, &publicKeyInfo)
+	if err != nil {
+		return false
+	}
+
+	nameHash := req.HashAlgorithm.New()
+	nameHash.Write(caCert.RawSubject)
+	keyHash := req.HashAlgorithm.New()
+	keyHash.Write(publicKeyInfo.PublicKey.RightAlign())
+
+	return bytes.Equal(req.IssuerNameHash, nameHash.Sum(nil)) && bytes.Equal(req.IssuerKeyHash, keyHash.Sum(nil))
+}
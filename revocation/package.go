@@ -0,0 +1 @@
+package revocation // import "code.cloudfoundry.org/executor/revocation"
@@ -0,0 +1,13 @@
+package revocation_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRevocation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Revocation Suite")
+}
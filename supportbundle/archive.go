@@ -0,0 +1,171 @@
+package supportbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeyWords are the words of the keys whose string values must never
+// leave the cell, e.g. image_password, instance_identity_signer_vault_token
+// or inline_string. Keys naming the path of a secret, like admin_key_path,
+// are kept.
+var secretKeyWords = []string{"password", "passphrase", "token", "secret", "credential", "private_key", "inline_string", "inline_bytes"}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "_path") {
+		return false
+	}
+	for _, word := range secretKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return key == "key"
+}
+
+// redactString redacts the credentials of URLs, like the password of
+// postgres://user:secret@db, and drops their query.
+func redactString(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Scheme + "://" + redacted + "@" + u.Host + u.EscapedPath()
+}
+
+var yamlKeyValue = regexp.MustCompile(`^(\s*-?\s*"?([A-Za-z0-9_]+)"?\s*:\s*)(.+)$`)
+
+// redactYAML redacts the values of the secret keys of a YAML document, like
+// the Envoy configuration of a container, line by line. The lines of block
+// scalars of secret keys, like PEM encoded private keys, are dropped.
+func redactYAML(contents []byte) []byte {
+	var redactedLines [][]byte
+	blockIndent := -1
+	for _, line := range bytes.Split(contents, []byte("\n")) {
+		indent := len(line) - len(bytes.TrimLeft(line, " "))
+		if blockIndent >= 0 {
+			if len(bytes.TrimSpace(line)) == 0 || indent > blockIndent {
+				continue
+			}
+			blockIndent = -1
+		}
+
+		match := yamlKeyValue.FindSubmatch(line)
+		switch {
+		case match == nil:
+		case isSecretKey(string(match[2])):
+			if value := bytes.TrimSpace(match[3]); bytes.HasPrefix(value, []byte("|")) || bytes.HasPrefix(value, []byte(">")) {
+				blockIndent = indent
+			}
+			line = append(append([]byte{}, match[1]...), redacted...)
+		default:
+			line = append(append([]byte{}, match[1]...), redactString(string(match[3]))...)
+		}
+		redactedLines = append(redactedLines, line)
+	}
+	return bytes.Join(redactedLines, []byte("\n"))
+}
+
+type archive struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func newArchive(w io.Writer, modTime time.Time) *archive {
+	gz := gzip.NewWriter(w)
+	return &archive{gz: gz, tw: tar.NewWriter(gz), modTime: modTime}
+}
+
+func (a *archive) add(name string, contents []byte) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(contents)),
+		ModTime: a.modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = a.tw.Write(contents)
+	return err
+}
+
+// addJSON adds v as indented JSON, with the values of environment variables
+// and of secret keys and the credentials of URLs redacted.
+func (a *archive) addJSON(name string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	err = json.Unmarshal(raw, &generic)
+	if err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(redact(generic), "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.add(name, contents)
+}
+
+func (a *archive) Close() error {
+	err := a.tw.Close()
+	if err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+func redact(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			switch {
+			case key == "env":
+				value[key] = redactEnv(child)
+			case isSecretKey(key):
+				if s, ok := child.(string); ok && s != "" {
+					value[key] = redacted
+				} else {
+					value[key] = redact(child)
+				}
+			default:
+				value[key] = redact(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redact(child)
+		}
+	case string:
+		return redactString(value)
+	}
+	return v
+}
+
+func redactEnv(v interface{}) interface{} {
+	vars, ok := v.([]interface{})
+	if !ok {
+		return redact(v)
+	}
+	for _, envVar := range vars {
+		if m, ok := envVar.(map[string]interface{}); ok {
+			if _, hasValue := m["value"]; hasValue {
+				m["value"] = redacted
+			}
+		}
+	}
+	return vars
+}
@@ -0,0 +1,269 @@
+package supportbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const (
+	envoyConfigPath = "/etc/cf-assets/envoy_config/envoy.yaml"
+	cellEvents      = 200
+)
+
+// CellHealth summarises the state of the executor's subsystems. Errors holds
+// the subsystems that could not be queried.
+type CellHealth struct {
+	Healthy            bool                           `json:"healthy"`
+	TotalResources     executor.ExecutorResources     `json:"total_resources"`
+	RemainingResources executor.ExecutorResources     `json:"remaining_resources"`
+	ContainersByState  map[executor.State]int         `json:"containers_by_state"`
+	VolumeDrivers      []string                       `json:"volume_drivers"`
+	ScheduledTasks     []executor.ScheduledTaskResult `json:"scheduled_tasks"`
+	Errors             map[string]string              `json:"errors,omitempty"`
+}
+
+// CacheStats describes the contents of the download cache directory.
+type CacheStats struct {
+	Path           string `json:"path"`
+	Entries        int    `json:"entries"`
+	SizeInBytes    int64  `json:"size_in_bytes"`
+	MaxSizeInBytes uint64 `json:"max_size_in_bytes"`
+}
+
+// Bundler assembles support bundles from the state the executor keeps about
+// its containers. Everything written to a bundle is redacted: environment
+// variable values, the values of keys that may hold secrets and the
+// credentials of URLs.
+type Bundler struct {
+	client              executor.Client
+	recorder            *Recorder
+	clock               clock.Clock
+	config              interface{}
+	cachePath           string
+	maxCacheSizeInBytes uint64
+}
+
+func NewBundler(
+	client executor.Client,
+	recorder *Recorder,
+	clock clock.Clock,
+	config interface{},
+	cachePath string,
+	maxCacheSizeInBytes uint64,
+) *Bundler {
+	return &Bundler{
+		client:              client,
+		recorder:            recorder,
+		clock:               clock,
+		config:              config,
+		cachePath:           cachePath,
+		maxCacheSizeInBytes: maxCacheSizeInBytes,
+	}
+}
+
+// WriteCellBundle writes a gzipped tarball describing the cell to w: its
+// configuration, the health of its subsystems, goroutine and heap profiles,
+// the most recent container events and the download cache usage.
+func (b *Bundler) WriteCellBundle(logger lager.Logger, w io.Writer) error {
+	logger = logger.Session("write-cell-bundle")
+
+	archive := newArchive(w, b.clock.Now())
+
+	err := archive.addJSON("config.json", b.config)
+	if err != nil {
+		return err
+	}
+
+	err = archive.addJSON("health.json", b.health(logger))
+	if err != nil {
+		return err
+	}
+
+	for name, profile := range map[string]struct {
+		name  string
+		debug int
+	}{
+		"goroutines.txt": {"goroutine", 2},
+		"heap.pprof":     {"heap", 0},
+	} {
+		var buf bytes.Buffer
+		err = pprof.Lookup(profile.name).WriteTo(&buf, profile.debug)
+		if err != nil {
+			return err
+		}
+		err = archive.add(name, buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = archive.addJSON("events.json", b.recorder.RecentEvents(cellEvents))
+	if err != nil {
+		return err
+	}
+
+	err = archive.addJSON("cache.json", b.cacheStats(logger))
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func (b *Bundler) health(logger lager.Logger) CellHealth {
+	health := CellHealth{
+		Healthy:           b.client.Healthy(logger),
+		ContainersByState: map[executor.State]int{},
+		ScheduledTasks:    b.client.ScheduledTaskResults(logger),
+		Errors:            map[string]string{},
+	}
+
+	var err error
+	if err = b.client.Ping(logger); err != nil {
+		health.Errors["garden"] = err.Error()
+	}
+	if health.TotalResources, err = b.client.TotalResources(logger); err != nil {
+		health.Errors["total_resources"] = err.Error()
+	}
+	if health.RemainingResources, err = b.client.RemainingResources(logger); err != nil {
+		health.Errors["remaining_resources"] = err.Error()
+	}
+	if health.VolumeDrivers, err = b.client.VolumeDrivers(logger); err != nil {
+		health.Errors["volume_drivers"] = err.Error()
+	}
+
+	containers, err := b.client.ListContainers(logger)
+	if err != nil {
+		health.Errors["containers"] = err.Error()
+	}
+	for _, container := range containers {
+		health.ContainersByState[container.State]++
+	}
+
+	return health
+}
+
+func (b *Bundler) cacheStats(logger lager.Logger) CacheStats {
+	stats := CacheStats{Path: b.cachePath, MaxSizeInBytes: b.maxCacheSizeInBytes}
+	if b.cachePath == "" {
+		return stats
+	}
+
+	err := filepath.Walk(b.cachePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			stats.Entries++
+			stats.SizeInBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed-to-walk-cache", err)
+	}
+	return stats
+}
+
+// WriteContainerBundle writes a gzipped tarball describing the container to
+// w. Parts of the bundle that are not available are listed, with the reason,
+// in its OMITTED file.
+func (b *Bundler) WriteContainerBundle(logger lager.Logger, w io.Writer, guid string) error {
+	logger = logger.Session("write-container-bundle", lager.Data{"guid": guid})
+
+	container, err := b.client.GetContainer(logger, guid)
+	if err != nil {
+		return err
+	}
+
+	omitted := map[string]string{
+		"steps": "the executor does not retain the step tree of a container; its setup, action and monitor definitions are in container.json",
+		"logs":  "container logs are streamed to loggregator and are not retained by the executor",
+	}
+
+	archive := newArchive(w, b.clock.Now())
+
+	err = archive.addJSON("container.json", container)
+	if err != nil {
+		return err
+	}
+
+	err = archive.addJSON("state_history.json", b.recorder.StateHistory(guid))
+	if err != nil {
+		return err
+	}
+
+	err = archive.addJSON("events.json", b.recorder.Events(guid))
+	if err != nil {
+		return err
+	}
+
+	metrics, err := b.client.GetBulkMetrics(logger)
+	if m, ok := metrics[guid]; err == nil && ok {
+		err = archive.addJSON("metrics.json", m)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		omitted["metrics"] = err.Error()
+	} else {
+		omitted["metrics"] = "no metrics have been collected for the container"
+	}
+
+	envoyConfig, err := b.envoyConfig(logger, guid)
+	if err == nil {
+		err = archive.add("envoy.yaml", redactYAML(envoyConfig))
+		if err != nil {
+			return err
+		}
+	} else {
+		omitted["envoy.yaml"] = err.Error()
+	}
+
+	err = archive.add("OMITTED", formatOmitted(omitted))
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func (b *Bundler) envoyConfig(logger lager.Logger, guid string) ([]byte, error) {
+	stream, err := b.client.GetFiles(logger, guid, envoyConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	reader := tar.NewReader(stream)
+	_, err = reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func formatOmitted(omitted map[string]string) []byte {
+	names := make([]string, 0, len(omitted))
+	for name := range omitted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s: %s\n", name, omitted[name])
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,65 @@
+package supportbundle
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// Handler serves support bundles on the executor's admin listen address:
+//
+//	GET /bundle
+//	GET /containers/:guid/bundle
+func Handler(logger lager.Logger, bundler *Bundler) http.Handler {
+	logger = logger.Session("support-bundle-handler")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.URL.Path == "/bundle" {
+			var bundle bytes.Buffer
+			err := bundler.WriteCellBundle(logger, &bundle)
+			if err != nil {
+				logger.Error("failed-to-write-cell-bundle", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writeBundle(w, "cell.tgz", bundle.Bytes())
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "containers" || parts[2] != "bundle" || parts[1] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		guid := parts[1]
+
+		var bundle bytes.Buffer
+		err := bundler.WriteContainerBundle(logger, &bundle, guid)
+		if err == executor.ErrContainerNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed-to-write-container-bundle", err, lager.Data{"guid": guid})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeBundle(w, guid+".tgz", bundle.Bytes())
+	})
+}
+
+func writeBundle(w http.ResponseWriter, filename string, bundle []byte) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(bundle)
+}
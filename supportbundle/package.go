@@ -0,0 +1 @@
+package supportbundle // import "code.cloudfoundry.org/executor/supportbundle"
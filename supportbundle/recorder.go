@@ -0,0 +1,173 @@
+package supportbundle
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// RecordedEvent is an executor event together with the time it was received.
+type RecordedEvent struct {
+	Time  time.Time          `json:"time"`
+	Type  executor.EventType `json:"type"`
+	Event executor.Event     `json:"event"`
+}
+
+// StateChange is a container state as observed by a lifecycle event.
+type StateChange struct {
+	Time  time.Time      `json:"time"`
+	State executor.State `json:"state"`
+}
+
+type containerEvent interface {
+	Container() executor.Container
+}
+
+// Recorder subscribes to the executor's events and keeps the most recent
+// ones for every container, so that they can be included in its support
+// bundle. The history of the least recently active containers is dropped
+// once more than maxContainers are being tracked.
+type Recorder struct {
+	logger        lager.Logger
+	client        executor.Client
+	clock         clock.Clock
+	maxEvents     int
+	maxContainers int
+
+	lock   sync.Mutex
+	events map[string][]RecordedEvent
+	order  []string
+}
+
+func NewRecorder(
+	logger lager.Logger,
+	client executor.Client,
+	clock clock.Clock,
+	maxEvents int,
+	maxContainers int,
+) *Recorder {
+	return &Recorder{
+		logger:        logger.Session("support-bundle-recorder"),
+		client:        client,
+		clock:         clock,
+		maxEvents:     maxEvents,
+		maxContainers: maxContainers,
+		events:        map[string][]RecordedEvent{},
+	}
+}
+
+func (r *Recorder) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	source, err := r.client.SubscribeToEvents(r.logger)
+	if err != nil {
+		r.logger.Error("failed-to-subscribe", err)
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			ev, err := source.Next()
+			if err != nil {
+				return
+			}
+			r.record(ev)
+		}
+	}()
+
+	close(ready)
+
+	select {
+	case <-signals:
+		source.Close()
+		<-done
+		return nil
+	case <-done:
+		return nil
+	}
+}
+
+// Events returns the recorded events of the container, oldest first.
+func (r *Recorder) Events(guid string) []RecordedEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]RecordedEvent(nil), r.events[guid]...)
+}
+
+// StateHistory returns the states the container went through according to
+// its recorded lifecycle events.
+func (r *Recorder) StateHistory(guid string) []StateChange {
+	history := []StateChange{}
+	for _, recorded := range r.Events(guid) {
+		lifecycle, ok := recorded.Event.(executor.LifecycleEvent)
+		if !ok {
+			continue
+		}
+		state := lifecycle.Container().State
+		if len(history) > 0 && history[len(history)-1].State == state {
+			continue
+		}
+		history = append(history, StateChange{Time: recorded.Time, State: state})
+	}
+	return history
+}
+
+// RecentEvents returns the n most recent events of all containers, oldest
+// first.
+func (r *Recorder) RecentEvents(n int) []RecordedEvent {
+	r.lock.Lock()
+	all := []RecordedEvent{}
+	for _, events := range r.events {
+		all = append(all, events...)
+	}
+	r.lock.Unlock()
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	if len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all
+}
+
+func (r *Recorder) record(ev executor.Event) {
+	containerEv, ok := ev.(containerEvent)
+	if !ok {
+		return
+	}
+	guid := containerEv.Container().Guid
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	events, tracked := r.events[guid]
+	if !tracked {
+		r.order = append(r.order, guid)
+	} else {
+		r.touch(guid)
+	}
+
+	events = append(events, RecordedEvent{Time: r.clock.Now(), Type: ev.EventType(), Event: ev})
+	if len(events) > r.maxEvents {
+		events = events[len(events)-r.maxEvents:]
+	}
+	r.events[guid] = events
+
+	for len(r.order) > r.maxContainers {
+		delete(r.events, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *Recorder) touch(guid string) {
+	for i, g := range r.order {
+		if g == guid {
+			r.order = append(append(r.order[:i:i], r.order[i+1:]...), guid)
+			return
+		}
+	}
+}
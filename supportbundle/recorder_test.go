@@ -0,0 +1,100 @@
+package supportbundle_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/executor"
+	"code.cloudfoundry.org/executor/fakes"
+	"code.cloudfoundry.org/executor/supportbundle"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Recorder", func() {
+	var (
+		client   *fakes.FakeClient
+		source   *fakes.FakeEventSource
+		events   chan executor.Event
+		clock    *fakeclock.FakeClock
+		recorder *supportbundle.Recorder
+		process  ifrit.Process
+	)
+
+	BeforeEach(func() {
+		events = make(chan executor.Event)
+		source = &fakes.FakeEventSource{}
+		source.NextStub = func() (executor.Event, error) {
+			ev, ok := <-events
+			if !ok {
+				return nil, errors.New("closed")
+			}
+			return ev, nil
+		}
+		source.CloseStub = func() error {
+			close(events)
+			return nil
+		}
+
+		client = &fakes.FakeClient{}
+		client.SubscribeToEventsReturns(source, nil)
+		clock = fakeclock.NewFakeClock(time.Unix(1000, 0))
+		recorder = supportbundle.NewRecorder(lagertest.NewTestLogger("test"), client, clock, 2, 2)
+	})
+
+	JustBeforeEach(func() {
+		process = ifrit.Invoke(recorder)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	container := func(guid string, state executor.State) executor.Container {
+		return executor.Container{Guid: guid, State: state}
+	}
+
+	It("keeps the most recent events of every container", func() {
+		events <- executor.NewContainerReservedEvent(container("guid-1", executor.StateReserved), "")
+		clock.Increment(time.Second)
+		events <- executor.NewContainerRunningEvent(container("guid-1", executor.StateRunning), "")
+		events <- executor.NewContainerCompleteEvent(container("guid-1", executor.StateCompleted), "")
+		events <- executor.NewContainerReservedEvent(container("guid-2", executor.StateReserved), "")
+
+		Eventually(func() []executor.EventType {
+			types := []executor.EventType{}
+			for _, recorded := range recorder.Events("guid-1") {
+				types = append(types, recorded.Type)
+			}
+			return types
+		}).Should(Equal([]executor.EventType{executor.EventTypeContainerRunning, executor.EventTypeContainerComplete}))
+		Expect(recorder.Events("guid-1")[0].Time).To(Equal(time.Unix(1001, 0)))
+	})
+
+	It("derives the state history from lifecycle events", func() {
+		events <- executor.NewContainerReservedEvent(container("guid-1", executor.StateReserved), "")
+		clock.Increment(time.Second)
+		events <- executor.NewContainerRunningEvent(container("guid-1", executor.StateRunning), "")
+
+		Eventually(func() []supportbundle.StateChange { return recorder.StateHistory("guid-1") }).Should(Equal([]supportbundle.StateChange{
+			{Time: time.Unix(1000, 0), State: executor.StateReserved},
+			{Time: time.Unix(1001, 0), State: executor.StateRunning},
+		}))
+	})
+
+	It("drops the history of the least recently active containers", func() {
+		events <- executor.NewContainerReservedEvent(container("guid-1", executor.StateReserved), "")
+		events <- executor.NewContainerReservedEvent(container("guid-2", executor.StateReserved), "")
+		events <- executor.NewContainerRunningEvent(container("guid-1", executor.StateRunning), "")
+		events <- executor.NewContainerReservedEvent(container("guid-3", executor.StateReserved), "")
+
+		Eventually(func() []supportbundle.RecordedEvent { return recorder.Events("guid-3") }).Should(HaveLen(1))
+		Expect(recorder.Events("guid-1")).To(HaveLen(2))
+		Expect(recorder.Events("guid-2")).To(BeEmpty())
+	})
+})